@@ -0,0 +1,132 @@
+// code-switch 命令行：列出与切换 provider，供 Raycast、Alfred 等启动器工作流调用
+// 加 --json 时输出稳定的 JSON（见 services.CommandListOutput / services.CommandSwitchOutput），失败时以状态码 1 退出
+//
+//	code-switch list [platform] [--json]
+//	code-switch switch <platform> <provider> [--json]
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"codeswitch/services"
+)
+
+const usage = `用法:
+  code-switch list [platform] [--json]
+  code-switch switch <platform> <provider> [--json]
+
+platform 可选值: claude、codex、gemini
+`
+
+func main() {
+	args, asJSON := parseArgs(os.Args[1:])
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	providerService := services.NewProviderService()
+	geminiService := services.NewGeminiService(services.RelayListenAddr())
+
+	switch args[0] {
+	case "list":
+		if len(args) > 2 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		platform := ""
+		if len(args) == 2 {
+			platform = args[1]
+		}
+		output, err := services.CommandListProviders(providerService, geminiService, platform)
+		if err != nil {
+			output.OK, output.Error = false, err.Error()
+		}
+		if asJSON {
+			writeJSON(output)
+		} else if err == nil {
+			printList(output)
+		}
+		exitOnError(err, asJSON)
+
+	case "switch":
+		if len(args) != 3 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		// 与应用内切换一致：按应用设置同步写入 Claude Code / Codex 的配置文件
+		relayAddr := services.RelayListenAddr()
+		appSettings := services.NewAppSettingsService(services.NewAutoStartService())
+		services.NewClaudeSettingsService(relayAddr).AttachProviderPush(providerService, appSettings)
+		services.NewCodexSettingsService(relayAddr).AttachProviderPush(providerService, appSettings)
+
+		platform, name := args[1], args[2]
+		err := services.CommandSwitchProvider(providerService, geminiService, platform, name)
+		output := services.CommandSwitchOutput{Version: services.CommandOutputVersion, OK: err == nil, Platform: platform, Provider: name}
+		if err != nil {
+			output.Error = err.Error()
+		}
+		if asJSON {
+			writeJSON(output)
+		} else if err == nil {
+			fmt.Printf("已将 %s 切换到 %s\n", platform, name)
+		}
+		exitOnError(err, asJSON)
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// parseArgs 取出 --json（可以出现在任意位置），返回其余参数
+func parseArgs(raw []string) ([]string, bool) {
+	args := make([]string, 0, len(raw))
+	asJSON := false
+	for _, arg := range raw {
+		if arg == "--json" || arg == "-json" {
+			asJSON = true
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args, asJSON
+}
+
+func printList(output services.CommandListOutput) {
+	for _, platform := range output.Platforms {
+		fmt.Println(platform.Platform)
+		if len(platform.Providers) == 0 {
+			fmt.Println("  （无）")
+		}
+		for _, p := range platform.Providers {
+			marker := " "
+			if p.Current {
+				marker = "*"
+			}
+			state := fmt.Sprintf("level %d", p.Level)
+			if !p.Enabled {
+				state = "未启用"
+			}
+			fmt.Printf("  %s %s (%s)\n", marker, p.Name, state)
+		}
+	}
+}
+
+func writeJSON(v any) {
+	data, _ := json.Marshal(v)
+	os.Stdout.Write(append(data, '\n'))
+}
+
+// exitOnError 失败时以状态码 1 退出；非 JSON 模式下把错误输出到标准错误
+func exitOnError(err error, asJSON bool) {
+	if err == nil {
+		return
+	}
+	if !asJSON {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,30 @@
+// openapi 根据中继管理接口的路由定义生成 OpenAPI 文档，构建时执行以保持文档与代码同步
+//
+//	go run ./cmd/openapi -o build/openapi/admin-api.json
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"codeswitch/services"
+)
+
+func main() {
+	output := flag.String("o", "build/openapi/admin-api.json", "输出文件路径")
+	flag.Parse()
+
+	spec, err := services.AdminOpenAPISpec()
+	if err != nil {
+		log.Fatalf("生成 OpenAPI 文档失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(*output), 0o755); err != nil {
+		log.Fatalf("创建输出目录失败: %v", err)
+	}
+	if err := os.WriteFile(*output, spec, 0o644); err != nil {
+		log.Fatalf("写入 OpenAPI 文档失败: %v", err)
+	}
+	log.Printf("已生成 %s", *output)
+}
@@ -0,0 +1,65 @@
+// providermatrix 用金丝雀提示词测试所有已启用的 provider，输出 JUnit XML 或 JSON 供 CI 使用
+// 存在失败用例时以状态码 1 退出，可用于在版本库中维护“已批准的 provider 列表”
+//
+//	go run ./cmd/providermatrix -format junit -o provider-matrix.xml
+//	go run ./cmd/providermatrix -platform claude -prompts ci/matrix-prompts.json
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"codeswitch/services"
+)
+
+func main() {
+	format := flag.String("format", services.MatrixFormatJUnit, "输出格式: junit 或 json")
+	output := flag.String("o", "", "输出文件路径（默认输出到标准输出）")
+	platform := flag.String("platform", "", "只测试指定平台（claude、codex，逗号分隔）")
+	promptsPath := flag.String("prompts", "", "提示词文件（默认 ~/.code-switch/matrix-prompts.json 或内置提示词）")
+	flag.Parse()
+
+	var platforms []string
+	for _, p := range strings.Split(*platform, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			platforms = append(platforms, p)
+		}
+	}
+
+	prompts, err := services.LoadMatrixPrompts()
+	if *promptsPath != "" {
+		prompts, err = services.LoadMatrixPromptsFile(*promptsPath)
+	}
+	if err != nil {
+		log.Fatalf("加载提示词失败: %v", err)
+	}
+
+	report, err := services.RunProviderMatrix(context.Background(), services.NewProviderService(), platforms, prompts)
+	if err != nil {
+		log.Fatalf("运行测试矩阵失败: %v", err)
+	}
+	data, err := report.Encode(*format)
+	if err != nil {
+		log.Fatalf("生成报告失败: %v", err)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(data)
+	} else {
+		if err := os.MkdirAll(filepath.Dir(*output), 0o755); err != nil {
+			log.Fatalf("创建输出目录失败: %v", err)
+		}
+		if err := os.WriteFile(*output, data, 0o644); err != nil {
+			log.Fatalf("写入报告失败: %v", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "provider 测试矩阵: 共 %d，通过 %d，失败 %d\n", report.Total, report.Passed, report.Failed)
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,36 @@
+// statusline 输出一行 Code Switch 状态（当前 provider、健康状态与当日花费），用于 shell 提示符、tmux 状态栏等
+// 只读取应用定期写入的 ~/.code-switch/statusline.json，需在 relay-config.json 中启用 statusLine
+//
+//	set -g status-right '#(statusline -ascii)'
+//	statusline -format json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"codeswitch/services"
+)
+
+func main() {
+	format := flag.String("format", "text", "输出格式: text 或 json")
+	ascii := flag.Bool("ascii", false, "不使用 Unicode 符号")
+	flag.Parse()
+
+	// 快照不存在或无法解析时按应用未运行输出
+	snapshot, _ := services.LoadStatusLineSnapshot()
+
+	if *format == "json" {
+		if snapshot == nil {
+			fmt.Println("null")
+			return
+		}
+		data, _ := json.Marshal(snapshot)
+		os.Stdout.Write(append(data, '\n'))
+		return
+	}
+	fmt.Println(services.FormatStatusLine(snapshot, *ascii, time.Now()))
+}
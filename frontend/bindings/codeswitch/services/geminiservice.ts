@@ -70,20 +70,21 @@ export function GetPresets(): $CancellablePromise<$models.GeminiPreset[]> {
 }
 
 /**
- * GetProviders 获取已配置的供应商列表
+ * GetStatus 获取当前 Gemini 配置状态
  */
-export function GetProviders(): $CancellablePromise<$models.GeminiProvider[]> {
-    return $Call.ByID(4102812223).then(($result: any) => {
-        return $$createType4($result);
+export function GetStatus(): $CancellablePromise<$models.GeminiStatus | null> {
+    return $Call.ByID(278805041).then(($result: any) => {
+        return $$createType6($result);
     });
 }
 
 /**
- * GetStatus 获取当前 Gemini 配置状态
+ * ListProviders 获取供应商列表，API Key 只返回脱敏后的末 4 位（供前端调用）
+ * 完整的 Key 只能通过 RevealKey 在系统身份验证后读取
  */
-export function GetStatus(): $CancellablePromise<$models.GeminiStatus | null> {
-    return $Call.ByID(278805041).then(($result: any) => {
-        return $$createType6($result);
+export function ListProviders(): $CancellablePromise<$models.GeminiProvider[]> {
+    return $Call.ByID(895626769).then(($result: any) => {
+        return $$createType4($result);
     });
 }
 
@@ -103,6 +104,13 @@ export function ReorderProviders(ids: string[]): $CancellablePromise<void> {
     return $Call.ByID(1005362802, ids);
 }
 
+/**
+ * RevealKey 读取 Gemini 供应商的完整 API Key（供前端调用），验证与审计同 ProviderService.RevealKey
+ */
+export function RevealKey(id: string): $CancellablePromise<string> {
+    return $Call.ByID(1522954335, id);
+}
+
 /**
  * Start Wails生命周期方法
  */
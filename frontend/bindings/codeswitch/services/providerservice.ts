@@ -19,12 +19,24 @@ export function DuplicateProvider(kind: string, sourceID: number): $CancellableP
     });
 }
 
-export function LoadProviders(kind: string): $CancellablePromise<$models.Provider[]> {
-    return $Call.ByID(3413098935, kind).then(($result: any) => {
+/**
+ * ListProviders 获取 provider 列表，API Key 只返回脱敏后的末 4 位（供前端调用）
+ * 完整的 Key 只能通过 RevealKey 在系统身份验证后读取
+ */
+export function ListProviders(kind: string): $CancellablePromise<$models.Provider[]> {
+    return $Call.ByID(143452743, kind).then(($result: any) => {
         return $$createType2($result);
     });
 }
 
+/**
+ * RevealKey 读取 provider 的完整 API Key（供前端调用）
+ * 需要通过系统身份验证（Touch ID / Windows Hello / polkit），成功与失败都会写入审计日志
+ */
+export function RevealKey(kind: string, name: string): $CancellablePromise<string> {
+    return $Call.ByID(295075041, kind, name);
+}
+
 export function SaveProviders(kind: string, providers: $models.Provider[]): $CancellablePromise<void> {
     return $Call.ByID(1034860836, kind, providers);
 }
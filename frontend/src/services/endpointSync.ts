@@ -4,8 +4,8 @@
  * @author sm
  */
 
-import { LoadProviders } from '../../bindings/codeswitch/services/providerservice'
-import { GetProviders as GetGeminiProviders } from '../../bindings/codeswitch/services/geminiservice'
+import { ListProviders } from '../../bindings/codeswitch/services/providerservice'
+import { ListProviders as ListGeminiProviders } from '../../bindings/codeswitch/services/geminiservice'
 
 /**
  * 同步的端点数据结构
@@ -50,7 +50,7 @@ export async function fetchAllProviderEndpoints(): Promise<SyncedEndpoint[]> {
 
   try {
     // 1. 获取 Claude 供应商
-    const claudeProviders = await LoadProviders('claude')
+    const claudeProviders = await ListProviders('claude')
     if (Array.isArray(claudeProviders)) {
       claudeProviders.forEach((p: any) => {
         if (p.apiUrl && p.apiUrl.trim()) {
@@ -71,7 +71,7 @@ export async function fetchAllProviderEndpoints(): Promise<SyncedEndpoint[]> {
 
   try {
     // 2. 获取 Codex 供应商
-    const codexProviders = await LoadProviders('codex')
+    const codexProviders = await ListProviders('codex')
     if (Array.isArray(codexProviders)) {
       codexProviders.forEach((p: any) => {
         if (p.apiUrl && p.apiUrl.trim()) {
@@ -92,7 +92,7 @@ export async function fetchAllProviderEndpoints(): Promise<SyncedEndpoint[]> {
 
   try {
     // 3. 获取 Gemini 供应商
-    const geminiProviders = await GetGeminiProviders()
+    const geminiProviders = await ListGeminiProviders()
     if (Array.isArray(geminiProviders)) {
       geminiProviders.forEach((p: any) => {
         if (p.baseUrl && p.baseUrl.trim()) {
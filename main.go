@@ -66,6 +66,8 @@ func (a *AppService) OpenSecondWindow() {
 // logs any error that might occur.
 func main() {
 	appservice := &AppService{}
+	// 记录各服务的启动进度（窗口显示前只做必要的同步初始化，其余服务在后台启动）
+	readinessService := services.NewReadinessService()
 
 	// 【更新恢复】Windows 平台：检查并从失败的更新中恢复
 	checkAndRecoverFromFailedUpdate()
@@ -73,20 +75,12 @@ func main() {
 	// 【残留清理】全平台：清理更新过程中的临时文件（Windows/Linux/macOS）
 	cleanupOldFiles()
 
-	// 【修复】第一步：初始化数据库（必须最先执行）
-	// 解决问题：InitGlobalDBQueue 依赖 xdb.DB("default")，但 xdb.Inits() 在 NewProviderRelayService 中
-	if err := services.InitDatabase(); err != nil {
-		log.Fatalf("数据库初始化失败: %v", err)
+	// 回滚上次运行时未完成的跨文件操作（必须在各服务读取配置前执行）
+	if n := services.RecoverConfigTransactions(); n > 0 {
+		log.Printf("已回滚 %d 个未完成的配置操作", n)
 	}
-	log.Println("✅ 数据库已初始化")
-
-	// 【修复】第二步：初始化写入队列（依赖数据库连接）
-	if err := services.InitGlobalDBQueue(); err != nil {
-		log.Fatalf("初始化数据库队列失败: %v", err)
-	}
-	log.Println("✅ 数据库写入队列已启动")
 
-	// 【修复】第三步：创建服务（现在可以安全使用数据库了）
+	// 创建服务（构造时不访问数据库，数据库在窗口显示后初始化）
 	suiService, errt := services.NewSuiStore()
 	if errt != nil {
 		log.Fatalf("SuiStore 初始化失败: %v", errt)
@@ -97,13 +91,18 @@ func main() {
 	autoStartService := services.NewAutoStartService()
 	appSettings := services.NewAppSettingsService(autoStartService)
 	notificationService := services.NewNotificationService(appSettings) // 通知服务
+	readinessService.SetNotificationService(notificationService)
 	blacklistService := services.NewBlacklistService(settingsService, notificationService)
-	geminiService := services.NewGeminiService("127.0.0.1:18100")
-	providerRelay := services.NewProviderRelayService(providerService, geminiService, blacklistService, notificationService, ":18100")
+	relayAddr := services.RelayListenAddr()
+	geminiService := services.NewGeminiService("127.0.0.1" + relayAddr)
+	providerRelay := services.NewProviderRelayService(providerService, geminiService, blacklistService, notificationService, relayAddr)
 	claudeSettings := services.NewClaudeSettingsService(providerRelay.Addr())
+	claudeSettings.AttachProviderPush(providerService, appSettings)
 	codexSettings := services.NewCodexSettingsService(providerRelay.Addr())
+	codexSettings.AttachProviderPush(providerService, appSettings)
 	cliConfigService := services.NewCliConfigService(providerRelay.Addr())
 	logService := services.NewLogService()
+	dataPurgeService := services.NewDataPurgeService(providerService, geminiService)
 	updateService := services.NewUpdateService(AppVersion)
 	mcpService := services.NewMCPService()
 	skillService := services.NewSkillService()
@@ -116,6 +115,28 @@ func main() {
 	dockService := dock.New()
 	versionService := NewVersionService()
 	consoleService := services.NewConsoleService()
+	crashReportService := services.NewCrashReportService(consoleService, AppVersion, notificationService)
+	transcriptService := services.NewTranscriptService()
+	networkMonitor := services.NewNetworkMonitorService(notificationService)
+	providerRelay.SetNetworkMonitor(networkMonitor)
+	startupCheckService := services.NewStartupCheckService(providerService, providerRelay)
+	latencyTrendService := services.NewLatencyTrendService(notificationService)
+	sloService := services.NewSLOService(notificationService)
+	rollupService := services.NewRollupService(logService)
+	reportService := services.NewReportService(notificationService)
+	batchService := services.NewBatchService(providerService)
+	keyHealthService := services.NewKeyHealthService(providerService, notificationService)
+	policyService := services.NewPolicyService()
+	lanDiscoveryService := services.NewLanDiscoveryService(providerService, relayAddr, AppVersion)
+	statusPageService := services.NewStatusPageService(blacklistService, notificationService)
+	capabilityService := services.NewCapabilityService(providerService)
+	integrityService := services.NewIntegrityService(notificationService)
+	editorCompanion := services.NewEditorCompanionService(providerRelay)
+	statusLineService := services.NewStatusLineService(providerRelay)
+	providerWizardService := services.NewProviderWizardService(providerService, geminiService)
+	jobScheduler := services.NewJobScheduler()
+	pathService := services.NewPathService()
+	resumeWatchService := services.NewResumeWatchService(blacklistService, connectivityTestService, networkMonitor, notificationService)
 
 	// 应用待处理的更新
 	go func() {
@@ -134,40 +155,86 @@ func main() {
 		}()
 	}
 
-	go func() {
-		if err := providerRelay.Start(); err != nil {
-			log.Printf("provider relay start error: %v", err)
-		}
-	}()
-
-	// 启动黑名单自动恢复定时器（每分钟检查一次）
-	go func() {
-		ticker := time.NewTicker(1 * time.Minute)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			if err := blacklistService.AutoRecoverExpired(); err != nil {
-				log.Printf("自动恢复黑名单失败: %v", err)
+	// 基础设施：应用启动（窗口显示）后最先依次初始化，失败时无法继续运行
+	coreServices := []startupService{
+		// 初始化数据库（InitGlobalDBQueue 依赖 xdb.DB("default")）
+		{name: "database", start: services.InitDatabase},
+		// 初始化写入队列（依赖数据库连接）
+		{name: "dbQueue", start: services.InitGlobalDBQueue},
+	}
+	// 后台服务：基础设施就绪后并行启动（after 指定须先完成的服务），每个服务完成时发送 service:ready 事件
+	backgroundServices := []startupService{
+		// 启动自检（与中继并行，端口检查会识别中继自身的监听）
+		{name: "startupCheck", start: func() error {
+			if report := startupCheckService.RunStartupChecks(); report.OK {
+				log.Println("✅ 启动自检通过")
+			}
+			return nil
+		}},
+		// 为 provider 分配稳定 ID，并为数据库记录补齐（须在中继开始转发前执行）
+		{name: "providerIdentities", start: func() error {
+			providerService.MigrateProviderIdentities(geminiService)
+			return nil
+		}},
+		{name: "providerRelay", start: providerRelay.Start, after: "providerIdentities"},
+		// 提示上次运行期间产生的崩溃报告
+		{name: "crashReportService", start: crashReportService.Start},
+		// 启动后台任务调度（各服务的定时任务统一由调度器触发）
+		{name: "jobScheduler", start: jobScheduler.Start},
+		// 启动网络监测（离线模式，未启用时只保持在线状态）
+		{name: "networkMonitor", start: networkMonitor.Start},
+		// 启动端点延迟趋势评估（未启用告警时只清理过期样本）
+		{name: "latencyTrendService", start: latencyTrendService.Start},
+		// 启动 SLO 评估（未启用时不评估）
+		{name: "sloService", start: sloService.Start},
+		// 启动请求指标汇总（按保留策略清理原始记录）
+		{name: "rollupService", start: rollupService.Start},
+		// 启动定期摘要报告（未启用时不生成）
+		{name: "reportService", start: reportService.Start},
+		// 启动密钥健康检查
+		{name: "keyHealthService", start: keyHealthService.Start},
+		// 启动上游官方状态页检查（未启用时仅等待下一轮）
+		{name: "statusPageService", start: statusPageService.Start},
+		// provider 能力数据集（未配置数据集地址时仅等待下一轮）
+		{name: "capabilityService", start: capabilityService.Start},
+		// 定期校验配置文件与数据库表结构
+		{name: "integrityService", start: integrityService.Start},
+		// 编辑器扩展接口（未启用时仅等待配置变化）
+		{name: "editorCompanion", start: editorCompanion.Start},
+		{name: "statusLineService", start: statusLineService.Start},
+		// 按管理员策略的保留期限定期清理数据（无策略时不启动）
+		{name: "policyService", start: policyService.Start},
+		// 在局域网广播本机中继（discovery.advertise 开启时）
+		{name: "lanDiscoveryService", start: lanDiscoveryService.Start},
+		// 启动系统唤醒检测
+		{name: "resumeWatchService", start: resumeWatchService.Start},
+		// 启动批量任务轮询
+		{name: "batchService", start: batchService.Start},
+		// 启动黑名单自动恢复定时器（每分钟检查一次）
+		{name: "blacklistService", start: blacklistService.Start},
+		// 根据 AppSettings 配置启动自动连通性检测（首次测试在调度器启动宽限期后执行）
+		{name: "connectivityAutoTest", start: func() error {
+			settings, err := appSettings.GetAppSettings()
+			if err != nil {
+				return fmt.Errorf("读取应用设置失败: %w", err)
+			}
+			if !settings.AutoConnectivityTest {
+				return nil
 			}
-		}
-	}()
-
-	// 根据 AppSettings 配置启动自动连通性检测
-	go func() {
-		time.Sleep(3 * time.Second) // 延迟3秒，等待应用初始化
-		settings, err := appSettings.GetAppSettings()
-		if err != nil {
-			log.Printf("读取应用设置失败: %v", err)
-			return
-		}
-		if settings.AutoConnectivityTest {
 			if err := connectivityTestService.SetAutoTestEnabled(true); err != nil {
-				log.Printf("启动自动连通性检测失败: %v", err)
-			} else {
-				log.Println("✅ 自动连通性检测已启动")
+				return err
 			}
-		}
-	}()
+			log.Println("✅ 自动连通性检测已启动")
+			return nil
+		}},
+	}
+	for _, svc := range coreServices {
+		readinessService.Register(services.StartupPhaseCore, svc.name)
+	}
+	for _, svc := range backgroundServices {
+		readinessService.Register(services.StartupPhaseBackground, svc.name)
+	}
+	readinessService.Seal()
 
 	//fmt.Println(clipboardService)
 	// Create a new Wails application by providing the necessary options.
@@ -188,6 +255,7 @@ func main() {
 			application.NewService(codexSettings),
 			application.NewService(cliConfigService),
 			application.NewService(logService),
+			application.NewService(dataPurgeService),
 			application.NewService(appSettings),
 			application.NewService(updateService),
 			application.NewService(mcpService),
@@ -198,10 +266,36 @@ func main() {
 			application.NewService(deeplinkService),
 			application.NewService(speedTestService),
 			application.NewService(connectivityTestService),
+			application.NewService(resumeWatchService),
 			application.NewService(dockService),
 			application.NewService(versionService),
 			application.NewService(geminiService),
 			application.NewService(consoleService),
+			application.NewService(transcriptService),
+			application.NewService(networkMonitor),
+			application.NewService(startupCheckService),
+			application.NewService(latencyTrendService),
+			application.NewService(sloService),
+			application.NewService(rollupService),
+			application.NewService(reportService),
+			application.NewService(batchService),
+			application.NewService(keyHealthService),
+			application.NewService(statusPageService),
+			application.NewService(capabilityService),
+			application.NewService(integrityService),
+			application.NewService(editorCompanion),
+			application.NewService(statusLineService),
+			application.NewService(providerWizardService),
+			application.NewService(policyService),
+			application.NewService(lanDiscoveryService),
+			application.NewService(jobScheduler),
+			application.NewService(readinessService),
+			application.NewService(crashReportService),
+			application.NewService(pathService),
+		},
+		// 前端调用中的 panic 写入本地崩溃报告，不再直接退出应用
+		PanicHandler: func(details *application.PanicDetails) {
+			services.RecordCrash("binding", details.Error, details.FullStackTrace)
 		},
 		Assets: application.AssetOptions{
 			Handler: application.AssetFileServerFS(assets),
@@ -216,6 +310,24 @@ func main() {
 
 	app.OnShutdown(func() {
 		_ = providerRelay.Stop()
+		_ = networkMonitor.Stop()
+		_ = latencyTrendService.Stop()
+		_ = sloService.Stop()
+		_ = rollupService.Stop()
+		_ = reportService.Stop()
+		_ = batchService.Stop()
+		_ = keyHealthService.Stop()
+		_ = statusPageService.Stop()
+		_ = capabilityService.Stop()
+		_ = integrityService.Stop()
+		_ = editorCompanion.Stop()
+		_ = statusLineService.Stop()
+		_ = policyService.Stop()
+		_ = lanDiscoveryService.Stop()
+		_ = resumeWatchService.Stop()
+		_ = blacklistService.Stop()
+		_ = connectivityTestService.Stop()
+		_ = jobScheduler.Stop()
 
 		// 优雅关闭数据库写入队列（10秒超时，双队列架构）
 		if err := services.ShutdownGlobalDBQueue(10 * time.Second); err != nil {
@@ -341,6 +453,11 @@ func main() {
 		// }
 	}()
 
+	// 应用启动（窗口显示）后再初始化数据库并启动各服务，不阻塞窗口显示
+	app.Event.OnApplicationEvent(events.Common.ApplicationStarted, func(event *application.ApplicationEvent) {
+		go startServices(readinessService, coreServices, backgroundServices)
+	})
+
 	// Run the application. This blocks until the application has been exited.
 	err := app.Run()
 
@@ -350,6 +467,37 @@ func main() {
 	}
 }
 
+// startupService 启动阶段需要启动的服务
+type startupService struct {
+	name  string
+	start func() error
+	after string // 须先启动完成的服务（为空时基础设施就绪后立即启动）
+}
+
+// startServices 依次初始化基础设施，再并行启动各后台服务
+func startServices(readiness *services.ReadinessService, core, background []startupService) {
+	for _, svc := range core {
+		if err := readiness.Run(services.StartupPhaseCore, svc.name, svc.start); err != nil {
+			log.Fatalf("%s 初始化失败: %v", svc.name, err)
+		}
+	}
+	log.Println("✅ 数据库已初始化")
+
+	done := make(map[string]chan struct{}, len(background))
+	for _, svc := range background {
+		done[svc.name] = make(chan struct{})
+	}
+	for _, svc := range background {
+		go func() {
+			defer close(done[svc.name])
+			if wait, ok := done[svc.after]; ok {
+				<-wait
+			}
+			_ = readiness.Run(services.StartupPhaseBackground, svc.name, svc.start)
+		}()
+	}
+}
+
 func loadTrayIcon(path string) []byte {
 	data, err := trayIcons.ReadFile(path)
 	if err != nil {
@@ -424,12 +572,7 @@ func checkAndRecoverFromFailedUpdate() {
 // cleanupOldFiles 清理更新过程中的残留文件
 // 在主程序启动时调用 - 支持所有平台
 func cleanupOldFiles() {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return
-	}
-
-	updateDir := filepath.Join(home, ".code-switch", "updates")
+	updateDir := filepath.Join(services.ConfigDir(), "updates")
 	if _, err := os.Stat(updateDir); os.IsNotExist(err) {
 		return // 更新目录不存在
 	}
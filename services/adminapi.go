@@ -0,0 +1,396 @@
+package services
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// 管理接口令牌权限（按级别递增，高级别包含低级别的全部权限）
+const (
+	AdminScopeReadOnly = "read-only"       // 查询健康状态与 provider 列表（不含 Key）
+	AdminScopeSwitch   = "switch-provider" // 额外允许切换 provider、解除拉黑
+	AdminScopeAdmin    = "full-admin"      // 额外允许读取 API Key 与审计日志
+)
+
+// adminMinTokenLength 管理令牌最短长度
+const adminMinTokenLength = 16
+
+// adminTokenContextKey gin 上下文中保存当前令牌名称的键
+const adminTokenContextKey = "adminToken"
+
+// AdminToken 管理接口令牌
+// 通过 GenerateAdminToken 生成的令牌只在配置中保存 SHA-256 摘要，令牌值保存在系统钥匙串中
+type AdminToken struct {
+	Name      string `json:"name"`                // 令牌名称，用于审计归属（如 ci-health）
+	Token     string `json:"token,omitempty"`     // 令牌值，请求时通过 Authorization: Bearer <token> 携带
+	TokenHash string `json:"tokenHash,omitempty"` // 令牌值的 SHA-256 摘要（十六进制），与 Token 二选一
+	Keychain  bool   `json:"keychain,omitempty"`  // 令牌值是否保存在系统钥匙串中（可通过 RevealAdminToken 读取）
+	Scope     string `json:"scope"`               // read-only / switch-provider / full-admin
+	CreatedAt int64  `json:"createdAt,omitempty"` // 生成或轮换时间（Unix 时间戳）
+	ExpiresAt int64  `json:"expiresAt,omitempty"` // 过期时间（Unix 时间戳），0 表示永不过期
+}
+
+// AdminProviderView 管理接口返回的 provider 信息（不含 API Key）
+type AdminProviderView struct {
+	Name             string `json:"name"`
+	APIURL           string `json:"apiUrl"`
+	Enabled          bool   `json:"enabled"`
+	Level            int    `json:"level"`
+	HasKey           bool   `json:"hasKey"`
+	Blacklisted      bool   `json:"blacklisted"`
+	BlacklistedUntil string `json:"blacklistedUntil,omitempty"`
+}
+
+func adminScopeRank(scope string) int {
+	switch scope {
+	case AdminScopeReadOnly:
+		return 1
+	case AdminScopeSwitch:
+		return 2
+	case AdminScopeAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// validateAdminAPIConfig 校验管理接口配置
+func validateAdminAPIConfig(config RelayAdminAPIConfig) error {
+	names := make(map[string]bool, len(config.Tokens))
+	values := make(map[string]bool, len(config.Tokens))
+	for _, token := range config.Tokens {
+		if strings.TrimSpace(token.Name) == "" {
+			return fmt.Errorf("管理令牌名称不能为空")
+		}
+		if names[token.Name] {
+			return fmt.Errorf("管理令牌名称重复: %s", token.Name)
+		}
+		names[token.Name] = true
+		hash := token.TokenHash
+		if hash != "" {
+			if token.Token != "" {
+				return fmt.Errorf("管理令牌 %s 不能同时配置令牌值与摘要", token.Name)
+			}
+			if !isAdminTokenHash(hash) {
+				return fmt.Errorf("管理令牌 %s 的摘要无效（需为 64 位十六进制 SHA-256）", token.Name)
+			}
+		} else {
+			if len(token.Token) < adminMinTokenLength {
+				return fmt.Errorf("管理令牌 %s 的长度不能少于 %d 个字符", token.Name, adminMinTokenLength)
+			}
+			hash = adminTokenHash(token.Token)
+		}
+		if values[hash] {
+			return fmt.Errorf("管理令牌 %s 与其他令牌的值重复", token.Name)
+		}
+		values[hash] = true
+		if token.ExpiresAt < 0 {
+			return fmt.Errorf("管理令牌 %s 的过期时间无效", token.Name)
+		}
+		if adminScopeRank(token.Scope) == 0 {
+			return fmt.Errorf("管理令牌 %s 的权限无效: %s（可选值: read-only、switch-provider、full-admin）", token.Name, token.Scope)
+		}
+	}
+	if config.Enabled && len(config.Tokens) == 0 {
+		return fmt.Errorf("启用管理接口时至少需要配置一个令牌")
+	}
+	return nil
+}
+
+// matchAdminToken 按令牌值查找（常量时间比较，避免时序侧信道）
+func matchAdminToken(tokens []AdminToken, presented string) *AdminToken {
+	if presented == "" {
+		return nil
+	}
+	presentedHash := adminTokenHash(presented)
+	var matched *AdminToken
+	for i := range tokens {
+		if tokens[i].TokenHash != "" {
+			if subtle.ConstantTimeCompare([]byte(tokens[i].TokenHash), []byte(presentedHash)) == 1 {
+				matched = &tokens[i]
+			}
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(tokens[i].Token), []byte(presented)) == 1 {
+			matched = &tokens[i]
+		}
+	}
+	return matched
+}
+
+// adminAuth 校验令牌及其权限；未启用管理接口时返回 404，与未注册路由一致
+func adminAuth(required string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		config := currentRelayConfig().AdminAPI
+		if !config.Enabled {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "admin api disabled"})
+			return
+		}
+
+		presented := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		token := matchAdminToken(config.Tokens, presented)
+		if token == nil {
+			recordAudit("admin_api", "auth_failed", fmt.Sprintf("%s %s 来自 %s", c.Request.Method, c.Request.URL.Path, c.ClientIP()))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			return
+		}
+		if token.expired(time.Now()) {
+			recordAudit("admin_api", "token_expired", fmt.Sprintf("令牌 %s 已过期，拒绝 %s %s", token.Name, c.Request.Method, c.Request.URL.Path))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "admin token expired"})
+			return
+		}
+		adminTokenUsage.touch(token.Name, c.ClientIP(), time.Now())
+		if adminScopeRank(token.Scope) < adminScopeRank(required) {
+			recordAudit("admin_api", "forbidden", fmt.Sprintf("令牌 %s（%s）尝试 %s %s", token.Name, token.Scope, c.Request.Method, c.Request.URL.Path))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("令牌权限不足，需要 %s", required)})
+			return
+		}
+		c.Set(adminTokenContextKey, token.Name)
+		c.Next()
+	}
+}
+
+// AdminHealthResponse GET /admin/health 的响应
+type AdminHealthResponse struct {
+	Status    string                         `json:"status"`
+	Offline   bool                           `json:"offline"`
+	Platforms map[string][]AdminProviderView `json:"platforms"`
+	LastUsed  map[string]*LastUsedProvider   `json:"lastUsed"`
+}
+
+// AdminProvidersResponse GET /admin/providers/:platform 的响应
+type AdminProvidersResponse struct {
+	Providers []AdminProviderView `json:"providers"`
+}
+
+// AdminOKResponse 操作类接口的响应
+type AdminOKResponse struct {
+	OK bool `json:"ok"`
+}
+
+// AdminKeyResponse GET /admin/providers/:platform/:name/key 的响应
+type AdminKeyResponse struct {
+	APIKey string `json:"apiKey"`
+}
+
+// AdminAuditResponse GET /admin/audit 的响应
+type AdminAuditResponse struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+// AdminErrorResponse 管理接口的错误响应
+type AdminErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// adminRoute 管理接口路由定义：注册路由与生成 OpenAPI 文档共用，保证两者一致
+type adminRoute struct {
+	method   string
+	path     string // gin 路由格式，如 /providers/:platform
+	scope    string
+	summary  string
+	response any // 成功响应的类型（零值）
+	handler  gin.HandlerFunc
+}
+
+// adminRoutes 全部管理接口（路径相对 /admin）
+func (prs *ProviderRelayService) adminRoutes() []adminRoute {
+	return []adminRoute{
+		{http.MethodGet, "/health", AdminScopeReadOnly, "查询中继状态、各平台 provider 与最近使用的 provider", AdminHealthResponse{}, prs.adminHealth},
+		{http.MethodGet, "/providers/:platform", AdminScopeReadOnly, "列出平台的 provider（不含 API Key）", AdminProvidersResponse{}, prs.adminListProviders},
+		{http.MethodPost, "/providers/:platform/:name/switch", AdminScopeSwitch, "切换到指定 provider", AdminOKResponse{}, prs.adminSwitchProvider},
+		{http.MethodPost, "/providers/:platform/:name/unblock", AdminScopeSwitch, "解除 provider 的拉黑状态", AdminOKResponse{}, prs.adminUnblockProvider},
+		{http.MethodGet, "/providers/:platform/:name/key", AdminScopeAdmin, "读取 provider 的 API Key", AdminKeyResponse{}, prs.adminRevealKey},
+		{http.MethodGet, "/audit", AdminScopeAdmin, "查询最近 200 条审计日志", AdminAuditResponse{}, prs.adminAuditLogs},
+	}
+}
+
+// registerAdminRoutes 注册管理接口（默认关闭，需在 relay-config.json 的 adminApi 中启用并配置令牌）
+func (prs *ProviderRelayService) registerAdminRoutes(router gin.IRouter) {
+	admin := router.Group("/admin")
+	for _, route := range prs.adminRoutes() {
+		admin.Handle(route.method, route.path, adminAuth(route.scope), route.handler)
+	}
+	admin.GET("/openapi.json", adminOpenAPIHandler)
+}
+
+// adminAudit 以令牌名称记录审计日志
+func adminAudit(c *gin.Context, action, detail string) {
+	recordAudit("admin_api", action, fmt.Sprintf("[%s] %s", c.GetString(adminTokenContextKey), detail))
+}
+
+func (prs *ProviderRelayService) adminHealth(c *gin.Context) {
+	platforms := make(map[string][]AdminProviderView)
+	for _, platform := range []string{"claude", "codex", "gemini"} {
+		views, err := prs.adminProviderViews(platform)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		platforms[platform] = views
+	}
+	c.JSON(http.StatusOK, AdminHealthResponse{
+		Status:    "ok",
+		Offline:   prs.isOffline(),
+		Platforms: platforms,
+		LastUsed:  prs.GetAllLastUsedProviders(),
+	})
+}
+
+func (prs *ProviderRelayService) adminListProviders(c *gin.Context) {
+	views, err := prs.adminProviderViews(c.Param("platform"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, AdminProvidersResponse{Providers: views})
+}
+
+func (prs *ProviderRelayService) adminSwitchProvider(c *gin.Context) {
+	platform, name := c.Param("platform"), c.Param("name")
+	if err := prs.switchProviderByName(platform, name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adminAudit(c, "switch_provider", fmt.Sprintf("切换 %s 到 %s", platform, name))
+	c.JSON(http.StatusOK, AdminOKResponse{OK: true})
+}
+
+func (prs *ProviderRelayService) adminUnblockProvider(c *gin.Context) {
+	platform, name := c.Param("platform"), c.Param("name")
+	if err := prs.blacklistService.ManualUnblockAndReset(platform, name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adminAudit(c, "unblock_provider", fmt.Sprintf("解除拉黑 %s/%s", platform, name))
+	c.JSON(http.StatusOK, AdminOKResponse{OK: true})
+}
+
+func (prs *ProviderRelayService) adminRevealKey(c *gin.Context) {
+	if currentPolicy().DisableKeyExport {
+		c.JSON(http.StatusForbidden, gin.H{"error": "管理员策略已禁止导出 API Key"})
+		return
+	}
+	platform, name := c.Param("platform"), c.Param("name")
+	key, found := "", false
+	switch platform {
+	case "claude", "codex":
+		providers, err := prs.providerService.LoadProviders(platform)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, p := range providers {
+			if p.Name == name {
+				key, found = p.APIKey, true
+				break
+			}
+		}
+	case "gemini":
+		for _, p := range prs.geminiService.GetProviders() {
+			if p.Name == name {
+				key, found = p.APIKey, true
+				break
+			}
+		}
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("provider 不存在: %s/%s", platform, name)})
+		return
+	}
+	// 与 RevealKey 相同，完整 Key 需在本机通过系统身份验证后才返回
+	if err := osAuthenticate(fmt.Sprintf("管理 API 读取 %s 的 API Key", name)); err != nil {
+		adminAudit(c, "reveal_key_denied", fmt.Sprintf("读取 %s/%s 的 API Key：%v", platform, name, err))
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	adminAudit(c, "reveal_key", fmt.Sprintf("读取 %s/%s 的 API Key（已通过系统身份验证）", platform, name))
+	c.JSON(http.StatusOK, AdminKeyResponse{APIKey: key})
+}
+
+func (prs *ProviderRelayService) adminAuditLogs(c *gin.Context) {
+	records, err := sharedModel("audit_log").Selects(xdb.OrderByDesc("id"), xdb.Limit(200))
+	if err != nil && !isNoSuchTableErr(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	entries := make([]AuditEntry, 0, len(records))
+	for _, record := range records {
+		entries = append(entries, AuditEntry{
+			ID:        record.GetInt64("id"),
+			Category:  record.GetString("category"),
+			Action:    record.GetString("action"),
+			Detail:    record.GetString("detail"),
+			CreatedAt: recordTimeString(record, "created_at"),
+		})
+	}
+	c.JSON(http.StatusOK, AdminAuditResponse{Entries: entries})
+}
+
+// adminProviderViews 汇总 provider 配置与黑名单状态（不含 API Key）
+func (prs *ProviderRelayService) adminProviderViews(platform string) ([]AdminProviderView, error) {
+	views := []AdminProviderView{}
+	appendView := func(name, apiURL string, enabled bool, level int, hasKey bool) {
+		view := AdminProviderView{Name: name, APIURL: apiURL, Enabled: enabled, Level: level, HasKey: hasKey}
+		if blacklisted, until := prs.blacklistService.IsBlacklisted(platform, name); blacklisted {
+			view.Blacklisted = true
+			view.BlacklistedUntil = until.Format(timeLayout)
+		}
+		views = append(views, view)
+	}
+
+	switch platform {
+	case "claude", "codex":
+		providers, err := prs.providerService.LoadProviders(platform)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range providers {
+			appendView(p.Name, p.APIURL, p.Enabled, p.Level, p.APIKey != "")
+		}
+	case "gemini":
+		if prs.geminiService != nil {
+			for _, p := range prs.geminiService.GetProviders() {
+				appendView(p.Name, p.BaseURL, p.Enabled, p.Level, p.APIKey != "")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("无效的平台: %s", platform)
+	}
+	return views, nil
+}
+
+// switchProviderByName 按平台与名称切换 provider
+func (prs *ProviderRelayService) switchProviderByName(platform, name string) error {
+	switch platform {
+	case "claude", "codex":
+		return prs.providerService.SwitchProvider(platform, name)
+	case "gemini":
+		return prs.switchGeminiProviderByName(name)
+	default:
+		return fmt.Errorf("无效的平台: %s", platform)
+	}
+}
+
+// switchGeminiProviderByName 按名称切换 Gemini provider
+func (prs *ProviderRelayService) switchGeminiProviderByName(name string) error {
+	return switchGeminiByName(prs.geminiService, name)
+}
+
+func switchGeminiByName(geminiService *GeminiService, name string) error {
+	if geminiService == nil {
+		return fmt.Errorf("Gemini 服务不可用")
+	}
+	for _, p := range geminiService.GetProviders() {
+		if p.Name == name {
+			return geminiService.SwitchProvider(p.ID)
+		}
+	}
+	return fmt.Errorf("未找到名为 '%s' 的供应商", name)
+}
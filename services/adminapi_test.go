@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateAdminAPIConfig(t *testing.T) {
+	valid := AdminToken{Name: "ci", Token: "0123456789abcdef", Scope: AdminScopeReadOnly}
+	tests := []struct {
+		name    string
+		config  RelayAdminAPIConfig
+		wantErr bool
+	}{
+		{"未启用且无令牌", RelayAdminAPIConfig{}, false},
+		{"启用但无令牌", RelayAdminAPIConfig{Enabled: true}, true},
+		{"有效令牌", RelayAdminAPIConfig{Enabled: true, Tokens: []AdminToken{valid}}, false},
+		{"令牌过短", RelayAdminAPIConfig{Tokens: []AdminToken{{Name: "a", Token: "short", Scope: AdminScopeAdmin}}}, true},
+		{"权限无效", RelayAdminAPIConfig{Tokens: []AdminToken{{Name: "a", Token: "0123456789abcdef", Scope: "root"}}}, true},
+		{"名称重复", RelayAdminAPIConfig{Tokens: []AdminToken{valid, {Name: "ci", Token: "fedcba9876543210", Scope: AdminScopeAdmin}}}, true},
+		{"令牌值重复", RelayAdminAPIConfig{Tokens: []AdminToken{valid, {Name: "ops", Token: valid.Token, Scope: AdminScopeAdmin}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAdminAPIConfig(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("validateAdminAPIConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchAdminToken_ScopeRank(t *testing.T) {
+	tokens := []AdminToken{
+		{Name: "ci", Token: "read-token-000000", Scope: AdminScopeReadOnly},
+		{Name: "ops", Token: "admin-token-00000", Scope: AdminScopeAdmin},
+	}
+	if got := matchAdminToken(tokens, "read-token-000000"); got == nil || got.Name != "ci" {
+		t.Fatalf("matchAdminToken() = %v, want ci", got)
+	}
+	if got := matchAdminToken(tokens, "unknown"); got != nil {
+		t.Errorf("未知令牌不应匹配，实际为 %s", got.Name)
+	}
+	if adminScopeRank(AdminScopeReadOnly) >= adminScopeRank(AdminScopeSwitch) ||
+		adminScopeRank(AdminScopeSwitch) >= adminScopeRank(AdminScopeAdmin) {
+		t.Error("权限级别应为 read-only < switch-provider < full-admin")
+	}
+}
+
+func TestAdminRevealKeyRequiresOSAuth(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "a", APIURL: "https://api.example.com", APIKey: "sk-secret-key-1234"}}); err != nil {
+		t.Fatal(err)
+	}
+	prs := &ProviderRelayService{providerService: ps}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/providers/:platform/:name/key", prs.adminRevealKey)
+
+	original := osAuthenticate
+	defer func() { osAuthenticate = original }()
+
+	osAuthenticate = func(string) error { return errors.New("denied") }
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/providers/claude/a/key", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("未通过系统身份验证应返回 403，得到 %d", w.Code)
+	}
+
+	osAuthenticate = func(string) error { return nil }
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/providers/claude/a/key", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("通过系统身份验证应返回 200，得到 %d", w.Code)
+	}
+}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 管理令牌管理：由应用生成随机令牌，令牌值保存在系统钥匙串中，relay-config.json 只保存 SHA-256 摘要，
+// 避免用户在配置文件中手工维护明文密钥。令牌可以设置有效期、随时轮换或吊销；最近一次使用时间与来源 IP
+// 记录在 admin_token_usage 表中（同一令牌每分钟最多写入一次）。钥匙串不可用时令牌仍然有效，但只在生成时显示一次。
+
+const (
+	// adminTokenPrefix 生成的令牌前缀，便于在日志与密钥扫描中识别
+	adminTokenPrefix = "csadm_"
+	// maxAdminTokenTTLDays 令牌有效期上限（天）
+	maxAdminTokenTTLDays = 3650
+	// adminTokenUsageFlushInterval 同一令牌使用记录的最短写库间隔
+	adminTokenUsageFlushInterval = time.Minute
+)
+
+// AdminTokenInfo 管理令牌信息（不含令牌值）
+type AdminTokenInfo struct {
+	Name       string `json:"name"`
+	Scope      string `json:"scope"`
+	Keychain   bool   `json:"keychain"`             // 令牌值保存在系统钥匙串中
+	Plaintext  bool   `json:"plaintext"`            // 令牌值以明文保存在 relay-config.json 中（建议轮换）
+	CreatedAt  int64  `json:"createdAt,omitempty"`  // Unix 时间戳
+	ExpiresAt  int64  `json:"expiresAt,omitempty"`  // Unix 时间戳，0 表示永不过期
+	Expired    bool   `json:"expired"`              // 已过期
+	LastUsedAt int64  `json:"lastUsedAt,omitempty"` // 最近一次通过校验的时间（Unix 时间戳）
+	LastUsedIP string `json:"lastUsedIp,omitempty"` // 最近一次使用的来源 IP
+	UseCount   int64  `json:"useCount"`             // 累计使用次数
+}
+
+// adminTokenHash 令牌值的 SHA-256 摘要（十六进制）
+func adminTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// isAdminTokenHash 是否为合法的 SHA-256 十六进制摘要
+func isAdminTokenHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// expired 令牌在 now 时是否已过期
+func (t AdminToken) expired(now time.Time) bool {
+	return t.ExpiresAt > 0 && now.Unix() >= t.ExpiresAt
+}
+
+// adminTokenKeychainAccount 令牌在钥匙串中的账户名
+func adminTokenKeychainAccount(name string) string {
+	return "admin-token/" + name
+}
+
+// newAdminTokenValue 生成随机令牌值（32 字节随机数）
+func newAdminTokenValue() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成令牌失败: %w", err)
+	}
+	return adminTokenPrefix + hex.EncodeToString(buf), nil
+}
+
+// issueAdminToken 生成新令牌值并写入钥匙串，返回令牌值与只含摘要的配置项
+func issueAdminToken(name, scope string, createdAt, expiresAt int64) (string, AdminToken, error) {
+	value, err := newAdminTokenValue()
+	if err != nil {
+		return "", AdminToken{}, err
+	}
+	token := AdminToken{
+		Name:      name,
+		TokenHash: adminTokenHash(value),
+		Keychain:  true,
+		Scope:     scope,
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+	}
+	if err := systemKeychain.Set(adminTokenKeychainAccount(name), value); err != nil {
+		fmt.Printf("[WARN] 管理令牌 %s 未能保存到钥匙串，只显示这一次: %v\n", name, err)
+		token.Keychain = false
+	}
+	return value, token, nil
+}
+
+// adminTokenTTL 根据有效期天数计算过期时间，0 表示永不过期
+func adminTokenTTL(ttlDays int, now time.Time) (int64, error) {
+	if ttlDays < 0 || ttlDays > maxAdminTokenTTLDays {
+		return 0, fmt.Errorf("令牌有效期必须在 0-%d 天之间（0 表示永不过期）", maxAdminTokenTTLDays)
+	}
+	if ttlDays == 0 {
+		return 0, nil
+	}
+	return now.Add(time.Duration(ttlDays) * 24 * time.Hour).Unix(), nil
+}
+
+// findAdminToken 按名称查找令牌下标，不存在时返回 -1
+func findAdminToken(tokens []AdminToken, name string) int {
+	for i, token := range tokens {
+		if token.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ListAdminTokens 列出管理令牌及其过期与最近使用情况（供前端调用）
+func (ss *SettingsService) ListAdminTokens() ([]AdminTokenInfo, error) {
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return nil, err
+	}
+	usage := adminTokenUsage.snapshot()
+	now := time.Now()
+	infos := make([]AdminTokenInfo, 0, len(config.AdminAPI.Tokens))
+	for _, token := range config.AdminAPI.Tokens {
+		info := AdminTokenInfo{
+			Name:      token.Name,
+			Scope:     token.Scope,
+			Keychain:  token.Keychain,
+			Plaintext: token.TokenHash == "",
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+			Expired:   token.expired(now),
+		}
+		if record, ok := usage[token.Name]; ok {
+			info.LastUsedAt, info.LastUsedIP, info.UseCount = record.lastUsedAt, record.lastIP, record.count
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// GenerateAdminToken 生成管理令牌，ttlDays 为有效期天数（0 表示永不过期）；
+// 返回的令牌值保存在系统钥匙串中，配置文件只保存摘要（供前端调用）
+func (ss *SettingsService) GenerateAdminToken(name string, scope string, ttlDays int) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("管理令牌名称不能为空")
+	}
+	if adminScopeRank(scope) == 0 {
+		return "", fmt.Errorf("管理令牌的权限无效: %s（可选值: read-only、switch-provider、full-admin）", scope)
+	}
+	now := time.Now()
+	expiresAt, err := adminTokenTTL(ttlDays, now)
+	if err != nil {
+		return "", err
+	}
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return "", err
+	}
+	if findAdminToken(config.AdminAPI.Tokens, name) >= 0 {
+		return "", fmt.Errorf("管理令牌名称重复: %s", name)
+	}
+
+	value, token, err := issueAdminToken(name, scope, now.Unix(), expiresAt)
+	if err != nil {
+		return "", err
+	}
+	config.AdminAPI.Tokens = append(config.AdminAPI.Tokens, token)
+	if err := ss.UpdateRelayConfig(config); err != nil {
+		if token.Keychain {
+			_ = systemKeychain.Delete(adminTokenKeychainAccount(name))
+		}
+		return "", err
+	}
+	recordAudit("admin_api", "token_generated", fmt.Sprintf("生成管理令牌 %s（%s）", name, scope))
+	return value, nil
+}
+
+// RotateAdminToken 为令牌生成新的值，旧值立即失效；权限与有效期时长保持不变，
+// 明文保存在配置中的旧令牌同时迁移到钥匙串（供前端调用）
+func (ss *SettingsService) RotateAdminToken(name string) (string, error) {
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return "", err
+	}
+	index := findAdminToken(config.AdminAPI.Tokens, name)
+	if index < 0 {
+		return "", fmt.Errorf("管理令牌不存在: %s", name)
+	}
+	old := config.AdminAPI.Tokens[index]
+	now := time.Now()
+	expiresAt := int64(0)
+	if old.ExpiresAt > 0 && old.CreatedAt > 0 && old.ExpiresAt > old.CreatedAt {
+		expiresAt = now.Unix() + (old.ExpiresAt - old.CreatedAt)
+	}
+
+	// issueAdminToken 会覆盖钥匙串中的旧值，配置保存失败时需要还原，否则配置中的摘要与钥匙串不一致
+	account := adminTokenKeychainAccount(name)
+	previous, previousErr := "", errKeychainUnavailable
+	if old.Keychain {
+		previous, previousErr = systemKeychain.Get(account)
+	}
+	value, token, err := issueAdminToken(name, old.Scope, now.Unix(), expiresAt)
+	if err != nil {
+		return "", err
+	}
+	config.AdminAPI.Tokens[index] = token
+	if err := ss.UpdateRelayConfig(config); err != nil {
+		if token.Keychain {
+			if previousErr == nil {
+				_ = systemKeychain.Set(account, previous)
+			} else {
+				_ = systemKeychain.Delete(account)
+			}
+		}
+		return "", err
+	}
+	recordAudit("admin_api", "token_rotated", fmt.Sprintf("轮换管理令牌 %s", name))
+	return value, nil
+}
+
+// RevokeToken 吊销管理令牌：从配置与钥匙串中删除，并清除使用记录（供前端调用）
+func (ss *SettingsService) RevokeToken(name string) error {
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return err
+	}
+	index := findAdminToken(config.AdminAPI.Tokens, name)
+	if index < 0 {
+		return fmt.Errorf("管理令牌不存在: %s", name)
+	}
+	token := config.AdminAPI.Tokens[index]
+	config.AdminAPI.Tokens = append(config.AdminAPI.Tokens[:index], config.AdminAPI.Tokens[index+1:]...)
+	if len(config.AdminAPI.Tokens) == 0 {
+		// 没有令牌时无法访问管理接口，一并关闭
+		config.AdminAPI.Enabled = false
+	}
+	if err := ss.UpdateRelayConfig(config); err != nil {
+		return err
+	}
+	if token.Keychain {
+		if err := systemKeychain.Delete(adminTokenKeychainAccount(name)); err != nil {
+			fmt.Printf("[WARN] 从钥匙串删除管理令牌 %s 失败: %v\n", name, err)
+		}
+	}
+	adminTokenUsage.forget(name)
+	recordAudit("admin_api", "token_revoked", fmt.Sprintf("吊销管理令牌 %s", name))
+	return nil
+}
+
+// RevealAdminToken 从钥匙串读取管理令牌的值（供前端调用）
+// 需要通过系统身份验证，成功与失败都会写入审计日志
+func (ss *SettingsService) RevealAdminToken(name string) (string, error) {
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return "", err
+	}
+	index := findAdminToken(config.AdminAPI.Tokens, name)
+	if index < 0 {
+		return "", fmt.Errorf("管理令牌不存在: %s", name)
+	}
+	token := config.AdminAPI.Tokens[index]
+	if !token.Keychain {
+		return "", fmt.Errorf("管理令牌 %s 未保存在钥匙串中，请轮换后重新获取", name)
+	}
+	if err := osAuthenticate(fmt.Sprintf("查看管理令牌 %s", name)); err != nil {
+		recordAudit("admin_api", "token_reveal_denied", fmt.Sprintf("读取管理令牌 %s：%v", name, err))
+		return "", err
+	}
+	value, err := systemKeychain.Get(adminTokenKeychainAccount(name))
+	if err != nil {
+		return "", err
+	}
+	if adminTokenHash(value) != token.TokenHash {
+		return "", errors.New("钥匙串中的令牌与配置不一致，请轮换该令牌")
+	}
+	recordAudit("admin_api", "token_revealed", fmt.Sprintf("读取管理令牌 %s（已通过系统身份验证）", name))
+	return value, nil
+}
+
+// ensureAdminTokenUsageTable 确保 admin_token_usage 表存在
+func ensureAdminTokenUsageTable() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS admin_token_usage (
+		name TEXT PRIMARY KEY,
+		last_used_at BIGINT,
+		last_ip TEXT,
+		use_count INTEGER DEFAULT 0
+	)`
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("创建 admin_token_usage 表失败: %w", err)
+	}
+	return nil
+}
+
+// adminTokenUsageRecord 令牌的使用记录
+type adminTokenUsageRecord struct {
+	lastUsedAt int64
+	lastIP     string
+	count      int64
+	pending    int64 // 尚未写库的使用次数
+	flushedAt  time.Time
+}
+
+// adminTokenUsageTracker 记录令牌最近一次使用，按间隔合并写库
+type adminTokenUsageTracker struct {
+	mu      sync.Mutex
+	loaded  bool
+	records map[string]*adminTokenUsageRecord
+}
+
+var adminTokenUsage = &adminTokenUsageTracker{records: make(map[string]*adminTokenUsageRecord)}
+
+// load 首次访问时从数据库读取历史使用记录
+func (t *adminTokenUsageTracker) load() {
+	if t.loaded || GlobalDBQueue == nil {
+		return
+	}
+	t.loaded = true
+	rows, err := xdb.New("admin_token_usage").Selects()
+	if err != nil {
+		if !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+			fmt.Printf("[WARN] 读取管理令牌使用记录失败: %v\n", err)
+		}
+		return
+	}
+	for _, row := range rows {
+		name := row.GetString("name")
+		if _, ok := t.records[name]; ok {
+			continue
+		}
+		t.records[name] = &adminTokenUsageRecord{
+			lastUsedAt: row.GetInt64("last_used_at"),
+			lastIP:     row.GetString("last_ip"),
+			count:      row.GetInt64("use_count"),
+		}
+	}
+}
+
+// touch 记录一次令牌使用
+func (t *adminTokenUsageTracker) touch(name, ip string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.load()
+	record := t.records[name]
+	if record == nil {
+		record = &adminTokenUsageRecord{}
+		t.records[name] = record
+	}
+	record.lastUsedAt, record.lastIP = now.Unix(), ip
+	record.count++
+	record.pending++
+	if GlobalDBQueue == nil || now.Sub(record.flushedAt) < adminTokenUsageFlushInterval {
+		return
+	}
+	record.flushedAt = now
+	pending := record.pending
+	record.pending = 0
+	go func() {
+		err := GlobalDBQueue.Exec(`
+			INSERT INTO admin_token_usage (name, last_used_at, last_ip, use_count) VALUES (?, ?, ?, ?)
+			ON CONFLICT(name) DO UPDATE SET last_used_at = excluded.last_used_at, last_ip = excluded.last_ip,
+				use_count = admin_token_usage.use_count + excluded.use_count
+		`, name, now.Unix(), ip, pending)
+		if err != nil {
+			fmt.Printf("[WARN] 写入管理令牌使用记录失败: %v\n", err)
+		}
+	}()
+}
+
+// forget 删除令牌的使用记录
+func (t *adminTokenUsageTracker) forget(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.records, name)
+	if GlobalDBQueue == nil {
+		return
+	}
+	if err := GlobalDBQueue.Exec(`DELETE FROM admin_token_usage WHERE name = ?`, name); err != nil {
+		fmt.Printf("[WARN] 删除管理令牌使用记录失败: %v\n", err)
+	}
+}
+
+// snapshot 各令牌的使用记录
+func (t *adminTokenUsageTracker) snapshot() map[string]adminTokenUsageRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.load()
+	result := make(map[string]adminTokenUsageRecord, len(t.records))
+	for name, record := range t.records {
+		result[name] = *record
+	}
+	return result
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryKeychain map[string]string
+
+func (m memoryKeychain) Set(account, secret string) error { m[account] = secret; return nil }
+
+func (m memoryKeychain) Get(account string) (string, error) {
+	secret, ok := m[account]
+	if !ok {
+		return "", fmt.Errorf("not found: %s", account)
+	}
+	return secret, nil
+}
+
+func (m memoryKeychain) Delete(account string) error { delete(m, account); return nil }
+
+func TestAdminTokenLifecycle(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	keychain := memoryKeychain{}
+	originalKeychain, originalAuth := systemKeychain, osAuthenticate
+	defer func() { systemKeychain, osAuthenticate = originalKeychain, originalAuth }()
+	systemKeychain = keychain
+	osAuthenticate = func(string) error { return nil }
+	ss := &SettingsService{}
+
+	value, err := ss.GenerateAdminToken("ci", AdminScopeReadOnly, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value, adminTokenPrefix) || keychain[adminTokenKeychainAccount("ci")] != value {
+		t.Fatalf("令牌应保存在钥匙串中: %q", value)
+	}
+	config, _ := LoadRelayConfig()
+	token := config.AdminAPI.Tokens[0]
+	if token.Token != "" || token.TokenHash != adminTokenHash(value) || !token.Keychain {
+		t.Fatalf("配置中只应保存摘要: %+v", token)
+	}
+	if days := (token.ExpiresAt - token.CreatedAt) / 86400; days != 30 {
+		t.Errorf("有效期应为 30 天，实际 %d 天", days)
+	}
+	if got := matchAdminToken(config.AdminAPI.Tokens, value); got == nil || got.Name != "ci" {
+		t.Fatal("生成的令牌应能通过校验")
+	}
+	if _, err := ss.GenerateAdminToken("ci", AdminScopeAdmin, 0); err == nil {
+		t.Error("重复的名称应报错")
+	}
+
+	rotated, err := ss.RotateAdminToken("ci")
+	if err != nil || rotated == value {
+		t.Fatalf("轮换失败: %v", err)
+	}
+	config, _ = LoadRelayConfig()
+	if matchAdminToken(config.AdminAPI.Tokens, value) != nil || matchAdminToken(config.AdminAPI.Tokens, rotated) == nil {
+		t.Error("轮换后旧令牌应失效、新令牌应生效")
+	}
+	if revealed, err := ss.RevealAdminToken("ci"); err != nil || revealed != rotated {
+		t.Errorf("RevealAdminToken() = %q, %v", revealed, err)
+	}
+
+	if err := ss.RevokeToken("ci"); err != nil {
+		t.Fatal(err)
+	}
+	config, _ = LoadRelayConfig()
+	if len(config.AdminAPI.Tokens) != 0 || config.AdminAPI.Enabled || len(keychain) != 0 {
+		t.Errorf("吊销后应删除配置与钥匙串中的令牌: %+v %v", config.AdminAPI, keychain)
+	}
+}
+
+func TestAdminTokenExpiry(t *testing.T) {
+	now := time.Now()
+	if (AdminToken{}).expired(now) {
+		t.Error("未设置过期时间的令牌不应过期")
+	}
+	if !(AdminToken{ExpiresAt: now.Unix()}).expired(now) || (AdminToken{ExpiresAt: now.Unix() + 1}).expired(now) {
+		t.Error("过期时间判断错误")
+	}
+	if _, err := adminTokenTTL(maxAdminTokenTTLDays+1, now); err == nil {
+		t.Error("超出上限的有效期应报错")
+	}
+	hashed := AdminToken{Name: "a", TokenHash: adminTokenHash("0123456789abcdef"), Scope: AdminScopeAdmin}
+	if err := validateAdminAPIConfig(RelayAdminAPIConfig{Tokens: []AdminToken{hashed, {Name: "b", Token: "0123456789abcdef", Scope: AdminScopeAdmin}}}); err == nil {
+		t.Error("摘要与明文令牌值相同应视为重复")
+	}
+	if err := validateAdminAPIConfig(RelayAdminAPIConfig{Tokens: []AdminToken{{Name: "a", TokenHash: "abc", Scope: AdminScopeAdmin}}}); err == nil {
+		t.Error("无效摘要应报错")
+	}
+}
+
+func TestRotateAdminTokenRestoresKeychainOnSaveFailure(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	keychain := memoryKeychain{}
+	originalKeychain := systemKeychain
+	defer func() { systemKeychain = originalKeychain }()
+	systemKeychain = keychain
+	ss := &SettingsService{}
+
+	value, err := ss.GenerateAdminToken("ci", AdminScopeReadOnly, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 策略失效时所有设置被锁定，配置保存失败
+	currentPolicy()
+	originalPolicy := activePolicy.Load()
+	defer activePolicy.Store(originalPolicy)
+	activePolicy.Store(&policyState{policy: &Policy{failClosed: true}})
+
+	if _, err := ss.RotateAdminToken("ci"); err == nil {
+		t.Fatal("配置保存失败时轮换应返回错误")
+	}
+	if got := keychain[adminTokenKeychainAccount("ci")]; got != value {
+		t.Errorf("钥匙串应还原为旧令牌，得到 %q", got)
+	}
+	config, _ := LoadRelayConfig()
+	if matchAdminToken(config.AdminAPI.Tokens, value) == nil {
+		t.Error("旧令牌应仍然有效")
+	}
+}
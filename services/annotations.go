@@ -0,0 +1,249 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	// annotationNoteMaxLength 请求备注最大长度（字符）
+	annotationNoteMaxLength = 2000
+	// annotationTagMaxLength 单个标签最大长度（字符）
+	annotationTagMaxLength = 32
+	// annotationMaxTags 每条请求最多的标签数
+	annotationMaxTags = 10
+)
+
+// RequestLogFilter 请求日志查询条件（Tag 非空时只返回带该标签的请求）
+type RequestLogFilter struct {
+	Platform      string `json:"platform"`
+	Provider      string `json:"provider"`
+	Tag           string `json:"tag"`
+	AnnotatedOnly bool   `json:"annotatedOnly"` // 只返回有备注或标签的请求
+	Limit         int    `json:"limit"`
+}
+
+// RequestTagCount 标签及使用次数
+type RequestTagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// ensureAnnotationTable 确保 request_annotation 表存在（每条请求日志最多一条备注）
+// tags 以 ",a,b," 形式保存，便于按标签筛选
+func ensureAnnotationTable() error {
+	db, err := sharedDB()
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS request_annotation (
+		request_id INTEGER PRIMARY KEY,
+		platform TEXT,
+		provider TEXT,
+		note TEXT,
+		tags TEXT,
+		created_at BIGINT,
+		updated_at BIGINT
+	)`
+	if _, err := db.Exec(sharedDialect().DDL(createTableSQL)); err != nil {
+		return fmt.Errorf("创建 request_annotation 表失败: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_request_annotation_platform ON request_annotation(platform, provider)`); err != nil {
+		return fmt.Errorf("创建 request_annotation 索引失败: %w", err)
+	}
+	return nil
+}
+
+// normalizeTags 去除首尾空白、合并连续空白、去重；标签不能包含逗号
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(tag), " ")
+		if tag == "" {
+			continue
+		}
+		if strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("标签不能包含逗号: %s", tag)
+		}
+		if len([]rune(tag)) > annotationTagMaxLength {
+			return nil, fmt.Errorf("标签不能超过 %d 个字符: %s", annotationTagMaxLength, tag)
+		}
+		key := strings.ToLower(tag)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > annotationMaxTags {
+		return nil, fmt.Errorf("每条请求最多 %d 个标签", annotationMaxTags)
+	}
+	return normalized, nil
+}
+
+// encodeTags 编码为 ",a,b,"（无标签时为空字符串）
+func encodeTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "," + strings.Join(tags, ",") + ","
+}
+
+func decodeTags(raw string) []string {
+	var tags []string
+	for _, tag := range strings.Split(raw, ",") {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// hasTag 标签匹配不区分大小写
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnnotateRequest 为一条请求日志添加备注与标签（供前端调用），备注与标签均为空时删除
+func (ls *LogService) AnnotateRequest(requestID int64, note string, tags []string) error {
+	if GlobalDBQueueShared == nil {
+		return fmt.Errorf("数据库队列未初始化")
+	}
+	note = strings.TrimSpace(note)
+	if runes := []rune(note); len(runes) > annotationNoteMaxLength {
+		note = string(runes[:annotationNoteMaxLength])
+	}
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	if note == "" && len(tags) == 0 {
+		return GlobalDBQueueShared.Exec(`DELETE FROM request_annotation WHERE request_id = ?`, requestID)
+	}
+
+	record, err := sharedModel("request_log").First(
+		xdb.WhereEq("id", requestID),
+		xdb.Field("platform", "provider"),
+	)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return fmt.Errorf("请求日志不存在: %d", requestID)
+		}
+		return err
+	}
+
+	now := epochNow()
+	return GlobalDBQueueShared.Exec(`
+		INSERT INTO request_annotation (request_id, platform, provider, note, tags, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(request_id) DO UPDATE SET note = excluded.note, tags = excluded.tags, updated_at = excluded.updated_at
+	`, requestID, record.GetString("platform"), record.GetString("provider"),
+		maskForStorage(note), encodeTags(tags), now, now)
+}
+
+// QueryRequestLogs 按条件查询请求日志（供前端调用），支持按标签筛选
+func (ls *LogService) QueryRequestLogs(filter RequestLogFilter) ([]ReqeustLog, error) {
+	tag := strings.Join(strings.Fields(filter.Tag), " ")
+	if tag == "" && !filter.AnnotatedOnly {
+		return ls.ListRequestLogs(filter.Platform, filter.Provider, filter.Limit)
+	}
+
+	options := []xdb.Option{xdb.Field("request_id", "tags")}
+	if filter.Platform != "" {
+		options = append(options, xdb.WhereEq("platform", filter.Platform))
+	}
+	if filter.Provider != "" {
+		options = append(options, xdb.WhereEq("provider", filter.Provider))
+	}
+	if tag != "" {
+		// LIKE 只做粗筛，精确匹配在下面完成
+		options = append(options, xdb.WhereLike("tags", "%"+tag+"%"))
+	}
+	records, err := sharedModel("request_annotation").Selects(options...)
+	if err != nil && !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+		return nil, err
+	}
+	ids := make([]any, 0, len(records))
+	for _, record := range records {
+		if tag != "" && !hasTag(decodeTags(record.GetString("tags")), tag) {
+			continue
+		}
+		ids = append(ids, record.GetInt64("request_id"))
+	}
+	if len(ids) == 0 {
+		return []ReqeustLog{}, nil
+	}
+	return ls.listRequestLogs(filter.Platform, filter.Provider, filter.Limit, xdb.WhereIn("id", ids))
+}
+
+// ListRequestTags 列出已使用的标签及次数（供前端筛选使用），按次数降序
+func (ls *LogService) ListRequestTags(platform string) ([]RequestTagCount, error) {
+	options := []xdb.Option{xdb.Field("tags"), xdb.WhereNotEq("tags", "")}
+	if platform != "" {
+		options = append(options, xdb.WhereEq("platform", platform))
+	}
+	records, err := sharedModel("request_annotation").Selects(options...)
+	if err != nil && !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+		return nil, err
+	}
+	counts := map[string]*RequestTagCount{}
+	for _, record := range records {
+		for _, tag := range decodeTags(record.GetString("tags")) {
+			key := strings.ToLower(tag)
+			if counts[key] == nil {
+				counts[key] = &RequestTagCount{Tag: tag}
+			}
+			counts[key].Count++
+		}
+	}
+	result := make([]RequestTagCount, 0, len(counts))
+	for _, count := range counts {
+		result = append(result, *count)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result, nil
+}
+
+// attachAnnotations 为日志填充备注与标签
+func attachAnnotations(logs []ReqeustLog) {
+	if len(logs) == 0 {
+		return
+	}
+	ids := make([]any, 0, len(logs))
+	for _, entry := range logs {
+		ids = append(ids, entry.ID)
+	}
+	records, err := sharedModel("request_annotation").Selects(
+		xdb.WhereIn("request_id", ids),
+		xdb.Field("request_id", "note", "tags"),
+	)
+	if err != nil {
+		return
+	}
+	byID := make(map[int64]int, len(logs))
+	for i := range logs {
+		byID[logs[i].ID] = i
+	}
+	for _, record := range records {
+		if i, ok := byID[record.GetInt64("request_id")]; ok {
+			logs[i].Note = record.GetString("note")
+			logs[i].Tags = decodeTags(record.GetString("tags"))
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := normalizeTags([]string{"  bad   tool call ", "Slow", "slow", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bad tool call", "Slow"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("normalizeTags() = %v, want %v", tags, want)
+	}
+	if encoded := encodeTags(tags); encoded != ",bad tool call,Slow," {
+		t.Errorf("encodeTags() = %q", encoded)
+	}
+	if decoded := decodeTags(encodeTags(tags)); !reflect.DeepEqual(decoded, tags) {
+		t.Errorf("decodeTags() = %v", decoded)
+	}
+	if !hasTag(tags, "slow") || hasTag(tags, "tool") {
+		t.Error("标签应完整匹配且不区分大小写")
+	}
+
+	if _, err := normalizeTags([]string{"a,b"}); err == nil {
+		t.Error("包含逗号的标签应报错")
+	}
+	if _, err := normalizeTags([]string{strings.Repeat("长", annotationTagMaxLength+1)}); err == nil {
+		t.Error("超长标签应报错")
+	}
+}
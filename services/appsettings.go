@@ -11,7 +11,6 @@ import (
 )
 
 const (
-	appSettingsDir      = ".code-switch" // 【修复】修正拼写错误（原为 .codex-swtich）
 	appSettingsFile     = "app.json"
 	oldSettingsDir      = ".codex-swtich"           // 旧的错误拼写
 	migrationMarkerFile = ".migrated-from-codex-swtich" // 迁移标记文件
@@ -24,6 +23,10 @@ type AppSettings struct {
 	AutoUpdate           bool `json:"auto_update"`
 	AutoConnectivityTest bool `json:"auto_connectivity_test"`
 	EnableSwitchNotify   bool `json:"enable_switch_notify"` // 供应商切换通知开关
+
+	PushClaudeSettings bool   `json:"push_claude_settings"` // 切换 Claude 供应商时直接写入 ~/.claude/settings.json（不经过中继）
+	ClaudePushMode     string `json:"claude_push_mode"`     // 写入方式：env / apiKeyHelper
+	PushCodexSettings  bool   `json:"push_codex_settings"`  // 切换 Codex 供应商时直接写入 ~/.codex/config.toml（不经过中继）
 }
 
 type AppSettingsService struct {
@@ -38,7 +41,7 @@ func NewAppSettingsService(autoStartService *AutoStartService) *AppSettingsServi
 		home = "."
 	}
 
-	newDir := filepath.Join(home, appSettingsDir)
+	newDir := getConfigDir()
 	newPath := filepath.Join(newDir, appSettingsFile)
 	oldDir := filepath.Join(home, oldSettingsDir)
 	oldPath := filepath.Join(oldDir, appSettingsFile)
@@ -142,6 +145,7 @@ func (as *AppSettingsService) defaultSettings() AppSettings {
 		AutoUpdate:           true,  // 默认开启自动更新
 		AutoConnectivityTest: false, // 默认关闭自动连通性检测
 		EnableSwitchNotify:   true,  // 默认开启切换通知
+		ClaudePushMode:       ClaudePushModeEnv,
 	}
 }
 
@@ -203,5 +207,9 @@ func (as *AppSettingsService) saveLocked(settings AppSettings) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(as.path, data, 0o644)
+	if err := os.WriteFile(as.path, data, 0o644); err != nil {
+		return err
+	}
+	recordConfigIntegrity(as.path)
+	return nil
 }
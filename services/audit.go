@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// AuditEntry 审计日志条目
+type AuditEntry struct {
+	ID        int64  `json:"id"`
+	Category  string `json:"category"` // 类别，如 budget
+	Action    string `json:"action"`   // 动作，如 model_downgrade
+	Detail    string `json:"detail"`   // 详情（可读文本）
+	CreatedAt string `json:"created_at"`
+}
+
+// ensureAuditTable 确保 audit_log 表存在
+func ensureAuditTable() error {
+	db, err := sharedDB()
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		category TEXT NOT NULL,
+		action TEXT NOT NULL,
+		detail TEXT,
+		created_at BIGINT
+	)`
+	if _, err := db.Exec(sharedDialect().DDL(createTableSQL)); err != nil {
+		return fmt.Errorf("创建 audit_log 表失败: %w", err)
+	}
+	return nil
+}
+
+// recordAudit 写入一条审计日志（失败只记录日志，不影响主流程）
+func recordAudit(category, action, detail string) {
+	if GlobalDBQueueShared == nil {
+		log.Printf("⚠️  写入审计日志失败: 队列未初始化")
+		return
+	}
+	if err := GlobalDBQueueShared.Exec(
+		`INSERT INTO audit_log (category, action, detail, created_at) VALUES (?, ?, ?, ?)`,
+		category, action, maskForStorage(detail), epochNow(),
+	); err != nil {
+		log.Printf("⚠️  写入审计日志失败: %v", err)
+	}
+}
+
+// ListAuditLogs 查询审计日志（category 为空时返回全部类别）
+func (ls *LogService) ListAuditLogs(category string, limit int) ([]AuditEntry, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	options := []xdb.Option{
+		xdb.OrderByDesc("id"),
+		xdb.Limit(limit),
+	}
+	if category != "" {
+		options = append(options, xdb.WhereEq("category", category))
+	}
+	records, err := sharedModel("audit_log").Selects(options...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []AuditEntry{}, nil
+		}
+		return nil, err
+	}
+	entries := make([]AuditEntry, 0, len(records))
+	for _, record := range records {
+		entries = append(entries, AuditEntry{
+			ID:        record.GetInt64("id"),
+			Category:  record.GetString("category"),
+			Action:    record.GetString("action"),
+			Detail:    record.GetString("detail"),
+			CreatedAt: recordTimeString(record, "created_at"),
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// authFailureTracker 统计各 provider 连续返回 401 的次数（内存中，重启后清零）
+type authFailureTracker struct {
+	mu       sync.Mutex
+	failures map[string]int // key: platform/provider
+}
+
+func newAuthFailureTracker() *authFailureTracker {
+	return &authFailureTracker{failures: make(map[string]int)}
+}
+
+// observe 记录一次响应状态，返回连续 401 次数（非 401 响应清零）
+func (t *authFailureTracker) observe(kind, providerName string, status int) int {
+	key := kind + "/" + providerName
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if status != http.StatusUnauthorized {
+		delete(t.failures, key)
+		return 0
+	}
+	t.failures[key]++
+	return t.failures[key]
+}
+
+func (t *authFailureTracker) reset(kind, providerName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, kind+"/"+providerName)
+}
+
+// keyFingerprint 生成 API Key 的指纹（不保存明文，用于判断 Key 是否已更换）
+func keyFingerprint(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// IsAuthDisabled 判断 provider 是否因密钥失效被自动停用（更换 Key 后自动失效）
+func (p *Provider) IsAuthDisabled() bool {
+	return p.AuthDisabledKey != "" && p.AuthDisabledKey == keyFingerprint(p.APIKey)
+}
+
+// trackAuthStatus 统计 401 响应，连续达到阈值后自动停用 provider
+// 停用与拉黑不同：不会随时间自动恢复，直到用户更换 API Key 或手动恢复
+func (prs *ProviderRelayService) trackAuthStatus(kind string, provider Provider, status int) {
+	if prs.authFailures == nil || status == 0 {
+		return
+	}
+	count := prs.authFailures.observe(kind, provider.Name, status)
+	config := currentRelayConfig().AuthFailure
+	if !config.Enabled || count < config.Threshold {
+		return
+	}
+	prs.authFailures.reset(kind, provider.Name)
+
+	if err := prs.providerService.MarkAuthDisabled(kind, provider.Name, keyFingerprint(provider.APIKey)); err != nil {
+		log.Printf("⚠️  自动停用 provider %s/%s 失败: %v", kind, provider.Name, err)
+		return
+	}
+	log.Printf("🔑 Provider %s/%s 连续 %d 次返回 401，判定 API Key 无效，已自动停用", kind, provider.Name, count)
+	recordAudit("provider", "auth_disabled", fmt.Sprintf("%s/%s 连续 %d 次返回 401，已自动停用", kind, provider.Name, count))
+	if prs.notificationService != nil {
+		prs.notificationService.NotifyProviderAuthDisabled(kind, provider.Name)
+	}
+}
+
+// MarkAuthDisabled 标记 provider 因密钥失效被停用（记录当时的 Key 指纹）
+func (ps *ProviderService) MarkAuthDisabled(kind string, name string, fingerprint string) error {
+	return ps.updateProviderByName(kind, name, func(p *Provider) {
+		p.AuthDisabledKey = fingerprint
+	})
+}
+
+// ClearAuthDisabled 手动恢复因密钥失效被停用的 provider（供前端调用）
+func (ps *ProviderService) ClearAuthDisabled(kind string, name string) error {
+	return ps.updateProviderByName(kind, name, func(p *Provider) {
+		p.AuthDisabledKey = ""
+	})
+}
+
+// updateProviderByName 按名称修改单个 provider 并保存
+func (ps *ProviderService) updateProviderByName(kind string, name string, update func(p *Provider)) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return fmt.Errorf("加载供应商配置失败: %w", err)
+	}
+	for i := range providers {
+		if providers[i].Name == name {
+			update(&providers[i])
+			return ps.saveProvidersLocked(kind, providers)
+		}
+	}
+	return fmt.Errorf("未找到名为 '%s' 的供应商", name)
+}
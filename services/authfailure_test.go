@@ -0,0 +1,33 @@
+package services
+
+import "testing"
+
+func TestAuthFailureTracker(t *testing.T) {
+	tracker := newAuthFailureTracker()
+	for i := 1; i <= 2; i++ {
+		if got := tracker.observe("claude", "p", 401); got != i {
+			t.Fatalf("第 %d 次 401 计数 = %d", i, got)
+		}
+	}
+	if got := tracker.observe("claude", "p", 200); got != 0 {
+		t.Errorf("成功响应后计数应清零，实际为 %d", got)
+	}
+	if got := tracker.observe("claude", "p", 401); got != 1 {
+		t.Errorf("清零后重新计数 = %d, want 1", got)
+	}
+	if got := tracker.observe("codex", "p", 401); got != 1 {
+		t.Errorf("不同平台应分别计数，实际为 %d", got)
+	}
+}
+
+func TestProvider_IsAuthDisabled(t *testing.T) {
+	p := Provider{APIKey: "sk-old"}
+	p.AuthDisabledKey = keyFingerprint("sk-old")
+	if !p.IsAuthDisabled() {
+		t.Error("Key 未更换时应保持停用")
+	}
+	p.APIKey = "sk-new"
+	if p.IsAuthDisabled() {
+		t.Error("更换 Key 后应自动恢复")
+	}
+}
@@ -0,0 +1,686 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// batchPollInterval 后台轮询批量任务状态的间隔
+	batchPollInterval = time.Minute
+	// batchMaxRequests 单个批量任务的最大请求数
+	batchMaxRequests = 10000
+	// anthropicAPIVersion Anthropic 原生接口版本
+	anthropicAPIVersion = "2023-06-01"
+)
+
+// 批量任务状态
+const (
+	BatchStatusSubmitted = "submitted" // 已提交，等待上游处理
+	BatchStatusCompleted = "completed" // 已完成，结果已保存
+	BatchStatusFailed    = "failed"    // 上游处理失败或已过期
+	BatchStatusCanceled  = "canceled"  // 已取消
+)
+
+// BatchRequestItem 批量任务中的单个请求
+type BatchRequestItem struct {
+	CustomID string          `json:"customId"` // 调用方自定义 ID，用于对应结果
+	Body     json.RawMessage `json:"body"`     // 与单次请求相同的请求体（/v1/messages 或 /responses）
+}
+
+// BatchJob 批量任务
+type BatchJob struct {
+	ID             string `json:"id"`
+	Platform       string `json:"platform"`
+	Provider       string `json:"provider"`
+	RemoteID       string `json:"remoteId"` // 上游批量任务 ID
+	Status         string `json:"status"`
+	RequestCount   int    `json:"requestCount"`
+	SucceededCount int    `json:"succeededCount"`
+	FailedCount    int    `json:"failedCount"`
+	Error          string `json:"error,omitempty"`
+	CreatedAt      string `json:"createdAt"`
+	UpdatedAt      string `json:"updatedAt"`
+}
+
+// BatchResult 批量任务中单个请求的结果
+type BatchResult struct {
+	CustomID   string `json:"customId"`
+	Succeeded  bool   `json:"succeeded"`
+	StatusCode int    `json:"statusCode"`
+	Body       string `json:"body"` // 上游返回的响应或错误 JSON
+}
+
+// BatchService 批量任务：通过 provider 的原生批量接口提交请求（约五折价格），后台轮询并保存结果
+type BatchService struct {
+	providerService *ProviderService
+	client          *http.Client
+	pollMu          sync.Mutex // 避免手动轮询与定时轮询并发执行
+}
+
+func NewBatchService(providerService *ProviderService) *BatchService {
+	return &BatchService{
+		providerService: providerService,
+		client:          &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// ensureBatchTables 确保批量任务相关表存在
+func ensureBatchTables() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	return createBatchTables(db)
+}
+
+func createBatchTables(db *sql.DB) error {
+	const createJobSQL = `CREATE TABLE IF NOT EXISTS batch_job (
+		id TEXT PRIMARY KEY,
+		platform TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		remote_id TEXT,
+		status TEXT NOT NULL,
+		request_count INTEGER DEFAULT 0,
+		succeeded_count INTEGER DEFAULT 0,
+		failed_count INTEGER DEFAULT 0,
+		error TEXT,
+		created_at BIGINT,
+		updated_at BIGINT
+	)`
+	if _, err := db.Exec(createJobSQL); err != nil {
+		return fmt.Errorf("创建 batch_job 表失败: %w", err)
+	}
+
+	const createResultSQL = `CREATE TABLE IF NOT EXISTS batch_result (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id TEXT NOT NULL,
+		custom_id TEXT,
+		succeeded INTEGER DEFAULT 0,
+		status_code INTEGER DEFAULT 0,
+		body TEXT
+	)`
+	if _, err := db.Exec(createResultSQL); err != nil {
+		return fmt.Errorf("创建 batch_result 表失败: %w", err)
+	}
+	// 旧版本逐条写入，轮询重试时可能产生重复结果；建立唯一索引前只保留每个请求最早的一条
+	if _, err := db.Exec(`DELETE FROM batch_result WHERE id NOT IN (SELECT MIN(id) FROM batch_result GROUP BY job_id, custom_id)`); err != nil {
+		return fmt.Errorf("清理重复批量结果失败: %w", err)
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_batch_result_job_custom ON batch_result(job_id, custom_id)`); err != nil {
+		return fmt.Errorf("创建 batch_result 索引失败: %w", err)
+	}
+	if _, err := db.Exec(`DROP INDEX IF EXISTS idx_batch_result_job`); err != nil {
+		return fmt.Errorf("删除 batch_result 旧索引失败: %w", err)
+	}
+	return nil
+}
+
+// Start 注册后台轮询任务
+func (bs *BatchService) Start() error {
+	scheduleJob(backgroundJob{
+		name:     "batch_poll",
+		title:    "批量任务状态轮询",
+		delay:    batchPollInterval,
+		interval: func() time.Duration { return batchPollInterval },
+		run: func() error {
+			bs.PollBatches()
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止后台轮询
+func (bs *BatchService) Stop() error {
+	unscheduleJob("batch_poll")
+	return nil
+}
+
+// SubmitBatch 提交批量任务（供前端调用）
+// platform 为 claude 或 codex，对应 Anthropic Message Batches 与 OpenAI Batch API
+func (bs *BatchService) SubmitBatch(platform string, providerName string, items []BatchRequestItem) (*BatchJob, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("批量任务不能为空")
+	}
+	if len(items) > batchMaxRequests {
+		return nil, fmt.Errorf("单个批量任务最多 %d 个请求", batchMaxRequests)
+	}
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		if item.CustomID == "" {
+			return nil, fmt.Errorf("第 %d 个请求缺少 customId", i+1)
+		}
+		if seen[item.CustomID] {
+			return nil, fmt.Errorf("customId 重复: %s", item.CustomID)
+		}
+		seen[item.CustomID] = true
+		if !json.Valid(item.Body) {
+			return nil, fmt.Errorf("请求 %s 的 body 不是有效的 JSON", item.CustomID)
+		}
+	}
+
+	provider, err := bs.findProvider(platform, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var remoteID string
+	switch platform {
+	case "claude":
+		remoteID, err = bs.submitAnthropicBatch(provider, items)
+	case "codex":
+		remoteID, err = bs.submitOpenAIBatch(provider, items)
+	default:
+		return nil, fmt.Errorf("平台 %s 不支持批量任务", platform)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job := &BatchJob{
+		ID:           newBatchJobID(),
+		Platform:     platform,
+		Provider:     provider.Name,
+		RemoteID:     remoteID,
+		Status:       BatchStatusSubmitted,
+		RequestCount: len(items),
+	}
+	if err := GlobalDBQueue.Exec(
+		`INSERT INTO batch_job (id, platform, provider, remote_id, status, request_count, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Platform, job.Provider, job.RemoteID, job.Status, job.RequestCount, epochNow(), epochNow(),
+	); err != nil {
+		return nil, fmt.Errorf("保存批量任务失败（上游任务 %s 已提交）: %w", remoteID, err)
+	}
+	log.Printf("[Batch] 已提交批量任务 %s -> %s/%s (%s)，共 %d 个请求", job.ID, platform, provider.Name, remoteID, len(items))
+	return bs.GetBatchJob(job.ID)
+}
+
+// ListBatchJobs 列出批量任务（最新在前）
+func (bs *BatchService) ListBatchJobs(limit int) ([]BatchJob, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	records, err := xdb.New("batch_job").Selects(xdb.OrderByDesc("created_at"), xdb.Limit(limit))
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []BatchJob{}, nil
+		}
+		return nil, err
+	}
+	jobs := make([]BatchJob, 0, len(records))
+	for _, record := range records {
+		jobs = append(jobs, batchJobFromRecord(record))
+	}
+	return jobs, nil
+}
+
+// GetBatchJob 获取单个批量任务
+func (bs *BatchService) GetBatchJob(id string) (*BatchJob, error) {
+	records, err := xdb.New("batch_job").Selects(xdb.WhereEq("id", id), xdb.Limit(1))
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("批量任务不存在: %s", id)
+	}
+	job := batchJobFromRecord(records[0])
+	return &job, nil
+}
+
+// GetBatchResults 获取批量任务的结果
+func (bs *BatchService) GetBatchResults(id string) ([]BatchResult, error) {
+	records, err := xdb.New("batch_result").Selects(xdb.WhereEq("job_id", id), xdb.OrderByAsc("id"))
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []BatchResult{}, nil
+		}
+		return nil, err
+	}
+	results := make([]BatchResult, 0, len(records))
+	for _, record := range records {
+		results = append(results, BatchResult{
+			CustomID:   record.GetString("custom_id"),
+			Succeeded:  record.GetInt("succeeded") == 1,
+			StatusCode: record.GetInt("status_code"),
+			Body:       record.GetString("body"),
+		})
+	}
+	return results, nil
+}
+
+// CancelBatch 取消尚未完成的批量任务
+func (bs *BatchService) CancelBatch(id string) error {
+	job, err := bs.GetBatchJob(id)
+	if err != nil {
+		return err
+	}
+	if job.Status != BatchStatusSubmitted {
+		return fmt.Errorf("批量任务已结束（%s），无法取消", job.Status)
+	}
+	provider, err := bs.findProvider(job.Platform, job.Provider)
+	if err != nil {
+		return err
+	}
+
+	var cancelURL string
+	if job.Platform == "claude" {
+		cancelURL = joinURL(provider.APIURL, "/v1/messages/batches/"+job.RemoteID+"/cancel")
+	} else {
+		cancelURL = joinURL(provider.APIURL, "/batches/"+job.RemoteID+"/cancel")
+	}
+	if _, err := bs.doJSON(http.MethodPost, cancelURL, job.Platform, provider, nil); err != nil {
+		return err
+	}
+	return bs.updateJob(job.ID, BatchStatusCanceled, job.SucceededCount, job.FailedCount, "")
+}
+
+// PollBatches 检查所有未完成任务的状态，完成后下载结果（后台定时调用，也可手动触发）
+func (bs *BatchService) PollBatches() {
+	bs.pollMu.Lock()
+	defer bs.pollMu.Unlock()
+
+	records, err := xdb.New("batch_job").Selects(xdb.WhereEq("status", BatchStatusSubmitted))
+	if err != nil {
+		if !isNoSuchTableErr(err) {
+			log.Printf("[Batch] 查询未完成任务失败: %v", err)
+		}
+		return
+	}
+	for _, record := range records {
+		job := batchJobFromRecord(record)
+		provider, err := bs.findProvider(job.Platform, job.Provider)
+		if err != nil {
+			log.Printf("[Batch] 任务 %s 的 provider 不可用: %v", job.ID, err)
+			continue
+		}
+		if err := bs.pollBatch(job, provider); err != nil {
+			log.Printf("[Batch] 轮询任务 %s 失败: %v", job.ID, err)
+		}
+	}
+}
+
+// submitAnthropicBatch 提交到 Anthropic Message Batches API
+func (bs *BatchService) submitAnthropicBatch(provider *Provider, items []BatchRequestItem) (string, error) {
+	requests := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		requests = append(requests, map[string]interface{}{
+			"custom_id": item.CustomID,
+			"params":    item.Body,
+		})
+	}
+	payload, err := json.Marshal(map[string]interface{}{"requests": requests})
+	if err != nil {
+		return "", err
+	}
+	body, err := bs.doJSON(http.MethodPost, joinURL(provider.APIURL, "/v1/messages/batches"), "claude", provider, payload)
+	if err != nil {
+		return "", err
+	}
+	id := gjson.GetBytes(body, "id").String()
+	if id == "" {
+		return "", fmt.Errorf("上游未返回批量任务 ID: %s", truncateBatchBody(body))
+	}
+	return id, nil
+}
+
+// batchPollOutcome 单次轮询的结果；Status 为空表示上游仍在处理
+type batchPollOutcome struct {
+	Status  string
+	Error   string
+	Results []BatchResult
+}
+
+// pollBatch 查询上游任务状态，任务结束时保存结果或记录失败原因
+func (bs *BatchService) pollBatch(job BatchJob, provider *Provider) error {
+	var (
+		outcome batchPollOutcome
+		err     error
+	)
+	if job.Platform == "claude" {
+		outcome, err = bs.checkAnthropicBatch(job, provider)
+	} else {
+		outcome, err = bs.checkOpenAIBatch(job, provider)
+	}
+	if err != nil {
+		return err
+	}
+	switch outcome.Status {
+	case "":
+		return nil
+	case BatchStatusCompleted:
+		return bs.saveResults(job, outcome.Results)
+	default:
+		return bs.updateJob(job.ID, outcome.Status, 0, 0, outcome.Error)
+	}
+}
+
+// checkAnthropicBatch 查询 Anthropic 批量任务，结束后下载 JSONL 结果
+func (bs *BatchService) checkAnthropicBatch(job BatchJob, provider *Provider) (batchPollOutcome, error) {
+	body, err := bs.doJSON(http.MethodGet, joinURL(provider.APIURL, "/v1/messages/batches/"+job.RemoteID), "claude", provider, nil)
+	if err != nil {
+		return batchPollOutcome{}, err
+	}
+	if gjson.GetBytes(body, "processing_status").String() != "ended" {
+		return batchPollOutcome{}, nil
+	}
+	resultsURL := gjson.GetBytes(body, "results_url").String()
+	if resultsURL == "" {
+		return batchPollOutcome{Status: BatchStatusFailed, Error: "上游未返回结果地址"}, nil
+	}
+	data, err := bs.doJSON(http.MethodGet, resultsURL, "claude", provider, nil)
+	if err != nil {
+		return batchPollOutcome{}, err
+	}
+	return batchPollOutcome{Status: BatchStatusCompleted, Results: parseAnthropicBatchResults(data)}, nil
+}
+
+// parseAnthropicBatchResults 解析 Anthropic 批量结果 JSONL
+func parseAnthropicBatchResults(data []byte) []BatchResult {
+	var results []BatchResult
+	forEachJSONLine(data, func(line gjson.Result) {
+		resultType := line.Get("result.type").String()
+		result := BatchResult{CustomID: line.Get("custom_id").String(), Succeeded: resultType == "succeeded"}
+		if result.Succeeded {
+			result.StatusCode = http.StatusOK
+			result.Body = line.Get("result.message").Raw
+		} else {
+			result.Body = line.Get("result").Raw
+		}
+		results = append(results, result)
+	})
+	return results
+}
+
+// submitOpenAIBatch 上传 JSONL 文件并创建 OpenAI Batch 任务
+func (bs *BatchService) submitOpenAIBatch(provider *Provider, items []BatchRequestItem) (string, error) {
+	var jsonl bytes.Buffer
+	for _, item := range items {
+		line, err := json.Marshal(map[string]interface{}{
+			"custom_id": item.CustomID,
+			"method":    http.MethodPost,
+			"url":       "/v1/responses",
+			"body":      item.Body,
+		})
+		if err != nil {
+			return "", err
+		}
+		jsonl.Write(line)
+		jsonl.WriteByte('\n')
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	_ = writer.WriteField("purpose", "batch")
+	part, err := writer.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(jsonl.Bytes()); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, joinURL(provider.APIURL, "/files"), &form)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	fileBody, err := bs.do(req)
+	if err != nil {
+		return "", fmt.Errorf("上传批量文件失败: %w", err)
+	}
+	fileID := gjson.GetBytes(fileBody, "id").String()
+	if fileID == "" {
+		return "", fmt.Errorf("上游未返回文件 ID: %s", truncateBatchBody(fileBody))
+	}
+
+	payload, _ := json.Marshal(map[string]string{
+		"input_file_id":     fileID,
+		"endpoint":          "/v1/responses",
+		"completion_window": "24h",
+	})
+	body, err := bs.doJSON(http.MethodPost, joinURL(provider.APIURL, "/batches"), "codex", provider, payload)
+	if err != nil {
+		return "", err
+	}
+	id := gjson.GetBytes(body, "id").String()
+	if id == "" {
+		return "", fmt.Errorf("上游未返回批量任务 ID: %s", truncateBatchBody(body))
+	}
+	return id, nil
+}
+
+// checkOpenAIBatch 查询 OpenAI 批量任务，完成后下载输出与错误文件
+func (bs *BatchService) checkOpenAIBatch(job BatchJob, provider *Provider) (batchPollOutcome, error) {
+	body, err := bs.doJSON(http.MethodGet, joinURL(provider.APIURL, "/batches/"+job.RemoteID), "codex", provider, nil)
+	if err != nil {
+		return batchPollOutcome{}, err
+	}
+	switch status := gjson.GetBytes(body, "status").String(); status {
+	case "completed":
+	case "failed", "expired", "cancelled":
+		errMsg := gjson.GetBytes(body, "errors.data.0.message").String()
+		if errMsg == "" {
+			errMsg = "上游任务状态: " + status
+		}
+		finalStatus := BatchStatusFailed
+		if status == "cancelled" {
+			finalStatus = BatchStatusCanceled
+		}
+		return batchPollOutcome{Status: finalStatus, Error: errMsg}, nil
+	default:
+		return batchPollOutcome{}, nil
+	}
+
+	var results []BatchResult
+	for _, fileField := range []string{"output_file_id", "error_file_id"} {
+		fileID := gjson.GetBytes(body, fileField).String()
+		if fileID == "" {
+			continue
+		}
+		data, err := bs.doJSON(http.MethodGet, joinURL(provider.APIURL, "/files/"+fileID+"/content"), "codex", provider, nil)
+		if err != nil {
+			return batchPollOutcome{}, err
+		}
+		results = append(results, parseOpenAIBatchResults(data)...)
+	}
+	return batchPollOutcome{Status: BatchStatusCompleted, Results: results}, nil
+}
+
+// parseOpenAIBatchResults 解析 OpenAI 批量输出或错误文件 JSONL
+func parseOpenAIBatchResults(data []byte) []BatchResult {
+	var results []BatchResult
+	forEachJSONLine(data, func(line gjson.Result) {
+		statusCode := int(line.Get("response.status_code").Int())
+		result := BatchResult{
+			CustomID:   line.Get("custom_id").String(),
+			StatusCode: statusCode,
+			Succeeded:  statusCode >= 200 && statusCode < 300,
+			Body:       line.Get("response.body").Raw,
+		}
+		if !result.Succeeded && line.Get("error").Exists() && line.Get("error").Type != gjson.Null {
+			result.Body = line.Get("error").Raw
+		}
+		results = append(results, result)
+	})
+	return results
+}
+
+// saveResults 保存结果并将任务标记为完成
+func (bs *BatchService) saveResults(job BatchJob, results []BatchResult) error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	succeeded, failed, err := storeBatchResults(db, job.ID, results)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Batch] 任务 %s 已完成：成功 %d，失败 %d", job.ID, succeeded, failed)
+	return nil
+}
+
+// storeBatchResults 在同一事务中写入全部结果并将任务标记为完成
+// 结果按 (job_id, custom_id) 去重，上次保存中途失败后重新轮询不会产生重复记录；计数以落库结果为准
+func storeBatchResults(db *sql.DB, jobID string, results []BatchResult) (succeeded, failed int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("保存批量结果失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO batch_result (job_id, custom_id, succeeded, status_code, body) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("保存批量结果失败: %w", err)
+	}
+	defer stmt.Close()
+	for _, result := range results {
+		if _, err := stmt.Exec(jobID, result.CustomID, boolToInt(result.Succeeded), result.StatusCode, result.Body); err != nil {
+			return 0, 0, fmt.Errorf("保存批量结果失败: %w", err)
+		}
+	}
+
+	var total int
+	if err := tx.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(succeeded), 0) FROM batch_result WHERE job_id = ?`, jobID,
+	).Scan(&total, &succeeded); err != nil {
+		return 0, 0, fmt.Errorf("统计批量结果失败: %w", err)
+	}
+	failed = total - succeeded
+	if _, err := tx.Exec(
+		`UPDATE batch_job SET status = ?, succeeded_count = ?, failed_count = ?, error = ?, updated_at = ? WHERE id = ?`,
+		BatchStatusCompleted, succeeded, failed, "", epochNow(), jobID,
+	); err != nil {
+		return 0, 0, fmt.Errorf("更新批量任务状态失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("提交批量结果失败: %w", err)
+	}
+	return succeeded, failed, nil
+}
+
+func (bs *BatchService) updateJob(id, status string, succeeded, failed int, errMsg string) error {
+	return GlobalDBQueue.Exec(
+		`UPDATE batch_job SET status = ?, succeeded_count = ?, failed_count = ?, error = ?, updated_at = ? WHERE id = ?`,
+		status, succeeded, failed, errMsg, epochNow(), id,
+	)
+}
+
+// findProvider 查找已启用的 provider
+func (bs *BatchService) findProvider(platform, name string) (*Provider, error) {
+	providers, err := bs.providerService.LoadProviders(platform)
+	if err != nil {
+		return nil, err
+	}
+	for i := range providers {
+		if providers[i].Name == name {
+			if !providers[i].Enabled || providers[i].APIURL == "" || providers[i].APIKey == "" {
+				return nil, fmt.Errorf("provider %s 未启用或配置不完整", name)
+			}
+			return &providers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("provider 不存在: %s", name)
+}
+
+// doJSON 发送 JSON 请求（按平台设置认证头），返回响应体
+func (bs *BatchService) doJSON(method, url, platform string, provider *Provider, payload []byte) ([]byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	if platform == "claude" {
+		req.Header.Set("x-api-key", provider.APIKey)
+		req.Header.Set("anthropic-version", anthropicAPIVersion)
+	}
+	return bs.do(req)
+}
+
+func (bs *BatchService) do(req *http.Request) ([]byte, error) {
+	resp, err := bs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("上游不支持批量接口（404），请使用官方 API 地址: %s", req.URL.String())
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("上游返回 %d: %s", resp.StatusCode, truncateBatchBody(body))
+	}
+	return body, nil
+}
+
+// forEachJSONLine 逐行解析 JSONL
+func forEachJSONLine(data []byte, fn func(line gjson.Result)) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 32*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || !gjson.Valid(line) {
+			continue
+		}
+		fn(gjson.Parse(line))
+	}
+}
+
+func batchJobFromRecord(record xdb.Record) BatchJob {
+	return BatchJob{
+		ID:             record.GetString("id"),
+		Platform:       record.GetString("platform"),
+		Provider:       record.GetString("provider"),
+		RemoteID:       record.GetString("remote_id"),
+		Status:         record.GetString("status"),
+		RequestCount:   record.GetInt("request_count"),
+		SucceededCount: record.GetInt("succeeded_count"),
+		FailedCount:    record.GetInt("failed_count"),
+		Error:          record.GetString("error"),
+		CreatedAt:      recordTimeString(record, "created_at"),
+		UpdatedAt:      recordTimeString(record, "updated_at"),
+	}
+}
+
+func newBatchJobID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return "batch_" + hex.EncodeToString(buf)
+}
+
+func truncateBatchBody(body []byte) string {
+	const max = 500
+	if len(body) > max {
+		return string(body[:max]) + "..."
+	}
+	return string(body)
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func newBatchTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	// 内存库每个连接相互独立
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := createBatchTables(db); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	return db
+}
+
+func TestCheckAnthropicBatch(t *testing.T) {
+	status := "in_progress"
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/v1/messages/batches/msgbatch_1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "sk-test" || r.Header.Get("anthropic-version") != anthropicAPIVersion {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id":"msgbatch_1","processing_status":"` + status + `","results_url":"` + srv.URL + `/results"}`))
+	})
+	mux.HandleFunc("/results", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"custom_id":"a","result":{"type":"succeeded","message":{"id":"msg_1"}}}
+{"custom_id":"b","result":{"type":"errored","error":{"type":"invalid_request_error"}}}
+`))
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	bs := NewBatchService(nil)
+	provider := &Provider{APIURL: srv.URL, APIKey: "sk-test"}
+	job := BatchJob{ID: "batch_1", Platform: "claude", RemoteID: "msgbatch_1"}
+
+	outcome, err := bs.checkAnthropicBatch(job, provider)
+	if err != nil || outcome.Status != "" {
+		t.Fatalf("处理中的任务应保持不变: %+v, %v", outcome, err)
+	}
+
+	status = "ended"
+	outcome, err = bs.checkAnthropicBatch(job, provider)
+	if err != nil {
+		t.Fatalf("checkAnthropicBatch() 失败: %v", err)
+	}
+	if outcome.Status != BatchStatusCompleted || len(outcome.Results) != 2 {
+		t.Fatalf("结束的任务应返回全部结果: %+v", outcome)
+	}
+	if r := outcome.Results[0]; r.CustomID != "a" || !r.Succeeded || r.StatusCode != http.StatusOK || r.Body != `{"id":"msg_1"}` {
+		t.Errorf("成功结果不符: %+v", r)
+	}
+	if r := outcome.Results[1]; r.CustomID != "b" || r.Succeeded || r.StatusCode != 0 {
+		t.Errorf("失败结果不符: %+v", r)
+	}
+}
+
+func TestCheckOpenAIBatchStatusTransitions(t *testing.T) {
+	tests := []struct {
+		upstream   string
+		wantStatus string
+		wantError  string
+	}{
+		{upstream: `{"status":"validating"}`},
+		{upstream: `{"status":"in_progress"}`},
+		{upstream: `{"status":"finalizing"}`},
+		{upstream: `{"status":"failed","errors":{"data":[{"message":"invalid jsonl"}]}}`, wantStatus: BatchStatusFailed, wantError: "invalid jsonl"},
+		{upstream: `{"status":"expired"}`, wantStatus: BatchStatusFailed, wantError: "上游任务状态: expired"},
+		{upstream: `{"status":"cancelled"}`, wantStatus: BatchStatusCanceled, wantError: "上游任务状态: cancelled"},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tt.upstream))
+		}))
+		outcome, err := NewBatchService(nil).checkOpenAIBatch(BatchJob{RemoteID: "batch_x"}, &Provider{APIURL: srv.URL})
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s: checkOpenAIBatch() 失败: %v", tt.upstream, err)
+		}
+		if outcome.Status != tt.wantStatus || outcome.Error != tt.wantError {
+			t.Errorf("%s: 得到 (%q, %q)，期望 (%q, %q)", tt.upstream, outcome.Status, outcome.Error, tt.wantStatus, tt.wantError)
+		}
+	}
+}
+
+func TestCheckOpenAIBatchCompleted(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/batches/batch_x", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"completed","output_file_id":"file_out","error_file_id":"file_err"}`))
+	})
+	mux.HandleFunc("/files/file_out/content", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"custom_id":"a","response":{"status_code":200,"body":{"id":"resp_1"}},"error":null}` + "\n"))
+	})
+	mux.HandleFunc("/files/file_err/content", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"custom_id":"b","response":{"status_code":400,"body":{}},"error":{"message":"bad request"}}` + "\n"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	outcome, err := NewBatchService(nil).checkOpenAIBatch(BatchJob{RemoteID: "batch_x"}, &Provider{APIURL: srv.URL})
+	if err != nil {
+		t.Fatalf("checkOpenAIBatch() 失败: %v", err)
+	}
+	if outcome.Status != BatchStatusCompleted || len(outcome.Results) != 2 {
+		t.Fatalf("完成的任务应合并输出与错误文件: %+v", outcome)
+	}
+	if r := outcome.Results[0]; !r.Succeeded || r.Body != `{"id":"resp_1"}` {
+		t.Errorf("成功结果不符: %+v", r)
+	}
+	if r := outcome.Results[1]; r.Succeeded || r.StatusCode != 400 || r.Body != `{"message":"bad request"}` {
+		t.Errorf("失败结果应保存错误信息: %+v", r)
+	}
+}
+
+func TestStoreBatchResults(t *testing.T) {
+	db := newBatchTestDB(t)
+	if _, err := db.Exec(`INSERT INTO batch_job (id, platform, provider, status, request_count) VALUES ('batch_1', 'claude', 'p', ?, 3)`, BatchStatusSubmitted); err != nil {
+		t.Fatal(err)
+	}
+	results := []BatchResult{
+		{CustomID: "a", Succeeded: true, StatusCode: 200, Body: "{}"},
+		{CustomID: "b", Succeeded: false, Body: `{"type":"errored"}`},
+		{CustomID: "c", Succeeded: true, StatusCode: 200, Body: "{}"},
+	}
+	succeeded, failed, err := storeBatchResults(db, "batch_1", results)
+	if err != nil {
+		t.Fatalf("storeBatchResults() 失败: %v", err)
+	}
+	if succeeded != 2 || failed != 1 {
+		t.Errorf("计数 = (%d, %d)，期望 (2, 1)", succeeded, failed)
+	}
+
+	// 重复保存（例如上次提交后进程退出、任务再次被轮询）不产生重复结果
+	if succeeded, failed, err = storeBatchResults(db, "batch_1", results); err != nil || succeeded != 2 || failed != 1 {
+		t.Fatalf("重复保存应幂等: (%d, %d, %v)", succeeded, failed, err)
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM batch_result WHERE job_id = 'batch_1'`).Scan(&count); err != nil || count != 3 {
+		t.Errorf("结果记录数 = %d (%v)，期望 3", count, err)
+	}
+
+	var status string
+	var succeededCount, failedCount int
+	if err := db.QueryRow(`SELECT status, succeeded_count, failed_count FROM batch_job WHERE id = 'batch_1'`).Scan(&status, &succeededCount, &failedCount); err != nil {
+		t.Fatal(err)
+	}
+	if status != BatchStatusCompleted || succeededCount != 2 || failedCount != 1 {
+		t.Errorf("任务状态 = (%s, %d, %d)，期望 (completed, 2, 1)", status, succeededCount, failedCount)
+	}
+}
+
+func TestStoreBatchResultsRollsBackOnError(t *testing.T) {
+	db := newBatchTestDB(t)
+	if _, err := db.Exec(`INSERT INTO batch_job (id, platform, provider, status) VALUES ('batch_1', 'claude', 'p', ?)`, BatchStatusSubmitted); err != nil {
+		t.Fatal(err)
+	}
+	// 结果写入后更新任务失败时，已写入的结果应随事务回滚
+	if _, err := db.Exec(`CREATE TRIGGER reject_job_update BEFORE UPDATE ON batch_job BEGIN SELECT RAISE(ABORT, 'boom'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := storeBatchResults(db, "batch_1", []BatchResult{{CustomID: "a", Succeeded: true}}); err == nil {
+		t.Fatal("更新任务失败时应返回错误")
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM batch_result`).Scan(&count); err != nil || count != 0 {
+		t.Errorf("回滚后不应残留结果，得到 %d (%v)", count, err)
+	}
+}
+
+func TestCreateBatchTablesDeduplicatesLegacyResults(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	// 旧版本表结构：仅有 job_id 普通索引，可能存在重复结果
+	for _, stmt := range []string{
+		`CREATE TABLE batch_result (id INTEGER PRIMARY KEY AUTOINCREMENT, job_id TEXT NOT NULL, custom_id TEXT, succeeded INTEGER DEFAULT 0, status_code INTEGER DEFAULT 0, body TEXT)`,
+		`CREATE INDEX idx_batch_result_job ON batch_result(job_id)`,
+		`INSERT INTO batch_result (job_id, custom_id, body) VALUES ('j', 'a', 'first'), ('j', 'a', 'dup'), ('j', 'b', 'other')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createBatchTables(db); err != nil {
+		t.Fatalf("createBatchTables() 失败: %v", err)
+	}
+	var body string
+	if err := db.QueryRow(`SELECT group_concat(body, ',') FROM (SELECT body FROM batch_result ORDER BY id)`).Scan(&body); err != nil || body != "first,other" {
+		t.Errorf("应保留每个请求最早的结果，得到 %q (%v)", body, err)
+	}
+}
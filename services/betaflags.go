@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BetaFlag 可按 provider 开启的 beta 功能（转发时注入对应请求头）
+type BetaFlag struct {
+	Platform    string `json:"platform"`
+	Header      string `json:"header"`
+	Value       string `json:"value"` // 同时作为开关的标识，保存在 Provider.BetaFlags
+	Description string `json:"description"`
+}
+
+// knownBetaFlags 已知的 beta 取值，只允许开启列表中的值，避免拼写错误导致请求被上游拒绝
+var knownBetaFlags = []BetaFlag{
+	{"claude", "anthropic-beta", "prompt-caching-2024-07-31", "提示词缓存（旧模型）"},
+	{"claude", "anthropic-beta", "extended-cache-ttl-2025-04-11", "1 小时缓存有效期"},
+	{"claude", "anthropic-beta", "token-efficient-tools-2025-02-19", "省 token 的工具调用"},
+	{"claude", "anthropic-beta", "fine-grained-tool-streaming-2025-05-14", "工具参数细粒度流式输出"},
+	{"claude", "anthropic-beta", "interleaved-thinking-2025-05-14", "工具调用之间的交错思考"},
+	{"claude", "anthropic-beta", "output-128k-2025-02-19", "128K 输出长度"},
+	{"claude", "anthropic-beta", "context-1m-2025-08-07", "100 万 token 上下文"},
+	{"claude", "anthropic-beta", "files-api-2025-04-14", "Files API"},
+	{"claude", "anthropic-beta", "code-execution-2025-05-22", "代码执行工具"},
+	{"claude", "anthropic-beta", "mcp-client-2025-04-04", "远程 MCP 连接器"},
+	{"claude", "anthropic-beta", "computer-use-2025-01-24", "Computer Use 工具"},
+	{"codex", "OpenAI-Beta", "assistants=v2", "Assistants API v2"},
+	{"codex", "OpenAI-Beta", "realtime=v1", "Realtime API"},
+}
+
+// findBetaFlag 查找平台下的已知 beta 取值
+func findBetaFlag(platform, value string) (BetaFlag, bool) {
+	for _, flag := range knownBetaFlags {
+		if flag.Platform == platform && flag.Value == value {
+			return flag, true
+		}
+	}
+	return BetaFlag{}, false
+}
+
+// validateBetaFlags 校验 provider 开启的 beta 取值是否已知
+func validateBetaFlags(platform string, values []string) error {
+	for _, value := range values {
+		if _, ok := findBetaFlag(platform, value); !ok {
+			return fmt.Errorf("未知的 beta 功能: %s（可在 ListBetaFlags 中查看支持的取值）", value)
+		}
+	}
+	return nil
+}
+
+// applyBetaFlags 将 provider 开启的 beta 取值合并到请求头（与客户端自带的取值去重），返回注入的取值
+func applyBetaFlags(platform string, provider Provider, headers map[string]string) []string {
+	var applied []string
+	for _, value := range provider.BetaFlags {
+		flag, ok := findBetaFlag(platform, value)
+		if !ok {
+			continue
+		}
+		key := http.CanonicalHeaderKey(flag.Header)
+		existing := headers[key]
+		present := false
+		for _, item := range strings.Split(existing, ",") {
+			if strings.TrimSpace(item) == value {
+				present = true
+				break
+			}
+		}
+		if !present {
+			if existing == "" {
+				headers[key] = value
+			} else {
+				headers[key] = existing + "," + value
+			}
+		}
+		applied = append(applied, value)
+	}
+	return applied
+}
+
+// BetaFlagStat 单个 provider 上某个 beta 取值的使用统计（内存中，重启后清零）
+type BetaFlagStat struct {
+	Platform   string `json:"platform"`
+	Provider   string `json:"provider"`
+	Flag       string `json:"flag"`
+	Requests   int    `json:"requests"`
+	Successes  int    `json:"successes"`
+	LastUsedAt int64  `json:"lastUsedAt"` // 毫秒时间戳
+}
+
+// betaFlagStats 统计注入了 beta 请求头的请求数与成功数，便于判断 beta 功能是否被上游支持
+type betaFlagStats struct {
+	mu    sync.Mutex
+	stats map[string]*BetaFlagStat // key: platform/provider/flag
+}
+
+func newBetaFlagStats() *betaFlagStats {
+	return &betaFlagStats{stats: make(map[string]*BetaFlagStat)}
+}
+
+func (s *betaFlagStats) observe(platform, providerName string, flags []string, success bool) {
+	if s == nil || len(flags) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UnixMilli()
+	for _, flag := range flags {
+		key := platform + "/" + providerName + "/" + flag
+		stat := s.stats[key]
+		if stat == nil {
+			stat = &BetaFlagStat{Platform: platform, Provider: providerName, Flag: flag}
+			s.stats[key] = stat
+		}
+		stat.Requests++
+		if success {
+			stat.Successes++
+		}
+		stat.LastUsedAt = now
+	}
+}
+
+func (s *betaFlagStats) list(platform string) []BetaFlagStat {
+	if s == nil {
+		return []BetaFlagStat{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]BetaFlagStat, 0, len(s.stats))
+	for _, stat := range s.stats {
+		if platform == "" || stat.Platform == platform {
+			result = append(result, *stat)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Provider != result[j].Provider {
+			return result[i].Provider < result[j].Provider
+		}
+		return result[i].Flag < result[j].Flag
+	})
+	return result
+}
+
+// ListBetaFlags 列出平台支持的 beta 功能（供前端调用）
+func (prs *ProviderRelayService) ListBetaFlags(platform string) []BetaFlag {
+	flags := []BetaFlag{}
+	for _, flag := range knownBetaFlags {
+		if platform == "" || flag.Platform == platform {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+// GetBetaFlagStats 获取 beta 功能的使用统计（供前端调用）
+func (prs *ProviderRelayService) GetBetaFlagStats(platform string) []BetaFlagStat {
+	return prs.betaFlags.list(platform)
+}
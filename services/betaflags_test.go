@@ -0,0 +1,41 @@
+package services
+
+import "testing"
+
+func TestApplyBetaFlags(t *testing.T) {
+	provider := Provider{Name: "p", BetaFlags: []string{"context-1m-2025-08-07", "interleaved-thinking-2025-05-14", "unknown-flag"}}
+	headers := map[string]string{"Anthropic-Beta": "interleaved-thinking-2025-05-14"}
+
+	applied := applyBetaFlags("claude", provider, headers)
+	if len(applied) != 2 {
+		t.Errorf("applied = %v", applied)
+	}
+	if got, want := headers["Anthropic-Beta"], "interleaved-thinking-2025-05-14,context-1m-2025-08-07"; got != want {
+		t.Errorf("Anthropic-Beta = %q, want %q", got, want)
+	}
+
+	headers = map[string]string{}
+	applyBetaFlags("codex", Provider{BetaFlags: []string{"assistants=v2"}}, headers)
+	if headers["Openai-Beta"] != "assistants=v2" {
+		t.Errorf("headers = %v", headers)
+	}
+
+	if err := validateBetaFlags("claude", []string{"assistants=v2"}); err == nil {
+		t.Error("其他平台的取值应校验失败")
+	}
+	if err := validateBetaFlags("claude", []string{"context-1m-2025-08-07"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBetaFlagStats(t *testing.T) {
+	stats := newBetaFlagStats()
+	stats.observe("claude", "p", []string{"a"}, true)
+	stats.observe("claude", "p", []string{"a"}, false)
+	list := stats.list("claude")
+	if len(list) != 1 || list[0].Requests != 2 || list[0].Successes != 1 {
+		t.Errorf("list = %+v", list)
+	}
+	var nilStats *betaFlagStats
+	nilStats.observe("claude", "p", []string{"a"}, true)
+}
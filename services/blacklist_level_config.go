@@ -9,12 +9,7 @@ import (
 
 // GetBlacklistLevelConfigPath 获取等级拉黑配置文件路径
 func GetBlacklistLevelConfigPath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("获取用户目录失败: %w", err)
-	}
-
-	configDir := filepath.Join(home, ".code-switch")
+	configDir := getConfigDir()
 	// 确保目录存在
 	if err := os.MkdirAll(configDir, 0755); err != nil {
 		return "", fmt.Errorf("创建配置目录失败: %w", err)
@@ -90,6 +85,7 @@ func (ss *SettingsService) SaveBlacklistLevelConfig(config *BlacklistLevelConfig
 	if err := os.Rename(tmpPath, configPath); err != nil {
 		return fmt.Errorf("重命名配置文件失败: %w", err)
 	}
+	recordConfigIntegrity(configPath)
 
 	return nil
 }
@@ -151,5 +147,9 @@ func validateBlacklistLevelConfig(config *BlacklistLevelConfig) error {
 		return fmt.Errorf("fallback 拉黑时长必须在 1-10080 分钟之间")
 	}
 
+	if err := validateBlacklistTriggers(config.Triggers); err != nil {
+		return err
+	}
+
 	return nil
 }
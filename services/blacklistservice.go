@@ -4,21 +4,24 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"time"
-
-	"github.com/daodao97/xgo/xdb"
 )
 
 // BlacklistService 管理供应商黑名单
 type BlacklistService struct {
 	settingsService     *SettingsService
 	notificationService *NotificationService
+	incidents           *incidentDetector          // 平台级故障检测
+	availableProviders  func(platform string) int  // 平台当前可用 provider 数（由中继服务注入）
+	upstreamIncident    func(platform string) bool // 上游确认故障期间暂停升级（由状态页服务注入）
 }
 
 // BlacklistStatus 黑名单状态（用于前端展示）
 type BlacklistStatus struct {
 	Platform         string     `json:"platform"`
 	ProviderName     string     `json:"providerName"`
+	ProviderUID      string     `json:"providerUid,omitempty"` // provider 稳定 ID
 	FailureCount     int        `json:"failureCount"`
 	BlacklistedAt    *time.Time `json:"blacklistedAt"`
 	BlacklistedUntil *time.Time `json:"blacklistedUntil"`
@@ -32,16 +35,66 @@ type BlacklistStatus struct {
 	ForgivenessRemaining int        `json:"forgivenessRemaining"` // 距离宽恕还剩多少秒（3小时倒计时）
 }
 
+// BlacklistQuery 黑名单状态查询条件（零值表示返回全部记录，按最近失败时间倒序）
+type BlacklistQuery struct {
+	OnlyActive bool   `json:"onlyActive"` // 只返回仍在拉黑中的记录
+	Since      int64  `json:"since"`      // 只返回此时间（毫秒）之后有失败的记录，0 表示不限
+	OrderBy    string `json:"orderBy"`    // lastFailureAt / blacklistedUntil / level / failureCount / providerName
+	Ascending  bool   `json:"ascending"`  // 默认倒序
+	Limit      int    `json:"limit"`      // 0 表示不分页
+	Offset     int    `json:"offset"`
+}
+
+// BlacklistStatusPage 分页查询结果
+type BlacklistStatusPage struct {
+	Items []BlacklistStatus `json:"items"`
+	Total int               `json:"total"` // 满足条件的总数（不受分页影响）
+}
+
+// blacklistOrderColumns 可排序字段到列名的映射
+var blacklistOrderColumns = map[string]string{
+	"":                 "last_failure_at",
+	"lastFailureAt":    "last_failure_at",
+	"blacklistedUntil": "blacklisted_until",
+	"level":            "blacklist_level",
+	"failureCount":     "failure_count",
+	"providerName":     "provider_name",
+}
+
+// maxBlacklistPageSize 单页最多返回的记录数
+const maxBlacklistPageSize = 500
+
 func NewBlacklistService(settingsService *SettingsService, notificationService *NotificationService) *BlacklistService {
 	return &BlacklistService{
 		settingsService:     settingsService,
 		notificationService: notificationService,
+		incidents:           newIncidentDetector(),
 	}
 }
 
+// Start 注册黑名单自动恢复任务（每分钟检查一次）
+func (bs *BlacklistService) Start() error {
+	scheduleJob(backgroundJob{
+		name:     "blacklist_recover",
+		title:    "黑名单自动恢复",
+		delay:    time.Minute,
+		interval: func() time.Duration { return time.Minute },
+		run:      bs.AutoRecoverExpired,
+	})
+	return nil
+}
+
+// Stop 停止黑名单自动恢复
+func (bs *BlacklistService) Stop() error {
+	unscheduleJob("blacklist_recover")
+	return nil
+}
+
 // RecordSuccess 记录 provider 成功，清零连续失败计数，执行降级和宽恕逻辑
 func (bs *BlacklistService) RecordSuccess(platform string, providerName string) error {
-	db, err := xdb.DB("default")
+	bs.resolveIncident(platform)
+
+	db, err := sharedDB()
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
@@ -56,9 +109,9 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 	// 查询现有记录
 	var id int
 	var blacklistLevel int
-	var lastRecoveredAt sql.NullTime
+	var lastRecoveredAt epochTime
 	var lastDegradeHour int
-	var blacklistedUntil sql.NullTime
+	var blacklistedUntil epochTime
 
 	err = db.QueryRow(`
 		SELECT id, blacklist_level, last_recovered_at, last_degrade_hour, blacklisted_until
@@ -79,13 +132,13 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 	justRecovered := false
 	if blacklistedUntil.Valid && blacklistedUntil.Time.Before(now) && !lastRecoveredAt.Valid {
 		justRecovered = true
-		lastRecoveredAt = sql.NullTime{Time: now, Valid: true}
+		lastRecoveredAt = newEpochTime(now)
 		log.Printf("🔓 Provider %s/%s 从黑名单恢复（L%d），开始降级计时", platform, providerName, blacklistLevel)
 	}
 
 	// 如果功能关闭，只清零失败计数
 	if !levelConfig.EnableLevelBlacklist {
-		err = GlobalDBQueue.Exec(`
+		err = GlobalDBQueueShared.Exec(`
 			UPDATE provider_blacklist
 			SET failure_count = 0
 			WHERE id = ?
@@ -142,14 +195,7 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 		WHERE id = ?
 	`
 
-	var lastRecoveredTime interface{}
-	if lastRecoveredAt.Valid {
-		lastRecoveredTime = lastRecoveredAt.Time
-	} else {
-		lastRecoveredTime = nil
-	}
-
-	err = GlobalDBQueue.Exec(updateSQL, newLevel, lastRecoveredTime, newLastDegradeHour, id)
+	err = GlobalDBQueueShared.Exec(updateSQL, newLevel, lastRecoveredAt, newLastDegradeHour, id)
 
 	if err != nil {
 		return fmt.Errorf("更新成功记录失败: %w", err)
@@ -174,7 +220,12 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 		return nil
 	}
 
-	db, err := xdb.DB("default")
+	// 所有 provider 同时失败时判定为本地问题，不计入失败次数
+	if bs.checkIncident(platform, providerName) {
+		return nil
+	}
+
+	db, err := sharedDB()
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
@@ -195,7 +246,7 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 			threshold = levelConfig.FailureThreshold
 			duration = levelConfig.FallbackDurationMinutes
 		}
-		return bs.recordFailureFixedMode(platform, providerName, levelConfig.FallbackMode, duration, threshold)
+		return bs.recordFailureFixedMode(platform, providerName, levelConfig.FallbackMode, duration, threshold, levelConfig.Triggers)
 	}
 
 	now := time.Now()
@@ -203,10 +254,10 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 	// 查询现有记录
 	var id int
 	var failureCount int
-	var blacklistedUntil sql.NullTime
+	var blacklistedUntil epochTime
 	var blacklistLevel int
-	var lastRecoveredAt sql.NullTime
-	var lastFailureWindowStart sql.NullTime
+	var lastRecoveredAt epochTime
+	var lastFailureWindowStart epochTime
 
 	err = db.QueryRow(`
 		SELECT id, failure_count, blacklisted_until, blacklist_level, last_recovered_at, last_failure_window_start
@@ -216,11 +267,11 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 
 	if err == sql.ErrNoRows {
 		// 首次失败，插入新记录
-		err = GlobalDBQueue.Exec(`
+		err = GlobalDBQueueShared.Exec(`
 			INSERT INTO provider_blacklist
-				(platform, provider_name, failure_count, last_failure_at, last_failure_window_start, blacklist_level)
-			VALUES (?, ?, 1, ?, ?, 0)
-		`, platform, providerName, now, now)
+				(platform, provider_name, provider_uid, failure_count, last_failure_at, last_failure_window_start, blacklist_level)
+			VALUES (?, ?, ?, 1, ?, ?, 0)
+		`, platform, providerName, providerUIDByName(platform, providerName), now.Unix(), now.Unix())
 
 		if err != nil {
 			return fmt.Errorf("插入失败记录失败: %w", err)
@@ -251,8 +302,12 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 	// 失败计数 +1，更新去重窗口起始时间
 	failureCount++
 
-	// 检查是否达到拉黑阈值
-	if failureCount >= levelConfig.FailureThreshold {
+	// 检查是否达到拉黑阈值（配置了触发条件时按请求日志计算）
+	resetAt := lastRecoveredAt.Time
+	if blacklistedUntil.Valid && blacklistedUntil.Time.After(resetAt) {
+		resetAt = blacklistedUntil.Time
+	}
+	if failureThresholdReached(platform, providerName, failureCount, levelConfig.FailureThreshold, levelConfig.Triggers, resetAt, now) {
 		// 计算等级升级策略
 		newLevel := blacklistLevel
 		var levelIncrease int
@@ -277,6 +332,12 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 			levelIncrease = 1
 		}
 
+		// 上游官方状态页确认故障时只拉黑不升级，避免故障结束后 provider 长时间处于高等级
+		if bs.upstreamIncident != nil && bs.upstreamIncident(platform) && blacklistLevel > 0 {
+			levelIncrease = 0
+			log.Printf("🛰️  %s 上游官方状态页报告故障，Provider %s 保持 L%d 不升级", platform, providerName, blacklistLevel)
+		}
+
 		newLevel = blacklistLevel + levelIncrease
 		if newLevel > 5 {
 			newLevel = 5 // 最高 L5
@@ -287,7 +348,7 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 		blacklistedAt := now
 		blacklistedUntil := now.Add(time.Duration(duration) * time.Minute)
 
-		err = GlobalDBQueue.Exec(`
+		err = GlobalDBQueueShared.Exec(`
 			UPDATE provider_blacklist
 			SET failure_count = 0,
 				last_failure_at = ?,
@@ -297,7 +358,7 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 				auto_recovered = 0,
 				last_failure_window_start = ?
 			WHERE id = ?
-		`, now, blacklistedAt, blacklistedUntil, newLevel, now, id)
+		`, now.Unix(), blacklistedAt.Unix(), blacklistedUntil.Unix(), newLevel, now.Unix(), id)
 
 		if err != nil {
 			return fmt.Errorf("更新拉黑状态失败: %w", err)
@@ -306,6 +367,9 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 		log.Printf("⛔ Provider %s/%s 已拉黑（L%d → L%d，%d 分钟），过期时间: %s",
 			platform, providerName, blacklistLevel, newLevel, duration, blacklistedUntil.Format("15:04:05"))
 
+		recordProviderEvent(platform, providerName, TimelineBlacklisted, "",
+			fmt.Sprintf("拉黑 %d 分钟（L%d → L%d），至 %s", duration, blacklistLevel, newLevel, blacklistedUntil.Format("15:04:05")))
+
 		// 发送拉黑通知
 		if bs.notificationService != nil {
 			bs.notificationService.NotifyProviderBlacklisted(platform, providerName, newLevel, duration)
@@ -313,11 +377,11 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 
 	} else {
 		// 未达到阈值，仅更新失败计数和窗口起始时间
-		err = GlobalDBQueue.Exec(`
+		err = GlobalDBQueueShared.Exec(`
 			UPDATE provider_blacklist
 			SET failure_count = ?, last_failure_at = ?, last_failure_window_start = ?
 			WHERE id = ?
-		`, failureCount, now, now, id)
+		`, failureCount, now.Unix(), now.Unix(), id)
 
 		if err != nil {
 			return fmt.Errorf("更新失败计数失败: %w", err)
@@ -331,14 +395,14 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 }
 
 // recordFailureFixedMode 固定拉黑模式（向后兼容）
-func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName string, fallbackMode string, fallbackDuration int, failureThreshold int) error {
+func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName string, fallbackMode string, fallbackDuration int, failureThreshold int, triggers []string) error {
 	if fallbackMode == "none" {
 		log.Printf("🚫 Provider %s/%s 失败，但等级拉黑已关闭且 fallbackMode=none，不拉黑", platform, providerName)
 		return nil
 	}
 
 	// 使用旧的固定拉黑逻辑
-	db, err := xdb.DB("default")
+	db, err := sharedDB()
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
@@ -348,7 +412,7 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 	// 查询现有记录
 	var id int
 	var failureCount int
-	var blacklistedUntil sql.NullTime
+	var blacklistedUntil epochTime
 
 	err = db.QueryRow(`
 		SELECT id, failure_count, blacklisted_until
@@ -358,11 +422,11 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 
 	if err == sql.ErrNoRows {
 		// 首次失败，插入新记录
-		err = GlobalDBQueue.Exec(`
+		err = GlobalDBQueueShared.Exec(`
 			INSERT INTO provider_blacklist
-				(platform, provider_name, failure_count, last_failure_at)
-			VALUES (?, ?, 1, ?)
-		`, platform, providerName, now)
+				(platform, provider_name, provider_uid, failure_count, last_failure_at)
+			VALUES (?, ?, ?, 1, ?)
+		`, platform, providerName, providerUIDByName(platform, providerName), now.Unix())
 
 		if err != nil {
 			return fmt.Errorf("插入失败记录失败: %w", err)
@@ -383,12 +447,12 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 	// 失败计数 +1
 	failureCount++
 
-	// 检查是否达到拉黑阈值
-	if failureCount >= failureThreshold {
+	// 检查是否达到拉黑阈值（配置了触发条件时按请求日志计算）
+	if failureThresholdReached(platform, providerName, failureCount, failureThreshold, triggers, blacklistedUntil.Time, now) {
 		blacklistedAt := now
 		blacklistedUntil := now.Add(time.Duration(fallbackDuration) * time.Minute)
 
-		err = GlobalDBQueue.Exec(`
+		err = GlobalDBQueueShared.Exec(`
 			UPDATE provider_blacklist
 			SET failure_count = ?,
 				last_failure_at = ?,
@@ -396,7 +460,7 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 				blacklisted_until = ?,
 				auto_recovered = 0
 			WHERE id = ?
-		`, failureCount, now, blacklistedAt, blacklistedUntil, id)
+		`, failureCount, now.Unix(), blacklistedAt.Unix(), blacklistedUntil.Unix(), id)
 
 		if err != nil {
 			return fmt.Errorf("更新拉黑状态失败: %w", err)
@@ -404,14 +468,16 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 
 		log.Printf("⛔ Provider %s/%s 已拉黑 %d 分钟（固定模式，失败 %d 次），过期时间: %s",
 			platform, providerName, fallbackDuration, failureCount, blacklistedUntil.Format("15:04:05"))
+		recordProviderEvent(platform, providerName, TimelineBlacklisted, "",
+			fmt.Sprintf("连续失败 %d 次，拉黑 %d 分钟，至 %s", failureCount, fallbackDuration, blacklistedUntil.Format("15:04:05")))
 
 	} else {
 		// 更新失败计数
-		err = GlobalDBQueue.Exec(`
+		err = GlobalDBQueueShared.Exec(`
 			UPDATE provider_blacklist
 			SET failure_count = ?, last_failure_at = ?
 			WHERE id = ?
-		`, failureCount, now, id)
+		`, failureCount, now.Unix(), id)
 
 		if err != nil {
 			return fmt.Errorf("更新失败计数失败: %w", err)
@@ -448,15 +514,15 @@ func (bs *BlacklistService) IsBlacklisted(platform string, providerName string)
 		return false, nil
 	}
 
-	db, err := xdb.DB("default")
+	db, err := sharedDB()
 	if err != nil {
 		log.Printf("⚠️  获取数据库连接失败: %v", err)
 		return false, nil
 	}
 
-	var blacklistedUntil sql.NullTime
+	var blacklistedUntil epochTime
 
-	// 移除 SQL 时间比较，改为 Go 代码判断（修复时区 bug）
+	// 时间以 UTC 时间戳存储，在 Go 代码中比较
 	err = db.QueryRow(`
 		SELECT blacklisted_until
 		FROM provider_blacklist
@@ -471,7 +537,7 @@ func (bs *BlacklistService) IsBlacklisted(platform string, providerName string)
 	}
 
 	if blacklistedUntil.Valid {
-		// 使用 Go 代码比较时间（正确处理时区）
+		// 使用 Go 代码比较时间
 		if blacklistedUntil.Time.After(time.Now()) {
 			return true, &blacklistedUntil.Time
 		}
@@ -482,7 +548,7 @@ func (bs *BlacklistService) IsBlacklisted(platform string, providerName string)
 
 // ManualUnblockAndReset 手动解除拉黑（保留等级，如需清零请调用 ManualResetLevel）
 func (bs *BlacklistService) ManualUnblockAndReset(platform string, providerName string) error {
-	db, err := xdb.DB("default")
+	db, err := sharedDB()
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
@@ -503,7 +569,7 @@ func (bs *BlacklistService) ManualUnblockAndReset(platform string, providerName
 	}
 
 	// 【重要】保留 blacklist_level，让降级/宽恕机制逐渐降低等级
-	err = GlobalDBQueue.Exec(`
+	err = GlobalDBQueueShared.Exec(`
 		UPDATE provider_blacklist
 		SET blacklisted_at = NULL,
 			blacklisted_until = NULL,
@@ -512,13 +578,14 @@ func (bs *BlacklistService) ManualUnblockAndReset(platform string, providerName
 			last_degrade_hour = 0,
 			auto_recovered = 0
 		WHERE platform = ? AND provider_name = ?
-	`, now, platform, providerName)
+	`, now.Unix(), platform, providerName)
 
 	if err != nil {
 		return fmt.Errorf("手动解除拉黑失败: %w", err)
 	}
 
 	log.Printf("✅ 手动解除拉黑: %s/%s（等级保留，重新开始降级计时）", platform, providerName)
+	recordProviderEvent(platform, providerName, TimelineUnblocked, "", "手动解除拉黑")
 	return nil
 }
 
@@ -529,7 +596,7 @@ func (bs *BlacklistService) ManualUnblock(platform string, providerName string)
 
 // ManualResetLevel 手动清零等级（不解除拉黑，仅重置等级）
 func (bs *BlacklistService) ManualResetLevel(platform string, providerName string) error {
-	db, err := xdb.DB("default")
+	db, err := sharedDB()
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
@@ -547,7 +614,7 @@ func (bs *BlacklistService) ManualResetLevel(platform string, providerName strin
 		return fmt.Errorf("查询黑名单记录失败: %w", err)
 	}
 
-	err = GlobalDBQueue.Exec(`
+	err = GlobalDBQueueShared.Exec(`
 		UPDATE provider_blacklist
 		SET blacklist_level = 0,
 			last_degrade_hour = 0
@@ -565,7 +632,7 @@ func (bs *BlacklistService) ManualResetLevel(platform string, providerName strin
 // AutoRecoverExpired 自动恢复过期的黑名单（由定时器调用）
 // 使用事务批量处理，避免多次单独写入导致的并发锁冲突
 func (bs *BlacklistService) AutoRecoverExpired() error {
-	db, err := xdb.DB("default")
+	db, err := sharedDB()
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
@@ -593,14 +660,14 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 	// 收集所有需要恢复的 provider
 	for rows.Next() {
 		var platform, providerName string
-		var blacklistedUntil sql.NullTime
+		var blacklistedUntil epochTime
 
 		if err := rows.Scan(&platform, &providerName, &blacklistedUntil); err != nil {
 			log.Printf("⚠️  读取恢复记录失败: %v", err)
 			continue
 		}
 
-		// 使用 Go 代码判断是否过期（正确处理时区）
+		// 使用 Go 代码判断是否过期
 		if !blacklistedUntil.Valid || blacklistedUntil.Time.After(now) {
 			continue // 未过期，跳过
 		}
@@ -622,20 +689,21 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 	// 批量更新所有过期的 provider（使用队列）
 	// 【重要】保留 blacklist_level，让 RecordSuccess 中的降级/宽恕机制逐渐降低等级
 	for _, item := range toRecover {
-		err := GlobalDBQueue.Exec(`
+		err := GlobalDBQueueShared.Exec(`
 			UPDATE provider_blacklist
 			SET auto_recovered = 1,
 				failure_count = 0,
 				last_recovered_at = ?,
 				last_degrade_hour = 0
 			WHERE platform = ? AND provider_name = ?
-		`, now, item.Platform, item.ProviderName)
+		`, now.Unix(), item.Platform, item.ProviderName)
 
 		if err != nil {
 			failed = append(failed, fmt.Sprintf("%s/%s", item.Platform, item.ProviderName))
 			log.Printf("⚠️  标记恢复状态失败: %s/%s - %v", item.Platform, item.ProviderName, err)
 		} else {
 			recovered = append(recovered, fmt.Sprintf("%s/%s", item.Platform, item.ProviderName))
+			recordProviderEvent(item.Platform, item.ProviderName, TimelineRecovered, "", "拉黑到期，自动恢复")
 		}
 	}
 
@@ -652,7 +720,56 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 
 // GetBlacklistStatus 获取所有黑名单状态（用于前端展示，支持等级拉黑）
 func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStatus, error) {
-	db, err := xdb.DB("default")
+	page, err := bs.QueryBlacklistStatus(platform, BlacklistQuery{})
+	if err != nil {
+		return nil, err
+	}
+	return page.Items, nil
+}
+
+// buildBlacklistQuery 根据查询条件生成 WHERE 与 ORDER BY 子句（platform 为空时查询全部平台）
+func buildBlacklistQuery(platform string, query BlacklistQuery, now time.Time) (string, []interface{}, string, error) {
+	column, ok := blacklistOrderColumns[query.OrderBy]
+	if !ok {
+		return "", nil, "", fmt.Errorf("不支持的排序字段: %s", query.OrderBy)
+	}
+	if query.Limit < 0 || query.Offset < 0 {
+		return "", nil, "", fmt.Errorf("limit 与 offset 不能为负数")
+	}
+
+	conds := []string{"1=1"}
+	var args []interface{}
+	if platform != "" {
+		conds = append(conds, "platform = ?")
+		args = append(args, platform)
+	}
+	if query.OnlyActive {
+		conds = append(conds, "blacklisted_until > ?")
+		args = append(args, now.Unix())
+	}
+	if query.Since > 0 {
+		conds = append(conds, "last_failure_at >= ?")
+		args = append(args, query.Since/1000)
+	}
+
+	direction := "DESC"
+	if query.Ascending {
+		direction = "ASC"
+	}
+	// 空值始终排在最后（SQLite 与 PostgreSQL 对 NULL 的默认排序相反），id 保证分页稳定
+	order := fmt.Sprintf("(%s IS NULL), %s %s, id %s", column, column, direction, direction)
+	return strings.Join(conds, " AND "), args, order, nil
+}
+
+// QueryBlacklistStatus 按条件分页查询黑名单状态（供前端调用，避免历史记录增多后全量拉取）
+func (bs *BlacklistService) QueryBlacklistStatus(platform string, query BlacklistQuery) (*BlacklistStatusPage, error) {
+	now := time.Now()
+	where, args, order, err := buildBlacklistQuery(platform, query, now)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sharedDB()
 	if err != nil {
 		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
 	}
@@ -663,10 +780,16 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 		levelConfig = DefaultBlacklistLevelConfig()
 	}
 
-	rows, err := db.Query(`
+	page := &BlacklistStatusPage{Items: []BlacklistStatus{}}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM provider_blacklist WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("统计黑名单记录失败: %w", err)
+	}
+
+	statement := `
 		SELECT
 			platform,
 			provider_name,
+			COALESCE(provider_uid, ''),
 			failure_count,
 			blacklisted_at,
 			blacklisted_until,
@@ -674,25 +797,31 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 			blacklist_level,
 			last_recovered_at
 		FROM provider_blacklist
-		WHERE platform = ?
-		ORDER BY last_failure_at DESC
-	`, platform)
+		WHERE ` + where + `
+		ORDER BY ` + order
+	if query.Limit > 0 {
+		limit := query.Limit
+		if limit > maxBlacklistPageSize {
+			limit = maxBlacklistPageSize
+		}
+		statement += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, query.Offset)
+	}
+	rows, err := db.Query(statement, args...)
 
 	if err != nil {
 		return nil, fmt.Errorf("查询黑名单状态失败: %w", err)
 	}
 	defer rows.Close()
 
-	var statuses []BlacklistStatus
-	now := time.Now()
-
 	for rows.Next() {
 		var s BlacklistStatus
-		var blacklistedAt, blacklistedUntil, lastFailureAt, lastRecoveredAt sql.NullTime
+		var blacklistedAt, blacklistedUntil, lastFailureAt, lastRecoveredAt epochTime
 
 		err := rows.Scan(
 			&s.Platform,
 			&s.ProviderName,
+			&s.ProviderUID,
 			&s.FailureCount,
 			&blacklistedAt,
 			&blacklistedUntil,
@@ -736,10 +865,10 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 			}
 		}
 
-		statuses = append(statuses, s)
+		page.Items = append(page.Items, s)
 	}
 
-	return statuses, nil
+	return page, rows.Err()
 }
 
 // IsLevelBlacklistEnabled 返回等级拉黑功能是否开启
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildBlacklistQuery(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	where, args, order, err := buildBlacklistQuery("claude", BlacklistQuery{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if where != "1=1 AND platform = ?" || len(args) != 1 {
+		t.Errorf("默认条件 = %q %v", where, args)
+	}
+	if !strings.HasPrefix(order, "(last_failure_at IS NULL), last_failure_at DESC") {
+		t.Errorf("默认排序 = %q", order)
+	}
+
+	where, args, order, err = buildBlacklistQuery("", BlacklistQuery{OnlyActive: true, Since: 1_699_999_000_000, OrderBy: "level", Ascending: true}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if where != "1=1 AND blacklisted_until > ? AND last_failure_at >= ?" {
+		t.Errorf("where = %q", where)
+	}
+	if args[0] != now.Unix() || args[1] != int64(1_699_999_000) {
+		t.Errorf("args = %v", args)
+	}
+	if order != "(blacklist_level IS NULL), blacklist_level ASC, id ASC" {
+		t.Errorf("order = %q", order)
+	}
+
+	if _, _, _, err := buildBlacklistQuery("claude", BlacklistQuery{OrderBy: "id; DROP TABLE x"}, now); err == nil {
+		t.Error("未知排序字段应报错")
+	}
+	if _, _, _, err := buildBlacklistQuery("claude", BlacklistQuery{Offset: -1}, now); err == nil {
+		t.Error("负数 offset 应报错")
+	}
+}
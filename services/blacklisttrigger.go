@@ -0,0 +1,185 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 拉黑触发条件表达式（基于 request_log 计算，任一条件满足即拉黑）：
+//
+//	failures >= 3 within 5m        5 分钟内失败不少于 3 次
+//	error_rate > 50% over 20       最近 20 个请求的错误率超过 50%
+//
+// 失败指 HTTP 状态码不是 2xx/3xx（包括无响应）
+var (
+	failuresTriggerPattern  = regexp.MustCompile(`^failures\s*(>=|>)\s*(\d+)\s+within\s+(\S+)$`)
+	errorRateTriggerPattern = regexp.MustCompile(`^error_rate\s*(>=|>)\s*(\d+(?:\.\d+)?)%\s+over\s+(\d+)(?:\s+requests?)?$`)
+)
+
+const (
+	triggerKindFailures  = "failures"
+	triggerKindErrorRate = "error_rate"
+
+	maxTriggerWindow   = 24 * time.Hour
+	maxTriggerRequests = 1000
+)
+
+// blacklistTrigger 解析后的触发条件
+type blacklistTrigger struct {
+	expr      string
+	kind      string
+	inclusive bool    // >= 还是 >
+	threshold float64 // 失败次数或错误率（0-100）
+	window    time.Duration
+	requests  int
+}
+
+// parseBlacklistTrigger 解析触发条件表达式
+func parseBlacklistTrigger(expr string) (*blacklistTrigger, error) {
+	normalized := strings.Join(strings.Fields(strings.ToLower(expr)), " ")
+	if m := failuresTriggerPattern.FindStringSubmatch(normalized); m != nil {
+		count, _ := strconv.Atoi(m[2])
+		window, err := time.ParseDuration(m[3])
+		if err != nil {
+			return nil, fmt.Errorf("触发条件 %q 的时间窗口无效（示例: 30s、5m、1h）", expr)
+		}
+		if window <= 0 || window > maxTriggerWindow {
+			return nil, fmt.Errorf("触发条件 %q 的时间窗口必须在 0-24h 之间", expr)
+		}
+		if count < 1 || (count < 2 && m[1] == ">=") {
+			return nil, fmt.Errorf("触发条件 %q 的失败次数至少为 2", expr)
+		}
+		return &blacklistTrigger{expr: expr, kind: triggerKindFailures, inclusive: m[1] == ">=", threshold: float64(count), window: window}, nil
+	}
+	if m := errorRateTriggerPattern.FindStringSubmatch(normalized); m != nil {
+		rate, _ := strconv.ParseFloat(m[2], 64)
+		requests, _ := strconv.Atoi(m[3])
+		if rate <= 0 || rate > 100 {
+			return nil, fmt.Errorf("触发条件 %q 的错误率必须在 0-100%% 之间", expr)
+		}
+		if requests < 2 || requests > maxTriggerRequests {
+			return nil, fmt.Errorf("触发条件 %q 的请求数必须在 2-%d 之间", expr, maxTriggerRequests)
+		}
+		return &blacklistTrigger{expr: expr, kind: triggerKindErrorRate, inclusive: m[1] == ">=", threshold: rate, requests: requests}, nil
+	}
+	return nil, fmt.Errorf("无法解析触发条件 %q（示例: \"failures >= 3 within 5m\"、\"error_rate > 50%% over 20\"）", expr)
+}
+
+// validateBlacklistTriggers 校验全部触发条件
+func validateBlacklistTriggers(exprs []string) error {
+	for _, expr := range exprs {
+		if _, err := parseBlacklistTrigger(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *blacklistTrigger) compare(value float64) bool {
+	if t.inclusive {
+		return value >= t.threshold
+	}
+	return value > t.threshold
+}
+
+// matches 用请求结果（从新到旧，true 表示失败）判断是否满足条件
+// failures 类型的 outcomes 只包含时间窗口内的请求
+func (t *blacklistTrigger) matches(outcomes []bool) bool {
+	failures := 0
+	switch t.kind {
+	case triggerKindFailures:
+		for _, failed := range outcomes {
+			if failed {
+				failures++
+			}
+		}
+		return t.compare(float64(failures))
+	case triggerKindErrorRate:
+		// 样本不足时不判定，避免 1 次失败即为 100% 错误率
+		if len(outcomes) < t.requests {
+			return false
+		}
+		for _, failed := range outcomes[:t.requests] {
+			if failed {
+				failures++
+			}
+		}
+		return t.compare(float64(failures) * 100 / float64(t.requests))
+	}
+	return false
+}
+
+// requestOutcomes 从 request_log 读取 provider 的请求结果（从新到旧）
+// since 之前的请求不参与计算（上次恢复前的失败不应再次触发拉黑）
+func requestOutcomes(platform, providerName string, since time.Time, limit int) ([]bool, error) {
+	db, err := sharedDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT http_code FROM request_log
+		WHERE platform = ? AND provider = ? AND created_at >= ?
+		ORDER BY id DESC LIMIT ?
+	`, platform, providerName, since.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var outcomes []bool
+	for rows.Next() {
+		var code int
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		outcomes = append(outcomes, code < 200 || code >= 400)
+	}
+	return outcomes, rows.Err()
+}
+
+// evaluateBlacklistTriggers 判断是否有触发条件满足，返回满足的表达式
+// resetAt 为上次恢复（或拉黑到期）时间，此前的请求不参与计算
+func evaluateBlacklistTriggers(platform, providerName string, exprs []string, resetAt time.Time, now time.Time) (string, bool, error) {
+	for _, expr := range exprs {
+		trigger, err := parseBlacklistTrigger(expr)
+		if err != nil {
+			return "", false, err
+		}
+		since, limit := resetAt, trigger.requests
+		if trigger.kind == triggerKindFailures {
+			if windowStart := now.Add(-trigger.window); windowStart.After(since) {
+				since = windowStart
+			}
+			limit = maxTriggerRequests
+		}
+		outcomes, err := requestOutcomes(platform, providerName, since, limit)
+		if err != nil {
+			return "", false, fmt.Errorf("读取请求日志失败: %w", err)
+		}
+		if trigger.matches(outcomes) {
+			return expr, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// failureThresholdReached 判断是否应拉黑：配置了触发条件时按请求日志计算，否则按连续失败计数
+func failureThresholdReached(platform, providerName string, failureCount, threshold int, triggers []string, resetAt time.Time, now time.Time) bool {
+	if len(triggers) == 0 {
+		return failureCount >= threshold
+	}
+	expr, matched, err := evaluateBlacklistTriggers(platform, providerName, triggers, resetAt, now)
+	if err != nil {
+		// 触发条件无法计算时退回连续失败计数，避免故障 provider 一直不被拉黑
+		log.Printf("⚠️  计算拉黑触发条件失败，改用连续失败计数: %v", err)
+		return failureCount >= threshold
+	}
+	if matched {
+		log.Printf("🎯 Provider %s/%s 满足拉黑触发条件: %s", platform, providerName, expr)
+	}
+	return matched
+}
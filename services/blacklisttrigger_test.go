@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBlacklistTrigger(t *testing.T) {
+	trigger, err := parseBlacklistTrigger("Failures >= 3  within 5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trigger.kind != triggerKindFailures || trigger.threshold != 3 || trigger.window != 5*time.Minute || !trigger.inclusive {
+		t.Errorf("failures trigger = %+v", trigger)
+	}
+
+	trigger, err = parseBlacklistTrigger("error_rate > 50% over 20 requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trigger.kind != triggerKindErrorRate || trigger.threshold != 50 || trigger.requests != 20 || trigger.inclusive {
+		t.Errorf("error_rate trigger = %+v", trigger)
+	}
+
+	for _, expr := range []string{"failures >= 1 within 5m", "failures >= 3 within 48h", "error_rate > 150% over 20", "error_rate > 50% over 1", "latency > 3s"} {
+		if _, err := parseBlacklistTrigger(expr); err == nil {
+			t.Errorf("%q 应校验失败", expr)
+		}
+	}
+}
+
+func TestBlacklistTriggerMatches(t *testing.T) {
+	failures, _ := parseBlacklistTrigger("failures >= 3 within 5m")
+	if failures.matches([]bool{true, false, true}) {
+		t.Error("2 次失败不应触发")
+	}
+	if !failures.matches([]bool{true, true, false, true}) {
+		t.Error("3 次失败应触发")
+	}
+
+	rate, _ := parseBlacklistTrigger("error_rate > 50% over 4")
+	if rate.matches([]bool{true, true, true}) {
+		t.Error("样本不足时不应触发")
+	}
+	if rate.matches([]bool{true, true, false, false, true}) {
+		t.Error("50% 不应触发 > 50%")
+	}
+	if !rate.matches([]bool{true, true, true, false, false}) {
+		t.Error("75% 应触发")
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/tidwall/sjson"
+)
+
+// budgetSpendCacheTTL 当日花费的缓存时间，避免每个请求都扫描 request_log
+const budgetSpendCacheTTL = 30 * time.Second
+
+// defaultDowngradeRules 默认降级规则：高价模型 -> 同系列低价模型
+var defaultDowngradeRules = map[string]string{
+	"claude-opus-*":  "claude-sonnet-4-5",
+	"gpt-4o":         "gpt-4o-mini",
+	"gpt-5":          "gpt-5-mini",
+	"gpt-5-codex":    "gpt-5-mini",
+	"gemini-2.5-pro": "gemini-2.5-flash",
+}
+
+// BudgetStatus 当日预算使用情况
+type BudgetStatus struct {
+	DailyLimitUSD    float64 `json:"dailyLimitUsd"`
+	SpentTodayUSD    float64 `json:"spentTodayUsd"`
+	UsedPercent      float64 `json:"usedPercent"`
+	DowngradeEnabled bool    `json:"downgradeEnabled"`
+	DowngradeActive  bool    `json:"downgradeActive"` // 当前是否处于降级状态
+}
+
+// budgetTracker 缓存当日花费
+type budgetTracker struct {
+	mu        sync.Mutex
+	spent     float64
+	day       string
+	fetchedAt time.Time
+}
+
+func newBudgetTracker() *budgetTracker {
+	return &budgetTracker{}
+}
+
+// spentToday 返回当日累计花费（美元），包含高可用对端实例的花费
+func (bt *budgetTracker) spentToday() (float64, error) {
+	spent, err := bt.localSpentToday()
+	return spent + peerSpendToday(time.Now()), err
+}
+
+// localSpentToday 返回本实例的当日累计花费（美元），缓存过期时重新统计
+func (bt *budgetTracker) localSpentToday() (float64, error) {
+	now := time.Now()
+	today := now.Format("2006-01-02")
+
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if bt.day == today && now.Sub(bt.fetchedAt) < budgetSpendCacheTTL {
+		return bt.spent, nil
+	}
+
+	spent, err := sumCostSince(startOfDay(now))
+	if err != nil {
+		return bt.spent, err
+	}
+	bt.spent = spent
+	bt.day = today
+	bt.fetchedAt = now
+	return spent, nil
+}
+
+// sumCostSince 统计指定时间以来所有请求的费用
+func sumCostSince(since time.Time) (float64, error) {
+	pricing, err := modelpricing.DefaultService()
+	if err != nil {
+		return 0, fmt.Errorf("加载模型价格失败: %w", err)
+	}
+	records, err := sharedModel("request_log").Selects(
+		xdb.WhereGte("created_at", since.Unix()),
+		xdb.Field(
+			"model",
+			"input_tokens",
+			"output_tokens",
+			"reasoning_tokens",
+			"cache_create_tokens",
+			"cache_read_tokens",
+		),
+	)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	total := 0.0
+	for _, record := range records {
+		total += pricing.CalculateCost(record.GetString("model"), modelpricing.UsageSnapshot{
+			InputTokens:       record.GetInt("input_tokens"),
+			OutputTokens:      record.GetInt("output_tokens"),
+			ReasoningTokens:   record.GetInt("reasoning_tokens"),
+			CacheCreateTokens: record.GetInt("cache_create_tokens"),
+			CacheReadTokens:   record.GetInt("cache_read_tokens"),
+		}).TotalCost
+	}
+	return total, nil
+}
+
+// downgradeTarget 根据规则查找降级后的模型，精确匹配优先，其次是更长的通配符模式
+func downgradeTarget(rules map[string]string, model string) (string, bool) {
+	if model == "" {
+		return "", false
+	}
+	if target, ok := rules[model]; ok && target != "" && target != model {
+		return target, true
+	}
+
+	patterns := make([]string, 0, len(rules))
+	for pattern := range rules {
+		if strings.Contains(pattern, "*") {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool { return len(patterns[i]) > len(patterns[j]) })
+	for _, pattern := range patterns {
+		if matchWildcard(pattern, model) {
+			target := applyWildcardMapping(pattern, rules[pattern], model)
+			if target != "" && target != model {
+				return target, true
+			}
+		}
+	}
+	return "", false
+}
+
+// applyBudgetDowngrade 当日花费超过阈值时将请求模型改写为低价模型
+// 返回改写后的请求体与模型名；未触发时原样返回
+func (prs *ProviderRelayService) applyBudgetDowngrade(kind string, bodyBytes []byte, model string) ([]byte, string) {
+	config := currentRelayConfig().Budget
+	if !config.DowngradeEnabled || config.DailyLimitUSD <= 0 || model == "" || prs.budget == nil {
+		return bodyBytes, model
+	}
+
+	target, ok := downgradeTarget(config.effectiveRules(), model)
+	if !ok {
+		return bodyBytes, model
+	}
+
+	spent, err := prs.budget.spentToday()
+	if err != nil {
+		fmt.Printf("[WARN] 统计当日花费失败，跳过预算降级: %v\n", err)
+		return bodyBytes, model
+	}
+	// 计入本次请求的预估输入费用，避免单个大请求越过预算
+	spent += estimateRequestCost(model, bodyBytes)
+	usedPercent := spent / config.DailyLimitUSD * 100
+	if usedPercent < float64(config.DowngradeThreshold) {
+		return bodyBytes, model
+	}
+
+	modified, err := sjson.SetBytes(bodyBytes, "model", target)
+	if err != nil {
+		fmt.Printf("[WARN] 改写模型失败，跳过预算降级: %v\n", err)
+		return bodyBytes, model
+	}
+
+	fmt.Printf("[INFO] 💸 当日花费 $%.2f 已达预算 %.0f%%，模型降级: %s -> %s\n", spent, usedPercent, model, target)
+	recordAudit("budget", "model_downgrade", fmt.Sprintf(
+		"[%s] %s -> %s（当日花费 $%.4f / 预算 $%.2f，%.1f%%）",
+		kind, model, target, spent, config.DailyLimitUSD, usedPercent,
+	))
+	if prs.notificationService != nil {
+		prs.notificationService.NotifyModelDowngraded(kind, model, target, spent, config.DailyLimitUSD)
+	}
+	return modified, target
+}
+
+// effectiveRules 返回生效的降级规则（未配置时使用默认规则）
+func (c RelayBudgetConfig) effectiveRules() map[string]string {
+	if len(c.DowngradeRules) > 0 {
+		return c.DowngradeRules
+	}
+	return defaultDowngradeRules
+}
+
+// GetBudgetStatus 获取当日预算使用情况（供前端调用）
+func (prs *ProviderRelayService) GetBudgetStatus() (BudgetStatus, error) {
+	config := currentRelayConfig().Budget
+	status := BudgetStatus{
+		DailyLimitUSD:    config.DailyLimitUSD,
+		DowngradeEnabled: config.DowngradeEnabled,
+	}
+	if prs.budget == nil {
+		return status, nil
+	}
+	spent, err := prs.budget.spentToday()
+	if err != nil {
+		return status, err
+	}
+	status.SpentTodayUSD = spent
+	if config.DailyLimitUSD > 0 {
+		status.UsedPercent = spent / config.DailyLimitUSD * 100
+		status.DowngradeActive = config.DowngradeEnabled && status.UsedPercent >= float64(config.DowngradeThreshold)
+	}
+	return status, nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestDowngradeTarget(t *testing.T) {
+	rules := map[string]string{
+		"claude-opus-*":     "claude-sonnet-4-5",
+		"claude-opus-4-1-*": "claude-sonnet-4",
+		"gpt-4o":            "gpt-4o-mini",
+		"gpt-4o-mini":       "gpt-4o-mini",
+		"gemini-*":          "",
+	}
+	tests := []struct {
+		model  string
+		want   string
+		wantOK bool
+	}{
+		{"gpt-4o", "gpt-4o-mini", true},
+		{"claude-opus-4", "claude-sonnet-4-5", true},
+		{"claude-opus-4-1-20250805", "claude-sonnet-4", true}, // 更长的通配符优先
+		{"gpt-4o-mini", "", false},                            // 目标与原模型相同
+		{"gemini-2.5-pro", "", false},                         // 目标为空
+		{"claude-haiku-4-5", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := downgradeTarget(rules, tt.model)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("downgradeTarget(%q) = (%q, %v)，期望 (%q, %v)", tt.model, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestBudgetTrackerSpentToday(t *testing.T) {
+	writeTestRelayConfig(t, DefaultRelayConfig())
+	newTestDatabase(t)
+	defer activeHAPeerUsage.Store(nil)
+	db, err := sharedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pricing, err := modelpricing.DefaultService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const model = "claude-sonnet-4-5"
+	cost := func(input, output int) float64 {
+		return pricing.CalculateCost(model, modelpricing.UsageSnapshot{InputTokens: input, OutputTokens: output}).TotalCost
+	}
+	insert := func(input, output int, at time.Time) {
+		t.Helper()
+		if _, err := db.Exec(`INSERT INTO request_log (platform, model, provider, input_tokens, output_tokens, created_at) VALUES ('claude', ?, 'p', ?, ?, ?)`,
+			model, input, output, at.Unix()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+	now := time.Now()
+	insert(1000, 500, now)
+	insert(2000, 0, now)
+	insert(100000, 100000, startOfDay(now).Add(-time.Second)) // 昨天的请求不计入
+	want := cost(1000, 500) + cost(2000, 0)
+	if want <= 0 {
+		t.Fatalf("%s 应有价格", model)
+	}
+
+	bt := newBudgetTracker()
+	if got, err := bt.spentToday(); err != nil || !near(got, want) {
+		t.Fatalf("spentToday() = %v, %v，期望 %v", got, err, want)
+	}
+
+	// 缓存有效期内不重新统计
+	insert(3000, 0, now)
+	if got, _ := bt.spentToday(); !near(got, want) {
+		t.Errorf("缓存有效期内应返回缓存值 %v，得到 %v", want, got)
+	}
+	bt.fetchedAt = time.Now().Add(-budgetSpendCacheTTL)
+	want += cost(3000, 0)
+	if got, _ := bt.spentToday(); !near(got, want) {
+		t.Errorf("缓存过期后应重新统计为 %v，得到 %v", want, got)
+	}
+
+	// 跨天后即使缓存未过期也重新统计，不沿用前一天的花费
+	bt.day, bt.spent, bt.fetchedAt = "2000-01-01", 999, time.Now()
+	if got, _ := bt.spentToday(); !near(got, want) {
+		t.Errorf("跨天后应重新统计为 %v，得到 %v", want, got)
+	}
+
+	// 高可用对端的花费只计入同一天的
+	activeHAPeerUsage.Store(&haPeerUsage{day: now.Format("2006-01-02"), spentUSD: 2})
+	if got, _ := bt.spentToday(); !near(got, want+2) {
+		t.Errorf("应计入对端当日花费，得到 %v", got)
+	}
+	activeHAPeerUsage.Store(&haPeerUsage{day: "2000-01-01", spentUSD: 2})
+	if got, _ := bt.spentToday(); !near(got, want) {
+		t.Errorf("不应计入对端前一天的花费，得到 %v", got)
+	}
+}
+
+func TestApplyBudgetDowngrade(t *testing.T) {
+	tests := []struct {
+		name      string
+		budget    RelayBudgetConfig
+		spent     float64
+		model     string
+		wantModel string
+	}{
+		{name: "未启用降级", budget: RelayBudgetConfig{DailyLimitUSD: 10, DowngradeThreshold: 80}, spent: 100, model: "gpt-4o", wantModel: "gpt-4o"},
+		{name: "未设置预算", budget: RelayBudgetConfig{DowngradeEnabled: true, DowngradeThreshold: 80}, spent: 100, model: "gpt-4o", wantModel: "gpt-4o"},
+		{name: "低于阈值", budget: RelayBudgetConfig{DailyLimitUSD: 10, DowngradeEnabled: true, DowngradeThreshold: 80}, spent: 7.9, model: "gpt-4o", wantModel: "gpt-4o"},
+		{name: "恰好达到阈值", budget: RelayBudgetConfig{DailyLimitUSD: 10, DowngradeEnabled: true, DowngradeThreshold: 80}, spent: 8, model: "gpt-4o", wantModel: "gpt-4o-mini"},
+		{name: "超出预算", budget: RelayBudgetConfig{DailyLimitUSD: 10, DowngradeEnabled: true, DowngradeThreshold: 80}, spent: 12, model: "gpt-4o", wantModel: "gpt-4o-mini"},
+		{name: "没有降级规则", budget: RelayBudgetConfig{DailyLimitUSD: 10, DowngradeEnabled: true, DowngradeThreshold: 80}, spent: 12, model: "gpt-4o-mini", wantModel: "gpt-4o-mini"},
+		{name: "自定义规则", budget: RelayBudgetConfig{DailyLimitUSD: 10, DowngradeEnabled: true, DowngradeThreshold: 50, DowngradeRules: map[string]string{"gpt-4o": "gpt-4.1-mini"}}, spent: 5, model: "gpt-4o", wantModel: "gpt-4.1-mini"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultRelayConfig()
+			config.Budget = tt.budget
+			writeTestRelayConfig(t, config)
+			// 预置当日花费缓存，不访问数据库
+			prs := &ProviderRelayService{budget: &budgetTracker{spent: tt.spent, day: time.Now().Format("2006-01-02"), fetchedAt: time.Now()}}
+
+			body := []byte(`{"model":"` + tt.model + `","messages":[{"role":"user","content":"hi"}]}`)
+			gotBody, gotModel := prs.applyBudgetDowngrade("codex", body, tt.model)
+			if gotModel != tt.wantModel || gjson.GetBytes(gotBody, "model").String() != tt.wantModel {
+				t.Errorf("applyBudgetDowngrade() 模型 = %q，请求体 = %s，期望 %q", gotModel, gotBody, tt.wantModel)
+			}
+
+			status, err := prs.GetBudgetStatus()
+			wantActive := tt.budget.DowngradeEnabled && tt.budget.DailyLimitUSD > 0 && tt.spent/tt.budget.DailyLimitUSD*100 >= float64(tt.budget.DowngradeThreshold)
+			if err != nil || status.SpentTodayUSD != tt.spent || status.DowngradeActive != wantActive {
+				t.Errorf("GetBudgetStatus() = %+v, %v，期望 DowngradeActive = %v", status, err, wantActive)
+			}
+		})
+	}
+}
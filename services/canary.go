@@ -0,0 +1,298 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 灰度切换状态
+const (
+	CanaryStateRunning    = "running"     // 灰度中
+	CanaryStateCompleted  = "completed"   // 已全量切换
+	CanaryStateRolledBack = "rolled_back" // 新 provider 错误率过高，已回滚
+	CanaryStateAborted    = "aborted"     // 用户手动取消
+)
+
+// CanaryStatus 灰度切换状态
+type CanaryStatus struct {
+	Platform      string  `json:"platform"`
+	From          string  `json:"from"`          // 原 provider
+	To            string  `json:"to"`            // 新 provider
+	State         string  `json:"state"`         // running / completed / rolled_back / aborted
+	Percent       int     `json:"percent"`       // 当前分配给新 provider 的流量百分比
+	StartedAt     int64   `json:"startedAt"`     // 毫秒
+	EndsAt        int64   `json:"endsAt"`        // 毫秒
+	FromRequests  int     `json:"fromRequests"`  // 灰度期间原 provider 的请求数
+	FromErrors    int     `json:"fromErrors"`    // 灰度期间原 provider 的失败数
+	ToRequests    int     `json:"toRequests"`    // 灰度期间新 provider 的请求数
+	ToErrors      int     `json:"toErrors"`      // 灰度期间新 provider 的失败数
+	ToErrorRate   float64 `json:"toErrorRate"`   // 新 provider 错误率
+	FromErrorRate float64 `json:"fromErrorRate"` // 原 provider 错误率
+	Reason        string  `json:"reason,omitempty"`
+}
+
+// canaryRollout 单个平台的灰度切换过程
+type canaryRollout struct {
+	status CanaryStatus
+	steps  []int
+}
+
+// canaryController 管理各平台的灰度切换（内存中，重启后未完成的灰度失效）
+type canaryController struct {
+	mu       sync.Mutex
+	rollouts map[string]*canaryRollout // key: platform
+	rand     func() float64
+}
+
+func newCanaryController() *canaryController {
+	return &canaryController{rollouts: make(map[string]*canaryRollout), rand: rand.Float64}
+}
+
+// percentAt 按时间计算当前灰度比例：灰度窗口按步骤数等分
+func (r *canaryRollout) percentAt(now time.Time) int {
+	start, end := r.status.StartedAt, r.status.EndsAt
+	if now.UnixMilli() >= end || len(r.steps) == 0 {
+		return 100
+	}
+	stepLength := (end - start) / int64(len(r.steps))
+	if stepLength <= 0 {
+		return 100
+	}
+	index := int((now.UnixMilli() - start) / stepLength)
+	if index >= len(r.steps) {
+		index = len(r.steps) - 1
+	}
+	return r.steps[index]
+}
+
+// route 决定本次请求优先使用哪个 provider，返回 provider 名称（无进行中的灰度时返回空）
+// 灰度窗口结束时返回 completed=true，由调用方完成永久切换
+func (cc *canaryController) route(kind string, now time.Time) (target string, completed *CanaryStatus) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	rollout, ok := cc.rollouts[kind]
+	if !ok || rollout.status.State != CanaryStateRunning {
+		return "", nil
+	}
+	if now.UnixMilli() >= rollout.status.EndsAt {
+		rollout.status.State = CanaryStateCompleted
+		rollout.status.Percent = 100
+		finished := rollout.status
+		return rollout.status.To, &finished
+	}
+	rollout.status.Percent = rollout.percentAt(now)
+	if cc.rand()*100 < float64(rollout.status.Percent) {
+		return rollout.status.To, nil
+	}
+	return rollout.status.From, nil
+}
+
+// observe 记录灰度期间两个 provider 的请求结果；新 provider 错误率超出原 provider 时回滚
+func (cc *canaryController) observe(kind, providerName string, ok bool, err error, config RelayCanaryConfig) *CanaryStatus {
+	// 客户端中断与排队超时不反映 provider 质量
+	if !ok && (errors.Is(err, errClientAbort) || errors.Is(err, errQueueTimeout)) {
+		return nil
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	rollout, exists := cc.rollouts[kind]
+	if !exists || rollout.status.State != CanaryStateRunning {
+		return nil
+	}
+	status := &rollout.status
+	switch providerName {
+	case status.To:
+		status.ToRequests++
+		if !ok {
+			status.ToErrors++
+		}
+	case status.From:
+		status.FromRequests++
+		if !ok {
+			status.FromErrors++
+		}
+	default:
+		return nil
+	}
+	status.ToErrorRate = errorRate(status.ToErrors, status.ToRequests)
+	status.FromErrorRate = errorRate(status.FromErrors, status.FromRequests)
+
+	if status.ToRequests < config.MinSamples || status.ToErrorRate <= status.FromErrorRate+config.ErrorRateMargin {
+		return nil
+	}
+	status.State = CanaryStateRolledBack
+	status.Reason = fmt.Sprintf("新 provider 错误率 %.0f%% 高于原 provider %.0f%%", status.ToErrorRate*100, status.FromErrorRate*100)
+	rolledBack := *status
+	return &rolledBack
+}
+
+func errorRate(errs, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(errs) / float64(total)
+}
+
+// applyCanary 按灰度比例调整本次请求的 provider 顺序：被选中的 provider 放到最前并提升到最高优先级的 Level
+func (prs *ProviderRelayService) applyCanary(kind string, active []Provider) []Provider {
+	target, completed := prs.canary.route(kind, time.Now())
+	if completed != nil {
+		prs.finishCanary(*completed)
+	}
+	if target == "" {
+		return active
+	}
+
+	index, topLevel := -1, 0
+	for i, p := range active {
+		level := p.Level
+		if level <= 0 {
+			level = 1
+		}
+		if topLevel == 0 || level < topLevel {
+			topLevel = level
+		}
+		if p.Name == target {
+			index = i
+		}
+	}
+	if index < 0 {
+		return active
+	}
+	chosen := active[index]
+	chosen.Level = topLevel
+	reordered := make([]Provider, 0, len(active))
+	reordered = append(reordered, chosen)
+	reordered = append(reordered, active[:index]...)
+	return append(reordered, active[index+1:]...)
+}
+
+// observeCanary 记录请求结果，触发回滚时发送通知
+func (prs *ProviderRelayService) observeCanary(kind, providerName string, ok bool, err error) {
+	rolledBack := prs.canary.observe(kind, providerName, ok, err, currentRelayConfig().Canary)
+	if rolledBack == nil {
+		return
+	}
+	log.Printf("🐤 [%s] 灰度切换 %s → %s 已回滚: %s", kind, rolledBack.From, rolledBack.To, rolledBack.Reason)
+	recordAudit("canary", "rollback", fmt.Sprintf("%s: %s → %s，%s", kind, rolledBack.From, rolledBack.To, rolledBack.Reason))
+	if prs.notificationService != nil {
+		prs.notificationService.NotifyCanary(*rolledBack)
+	}
+}
+
+// finishCanary 灰度窗口结束，永久切换到新 provider
+func (prs *ProviderRelayService) finishCanary(status CanaryStatus) {
+	if err := prs.providerService.SwitchProvider(status.Platform, status.To); err != nil {
+		log.Printf("⚠️  [%s] 灰度完成但切换到 %s 失败: %v", status.Platform, status.To, err)
+		return
+	}
+	log.Printf("🐤 [%s] 灰度切换完成，已全量切换到 %s", status.Platform, status.To)
+	recordAudit("canary", "complete", fmt.Sprintf("%s: %s → %s", status.Platform, status.From, status.To))
+	if prs.notificationService != nil {
+		prs.notificationService.NotifyCanary(status)
+	}
+}
+
+// StartCanary 开始灰度切换到指定 provider（供前端调用）
+// 按配置的比例（默认 10%→50%→100%）在窗口期内逐步放量，窗口结束后永久切换
+func (prs *ProviderRelayService) StartCanary(platform string, provider string, windowMinutes int) (*CanaryStatus, error) {
+	if platform != "claude" && platform != "codex" {
+		return nil, fmt.Errorf("灰度切换仅支持 claude、codex 平台")
+	}
+	config := currentRelayConfig().Canary
+	if err := validateCanaryConfig(config); err != nil {
+		config = DefaultRelayConfig().Canary
+	}
+	if windowMinutes <= 0 {
+		windowMinutes = config.WindowMinutes
+	}
+
+	providers, err := prs.providerService.LoadProviders(platform)
+	if err != nil {
+		return nil, err
+	}
+	sortProvidersByLevel(providers)
+	from, found := "", false
+	for _, p := range providers {
+		if p.Name == provider {
+			found = true
+			if p.APIURL == "" || p.APIKey == "" || p.IsAuthDisabled() {
+				return nil, fmt.Errorf("provider %s 配置不完整或密钥已失效", provider)
+			}
+			continue
+		}
+		if from == "" && p.Enabled && !p.IsAuthDisabled() {
+			from = p.Name
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("未找到名为 '%s' 的供应商", provider)
+	}
+	if from == "" {
+		// 没有可对比的原 provider，直接切换
+		if err := prs.providerService.SwitchProvider(platform, provider); err != nil {
+			return nil, err
+		}
+		return &CanaryStatus{Platform: platform, To: provider, State: CanaryStateCompleted, Percent: 100}, nil
+	}
+
+	// 新 provider 需要处于启用状态才能参与转发
+	if err := prs.providerService.updateProviderByName(platform, provider, func(p *Provider) { p.Enabled = true }); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rollout := &canaryRollout{
+		steps: config.Steps,
+		status: CanaryStatus{
+			Platform:  platform,
+			From:      from,
+			To:        provider,
+			State:     CanaryStateRunning,
+			Percent:   config.Steps[0],
+			StartedAt: now.UnixMilli(),
+			EndsAt:    now.Add(time.Duration(windowMinutes) * time.Minute).UnixMilli(),
+		},
+	}
+	prs.canary.mu.Lock()
+	prs.canary.rollouts[platform] = rollout
+	prs.canary.mu.Unlock()
+
+	log.Printf("🐤 [%s] 开始灰度切换 %s → %s，窗口 %d 分钟，比例 %v", platform, from, provider, windowMinutes, config.Steps)
+	recordAudit("canary", "start", fmt.Sprintf("%s: %s → %s，窗口 %d 分钟", platform, from, provider, windowMinutes))
+	status := rollout.status
+	return &status, nil
+}
+
+// GetCanaryStatus 获取平台最近一次灰度切换的状态（供前端调用），没有时返回 nil
+func (prs *ProviderRelayService) GetCanaryStatus(platform string) *CanaryStatus {
+	prs.canary.mu.Lock()
+	defer prs.canary.mu.Unlock()
+	rollout, ok := prs.canary.rollouts[platform]
+	if !ok {
+		return nil
+	}
+	status := rollout.status
+	if status.State == CanaryStateRunning {
+		status.Percent = rollout.percentAt(time.Now())
+	}
+	return &status
+}
+
+// AbortCanary 取消进行中的灰度切换，流量回到原 provider（供前端调用）
+func (prs *ProviderRelayService) AbortCanary(platform string) error {
+	prs.canary.mu.Lock()
+	defer prs.canary.mu.Unlock()
+	rollout, ok := prs.canary.rollouts[platform]
+	if !ok || rollout.status.State != CanaryStateRunning {
+		return fmt.Errorf("%s 没有进行中的灰度切换", platform)
+	}
+	rollout.status.State = CanaryStateAborted
+	recordAudit("canary", "abort", fmt.Sprintf("%s: %s → %s", platform, rollout.status.From, rollout.status.To))
+	return nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanaryRollout_PercentAt(t *testing.T) {
+	start := time.Now()
+	rollout := &canaryRollout{
+		steps: []int{10, 50, 100},
+		status: CanaryStatus{
+			StartedAt: start.UnixMilli(),
+			EndsAt:    start.Add(30 * time.Minute).UnixMilli(),
+		},
+	}
+	tests := []struct {
+		elapsed time.Duration
+		want    int
+	}{
+		{0, 10},
+		{9 * time.Minute, 10},
+		{11 * time.Minute, 50},
+		{25 * time.Minute, 100},
+		{31 * time.Minute, 100},
+	}
+	for _, tt := range tests {
+		if got := rollout.percentAt(start.Add(tt.elapsed)); got != tt.want {
+			t.Errorf("percentAt(+%s) = %d, want %d", tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestCanaryController_RollbackOnHigherErrorRate(t *testing.T) {
+	cc := newCanaryController()
+	cc.rollouts["claude"] = &canaryRollout{
+		steps:  []int{10, 100},
+		status: CanaryStatus{Platform: "claude", From: "old", To: "new", State: CanaryStateRunning},
+	}
+	config := RelayCanaryConfig{MinSamples: 4, ErrorRateMargin: 0.1}
+
+	for i := 0; i < 10; i++ {
+		cc.observe("claude", "old", true, nil, config)
+	}
+	cc.observe("claude", "new", true, nil, config)
+	cc.observe("claude", "new", false, nil, config)
+	if status := cc.observe("claude", "new", false, nil, config); status != nil {
+		t.Fatal("样本不足时不应回滚")
+	}
+	status := cc.observe("claude", "new", false, nil, config)
+	if status == nil || status.State != CanaryStateRolledBack {
+		t.Fatalf("新 provider 错误率 75%% 应触发回滚，实际为 %+v", status)
+	}
+	if target, _ := cc.route("claude", time.Now()); target != "" {
+		t.Errorf("回滚后不应再按灰度选路，实际为 %s", target)
+	}
+}
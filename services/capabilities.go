@@ -0,0 +1,412 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// provider 能力标记：从社区维护的数据集中读取已知中转域名的能力与信任说明（是否支持流式、是否去掉缓存请求头、
+// 是否记录请求内容），在 provider 旁显示为标记。数据集必须带有 Ed25519 签名（同地址加 .sig，内容为 base64），
+// 签名校验通过后缓存到 ~/.code-switch/capabilities.json，离线时使用缓存。本地覆盖写在 relay-config.json 中，逐项优先于数据集。
+
+const (
+	// capabilityDatasetMaxBytes 数据集大小上限
+	capabilityDatasetMaxBytes = 4 << 20
+	// capabilityCacheFile 缓存文件名（签名保存在同名 .sig 文件中）
+	capabilityCacheFile = "capabilities.json"
+)
+
+// RelayCapabilitiesConfig provider 能力数据集配置
+type RelayCapabilitiesConfig struct {
+	DatasetURL   string            `json:"datasetUrl,omitempty"` // 数据集地址，为空表示不拉取
+	PublicKey    string            `json:"publicKey,omitempty"`  // 校验签名的 Ed25519 公钥（base64）
+	RefreshHours int               `json:"refreshHours"`         // 刷新间隔（小时）
+	Overrides    []CapabilityEntry `json:"overrides,omitempty"`  // 本地覆盖，逐项优先于数据集
+}
+
+// CapabilityEntry 一个域名的能力说明，未填写的项表示未知
+type CapabilityEntry struct {
+	Domain             string `json:"domain"`                       // 域名，支持 *.example.com 匹配子域名
+	Streaming          *bool  `json:"streaming,omitempty"`          // 支持流式响应
+	StripsCacheHeaders *bool  `json:"stripsCacheHeaders,omitempty"` // 会去掉 prompt 缓存相关请求头
+	LogsPrompts        *bool  `json:"logsPrompts,omitempty"`        // 会记录请求内容
+	Notes              string `json:"notes,omitempty"`              // 信任说明
+}
+
+// CapabilityDataset 社区数据集
+type CapabilityDataset struct {
+	Version   int               `json:"version"`
+	UpdatedAt string            `json:"updatedAt,omitempty"`
+	Entries   []CapabilityEntry `json:"entries"`
+}
+
+// ProviderBadge provider 旁显示的标记
+type ProviderBadge struct {
+	Key    string `json:"key"`    // streaming / no-streaming / strips-cache / keeps-cache / logs-prompts / no-prompt-logs / notes
+	Label  string `json:"label"`  // 显示文字
+	Tone   string `json:"tone"`   // positive / warning / info
+	Source string `json:"source"` // dataset / local
+}
+
+// CapabilityStatus 数据集状态
+type CapabilityStatus struct {
+	Configured bool   `json:"configured"`
+	Entries    int    `json:"entries"`
+	Overrides  int    `json:"overrides"`
+	UpdatedAt  string `json:"updatedAt,omitempty"` // 数据集自身标注的更新时间
+	FetchedAt  int64  `json:"fetchedAt,omitempty"` // 最近一次校验通过的时间（毫秒）
+	Error      string `json:"error,omitempty"`
+}
+
+func validateCapabilitiesConfig(config RelayCapabilitiesConfig) error {
+	if config.DatasetURL != "" {
+		if err := validateHTTPURL(config.DatasetURL, "datasetUrl"); err != nil {
+			return err
+		}
+		if _, err := capabilityPublicKey(config.PublicKey); err != nil {
+			return err
+		}
+	}
+	if config.RefreshHours < 1 || config.RefreshHours > 24*7 {
+		return fmt.Errorf("能力数据集刷新间隔必须在 1-168 小时之间")
+	}
+	seen := make(map[string]bool)
+	for _, entry := range config.Overrides {
+		domain := strings.ToLower(strings.TrimSpace(entry.Domain))
+		if domain == "" {
+			return fmt.Errorf("能力覆盖的域名不能为空")
+		}
+		if seen[domain] {
+			return fmt.Errorf("能力覆盖的域名重复: %s", domain)
+		}
+		seen[domain] = true
+	}
+	return nil
+}
+
+// capabilityPublicKey 解析 base64 编码的 Ed25519 公钥
+func capabilityPublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("能力数据集公钥无效（需要 base64 编码的 Ed25519 公钥）")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifyCapabilityDataset 校验签名并解析数据集
+func verifyCapabilityDataset(data, signature []byte, publicKey string) (*CapabilityDataset, error) {
+	key, err := capabilityPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(key, data, sig) {
+		return nil, fmt.Errorf("能力数据集签名校验失败")
+	}
+	dataset := &CapabilityDataset{}
+	if err := json.Unmarshal(data, dataset); err != nil {
+		return nil, fmt.Errorf("解析能力数据集失败: %w", err)
+	}
+	return dataset, nil
+}
+
+// matchCapabilityEntry 返回与主机名匹配的条目，精确域名优先，其次是更长的通配符
+func matchCapabilityEntry(host string, entries []CapabilityEntry) *CapabilityEntry {
+	var best *CapabilityEntry
+	bestScore := -1
+	for i := range entries {
+		pattern := strings.ToLower(strings.TrimSpace(entries[i].Domain))
+		if !matchDomain(host, pattern) {
+			continue
+		}
+		score := len(pattern)
+		if !strings.HasPrefix(pattern, "*.") {
+			score += 1 << 16
+		}
+		if score > bestScore {
+			best, bestScore = &entries[i], score
+		}
+	}
+	return best
+}
+
+// capabilityBadges 合并数据集与本地覆盖，生成主机名对应的标记
+func capabilityBadges(host string, dataset, overrides []CapabilityEntry) []ProviderBadge {
+	remote, local := matchCapabilityEntry(host, dataset), matchCapabilityEntry(host, overrides)
+	// pick 本地覆盖填写了该项时使用本地值
+	pick := func(get func(*CapabilityEntry) *bool) (*bool, string) {
+		if local != nil && get(local) != nil {
+			return get(local), "local"
+		}
+		if remote != nil {
+			return get(remote), "dataset"
+		}
+		return nil, ""
+	}
+	checks := []struct {
+		get              func(*CapabilityEntry) *bool
+		yesKey, yesLabel string
+		noKey, noLabel   string
+		yesTone, noTone  string
+	}{
+		{func(e *CapabilityEntry) *bool { return e.Streaming }, "streaming", "支持流式", "no-streaming", "不支持流式", "positive", "warning"},
+		{func(e *CapabilityEntry) *bool { return e.StripsCacheHeaders }, "strips-cache", "去掉缓存请求头", "keeps-cache", "保留缓存请求头", "warning", "positive"},
+		{func(e *CapabilityEntry) *bool { return e.LogsPrompts }, "logs-prompts", "记录请求内容", "no-prompt-logs", "不记录请求内容", "warning", "positive"},
+	}
+	var badges []ProviderBadge
+	for _, check := range checks {
+		value, source := pick(check.get)
+		switch {
+		case value == nil:
+		case *value:
+			badges = append(badges, ProviderBadge{Key: check.yesKey, Label: check.yesLabel, Tone: check.yesTone, Source: source})
+		default:
+			badges = append(badges, ProviderBadge{Key: check.noKey, Label: check.noLabel, Tone: check.noTone, Source: source})
+		}
+	}
+	if local != nil && local.Notes != "" {
+		badges = append(badges, ProviderBadge{Key: "notes", Label: local.Notes, Tone: "info", Source: "local"})
+	} else if remote != nil && remote.Notes != "" {
+		badges = append(badges, ProviderBadge{Key: "notes", Label: remote.Notes, Tone: "info", Source: "dataset"})
+	}
+	return badges
+}
+
+// CapabilityService 定期拉取签名的能力数据集，为 provider 生成能力标记
+type CapabilityService struct {
+	providerService *ProviderService
+	client          *http.Client
+	mu              sync.Mutex
+	dataset         *CapabilityDataset
+	fetchedAt       time.Time
+	lastErr         error
+}
+
+func NewCapabilityService(providerService *ProviderService) *CapabilityService {
+	return &CapabilityService{
+		providerService: providerService,
+		client:          &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Start 读取缓存并注册定时刷新任务（未配置数据集地址时不刷新）
+func (cs *CapabilityService) Start() error {
+	cs.mu.Lock()
+	cs.loadCacheLocked()
+	cs.mu.Unlock()
+
+	scheduleJob(backgroundJob{
+		name:  "capabilities",
+		title: "能力数据集刷新",
+		delay: time.Minute,
+		interval: func() time.Duration {
+			config := currentRelayConfig().Capabilities
+			if config.DatasetURL == "" {
+				return 0
+			}
+			interval := time.Duration(config.RefreshHours) * time.Hour
+			if interval < time.Hour {
+				interval = 24 * time.Hour
+			}
+			return interval
+		},
+		run: func() error {
+			if _, err := cs.RefreshCapabilities(); err != nil {
+				return fmt.Errorf("刷新能力数据集失败: %w", err)
+			}
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止定时刷新
+func (cs *CapabilityService) Stop() error {
+	unscheduleJob("capabilities")
+	return nil
+}
+
+// capabilityCachePath 数据集缓存路径
+func capabilityCachePath() (string, error) {
+	return filepath.Join(getConfigDir(), capabilityCacheFile), nil
+}
+
+// loadCacheLocked 读取缓存的数据集，并用当前配置的公钥重新校验
+func (cs *CapabilityService) loadCacheLocked() {
+	config := currentRelayConfig().Capabilities
+	if config.DatasetURL == "" {
+		return
+	}
+	path, err := capabilityCachePath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	signature, err := os.ReadFile(path + ".sig")
+	if err != nil {
+		return
+	}
+	dataset, err := verifyCapabilityDataset(data, signature, config.PublicKey)
+	if err != nil {
+		log.Printf("[Capabilities] 缓存的能力数据集无效: %v", err)
+		return
+	}
+	cs.dataset = dataset
+	if info, err := os.Stat(path); err == nil {
+		cs.fetchedAt = info.ModTime()
+	}
+}
+
+// fetch 下载数据集或签名
+func (cs *CapabilityService) fetch(url string) ([]byte, error) {
+	resp, err := cs.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s 返回 HTTP %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, capabilityDatasetMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > capabilityDatasetMaxBytes {
+		return nil, fmt.Errorf("%s 超过大小上限", url)
+	}
+	return data, nil
+}
+
+// RefreshCapabilities 立即拉取并校验能力数据集（供前端调用）
+// 校验失败时保留上一次有效的数据集
+func (cs *CapabilityService) RefreshCapabilities() (CapabilityStatus, error) {
+	config := currentRelayConfig().Capabilities
+	if config.DatasetURL == "" {
+		return cs.GetCapabilityStatus(), fmt.Errorf("未配置能力数据集地址")
+	}
+	data, err := cs.fetch(config.DatasetURL)
+	var signature []byte
+	if err == nil {
+		signature, err = cs.fetch(config.DatasetURL + ".sig")
+	}
+	var dataset *CapabilityDataset
+	if err == nil {
+		dataset, err = verifyCapabilityDataset(data, signature, config.PublicKey)
+	}
+
+	cs.mu.Lock()
+	cs.lastErr = err
+	if err == nil {
+		cs.dataset, cs.fetchedAt = dataset, time.Now()
+	}
+	cs.mu.Unlock()
+	if err != nil {
+		return cs.GetCapabilityStatus(), err
+	}
+
+	if path, pathErr := capabilityCachePath(); pathErr == nil {
+		writeErr := AtomicWriteBytes(path, data)
+		if writeErr == nil {
+			writeErr = AtomicWriteBytes(path+".sig", signature)
+		}
+		if writeErr != nil {
+			log.Printf("[Capabilities] 缓存能力数据集失败: %v", writeErr)
+		}
+	}
+	return cs.GetCapabilityStatus(), nil
+}
+
+// GetCapabilityStatus 获取能力数据集状态（供前端调用）
+func (cs *CapabilityService) GetCapabilityStatus() CapabilityStatus {
+	config := currentRelayConfig().Capabilities
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	status := CapabilityStatus{Configured: config.DatasetURL != "", Overrides: len(config.Overrides)}
+	if cs.dataset != nil {
+		status.Entries, status.UpdatedAt = len(cs.dataset.Entries), cs.dataset.UpdatedAt
+		status.FetchedAt = cs.fetchedAt.UnixMilli()
+	}
+	if cs.lastErr != nil {
+		status.Error = cs.lastErr.Error()
+	}
+	return status
+}
+
+// GetProviderBadges 获取各 provider 的能力标记，key 为 provider 名称（供前端调用）
+func (cs *CapabilityService) GetProviderBadges(kind string) (map[string][]ProviderBadge, error) {
+	providers, err := cs.providerService.LoadProviders(kind)
+	if err != nil {
+		return nil, err
+	}
+	config := currentRelayConfig().Capabilities
+	cs.mu.Lock()
+	var entries []CapabilityEntry
+	if cs.dataset != nil {
+		entries = cs.dataset.Entries
+	}
+	cs.mu.Unlock()
+
+	result := make(map[string][]ProviderBadge)
+	for _, p := range providers {
+		host, err := upstreamHost(p.APIURL)
+		if err != nil {
+			continue
+		}
+		if badges := capabilityBadges(host, entries, config.Overrides); len(badges) > 0 {
+			result[p.Name] = badges
+		}
+	}
+	return result, nil
+}
+
+// SetCapabilityOverride 新增或替换某个域名的本地覆盖（供前端调用）
+func (ss *SettingsService) SetCapabilityOverride(entry CapabilityEntry) error {
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return err
+	}
+	entry.Domain = strings.ToLower(strings.TrimSpace(entry.Domain))
+	overrides := make([]CapabilityEntry, 0, len(config.Capabilities.Overrides)+1)
+	for _, item := range config.Capabilities.Overrides {
+		if !strings.EqualFold(item.Domain, entry.Domain) {
+			overrides = append(overrides, item)
+		}
+	}
+	overrides = append(overrides, entry)
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Domain < overrides[j].Domain })
+	config.Capabilities.Overrides = overrides
+	return ss.UpdateRelayConfig(config)
+}
+
+// DeleteCapabilityOverride 删除某个域名的本地覆盖（供前端调用）
+func (ss *SettingsService) DeleteCapabilityOverride(domain string) error {
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return err
+	}
+	kept := make([]CapabilityEntry, 0, len(config.Capabilities.Overrides))
+	for _, item := range config.Capabilities.Overrides {
+		if !strings.EqualFold(item.Domain, strings.TrimSpace(domain)) {
+			kept = append(kept, item)
+		}
+	}
+	if len(kept) == len(config.Capabilities.Overrides) {
+		return fmt.Errorf("没有域名 %s 的能力覆盖", domain)
+	}
+	config.Capabilities.Overrides = kept
+	return ss.UpdateRelayConfig(config)
+}
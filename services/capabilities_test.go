@@ -0,0 +1,50 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func TestVerifyCapabilityDataset(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(public)
+	data := []byte(`{"version":1,"entries":[{"domain":"*.relay.example","streaming":true}]}`)
+	signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, data)))
+
+	dataset, err := verifyCapabilityDataset(data, signature, key)
+	if err != nil || len(dataset.Entries) != 1 {
+		t.Fatalf("verifyCapabilityDataset() = %+v, %v", dataset, err)
+	}
+	tampered := []byte(`{"version":1,"entries":[{"domain":"*.relay.example","streaming":false}]}`)
+	if _, err := verifyCapabilityDataset(tampered, signature, key); err == nil {
+		t.Error("篡改后的数据集应校验失败")
+	}
+}
+
+func TestCapabilityBadges(t *testing.T) {
+	yes, no := true, false
+	dataset := []CapabilityEntry{
+		{Domain: "*.relay.example", Streaming: &yes, LogsPrompts: &yes, Notes: "社区反馈会记录请求"},
+		{Domain: "api.relay.example", StripsCacheHeaders: &yes},
+	}
+	overrides := []CapabilityEntry{{Domain: "*.relay.example", LogsPrompts: &no}}
+
+	// 精确域名优先于通配符，未填写的项不显示
+	badges := capabilityBadges("api.relay.example", dataset, overrides)
+	if len(badges) != 2 || badges[0].Key != "strips-cache" || badges[1].Key != "no-prompt-logs" || badges[1].Source != "local" {
+		t.Errorf("unexpected badges: %+v", badges)
+	}
+
+	badges = capabilityBadges("eu.relay.example", dataset, overrides)
+	if len(badges) != 3 || badges[0].Key != "streaming" || badges[0].Source != "dataset" || badges[1].Key != "no-prompt-logs" || badges[2].Key != "notes" {
+		t.Errorf("unexpected badges: %+v", badges)
+	}
+	if badges := capabilityBadges("other.example", dataset, overrides); len(badges) != 0 {
+		t.Errorf("未匹配的域名不应有标记: %+v", badges)
+	}
+}
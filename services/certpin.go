@@ -0,0 +1,210 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certPinPrefix 证书指纹格式：sha256/<base64(SHA-256(SubjectPublicKeyInfo))>，与 HPKP、curl --pinnedpubkey 一致
+const certPinPrefix = "sha256/"
+
+// errCertPinMismatch 上游证书与固定的指纹不一致
+var errCertPinMismatch = errors.New("certificate pin mismatch")
+
+// certPinAlerted 已告警的指纹不一致（platform/provider/指纹），避免每个请求重复告警
+var certPinAlerted sync.Map
+
+// CertPinInfo 上游证书链中一张证书的指纹
+type CertPinInfo struct {
+	Pin       string `json:"pin"`
+	Subject   string `json:"subject"`
+	Issuer    string `json:"issuer"`
+	NotAfter  int64  `json:"notAfter"` // 毫秒
+	IsLeaf    bool   `json:"isLeaf"`
+	IsCurrent bool   `json:"isCurrent"` // 是否与 provider 已固定的指纹匹配
+}
+
+// spkiPin 计算证书公钥的 SPKI 指纹
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return certPinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// validateCertPins 校验指纹格式
+func validateCertPins(pins []string) error {
+	for _, pin := range pins {
+		encoded, ok := strings.CutPrefix(strings.TrimSpace(pin), certPinPrefix)
+		if !ok {
+			return fmt.Errorf("无效的证书指纹 %q（格式应为 sha256/<base64>）", pin)
+		}
+		if sum, err := base64.StdEncoding.DecodeString(encoded); err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("无效的证书指纹 %q（应为 SHA-256 的 base64 编码）", pin)
+		}
+	}
+	return nil
+}
+
+// matchCertPins 证书链（叶子证书或任一中间证书）是否命中固定的指纹
+func matchCertPins(certs []*x509.Certificate, pins []string) bool {
+	for _, cert := range certs {
+		pin := spkiPin(cert)
+		for _, pinned := range pins {
+			if strings.TrimSpace(pinned) == pin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upstreamClientFor 转发到指定 provider 的 HTTP 客户端：启用证书固定时在标准证书校验之后再比对指纹
+func (prs *ProviderRelayService) upstreamClientFor(kind string, provider Provider) *http.Client {
+	client := upstreamClient()
+	applyProviderNetwork(client, provider.network())
+	if !provider.CertPinning && len(provider.CertPins) == 0 {
+		return client
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return client
+	}
+	transport.ForceAttemptHTTP2 = true
+	transport.TLSClientConfig = &tls.Config{
+		// 只在系统证书校验通过后执行，自动记录的指纹一定来自可信的连接
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return prs.verifyCertPins(kind, provider, state)
+		},
+	}
+	return client
+}
+
+// withCertPins 需要证书固定或单独的出站网络配置时为 provider 创建客户端（沿用 shared 的超时），否则直接使用 shared
+func (prs *ProviderRelayService) withCertPins(kind string, provider Provider, shared *http.Client) *http.Client {
+	if !provider.CertPinning && len(provider.CertPins) == 0 && provider.network().isZero() {
+		return shared
+	}
+	client := prs.upstreamClientFor(kind, provider)
+	client.Timeout = shared.Timeout
+	return client
+}
+
+// verifyCertPins 比对证书指纹；尚未固定时记录首次连接的叶子证书指纹
+func (prs *ProviderRelayService) verifyCertPins(kind string, provider Provider, state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: 上游未提供证书", errCertPinMismatch)
+	}
+	leafPin := spkiPin(state.PeerCertificates[0])
+	if len(provider.CertPins) == 0 {
+		go prs.captureCertPin(kind, provider.Name, leafPin)
+		return nil
+	}
+	if matchCertPins(state.PeerCertificates, provider.CertPins) {
+		return nil
+	}
+	prs.reportCertPinMismatch(kind, provider.Name, state.ServerName, leafPin)
+	return fmt.Errorf("%w: %s 的证书指纹为 %s", errCertPinMismatch, state.ServerName, leafPin)
+}
+
+// captureCertPin 首次验证通过的连接自动固定叶子证书指纹（已有指纹时不覆盖）
+func (prs *ProviderRelayService) captureCertPin(kind, name, pin string) {
+	captured := false
+	err := prs.providerService.updateProviderByName(kind, name, func(p *Provider) {
+		if p.CertPinning && len(p.CertPins) == 0 {
+			p.CertPins = []string{pin}
+			captured = true
+		}
+	})
+	if err != nil {
+		log.Printf("⚠️  [%s] 记录 %s 的证书指纹失败: %v", kind, name, err)
+		return
+	}
+	if captured {
+		log.Printf("🔐 [%s] 已固定 %s 的证书指纹 %s", kind, name, pin)
+		recordAudit("cert_pin", "capture", fmt.Sprintf("%s/%s: %s", kind, name, pin))
+	}
+}
+
+// reportCertPinMismatch 指纹不一致时记录审计并发送告警（同一指纹只告警一次）
+func (prs *ProviderRelayService) reportCertPinMismatch(kind, name, host, pin string) {
+	if _, alerted := certPinAlerted.LoadOrStore(kind+"/"+name+"/"+pin, true); alerted {
+		return
+	}
+	log.Printf("🚨 [%s] %s 的证书指纹不一致（%s: %s），已拒绝连接", kind, name, host, pin)
+	recordAudit("cert_pin", "mismatch", fmt.Sprintf("%s/%s %s: %s", kind, name, host, pin))
+	if prs.notificationService != nil {
+		prs.notificationService.NotifyCertPinMismatch(kind, name, host, pin)
+	}
+}
+
+// GetUpstreamCertPins 连接上游并列出证书链各证书的指纹，用于手动固定（供前端调用）
+func (ps *ProviderService) GetUpstreamCertPins(kind string, name string) ([]CertPinInfo, error) {
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range providers {
+		if p.Name == name {
+			return fetchCertPins(p.APIURL, p.CertPins)
+		}
+	}
+	return nil, fmt.Errorf("未找到名为 '%s' 的供应商", name)
+}
+
+// fetchCertPins 建立 TLS 连接（执行标准证书校验）并返回证书链指纹
+func fetchCertPins(rawURL string, pinned []string) ([]CertPinInfo, error) {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return nil, fmt.Errorf("无效的地址: %s", rawURL)
+	}
+	if parsed.Scheme != "https" {
+		return nil, fmt.Errorf("仅 https 地址支持证书固定")
+	}
+	if err := checkUpstreamURL(rawURL); err != nil {
+		return nil, err
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(parsed.Hostname(), port), &tls.Config{ServerName: parsed.Hostname()})
+	if err != nil {
+		return nil, fmt.Errorf("TLS 连接失败: %w", err)
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	infos := make([]CertPinInfo, 0, len(certs))
+	for i, cert := range certs {
+		pin := spkiPin(cert)
+		infos = append(infos, CertPinInfo{
+			Pin:       pin,
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			NotAfter:  cert.NotAfter.UnixMilli(),
+			IsLeaf:    i == 0,
+			IsCurrent: matchCertPins([]*x509.Certificate{cert}, pinned),
+		})
+	}
+	return infos, nil
+}
+
+// ResetCertPins 清除 provider 的证书指纹，启用证书固定时下次连接重新记录（证书正常轮换后使用，供前端调用）
+func (ps *ProviderService) ResetCertPins(kind string, name string) error {
+	if err := ps.updateProviderByName(kind, name, func(p *Provider) { p.CertPins = nil }); err != nil {
+		return err
+	}
+	recordAudit("cert_pin", "reset", fmt.Sprintf("%s/%s", kind, name))
+	return nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCert 生成 host 的自签名证书，供证书固定与 TLS 诊断测试共用
+func newTestCert(t *testing.T, host string, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestSpkiPinMatch(t *testing.T) {
+	notAfter := time.Now().Add(time.Hour)
+	leaf, other := newTestCert(t, "api.example.com", notAfter), newTestCert(t, "api.example.com", notAfter)
+	pin := spkiPin(leaf)
+	if !strings.HasPrefix(pin, certPinPrefix) {
+		t.Fatalf("spkiPin = %q, want prefix %q", pin, certPinPrefix)
+	}
+	if err := validateCertPins([]string{pin}); err != nil {
+		t.Errorf("validateCertPins(%q) = %v", pin, err)
+	}
+	if !matchCertPins([]*x509.Certificate{other, leaf}, []string{pin}) {
+		t.Error("pin of intermediate certificate should match")
+	}
+	if matchCertPins([]*x509.Certificate{other}, []string{pin}) {
+		t.Error("pin of different key should not match")
+	}
+}
+
+func TestValidateCertPinsInvalid(t *testing.T) {
+	for _, pin := range []string{"", "abc", "sha1/AAAA", "sha256/not-base64", "sha256/AAAA"} {
+		if err := validateCertPins([]string{pin}); err == nil {
+			t.Errorf("validateCertPins(%q) should fail", pin)
+		}
+	}
+}
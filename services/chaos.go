@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 故障注入类型
+const (
+	ChaosFaultTimeout      = "timeout"      // 等待一段时间后按超时失败
+	ChaosFaultRateLimit    = "429"          // 返回 429 Too Many Requests
+	ChaosFaultServerError  = "5xx"          // 返回 503 Service Unavailable
+	ChaosFaultUnauthorized = "401"          // 返回 401（验证密钥失效自动停用）
+	ChaosFaultConnRefused  = "conn_refused" // 连接失败（不产生 HTTP 状态码）
+)
+
+const (
+	// chaosDefaultDuration 故障规则默认有效期，避免测试后忘记关闭
+	chaosDefaultDuration = 10 * time.Minute
+	// chaosMaxDuration 故障规则最长有效期
+	chaosMaxDuration = 2 * time.Hour
+	// chaosDefaultTimeoutDelay 模拟超时的默认等待时间
+	chaosDefaultTimeoutDelay = 5 * time.Second
+)
+
+// ChaosRule 故障注入规则：仅在内存中生效，不写入配置文件，重启后失效
+type ChaosRule struct {
+	Platform        string  `json:"platform"`        // claude / codex
+	Provider        string  `json:"provider"`        // provider 名称
+	Fault           string  `json:"fault"`           // timeout / 429 / 5xx / 401 / conn_refused
+	Probability     float64 `json:"probability"`     // 注入概率（0-1），0 视为 1
+	DelayMs         int     `json:"delayMs"`         // timeout 故障的等待时间，0 使用默认 5 秒
+	DurationMinutes int     `json:"durationMinutes"` // 有效期（分钟），0 使用默认 10 分钟
+	ExpiresAt       int64   `json:"expiresAt"`       // 过期时间（毫秒），由服务端计算
+	Injected        int     `json:"injected"`        // 已注入次数
+}
+
+// chaosInjector 管理故障注入规则（按 platform/provider 索引）
+type chaosInjector struct {
+	mu    sync.Mutex
+	rules map[string]*ChaosRule
+	rand  func() float64
+}
+
+func newChaosInjector() *chaosInjector {
+	return &chaosInjector{rules: make(map[string]*ChaosRule), rand: rand.Float64}
+}
+
+// pick 判断本次请求是否注入故障，返回命中的规则副本
+func (ci *chaosInjector) pick(kind, providerName string, now time.Time) *ChaosRule {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	key := kind + "/" + providerName
+	rule, ok := ci.rules[key]
+	if !ok {
+		return nil
+	}
+	if now.UnixMilli() >= rule.ExpiresAt {
+		delete(ci.rules, key)
+		fmt.Printf("[CHAOS] 故障注入规则已过期: %s\n", key)
+		return nil
+	}
+	if rule.Probability < 1 && ci.rand() >= rule.Probability {
+		return nil
+	}
+	rule.Injected++
+	picked := *rule
+	return &picked
+}
+
+// inject 模拟故障，返回模拟的状态码（连接类故障为 0）与错误
+func (rule *ChaosRule) inject(ctx context.Context) (int, error) {
+	switch rule.Fault {
+	case ChaosFaultTimeout:
+		delay := time.Duration(rule.DelayMs) * time.Millisecond
+		if delay <= 0 {
+			delay = chaosDefaultTimeoutDelay
+		}
+		select {
+		case <-time.After(delay):
+			return 0, fmt.Errorf("[chaos] 模拟超时（%s）", delay)
+		case <-ctx.Done():
+			return 0, fmt.Errorf("%w: %v", errClientAbort, ctx.Err())
+		}
+	case ChaosFaultRateLimit:
+		return http.StatusTooManyRequests, fmt.Errorf("[chaos] upstream status %d", http.StatusTooManyRequests)
+	case ChaosFaultServerError:
+		return http.StatusServiceUnavailable, fmt.Errorf("[chaos] upstream status %d", http.StatusServiceUnavailable)
+	case ChaosFaultUnauthorized:
+		return http.StatusUnauthorized, fmt.Errorf("[chaos] upstream status %d", http.StatusUnauthorized)
+	default:
+		return 0, fmt.Errorf("[chaos] 模拟连接失败: connection refused")
+	}
+}
+
+func isValidChaosFault(fault string) bool {
+	switch fault {
+	case ChaosFaultTimeout, ChaosFaultRateLimit, ChaosFaultServerError, ChaosFaultUnauthorized, ChaosFaultConnRefused:
+		return true
+	}
+	return false
+}
+
+// SetChaosRule 为指定 provider 设置故障注入规则（供前端调用，用于演练降级链路、拉黑阈值与通知）
+func (prs *ProviderRelayService) SetChaosRule(rule ChaosRule) (*ChaosRule, error) {
+	if rule.Platform != "claude" && rule.Platform != "codex" {
+		return nil, fmt.Errorf("故障注入仅支持 claude、codex 平台")
+	}
+	if rule.Provider == "" {
+		return nil, fmt.Errorf("请指定 provider")
+	}
+	if !isValidChaosFault(rule.Fault) {
+		return nil, fmt.Errorf("无效的故障类型: %s（可选值: timeout、429、5xx、401、conn_refused）", rule.Fault)
+	}
+	if rule.Probability < 0 || rule.Probability > 1 {
+		return nil, fmt.Errorf("注入概率必须在 0-1 之间")
+	}
+	if rule.Probability == 0 {
+		rule.Probability = 1
+	}
+	duration := time.Duration(rule.DurationMinutes) * time.Minute
+	if duration <= 0 {
+		duration = chaosDefaultDuration
+	}
+	if duration > chaosMaxDuration {
+		return nil, fmt.Errorf("故障注入有效期不能超过 %d 分钟", int(chaosMaxDuration.Minutes()))
+	}
+	rule.ExpiresAt = time.Now().Add(duration).UnixMilli()
+	rule.Injected = 0
+
+	prs.chaos.mu.Lock()
+	prs.chaos.rules[rule.Platform+"/"+rule.Provider] = &rule
+	prs.chaos.mu.Unlock()
+
+	fmt.Printf("[CHAOS] ⚡ 已启用故障注入: %s/%s 故障=%s 概率=%.0f%% 有效期 %s\n",
+		rule.Platform, rule.Provider, rule.Fault, rule.Probability*100, duration)
+	recordAudit("chaos", "enable", fmt.Sprintf("%s/%s 故障=%s 概率=%.2f 有效期 %s", rule.Platform, rule.Provider, rule.Fault, rule.Probability, duration))
+	return &rule, nil
+}
+
+// GetChaosRules 获取当前生效的故障注入规则（供前端调用）
+func (prs *ProviderRelayService) GetChaosRules() []ChaosRule {
+	now := time.Now().UnixMilli()
+	prs.chaos.mu.Lock()
+	defer prs.chaos.mu.Unlock()
+	rules := make([]ChaosRule, 0, len(prs.chaos.rules))
+	for key, rule := range prs.chaos.rules {
+		if now >= rule.ExpiresAt {
+			delete(prs.chaos.rules, key)
+			continue
+		}
+		rules = append(rules, *rule)
+	}
+	return rules
+}
+
+// ClearChaosRules 清除故障注入规则（provider 为空时清除该平台全部规则，platform 也为空时清除所有规则）
+func (prs *ProviderRelayService) ClearChaosRules(platform string, provider string) int {
+	prs.chaos.mu.Lock()
+	defer prs.chaos.mu.Unlock()
+	cleared := 0
+	for key, rule := range prs.chaos.rules {
+		if (platform == "" || rule.Platform == platform) && (provider == "" || rule.Provider == provider) {
+			delete(prs.chaos.rules, key)
+			cleared++
+		}
+	}
+	if cleared > 0 {
+		fmt.Printf("[CHAOS] 已清除 %d 条故障注入规则\n", cleared)
+		recordAudit("chaos", "clear", fmt.Sprintf("清除 %d 条规则（platform=%q provider=%q）", cleared, platform, provider))
+	}
+	return cleared
+}
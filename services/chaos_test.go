@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestChaosInjector_Pick(t *testing.T) {
+	ci := newChaosInjector()
+	now := time.Now()
+	ci.rules["claude/p"] = &ChaosRule{Platform: "claude", Provider: "p", Fault: ChaosFaultRateLimit, Probability: 0.5, ExpiresAt: now.Add(time.Minute).UnixMilli()}
+
+	ci.rand = func() float64 { return 0.7 }
+	if rule := ci.pick("claude", "p", now); rule != nil {
+		t.Error("随机数高于概率时不应注入")
+	}
+	ci.rand = func() float64 { return 0.2 }
+	rule := ci.pick("claude", "p", now)
+	if rule == nil {
+		t.Fatal("随机数低于概率时应注入")
+	}
+	if status, err := rule.inject(context.Background()); status != http.StatusTooManyRequests || err == nil {
+		t.Errorf("inject() = %d, %v, want 429 和错误", status, err)
+	}
+	if rule := ci.pick("codex", "p", now); rule != nil {
+		t.Error("其他平台的同名 provider 不应注入")
+	}
+	if rule := ci.pick("claude", "p", now.Add(2*time.Minute)); rule != nil {
+		t.Error("过期规则不应注入")
+	}
+	if len(ci.rules) != 0 {
+		t.Error("过期规则应被移除")
+	}
+}
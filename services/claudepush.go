@@ -0,0 +1,196 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// 切换 Claude 供应商时直接写入 ~/.claude/settings.json 的方式（不经过中继）
+const (
+	ClaudePushModeEnv          = "env"          // 写入 env.ANTHROPIC_BASE_URL 与 env.ANTHROPIC_AUTH_TOKEN
+	ClaudePushModeAPIKeyHelper = "apiKeyHelper" // 写入 env.ANTHROPIC_BASE_URL，Key 由本地脚本输出
+)
+
+const (
+	claudePushBackupFileName = "settings.json.code-switch.bak"
+	claudeKeyHelperBaseName  = "claude-api-key-helper"
+)
+
+// keyHelperSafeKey apiKeyHelper 脚本中直接输出的 Key 只允许常见字符，避免脚本注入
+var keyHelperSafeKey = regexp.MustCompile(`^[A-Za-z0-9._\-]+$`)
+
+// AttachProviderPush 在 Claude 供应商切换时按应用设置写入 settings.json（启动时调用一次）
+func (css *ClaudeSettingsService) AttachProviderPush(providerService *ProviderService, appSettings *AppSettingsService) {
+	providerService.addSwitchHook(func(tx *configTransaction, kind string, provider Provider) (func(), error) {
+		if kind != "claude" || appSettings == nil {
+			return nil, nil
+		}
+		settings, err := appSettings.GetAppSettings()
+		if err != nil || !settings.PushClaudeSettings {
+			return nil, nil
+		}
+		settingsPath, _, err := css.paths()
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Track(settingsPath); err != nil {
+			return nil, err
+		}
+		return css.pushProvider(provider, settings.ClaudePushMode)
+	})
+}
+
+// pushProvider 将 provider 写入 settings.json，返回回滚函数
+// 已启用中继代理时不写入（请求已经经过中继，直接写入上游地址会绕过中继）
+func (css *ClaudeSettingsService) pushProvider(provider Provider, mode string) (func(), error) {
+	if status, err := css.ProxyStatus(); err == nil && status.Enabled {
+		log.Printf("[ClaudeSettings] 已启用中继代理，跳过写入 %s 的配置", provider.Name)
+		return nil, nil
+	}
+	if provider.isSplitProvider() || provider.APIURL == "" || provider.APIKey == "" {
+		log.Printf("[ClaudeSettings] %s 没有可直接使用的地址或 Key，跳过写入 settings.json", provider.Name)
+		return nil, nil
+	}
+	if mode == "" {
+		mode = ClaudePushModeEnv
+	}
+
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureNoConfigDrift(configDriftClaude, settingsPath); err != nil {
+		return nil, err
+	}
+	backupPath := filepath.Join(filepath.Dir(settingsPath), claudePushBackupFileName)
+	if err := os.MkdirAll(filepath.Dir(settingsPath), 0o755); err != nil {
+		return nil, err
+	}
+
+	original, readErr := os.ReadFile(settingsPath)
+	existed := readErr == nil
+	if readErr != nil && !errors.Is(readErr, os.ErrNotExist) {
+		return nil, fmt.Errorf("读取 settings.json 失败: %w", readErr)
+	}
+	data := map[string]interface{}{}
+	if len(original) > 0 {
+		// 格式无效时不覆盖，避免丢失用户手写的配置
+		if err := json.Unmarshal(original, &data); err != nil {
+			return nil, fmt.Errorf("settings.json 格式无效，未写入: %w", err)
+		}
+	}
+	if existed {
+		if err := os.WriteFile(backupPath, original, 0o600); err != nil {
+			return nil, fmt.Errorf("备份 settings.json 失败: %w", err)
+		}
+	}
+
+	rollback := func() {
+		var err error
+		if existed {
+			err = AtomicWriteBytes(settingsPath, original)
+			recordConfigSync(configDriftClaude, settingsPath, original)
+		} else {
+			err = os.Remove(settingsPath)
+			forgetConfigSync(configDriftClaude)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[ClaudeSettings] ⚠️  回滚 settings.json 失败（备份: %s）: %v", backupPath, err)
+		}
+	}
+
+	if err := applyClaudePush(data, provider, mode); err != nil {
+		return nil, err
+	}
+	if err := AtomicWriteJSON(settingsPath, data); err != nil {
+		return nil, fmt.Errorf("写入 settings.json 失败: %w", err)
+	}
+	// 写入后重新读取校验，失败时恢复原文件
+	if err := verifyClaudePush(settingsPath, provider); err != nil {
+		rollback()
+		return nil, err
+	}
+	recordConfigSyncFile(configDriftClaude, settingsPath)
+	log.Printf("[ClaudeSettings] 已将 %s 写入 settings.json（%s）", provider.Name, mode)
+	return rollback, nil
+}
+
+// applyClaudePush 修改 settings.json 内容（保留其他配置）
+func applyClaudePush(data map[string]interface{}, provider Provider, mode string) error {
+	env, ok := data["env"].(map[string]interface{})
+	if !ok {
+		env = make(map[string]interface{})
+	}
+	env["ANTHROPIC_BASE_URL"] = strings.TrimSuffix(provider.APIURL, "/")
+
+	switch mode {
+	case ClaudePushModeEnv:
+		env["ANTHROPIC_AUTH_TOKEN"] = provider.APIKey
+		// 移除之前由本应用写入的 apiKeyHelper，否则 Claude Code 会优先使用它
+		if helper, _ := data["apiKeyHelper"].(string); strings.Contains(helper, claudeKeyHelperBaseName) {
+			delete(data, "apiKeyHelper")
+		}
+	case ClaudePushModeAPIKeyHelper:
+		helperPath, err := writeClaudeKeyHelper(provider.APIKey)
+		if err != nil {
+			return err
+		}
+		delete(env, "ANTHROPIC_AUTH_TOKEN")
+		data["apiKeyHelper"] = helperPath
+	default:
+		return fmt.Errorf("无效的写入方式: %s（可选值: env、apiKeyHelper）", mode)
+	}
+	data["env"] = env
+	return nil
+}
+
+// writeClaudeKeyHelper 生成输出 API Key 的脚本（仅当前用户可读），返回脚本路径
+func writeClaudeKeyHelper(apiKey string) (string, error) {
+	if !keyHelperSafeKey.MatchString(apiKey) {
+		return "", fmt.Errorf("API Key 含有特殊字符，请改用 env 方式写入")
+	}
+	dir := getConfigDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	var path, content string
+	if runtime.GOOS == "windows" {
+		path = filepath.Join(dir, claudeKeyHelperBaseName+".cmd")
+		content = "@echo off\r\necho " + apiKey + "\r\n"
+	} else {
+		path = filepath.Join(dir, claudeKeyHelperBaseName+".sh")
+		content = "#!/bin/sh\nprintf '%s' '" + apiKey + "'\n"
+	}
+	if err := AtomicWriteBytes(path, []byte(content)); err != nil {
+		return "", fmt.Errorf("写入 apiKeyHelper 脚本失败: %w", err)
+	}
+	// 需要可执行权限（仍然只允许当前用户访问）
+	if err := os.Chmod(path, 0o700); err != nil {
+		return "", fmt.Errorf("设置 apiKeyHelper 脚本权限失败: %w", err)
+	}
+	return path, nil
+}
+
+// verifyClaudePush 确认 settings.json 可解析且地址已更新
+func verifyClaudePush(settingsPath string, provider Provider) error {
+	content, err := os.ReadFile(settingsPath)
+	if err != nil {
+		return fmt.Errorf("校验 settings.json 失败: %w", err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(content, &payload); err != nil {
+		return fmt.Errorf("校验 settings.json 失败: %w", err)
+	}
+	env, _ := payload["env"].(map[string]interface{})
+	if baseURL, _ := env["ANTHROPIC_BASE_URL"].(string); baseURL != strings.TrimSuffix(provider.APIURL, "/") {
+		return fmt.Errorf("校验 settings.json 失败: 地址未更新")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestApplyClaudePush(t *testing.T) {
+	data := map[string]interface{}{
+		"model":        "opus",
+		"apiKeyHelper": "/home/u/.code-switch/claude-api-key-helper.sh",
+		"env":          map[string]interface{}{"DISABLE_TELEMETRY": "1"},
+	}
+	provider := Provider{Name: "p", APIURL: "https://api.example.com/", APIKey: "sk-test"}
+	if err := applyClaudePush(data, provider, ClaudePushModeEnv); err != nil {
+		t.Fatal(err)
+	}
+	env := data["env"].(map[string]interface{})
+	if env["ANTHROPIC_BASE_URL"] != "https://api.example.com" || env["ANTHROPIC_AUTH_TOKEN"] != "sk-test" {
+		t.Errorf("env = %v", env)
+	}
+	if env["DISABLE_TELEMETRY"] != "1" || data["model"] != "opus" {
+		t.Error("应保留用户的其他配置")
+	}
+	if _, ok := data["apiKeyHelper"]; ok {
+		t.Error("应移除本应用写入的 apiKeyHelper")
+	}
+
+	if err := applyClaudePush(data, provider, "unknown"); err == nil {
+		t.Error("未知写入方式应报错")
+	}
+	if _, err := writeClaudeKeyHelper("sk-'; rm -rf ~"); err == nil {
+		t.Error("含特殊字符的 Key 不应写入脚本")
+	}
+}
@@ -102,7 +102,11 @@ func (css *ClaudeSettingsService) EnableProxy() error {
 	existingData["env"] = env
 
 	// 原子写入
-	return AtomicWriteJSON(settingsPath, existingData)
+	if err := AtomicWriteJSON(settingsPath, existingData); err != nil {
+		return err
+	}
+	recordConfigSyncFile(configDriftClaude, settingsPath)
+	return nil
 }
 
 func (css *ClaudeSettingsService) DisableProxy() error {
@@ -110,6 +114,8 @@ func (css *ClaudeSettingsService) DisableProxy() error {
 	if err != nil {
 		return err
 	}
+	// 恢复为用户的原始配置，不再检测漂移
+	forgetConfigSync(configDriftClaude)
 	if err := os.Remove(settingsPath); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
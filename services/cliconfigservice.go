@@ -75,8 +75,7 @@ type CLITemplates struct {
 
 // getTemplatesPath 获取模板存储路径
 func (s *CliConfigService) getTemplatesPath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".code-switch", "cli-templates.json")
+	return filepath.Join(getConfigDir(), "cli-templates.json")
 }
 
 // GetConfig 获取指定平台的 CLI 配置
@@ -739,7 +738,11 @@ func (s *CliConfigService) saveTemplates(templates *CLITemplates) error {
 	if err := EnsureDir(filepath.Dir(path)); err != nil {
 		return err
 	}
-	return AtomicWriteJSON(path, templates)
+	if err := AtomicWriteJSON(path, templates); err != nil {
+		return err
+	}
+	recordConfigIntegrity(path)
+	return nil
 }
 
 // ========== 辅助函数 ==========
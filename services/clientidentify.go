@@ -0,0 +1,510 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// clientProcessCacheTTL PID 到进程名的缓存时间
+	clientProcessCacheTTL = 5 * time.Minute
+	// clientSocketTableTTL 连接表的最长缓存时间（端口可能被其他进程复用）
+	clientSocketTableTTL = 10 * time.Second
+	// clientSocketMinRefresh 未命中时重新读取连接表的最小间隔
+	clientSocketMinRefresh = time.Second
+)
+
+// clientToolPatterns 按 User-Agent 识别常见工具（按顺序匹配，小写比较）
+var clientToolPatterns = []struct {
+	keyword string
+	tool    string
+}{
+	{"claude-cli", "claude-code"},
+	{"claude-code", "claude-code"},
+	{"codex", "codex"},
+	{"geminicli", "gemini-cli"},
+	{"gemini-cli", "gemini-cli"},
+	{"cursor", "cursor"},
+	{"cline", "cline"},
+	{"roo-code", "roo-code"},
+	{"continue", "continue"},
+	{"aider", "aider"},
+	{"anthropic/python", "anthropic-sdk-python"},
+	{"anthropic/js", "anthropic-sdk-js"},
+	{"openai/python", "openai-sdk-python"},
+	{"openai/js", "openai-sdk-js"},
+	{"python-requests", "python"},
+	{"python-httpx", "python"},
+	{"aiohttp", "python"},
+	{"curl", "curl"},
+	{"node-fetch", "node"},
+	{"undici", "node"},
+	{"axios", "node"},
+	{"go-http-client", "go"},
+}
+
+// ClientUsageStat 按客户端工具汇总的用量与错误
+type ClientUsageStat struct {
+	Client             string  `json:"client"`
+	TotalRequests      int64   `json:"total_requests"`
+	SuccessfulRequests int64   `json:"successful_requests"`
+	FailedRequests     int64   `json:"failed_requests"`
+	SuccessRate        float64 `json:"success_rate"`
+	InputTokens        int64   `json:"input_tokens"`
+	OutputTokens       int64   `json:"output_tokens"`
+	CostTotal          float64 `json:"cost_total"`
+}
+
+// detectClientTool 根据 User-Agent 识别发起请求的工具
+func detectClientTool(userAgent string) string {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return "unknown"
+	}
+	for _, p := range clientToolPatterns {
+		if strings.Contains(ua, p.keyword) {
+			return p.tool
+		}
+	}
+	return "other"
+}
+
+// clientProcessResolver 通过来源端口反查本机发起请求的进程
+// 每个新连接的来源端口都不同，按端口缓存几乎总是未命中；因此定期读取一次整张连接表（端口 → 进程），
+// 进程名按 PID 缓存，查询在后台进行，不阻塞转发
+type clientProcessResolver struct {
+	mu        sync.Mutex  // 串行刷新连接表
+	sockets   map[int]int // 本地端口 → PID
+	fetchedAt time.Time
+	names     map[int]clientProcessEntry // PID → 进程名
+	readTable func() (map[int]int, error)
+	readNames func(pids []int) (map[int]string, error)
+}
+
+type clientProcessEntry struct {
+	name      string
+	expiresAt time.Time
+}
+
+var globalClientProcessResolver = newClientProcessResolver()
+
+func newClientProcessResolver() *clientProcessResolver {
+	return &clientProcessResolver{
+		names:     make(map[int]clientProcessEntry),
+		readTable: readSocketTable,
+		readNames: readProcessNames,
+	}
+}
+
+// clientProcessLookup 一次后台进程查询，完成前读取结果为空
+type clientProcessLookup struct {
+	done chan struct{}
+	name string
+}
+
+// get 返回查询结果，尚未完成时返回空字符串（不等待）
+func (l *clientProcessLookup) get() string {
+	if l == nil {
+		return ""
+	}
+	select {
+	case <-l.done:
+		return l.name
+	default:
+		return ""
+	}
+}
+
+// clientContextKey 识别结果在 gin.Context 中的缓存键（同一请求的多次转发尝试只识别一次）
+const clientContextKey = "codeswitch.client"
+
+type clientIdentity struct {
+	tool    string
+	process *clientProcessLookup
+}
+
+// identifyClient 识别请求来源：工具名（User-Agent）与进程名（需在中继配置中开启）
+// 进程名在后台查询，写入请求日志时通过 clientProcessLookup.get 读取
+func identifyClient(c *gin.Context) (tool string, process *clientProcessLookup) {
+	if c == nil || c.Request == nil {
+		return "", nil
+	}
+	if cached, ok := c.Get(clientContextKey); ok {
+		if identity, ok := cached.(clientIdentity); ok {
+			return identity.tool, identity.process
+		}
+	}
+
+	tool = detectClientTool(c.Request.UserAgent())
+	if currentRelayConfig().Client.ResolveProcess {
+		process = globalClientProcessResolver.resolveAsync(c.Request.RemoteAddr)
+	}
+	c.Set(clientContextKey, clientIdentity{tool: tool, process: process})
+	return tool, process
+}
+
+// resolveAsync 在后台查询来源地址对应的进程，非本机地址返回 nil
+func (r *clientProcessResolver) resolveAsync(remoteAddr string) *clientProcessLookup {
+	host, portStr, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return nil
+	}
+	// 只能反查本机进程
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil
+	}
+	lookup := &clientProcessLookup{done: make(chan struct{})}
+	go func() {
+		defer close(lookup.done)
+		lookup.name = r.resolve(port, time.Now())
+	}()
+	return lookup
+}
+
+// resolve 返回本地端口对应的进程名，失败时返回空字符串（不影响转发）
+func (r *clientProcessResolver) resolve(port int, now time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pid, ok := r.sockets[port]
+	age := now.Sub(r.fetchedAt)
+	// 新连接不在上次读取的连接表中时重新读取，但限制刷新频率，避免大量并发连接反复执行外部命令
+	if (!ok && age >= clientSocketMinRefresh) || age >= clientSocketTableTTL {
+		table, err := r.readTable()
+		if err != nil {
+			fmt.Printf("[WARN] 读取连接表失败: %v\n", err)
+			return ""
+		}
+		r.sockets, r.fetchedAt = table, now
+		pid, ok = table[port]
+	}
+	if !ok {
+		return ""
+	}
+	return r.processNameLocked(pid, now)
+}
+
+// processNameLocked 按 PID 返回进程名（缓存 clientProcessCacheTTL）
+func (r *clientProcessResolver) processNameLocked(pid int, now time.Time) string {
+	if entry, ok := r.names[pid]; ok && now.Before(entry.expiresAt) {
+		return entry.name
+	}
+	names, err := r.readNames([]int{pid})
+	if err != nil {
+		fmt.Printf("[WARN] 反查客户端进程失败 (PID %d): %v\n", pid, err)
+	}
+	// 清理过期缓存，防止无限增长
+	for key, entry := range r.names {
+		if now.After(entry.expiresAt) {
+			delete(r.names, key)
+		}
+	}
+	name := names[pid]
+	r.names[pid] = clientProcessEntry{name: name, expiresAt: now.Add(clientProcessCacheTTL)}
+	return name
+}
+
+// readSocketTable 读取本机 TCP 连接表：本地端口 → PID
+func readSocketTable() (map[int]int, error) {
+	switch runtime.GOOS {
+	case "windows":
+		out, err := exec.Command("netstat", "-ano", "-p", "TCP").Output()
+		if err != nil {
+			return nil, fmt.Errorf("执行 netstat 失败: %w", err)
+		}
+		return parseNetstatSockets(string(out)), nil
+	case "darwin":
+		out, err := exec.Command("lsof", "-nP", "-iTCP", "-sTCP:ESTABLISHED", "-Fpn").Output()
+		if err != nil {
+			return nil, fmt.Errorf("执行 lsof 失败: %w", err)
+		}
+		return parseLsofSockets(string(out), os.Getpid()), nil
+	case "linux":
+		return readProcSockets()
+	default:
+		return nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+}
+
+// readProcessNames 查询 PID 对应的进程名
+func readProcessNames(pids []int) (map[int]string, error) {
+	names := make(map[int]string, len(pids))
+	switch runtime.GOOS {
+	case "windows":
+		for _, pid := range pids {
+			out, err := exec.Command("tasklist", "/FI", "PID eq "+strconv.Itoa(pid), "/FO", "CSV", "/NH").Output()
+			if err != nil {
+				return names, fmt.Errorf("执行 tasklist 失败: %w", err)
+			}
+			for pid, name := range parseTasklist(string(out)) {
+				names[pid] = name
+			}
+		}
+	case "darwin":
+		for _, pid := range pids {
+			out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+			if err != nil {
+				return names, fmt.Errorf("执行 ps 失败: %w", err)
+			}
+			names[pid] = filepath.Base(strings.TrimSpace(string(out)))
+		}
+	case "linux":
+		for _, pid := range pids {
+			comm, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+			if err != nil {
+				return names, err
+			}
+			names[pid] = strings.TrimSpace(string(comm))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+	return names, nil
+}
+
+// parseNetstatSockets 解析 Windows netstat -ano 输出
+//
+//	TCP    127.0.0.1:54321    127.0.0.1:18100    ESTABLISHED     1234
+func parseNetstatSockets(out string) map[int]int {
+	sockets := make(map[int]int)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.EqualFold(fields[0], "TCP") {
+			continue
+		}
+		port, ok := addressPort(fields[1])
+		pid, err := strconv.Atoi(fields[4])
+		if !ok || err != nil || pid == 0 {
+			continue
+		}
+		sockets[port] = pid
+	}
+	return sockets
+}
+
+// parseTasklist 解析 tasklist /FO CSV /NH 输出："node.exe","1234","Console","1","45,000 K"
+func parseTasklist(out string) map[int]string {
+	names := make(map[int]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\",\"")
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "\"") {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		names[pid] = strings.TrimPrefix(fields[0], "\"")
+	}
+	return names
+}
+
+// parseLsofSockets 解析 lsof -Fpn 输出（p 行为 PID，n 行为 "本地地址->远端地址"），排除本进程
+func parseLsofSockets(out string, self int) map[int]int {
+	sockets := make(map[int]int)
+	pid := 0
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		switch line[0] {
+		case 'p':
+			pid, _ = strconv.Atoi(line[1:])
+		case 'n':
+			local, _, found := strings.Cut(line[1:], "->")
+			if !found || pid == 0 || pid == self {
+				continue
+			}
+			if port, ok := addressPort(local); ok {
+				sockets[port] = pid
+			}
+		}
+	}
+	return sockets
+}
+
+// addressPort 取出 "127.0.0.1:54321" / "[::1]:54321" 中的端口
+func addressPort(address string) (int, bool) {
+	idx := strings.LastIndex(address, ":")
+	if idx < 0 {
+		return 0, false
+	}
+	port, err := strconv.Atoi(address[idx+1:])
+	return port, err == nil && port > 0
+}
+
+// readProcSockets Linux 实现：从 /proc/net/tcp* 读取端口 → inode，再扫描 /proc/*/fd 找到持有 socket 的进程
+func readProcSockets() (map[int]int, error) {
+	inodes := make(map[string]int)
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		data, err := os.ReadFile(table)
+		if err != nil {
+			continue
+		}
+		for port, inode := range parseProcNetTCP(string(data)) {
+			inodes["socket:["+inode+"]"] = port
+		}
+	}
+	if len(inodes) == 0 {
+		return nil, errors.New("未读取到 TCP 连接表")
+	}
+
+	sockets := make(map[int]int)
+	self := os.Getpid()
+	fdDirs, _ := filepath.Glob("/proc/[0-9]*/fd")
+	for _, fdDir := range fdDirs {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(fdDir)))
+		if err != nil || pid == self {
+			continue
+		}
+		entries, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			link, err := os.Readlink(filepath.Join(fdDir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			if port, ok := inodes[link]; ok {
+				sockets[port] = pid
+			}
+		}
+	}
+	return sockets, nil
+}
+
+// parseProcNetTCP 解析 /proc/net/tcp 格式：本地端口 → socket inode
+//
+//	sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+func parseProcNetTCP(data string) map[int]string {
+	inodes := make(map[int]string)
+	lines := strings.Split(data, "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			continue
+		}
+		_, portHex, found := strings.Cut(fields[1], ":")
+		if !found {
+			continue
+		}
+		port, err := strconv.ParseInt(portHex, 16, 32)
+		if err != nil || fields[9] == "0" {
+			continue
+		}
+		inodes[int(port)] = fields[9]
+	}
+	return inodes
+}
+
+// ClientUsageStats 按客户端工具统计最近 days 天的请求、错误与费用
+func (ls *LogService) ClientUsageStats(platform string, days int) ([]ClientUsageStat, error) {
+	if days <= 0 {
+		days = 30
+	}
+	start := startOfDay(time.Now()).AddDate(0, 0, -(days - 1))
+	model := sharedModel("request_log")
+	options := []xdb.Option{
+		xdb.WhereGte("created_at", start.Unix()),
+		xdb.Field(
+			"client",
+			"client_process",
+			"model",
+			"http_code",
+			"input_tokens",
+			"output_tokens",
+			"reasoning_tokens",
+			"cache_create_tokens",
+			"cache_read_tokens",
+		),
+	}
+	if platform != "" {
+		options = append(options, xdb.WhereEq("platform", platform))
+	}
+	records, err := model.Selects(options...)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return []ClientUsageStat{}, nil
+		}
+		return nil, err
+	}
+
+	statMap := map[string]*ClientUsageStat{}
+	for _, record := range records {
+		client := clientLabel(record.GetString("client"), record.GetString("client_process"))
+		stat := statMap[client]
+		if stat == nil {
+			stat = &ClientUsageStat{Client: client}
+			statMap[client] = stat
+		}
+		input := record.GetInt("input_tokens")
+		output := record.GetInt("output_tokens")
+		cost := ls.calculateCost(record.GetString("model"), modelpricing.UsageSnapshot{
+			InputTokens:       input,
+			OutputTokens:      output,
+			ReasoningTokens:   record.GetInt("reasoning_tokens"),
+			CacheCreateTokens: record.GetInt("cache_create_tokens"),
+			CacheReadTokens:   record.GetInt("cache_read_tokens"),
+		})
+
+		stat.TotalRequests++
+		if httpCode := record.GetInt("http_code"); httpCode >= 200 && httpCode < 300 {
+			stat.SuccessfulRequests++
+		} else {
+			stat.FailedRequests++
+		}
+		stat.InputTokens += int64(input)
+		stat.OutputTokens += int64(output)
+		stat.CostTotal += cost.TotalCost
+	}
+
+	stats := make([]ClientUsageStat, 0, len(statMap))
+	for _, stat := range statMap {
+		if stat.TotalRequests > 0 {
+			stat.SuccessRate = float64(stat.SuccessfulRequests) / float64(stat.TotalRequests)
+		}
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TotalRequests == stats[j].TotalRequests {
+			return stats[i].Client < stats[j].Client
+		}
+		return stats[i].TotalRequests > stats[j].TotalRequests
+	})
+	return stats, nil
+}
+
+// clientLabel 组合展示用的客户端名称：User-Agent 无法识别时使用进程名
+func clientLabel(tool string, process string) string {
+	tool = strings.TrimSpace(tool)
+	process = strings.TrimSpace(process)
+	if tool == "" {
+		tool = "unknown"
+	}
+	if process != "" && (tool == "other" || tool == "unknown") {
+		return process
+	}
+	return tool
+}
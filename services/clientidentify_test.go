@@ -0,0 +1,129 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDetectClientTool(t *testing.T) {
+	tests := map[string]string{
+		"":                                  "unknown",
+		"claude-cli/1.0.30 (external, cli)": "claude-code",
+		"codex_cli_rs/0.20.0":               "codex",
+		"curl/8.4.0":                        "curl",
+		"Mozilla/5.0":                       "other",
+	}
+	for ua, want := range tests {
+		if got := detectClientTool(ua); got != want {
+			t.Errorf("detectClientTool(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestParseNetstatSockets(t *testing.T) {
+	out := `
+Active Connections
+
+  Proto  Local Address          Foreign Address        State           PID
+  TCP    0.0.0.0:18100          0.0.0.0:0              LISTENING       4200
+  TCP    127.0.0.1:18100        127.0.0.1:54321        ESTABLISHED     4200
+  TCP    127.0.0.1:54321        127.0.0.1:18100        ESTABLISHED     1234
+  TCP    [::1]:54400            [::1]:18100            ESTABLISHED     5678
+  TCP    0.0.0.0:135            0.0.0.0:0              LISTENING       0
+`
+	got := parseNetstatSockets(out)
+	if got[54321] != 1234 || got[54400] != 5678 || got[18100] != 4200 {
+		t.Errorf("parseNetstatSockets() = %v", got)
+	}
+	if _, ok := got[135]; ok {
+		t.Error("PID 0 的系统连接应忽略")
+	}
+}
+
+func TestParseTasklist(t *testing.T) {
+	out := "\"node.exe\",\"1234\",\"Console\",\"1\",\"45,000 K\"\r\n\"Code.exe\",\"5678\",\"Console\",\"1\",\"120,000 K\"\r\n"
+	want := map[int]string{1234: "node.exe", 5678: "Code.exe"}
+	if got := parseTasklist(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTasklist() = %v, want %v", got, want)
+	}
+	if got := parseTasklist("INFO: No tasks are running which match the specified criteria.\r\n"); len(got) != 0 {
+		t.Errorf("无匹配进程时应返回空结果: %v", got)
+	}
+}
+
+func TestParseLsofSockets(t *testing.T) {
+	out := "p4200\nf12\nn127.0.0.1:18100->127.0.0.1:54321\np1234\nf20\nn127.0.0.1:54321->127.0.0.1:18100\np5678\nf7\nn[::1]:54400->[::1]:18100\n"
+	got := parseLsofSockets(out, 4200)
+	want := map[int]int{54321: 1234, 54400: 5678}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseLsofSockets() = %v, want %v", got, want)
+	}
+}
+
+func TestParseProcNetTCP(t *testing.T) {
+	data := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:46B4 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 31337 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:D431 0100007F:46B4 01 00000000:00000000 00:00000000 00000000  1000        0 42424 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:D432 0100007F:46B4 06 00000000:00000000 03:00001234 00000000     0        0 0 3 0000000000000000
+`
+	want := map[int]string{18100: "31337", 54321: "42424"}
+	if got := parseProcNetTCP(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProcNetTCP() = %v, want %v", got, want)
+	}
+}
+
+func TestClientProcessResolverCachesSocketTable(t *testing.T) {
+	tableReads, nameReads := 0, 0
+	r := newClientProcessResolver()
+	r.readTable = func() (map[int]int, error) {
+		tableReads++
+		return map[int]int{54321: 1234, 54322: 1234}, nil
+	}
+	r.readNames = func(pids []int) (map[int]string, error) {
+		nameReads++
+		return map[int]string{1234: "node"}, nil
+	}
+
+	now := time.Now()
+	if got := r.resolve(54321, now); got != "node" {
+		t.Fatalf("resolve() = %q, want node", got)
+	}
+	// 同一进程的其他连接命中连接表与 PID 缓存
+	if got := r.resolve(54322, now.Add(time.Second)); got != "node" {
+		t.Fatalf("resolve() = %q, want node", got)
+	}
+	// 不在连接表中的端口在最小刷新间隔内不重复读取
+	if got := r.resolve(60000, now.Add(1500*time.Millisecond)); got != "" {
+		t.Errorf("未知端口应返回空，得到 %q", got)
+	}
+	if got := r.resolve(60001, now.Add(1800*time.Millisecond)); got != "" {
+		t.Errorf("未知端口应返回空，得到 %q", got)
+	}
+	if tableReads != 2 || nameReads != 1 {
+		t.Errorf("连接表读取 %d 次、进程名读取 %d 次，期望 2 与 1", tableReads, nameReads)
+	}
+}
+
+func TestClientProcessLookupAsync(t *testing.T) {
+	r := newClientProcessResolver()
+	release := make(chan struct{})
+	r.readTable = func() (map[int]int, error) {
+		<-release
+		return map[int]int{54321: 1234}, nil
+	}
+	r.readNames = func([]int) (map[int]string, error) { return map[int]string{1234: "node"}, nil }
+
+	if r.resolveAsync("192.168.1.10:54321") != nil {
+		t.Error("非本机地址不应查询进程")
+	}
+	lookup := r.resolveAsync("127.0.0.1:54321")
+	if got := lookup.get(); got != "" {
+		t.Errorf("查询完成前不应阻塞或返回结果，得到 %q", got)
+	}
+	close(release)
+	<-lookup.done
+	if got := lookup.get(); got != "node" {
+		t.Errorf("lookup.get() = %q, want node", got)
+	}
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// 切换 Codex 供应商时直接写入 ~/.codex/config.toml（不经过中继）：
+// 每个供应商对应一个 [model_providers.code-switch-xxx] 与同名的 [profiles.code-switch-xxx]，
+// 切换时把顶层 model_provider 指向它，也可以用 `codex --profile code-switch-xxx` 临时使用其他供应商。
+// 修改在解析后的 map 上进行，写回时只就地替换变化的顶层键与本应用的条目，用户的注释、键顺序与其他配置原样保留。
+const (
+	codexPushBackupFileName = "config.toml.code-switch.bak"
+	codexProfilePrefix      = "code-switch-" // 本应用管理的 model_providers 与 profiles 名前缀
+)
+
+// CodexProfile config.toml 中的 profile
+type CodexProfile struct {
+	Name          string `json:"name"`
+	ModelProvider string `json:"modelProvider"`
+	Model         string `json:"model,omitempty"`
+	BaseURL       string `json:"baseUrl,omitempty"`
+	Managed       bool   `json:"managed"` // 由本应用写入
+	Active        bool   `json:"active"`  // 与顶层 model_provider 相同
+}
+
+// AttachProviderPush 在 Codex 供应商切换时按应用设置写入 config.toml（启动时调用一次）
+func (css *CodexSettingsService) AttachProviderPush(providerService *ProviderService, appSettings *AppSettingsService) {
+	css.providerService = providerService
+	providerService.addSwitchHook(func(tx *configTransaction, kind string, provider Provider) (func(), error) {
+		if kind != "codex" || appSettings == nil {
+			return nil, nil
+		}
+		settings, err := appSettings.GetAppSettings()
+		if err != nil || !settings.PushCodexSettings {
+			return nil, nil
+		}
+		settingsPath, _, err := css.paths()
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Track(settingsPath); err != nil {
+			return nil, err
+		}
+		return css.pushProvider(provider)
+	})
+}
+
+// pushProvider 将 provider 写入 config.toml 并设为当前 model_provider，返回回滚函数
+// 已启用中继代理时不写入（请求已经经过中继，直接写入上游地址会绕过中继）
+func (css *CodexSettingsService) pushProvider(provider Provider) (func(), error) {
+	if status, err := css.ProxyStatus(); err == nil && status.Enabled {
+		log.Printf("[CodexSettings] 已启用中继代理，跳过写入 %s 的配置", provider.Name)
+		return nil, nil
+	}
+	if !codexPushable(provider) {
+		log.Printf("[CodexSettings] %s 没有可直接使用的地址或 Key，跳过写入 config.toml", provider.Name)
+		return nil, nil
+	}
+
+	var key string
+	rollback, err := css.rewriteConfig(func(raw map[string]any) error {
+		key = applyCodexProvider(raw, provider, true)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[CodexSettings] 已将 %s 写入 config.toml（%s）", provider.Name, key)
+	return rollback, nil
+}
+
+// ListCodexProfiles 列出 config.toml 中的 profile（供前端调用）
+func (css *CodexSettingsService) ListCodexProfiles() ([]CodexProfile, error) {
+	raw, _, err := css.readRawConfig()
+	if err != nil {
+		return nil, err
+	}
+	return listCodexProfiles(raw), nil
+}
+
+// SyncCodexProfiles 为所有可用的 Codex 供应商写入 profile，并移除已删除供应商的 profile（供前端调用）
+// 不修改当前使用的 model_provider
+func (css *CodexSettingsService) SyncCodexProfiles() error {
+	if css.providerService == nil {
+		return fmt.Errorf("供应商服务未初始化")
+	}
+	providers, err := css.providerService.LoadProviders("codex")
+	if err != nil {
+		return err
+	}
+	_, err = css.rewriteConfig(func(raw map[string]any) error {
+		syncCodexProfiles(raw, providers)
+		return nil
+	})
+	return err
+}
+
+// DeleteCodexProfile 删除本应用写入的 profile 及对应的 model_provider（供前端调用）
+func (css *CodexSettingsService) DeleteCodexProfile(name string) error {
+	if !strings.HasPrefix(name, codexProfilePrefix) {
+		return fmt.Errorf("profile %s 不是由 Code Switch 写入的，请手动编辑 config.toml", name)
+	}
+	_, err := css.rewriteConfig(func(raw map[string]any) error {
+		if active, _ := raw["model_provider"].(string); active == name {
+			return fmt.Errorf("profile %s 正在使用中，请先切换到其他供应商", name)
+		}
+		if profile, _ := raw["profile"].(string); profile == name {
+			delete(raw, "profile")
+		}
+		delete(ensureTomlTable(raw, "profiles"), name)
+		delete(ensureTomlTable(raw, "model_providers"), name)
+		return nil
+	})
+	return err
+}
+
+// codexPushable 是否可以直接写入 config.toml（虚拟 provider 依赖中继分流，不能直接写入）
+func codexPushable(provider Provider) bool {
+	return !provider.isSplitProvider() && provider.APIURL != "" && provider.APIKey != ""
+}
+
+// codexProfileKey 由供应商名生成 TOML 可用的键名（只含小写字母、数字与连字符），名称中没有可用字符时使用 ID
+func codexProfileKey(provider Provider) string {
+	var b strings.Builder
+	lastDash := true
+	for _, r := range strings.ToLower(provider.Name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			lastDash = false
+		} else if !lastDash {
+			b.WriteByte('-')
+			lastDash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if slug == "" {
+		slug = fmt.Sprintf("provider-%d", provider.ID)
+	}
+	return codexProfilePrefix + slug
+}
+
+// applyCodexProvider 写入 provider 对应的 model_providers 与 profiles，activate 时设为当前 model_provider，返回键名
+func applyCodexProvider(raw map[string]any, provider Provider, activate bool) string {
+	key := codexProfileKey(provider)
+
+	entry := ensureProviderTable(ensureTomlTable(raw, "model_providers"), key)
+	entry["name"] = provider.Name
+	entry["base_url"] = strings.TrimSuffix(provider.APIURL, "/")
+	entry["wire_api"] = codexWireAPI
+	entry["experimental_bearer_token"] = provider.APIKey
+	// Key 直接写在表中，env_key 会让 Codex 改为读取环境变量
+	delete(entry, "env_key")
+
+	profile := ensureProviderTable(ensureTomlTable(raw, "profiles"), key)
+	profile["model_provider"] = key
+
+	if activate {
+		raw["model_provider"] = key
+		if _, exists := raw["model"]; !exists {
+			raw["model"] = codexDefaultModel
+		}
+	}
+	return key
+}
+
+// syncCodexProfiles 写入所有可用供应商，并移除不再对应任何供应商的本应用条目（正在使用的除外）
+func syncCodexProfiles(raw map[string]any, providers []Provider) {
+	keep := make(map[string]bool, len(providers))
+	for _, provider := range providers {
+		if codexPushable(provider) {
+			keep[applyCodexProvider(raw, provider, false)] = true
+		}
+	}
+	active, _ := raw["model_provider"].(string)
+	for _, table := range []string{"profiles", "model_providers"} {
+		entries := ensureTomlTable(raw, table)
+		for name := range entries {
+			if strings.HasPrefix(name, codexProfilePrefix) && !keep[name] && name != active {
+				delete(entries, name)
+			}
+		}
+	}
+}
+
+// listCodexProfiles 按名称排序列出 profile
+func listCodexProfiles(raw map[string]any) []CodexProfile {
+	active, _ := raw["model_provider"].(string)
+	modelProviders := ensureTomlTable(raw, "model_providers")
+	profiles := make([]CodexProfile, 0)
+	for name, table := range ensureTomlTable(raw, "profiles") {
+		profile := CodexProfile{Name: name, Managed: strings.HasPrefix(name, codexProfilePrefix)}
+		profile.ModelProvider, _ = table["model_provider"].(string)
+		profile.Model, _ = table["model"].(string)
+		if entry, ok := modelProviders[profile.ModelProvider]; ok {
+			profile.BaseURL, _ = entry["base_url"].(string)
+		}
+		profile.Active = profile.ModelProvider != "" && profile.ModelProvider == active
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// readRawConfig 读取 config.toml 为 map（文件不存在时返回空 map），同时返回原始内容
+func (css *CodexSettingsService) readRawConfig() (map[string]any, []byte, error) {
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := os.ReadFile(settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return make(map[string]any), nil, nil
+		}
+		return nil, nil, fmt.Errorf("读取 config.toml 失败: %w", err)
+	}
+	var raw map[string]any
+	if err := toml.Unmarshal(content, &raw); err != nil {
+		// 格式无效时不覆盖，避免丢失用户手写的配置
+		return nil, nil, fmt.Errorf("config.toml 格式无效，未写入: %w", err)
+	}
+	if raw == nil {
+		raw = make(map[string]any)
+	}
+	return raw, content, nil
+}
+
+// rewriteConfig 读取 config.toml、修改后原子写回：写入前备份，写入后校验可解析，失败时恢复原文件
+func (css *CodexSettingsService) rewriteConfig(mutate func(raw map[string]any) error) (func(), error) {
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(settingsPath), 0o755); err != nil {
+		return nil, err
+	}
+	if err := ensureNoConfigDrift(configDriftCodex, settingsPath); err != nil {
+		return nil, err
+	}
+	raw, original, err := css.readRawConfig()
+	if err != nil {
+		return nil, err
+	}
+	existed := original != nil
+	backupPath := filepath.Join(filepath.Dir(settingsPath), codexPushBackupFileName)
+	if existed {
+		if err := os.WriteFile(backupPath, original, 0o600); err != nil {
+			return nil, fmt.Errorf("备份 config.toml 失败: %w", err)
+		}
+	}
+
+	rollback := func() {
+		var err error
+		if existed {
+			err = AtomicWriteBytes(settingsPath, original)
+			recordConfigSync(configDriftCodex, settingsPath, original)
+		} else {
+			err = os.Remove(settingsPath)
+			forgetConfigSync(configDriftCodex)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[CodexSettings] ⚠️  回滚 config.toml 失败（备份: %s）: %v", backupPath, err)
+		}
+	}
+
+	before := make(map[string]any)
+	if existed {
+		if err := toml.Unmarshal(original, &before); err != nil {
+			return nil, fmt.Errorf("config.toml 格式无效，未写入: %w", err)
+		}
+	}
+	if err := mutate(raw); err != nil {
+		return nil, err
+	}
+	data, err := renderCodexConfig(original, before, raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := AtomicWriteBytes(settingsPath, data); err != nil {
+		return nil, fmt.Errorf("写入 config.toml 失败: %w", err)
+	}
+	if _, _, err := css.readRawConfig(); err != nil {
+		rollback()
+		return nil, fmt.Errorf("校验 config.toml 失败: %w", err)
+	}
+	recordConfigSyncFile(configDriftCodex, settingsPath)
+	return rollback, nil
+}
+
+// renderCodexConfig 生成写回的 config.toml：优先在原文上就地修改，
+// 原文结构无法就地编辑（如条目写成内联表）时退回整体重写，此时注释与键顺序会丢失
+func renderCodexConfig(original []byte, before, after map[string]any) ([]byte, error) {
+	if patched, ok := patchTomlDocument(original, before, after, "model_providers", "profiles"); ok {
+		var check map[string]any
+		if toml.Unmarshal(patched, &check) == nil && tomlDocumentsEqual(check, after) {
+			return patched, nil
+		}
+	}
+	log.Printf("[CodexSettings] ⚠️  config.toml 无法就地修改，改为整体重写（注释与键顺序不会保留）")
+	data, err := toml.Marshal(after)
+	if err != nil {
+		return nil, fmt.Errorf("生成 config.toml 失败: %w", err)
+	}
+	return stripModelProvidersHeader(data), nil
+}
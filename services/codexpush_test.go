@@ -0,0 +1,282 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestCodexProfileKey(t *testing.T) {
+	cases := map[string]string{
+		"OpenRouter":     "code-switch-openrouter",
+		"My  Relay (US)": "code-switch-my-relay-us",
+		"官方":             "code-switch-provider-7",
+		"DeepSeek 官方-v2": "code-switch-deepseek-v2",
+	}
+	for name, want := range cases {
+		if got := codexProfileKey(Provider{ID: 7, Name: name}); got != want {
+			t.Errorf("codexProfileKey(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestApplyCodexProviderPreservesUserKeys(t *testing.T) {
+	original := `model = "o3"
+approval_policy = "on-request"
+
+[model_providers.azure]
+name = "Azure"
+base_url = "https://example.openai.azure.com/openai"
+
+[model_providers.code-switch-openrouter]
+name = "old"
+query_params = { api-version = "2025-04-01" }
+env_key = "OR_KEY"
+
+[profiles.work]
+model = "gpt-5"
+model_provider = "azure"
+
+[mcp_servers.docs]
+command = "npx"
+`
+	var raw map[string]any
+	if err := toml.Unmarshal([]byte(original), &raw); err != nil {
+		t.Fatal(err)
+	}
+	key := applyCodexProvider(raw, Provider{Name: "OpenRouter", APIURL: "https://openrouter.ai/api/v1/", APIKey: "sk-or"}, true)
+	data, err := toml.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := toml.Unmarshal(stripModelProvidersHeader(data), &got); err != nil {
+		t.Fatalf("写回的 config.toml 无法解析: %v\n%s", err, data)
+	}
+
+	if got["model_provider"] != key || got["model"] != "o3" || got["approval_policy"] != "on-request" {
+		t.Errorf("顶层配置不正确: %v", got)
+	}
+	if _, ok := got["mcp_servers"]; !ok {
+		t.Error("应保留用户的 mcp_servers")
+	}
+	providers := got["model_providers"].(map[string]any)
+	if _, ok := providers["azure"]; !ok {
+		t.Error("应保留用户的 model_provider")
+	}
+	entry := providers[key].(map[string]any)
+	if entry["base_url"] != "https://openrouter.ai/api/v1" || entry["experimental_bearer_token"] != "sk-or" {
+		t.Errorf("model_provider 内容不正确: %v", entry)
+	}
+	if _, ok := entry["query_params"]; !ok {
+		t.Error("应保留表中用户添加的键")
+	}
+	if _, ok := entry["env_key"]; ok {
+		t.Error("应移除 env_key")
+	}
+
+	profiles := listCodexProfiles(got)
+	if len(profiles) != 2 || profiles[0].Name != key || !profiles[0].Managed || !profiles[0].Active {
+		t.Errorf("profiles = %+v", profiles)
+	}
+	if profiles[1].Name != "work" || profiles[1].Managed || profiles[1].BaseURL == "" {
+		t.Errorf("profiles = %+v", profiles)
+	}
+}
+
+func TestSyncCodexProfiles(t *testing.T) {
+	raw := map[string]any{"model_provider": "code-switch-active"}
+	ensureProviderTable(ensureTomlTable(raw, "model_providers"), "code-switch-active")
+	ensureProviderTable(ensureTomlTable(raw, "model_providers"), "code-switch-removed")
+	ensureProviderTable(ensureTomlTable(raw, "profiles"), "code-switch-removed")
+	ensureProviderTable(ensureTomlTable(raw, "profiles"), "mine")
+
+	syncCodexProfiles(raw, []Provider{
+		{Name: "A", APIURL: "https://a.example.com", APIKey: "k"},
+		{Name: "NoKey", APIURL: "https://b.example.com"},
+	})
+
+	providers := ensureTomlTable(raw, "model_providers")
+	profiles := ensureTomlTable(raw, "profiles")
+	if _, ok := providers["code-switch-a"]; !ok {
+		t.Error("应写入可用的供应商")
+	}
+	if _, ok := providers["code-switch-nokey"]; ok {
+		t.Error("没有 Key 的供应商不应写入")
+	}
+	if _, ok := providers["code-switch-removed"]; ok {
+		t.Error("应移除已删除供应商的条目")
+	}
+	if _, ok := profiles["code-switch-removed"]; ok {
+		t.Error("应移除已删除供应商的 profile")
+	}
+	if _, ok := providers["code-switch-active"]; !ok {
+		t.Error("正在使用的条目不应移除")
+	}
+	if _, ok := profiles["mine"]; !ok {
+		t.Error("不应移除用户的 profile")
+	}
+}
+
+func TestRenderCodexConfigPreservesFormatting(t *testing.T) {
+	original := `# 用户的注释
+model = "o3"
+approval_policy = "on-request" # 行尾注释
+
+[model_providers.azure]
+# Azure 部署
+name = "Azure"
+base_url = "https://example.openai.azure.com/openai"
+
+[model_providers.code-switch-old]
+name = "Old"
+base_url = "https://old.example.com"
+
+# 工作用 profile
+[profiles.work]
+model_provider = "azure"
+model = "gpt-5"
+
+[profiles.code-switch-old]
+model_provider = "code-switch-old"
+
+[mcp_servers.docs]
+command = "npx"
+args = [
+  "-y",
+  "docs-server",
+]
+`
+	var raw, before map[string]any
+	if err := toml.Unmarshal([]byte(original), &raw); err != nil {
+		t.Fatal(err)
+	}
+	toml.Unmarshal([]byte(original), &before)
+	key := applyCodexProvider(raw, Provider{Name: "OpenRouter", APIURL: "https://openrouter.ai/api/v1", APIKey: "sk-or"}, true)
+	delete(ensureTomlTable(raw, "model_providers"), "code-switch-old")
+	delete(ensureTomlTable(raw, "profiles"), "code-switch-old")
+
+	data, err := renderCodexConfig([]byte(original), before, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# 用户的注释
+model = "o3"
+approval_policy = "on-request" # 行尾注释
+model_provider = 'code-switch-openrouter'
+
+[model_providers.azure]
+# Azure 部署
+name = "Azure"
+base_url = "https://example.openai.azure.com/openai"
+
+[model_providers.code-switch-openrouter]
+base_url = 'https://openrouter.ai/api/v1'
+experimental_bearer_token = 'sk-or'
+name = 'OpenRouter'
+wire_api = 'responses'
+
+# 工作用 profile
+[profiles.work]
+model_provider = "azure"
+model = "gpt-5"
+
+[profiles.code-switch-openrouter]
+model_provider = 'code-switch-openrouter'
+
+[mcp_servers.docs]
+command = "npx"
+args = [
+  "-y",
+  "docs-server",
+]
+`
+	if string(data) != want {
+		t.Errorf("就地修改结果不符:\n%s", data)
+	}
+	if key != "code-switch-openrouter" {
+		t.Errorf("key = %q", key)
+	}
+}
+
+func TestRenderCodexConfigUpdatesExistingEntry(t *testing.T) {
+	original := "model_provider = \"azure\" # 当前使用\n\n[model_providers.code-switch-a]\nname = \"A\"\nbase_url = \"https://old\"\nquery_params = { api-version = \"1\" }\n\n[model_providers.azure]\nname = \"Azure\"\n"
+	var raw, before map[string]any
+	toml.Unmarshal([]byte(original), &raw)
+	toml.Unmarshal([]byte(original), &before)
+	applyCodexProvider(raw, Provider{Name: "A", APIURL: "https://new", APIKey: "k"}, false)
+
+	data, err := renderCodexConfig([]byte(original), before, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if !strings.HasPrefix(got, "model_provider = \"azure\" # 当前使用\n\n[model_providers.code-switch-a]\n") ||
+		!strings.Contains(got, "\n\n[model_providers.azure]\nname = \"Azure\"\n\n[profiles.code-switch-a]\n") {
+		t.Errorf("未修改的内容应原样保留:\n%s", got)
+	}
+	var parsed map[string]any
+	if err := toml.Unmarshal(data, &parsed); err != nil || !tomlDocumentsEqual(parsed, raw) {
+		t.Errorf("写回内容与修改后的配置不一致 (%v):\n%s", err, got)
+	}
+}
+
+func TestRenderCodexConfigFallsBackForInlineTables(t *testing.T) {
+	// 条目写成内联表时无法按表头定位，退回整体重写但内容仍正确
+	original := "model_providers = { code-switch-a = { name = \"A\" } }\n"
+	var raw, before map[string]any
+	toml.Unmarshal([]byte(original), &raw)
+	toml.Unmarshal([]byte(original), &before)
+	applyCodexProvider(raw, Provider{Name: "A", APIURL: "https://a", APIKey: "k"}, true)
+
+	if _, ok := patchTomlDocument([]byte(original), before, raw, "model_providers", "profiles"); ok {
+		t.Error("内联表不应就地修改")
+	}
+	data, err := renderCodexConfig([]byte(original), before, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed map[string]any
+	if err := toml.Unmarshal(data, &parsed); err != nil || !tomlDocumentsEqual(parsed, raw) {
+		t.Errorf("整体重写结果不符 (%v):\n%s", err, data)
+	}
+}
+
+func TestRenderCodexConfigNewFile(t *testing.T) {
+	raw := map[string]any{}
+	applyCodexProvider(raw, Provider{Name: "A", APIURL: "https://a", APIKey: "k"}, true)
+	data, err := renderCodexConfig(nil, map[string]any{}, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed map[string]any
+	if err := toml.Unmarshal(data, &parsed); err != nil || !tomlDocumentsEqual(parsed, raw) {
+		t.Errorf("新文件内容不符 (%v):\n%s", err, data)
+	}
+	if strings.Contains(string(data), "[model_providers]\n") {
+		t.Errorf("不应写入空的 [model_providers] 表头:\n%s", data)
+	}
+}
+
+func TestParseTomlHeader(t *testing.T) {
+	tests := []struct {
+		line  string
+		path  []string
+		array bool
+	}{
+		{"[model_providers.code-switch-a]", []string{"model_providers", "code-switch-a"}, false},
+		{"  [ profiles . 'my key' ]  # 注释", []string{"profiles", "my key"}, false},
+		{`[[mcp_servers."a.b"]]`, []string{"mcp_servers", "a.b"}, true},
+		{"[1, 2],", nil, false},
+		{`["a", "b"]`, nil, false},
+		{"key = [1]", nil, false},
+	}
+	for _, tt := range tests {
+		path, array, ok := parseTomlHeader(tt.line)
+		if ok != (tt.path != nil) || !reflect.DeepEqual(path, tt.path) || array != tt.array {
+			t.Errorf("parseTomlHeader(%q) = %v, %v, %v", tt.line, path, array, ok)
+		}
+	}
+}
@@ -25,7 +25,8 @@ const (
 )
 
 type CodexSettingsService struct {
-	relayAddr string
+	relayAddr       string
+	providerService *ProviderService // 同步 profile 时读取供应商列表
 }
 
 func NewCodexSettingsService(relayAddr string) *CodexSettingsService {
@@ -107,6 +108,7 @@ func (css *CodexSettingsService) EnableProxy() error {
 	if err := AtomicWriteBytes(settingsPath, cleaned); err != nil {
 		return err
 	}
+	recordConfigSyncFile(configDriftCodex, settingsPath)
 	return css.writeAuthFile()
 }
 
@@ -115,6 +117,8 @@ func (css *CodexSettingsService) DisableProxy() error {
 	if err != nil {
 		return err
 	}
+	// 恢复为用户的原始配置，不再检测漂移
+	forgetConfigSync(configDriftCodex)
 	if err := os.Remove(settingsPath); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
@@ -0,0 +1,557 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// 多机汇总：各开发者的中继定期把按小时的请求汇总（请求数、错误数、Token、费用、延迟百分位）与 provider 健康状态
+// 上报给团队自建的汇总服务（同一程序，在 collector.serve 开启时接收上报），团队负责人在一个面板中查看所有中继。
+// 上报内容是匿名的：实例以主机名与用户名的摘要标识（可自行设置显示名称），不包含 API Key、上游地址、对话内容与客户端信息。
+const (
+	collectorSecretHeader     = "X-CodeSwitch-Collector-Secret"
+	collectorSecretMinLength  = 16
+	collectorRequestTimeout   = 15 * time.Second
+	collectorPushWindow       = 48 * time.Hour      // 每次上报最近 48 小时的汇总（服务端按时段覆盖，重复上报无副作用）
+	collectorRetention        = 90 * 24 * time.Hour // 服务端保留的汇总时长
+	collectorMaxPushBytes     = 8 << 20
+	collectorDisabledPollWait = time.Minute // 未配置上报地址时检查配置的间隔
+)
+
+// RelayCollectorConfig 多机汇总配置
+type RelayCollectorConfig struct {
+	PushURL         string `json:"pushUrl,omitempty"` // 汇总服务地址（如 http://10.0.0.5:18100），为空表示不上报
+	Serve           bool   `json:"serve"`             // 作为汇总服务接收其他实例的上报
+	Secret          string `json:"secret,omitempty"`  // 共享密钥，上报端与汇总服务必须一致
+	Label           string `json:"label,omitempty"`   // 在汇总面板中显示的名称，为空时只显示匿名 ID
+	IntervalMinutes int    `json:"intervalMinutes"`   // 上报间隔（分钟）
+}
+
+// validateCollectorConfig 校验多机汇总配置
+func validateCollectorConfig(config RelayCollectorConfig) error {
+	if config.PushURL == "" && !config.Serve {
+		return nil
+	}
+	if config.PushURL != "" {
+		if err := validateHTTPURL(config.PushURL, "pushUrl"); err != nil {
+			return err
+		}
+	}
+	if len(config.Secret) < collectorSecretMinLength {
+		return fmt.Errorf("多机汇总共享密钥至少需要 %d 个字符", collectorSecretMinLength)
+	}
+	if config.IntervalMinutes < 5 || config.IntervalMinutes > 1440 {
+		return fmt.Errorf("多机汇总上报间隔必须在 5-1440 分钟之间")
+	}
+	if len([]rune(config.Label)) > 64 {
+		return fmt.Errorf("多机汇总显示名称不能超过 64 个字符")
+	}
+	return nil
+}
+
+// CollectorPush POST /collector/push 的请求体
+type CollectorPush struct {
+	Instance    string        `json:"instance"`        // 匿名实例 ID
+	Label       string        `json:"label,omitempty"` // 显示名称
+	Health      RelayHealth   `json:"health"`
+	Offline     bool          `json:"offline"`
+	Blacklisted []string      `json:"blacklisted"` // 当前被拉黑的 provider（platform/name）
+	Rollups     []UsageRollup `json:"rollups"`     // 按小时的汇总
+	PushedAt    int64         `json:"pushedAt"`    // 毫秒
+}
+
+// CollectorStatus 本机上报状态（供前端展示）
+type CollectorStatus struct {
+	Enabled    bool   `json:"enabled"`
+	Serving    bool   `json:"serving"`
+	Instance   string `json:"instance"`
+	PushURL    string `json:"pushUrl,omitempty"`
+	LastPushAt int64  `json:"lastPushAt,omitempty"` // 毫秒
+	LastRows   int    `json:"lastRows"`             // 最近一次上报的汇总行数
+	LastError  string `json:"lastError,omitempty"`
+}
+
+// CollectorInstanceSummary 汇总面板中的一个实例
+type CollectorInstanceSummary struct {
+	Instance    string      `json:"instance"`
+	Label       string      `json:"label,omitempty"`
+	LastPushAt  int64       `json:"lastPushAt"` // 毫秒
+	Stale       bool        `json:"stale"`      // 超过 3 个上报间隔没有上报
+	Status      string      `json:"status"`     // 最近一次上报时的健康状态：ok / degraded
+	Offline     bool        `json:"offline"`
+	Health      RelayHealth `json:"health"`
+	Blacklisted []string    `json:"blacklisted"`
+	Requests    int64       `json:"requests"`
+	Errors      int64       `json:"errors"`
+	Tokens      int64       `json:"tokens"`
+	Cost        float64     `json:"cost"`
+}
+
+// CollectorProviderSummary 汇总面板中的一个 provider（跨实例合计）
+type CollectorProviderSummary struct {
+	Platform      string  `json:"platform"`
+	Provider      string  `json:"provider"`
+	Instances     int     `json:"instances"` // 使用该 provider 的实例数
+	Requests      int64   `json:"requests"`
+	Errors        int64   `json:"errors"`
+	ErrorRate     float64 `json:"errorRate"`
+	Tokens        int64   `json:"tokens"`
+	Cost          float64 `json:"cost"`
+	DurationP95Ms float64 `json:"durationP95Ms"` // 各实例小时 P95 的请求数加权平均
+	Blacklisted   int     `json:"blacklisted"`   // 当前拉黑该 provider 的实例数
+}
+
+// CollectorDashboard 多机汇总面板
+type CollectorDashboard struct {
+	From      int64                      `json:"from"` // 秒
+	To        int64                      `json:"to"`
+	Requests  int64                      `json:"requests"`
+	Errors    int64                      `json:"errors"`
+	Cost      float64                    `json:"cost"`
+	Instances []CollectorInstanceSummary `json:"instances"`
+	Providers []CollectorProviderSummary `json:"providers"`
+}
+
+var (
+	collectorStatusMu sync.Mutex
+	collectorStatus   CollectorStatus
+)
+
+// collectorInstanceID 匿名实例 ID：主机名与用户名的摘要，同一台机器的同一用户保持不变
+func collectorInstanceID() string {
+	host, _ := os.Hostname()
+	name := ""
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	sum := sha256.Sum256([]byte("code-switch-collector\x00" + host + "\x00" + name))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ensureCollectorTables 确保汇总服务使用的表存在
+func ensureCollectorTables() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createInstanceSQL = `CREATE TABLE IF NOT EXISTS collector_instance (
+		instance TEXT PRIMARY KEY,
+		label TEXT,
+		health TEXT,
+		offline INTEGER DEFAULT 0,
+		blacklisted TEXT,
+		last_push_at BIGINT
+	)`
+	if _, err := db.Exec(createInstanceSQL); err != nil {
+		return fmt.Errorf("创建 collector_instance 表失败: %w", err)
+	}
+	const createRollupSQL = `CREATE TABLE IF NOT EXISTS collector_rollup (
+		instance TEXT NOT NULL,
+		bucket_start BIGINT NOT NULL,
+		platform TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		requests INTEGER DEFAULT 0,
+		errors INTEGER DEFAULT 0,
+		tokens INTEGER DEFAULT 0,
+		cost REAL DEFAULT 0,
+		duration_p95_ms REAL DEFAULT 0,
+		UNIQUE(instance, bucket_start, platform, provider, model)
+	)`
+	if _, err := db.Exec(createRollupSQL); err != nil {
+		return fmt.Errorf("创建 collector_rollup 表失败: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_collector_rollup_time ON collector_rollup(bucket_start)`); err != nil {
+		return fmt.Errorf("创建 collector_rollup 索引失败: %w", err)
+	}
+	return nil
+}
+
+// rollupTokens 汇总行的 Token 总数
+func rollupTokens(r UsageRollup) int64 {
+	return r.InputTokens + r.OutputTokens + r.ReasoningTokens + r.CacheCreateTokens + r.CacheReadTokens
+}
+
+// buildCollectorPush 汇总本机最近的数据
+func (prs *ProviderRelayService) buildCollectorPush(config RelayCollectorConfig, now time.Time) (*CollectorPush, error) {
+	rollups, err := loadRollups(RollupGranularityHour, "", now.Add(-collectorPushWindow), now)
+	if err != nil {
+		return nil, fmt.Errorf("读取请求汇总失败: %w", err)
+	}
+	entries, err := readHABlacklist()
+	if err != nil {
+		return nil, fmt.Errorf("读取拉黑状态失败: %w", err)
+	}
+	blacklisted := []string{}
+	for _, entry := range entries {
+		if entry.Until != nil && entry.Until.After(now) {
+			blacklisted = append(blacklisted, entry.Platform+"/"+entry.Provider)
+		}
+	}
+	return &CollectorPush{
+		Instance:    collectorInstanceID(),
+		Label:       config.Label,
+		Health:      prs.relayHealth(),
+		Offline:     prs.isOffline(),
+		Blacklisted: blacklisted,
+		Rollups:     rollups,
+		PushedAt:    now.UnixMilli(),
+	}, nil
+}
+
+// pushCollector 上报一次
+func (prs *ProviderRelayService) pushCollector(config RelayCollectorConfig) (int, error) {
+	push, err := prs.buildCollectorPush(config, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(config.PushURL, "/")+"/collector/push", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(collectorSecretHeader, config.Secret)
+	client := &http.Client{Timeout: collectorRequestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("汇总服务返回 HTTP %d", resp.StatusCode)
+	}
+	return len(push.Rollups), nil
+}
+
+// runCollectorPush 定期上报（每轮重新读取配置，修改配置后无需重启）
+func (prs *ProviderRelayService) runCollectorPush(stop <-chan struct{}) {
+	wasReachable := true
+	for {
+		config := currentRelayConfig().Collector
+		delay := collectorDisabledPollWait
+		if config.PushURL != "" {
+			delay = time.Duration(config.IntervalMinutes) * time.Minute
+			rows, err := prs.pushCollector(config)
+			recordCollectorPush(config, rows, err)
+			if (err == nil) != wasReachable {
+				if err != nil {
+					log.Printf("⚠️  [Collector] 上报到 %s 失败: %v", config.PushURL, err)
+				} else {
+					log.Printf("✅ [Collector] 已恢复上报到 %s", config.PushURL)
+				}
+				wasReachable = err == nil
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// recordCollectorPush 记录上报结果
+func recordCollectorPush(config RelayCollectorConfig, rows int, err error) {
+	collectorStatusMu.Lock()
+	defer collectorStatusMu.Unlock()
+	collectorStatus.PushURL = config.PushURL
+	collectorStatus.LastError = ""
+	if err != nil {
+		collectorStatus.LastError = err.Error()
+		return
+	}
+	collectorStatus.LastPushAt = time.Now().UnixMilli()
+	collectorStatus.LastRows = rows
+}
+
+// collectorPushHandler 接收其他实例的上报（需共享密钥，未开启汇总服务时返回 404）
+func (prs *ProviderRelayService) collectorPushHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		config := currentRelayConfig().Collector
+		if !config.Serve || config.Secret == "" {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "collector disabled"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(collectorSecretHeader)), []byte(config.Secret)) != 1 {
+			recordAudit("collector", "auth_failed", fmt.Sprintf("来自 %s 的上报密钥错误", c.ClientIP()))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid collector secret"})
+			return
+		}
+		var push CollectorPush
+		if err := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, collectorMaxPushBytes)).Decode(&push); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid push: " + err.Error()})
+			return
+		}
+		if push.Instance == "" || len(push.Instance) > 64 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid instance"})
+			return
+		}
+		if err := saveCollectorPush(&push, time.Now()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true, "rows": len(push.Rollups)})
+	}
+}
+
+// saveCollectorPush 保存上报：实例状态覆盖，汇总按时段覆盖，并清理过期汇总
+func saveCollectorPush(push *CollectorPush, now time.Time) error {
+	if GlobalDBQueue == nil {
+		return fmt.Errorf("数据库队列未初始化")
+	}
+	health, _ := json.Marshal(push.Health)
+	blacklisted, _ := json.Marshal(push.Blacklisted)
+	offline := 0
+	if push.Offline {
+		offline = 1
+	}
+	if err := GlobalDBQueue.Exec(`
+		INSERT INTO collector_instance (instance, label, health, offline, blacklisted, last_push_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(instance) DO UPDATE SET label = excluded.label, health = excluded.health, offline = excluded.offline,
+			blacklisted = excluded.blacklisted, last_push_at = excluded.last_push_at
+	`, push.Instance, push.Label, string(health), offline, string(blacklisted), now.UnixMilli()); err != nil {
+		return fmt.Errorf("保存实例状态失败: %w", err)
+	}
+	for _, r := range push.Rollups {
+		if r.Granularity != RollupGranularityHour {
+			continue
+		}
+		if err := GlobalDBQueue.Exec(`
+			INSERT INTO collector_rollup (instance, bucket_start, platform, provider, model, requests, errors, tokens, cost, duration_p95_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(instance, bucket_start, platform, provider, model) DO UPDATE SET
+				requests = excluded.requests, errors = excluded.errors, tokens = excluded.tokens,
+				cost = excluded.cost, duration_p95_ms = excluded.duration_p95_ms
+		`, push.Instance, r.BucketStart, r.Platform, r.Provider, r.Model,
+			r.Requests, r.Errors, rollupTokens(r), r.Cost, r.DurationP95Ms); err != nil {
+			return fmt.Errorf("保存汇总失败: %w", err)
+		}
+	}
+	if err := GlobalDBQueue.Exec(`DELETE FROM collector_rollup WHERE bucket_start < ?`, now.Add(-collectorRetention).Unix()); err != nil {
+		return fmt.Errorf("清理过期汇总失败: %w", err)
+	}
+	return nil
+}
+
+// collectorInstanceRow 汇总服务保存的实例状态
+type collectorInstanceRow struct {
+	instance    string
+	label       string
+	health      RelayHealth
+	offline     bool
+	blacklisted []string
+	lastPushAt  int64
+}
+
+// collectorRollupRow 汇总服务保存的一个时段
+type collectorRollupRow struct {
+	instance string
+	platform string
+	provider string
+	requests int64
+	errors   int64
+	tokens   int64
+	cost     float64
+	p95Ms    float64
+}
+
+// summarizeCollector 按实例与 provider 合计；staleAfter 内没有上报的实例标记为过期
+func summarizeCollector(instances []collectorInstanceRow, rows []collectorRollupRow, staleAfter time.Duration, now time.Time) *CollectorDashboard {
+	dashboard := &CollectorDashboard{Instances: []CollectorInstanceSummary{}, Providers: []CollectorProviderSummary{}}
+	byInstance := make(map[string]*CollectorInstanceSummary, len(instances))
+	for _, row := range instances {
+		summary := CollectorInstanceSummary{
+			Instance:    row.instance,
+			Label:       row.label,
+			LastPushAt:  row.lastPushAt,
+			Stale:       now.Sub(time.UnixMilli(row.lastPushAt)) > staleAfter,
+			Status:      row.health.Status,
+			Offline:     row.offline,
+			Health:      row.health,
+			Blacklisted: row.blacklisted,
+		}
+		if summary.Blacklisted == nil {
+			summary.Blacklisted = []string{}
+		}
+		dashboard.Instances = append(dashboard.Instances, summary)
+	}
+	for i := range dashboard.Instances {
+		byInstance[dashboard.Instances[i].Instance] = &dashboard.Instances[i]
+	}
+
+	type providerAcc struct {
+		summary   CollectorProviderSummary
+		instances map[string]bool
+		p95Weight float64
+	}
+	providers := make(map[string]*providerAcc)
+	for _, row := range rows {
+		if inst := byInstance[row.instance]; inst != nil {
+			inst.Requests += row.requests
+			inst.Errors += row.errors
+			inst.Tokens += row.tokens
+			inst.Cost += row.cost
+		}
+		dashboard.Requests += row.requests
+		dashboard.Errors += row.errors
+		dashboard.Cost += row.cost
+
+		key := row.platform + "/" + row.provider
+		acc := providers[key]
+		if acc == nil {
+			acc = &providerAcc{
+				summary:   CollectorProviderSummary{Platform: row.platform, Provider: row.provider},
+				instances: make(map[string]bool),
+			}
+			providers[key] = acc
+		}
+		acc.instances[row.instance] = true
+		acc.summary.Requests += row.requests
+		acc.summary.Errors += row.errors
+		acc.summary.Tokens += row.tokens
+		acc.summary.Cost += row.cost
+		acc.p95Weight += row.p95Ms * float64(row.requests)
+	}
+	for _, inst := range dashboard.Instances {
+		for _, key := range inst.Blacklisted {
+			if acc := providers[key]; acc != nil {
+				acc.summary.Blacklisted++
+			}
+		}
+	}
+	for _, acc := range providers {
+		acc.summary.Instances = len(acc.instances)
+		if acc.summary.Requests > 0 {
+			acc.summary.ErrorRate = float64(acc.summary.Errors) / float64(acc.summary.Requests)
+			acc.summary.DurationP95Ms = acc.p95Weight / float64(acc.summary.Requests)
+		}
+		dashboard.Providers = append(dashboard.Providers, acc.summary)
+	}
+
+	sort.Slice(dashboard.Instances, func(i, j int) bool {
+		a, b := dashboard.Instances[i], dashboard.Instances[j]
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		return a.Instance < b.Instance
+	})
+	sort.Slice(dashboard.Providers, func(i, j int) bool {
+		a, b := dashboard.Providers[i], dashboard.Providers[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Platform+"/"+a.Provider < b.Platform+"/"+b.Provider
+	})
+	return dashboard
+}
+
+// loadCollectorData 读取汇总服务保存的实例状态与 [from, to) 内的汇总
+func loadCollectorData(from, to time.Time) ([]collectorInstanceRow, []collectorRollupRow, error) {
+	instanceRecords, err := xdb.New("collector_instance").Selects()
+	if err != nil && !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+		return nil, nil, err
+	}
+	instances := make([]collectorInstanceRow, 0, len(instanceRecords))
+	for _, record := range instanceRecords {
+		row := collectorInstanceRow{
+			instance:   record.GetString("instance"),
+			label:      record.GetString("label"),
+			offline:    record.GetInt("offline") != 0,
+			lastPushAt: record.GetInt64("last_push_at"),
+		}
+		_ = json.Unmarshal([]byte(record.GetString("health")), &row.health)
+		_ = json.Unmarshal([]byte(record.GetString("blacklisted")), &row.blacklisted)
+		instances = append(instances, row)
+	}
+
+	rollupRecords, err := xdb.New("collector_rollup").Selects(
+		xdb.WhereGe("bucket_start", from.Unix()),
+		xdb.WhereLt("bucket_start", to.Unix()),
+	)
+	if err != nil && !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+		return nil, nil, err
+	}
+	rows := make([]collectorRollupRow, 0, len(rollupRecords))
+	for _, record := range rollupRecords {
+		rows = append(rows, collectorRollupRow{
+			instance: record.GetString("instance"),
+			platform: record.GetString("platform"),
+			provider: record.GetString("provider"),
+			requests: record.GetInt64("requests"),
+			errors:   record.GetInt64("errors"),
+			tokens:   record.GetInt64("tokens"),
+			cost:     record.GetFloat64("cost"),
+			p95Ms:    record.GetFloat64("duration_p95_ms"),
+		})
+	}
+	return instances, rows, nil
+}
+
+// GetCollectorDashboard 汇总服务的面板：最近 hours 小时内各实例与各 provider 的合计（供前端调用）
+func (prs *ProviderRelayService) GetCollectorDashboard(hours int) (*CollectorDashboard, error) {
+	config := currentRelayConfig().Collector
+	if !config.Serve {
+		return nil, fmt.Errorf("未开启多机汇总服务")
+	}
+	if hours <= 0 || hours > int(collectorRetention/time.Hour) {
+		hours = 24
+	}
+	now := time.Now()
+	from := now.Add(-time.Duration(hours) * time.Hour)
+	instances, rows, err := loadCollectorData(from, now)
+	if err != nil {
+		return nil, err
+	}
+	dashboard := summarizeCollector(instances, rows, 3*time.Duration(config.IntervalMinutes)*time.Minute, now)
+	dashboard.From, dashboard.To = from.Unix(), now.Unix()
+	return dashboard, nil
+}
+
+// GetCollectorStatus 本机的上报状态（供前端调用）
+func (prs *ProviderRelayService) GetCollectorStatus() CollectorStatus {
+	config := currentRelayConfig().Collector
+	collectorStatusMu.Lock()
+	status := collectorStatus
+	collectorStatusMu.Unlock()
+	status.Enabled = config.PushURL != ""
+	status.Serving = config.Serve
+	status.PushURL = config.PushURL
+	status.Instance = collectorInstanceID()
+	return status
+}
+
+// PushCollectorNow 立即上报一次，用于检查汇总服务地址与密钥（供前端调用）
+func (prs *ProviderRelayService) PushCollectorNow() (*CollectorStatus, error) {
+	config := currentRelayConfig().Collector
+	if config.PushURL == "" {
+		return nil, fmt.Errorf("尚未配置汇总服务地址")
+	}
+	rows, err := prs.pushCollector(config)
+	recordCollectorPush(config, rows, err)
+	if err != nil {
+		return nil, err
+	}
+	status := prs.GetCollectorStatus()
+	return &status, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateCollectorConfig(t *testing.T) {
+	secret := "0123456789abcdef"
+	tests := []struct {
+		name    string
+		config  RelayCollectorConfig
+		wantErr bool
+	}{
+		{"未启用", RelayCollectorConfig{}, false},
+		{"上报", RelayCollectorConfig{PushURL: "http://10.0.0.5:18100", Secret: secret, IntervalMinutes: 15}, false},
+		{"汇总服务", RelayCollectorConfig{Serve: true, Secret: secret, IntervalMinutes: 15}, false},
+		{"密钥过短", RelayCollectorConfig{Serve: true, Secret: "short", IntervalMinutes: 15}, true},
+		{"地址无效", RelayCollectorConfig{PushURL: "ftp://10.0.0.5", Secret: secret, IntervalMinutes: 15}, true},
+		{"间隔过短", RelayCollectorConfig{PushURL: "http://10.0.0.5:18100", Secret: secret, IntervalMinutes: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCollectorConfig(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("validateCollectorConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSummarizeCollector(t *testing.T) {
+	now := time.Now()
+	instances := []collectorInstanceRow{
+		{instance: "a", label: "alice", lastPushAt: now.Add(-10 * time.Minute).UnixMilli(), blacklisted: []string{"claude/p1"}},
+		{instance: "b", lastPushAt: now.Add(-2 * time.Hour).UnixMilli()},
+	}
+	rows := []collectorRollupRow{
+		{instance: "a", platform: "claude", provider: "p1", requests: 10, errors: 2, tokens: 1000, cost: 1.5, p95Ms: 1000},
+		{instance: "b", platform: "claude", provider: "p1", requests: 30, errors: 0, tokens: 3000, cost: 0.5, p95Ms: 2000},
+		{instance: "b", platform: "codex", provider: "p2", requests: 5, tokens: 100, cost: 0.1},
+	}
+	dashboard := summarizeCollector(instances, rows, 45*time.Minute, now)
+
+	if dashboard.Requests != 45 || dashboard.Errors != 2 || len(dashboard.Instances) != 2 || len(dashboard.Providers) != 2 {
+		t.Fatalf("unexpected totals: %+v", dashboard)
+	}
+	if first := dashboard.Instances[0]; first.Instance != "a" || first.Cost != 1.5 || first.Stale {
+		t.Errorf("实例按费用排序且 a 未过期: %+v", first)
+	}
+	if second := dashboard.Instances[1]; !second.Stale || second.Requests != 35 {
+		t.Errorf("实例 b 应已过期且有 35 个请求: %+v", second)
+	}
+	p1 := dashboard.Providers[0]
+	if p1.Provider != "p1" || p1.Instances != 2 || p1.Requests != 40 || p1.ErrorRate != 0.05 || p1.Blacklisted != 1 {
+		t.Errorf("unexpected provider summary: %+v", p1)
+	}
+	if p1.DurationP95Ms != 1750 {
+		t.Errorf("P95 应按请求数加权: %v", p1.DurationP95Ms)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// configWatchInterval 检查配置文件是否被外部修改的间隔
+const configWatchInterval = 2 * time.Second
+
+// snapshotProviderKinds 缓存到快照中的 provider 配置（gemini 由 GeminiService 自行缓存）
+var snapshotProviderKinds = []string{"claude", "codex"}
+
+// configSnapshot 中继热路径使用的配置快照：启动时加载，修改后整体替换，读取时无锁、无文件 IO
+// 快照内容只读，调用方需要修改时先复制
+type configSnapshot struct {
+	providers    map[string][]Provider // key: claude / codex
+	providerErrs map[string]error      // 首次加载即失败的 provider 配置
+	relay        *RelayConfig
+	stamps       map[string]fileStamp // 生成快照时各配置文件的状态，用于发现外部修改
+	loadedAt     time.Time
+}
+
+// fileStamp 配置文件的修改时间与大小（文件不存在时为零值）
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+var (
+	activeConfigSnapshot atomic.Pointer[configSnapshot]
+	// configReloadMu 串行化快照重建，避免并发保存时旧快照覆盖新快照
+	configReloadMu sync.Mutex
+)
+
+// configFileStamp 读取配置文件状态
+func configFileStamp(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// configSnapshotPaths 快照涵盖的配置文件（key 与 snapshot.stamps 对应）
+func configSnapshotPaths() map[string]string {
+	paths := make(map[string]string, len(snapshotProviderKinds)+1)
+	for _, kind := range snapshotProviderKinds {
+		if path, err := providerFilePath(kind); err == nil {
+			paths[kind] = path
+		}
+	}
+	if path, err := GetRelayConfigPath(); err == nil {
+		paths["relay"] = path
+	}
+	return paths
+}
+
+// reloadConfigSnapshot 重新读取并校验配置，原子替换快照
+// 某个文件解析失败时保留该文件在上一份快照中的内容，不影响正在转发的请求
+func reloadConfigSnapshot() *configSnapshot {
+	configReloadMu.Lock()
+	defer configReloadMu.Unlock()
+
+	previous := activeConfigSnapshot.Load()
+	next := &configSnapshot{
+		providers:    make(map[string][]Provider, len(snapshotProviderKinds)),
+		providerErrs: make(map[string]error),
+		stamps:       make(map[string]fileStamp),
+		loadedAt:     time.Now(),
+	}
+	paths := configSnapshotPaths()
+	for key, path := range paths {
+		// 先记录文件状态再读取，读取期间的修改会在下一次检查时重新加载
+		next.stamps[key] = configFileStamp(path)
+	}
+
+	for _, kind := range snapshotProviderKinds {
+		providers, err := loadProvidersFile(kind)
+		if err == nil {
+			next.providers[kind] = providers
+			continue
+		}
+		if previous != nil && previous.providerErrs[kind] == nil {
+			log.Printf("⚠️  [%s] provider 配置无效，继续使用上次加载的配置: %v", kind, err)
+			next.providers[kind] = previous.providers[kind]
+			continue
+		}
+		next.providerErrs[kind] = err
+	}
+
+	relay, err := LoadRelayConfig()
+	if err == nil {
+		if validateErr := validateRelayConfig(relay); validateErr != nil {
+			log.Printf("⚠️  中继配置校验未通过: %v", validateErr)
+		}
+		next.relay = relay
+	} else if previous != nil {
+		log.Printf("⚠️  读取中继配置失败，继续使用上次加载的配置: %v", err)
+		next.relay = previous.relay
+	} else {
+		log.Printf("⚠️  读取中继配置失败，使用默认值: %v", err)
+		next.relay = DefaultRelayConfig()
+	}
+
+	activeConfigSnapshot.Store(next)
+	return next
+}
+
+// refreshConfigSnapshot 配置保存后立即重建快照（快照尚未启用时无需处理）
+func refreshConfigSnapshot() {
+	if activeConfigSnapshot.Load() == nil {
+		return
+	}
+	reloadConfigSnapshot()
+}
+
+// configSnapshotStale 配置文件自上次加载后是否被修改
+func configSnapshotStale(snapshot *configSnapshot) bool {
+	for key, path := range configSnapshotPaths() {
+		if configFileStamp(path) != snapshot.stamps[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// watchConfigSnapshot 定期检查配置文件，发现外部修改（手动编辑、其他进程写入）时重新加载
+func watchConfigSnapshot(stop <-chan struct{}) {
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if snapshot := activeConfigSnapshot.Load(); snapshot != nil && configSnapshotStale(snapshot) {
+				reloadConfigSnapshot()
+				log.Printf("🔄 检测到配置文件变更，已重新加载")
+			}
+		}
+	}
+}
+
+// snapshotProviders 从快照读取 provider 列表（返回深拷贝，可安全排序与修改字段，包括 map 与切片字段）
+// 快照未启用时退回读取文件
+func (ps *ProviderService) snapshotProviders(kind string) ([]Provider, error) {
+	snapshot := activeConfigSnapshot.Load()
+	if snapshot == nil {
+		return ps.LoadProviders(kind)
+	}
+	if err := snapshot.providerErrs[kind]; err != nil {
+		return nil, err
+	}
+	cached, ok := snapshot.providers[kind]
+	if !ok {
+		return ps.LoadProviders(kind)
+	}
+	providers := make([]Provider, len(cached))
+	for i := range cached {
+		providers[i] = cached[i].clone()
+	}
+	return providers, nil
+}
+
+// clone 复制 provider，map、切片与指针字段不与原值共享
+func (p Provider) clone() Provider {
+	p.SupportedModels = maps.Clone(p.SupportedModels)
+	p.ModelMapping = maps.Clone(p.ModelMapping)
+	p.SplitRoutes = maps.Clone(p.SplitRoutes)
+	p.CertPins = slices.Clone(p.CertPins)
+	p.BetaFlags = slices.Clone(p.BetaFlags)
+	p.configErrors = slices.Clone(p.configErrors)
+	if p.Mock != nil {
+		mock := *p.Mock
+		p.Mock = &mock
+	}
+	if p.HealthCheck != nil {
+		check := *p.HealthCheck
+		check.Headers = maps.Clone(check.Headers)
+		check.ExpectStatus = slices.Clone(check.ExpectStatus)
+		p.HealthCheck = &check
+	}
+	return p
+}
+
+// warmConfigCache 中继启动时预热配置快照并开始监视配置文件
+func (prs *ProviderRelayService) warmConfigCache() {
+	start := time.Now()
+	snapshot := reloadConfigSnapshot()
+	count := 0
+	for _, providers := range snapshot.providers {
+		count += len(providers)
+	}
+	log.Printf("✅ 配置已预热（%d 个 provider，耗时 %s）", count, time.Since(start).Round(time.Millisecond))
+
+	prs.configWatchStop = make(chan struct{})
+	go watchConfigSnapshot(prs.configWatchStop)
+}
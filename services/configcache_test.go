@@ -0,0 +1,86 @@
+package services
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConfigSnapshotReload(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+	t.Cleanup(func() { activeConfigSnapshot.Store(nil) })
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "a", APIURL: "https://a.example.com", APIKey: "k", Enabled: true}}); err != nil {
+		t.Fatalf("SaveProviders: %v", err)
+	}
+	snapshot := reloadConfigSnapshot()
+	if configSnapshotStale(snapshot) {
+		t.Fatal("fresh snapshot should not be stale")
+	}
+
+	providers, err := ps.snapshotProviders("claude")
+	if err != nil || len(providers) != 1 {
+		t.Fatalf("snapshotProviders = %v, %v", providers, err)
+	}
+	providers[0].Name = "changed"
+	if again, _ := ps.snapshotProviders("claude"); again[0].Name != "a" {
+		t.Errorf("snapshot modified through returned slice: %q", again[0].Name)
+	}
+
+	// 通过 SaveProviders 保存后立即生效
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "a", APIURL: "https://a.example.com", APIKey: "k"}, {ID: 2, Name: "b", APIURL: "https://b.example.com", APIKey: "k"}}); err != nil {
+		t.Fatalf("SaveProviders: %v", err)
+	}
+	if providers, _ := ps.snapshotProviders("claude"); len(providers) != 2 {
+		t.Errorf("snapshot not refreshed after save: %d providers", len(providers))
+	}
+
+	// 外部写入无效内容：可检测到变更，重新加载时保留上次的配置
+	path, _ := providerFilePath("claude")
+	if err := os.WriteFile(path, []byte("{invalid"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	if !configSnapshotStale(activeConfigSnapshot.Load()) {
+		t.Fatal("external edit should mark snapshot stale")
+	}
+	reloadConfigSnapshot()
+	if providers, err := ps.snapshotProviders("claude"); err != nil || len(providers) != 2 {
+		t.Errorf("invalid file should keep previous providers, got %d, %v", len(providers), err)
+	}
+}
+
+func TestSnapshotProvidersDeepCopy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+	t.Cleanup(func() { activeConfigSnapshot.Store(nil) })
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{
+		ID: 1, Name: "a", APIURL: "https://a.example.com", APIKey: "k",
+		SupportedModels: map[string]bool{"claude-sonnet-4": true},
+		ModelMapping:    map[string]string{"claude-*": "anthropic/claude-*"},
+		BetaFlags:       []string{"context-1m-2025-08-07"},
+		HealthCheck:     &ProviderHealthCheck{Path: "/health", Headers: map[string]string{"X-Probe": "1"}},
+	}}); err != nil {
+		t.Fatalf("SaveProviders: %v", err)
+	}
+	reloadConfigSnapshot()
+
+	providers, _ := ps.snapshotProviders("claude")
+	providers[0].SupportedModels["other"] = true
+	providers[0].ModelMapping["claude-*"] = "changed"
+	providers[0].BetaFlags[0] = "changed"
+	providers[0].HealthCheck.Path = "/changed"
+	providers[0].HealthCheck.Headers["X-Probe"] = "changed"
+
+	again, _ := ps.snapshotProviders("claude")
+	p := again[0]
+	if len(p.SupportedModels) != 1 || p.ModelMapping["claude-*"] != "anthropic/claude-*" || p.BetaFlags[0] != "context-1m-2025-08-07" ||
+		p.HealthCheck.Path != "/health" || p.HealthCheck.Headers["X-Probe"] != "1" {
+		t.Errorf("修改返回值不应影响快照: %+v %+v", p, *p.HealthCheck)
+	}
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// 配置漂移：本应用写入 CLI 配置文件后记录写入的内容，之后文件在应用外被修改时提示用户
+// 重新应用（恢复为本应用写入的内容）、采用（以当前内容为准）或忽略本次修改，
+// 未处理前切换供应商不会直接覆盖该文件。
+
+const configSyncFileName = "config-sync.json"
+
+// 需要检测漂移的配置文件
+const (
+	configDriftClaude = "claude" // ~/.claude/settings.json
+	configDriftCodex  = "codex"  // ~/.codex/config.toml
+)
+
+// 处理漂移的方式
+const (
+	ConfigDriftReapply = "reapply" // 恢复为本应用上次写入的内容
+	ConfigDriftAdopt   = "adopt"   // 以当前文件内容为准
+	ConfigDriftIgnore  = "ignore"  // 忽略本次修改（文件再次变化时重新提示）
+)
+
+// ConfigDrift 配置文件的漂移状态
+type ConfigDrift struct {
+	Target     string   `json:"target"`
+	Path       string   `json:"path"`
+	Tracked    bool     `json:"tracked"` // 本应用是否写入过该文件
+	Drifted    bool     `json:"drifted"`
+	Missing    bool     `json:"missing"`    // 文件已被删除
+	SyncedAt   int64    `json:"syncedAt"`   // 上次写入时间（毫秒）
+	ModifiedAt int64    `json:"modifiedAt"` // 文件修改时间（毫秒）
+	Lines      []string `json:"lines"`      // 相对上次写入内容的差异，密钥已脱敏
+}
+
+// configSyncRecord 本应用最近一次写入的内容
+type configSyncRecord struct {
+	Path        string `json:"path"`
+	Content     []byte `json:"content"`
+	SyncedAt    int64  `json:"syncedAt"`
+	IgnoredHash string `json:"ignoredHash,omitempty"` // 用户忽略的外部修改
+}
+
+var configSyncMu sync.Mutex
+
+// configSecretLine 匹配配置中的密钥字段（token / key / secret），用于差异脱敏
+var configSecretLine = regexp.MustCompile(`(?i)((?:token|key|secret)[A-Za-z_]*["']?\s*[:=]\s*["']?)([^"'\s,]+)`)
+
+func configSyncPath() string {
+	return filepath.Join(getConfigDir(), configSyncFileName)
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func loadConfigSyncRecords() (map[string]configSyncRecord, error) {
+	records := make(map[string]configSyncRecord)
+	data, err := os.ReadFile(configSyncPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return records, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", configSyncFileName, err)
+	}
+	return records, nil
+}
+
+func saveConfigSyncRecords(records map[string]configSyncRecord) error {
+	if err := os.MkdirAll(getConfigDir(), 0o755); err != nil {
+		return err
+	}
+	return AtomicWriteJSON(configSyncPath(), records)
+}
+
+// recordConfigSync 记录本应用写入的内容，之后的修改视为外部修改
+func recordConfigSync(target, path string, content []byte) {
+	configSyncMu.Lock()
+	defer configSyncMu.Unlock()
+	records, err := loadConfigSyncRecords()
+	if err != nil {
+		log.Printf("⚠️  读取配置同步记录失败: %v", err)
+		records = make(map[string]configSyncRecord)
+	}
+	records[target] = configSyncRecord{Path: path, Content: content, SyncedAt: time.Now().UnixMilli()}
+	if err := saveConfigSyncRecords(records); err != nil {
+		log.Printf("⚠️  保存配置同步记录失败: %v", err)
+	}
+}
+
+// recordConfigSyncFile 读取刚写入的文件并记录
+func recordConfigSyncFile(target, path string) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("⚠️  读取 %s 失败，未记录同步内容: %v", path, err)
+		return
+	}
+	recordConfigSync(target, path, content)
+}
+
+// forgetConfigSync 删除记录（例如关闭代理后文件已恢复为用户的原始配置）
+func forgetConfigSync(target string) {
+	configSyncMu.Lock()
+	defer configSyncMu.Unlock()
+	records, err := loadConfigSyncRecords()
+	if err != nil {
+		return
+	}
+	if _, ok := records[target]; !ok {
+		return
+	}
+	delete(records, target)
+	if err := saveConfigSyncRecords(records); err != nil {
+		log.Printf("⚠️  保存配置同步记录失败: %v", err)
+	}
+}
+
+// detectConfigDrift 比较文件当前内容与本应用上次写入的内容
+func detectConfigDrift(target, path string) (*ConfigDrift, error) {
+	configSyncMu.Lock()
+	records, err := loadConfigSyncRecords()
+	configSyncMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	drift := &ConfigDrift{Target: target, Path: path, Lines: []string{}}
+	record, ok := records[target]
+	if !ok || record.Path != path {
+		return drift, nil
+	}
+	drift.Tracked = true
+	drift.SyncedAt = record.SyncedAt
+
+	current, err := readOptionalFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		drift.Missing = true
+	} else if info, err := os.Stat(path); err == nil {
+		drift.ModifiedAt = info.ModTime().UnixMilli()
+	}
+	hash := contentHash(current)
+	if string(current) == string(record.Content) || (current != nil && hash == record.IgnoredHash) {
+		return drift, nil
+	}
+	drift.Drifted = true
+	drift.Lines = maskConfigLines(diffLines(string(record.Content), string(current)))
+	return drift, nil
+}
+
+// resolveConfigDrift 按 action 处理漂移
+func resolveConfigDrift(target, path, action string) error {
+	configSyncMu.Lock()
+	defer configSyncMu.Unlock()
+	records, err := loadConfigSyncRecords()
+	if err != nil {
+		return err
+	}
+	record, ok := records[target]
+	if !ok || record.Path != path {
+		return fmt.Errorf("没有 %s 的同步记录", path)
+	}
+	current, err := readOptionalFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case ConfigDriftReapply:
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := AtomicWriteBytes(path, record.Content); err != nil {
+			return fmt.Errorf("重新写入 %s 失败: %w", path, err)
+		}
+		record.SyncedAt = time.Now().UnixMilli()
+		record.IgnoredHash = ""
+	case ConfigDriftAdopt:
+		if current == nil {
+			delete(records, target)
+			recordAudit("config_drift", action, path)
+			return saveConfigSyncRecords(records)
+		}
+		record.Content = current
+		record.SyncedAt = time.Now().UnixMilli()
+		record.IgnoredHash = ""
+	case ConfigDriftIgnore:
+		record.IgnoredHash = contentHash(current)
+	default:
+		return fmt.Errorf("无效的处理方式: %s（可选值: reapply、adopt、ignore）", action)
+	}
+	records[target] = record
+	recordAudit("config_drift", action, path)
+	return saveConfigSyncRecords(records)
+}
+
+// ensureNoConfigDrift 切换供应商写入配置前调用：文件有未处理的外部修改时拒绝写入
+func ensureNoConfigDrift(target, path string) error {
+	drift, err := detectConfigDrift(target, path)
+	if err != nil {
+		return err
+	}
+	if drift.Drifted {
+		return fmt.Errorf("%s 已在应用外修改，请先选择重新应用、采用或忽略该修改", filepath.Base(path))
+	}
+	return nil
+}
+
+// maskConfigLines 脱敏差异中的密钥
+func maskConfigLines(lines []string) []string {
+	for i, line := range lines {
+		lines[i] = configSecretLine.ReplaceAllStringFunc(line, func(match string) string {
+			parts := configSecretLine.FindStringSubmatch(match)
+			return parts[1] + maskAPIKey(parts[2])
+		})
+	}
+	return lines
+}
+
+// GetConfigDrift 检查 settings.json 是否在应用外被修改（供前端刷新时调用）
+func (css *ClaudeSettingsService) GetConfigDrift() (*ConfigDrift, error) {
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return nil, err
+	}
+	return detectConfigDrift(configDriftClaude, settingsPath)
+}
+
+// ResolveConfigDrift 处理 settings.json 的外部修改（供前端调用）
+func (css *ClaudeSettingsService) ResolveConfigDrift(action string) error {
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return err
+	}
+	return resolveConfigDrift(configDriftClaude, settingsPath, action)
+}
+
+// GetConfigDrift 检查 config.toml 是否在应用外被修改（供前端刷新时调用）
+func (css *CodexSettingsService) GetConfigDrift() (*ConfigDrift, error) {
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return nil, err
+	}
+	return detectConfigDrift(configDriftCodex, settingsPath)
+}
+
+// ResolveConfigDrift 处理 config.toml 的外部修改（供前端调用）
+func (css *CodexSettingsService) ResolveConfigDrift(action string) error {
+	settingsPath, _, err := css.paths()
+	if err != nil {
+		return err
+	}
+	return resolveConfigDrift(configDriftCodex, settingsPath, action)
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigDrift(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	path := filepath.Join(home, "settings.json")
+	synced := []byte(`{"env":{"ANTHROPIC_AUTH_TOKEN":"sk-synced-1234"}}`)
+	os.WriteFile(path, synced, 0o600)
+	recordConfigSync(configDriftClaude, path, synced)
+
+	if err := ensureNoConfigDrift(configDriftClaude, path); err != nil {
+		t.Fatalf("未修改时不应报告漂移: %v", err)
+	}
+
+	external := []byte(`{"env":{"ANTHROPIC_AUTH_TOKEN":"sk-external-5678"}}`)
+	os.WriteFile(path, external, 0o600)
+	drift, err := detectConfigDrift(configDriftClaude, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !drift.Drifted || len(drift.Lines) == 0 {
+		t.Fatalf("应检测到外部修改: %+v", drift)
+	}
+	if joined := strings.Join(drift.Lines, "\n"); strings.Contains(joined, "sk-external-5678") || strings.Contains(joined, "sk-synced-1234") {
+		t.Errorf("差异不应包含完整的 Key:\n%s", joined)
+	}
+	if ensureNoConfigDrift(configDriftClaude, path) == nil {
+		t.Error("存在未处理的外部修改时应拒绝写入")
+	}
+
+	if err := resolveConfigDrift(configDriftClaude, path, ConfigDriftIgnore); err != nil {
+		t.Fatal(err)
+	}
+	if drift, _ := detectConfigDrift(configDriftClaude, path); drift.Drifted {
+		t.Error("忽略后不应再报告本次修改")
+	}
+	os.WriteFile(path, []byte(`{}`), 0o600)
+	if drift, _ := detectConfigDrift(configDriftClaude, path); !drift.Drifted {
+		t.Error("文件再次变化时应重新报告")
+	}
+
+	if err := resolveConfigDrift(configDriftClaude, path, ConfigDriftReapply); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(synced) {
+		t.Errorf("重新应用后的内容 = %s", data)
+	}
+
+	os.WriteFile(path, external, 0o600)
+	if err := resolveConfigDrift(configDriftClaude, path, ConfigDriftAdopt); err != nil {
+		t.Fatal(err)
+	}
+	if drift, _ := detectConfigDrift(configDriftClaude, path); drift.Drifted {
+		t.Error("采用后应以当前内容为准")
+	}
+	if err := resolveConfigDrift(configDriftClaude, path, "overwrite"); err == nil {
+		t.Error("无效的处理方式应报错")
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// 跨文件事务：一次操作需要修改多个配置文件时（切换供应商并写入 CLI 配置、导入、MCP 同步、重命名 provider 并更新引用），
+// 先把涉及文件的原内容保存到 ~/.code-switch/transactions/<id>/ 并写入日志，再写入新内容；全部成功后提交（删除日志），
+// 任一步失败时按原内容恢复所有文件。应用在事务进行中退出时，下次启动发现未提交的日志会整体回滚，避免留下只改了一半的配置。
+
+const (
+	configTxnDir     = "transactions"
+	configTxnJournal = "journal.json"
+)
+
+// configTxnFile 事务涉及的文件
+type configTxnFile struct {
+	Path    string `json:"path"`
+	Existed bool   `json:"existed"`          // 事务开始前文件是否存在
+	Backup  string `json:"backup,omitempty"` // 原内容副本（事务目录内的文件名）
+}
+
+// configTxnLog 事务日志
+type configTxnLog struct {
+	ID        string          `json:"id"`
+	Operation string          `json:"operation"`
+	StartedAt int64           `json:"startedAt"` // 毫秒
+	Files     []configTxnFile `json:"files"`
+}
+
+// configTransaction 进行中的事务：Track 登记将被其他代码直接写入的文件，Stage 暂存由事务在提交时写入的内容
+type configTransaction struct {
+	dir     string
+	log     configTxnLog
+	tracked map[string]bool
+	staged  map[string][]byte
+	order   []string // 暂存内容的写入顺序
+	done    bool
+}
+
+var configTxnSeq atomic.Int64
+
+func configTxnRoot() string {
+	return filepath.Join(getConfigDir(), configTxnDir)
+}
+
+// beginConfigTransaction 开始事务，operation 为写入日志的操作说明
+func beginConfigTransaction(operation string) (*configTransaction, error) {
+	// 纳秒时间戳加序号，保证 ID 按开始顺序递增（崩溃恢复时按相反顺序回滚嵌套事务）
+	id := fmt.Sprintf("%d-%d", time.Now().UnixNano(), configTxnSeq.Add(1))
+	tx := &configTransaction{
+		dir:     filepath.Join(configTxnRoot(), id),
+		log:     configTxnLog{ID: id, Operation: operation, StartedAt: time.Now().UnixMilli(), Files: []configTxnFile{}},
+		tracked: make(map[string]bool),
+		staged:  make(map[string][]byte),
+	}
+	if err := os.MkdirAll(tx.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("创建事务目录失败: %w", err)
+	}
+	if err := tx.saveLog(); err != nil {
+		_ = os.RemoveAll(tx.dir)
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (tx *configTransaction) saveLog() error {
+	if err := AtomicWriteJSON(filepath.Join(tx.dir, configTxnJournal), tx.log); err != nil {
+		return fmt.Errorf("写入事务日志失败: %w", err)
+	}
+	return nil
+}
+
+// beginProviderFilesTransaction 开始事务并登记 claude / codex 的 provider 配置文件
+func beginProviderFilesTransaction(operation string) (*configTransaction, error) {
+	tx, err := beginConfigTransaction(operation)
+	if err != nil {
+		return nil, err
+	}
+	for _, kind := range []string{"claude", "codex"} {
+		path, err := providerFilePath(kind)
+		if err == nil {
+			err = tx.Track(path)
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// Track 在修改文件前登记并保存原内容；tx 为 nil 时不做任何事，便于在事务外复用同一段代码
+func (tx *configTransaction) Track(path string) error {
+	if tx == nil || path == "" {
+		return nil
+	}
+	if tx.done {
+		return errors.New("事务已结束")
+	}
+	path = filepath.Clean(path)
+	if tx.tracked[path] {
+		return nil
+	}
+	file := configTxnFile{Path: path}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		file.Existed = true
+		file.Backup = strconv.Itoa(len(tx.log.Files)) + ".bak"
+		if err := AtomicWriteBytes(filepath.Join(tx.dir, file.Backup), data); err != nil {
+			return fmt.Errorf("备份 %s 失败: %w", filepath.Base(path), err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("读取 %s 失败: %w", filepath.Base(path), err)
+	}
+	// 先写副本再写日志：日志中出现的文件一定有可用的原内容
+	tx.log.Files = append(tx.log.Files, file)
+	if err := tx.saveLog(); err != nil {
+		tx.log.Files = tx.log.Files[:len(tx.log.Files)-1]
+		return err
+	}
+	tx.tracked[path] = true
+	return nil
+}
+
+// Stage 暂存文件的新内容，提交时统一写入
+func (tx *configTransaction) Stage(path string, data []byte) error {
+	if err := tx.Track(path); err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	if _, ok := tx.staged[path]; !ok {
+		tx.order = append(tx.order, path)
+	}
+	tx.staged[path] = data
+	return nil
+}
+
+// Commit 写入暂存的内容并结束事务，写入失败时回滚全部文件
+func (tx *configTransaction) Commit() error {
+	if tx == nil || tx.done {
+		return nil
+	}
+	for _, path := range tx.order {
+		if err := AtomicWriteBytes(path, tx.staged[path]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("写入 %s 失败，已回滚: %w", filepath.Base(path), err)
+		}
+		recordConfigIntegrity(path)
+	}
+	tx.done = true
+	if err := os.RemoveAll(tx.dir); err != nil {
+		log.Printf("⚠️  清理事务目录失败: %v", err)
+	}
+	return nil
+}
+
+// Rollback 恢复事务涉及的所有文件；恢复失败时保留事务目录，下次启动再尝试
+func (tx *configTransaction) Rollback() {
+	if tx == nil || tx.done {
+		return
+	}
+	tx.done = true
+	if err := rollbackConfigTxn(tx.dir, tx.log); err != nil {
+		log.Printf("⚠️  回滚 %s 失败，副本保留在 %s: %v", tx.log.Operation, tx.dir, err)
+		return
+	}
+	_ = os.RemoveAll(tx.dir)
+}
+
+// rollbackConfigTxn 按相反顺序恢复日志中的文件
+func rollbackConfigTxn(dir string, txLog configTxnLog) error {
+	var errs []error
+	for i := len(txLog.Files) - 1; i >= 0; i-- {
+		file := txLog.Files[i]
+		var err error
+		if file.Existed {
+			err = RestoreBackup(filepath.Join(dir, file.Backup), file.Path)
+		} else if err = os.Remove(file.Path); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file.Path, err))
+			continue
+		}
+		recordConfigIntegrity(file.Path)
+	}
+	refreshConfigSnapshot()
+	return errors.Join(errs...)
+}
+
+// RecoverConfigTransactions 回滚上次运行时未提交的事务（启动时、其他服务读取配置前调用），返回回滚的事务数
+func RecoverConfigTransactions() int {
+	entries, err := os.ReadDir(configTxnRoot())
+	if err != nil {
+		return 0
+	}
+	// ID 以开始时间开头，按相反顺序回滚，嵌套事务先于外层事务恢复
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() > entries[j].Name() })
+	recovered := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(configTxnRoot(), entry.Name())
+		var txLog configTxnLog
+		if err := ReadJSONFile(filepath.Join(dir, configTxnJournal), &txLog); err != nil {
+			// 日志写入前退出，事务尚未修改任何文件
+			_ = os.RemoveAll(dir)
+			continue
+		}
+		if err := rollbackConfigTxn(dir, txLog); err != nil {
+			log.Printf("⚠️  回滚未完成的操作 %s 失败，副本保留在 %s: %v", txLog.Operation, dir, err)
+			continue
+		}
+		_ = os.RemoveAll(dir)
+		recovered++
+		log.Printf("↩️  已回滚上次未完成的操作: %s（%d 个文件）", txLog.Operation, len(txLog.Files))
+		recordAudit("config", "transaction_recovered", fmt.Sprintf("回滚未完成的操作 %s（%d 个文件）", txLog.Operation, len(txLog.Files)))
+	}
+	return recovered
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigTransactionRollback(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	existing := filepath.Join(home, "a.json")
+	created := filepath.Join(home, "b.json")
+	if err := os.WriteFile(existing, []byte(`{"v":1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := beginConfigTransaction("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Track(existing); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Track(created); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(existing, []byte(`{"v":2}`), 0o600)
+	_ = os.WriteFile(created, []byte(`{}`), 0o600)
+	tx.Rollback()
+
+	if data, _ := os.ReadFile(existing); string(data) != `{"v":1}` {
+		t.Errorf("回滚后应恢复原内容: %s", data)
+	}
+	if FileExists(created) {
+		t.Error("回滚后应删除事务中新建的文件")
+	}
+	if entries, _ := os.ReadDir(configTxnRoot()); len(entries) != 0 {
+		t.Errorf("事务结束后应清理事务目录: %d", len(entries))
+	}
+}
+
+func TestConfigTransactionCommitAndRecover(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	first := filepath.Join(home, "first.json")
+	second := filepath.Join(home, "second.json")
+	_ = os.WriteFile(first, []byte("old"), 0o600)
+
+	tx, err := beginConfigTransaction("commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tx.Stage(first, []byte("new"))
+	_ = tx.Stage(second, []byte("new"))
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if data, _ := os.ReadFile(second); string(data) != "new" {
+		t.Errorf("提交后应写入暂存内容: %s", data)
+	}
+
+	// 模拟事务进行中退出：文件已改写但日志未删除
+	tx, err = beginConfigTransaction("crash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tx.Track(first)
+	_ = tx.Track(second)
+	_ = os.WriteFile(first, []byte("half"), 0o600)
+	if n := RecoverConfigTransactions(); n != 1 {
+		t.Fatalf("RecoverConfigTransactions() = %d", n)
+	}
+	if data, _ := os.ReadFile(first); string(data) != "new" {
+		t.Errorf("启动时应回滚未提交的事务: %s", data)
+	}
+	if n := RecoverConfigTransactions(); n != 0 {
+		t.Errorf("已回滚的事务不应再次处理: %d", n)
+	}
+}
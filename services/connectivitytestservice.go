@@ -59,8 +59,7 @@ type ConnectivityTestService struct {
 	results map[string]map[int64]*ConnectivityResult // platform -> providerID -> result
 
 	autoTestEnabled bool
-	stopChan        chan struct{}
-	running         bool
+	testGate        backgroundTestGate // 空闲/计费网络调度
 
 	client *http.Client
 }
@@ -82,7 +81,8 @@ func NewConnectivityTestService(
 		},
 		autoTestEnabled: false,
 		client: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:       10 * time.Second,
+			CheckRedirect: checkUpstreamRedirect,
 			Transport: &http.Transport{
 				MaxIdleConns:        10,
 				IdleConnTimeout:     30 * time.Second,
@@ -104,6 +104,18 @@ func (cts *ConnectivityTestService) TestProvider(ctx context.Context, provider P
 		LastChecked:  time.Now(),
 	}
 
+	// 域名检查：不在允许范围内的地址不发起请求
+	if err := checkUpstreamURL(provider.APIURL); err != nil {
+		result.Message = err.Error()
+		result.SubStatus = SubStatusClientError
+		return result
+	}
+
+	// 自定义健康检查：按 provider 定义的请求与期望结果判定
+	if provider.HealthCheck != nil {
+		return cts.runHealthCheck(ctx, provider, platform, result)
+	}
+
 	// 构建测试请求
 	reqBody, contentField := cts.buildTestRequest(platform, &provider)
 	if reqBody == nil {
@@ -122,36 +134,16 @@ func (cts *ConnectivityTestService) TestProvider(ctx context.Context, provider P
 
 	// 设置 Headers
 	req.Header.Set("Content-Type", "application/json")
-	if provider.APIKey != "" {
-		// Claude/Anthropic 使用 x-api-key，OpenAI 使用 Authorization: Bearer
-		if strings.Contains(strings.ToLower(provider.APIURL), "anthropic") ||
-			strings.Contains(strings.ToLower(platform), "claude") {
-			req.Header.Set("x-api-key", provider.APIKey)
-			req.Header.Set("anthropic-version", "2023-06-01")
-		} else {
-			req.Header.Set("Authorization", "Bearer "+provider.APIKey)
-		}
-	}
+	setTestAuthHeaders(req, &provider, platform)
 
 	// 发送请求并计时
 	start := time.Now()
-	resp, err := cts.client.Do(req)
+	resp, err := withProviderNetwork(cts.client, provider.network()).Do(req)
 	latencyMs := int(time.Since(start).Milliseconds())
 	result.LatencyMs = latencyMs
 
 	if err != nil {
-		// 检测是否为超时错误 - 超时应视为"慢但可用"（黄色），而非"不可用"（红色）
-		// 这样可以避免慢响应的 Provider 被误判为失败而拉黑
-		if isTimeoutError(err) {
-			result.Status = StatusDegraded
-			result.SubStatus = SubStatusSlowLatency
-			result.Message = fmt.Sprintf("响应超时 (>%ds)", int(cts.client.Timeout.Seconds()))
-			return result
-		}
-		// 真正的网络错误（连接失败、DNS 解析失败等）
-		result.Status = StatusUnavailable
-		result.SubStatus = SubStatusNetworkError
-		result.Message = cts.truncateMessage(fmt.Sprintf("网络错误: %v", err))
+		cts.applyRequestError(result, err)
 		return result
 	}
 	defer resp.Body.Close()
@@ -180,6 +172,37 @@ func (cts *ConnectivityTestService) TestProvider(ctx context.Context, provider P
 	return result
 }
 
+// setTestAuthHeaders 设置测试请求的认证头
+func setTestAuthHeaders(req *http.Request, provider *Provider, platform string) {
+	if provider.APIKey == "" {
+		return
+	}
+	// Claude/Anthropic 使用 x-api-key，OpenAI 使用 Authorization: Bearer
+	if strings.Contains(strings.ToLower(provider.APIURL), "anthropic") ||
+		strings.Contains(strings.ToLower(platform), "claude") {
+		req.Header.Set("x-api-key", provider.APIKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+	} else {
+		req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	}
+}
+
+// applyRequestError 按请求错误设置测试结果
+func (cts *ConnectivityTestService) applyRequestError(result *ConnectivityResult, err error) {
+	// 检测是否为超时错误 - 超时应视为"慢但可用"（黄色），而非"不可用"（红色）
+	// 这样可以避免慢响应的 Provider 被误判为失败而拉黑
+	if isTimeoutError(err) {
+		result.Status = StatusDegraded
+		result.SubStatus = SubStatusSlowLatency
+		result.Message = fmt.Sprintf("响应超时 (>%ds)", int(cts.client.Timeout.Seconds()))
+		return
+	}
+	// 真正的网络错误（连接失败、DNS 解析失败等）
+	result.Status = StatusUnavailable
+	result.SubStatus = SubStatusNetworkError
+	result.Message = cts.truncateMessage(fmt.Sprintf("网络错误: %v", err))
+}
+
 // buildTestRequest 根据平台构建测试请求体
 func (cts *ConnectivityTestService) buildTestRequest(platform string, provider *Provider) ([]byte, string) {
 	var model string
@@ -360,6 +383,18 @@ func isTimeoutError(err error) bool {
 
 // TestAll 测试指定平台的所有启用检测的供应商
 func (cts *ConnectivityTestService) TestAll(platform string) []ConnectivityResult {
+	// 只测试启用了连通性检测的供应商
+	return cts.testProviders(platform, 30*time.Second, func(p Provider) bool { return p.ConnectivityCheck })
+}
+
+// ProbeActive 快速探测指定平台所有已启用的供应商（如系统唤醒后重新确认状态）
+// 未开启连通性检测的供应商只记录结果，不参与拉黑判定
+func (cts *ConnectivityTestService) ProbeActive(platform string, timeout time.Duration) []ConnectivityResult {
+	return cts.testProviders(platform, timeout, func(p Provider) bool { return p.Enabled })
+}
+
+// testProviders 并发测试满足条件的供应商
+func (cts *ConnectivityTestService) testProviders(platform string, timeout time.Duration, include func(Provider) bool) []ConnectivityResult {
 	providers, err := cts.providerService.LoadProviders(platform)
 	if err != nil {
 		log.Printf("[ConnectivityTest] 加载 %s 供应商失败: %v", platform, err)
@@ -371,12 +406,11 @@ func (cts *ConnectivityTestService) TestAll(platform string) []ConnectivityResul
 	var mu sync.Mutex
 	sem := make(chan struct{}, 5) // 最多 5 个并发
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	for _, provider := range providers {
-		// 只测试启用了连通性检测的供应商
-		if !provider.ConnectivityCheck {
+		if !include(provider) {
 			continue
 		}
 
@@ -397,7 +431,17 @@ func (cts *ConnectivityTestService) TestAll(platform string) []ConnectivityResul
 			cts.mu.Unlock()
 
 			// 与拉黑服务联动
-			cts.handleBlacklistIntegration(platform, p.Name, result)
+			if p.ConnectivityCheck {
+				cts.handleBlacklistIntegration(platform, p.Name, result)
+			}
+
+			// 记录延迟样本，用于端点延迟趋势告警
+			if result.Status != StatusUnavailable {
+				latency := uint64(result.LatencyMs)
+				recordEndpointLatency(p.APIURL, &latency)
+			} else {
+				recordEndpointLatency(p.APIURL, nil)
+			}
 
 			mu.Lock()
 			results = append(results, *result)
@@ -434,6 +478,11 @@ func (cts *ConnectivityTestService) handleBlacklistIntegration(platform, provide
 	}
 }
 
+// CloseIdleConnections 关闭测试客户端的空闲连接（系统唤醒后旧连接可能已失效）
+func (cts *ConnectivityTestService) CloseIdleConnections() {
+	cts.client.CloseIdleConnections()
+}
+
 // GetResults 获取指定平台的测试结果
 func (cts *ConnectivityTestService) GetResults(platform string) []ConnectivityResult {
 	cts.mu.RLock()
@@ -530,48 +579,32 @@ func (cts *ConnectivityTestService) GetAutoTestEnabled() bool {
 	return cts.autoTestEnabled
 }
 
-// startAutoTest 启动自动测试定时器
+// startAutoTest 注册自动测试任务（启动时立即执行一次）
 func (cts *ConnectivityTestService) startAutoTest() {
-	if cts.running {
-		return
-	}
-
-	cts.stopChan = make(chan struct{})
-	cts.running = true
-
-	go func() {
-		// 启动时立即执行一次
-		cts.runAllPlatformTests()
-
-		ticker := time.NewTicker(1 * time.Minute)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				cts.runAllPlatformTests()
-			case <-cts.stopChan:
-				log.Println("[ConnectivityTest] 自动测试定时器已停止")
-				return
-			}
-		}
-	}()
-
+	scheduleJob(backgroundJob{
+		name:     "connectivity_test",
+		title:    "自动连通性测试",
+		interval: func() time.Duration { return time.Minute },
+		run: func() error {
+			cts.runAllPlatformTests()
+			return nil
+		},
+	})
 	log.Println("[ConnectivityTest] 自动测试定时器已启动（间隔: 1分钟）")
 }
 
-// stopAutoTest 停止自动测试定时器
+// stopAutoTest 移除自动测试任务
 func (cts *ConnectivityTestService) stopAutoTest() {
-	if !cts.running {
-		return
-	}
-
-	close(cts.stopChan)
-	cts.running = false
+	unscheduleJob("connectivity_test")
 }
 
 // runAllPlatformTests 执行所有平台的测试
 func (cts *ConnectivityTestService) runAllPlatformTests() {
+	if deferred, reason := cts.testGate.shouldDefer(currentRelayConfig().BackgroundTest); deferred {
+		log.Printf("[ConnectivityTest] 推迟本轮自动测试: %s", reason)
+		return
+	}
+
 	// 仅轮询 ProviderService 支持的平台，避免无意义的错误日志
 	// Gemini 使用独立的 GeminiService，暂未接入
 	platforms := []string{"claude", "codex"}
@@ -580,18 +613,17 @@ func (cts *ConnectivityTestService) runAllPlatformTests() {
 	}
 }
 
+// GetBackgroundTestState 获取后台测速调度状态（供前端调用）
+func (cts *ConnectivityTestService) GetBackgroundTestState() BackgroundTestState {
+	return cts.testGate.state(currentRelayConfig().BackgroundTest, time.Now())
+}
+
 // Wails 生命周期方法
 func (cts *ConnectivityTestService) Start() error {
 	return nil
 }
 
 func (cts *ConnectivityTestService) Stop() error {
-	cts.mu.Lock()
-	defer cts.mu.Unlock()
-
-	if cts.running {
-		close(cts.stopChan)
-		cts.running = false
-	}
+	cts.stopAutoTest()
 	return nil
 }
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 浏览器客户端支持：启用后中继接口返回 CORS 头并处理 OPTIONS 预检，供指向本机中继的网页工具调用。
+// 只对转发类接口生效（/v1、/responses、/embeddings、/gemini、/health），管理、编辑器与 MCP 接口仍只接受本机非浏览器访问。
+// 启用时带有 Origin 头且来源不在白名单中的请求直接拒绝：即使不经预检的简单请求也无法借用中继消耗额度。
+
+// corsAllowHeaders 预检未声明请求头时允许的请求头
+const corsAllowHeaders = "Content-Type, Authorization, X-Api-Key, Anthropic-Version, Anthropic-Beta, Anthropic-Dangerous-Direct-Browser-Access, X-Goog-Api-Key, OpenAI-Beta"
+
+// corsExposeHeaders 允许网页读取的响应头
+const corsExposeHeaders = "Request-Id, X-Request-Id, Retry-After, X-CodeSwitch-Provider, X-CodeSwitch-Latency, X-CodeSwitch-Retries, X-CodeSwitch-Token-Count, X-CodeSwitch-Embedding-Cache"
+
+// corsRelayPrefixes 返回 CORS 头的接口路径前缀
+var corsRelayPrefixes = []string{"/v1/", "/responses", "/embeddings", "/gemini/", "/health"}
+
+// validateCORSConfig 校验浏览器访问配置
+func validateCORSConfig(config RelayCORSConfig) error {
+	if config.Enabled && len(config.AllowedOrigins) == 0 {
+		return fmt.Errorf("启用浏览器访问时至少需要一个允许的来源")
+	}
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		// 通配符按数字代入后校验格式（端口中的 * 无法直接解析）
+		parsed, err := url.Parse(strings.ReplaceAll(origin, "*", "0"))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") {
+			return fmt.Errorf("无效的来源: %s（格式应为 http(s)://host[:port]，可使用 * 通配）", origin)
+		}
+		if _, err := path.Match(strings.ToLower(origin), ""); err != nil {
+			return fmt.Errorf("无效的来源通配符: %s", origin)
+		}
+	}
+	if config.MaxAgeSeconds < 0 || config.MaxAgeSeconds > 86400 {
+		return fmt.Errorf("预检缓存时间必须在 0-86400 秒之间")
+	}
+	return nil
+}
+
+// corsOriginAllowed 来源是否在白名单中（支持 * 通配，如 http://localhost:*）
+func corsOriginAllowed(allowed []string, origin string) bool {
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	for _, pattern := range allowed {
+		if pattern == "*" {
+			return true
+		}
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "/"))
+		if pattern == origin {
+			return true
+		}
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isCORSRelayPath(p string) bool {
+	for _, prefix := range corsRelayPrefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// relayCORSMiddleware 为转发类接口返回 CORS 头并应答预检
+func relayCORSMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		config := currentRelayConfig().CORS
+		origin := c.GetHeader("Origin")
+		if !config.Enabled || origin == "" || !isCORSRelayPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		c.Header("Vary", "Origin")
+		if !corsOriginAllowed(config.AllowedOrigins, origin) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "origin not allowed"})
+			return
+		}
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Expose-Headers", corsExposeHeaders)
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			headers := c.GetHeader("Access-Control-Request-Headers")
+			if headers == "" {
+				headers = corsAllowHeaders
+			}
+			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Max-Age", strconv.Itoa(config.MaxAgeSeconds))
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
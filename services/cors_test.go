@@ -0,0 +1,88 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSOriginAllowed(t *testing.T) {
+	allowed := []string{"http://localhost:*", "https://playground.example.com"}
+	cases := map[string]bool{
+		"http://localhost:5173":           true,
+		"HTTP://LOCALHOST:3000":           true,
+		"https://playground.example.com/": true,
+		"https://evil.example.com":        false,
+		"http://localhost.evil.com":       false,
+	}
+	for origin, want := range cases {
+		if got := corsOriginAllowed(allowed, origin); got != want {
+			t.Errorf("%s: 期望 %v，得到 %v", origin, want, got)
+		}
+	}
+
+	if err := validateCORSConfig(RelayCORSConfig{Enabled: true}); err == nil {
+		t.Error("启用时没有允许的来源应报错")
+	}
+	if err := validateCORSConfig(RelayCORSConfig{AllowedOrigins: []string{"localhost:3000"}}); err == nil {
+		t.Error("缺少协议的来源应报错")
+	}
+	if err := validateCORSConfig(RelayCORSConfig{AllowedOrigins: []string{"*", "http://127.0.0.1:*"}}); err != nil {
+		t.Errorf("有效配置不应报错: %v", err)
+	}
+}
+
+func TestRelayCORSMiddleware(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	config := DefaultRelayConfig()
+	config.CORS = RelayCORSConfig{Enabled: true, AllowedOrigins: []string{"http://localhost:*"}, MaxAgeSeconds: 600}
+	data, _ := json.Marshal(config)
+	if err := os.MkdirAll(filepath.Join(home, ".code-switch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".code-switch", "relay-config.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(relayCORSMiddleware())
+	router.POST("/v1/messages", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	router.POST("/mcp", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	// 预检
+	req := httptest.NewRequest(http.MethodOptions, "/v1/messages", nil)
+	req.Header.Set("Origin", "http://localhost:5173")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "content-type, x-api-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:5173" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "content-type, x-api-key" {
+		t.Fatalf("预检应返回 204 与 CORS 头，得到 %d %v", w.Code, w.Header())
+	}
+
+	// 不在白名单中的来源被拒绝
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("未允许的来源应返回 403，得到 %d", w.Code)
+	}
+
+	// 非转发类接口不返回 CORS 头
+	req = httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set("Origin", "http://localhost:5173")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("MCP 接口不应返回 CORS 头")
+	}
+}
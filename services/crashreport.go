@@ -0,0 +1,343 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 崩溃报告：前端调用与中继后台 goroutine 中的 panic 被恢复后，在 ~/.code-switch/crashes 下写入本地报告
+// （调用栈、最近的日志、配置文件校验和），下次启动时提示用户查看。报告只保存在本地，
+// 仅在用户确认后提交到 relay-config.json 中配置的地址。
+
+const (
+	crashReportDir     = "crashes"
+	crashReportMax     = 20  // 最多保留的报告数，超出时删除最旧的
+	crashLogTailLines  = 200 // 报告中附带的最近日志条数
+	crashSubmitTimeout = 15 * time.Second
+	crashRestartDelay  = 5 * time.Second // 后台循环 panic 后重新启动前的等待时间
+)
+
+// RelayCrashReportConfig 崩溃报告提交配置
+type RelayCrashReportConfig struct {
+	SubmitURL string `json:"submitUrl,omitempty"` // 用户确认后提交报告的地址，为空表示只保存在本地
+}
+
+// validateCrashReportConfig 校验崩溃报告配置
+func validateCrashReportConfig(config RelayCrashReportConfig) error {
+	if config.SubmitURL == "" {
+		return nil
+	}
+	return validateHTTPURL(config.SubmitURL, "crashReport.submitUrl")
+}
+
+// CrashReport 崩溃报告
+type CrashReport struct {
+	ID              string            `json:"id"`
+	Component       string            `json:"component"` // 发生 panic 的位置，如 binding、relay.http、job:rollup
+	Message         string            `json:"message"`
+	Stack           string            `json:"stack"`
+	CreatedAt       int64             `json:"createdAt"` // 毫秒
+	AppVersion      string            `json:"appVersion,omitempty"`
+	OS              string            `json:"os"`
+	Arch            string            `json:"arch"`
+	LogTail         []string          `json:"logTail,omitempty"`         // 最近的日志（已脱敏）
+	ConfigChecksums map[string]string `json:"configChecksums,omitempty"` // 配置文件名 → 校验和，不含文件内容
+	Seen            bool              `json:"seen"`                      // 用户已查看
+	SubmittedAt     int64             `json:"submittedAt,omitempty"`     // 毫秒，0 表示未提交
+}
+
+var crashReportIDPattern = regexp.MustCompile(`^[0-9a-f-]+$`)
+
+var (
+	crashReporterMu sync.Mutex
+	crashLogTail    func(n int) []ConsoleLog // 由 CrashReportService 注入
+	crashAppVersion string
+)
+
+func crashReportRoot() string {
+	return filepath.Join(getConfigDir(), crashReportDir)
+}
+
+func crashReportPath(id string) (string, error) {
+	if !crashReportIDPattern.MatchString(id) {
+		return "", fmt.Errorf("无效的崩溃报告 ID: %s", id)
+	}
+	return filepath.Join(crashReportRoot(), "crash-"+id+".json"), nil
+}
+
+// runRecovered 运行 run，panic 时写入崩溃报告并返回 true
+func runRecovered(component string, run func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			RecordCrash(component, r, string(debug.Stack()))
+			panicked = true
+		}
+	}()
+	run()
+	return false
+}
+
+// superviseLoop 运行后台循环，panic 时写入崩溃报告并稍后重新启动，正常返回或 stop 关闭时结束
+func superviseLoop(component string, stop <-chan struct{}, run func()) {
+	for runRecovered(component, run) {
+		select {
+		case <-stop:
+			return
+		case <-time.After(crashRestartDelay):
+			log.Printf("🔁 [Crash] 重新启动 %s", component)
+		}
+	}
+}
+
+// RecordCrash 写入崩溃报告（也供应用入口的 Wails PanicHandler 调用），失败时只记录日志
+func RecordCrash(component string, value any, stack string) *CrashReport {
+	now := time.Now()
+	report := &CrashReport{
+		ID:              fmt.Sprintf("%d-%s", now.UnixMilli(), uuid.NewString()[:8]),
+		Component:       component,
+		Message:         fmt.Sprint(value),
+		Stack:           stack,
+		CreatedAt:       now.UnixMilli(),
+		OS:              runtime.GOOS,
+		Arch:            runtime.GOARCH,
+		ConfigChecksums: configChecksums(),
+	}
+	crashReporterMu.Lock()
+	tail := crashLogTail
+	report.AppVersion = crashAppVersion
+	crashReporterMu.Unlock()
+	if tail != nil {
+		for _, entry := range tail(crashLogTailLines) {
+			line := fmt.Sprintf("%s [%s] %s", entry.Timestamp.Format("15:04:05.000"), entry.Level, strings.TrimRight(entry.Message, "\n"))
+			report.LogTail = append(report.LogTail, secretKeyPattern.ReplaceAllStringFunc(line, redactSecret))
+		}
+	}
+	report.Message = secretKeyPattern.ReplaceAllStringFunc(report.Message, redactSecret)
+
+	log.Printf("💥 [Crash] %s 发生 panic: %s", component, report.Message)
+	if err := saveCrashReport(report); err != nil {
+		log.Printf("⚠️  [Crash] 保存崩溃报告失败: %v", err)
+		return report
+	}
+	pruneCrashReports()
+	return report
+}
+
+// configChecksums 受管理配置文件的校验和（文件不存在时不记录）
+func configChecksums() map[string]string {
+	sums := make(map[string]string)
+	for _, name := range managedConfigFiles {
+		data, err := os.ReadFile(filepath.Join(getConfigDir(), name))
+		if err != nil {
+			continue
+		}
+		sums[name] = contentHash(data)
+	}
+	return sums
+}
+
+func saveCrashReport(report *CrashReport) error {
+	path, err := crashReportPath(report.ID)
+	if err != nil {
+		return err
+	}
+	return AtomicWriteJSON(path, report)
+}
+
+// loadCrashReports 读取全部报告，按时间从新到旧排列（无法解析的文件跳过）
+func loadCrashReports() []CrashReport {
+	entries, err := os.ReadDir(crashReportRoot())
+	if err != nil {
+		return nil
+	}
+	var reports []CrashReport
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "crash-") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(crashReportRoot(), entry.Name()))
+		if err != nil {
+			continue
+		}
+		var report CrashReport
+		if err := json.Unmarshal(data, &report); err != nil || report.ID == "" {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].CreatedAt > reports[j].CreatedAt })
+	return reports
+}
+
+func pruneCrashReports() {
+	reports := loadCrashReports()
+	for _, report := range reports[min(len(reports), crashReportMax):] {
+		if path, err := crashReportPath(report.ID); err == nil {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+// relayCrashRecovery 中继请求处理中的 panic 写入崩溃报告并返回 500
+func relayCrashRecovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				RecordCrash("relay.http", r, string(debug.Stack()))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "中继内部错误，已生成崩溃报告"})
+			}
+		}()
+		c.Next()
+	}
+}
+
+// CrashReportService 崩溃报告管理
+type CrashReportService struct {
+	notificationService *NotificationService
+	startedAt           int64
+	client              *http.Client
+}
+
+// NewCrashReportService 创建崩溃报告服务（报告附带 consoleService 中最近的日志）
+func NewCrashReportService(consoleService *ConsoleService, appVersion string, notificationService *NotificationService) *CrashReportService {
+	crashReporterMu.Lock()
+	if consoleService != nil {
+		crashLogTail = consoleService.GetRecentLogs
+	}
+	crashAppVersion = appVersion
+	crashReporterMu.Unlock()
+	return &CrashReportService{
+		notificationService: notificationService,
+		startedAt:           time.Now().UnixMilli(),
+		client:              &http.Client{Timeout: crashSubmitTimeout},
+	}
+}
+
+// Start 提示上次运行期间产生的未查看报告
+func (crs *CrashReportService) Start() error {
+	pending := crs.GetPendingCrashReports()
+	if len(pending) == 0 {
+		return nil
+	}
+	log.Printf("💥 [Crash] 上次运行期间发生 %d 次崩溃，可在设置中查看崩溃报告", len(pending))
+	if crs.notificationService != nil {
+		crs.notificationService.NotifyCrashReports(len(pending))
+	}
+	return nil
+}
+
+func (crs *CrashReportService) Stop() error { return nil }
+
+// GetCrashReports 获取全部崩溃报告，从新到旧（供前端调用）
+func (crs *CrashReportService) GetCrashReports() []CrashReport {
+	reports := loadCrashReports()
+	if reports == nil {
+		return []CrashReport{}
+	}
+	return reports
+}
+
+// GetPendingCrashReports 获取本次启动前产生且尚未查看的崩溃报告（供前端调用）
+func (crs *CrashReportService) GetPendingCrashReports() []CrashReport {
+	pending := []CrashReport{}
+	for _, report := range loadCrashReports() {
+		if !report.Seen && report.CreatedAt < crs.startedAt {
+			pending = append(pending, report)
+		}
+	}
+	return pending
+}
+
+func (crs *CrashReportService) loadReport(id string) (*CrashReport, error) {
+	path, err := crashReportPath(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("崩溃报告 %s 不存在", id)
+		}
+		return nil, err
+	}
+	var report CrashReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("解析崩溃报告失败: %w", err)
+	}
+	return &report, nil
+}
+
+// DismissCrashReport 标记报告为已查看，之后启动时不再提示（供前端调用）
+func (crs *CrashReportService) DismissCrashReport(id string) error {
+	report, err := crs.loadReport(id)
+	if err != nil {
+		return err
+	}
+	if report.Seen {
+		return nil
+	}
+	report.Seen = true
+	return saveCrashReport(report)
+}
+
+// DeleteCrashReport 删除崩溃报告（供前端调用）
+func (crs *CrashReportService) DeleteCrashReport(id string) error {
+	path, err := crashReportPath(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除崩溃报告失败: %w", err)
+	}
+	return nil
+}
+
+// SubmitCrashReport 经用户确认后提交报告到配置的地址（供前端调用）
+func (crs *CrashReportService) SubmitCrashReport(id string) error {
+	submitURL := currentRelayConfig().CrashReport.SubmitURL
+	if submitURL == "" {
+		return fmt.Errorf("未配置崩溃报告提交地址，报告仅保存在本地")
+	}
+	report, err := crs.loadReport(id)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	resp, err := crs.client.Post(submitURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("提交崩溃报告失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("提交崩溃报告失败: HTTP %d", resp.StatusCode)
+	}
+
+	report.Seen = true
+	report.SubmittedAt = time.Now().UnixMilli()
+	if err := saveCrashReport(report); err != nil {
+		log.Printf("⚠️  [Crash] 更新崩溃报告状态失败: %v", err)
+	}
+	recordAudit("crash", "submit", fmt.Sprintf("%s → %s", id, submitURL))
+	return nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrashReports(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	if !runRecovered("test", func() { panic("key sk-ant-REDACTED leaked") }) {
+		t.Fatal("runRecovered 应报告 panic")
+	}
+	reports := loadCrashReports()
+	if len(reports) != 1 {
+		t.Fatalf("应写入一份崩溃报告: %d", len(reports))
+	}
+	report := reports[0]
+	if report.Component != "test" || report.Stack == "" {
+		t.Errorf("报告缺少组件或调用栈: %+v", report)
+	}
+	if strings.Contains(report.Message, "abcdefghijklmnop") {
+		t.Errorf("报告中的密钥应脱敏: %s", report.Message)
+	}
+
+	// 启动时只提示本次启动前产生、且未查看的报告
+	crs := &CrashReportService{startedAt: time.Now().UnixMilli() + 1}
+	if pending := crs.GetPendingCrashReports(); len(pending) != 1 {
+		t.Fatalf("GetPendingCrashReports() = %d", len(pending))
+	}
+	if err := crs.DismissCrashReport(report.ID); err != nil {
+		t.Fatal(err)
+	}
+	if pending := crs.GetPendingCrashReports(); len(pending) != 0 {
+		t.Errorf("已查看的报告不应再提示: %d", len(pending))
+	}
+	if err := crs.SubmitCrashReport(report.ID); err == nil {
+		t.Error("未配置提交地址时不应提交")
+	}
+	if err := crs.DeleteCrashReport("../app"); err == nil {
+		t.Error("应拒绝无效的报告 ID")
+	}
+}
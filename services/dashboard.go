@@ -0,0 +1,362 @@
+package services
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 自定义看板查询：在请求汇总表（request_rollup）上按预定义的维度与指标聚合，
+// 前端据此让用户自行组合图表，不暴露原始 SQL。
+// 天汇总覆盖已结束的日期，之后的时段使用小时汇总；数据截至最近一次汇总的整点。
+
+// 看板维度
+const (
+	DashboardDimPlatform = "platform"
+	DashboardDimProvider = "provider"
+	DashboardDimModel    = "model"
+	DashboardDimDay      = "day"
+	DashboardDimHour     = "hour"
+)
+
+const (
+	dashboardMaxDimensions = 3
+	dashboardMaxDays       = 730
+	dashboardDefaultLimit  = 1000
+	dashboardMaxLimit      = 5000
+)
+
+// dashboardMeasures 看板指标；延迟指标为各时段百分位按成功请求数加权的平均值（近似值）
+var dashboardMeasures = []DashboardField{
+	{"requests", "请求数"},
+	{"successes", "成功数"},
+	{"errors", "错误数"},
+	{"error_rate", "错误率"},
+	{"cost", "费用"},
+	{"input_tokens", "输入 Token"},
+	{"output_tokens", "输出 Token"},
+	{"reasoning_tokens", "推理 Token"},
+	{"cache_create_tokens", "缓存写入 Token"},
+	{"cache_read_tokens", "缓存读取 Token"},
+	{"total_tokens", "总 Token"},
+	{"latency_p50_ms", "耗时 P50（毫秒）"},
+	{"latency_p95_ms", "耗时 P95（毫秒）"},
+	{"latency_p99_ms", "耗时 P99（毫秒）"},
+	{"ttft_p50_ms", "首字节 P50（毫秒）"},
+	{"ttft_p95_ms", "首字节 P95（毫秒）"},
+}
+
+var dashboardDimensions = []DashboardField{
+	{DashboardDimPlatform, "平台"},
+	{DashboardDimProvider, "供应商"},
+	{DashboardDimModel, "模型"},
+	{DashboardDimDay, "日期"},
+	{DashboardDimHour, "小时"},
+}
+
+// DashboardField 可选的维度或指标
+type DashboardField struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+}
+
+// DashboardSchema 看板可用的维度与指标
+type DashboardSchema struct {
+	Dimensions []DashboardField `json:"dimensions"`
+	Measures   []DashboardField `json:"measures"`
+	MaxDays    int              `json:"maxDays"`
+}
+
+// DashboardQuery 看板查询
+type DashboardQuery struct {
+	Dimensions []string          `json:"dimensions"`        // 分组维度，最多 3 个
+	Measures   []string          `json:"measures"`          // 指标，至少 1 个
+	Days       int               `json:"days"`              // 最近多少天，默认 7
+	Filters    map[string]string `json:"filters,omitempty"` // 按 platform / provider / model 精确过滤
+	OrderBy    string            `json:"orderBy,omitempty"` // 排序字段（维度或指标），为空时按时间升序或第一个指标降序
+	Desc       bool              `json:"desc,omitempty"`
+	Limit      int               `json:"limit,omitempty"` // 最多返回行数，默认 1000
+}
+
+// DashboardResult 看板查询结果，每行包含所选维度与指标
+type DashboardResult struct {
+	Columns   []string         `json:"columns"`
+	Rows      []map[string]any `json:"rows"`
+	Truncated bool             `json:"truncated"` // 是否因 Limit 截断
+}
+
+// GetDashboardSchema 获取看板可用的维度与指标（供前端调用）
+func (rs *RollupService) GetDashboardSchema() DashboardSchema {
+	return DashboardSchema{Dimensions: dashboardDimensions, Measures: dashboardMeasures, MaxDays: dashboardMaxDays}
+}
+
+// QueryDashboard 执行看板查询（供前端调用）
+func (rs *RollupService) QueryDashboard(query DashboardQuery) (*DashboardResult, error) {
+	if err := normalizeDashboardQuery(&query); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	from := startOfDay(now).AddDate(0, 0, -(query.Days - 1))
+	rows, err := loadDashboardRollups(query, from, now)
+	if err != nil {
+		return nil, err
+	}
+	return runDashboardQuery(query, rows), nil
+}
+
+// normalizeDashboardQuery 校验查询并填充默认值
+func normalizeDashboardQuery(query *DashboardQuery) error {
+	if len(query.Dimensions) > dashboardMaxDimensions {
+		return fmt.Errorf("最多选择 %d 个维度", dashboardMaxDimensions)
+	}
+	for i, dim := range query.Dimensions {
+		if !isDashboardField(dashboardDimensions, dim) {
+			return fmt.Errorf("不支持的维度: %s", dim)
+		}
+		if slices.Contains(query.Dimensions[:i], dim) {
+			return fmt.Errorf("维度重复: %s", dim)
+		}
+	}
+	if slices.Contains(query.Dimensions, DashboardDimDay) && slices.Contains(query.Dimensions, DashboardDimHour) {
+		return fmt.Errorf("日期与小时维度不能同时选择")
+	}
+	if len(query.Measures) == 0 {
+		return fmt.Errorf("至少选择一个指标")
+	}
+	for _, measure := range query.Measures {
+		if !isDashboardField(dashboardMeasures, measure) {
+			return fmt.Errorf("不支持的指标: %s", measure)
+		}
+	}
+	for key := range query.Filters {
+		if key != DashboardDimPlatform && key != DashboardDimProvider && key != DashboardDimModel {
+			return fmt.Errorf("不支持的过滤条件: %s（可选值: platform、provider、model）", key)
+		}
+	}
+	if query.OrderBy != "" && !slices.Contains(query.Dimensions, query.OrderBy) && !slices.Contains(query.Measures, query.OrderBy) {
+		return fmt.Errorf("排序字段必须是已选择的维度或指标: %s", query.OrderBy)
+	}
+	if query.Days <= 0 {
+		query.Days = 7
+	}
+	if query.Days > dashboardMaxDays {
+		return fmt.Errorf("查询范围最多 %d 天", dashboardMaxDays)
+	}
+	if query.Limit <= 0 {
+		query.Limit = dashboardDefaultLimit
+	}
+	if query.Limit > dashboardMaxLimit {
+		query.Limit = dashboardMaxLimit
+	}
+	return nil
+}
+
+func isDashboardField(fields []DashboardField, key string) bool {
+	for _, f := range fields {
+		if f.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDashboardRollups 读取查询范围内的汇总：按小时分组时只用小时汇总，否则已结束的日期用天汇总、之后用小时汇总
+func loadDashboardRollups(query DashboardQuery, from, to time.Time) ([]UsageRollup, error) {
+	platform := query.Filters[DashboardDimPlatform]
+	hourlyFrom := from
+	var rows []UsageRollup
+	if !slices.Contains(query.Dimensions, DashboardDimHour) {
+		if covered := rollupCoveredUntil(RollupGranularityDay); covered.After(from) {
+			daily, err := loadRollups(RollupGranularityDay, platform, from, covered)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, daily...)
+			hourlyFrom = covered
+		}
+	}
+	hourly, err := loadRollups(RollupGranularityHour, platform, hourlyFrom, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(rows, hourly...), nil
+}
+
+// dashboardAcc 一个分组的累加值
+type dashboardAcc struct {
+	dims    map[string]any
+	sum     UsageRollup
+	latency [5]float64 // 按成功请求数加权的 duration p50/p95/p99、ttft p50/p95
+}
+
+// runDashboardQuery 按维度分组并计算指标
+func runDashboardQuery(query DashboardQuery, rows []UsageRollup) *DashboardResult {
+	groups := map[string]*dashboardAcc{}
+	var order []string
+	for _, r := range rows {
+		if !dashboardRowMatches(query.Filters, r) {
+			continue
+		}
+		dims := make(map[string]any, len(query.Dimensions))
+		key := ""
+		for _, dim := range query.Dimensions {
+			value := dashboardDimValue(dim, r)
+			dims[dim] = value
+			key += value + "\x00"
+		}
+		acc := groups[key]
+		if acc == nil {
+			acc = &dashboardAcc{dims: dims}
+			groups[key] = acc
+			order = append(order, key)
+		}
+		acc.sum.Requests += r.Requests
+		acc.sum.Successes += r.Successes
+		acc.sum.Errors += r.Errors
+		acc.sum.InputTokens += r.InputTokens
+		acc.sum.OutputTokens += r.OutputTokens
+		acc.sum.ReasoningTokens += r.ReasoningTokens
+		acc.sum.CacheCreateTokens += r.CacheCreateTokens
+		acc.sum.CacheReadTokens += r.CacheReadTokens
+		acc.sum.Cost += r.Cost
+		weight := float64(r.Successes)
+		acc.latency[0] += r.DurationP50Ms * weight
+		acc.latency[1] += r.DurationP95Ms * weight
+		acc.latency[2] += r.DurationP99Ms * weight
+		acc.latency[3] += r.TTFTP50Ms * weight
+		acc.latency[4] += r.TTFTP95Ms * weight
+	}
+
+	result := &DashboardResult{
+		Columns: append(append([]string{}, query.Dimensions...), query.Measures...),
+		Rows:    make([]map[string]any, 0, len(order)),
+	}
+	for _, key := range order {
+		acc := groups[key]
+		row := make(map[string]any, len(result.Columns))
+		for dim, value := range acc.dims {
+			row[dim] = value
+		}
+		for _, measure := range query.Measures {
+			row[measure] = acc.measure(measure)
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	sortDashboardRows(query, result.Rows)
+	if len(result.Rows) > query.Limit {
+		result.Rows = result.Rows[:query.Limit]
+		result.Truncated = true
+	}
+	return result
+}
+
+func dashboardRowMatches(filters map[string]string, r UsageRollup) bool {
+	for key, value := range filters {
+		if value != "" && dashboardDimValue(key, r) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func dashboardDimValue(dim string, r UsageRollup) string {
+	switch dim {
+	case DashboardDimPlatform:
+		return r.Platform
+	case DashboardDimProvider:
+		return r.Provider
+	case DashboardDimModel:
+		return r.Model
+	case DashboardDimDay:
+		return time.Unix(r.BucketStart, 0).Format("2006-01-02")
+	case DashboardDimHour:
+		return time.Unix(r.BucketStart, 0).Format("2006-01-02 15:00")
+	}
+	return ""
+}
+
+func (acc *dashboardAcc) measure(key string) float64 {
+	s := acc.sum
+	weighted := func(i int) float64 {
+		if s.Successes == 0 {
+			return 0
+		}
+		return acc.latency[i] / float64(s.Successes)
+	}
+	switch key {
+	case "requests":
+		return float64(s.Requests)
+	case "successes":
+		return float64(s.Successes)
+	case "errors":
+		return float64(s.Errors)
+	case "error_rate":
+		if s.Requests == 0 {
+			return 0
+		}
+		return float64(s.Errors) / float64(s.Requests)
+	case "cost":
+		return s.Cost
+	case "input_tokens":
+		return float64(s.InputTokens)
+	case "output_tokens":
+		return float64(s.OutputTokens)
+	case "reasoning_tokens":
+		return float64(s.ReasoningTokens)
+	case "cache_create_tokens":
+		return float64(s.CacheCreateTokens)
+	case "cache_read_tokens":
+		return float64(s.CacheReadTokens)
+	case "total_tokens":
+		return float64(s.InputTokens + s.OutputTokens + s.ReasoningTokens + s.CacheCreateTokens + s.CacheReadTokens)
+	case "latency_p50_ms":
+		return weighted(0)
+	case "latency_p95_ms":
+		return weighted(1)
+	case "latency_p99_ms":
+		return weighted(2)
+	case "ttft_p50_ms":
+		return weighted(3)
+	case "ttft_p95_ms":
+		return weighted(4)
+	}
+	return 0
+}
+
+// sortDashboardRows 排序：指定了 OrderBy 时按该字段；否则有时间维度时按时间升序，没有时按第一个指标降序
+func sortDashboardRows(query DashboardQuery, rows []map[string]any) {
+	orderBy, desc := query.OrderBy, query.Desc
+	if orderBy == "" {
+		switch {
+		case slices.Contains(query.Dimensions, DashboardDimDay):
+			orderBy = DashboardDimDay
+		case slices.Contains(query.Dimensions, DashboardDimHour):
+			orderBy = DashboardDimHour
+		default:
+			orderBy, desc = query.Measures[0], true
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		c := compareDashboardValues(rows[i][orderBy], rows[j][orderBy])
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+func compareDashboardValues(a, b any) int {
+	switch av := a.(type) {
+	case float64:
+		bv, _ := b.(float64)
+		return cmp.Compare(av, bv)
+	case string:
+		bv, _ := b.(string)
+		return strings.Compare(av, bv)
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunDashboardQuery(t *testing.T) {
+	day1 := time.Date(2025, 3, 10, 0, 0, 0, 0, time.Local).Unix()
+	day2 := time.Date(2025, 3, 11, 0, 0, 0, 0, time.Local).Unix()
+	rows := []UsageRollup{
+		{BucketStart: day1, Platform: "claude", Provider: "A", Model: "m1", Requests: 10, Successes: 8, Errors: 2, Cost: 1, DurationP95Ms: 1000},
+		{BucketStart: day1, Platform: "claude", Provider: "B", Model: "m1", Requests: 5, Successes: 5, Cost: 2, DurationP95Ms: 4000},
+		{BucketStart: day2, Platform: "claude", Provider: "A", Model: "m2", Requests: 4, Successes: 2, Errors: 2, Cost: 0.5, DurationP95Ms: 3000},
+		{BucketStart: day2, Platform: "codex", Provider: "C", Model: "m3", Requests: 100, Successes: 100, Cost: 10},
+	}
+
+	query := DashboardQuery{
+		Dimensions: []string{DashboardDimProvider},
+		Measures:   []string{"requests", "error_rate", "latency_p95_ms"},
+		Filters:    map[string]string{DashboardDimPlatform: "claude"},
+	}
+	if err := normalizeDashboardQuery(&query); err != nil {
+		t.Fatalf("查询应有效: %v", err)
+	}
+	result := runDashboardQuery(query, rows)
+	if len(result.Rows) != 2 {
+		t.Fatalf("过滤 claude 后应有 2 个 provider，得到 %d", len(result.Rows))
+	}
+	// 未指定排序时按第一个指标降序
+	first := result.Rows[0]
+	if first["provider"] != "A" || first["requests"] != 14.0 {
+		t.Fatalf("第一行应为 A（14 个请求），得到 %+v", first)
+	}
+	if rate := first["error_rate"].(float64); rate < 0.285 || rate > 0.286 {
+		t.Errorf("错误率应为 4/14，得到 %v", rate)
+	}
+	// 按成功请求数加权：(1000*8 + 3000*2) / 10
+	if p95 := first["latency_p95_ms"].(float64); p95 != 1400 {
+		t.Errorf("加权 P95 应为 1400，得到 %v", p95)
+	}
+
+	byDay := DashboardQuery{Dimensions: []string{DashboardDimDay}, Measures: []string{"cost"}, Limit: 1}
+	if err := normalizeDashboardQuery(&byDay); err != nil {
+		t.Fatalf("查询应有效: %v", err)
+	}
+	result = runDashboardQuery(byDay, rows)
+	if len(result.Rows) != 1 || !result.Truncated || result.Rows[0]["day"] != "2025-03-10" || result.Rows[0]["cost"] != 3.0 {
+		t.Errorf("按日期应升序并截断为 1 行，得到 %+v truncated=%v", result.Rows, result.Truncated)
+	}
+}
+
+func TestNormalizeDashboardQuery(t *testing.T) {
+	invalid := []DashboardQuery{
+		{Measures: []string{"requests; DROP TABLE request_log"}},
+		{Dimensions: []string{"api_key"}, Measures: []string{"requests"}},
+		{Dimensions: []string{DashboardDimDay, DashboardDimHour}, Measures: []string{"requests"}},
+		{Dimensions: []string{DashboardDimProvider}},
+		{Measures: []string{"requests"}, Filters: map[string]string{"user": "x"}},
+		{Measures: []string{"requests"}, OrderBy: "cost"},
+		{Measures: []string{"requests"}, Days: dashboardMaxDays + 1},
+	}
+	for i, q := range invalid {
+		if err := normalizeDashboardQuery(&q); err == nil {
+			t.Errorf("第 %d 个查询应报错: %+v", i, q)
+		}
+	}
+}
@@ -17,13 +17,8 @@ import (
 // 4. 确保表结构存在
 // 5. 预热连接池
 func InitDatabase() error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("获取用户目录失败: %w", err)
-	}
-
-	// 1. 确保配置目录存在（SQLite 不会自动创建父目录）
-	configDir := filepath.Join(home, ".code-switch")
+	// 1. 确保配置目录存在（SQLite 不会自动创建父目录；用户目录只读时使用备用目录）
+	configDir := getConfigDir()
 	if err := os.MkdirAll(configDir, 0755); err != nil {
 		return fmt.Errorf("创建配置目录失败: %w", err)
 	}
@@ -59,17 +54,22 @@ func InitDatabase() error {
 	}
 	fmt.Printf("✅ SQLite PRAGMA 已设置: journal_mode=%s, busy_timeout=30000ms\n", journalMode)
 
+	// 3.3 团队服务器部署可将共享表（黑名单、日志、历史）存放到 PostgreSQL
+	initSharedStorage()
+
 	// 4. 确保表结构存在
-	if err := ensureRequestLogTable(); err != nil {
-		return fmt.Errorf("初始化 request_log 表失败: %w", err)
-	}
-	if err := ensureBlacklistTables(); err != nil {
-		return fmt.Errorf("初始化黑名单表失败: %w", err)
+	if err := ensureSchema(); err != nil {
+		return err
 	}
+	recordSchemaIntegrity()
 
 	// 5. 预热连接池：强制建立数据库连接，避免首次写入时失败
 	var count int
-	if err := db.QueryRow("SELECT COUNT(*) FROM request_log").Scan(&count); err != nil {
+	shared, err := sharedDB()
+	if err != nil {
+		return fmt.Errorf("获取共享表数据库连接失败: %w", err)
+	}
+	if err := shared.QueryRow("SELECT COUNT(*) FROM request_log").Scan(&count); err != nil {
 		fmt.Printf("⚠️  连接池预热查询失败: %v\n", err)
 	} else {
 		fmt.Printf("✅ 数据库连接已预热（request_log 记录数: %d）\n", count)
@@ -78,6 +78,59 @@ func InitDatabase() error {
 	return nil
 }
 
+// ensureSchema 确保所有表结构存在（幂等，启动自检的迁移修复也会调用）
+func ensureSchema() error {
+	if err := ensureRequestLogTable(); err != nil {
+		return fmt.Errorf("初始化 request_log 表失败: %w", err)
+	}
+	if err := ensureBlacklistTables(); err != nil {
+		return fmt.Errorf("初始化黑名单表失败: %w", err)
+	}
+	if err := ensureTranscriptTable(); err != nil {
+		return fmt.Errorf("初始化对话历史表失败: %w", err)
+	}
+	if err := ensureAuditTable(); err != nil {
+		return fmt.Errorf("初始化审计日志表失败: %w", err)
+	}
+	if err := ensureEndpointLatencyTable(); err != nil {
+		return fmt.Errorf("初始化端点延迟表失败: %w", err)
+	}
+	if err := ensureProviderEventTable(); err != nil {
+		return fmt.Errorf("初始化 provider 事件表失败: %w", err)
+	}
+	if err := ensureSLOBreachTable(); err != nil {
+		return fmt.Errorf("初始化 SLO 违约表失败: %w", err)
+	}
+	if err := ensureBatchTables(); err != nil {
+		return fmt.Errorf("初始化批量任务表失败: %w", err)
+	}
+	if err := ensureEmbeddingCacheTable(); err != nil {
+		return fmt.Errorf("初始化嵌入缓存表失败: %w", err)
+	}
+	if err := ensureFeedbackTable(); err != nil {
+		return fmt.Errorf("初始化请求反馈表失败: %w", err)
+	}
+	if err := ensureAnnotationTable(); err != nil {
+		return fmt.Errorf("初始化请求备注表失败: %w", err)
+	}
+	if err := ensureRollupTable(); err != nil {
+		return fmt.Errorf("初始化请求汇总表失败: %w", err)
+	}
+	if err := ensureAdminTokenUsageTable(); err != nil {
+		return fmt.Errorf("初始化管理令牌使用记录表失败: %w", err)
+	}
+	if err := ensureCollectorTables(); err != nil {
+		return fmt.Errorf("初始化多机汇总表失败: %w", err)
+	}
+	if err := ensureProviderAliasTable(); err != nil {
+		return fmt.Errorf("初始化 provider 曾用名表失败: %w", err)
+	}
+	if err := migrateEpochTimestamps(); err != nil {
+		return fmt.Errorf("迁移时间格式失败: %w", err)
+	}
+	return nil
+}
+
 // ensureBlacklistTables 确保黑名单相关表存在
 func ensureBlacklistTables() error {
 	db, err := xdb.DB("default")
@@ -95,25 +148,40 @@ func ensureBlacklistTables() error {
 		return fmt.Errorf("创建 app_settings 表失败: %w", err)
 	}
 
-	// 2. 创建 provider_blacklist 表
+	// 2. 创建 provider_blacklist 表（共享表，可能位于 PostgreSQL）
+	shared, err := sharedDB()
+	if err != nil {
+		return fmt.Errorf("获取共享表数据库连接失败: %w", err)
+	}
 	const createBlacklistSQL = `CREATE TABLE IF NOT EXISTS provider_blacklist (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		platform TEXT NOT NULL,
 		provider_name TEXT NOT NULL,
 		failure_count INTEGER DEFAULT 0,
-		blacklisted_at DATETIME,
-		blacklisted_until DATETIME,
-		last_failure_at DATETIME,
+		blacklisted_at BIGINT,
+		blacklisted_until BIGINT,
+		last_failure_at BIGINT,
 		blacklist_level INTEGER DEFAULT 0,
-		last_recovered_at DATETIME,
+		last_recovered_at BIGINT,
 		last_degrade_hour INTEGER DEFAULT 0,
-		last_failure_window_start DATETIME,
+		last_failure_window_start BIGINT,
 		auto_recovered INTEGER DEFAULT 0,
+		provider_uid TEXT DEFAULT '',
 		UNIQUE(platform, provider_name)
 	)`
-	if _, err := db.Exec(createBlacklistSQL); err != nil {
+	if _, err := shared.Exec(sharedDialect().DDL(createBlacklistSQL)); err != nil {
 		return fmt.Errorf("创建 provider_blacklist 表失败: %w", err)
 	}
+	// 旧版本创建的表没有 provider_uid 列
+	exists, err := sharedDialect().ColumnExists(shared, "provider_blacklist", "provider_uid")
+	if err != nil {
+		return fmt.Errorf("检查 provider_blacklist 表结构失败: %w", err)
+	}
+	if !exists {
+		if _, err := shared.Exec(sharedDialect().DDL(`ALTER TABLE provider_blacklist ADD COLUMN provider_uid TEXT DEFAULT ''`)); err != nil {
+			return fmt.Errorf("添加 provider_uid 列失败: %w", err)
+		}
+	}
 
 	// 3. 确保 app_settings 中有默认的黑名单配置
 	defaultSettings := []struct {
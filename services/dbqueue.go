@@ -7,6 +7,7 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
@@ -16,12 +17,19 @@ import (
 	"github.com/daodao97/xgo/xdb"
 )
 
+// errDBQueueNotReady 数据库尚未初始化（启动阶段）时写入返回的错误
+var errDBQueueNotReady = errors.New("数据库正在初始化，请稍后重试")
+
 // GlobalDBQueue 全局单次写入队列（用于异构写入：blacklist、settings 等）
 var GlobalDBQueue *DBWriteQueue
 
 // GlobalDBQueueLogs 全局批量写入队列（仅用于 request_log 同构写入）
 var GlobalDBQueueLogs *DBWriteQueue
 
+// GlobalDBQueueShared 共享表（黑名单、审计、对话历史、反馈）的单次写入队列
+// SQLite 后端时与 GlobalDBQueue 为同一队列，PostgreSQL 后端时写入 PostgreSQL
+var GlobalDBQueueShared *DBWriteQueue
+
 // InitGlobalDBQueue 初始化全局队列（双队列架构）
 func InitGlobalDBQueue() error {
 	db, err := xdb.DB("default")
@@ -33,10 +41,20 @@ func InitGlobalDBQueue() error {
 	// 用途：blacklist、app_settings 等不同表、不同操作的写入
 	GlobalDBQueue = NewDBWriteQueue(db, 5000, false)
 
+	// 共享表所在的数据库（PostgreSQL 后端时与 default 不同）
+	shared, err := sharedDB()
+	if err != nil {
+		return fmt.Errorf("获取共享表数据库连接失败: %w", err)
+	}
+	GlobalDBQueueShared = GlobalDBQueue
+	if shared != db {
+		GlobalDBQueueShared = NewDBWriteQueue(shared, 5000, false)
+	}
+
 	// 队列 2：批量写入队列（启用批量，仅用于 request_log）
 	// 用途：高频 request_log INSERT（同表同操作，严格同构）
 	// 批量配置：50 条/批，100ms 超时提交
-	GlobalDBQueueLogs = NewDBWriteQueue(db, 5000, true)
+	GlobalDBQueueLogs = NewDBWriteQueue(shared, 5000, true)
 
 	return nil
 }
@@ -55,6 +73,13 @@ func ShutdownGlobalDBQueue(timeout time.Duration) error {
 		err2 = GlobalDBQueueLogs.Shutdown(timeout)
 	}
 
+	// 关闭共享表队列（与单次队列相同时已关闭）
+	if GlobalDBQueueShared != nil && GlobalDBQueueShared != GlobalDBQueue {
+		if err := GlobalDBQueueShared.Shutdown(timeout); err != nil && err1 == nil {
+			err1 = err
+		}
+	}
+
 	// 如果有任何一个队列关闭失败，返回错误
 	if err1 != nil {
 		return fmt.Errorf("单次队列关闭失败: %w", err1)
@@ -373,6 +398,10 @@ func (q *DBWriteQueue) commitBatch(tasks []*WriteTask) {
 // Exec 同步执行写入（阻塞直到完成，默认 30 秒超时）
 // 防御性设计：即使在高频路径误用，也有 30 秒兜底超时，避免永久阻塞
 func (q *DBWriteQueue) Exec(sql string, args ...interface{}) error {
+	// 窗口显示后才初始化数据库，此前的调用（如前端操作）直接返回错误
+	if q == nil {
+		return errDBQueueNotReady
+	}
 	// 先检查关闭状态
 	if q.closed.Load() {
 		return fmt.Errorf("写入队列已关闭")
@@ -411,6 +440,10 @@ func (q *DBWriteQueue) Exec(sql string, args ...interface{}) error {
 // ExecBatch 批量执行（异步，高吞吐量场景，默认 30 秒超时）
 // 防御性设计：即使误用，也有 30 秒兜底超时
 func (q *DBWriteQueue) ExecBatch(sql string, args ...interface{}) error {
+	// 窗口显示后才初始化数据库，此前的调用（如前端操作）直接返回错误
+	if q == nil {
+		return errDBQueueNotReady
+	}
 	// 先检查关闭状态
 	if q.closed.Load() {
 		return fmt.Errorf("写入队列已关闭")
@@ -452,6 +485,10 @@ func (q *DBWriteQueue) ExecBatch(sql string, args ...interface{}) error {
 
 // ExecCtx 支持 context 的写入（带超时控制）
 func (q *DBWriteQueue) ExecCtx(ctx context.Context, sql string, args ...interface{}) error {
+	// 窗口显示后才初始化数据库，此前的调用（如前端操作）直接返回错误
+	if q == nil {
+		return errDBQueueNotReady
+	}
 	// 先检查关闭状态
 	if q.closed.Load() {
 		return fmt.Errorf("写入队列已关闭")
@@ -487,6 +524,10 @@ func (q *DBWriteQueue) ExecCtx(ctx context.Context, sql string, args ...interfac
 
 // ExecBatchCtx 支持 context 的批量写入（带超时控制）
 func (q *DBWriteQueue) ExecBatchCtx(ctx context.Context, sql string, args ...interface{}) error {
+	// 窗口显示后才初始化数据库，此前的调用（如前端操作）直接返回错误
+	if q == nil {
+		return errDBQueueNotReady
+	}
 	// 先检查关闭状态
 	if q.closed.Load() {
 		return fmt.Errorf("写入队列已关闭")
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"github.com/daodao97/xgo/xrequest"
+)
+
+// maxUpstreamRedirects 转发上游请求时最多跟随的重定向次数
+const maxUpstreamRedirects = 10
+
+// errDomainNotAllowed 上游域名不在允许范围内
+var errDomainNotAllowed = errors.New("upstream domain not allowed")
+
+// matchDomain 判断主机名是否匹配域名规则：精确匹配，或 *.example.com 匹配任意子域名
+func matchDomain(host, pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// upstreamHost 解析地址中的主机名（小写，不含端口）
+func upstreamHost(rawURL string) (string, error) {
+	parsed, err := neturl.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Hostname() == "" {
+		return "", fmt.Errorf("%w: 无效的地址 %s", errDomainNotAllowed, rawURL)
+	}
+	return strings.ToLower(parsed.Hostname()), nil
+}
+
+// check 检查主机名是否被允许：先匹配拒绝列表，允许列表非空时必须命中
+func (c RelayDomainConfig) check(host string) error {
+	for _, pattern := range c.Deny {
+		if matchDomain(host, pattern) {
+			return fmt.Errorf("%w: %s 在拒绝列表中", errDomainNotAllowed, host)
+		}
+	}
+	if len(c.Allow) == 0 {
+		return nil
+	}
+	for _, pattern := range c.Allow {
+		if matchDomain(host, pattern) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s 不在允许列表中", errDomainNotAllowed, host)
+}
+
+// checkUpstreamURL 检查上游地址是否允许访问（管理员策略的域名白名单 + 中继设置的允许/拒绝列表）
+func checkUpstreamURL(rawURL string) error {
+	if !currentPolicy().AllowsURL(rawURL) {
+		return fmt.Errorf("%w: %s 不在管理员允许的域名范围内", errDomainNotAllowed, rawURL)
+	}
+	config := currentRelayConfig().Domains
+	if len(config.Allow) == 0 && len(config.Deny) == 0 {
+		return nil
+	}
+	host, err := upstreamHost(rawURL)
+	if err != nil {
+		return err
+	}
+	return config.check(host)
+}
+
+// checkUpstreamRedirect 作为 http.Client 的 CheckRedirect：重定向目标同样要通过域名检查
+func checkUpstreamRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxUpstreamRedirects {
+		return fmt.Errorf("重定向次数过多（%d 次）", len(via))
+	}
+	if err := checkUpstreamURL(req.URL.String()); err != nil {
+		return fmt.Errorf("拒绝重定向: %w", err)
+	}
+	return nil
+}
+
+// upstreamClient 转发请求使用的 HTTP 客户端（与 xrequest 默认客户端相同，另检查重定向目标、按 PAC 选择代理）
+// xrequest 会修改客户端的 Timeout，每次请求需使用新的客户端
+func upstreamClient() *http.Client {
+	client := xrequest.GetDefaultProxyClient()
+	client.CheckRedirect = checkUpstreamRedirect
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		transport.Proxy = relayProxy
+	}
+	return client
+}
+
+// validateDomainConfig 校验域名列表：只填写域名，不含协议、路径与端口
+func validateDomainConfig(config RelayDomainConfig) error {
+	for _, list := range [][]string{config.Allow, config.Deny} {
+		for _, pattern := range list {
+			domain := strings.TrimPrefix(strings.TrimSpace(pattern), "*.")
+			if domain == "" || strings.ContainsAny(domain, "/:*? ") {
+				return fmt.Errorf("无效的域名规则: %q（示例: api.example.com、*.example.com）", pattern)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package services
+
+import "testing"
+
+func TestRelayDomainConfigCheck(t *testing.T) {
+	config := RelayDomainConfig{
+		Allow: []string{"*.example.com", "api.anthropic.com"},
+		Deny:  []string{"mirror.example.com"},
+	}
+	tests := map[string]bool{
+		"api.example.com":       true,
+		"api.anthropic.com":     true,
+		"mirror.example.com":    false,
+		"api.anthroplc.com":     false,
+		"example.com.evil.test": false,
+	}
+	for host, allowed := range tests {
+		if err := config.check(host); (err == nil) != allowed {
+			t.Errorf("check(%q) = %v, want allowed=%v", host, err, allowed)
+		}
+	}
+	if err := (RelayDomainConfig{Deny: []string{"bad.test"}}).check("good.test"); err != nil {
+		t.Errorf("deny-only config should allow other domains: %v", err)
+	}
+	if err := validateDomainConfig(RelayDomainConfig{Allow: []string{"https://api.example.com"}}); err == nil {
+		t.Error("domain rule with scheme should be rejected")
+	}
+}
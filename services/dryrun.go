@@ -0,0 +1,214 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 试运行：请求照常经过筛选、选路、护栏、模型映射与降级（包括故障注入），但在发往上游前停止，
+// 记录最终要转发的地址、请求头与请求体（按脱敏规则处理后），并向客户端返回对应格式的模拟响应。
+// 用于在真实客户端流量上验证新的路由与脱敏规则而不消耗 token。
+// 全局开关仅在内存中生效并带有效期，避免忘记关闭；单个请求也可以通过 X-CodeSwitch-Dry-Run 请求头试运行。
+// 试运行请求不写入 request_log，不参与 beta 请求头统计。
+
+const (
+	// DryRunHeader 单个请求的试运行标记（值为 1 或 true）
+	DryRunHeader = "X-CodeSwitch-Dry-Run"
+
+	// dryRunDefaultDuration 试运行默认有效期
+	dryRunDefaultDuration = 30 * time.Minute
+	// dryRunMaxDuration 试运行最长有效期
+	dryRunMaxDuration = 24 * time.Hour
+	// dryRunMaxRecords 保留的试运行记录数
+	dryRunMaxRecords = 200
+	// dryRunMaxBodyBytes 记录中保留的请求体长度
+	dryRunMaxBodyBytes = 64 << 10
+)
+
+// DryRunStatus 试运行状态
+type DryRunStatus struct {
+	Enabled   bool  `json:"enabled"`
+	ExpiresAt int64 `json:"expiresAt,omitempty"` // 过期时间（毫秒）
+	Simulated int   `json:"simulated"`           // 本次开启后模拟的请求数
+}
+
+// DryRunRecord 一次试运行请求：最终会发往上游的内容
+type DryRunRecord struct {
+	Time      int64             `json:"time"` // 毫秒
+	Platform  string            `json:"platform"`
+	Provider  string            `json:"provider"`
+	Model     string            `json:"model"`
+	URL       string            `json:"url"`
+	Stream    bool              `json:"stream"`
+	Attempt   int               `json:"attempt"` // 第几次尝试（从 1 开始，大于 1 表示经过降级）
+	Headers   map[string]string `json:"headers"` // 密钥类请求头只保留前几位
+	BodyBytes int               `json:"bodyBytes"`
+	Body      string            `json:"body"`      // 按脱敏规则处理后的请求体
+	Masked    bool              `json:"masked"`    // 脱敏规则是否修改了请求体
+	Truncated bool              `json:"truncated"` // 请求体超过 64KB 已截断
+}
+
+// dryRunRequest 试运行时停在上游之前的请求
+type dryRunRequest struct {
+	kind     string
+	provider string
+	model    string
+	url      string
+	headers  map[string]string
+	body     []byte
+	stream   bool
+	attempt  int
+}
+
+// dryRunRecorder 试运行开关与最近的记录
+type dryRunRecorder struct {
+	mu        sync.Mutex
+	until     time.Time
+	simulated int
+	records   []DryRunRecord
+}
+
+func newDryRunRecorder() *dryRunRecorder {
+	return &dryRunRecorder{}
+}
+
+func (d *dryRunRecorder) active(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return now.Before(d.until)
+}
+
+func (d *dryRunRecorder) add(record DryRunRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.simulated++
+	d.records = append(d.records, record)
+	if len(d.records) > dryRunMaxRecords {
+		d.records = d.records[len(d.records)-dryRunMaxRecords:]
+	}
+}
+
+// isDryRun 本次请求是否试运行
+func (prs *ProviderRelayService) isDryRun(c *gin.Context) bool {
+	if enabled, err := strconv.ParseBool(c.GetHeader(DryRunHeader)); err == nil && enabled {
+		return true
+	}
+	return prs.dryRun.active(time.Now())
+}
+
+// simulateRequest 记录试运行请求并返回模拟响应
+func (prs *ProviderRelayService) simulateRequest(c *gin.Context, req dryRunRequest, start time.Time) {
+	body := string(req.body)
+	truncated := len(body) > dryRunMaxBodyBytes
+	if truncated {
+		cut := dryRunMaxBodyBytes
+		for cut > 0 && !utf8.RuneStart(body[cut]) {
+			cut--
+		}
+		body = body[:cut]
+	}
+	masked := maskForStorage(body)
+	prs.dryRun.add(DryRunRecord{
+		Time:      time.Now().UnixMilli(),
+		Platform:  req.kind,
+		Provider:  req.provider,
+		Model:     req.model,
+		URL:       maskForStorage(req.url),
+		Stream:    req.stream,
+		Attempt:   req.attempt + 1,
+		Headers:   redactDryRunHeaders(req.headers),
+		BodyBytes: len(req.body),
+		Body:      masked,
+		Masked:    masked != body,
+		Truncated: truncated,
+	})
+	fmt.Printf("[DRY-RUN] 🧪 %s 请求已路由到 %s（模型 %s，第 %d 次尝试），未转发: %s\n",
+		req.kind, req.provider, req.model, req.attempt+1, req.url)
+
+	text := fmt.Sprintf("[Code Switch 试运行] 请求已路由到 %s（模型 %s），未转发到上游。", req.provider, req.model)
+	setAttributionHeaders(c, req.provider, time.Since(start), req.attempt)
+	c.Header(DryRunHeader, "1")
+	_ = writeStubResponse(c, req.kind, req.model, []string{text}, req.stream, 0)
+}
+
+// redactDryRunHeaders 复制请求头，隐藏密钥
+func redactDryRunHeaders(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for key, value := range headers {
+		switch http.CanonicalHeaderKey(key) {
+		case "Authorization", "X-Api-Key", "X-Goog-Api-Key", "Cookie":
+			value = redactSecret(value)
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// SetDryRun 开启或关闭试运行（供前端调用）；durationMinutes 为 0 时使用默认 30 分钟
+func (prs *ProviderRelayService) SetDryRun(enabled bool, durationMinutes int) (*DryRunStatus, error) {
+	duration := time.Duration(durationMinutes) * time.Minute
+	if duration <= 0 {
+		duration = dryRunDefaultDuration
+	}
+	if duration > dryRunMaxDuration {
+		return nil, fmt.Errorf("试运行有效期不能超过 %d 分钟", int(dryRunMaxDuration.Minutes()))
+	}
+
+	prs.dryRun.mu.Lock()
+	if enabled {
+		prs.dryRun.until = time.Now().Add(duration)
+		prs.dryRun.simulated = 0
+	} else {
+		prs.dryRun.until = time.Time{}
+	}
+	prs.dryRun.mu.Unlock()
+
+	if enabled {
+		fmt.Printf("[DRY-RUN] 🧪 已开启试运行，有效期 %s：请求不会转发到上游\n", duration)
+		recordAudit("dryrun", "enable", fmt.Sprintf("有效期 %s", duration))
+	} else {
+		fmt.Printf("[DRY-RUN] 已关闭试运行\n")
+		recordAudit("dryrun", "disable", "")
+	}
+	status := prs.GetDryRunStatus()
+	return &status, nil
+}
+
+// GetDryRunStatus 获取试运行状态（供前端调用）
+func (prs *ProviderRelayService) GetDryRunStatus() DryRunStatus {
+	prs.dryRun.mu.Lock()
+	defer prs.dryRun.mu.Unlock()
+	status := DryRunStatus{Simulated: prs.dryRun.simulated}
+	if time.Now().Before(prs.dryRun.until) {
+		status.Enabled = true
+		status.ExpiresAt = prs.dryRun.until.UnixMilli()
+	}
+	return status
+}
+
+// GetDryRunRecords 获取最近的试运行记录，新记录在前（供前端调用）
+func (prs *ProviderRelayService) GetDryRunRecords(limit int) []DryRunRecord {
+	prs.dryRun.mu.Lock()
+	defer prs.dryRun.mu.Unlock()
+	if limit <= 0 || limit > len(prs.dryRun.records) {
+		limit = len(prs.dryRun.records)
+	}
+	records := make([]DryRunRecord, 0, limit)
+	for i := len(prs.dryRun.records) - 1; i >= 0 && len(records) < limit; i-- {
+		records = append(records, prs.dryRun.records[i])
+	}
+	return records
+}
+
+// ClearDryRunRecords 清空试运行记录（供前端调用）
+func (prs *ProviderRelayService) ClearDryRunRecords() {
+	prs.dryRun.mu.Lock()
+	defer prs.dryRun.mu.Unlock()
+	prs.dryRun.records = nil
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRedactDryRunHeaders(t *testing.T) {
+	headers := redactDryRunHeaders(map[string]string{
+		"Authorization": "Bearer sk-1234567890abcdef",
+		"x-api-key":     "sk-ant-1234567890",
+		"Content-Type":  "application/json",
+	})
+	if headers["Authorization"] != "Bearer***" || headers["x-api-key"] != "sk-ant***" {
+		t.Errorf("密钥类请求头应隐藏: %v", headers)
+	}
+	if headers["Content-Type"] != "application/json" {
+		t.Errorf("普通请求头应保留: %v", headers)
+	}
+}
+
+func TestDryRunRecorder(t *testing.T) {
+	recorder := newDryRunRecorder()
+	now := time.Now()
+	if recorder.active(now) {
+		t.Fatal("默认不应处于试运行")
+	}
+	recorder.until = now.Add(time.Minute)
+	if !recorder.active(now) || recorder.active(now.Add(2*time.Minute)) {
+		t.Error("试运行应在有效期内生效、过期后失效")
+	}
+
+	for i := 0; i < dryRunMaxRecords+5; i++ {
+		recorder.add(DryRunRecord{Attempt: i})
+	}
+	if len(recorder.records) != dryRunMaxRecords || recorder.records[0].Attempt != 5 {
+		t.Errorf("应只保留最近 %d 条记录，得到 %d 条，最早为 %d", dryRunMaxRecords, len(recorder.records), recorder.records[0].Attempt)
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 编辑器扩展接口：扩展读取 ~/.code-switch/editor.json 获得地址与令牌，
+// 通过 GET /editor/state 获取各平台当前 provider 与健康状态，POST /editor/switch 切换；
+// 启用 socket 时还会在本地 socket 上推送状态变化（每行一个 JSON 事件），扩展无需轮询。
+// 令牌在每次启用时重新生成，只能从本机访问。
+
+const (
+	editorDiscoveryFileName = "editor.json"
+	editorSocketFileName    = "editor.sock"
+	editorPollInterval      = 2 * time.Second
+)
+
+// provider 健康标记
+const (
+	EditorHealthOK           = "ok"
+	EditorHealthDisabled     = "disabled"      // 未启用
+	EditorHealthBlacklisted  = "blacklisted"   // 已拉黑
+	EditorHealthAuthDisabled = "auth_disabled" // 连续 401 已停用
+	EditorHealthIncident     = "incident"      // 平台级故障中
+)
+
+// EditorProviderBadge 编辑器显示的 provider 状态
+type EditorProviderBadge struct {
+	Name             string `json:"name"`
+	Enabled          bool   `json:"enabled"`
+	Level            int    `json:"level"`
+	Health           string `json:"health"`
+	BlacklistedUntil string `json:"blacklistedUntil,omitempty"`
+}
+
+// EditorPlatformState 单个平台的状态
+type EditorPlatformState struct {
+	Current   string                `json:"current"`            // 当前 provider（优先级最高的已启用 provider）
+	LastUsed  string                `json:"lastUsed,omitempty"` // 最近一次实际处理请求的 provider
+	Incident  bool                  `json:"incident"`           // 平台级故障中
+	Providers []EditorProviderBadge `json:"providers"`
+}
+
+// EditorState GET /editor/state 的响应，也是 socket 事件的内容
+type EditorState struct {
+	Offline   bool                           `json:"offline"`
+	Platforms map[string]EditorPlatformState `json:"platforms"`
+}
+
+// EditorSwitchRequest POST /editor/switch 的请求
+type EditorSwitchRequest struct {
+	Platform string `json:"platform"`
+	Provider string `json:"provider"`
+}
+
+// EditorEvent socket 推送的事件
+type EditorEvent struct {
+	Event string      `json:"event"` // state
+	Data  EditorState `json:"data"`
+}
+
+// editorDiscovery 写入 editor.json 的连接信息
+type editorDiscovery struct {
+	URL    string `json:"url"`
+	Token  string `json:"token"`
+	Socket string `json:"socket,omitempty"`
+	PID    int    `json:"pid"`
+}
+
+// registerEditorRoutes 注册编辑器接口（默认关闭，需在 relay-config.json 的 editor 中启用）
+func (prs *ProviderRelayService) registerEditorRoutes(router gin.IRouter) {
+	editor := router.Group("/editor", prs.editorAuth())
+	editor.GET("/state", func(c *gin.Context) {
+		c.JSON(http.StatusOK, prs.editorState())
+	})
+	editor.POST("/switch", func(c *gin.Context) {
+		var req EditorSwitchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求"})
+			return
+		}
+		if err := prs.switchProviderByName(req.Platform, req.Provider); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit("editor", "switch_provider", fmt.Sprintf("切换 %s 到 %s", req.Platform, req.Provider))
+		c.JSON(http.StatusOK, prs.editorState())
+	})
+}
+
+// editorAuth 只允许本机请求并校验令牌；未启用时返回 404，与未注册路由一致
+func (prs *ProviderRelayService) editorAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, _ := prs.editorToken.Load().(string)
+		if !currentRelayConfig().Editor.Enabled || token == "" {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "editor api disabled"})
+			return
+		}
+		if !isLoopbackRequest(c.Request) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "editor api is local only"})
+			return
+		}
+		presented := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid editor token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// editorState 汇总各平台当前 provider 与健康状态
+func (prs *ProviderRelayService) editorState() EditorState {
+	state := EditorState{Offline: prs.isOffline(), Platforms: map[string]EditorPlatformState{}}
+	incidents := map[string]bool{}
+	for _, incident := range prs.blacklistService.GetPlatformIncidents() {
+		incidents[incident.Platform] = true
+	}
+	lastUsed := prs.GetAllLastUsedProviders()
+
+	for _, platform := range []string{"claude", "codex", "gemini"} {
+		platformState := EditorPlatformState{Incident: incidents[platform], Providers: []EditorProviderBadge{}}
+		if used := lastUsed[platform]; used != nil {
+			platformState.LastUsed = used.ProviderName
+		}
+		currentLevel := 0
+		appendBadge := func(name string, enabled bool, level int, authDisabled bool) {
+			if level <= 0 {
+				level = 1
+			}
+			badge := EditorProviderBadge{Name: name, Enabled: enabled, Level: level, Health: EditorHealthOK}
+			switch blacklisted, until := prs.blacklistService.IsBlacklisted(platform, name); {
+			case !enabled:
+				badge.Health = EditorHealthDisabled
+			case blacklisted:
+				badge.Health = EditorHealthBlacklisted
+				badge.BlacklistedUntil = until.Format(timeLayout)
+			case authDisabled:
+				badge.Health = EditorHealthAuthDisabled
+			case platformState.Incident:
+				badge.Health = EditorHealthIncident
+			}
+			// 切换后的 provider 排在最前且优先级最高
+			if enabled && (currentLevel == 0 || level < currentLevel) {
+				platformState.Current, currentLevel = name, level
+			}
+			platformState.Providers = append(platformState.Providers, badge)
+		}
+
+		switch platform {
+		case "claude", "codex":
+			providers, err := prs.providerService.snapshotProviders(platform)
+			if err != nil {
+				continue
+			}
+			for _, p := range providers {
+				appendBadge(p.Name, p.Enabled, p.Level, p.IsAuthDisabled())
+			}
+		case "gemini":
+			if prs.geminiService == nil {
+				continue
+			}
+			for _, p := range prs.geminiService.GetProviders() {
+				appendBadge(p.Name, p.Enabled, p.Level, false)
+			}
+		}
+		state.Platforms[platform] = platformState
+	}
+	return state
+}
+
+// EditorCompanionService 编辑器接口的后台服务：按配置生成令牌、写入连接信息并推送状态变化
+type EditorCompanionService struct {
+	relay    *ProviderRelayService
+	mu       sync.Mutex
+	active   bool
+	listener net.Listener
+	clients  map[net.Conn]struct{}
+	last     []byte // 最近一次推送的状态
+	running  bool   // Stop 之后仍在执行的一轮不再重新启用接口
+}
+
+// NewEditorCompanionService 创建编辑器接口服务
+func NewEditorCompanionService(relay *ProviderRelayService) *EditorCompanionService {
+	return &EditorCompanionService{relay: relay, clients: make(map[net.Conn]struct{})}
+}
+
+// Start 注册后台任务（按配置启用或关闭接口）
+func (es *EditorCompanionService) Start() error {
+	es.mu.Lock()
+	es.running = true
+	es.mu.Unlock()
+
+	scheduleJob(backgroundJob{
+		name:     "editor_companion",
+		title:    "编辑器接口状态同步",
+		interval: func() time.Duration { return editorPollInterval },
+		run: func() error {
+			es.tick()
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止后台任务并删除连接信息
+func (es *EditorCompanionService) Stop() error {
+	unscheduleJob("editor_companion")
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.running = false
+	es.deactivateLocked()
+	return nil
+}
+
+// tick 同步启用状态并推送状态变化
+func (es *EditorCompanionService) tick() {
+	config := currentRelayConfig().Editor
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if !es.running {
+		return
+	}
+	if !config.Enabled {
+		if es.active {
+			es.deactivateLocked()
+		}
+		return
+	}
+	if !es.active {
+		if err := es.activateLocked(config.Socket); err != nil {
+			log.Printf("⚠️  启用编辑器接口失败: %v", err)
+			return
+		}
+	}
+	if es.listener == nil || len(es.clients) == 0 {
+		return
+	}
+	payload, err := editorEventLine(es.relay.editorState())
+	if err != nil || string(payload) == string(es.last) {
+		return
+	}
+	es.last = payload
+	for conn := range es.clients {
+		es.sendLocked(conn, payload)
+	}
+}
+
+// activateLocked 生成令牌、启动 socket 并写入 editor.json
+func (es *EditorCompanionService) activateLocked(withSocket bool) error {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(buf)
+
+	discovery := editorDiscovery{URL: editorBaseURL(es.relay.Addr()), Token: token, PID: os.Getpid()}
+	if withSocket {
+		socketPath := filepath.Join(getConfigDir(), editorSocketFileName)
+		// 清理上次异常退出遗留的 socket 文件
+		_ = os.Remove(socketPath)
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			log.Printf("⚠️  创建编辑器事件 socket 失败，仅提供 HTTP 接口: %v", err)
+		} else {
+			es.listener = listener
+			discovery.Socket = socketPath
+			go es.acceptLoop(listener)
+		}
+	}
+
+	if err := os.MkdirAll(getConfigDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(discovery, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 令牌仅当前用户可读
+	if err := AtomicWriteBytes(filepath.Join(getConfigDir(), editorDiscoveryFileName), data); err != nil {
+		return err
+	}
+	es.relay.editorToken.Store(token)
+	es.active = true
+	log.Printf("🧩 编辑器接口已启用: %s", discovery.URL)
+	return nil
+}
+
+// deactivateLocked 关闭 socket、作废令牌并删除 editor.json
+func (es *EditorCompanionService) deactivateLocked() {
+	if !es.active {
+		return
+	}
+	es.relay.editorToken.Store("")
+	if es.listener != nil {
+		_ = es.listener.Close()
+		_ = os.Remove(es.listener.Addr().String())
+		es.listener = nil
+	}
+	for conn := range es.clients {
+		_ = conn.Close()
+		delete(es.clients, conn)
+	}
+	es.last = nil
+	_ = os.Remove(filepath.Join(getConfigDir(), editorDiscoveryFileName))
+	es.active = false
+	log.Printf("🧩 编辑器接口已关闭")
+}
+
+// acceptLoop 接受 socket 连接，连接后立即推送一次当前状态
+func (es *EditorCompanionService) acceptLoop(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("⚠️  编辑器事件 socket 异常: %v", err)
+			}
+			return
+		}
+		payload, err := editorEventLine(es.relay.editorState())
+		es.mu.Lock()
+		if es.listener != listener {
+			es.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		es.clients[conn] = struct{}{}
+		if err == nil {
+			es.sendLocked(conn, payload)
+		}
+		es.mu.Unlock()
+		go es.watchClient(conn)
+	}
+}
+
+// watchClient 客户端断开时移除连接（客户端发送的内容被忽略）
+func (es *EditorCompanionService) watchClient(conn net.Conn) {
+	_, _ = io.Copy(io.Discard, conn)
+	es.mu.Lock()
+	delete(es.clients, conn)
+	es.mu.Unlock()
+	_ = conn.Close()
+}
+
+// sendLocked 写入一个事件，写入失败或过慢的客户端直接断开
+func (es *EditorCompanionService) sendLocked(conn net.Conn, payload []byte) {
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write(payload); err != nil {
+		_ = conn.Close()
+		delete(es.clients, conn)
+	}
+}
+
+// editorEventLine 生成一行 JSON 事件
+func editorEventLine(state EditorState) ([]byte, error) {
+	data, err := json.Marshal(EditorEvent{Event: "state", Data: state})
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// editorBaseURL 由中继监听地址生成本机访问地址
+func editorBaseURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://127.0.0.1:18100"
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEditorBaseURL(t *testing.T) {
+	cases := map[string]string{
+		":18100":          "http://127.0.0.1:18100",
+		"127.0.0.1:18100": "http://127.0.0.1:18100",
+		"0.0.0.0:19000":   "http://127.0.0.1:19000",
+		"[::1]:18100":     "http://[::1]:18100",
+	}
+	for addr, want := range cases {
+		if got := editorBaseURL(addr); got != want {
+			t.Errorf("editorBaseURL(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestEditorEventLine(t *testing.T) {
+	state := EditorState{Platforms: map[string]EditorPlatformState{
+		"claude": {Current: "A", Providers: []EditorProviderBadge{{Name: "A", Enabled: true, Level: 1, Health: EditorHealthOK}}},
+	}}
+	line, err := editorEventLine(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(line, []byte("\n")) || bytes.Count(line, []byte("\n")) != 1 {
+		t.Fatalf("每个事件应占一行: %q", line)
+	}
+	var event EditorEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != "state" || event.Data.Platforms["claude"].Current != "A" {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestEditorAuthRejectsForwardedLoopback(t *testing.T) {
+	config := DefaultRelayConfig()
+	config.Editor.Enabled = true
+	writeTestRelayConfig(t, config)
+
+	prs := &ProviderRelayService{}
+	prs.editorToken.Store("editor-token")
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/editor/state", prs.editorAuth(), func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	send := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/editor/state", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "127.0.0.1")
+		req.Header.Set("Authorization", "Bearer editor-token")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	if code := send("192.168.1.20:50000"); code != http.StatusForbidden {
+		t.Errorf("持有令牌的局域网主机伪造 X-Forwarded-For 也应返回 403，得到 %d", code)
+	}
+	if code := send("127.0.0.1:50000"); code != http.StatusOK {
+		t.Errorf("本机请求应放行，得到 %d", code)
+	}
+}
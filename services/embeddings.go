@@ -0,0 +1,396 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// embeddingCacheLastPrune 最近一次清理过期缓存的时间（UnixMilli），清理最多每小时一次
+var embeddingCacheLastPrune atomic.Int64
+
+// EmbeddingCacheStats 嵌入缓存统计
+type EmbeddingCacheStats struct {
+	Entries int `json:"entries"`
+}
+
+// ensureEmbeddingCacheTable 确保 embedding_cache 表存在
+func ensureEmbeddingCacheTable() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS embedding_cache (
+		cache_key TEXT PRIMARY KEY,
+		model TEXT,
+		embedding TEXT NOT NULL,
+		created_at BIGINT
+	)`
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("创建 embedding_cache 表失败: %w", err)
+	}
+	return nil
+}
+
+// embeddingInputs 拆分嵌入请求的 input，返回每个输入的原始 JSON 以及是否为单个输入
+// input 可以是字符串、字符串数组、token 数组或 token 数组的数组
+func embeddingInputs(body []byte) ([]string, bool) {
+	input := gjson.GetBytes(body, "input")
+	if !input.Exists() {
+		return nil, false
+	}
+	if !input.IsArray() {
+		return []string{input.Raw}, true
+	}
+	items := input.Array()
+	if len(items) == 0 {
+		return nil, false
+	}
+	// 纯数字数组是单个 token 化的输入
+	if items[0].Type == gjson.Number {
+		return []string{input.Raw}, true
+	}
+	inputs := make([]string, 0, len(items))
+	for _, item := range items {
+		inputs = append(inputs, item.Raw)
+	}
+	return inputs, false
+}
+
+// embeddingCacheKey 按模型、输出参数与输入内容生成缓存键
+func embeddingCacheKey(body []byte, model string, input string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		model,
+		gjson.GetBytes(body, "encoding_format").String(),
+		gjson.GetBytes(body, "dimensions").String(),
+		input,
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupEmbeddings 查询缓存，返回命中的向量（按缓存键）
+func lookupEmbeddings(keys []string, ttlDays int) map[string]string {
+	hits := make(map[string]string, len(keys))
+	cutoff := time.Now().AddDate(0, 0, -ttlDays).Unix()
+	for _, key := range keys {
+		records, err := xdb.New("embedding_cache").Selects(
+			xdb.WhereEq("cache_key", key),
+			xdb.WhereGte("created_at", cutoff),
+			xdb.Limit(1),
+		)
+		if err != nil {
+			if !isNoSuchTableErr(err) {
+				fmt.Printf("[WARN] 查询嵌入缓存失败: %v\n", err)
+			}
+			return hits
+		}
+		if len(records) > 0 {
+			hits[key] = records[0].GetString("embedding")
+		}
+	}
+	return hits
+}
+
+// storeEmbeddings 写入缓存，并按 TTL 清理过期条目
+func storeEmbeddings(model string, entries map[string]string, ttlDays int) {
+	if GlobalDBQueue == nil {
+		return
+	}
+	now := time.Now()
+	for key, embedding := range entries {
+		if err := GlobalDBQueue.Exec(
+			`INSERT OR REPLACE INTO embedding_cache (cache_key, model, embedding, created_at) VALUES (?, ?, ?, ?)`,
+			key, model, embedding, now.Unix(),
+		); err != nil {
+			fmt.Printf("[WARN] 写入嵌入缓存失败: %v\n", err)
+			return
+		}
+	}
+
+	last := embeddingCacheLastPrune.Load()
+	if now.Sub(time.UnixMilli(last)) < time.Hour || !embeddingCacheLastPrune.CompareAndSwap(last, now.UnixMilli()) {
+		return
+	}
+	cutoff := now.AddDate(0, 0, -ttlDays).Unix()
+	if err := GlobalDBQueue.Exec(`DELETE FROM embedding_cache WHERE created_at < ?`, cutoff); err != nil {
+		fmt.Printf("[WARN] 清理嵌入缓存失败: %v\n", err)
+	}
+}
+
+// embeddingProviders 选择处理嵌入请求的 provider
+// 配置了 embeddings.providers 时按配置顺序使用（不校验模型白名单，嵌入模型通常不在聊天白名单中），否则按 Level 顺序使用全部 codex provider
+func (prs *ProviderRelayService) embeddingProviders(model string, preferred []string) ([]Provider, error) {
+	providers, err := prs.providerService.snapshotProviders("codex")
+	if err != nil {
+		return nil, err
+	}
+
+	usable := func(p Provider) bool {
+		if !p.Enabled || p.APIURL == "" || p.APIKey == "" || p.IsAuthDisabled() || checkUpstreamURL(p.APIURL) != nil {
+			return false
+		}
+		if blacklisted, _ := prs.blacklistService.IsBlacklisted("codex", p.Name); blacklisted {
+			return false
+		}
+		if prs.isOffline() && !isLocalEndpoint(p.APIURL) {
+			return false
+		}
+		return true
+	}
+
+	selected := make([]Provider, 0, len(providers))
+	if len(preferred) > 0 {
+		for _, name := range preferred {
+			for _, p := range providers {
+				if p.Name == name && usable(p) {
+					selected = append(selected, p)
+					break
+				}
+			}
+		}
+		return selected, nil
+	}
+
+	for _, p := range providers {
+		if usable(p) && p.IsModelSupported(model) {
+			selected = append(selected, p)
+		}
+	}
+	sortProvidersByLevel(selected)
+	return selected, nil
+}
+
+// sortProvidersByLevel 按 Level 升序排序（未配置视为 Level 1），同级保持原顺序
+func sortProvidersByLevel(providers []Provider) {
+	level := func(p Provider) int {
+		if p.Level <= 0 {
+			return 1
+		}
+		return p.Level
+	}
+	for i := 1; i < len(providers); i++ {
+		for j := i; j > 0 && level(providers[j]) < level(providers[j-1]); j-- {
+			providers[j], providers[j-1] = providers[j-1], providers[j]
+		}
+	}
+}
+
+// embeddingsHandler 处理 OpenAI 兼容的嵌入请求：与聊天分开选路，并按输入缓存向量
+func (prs *ProviderRelayService) embeddingsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondRelayError(c, "embeddings", http.StatusBadRequest, "invalid request body", nil)
+			return
+		}
+		model := gjson.GetBytes(bodyBytes, "model").String()
+		inputs, single := embeddingInputs(bodyBytes)
+		if model == "" || len(inputs) == 0 {
+			respondRelayError(c, "embeddings", http.StatusBadRequest, "嵌入请求需要 model 和 input", nil)
+			return
+		}
+
+		config := currentRelayConfig().Embeddings
+		keys := make([]string, len(inputs))
+		for i, input := range inputs {
+			keys[i] = embeddingCacheKey(bodyBytes, model, input)
+		}
+
+		cached := map[string]string{}
+		if config.CacheEnabled {
+			cached = lookupEmbeddings(keys, config.CacheTTLDays)
+		}
+		// 只向上游请求未命中的输入（同一请求内重复的输入只请求一次）
+		var missing []int
+		pending := make(map[string]bool)
+		for i, key := range keys {
+			if _, ok := cached[key]; !ok && !pending[key] {
+				pending[key] = true
+				missing = append(missing, i)
+			}
+		}
+
+		usage := `{"prompt_tokens":0,"total_tokens":0}`
+		responseModel := model
+		if len(missing) > 0 {
+			upstreamBody := bodyBytes
+			if !single {
+				missingInputs := make([]json.RawMessage, len(missing))
+				for j, i := range missing {
+					missingInputs[j] = json.RawMessage(inputs[i])
+				}
+				upstreamBody, err = sjson.SetBytes(bodyBytes, "input", missingInputs)
+				if err != nil {
+					respondRelayError(c, "embeddings", http.StatusInternalServerError, fmt.Sprintf("构造嵌入请求失败: %v", err), nil)
+					return
+				}
+			}
+
+			respBody, err := prs.forwardEmbeddings(c, model, upstreamBody, config.Providers)
+			if err != nil {
+				respondRelayError(c, "embeddings", http.StatusBadGateway, err.Error(), nil)
+				return
+			}
+
+			fresh := make(map[string]string, len(missing))
+			for _, item := range gjson.GetBytes(respBody, "data").Array() {
+				index := int(item.Get("index").Int())
+				if index < 0 || index >= len(missing) {
+					continue
+				}
+				fresh[keys[missing[index]]] = item.Get("embedding").Raw
+			}
+			if len(fresh) != len(missing) {
+				respondRelayError(c, "embeddings", http.StatusBadGateway, fmt.Sprintf("上游返回 %d 个向量，期望 %d 个", len(fresh), len(missing)), nil)
+				return
+			}
+			for key, embedding := range fresh {
+				cached[key] = embedding
+			}
+			if config.CacheEnabled {
+				storeEmbeddings(model, fresh, config.CacheTTLDays)
+			}
+			if u := gjson.GetBytes(respBody, "usage"); u.Exists() {
+				usage = u.Raw
+			}
+			if m := gjson.GetBytes(respBody, "model").String(); m != "" {
+				responseModel = m
+			}
+		} else {
+			fmt.Printf("[INFO] 嵌入请求全部命中缓存（%d 个输入）\n", len(inputs))
+		}
+
+		var out bytes.Buffer
+		out.WriteString(`{"object":"list","data":[`)
+		for i, key := range keys {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			fmt.Fprintf(&out, `{"object":"embedding","index":%d,"embedding":%s}`, i, cached[key])
+		}
+		modelJSON, _ := json.Marshal(responseModel)
+		fmt.Fprintf(&out, `],"model":%s,"usage":%s}`, modelJSON, usage)
+
+		c.Header("X-CodeSwitch-Embedding-Cache", fmt.Sprintf("%d/%d", len(keys)-len(missing), len(keys)))
+		c.Data(http.StatusOK, "application/json", out.Bytes())
+	}
+}
+
+// forwardEmbeddings 依次尝试嵌入 provider，返回第一个成功的响应体
+func (prs *ProviderRelayService) forwardEmbeddings(c *gin.Context, model string, body []byte, preferred []string) ([]byte, error) {
+	providers, err := prs.embeddingProviders(model, preferred)
+	if err != nil {
+		return nil, fmt.Errorf("加载 provider 失败: %w", err)
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("没有可用的 provider 处理嵌入模型 '%s'", model)
+	}
+
+	client := &http.Client{Timeout: 2 * time.Minute, CheckRedirect: checkUpstreamRedirect, Transport: relayTransport}
+	var lastErr error
+	for _, provider := range providers {
+		respBody, err := prs.forwardEmbeddingsTo(c, prs.withCertPins("codex", provider, client), provider, model, body)
+		if err == nil {
+			return respBody, nil
+		}
+		fmt.Printf("[WARN] 嵌入请求 provider %s 失败: %v\n", provider.Name, err)
+		lastErr = err
+		if errors.Is(err, errClientAbort) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("所有 %d 个嵌入 provider 均失败，最后错误: %v", len(providers), lastErr)
+}
+
+func (prs *ProviderRelayService) forwardEmbeddingsTo(c *gin.Context, client *http.Client, provider Provider, model string, body []byte) ([]byte, error) {
+	releaseSlot, err := prs.acquireProviderSlot(c, "codex", provider)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseSlot()
+
+	effectiveModel := provider.GetEffectiveModel(model)
+	if effectiveModel != model {
+		if body, err = ReplaceModelInRequestBody(body, effectiveModel); err != nil {
+			return nil, err
+		}
+	}
+
+	requestLog := &ReqeustLog{
+		Platform:    "codex",
+		Provider:    provider.Name,
+		ProviderUID: provider.UID,
+		Model:       effectiveModel,
+		Project:     requestProject(c),
+	}
+	requestLog.Client, requestLog.clientProcess = identifyClient(c)
+	start := time.Now()
+	defer func() {
+		requestLog.DurationSec = time.Since(start).Seconds()
+		if err := saveRequestLog(requestLog); err != nil {
+			fmt.Printf("写入 request_log 失败: %v\n", err)
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, joinURL(provider.APIURL, "/embeddings"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if c.Request.Context().Err() != nil {
+			return nil, fmt.Errorf("%w: %v", errClientAbort, err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	requestLog.HttpCode = resp.StatusCode
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("upstream status %d", resp.StatusCode)
+	}
+	requestLog.InputTokens = int(gjson.GetBytes(respBody, "usage.prompt_tokens").Int())
+	return respBody, nil
+}
+
+// GetEmbeddingCacheStats 获取嵌入缓存统计（供前端调用）
+func (prs *ProviderRelayService) GetEmbeddingCacheStats() (*EmbeddingCacheStats, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, err
+	}
+	stats := &EmbeddingCacheStats{}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM embedding_cache`).Scan(&stats.Entries); err != nil {
+		if isNoSuchTableErr(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ClearEmbeddingCache 清空嵌入缓存（供前端调用）
+func (prs *ProviderRelayService) ClearEmbeddingCache() error {
+	return GlobalDBQueue.Exec(`DELETE FROM embedding_cache`)
+}
@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestEmbeddingInputs(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantInputs []string
+		wantSingle bool
+	}{
+		{"字符串", `{"input":"hello"}`, []string{`"hello"`}, true},
+		{"字符串数组", `{"input":["a","b"]}`, []string{`"a"`, `"b"`}, false},
+		{"token 数组", `{"input":[1,2,3]}`, []string{`[1,2,3]`}, true},
+		{"token 数组的数组", `{"input":[[1,2],[3]]}`, []string{`[1,2]`, `[3]`}, false},
+		{"缺少 input", `{"model":"m"}`, nil, false},
+		{"空数组", `{"input":[]}`, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs, single := embeddingInputs([]byte(tt.body))
+			if single != tt.wantSingle || len(inputs) != len(tt.wantInputs) {
+				t.Fatalf("embeddingInputs() = %v, %v, want %v, %v", inputs, single, tt.wantInputs, tt.wantSingle)
+			}
+			for i := range inputs {
+				if inputs[i] != tt.wantInputs[i] {
+					t.Errorf("inputs[%d] = %s, want %s", i, inputs[i], tt.wantInputs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 用户反馈评分
+const (
+	FeedbackThumbsUp   = 1
+	FeedbackThumbsDown = -1
+)
+
+// feedbackCommentMaxLength 反馈备注最大长度（字符）
+const feedbackCommentMaxLength = 500
+
+// ProviderFeedbackStat 单个 provider 的反馈汇总，与延迟、成本放在一起用于比较中转站质量
+type ProviderFeedbackStat struct {
+	Platform       string  `json:"platform"`
+	Provider       string  `json:"provider"`
+	ThumbsUp       int     `json:"thumbsUp"`
+	ThumbsDown     int     `json:"thumbsDown"`
+	Score          float64 `json:"score"`          // 好评占比（0-1），无反馈时为 0
+	FeedbackRate   float64 `json:"feedbackRate"`   // 有反馈的请求占比
+	TotalRequests  int     `json:"totalRequests"`  // 统计窗口内的请求数
+	SuccessRate    float64 `json:"successRate"`    // 统计窗口内的成功率
+	AvgDurationSec float64 `json:"avgDurationSec"` // 统计窗口内的平均耗时
+	CostTotal      float64 `json:"costTotal"`      // 统计窗口内的总成本
+}
+
+// ensureFeedbackTable 确保 request_feedback 表存在（每条请求日志最多一条反馈）
+func ensureFeedbackTable() error {
+	db, err := sharedDB()
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS request_feedback (
+		request_id INTEGER PRIMARY KEY,
+		platform TEXT,
+		provider TEXT,
+		model TEXT,
+		rating INTEGER NOT NULL,
+		comment TEXT,
+		created_at BIGINT
+	)`
+	if _, err := db.Exec(sharedDialect().DDL(createTableSQL)); err != nil {
+		return fmt.Errorf("创建 request_feedback 表失败: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_request_feedback_provider ON request_feedback(platform, provider, created_at)`); err != nil {
+		return fmt.Errorf("创建 request_feedback 索引失败: %w", err)
+	}
+	return nil
+}
+
+// SubmitFeedback 为一条请求日志打分（供前端调用）：rating 为 1（好评）、-1（差评），0 表示撤销反馈
+func (ls *LogService) SubmitFeedback(requestID int64, rating int, comment string) error {
+	if GlobalDBQueueShared == nil {
+		return fmt.Errorf("数据库队列未初始化")
+	}
+	if rating == 0 {
+		return GlobalDBQueueShared.Exec(`DELETE FROM request_feedback WHERE request_id = ?`, requestID)
+	}
+	if rating != FeedbackThumbsUp && rating != FeedbackThumbsDown {
+		return fmt.Errorf("无效的评分: %d（可选值: 1、-1、0）", rating)
+	}
+	// 备注是用户手写的文本，无论是否开启脱敏都去掉误贴的 API Key
+	comment = secretKeyPattern.ReplaceAllString(strings.TrimSpace(comment), "[API_KEY]")
+	if runes := []rune(comment); len(runes) > feedbackCommentMaxLength {
+		comment = string(runes[:feedbackCommentMaxLength])
+	}
+
+	record, err := sharedModel("request_log").First(
+		xdb.WhereEq("id", requestID),
+		xdb.Field("platform", "provider", "model"),
+	)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return fmt.Errorf("请求日志不存在: %d", requestID)
+		}
+		return err
+	}
+
+	return GlobalDBQueueShared.Exec(`
+		INSERT INTO request_feedback (request_id, platform, provider, model, rating, comment, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(request_id) DO UPDATE SET rating = excluded.rating, comment = excluded.comment, created_at = excluded.created_at
+	`, requestID, record.GetString("platform"), record.GetString("provider"), record.GetString("model"),
+		rating, maskForStorage(comment), epochNow())
+}
+
+// ProviderFeedbackStats 按 provider 汇总最近 days 天的反馈，并附带同一窗口的成功率、耗时与成本（供前端调用）
+func (ls *LogService) ProviderFeedbackStats(platform string, days int) ([]ProviderFeedbackStat, error) {
+	if days <= 0 {
+		days = 30
+	}
+	since := startOfDay(time.Now()).AddDate(0, 0, -(days - 1)).Unix()
+
+	statMap := map[string]*ProviderFeedbackStat{}
+	statFor := func(platform, provider string) *ProviderFeedbackStat {
+		provider = strings.TrimSpace(provider)
+		if provider == "" {
+			provider = "(unknown)"
+		}
+		key := platform + "/" + provider
+		stat := statMap[key]
+		if stat == nil {
+			stat = &ProviderFeedbackStat{Platform: platform, Provider: provider}
+			statMap[key] = stat
+		}
+		return stat
+	}
+
+	feedbackOptions := []xdb.Option{
+		xdb.WhereGte("created_at", since),
+		xdb.Field("platform", "provider", "rating"),
+	}
+	logOptions := []xdb.Option{
+		xdb.WhereGte("created_at", since),
+		xdb.Field(
+			"platform",
+			"provider",
+			"model",
+			"http_code",
+			"duration_sec",
+			"input_tokens",
+			"output_tokens",
+			"reasoning_tokens",
+			"cache_create_tokens",
+			"cache_read_tokens",
+		),
+	}
+	if platform != "" {
+		feedbackOptions = append(feedbackOptions, xdb.WhereEq("platform", platform))
+		logOptions = append(logOptions, xdb.WhereEq("platform", platform))
+	}
+
+	feedbacks, err := sharedModel("request_feedback").Selects(feedbackOptions...)
+	if err != nil && !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+		return nil, err
+	}
+	for _, record := range feedbacks {
+		stat := statFor(record.GetString("platform"), record.GetString("provider"))
+		switch record.GetInt("rating") {
+		case FeedbackThumbsUp:
+			stat.ThumbsUp++
+		case FeedbackThumbsDown:
+			stat.ThumbsDown++
+		}
+	}
+	if len(statMap) == 0 {
+		return []ProviderFeedbackStat{}, nil
+	}
+
+	logs, err := sharedModel("request_log").Selects(logOptions...)
+	if err != nil && !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+		return nil, err
+	}
+	successes := map[*ProviderFeedbackStat]int{}
+	durations := map[*ProviderFeedbackStat]float64{}
+	for _, record := range logs {
+		key := record.GetString("platform") + "/" + strings.TrimSpace(record.GetString("provider"))
+		stat := statMap[key]
+		if stat == nil {
+			// 只汇总有反馈的 provider
+			continue
+		}
+		stat.TotalRequests++
+		if code := record.GetInt("http_code"); code >= 200 && code < 300 {
+			successes[stat]++
+		}
+		durations[stat] += record.GetFloat64("duration_sec")
+		cost := ls.calculateCost(record.GetString("model"), modelpricing.UsageSnapshot{
+			InputTokens:       record.GetInt("input_tokens"),
+			OutputTokens:      record.GetInt("output_tokens"),
+			ReasoningTokens:   record.GetInt("reasoning_tokens"),
+			CacheCreateTokens: record.GetInt("cache_create_tokens"),
+			CacheReadTokens:   record.GetInt("cache_read_tokens"),
+		})
+		stat.CostTotal += cost.TotalCost
+	}
+
+	stats := make([]ProviderFeedbackStat, 0, len(statMap))
+	for _, stat := range statMap {
+		if rated := stat.ThumbsUp + stat.ThumbsDown; rated > 0 {
+			stat.Score = float64(stat.ThumbsUp) / float64(rated)
+			if stat.TotalRequests > 0 {
+				stat.FeedbackRate = float64(rated) / float64(stat.TotalRequests)
+			}
+		}
+		if stat.TotalRequests > 0 {
+			stat.SuccessRate = float64(successes[stat]) / float64(stat.TotalRequests)
+			stat.AvgDurationSec = durations[stat] / float64(stat.TotalRequests)
+		}
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Score == stats[j].Score {
+			return stats[i].Provider < stats[j].Provider
+		}
+		return stats[i].Score > stats[j].Score
+	})
+	return stats, nil
+}
+
+// attachFeedback 为请求日志填充用户反馈（查询失败时保持为 0，不影响日志列表）
+func attachFeedback(logs []ReqeustLog) {
+	if len(logs) == 0 {
+		return
+	}
+	ids := make([]any, 0, len(logs))
+	for _, entry := range logs {
+		ids = append(ids, entry.ID)
+	}
+	records, err := sharedModel("request_feedback").Selects(
+		xdb.WhereIn("request_id", ids),
+		xdb.Field("request_id", "rating"),
+	)
+	if err != nil {
+		return
+	}
+	ratings := make(map[int64]int, len(records))
+	for _, record := range records {
+		ratings[record.GetInt64("request_id")] = record.GetInt("rating")
+	}
+	for i := range logs {
+		logs[i].Feedback = ratings[logs[i].ID]
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+// insertFeedbackRequest 写入一条请求日志并返回其 ID
+func insertFeedbackRequest(t *testing.T, platform, provider string, httpCode int, durationSec float64) int64 {
+	t.Helper()
+	db, err := sharedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := db.Exec(`INSERT INTO request_log (platform, model, provider, http_code, duration_sec, created_at) VALUES (?, 'claude-sonnet-4-5', ?, ?, ?, ?)`,
+		platform, provider, httpCode, durationSec, epochNow())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// storedFeedback 读取请求的反馈记录，不存在时 found 为 false
+func storedFeedback(t *testing.T, requestID int64) (platform, provider, model string, rating int, comment string, found bool) {
+	t.Helper()
+	db, err := sharedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query(`SELECT platform, provider, model, rating, comment FROM request_feedback WHERE request_id = ?`, requestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", "", "", 0, "", false
+	}
+	if err := rows.Scan(&platform, &provider, &model, &rating, &comment); err != nil {
+		t.Fatal(err)
+	}
+	return platform, provider, model, rating, comment, true
+}
+
+func TestSubmitFeedback(t *testing.T) {
+	const key = "sk-ant-REDACTED"
+	tests := []struct {
+		name        string
+		masking     RelayMaskingConfig
+		rating      int
+		comment     string
+		wantComment string
+		wantErr     bool
+	}{
+		{name: "好评", rating: FeedbackThumbsUp, comment: "  回答很准确 \n", wantComment: "回答很准确"},
+		{name: "差评无备注", rating: FeedbackThumbsDown, wantComment: ""},
+		{name: "未开启脱敏时仍去掉 API Key", rating: FeedbackThumbsDown, comment: "用的 key 是 " + key + " 还是报错", wantComment: "用的 key 是 [API_KEY] 还是报错"},
+		{name: "开启脱敏时应用脱敏规则", masking: RelayMaskingConfig{Enabled: true, BuiltinRules: []string{MaskRuleEmail}}, rating: FeedbackThumbsDown, comment: "联系 dev@example.com，" + key, wantComment: "联系 [EMAIL]，[API_KEY]"},
+		{name: "备注超长时截断", rating: FeedbackThumbsUp, comment: strings.Repeat("好", feedbackCommentMaxLength+20), wantComment: strings.Repeat("好", feedbackCommentMaxLength)},
+		{name: "截断不会留下半截 Key", rating: FeedbackThumbsUp, comment: strings.Repeat("a", feedbackCommentMaxLength-10) + " " + key, wantComment: strings.Repeat("a", feedbackCommentMaxLength-10) + " [API_KEY]"},
+		{name: "无效评分", rating: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultRelayConfig()
+			config.Masking = tt.masking
+			writeTestRelayConfig(t, config)
+			newTestDatabase(t)
+			requestID := insertFeedbackRequest(t, "claude", "relay", 200, 1)
+
+			ls := NewLogService()
+			err := ls.SubmitFeedback(requestID, tt.rating, tt.comment)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("应返回错误")
+				}
+				if _, _, _, _, _, found := storedFeedback(t, requestID); found {
+					t.Error("失败的提交不应写入反馈")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SubmitFeedback() 失败: %v", err)
+			}
+			platform, provider, model, rating, comment, found := storedFeedback(t, requestID)
+			if !found {
+				t.Fatal("反馈未写入")
+			}
+			if platform != "claude" || provider != "relay" || model != "claude-sonnet-4-5" || rating != tt.rating {
+				t.Errorf("反馈应沿用请求日志的平台、provider 与模型: %s/%s/%s rating=%d", platform, provider, model, rating)
+			}
+			if comment != tt.wantComment {
+				t.Errorf("备注 = %q，期望 %q", comment, tt.wantComment)
+			}
+		})
+	}
+}
+
+func TestSubmitFeedbackUpdateAndRevoke(t *testing.T) {
+	writeTestRelayConfig(t, DefaultRelayConfig())
+	newTestDatabase(t)
+	requestID := insertFeedbackRequest(t, "claude", "relay", 200, 1)
+	ls := NewLogService()
+
+	if err := ls.SubmitFeedback(requestID+100, FeedbackThumbsUp, ""); err == nil || !strings.Contains(err.Error(), "请求日志不存在") {
+		t.Errorf("不存在的请求应返回错误，得到 %v", err)
+	}
+
+	// 再次提交覆盖原反馈
+	if err := ls.SubmitFeedback(requestID, FeedbackThumbsUp, "不错"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.SubmitFeedback(requestID, FeedbackThumbsDown, "其实有错"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, rating, comment, _ := storedFeedback(t, requestID); rating != FeedbackThumbsDown || comment != "其实有错" {
+		t.Errorf("再次提交应覆盖原反馈，得到 rating=%d comment=%q", rating, comment)
+	}
+	if n := countRows(t, "request_feedback", "request_id = ?", requestID); n != 1 {
+		t.Errorf("每条请求最多一条反馈，得到 %d", n)
+	}
+
+	logs := []ReqeustLog{{ID: requestID}, {ID: requestID + 1}}
+	attachFeedback(logs)
+	if logs[0].Feedback != FeedbackThumbsDown || logs[1].Feedback != 0 {
+		t.Errorf("attachFeedback() = %d / %d", logs[0].Feedback, logs[1].Feedback)
+	}
+
+	// 评分为 0 撤销反馈
+	if err := ls.SubmitFeedback(requestID, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, _, found := storedFeedback(t, requestID); found {
+		t.Error("撤销后反馈应被删除")
+	}
+}
+
+func TestProviderFeedbackStats(t *testing.T) {
+	writeTestRelayConfig(t, DefaultRelayConfig())
+	newTestDatabase(t)
+	ls := NewLogService()
+
+	// good: 3 次请求 2 次成功，2 好评；bad: 2 次请求，1 差评；quiet: 没有反馈，不参与汇总
+	good1 := insertFeedbackRequest(t, "claude", "good", 200, 1)
+	good2 := insertFeedbackRequest(t, "claude", "good", 200, 2)
+	insertFeedbackRequest(t, "claude", "good", 500, 3)
+	bad1 := insertFeedbackRequest(t, "claude", "bad", 502, 4)
+	insertFeedbackRequest(t, "claude", "bad", 200, 6)
+	insertFeedbackRequest(t, "claude", "quiet", 200, 1)
+	codex := insertFeedbackRequest(t, "codex", "good", 200, 1)
+	for id, rating := range map[int64]int{good1: FeedbackThumbsUp, good2: FeedbackThumbsUp, bad1: FeedbackThumbsDown, codex: FeedbackThumbsDown} {
+		if err := ls.SubmitFeedback(id, rating, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := ls.ProviderFeedbackStats("claude", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].Provider != "good" || stats[1].Provider != "bad" {
+		t.Fatalf("应只汇总有反馈的 provider 并按好评率排序: %+v", stats)
+	}
+	near := func(a, b float64) bool { return a-b < 1e-9 && b-a < 1e-9 }
+	good, bad := stats[0], stats[1]
+	if good.ThumbsUp != 2 || good.ThumbsDown != 0 || good.Score != 1 || good.TotalRequests != 3 ||
+		!near(good.FeedbackRate, 2.0/3) || !near(good.SuccessRate, 2.0/3) || !near(good.AvgDurationSec, 2) {
+		t.Errorf("good 汇总不符: %+v", good)
+	}
+	if bad.ThumbsDown != 1 || bad.Score != 0 || bad.TotalRequests != 2 ||
+		!near(bad.FeedbackRate, 0.5) || !near(bad.SuccessRate, 0.5) || !near(bad.AvgDurationSec, 5) {
+		t.Errorf("bad 汇总不符: %+v", bad)
+	}
+	if good.Platform != "claude" || bad.Platform != "claude" {
+		t.Errorf("按平台筛选时不应包含其他平台: %+v", stats)
+	}
+
+	all, err := ls.ProviderFeedbackStats("", 0)
+	if err != nil || len(all) != 3 {
+		t.Errorf("不筛选平台时应分别汇总各平台的 provider: %+v, %v", all, err)
+	}
+}
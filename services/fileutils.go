@@ -1,6 +1,7 @@
 package services
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -164,3 +165,45 @@ func FindLatestBackup(configPath string) (string, error) {
 
 	return latestPath, nil
 }
+
+// 损坏配置的恢复方式（RecoverEndpointsFile 的 action）
+const (
+	ConfigRecoveryRestore = "restore" // 从恢复点或有效的备份恢复
+	ConfigRecoveryReset   = "reset"   // 重新创建默认配置（损坏的文件已保留为 .bak）
+)
+
+// CorruptConfigError 配置文件无法解析：原文件保持不变并另存一份 .bak，由用户选择恢复方式
+type CorruptConfigError struct {
+	Path       string   `json:"path"`
+	BackupPath string   `json:"backupPath,omitempty"` // 损坏文件的副本
+	Reason     string   `json:"reason"`
+	Options    []string `json:"options"` // 可用的恢复方式：restore / reset
+}
+
+func (e *CorruptConfigError) Error() string {
+	msg := fmt.Sprintf("配置文件 %s 已损坏（%s）", e.Path, e.Reason)
+	if e.BackupPath != "" {
+		msg += fmt.Sprintf("，已另存为 %s", e.BackupPath)
+	}
+	return msg + "，请从备份恢复或重置为默认配置"
+}
+
+// MarshalJSON 前端据此展示恢复选项
+func (e *CorruptConfigError) MarshalJSON() ([]byte, error) {
+	type view CorruptConfigError
+	return json.Marshal(struct {
+		Kind    string `json:"kind"`
+		Message string `json:"message"`
+		*view
+	}{"corrupt_config", e.Error(), (*view)(e)})
+}
+
+// preserveCorruptFile 将损坏的文件另存为 .bak.<时间戳>；内容与最新备份相同时不重复保存
+func preserveCorruptFile(path string, data []byte) (string, error) {
+	if latest, err := FindLatestBackup(path); err == nil {
+		if existing, err := os.ReadFile(latest); err == nil && bytes.Equal(existing, data) {
+			return latest, nil
+		}
+	}
+	return CreateBackup(path)
+}
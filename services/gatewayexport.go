@@ -0,0 +1,325 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 导出到其他网关：把当前的 claude / codex provider 与降级顺序生成为 LiteLLM config.yaml 或 nginx / Caddy 反向代理配置，
+// 方便在无界面的服务器上部署相同的策略。与导入（gatewayimport.go）对称。
+// 默认不导出明文 Key，改为引用环境变量（LiteLLM os.environ/、Caddy {$VAR}、nginx 用 envsubst 替换）。
+// nginx / Caddy 只转发请求、不改写请求体，模型映射与白名单不会生效；需要这些功能时请导出 LiteLLM 配置。
+
+const (
+	GatewayExportNginx = "nginx"
+	GatewayExportCaddy = "caddy"
+)
+
+// GatewayExport 导出结果
+type GatewayExport struct {
+	Format   string   `json:"format"`
+	Filename string   `json:"filename"` // 建议的文件名
+	Content  string   `json:"content"`
+	EnvVars  []string `json:"envVars"`  // 部署时需要设置的环境变量（导出明文 Key 时为空）
+	Warnings []string `json:"warnings"` // 无法等价转换的设置
+}
+
+// exportedProvider 参与导出的 provider
+type exportedProvider struct {
+	platform string
+	provider Provider
+	keyRef   string // 环境变量名，导出明文 Key 时为空
+}
+
+// ExportGatewayConfig 将当前 provider 配置导出为 litellm / nginx / caddy 配置（供前端调用）
+// includeKeys 为 true 时写入明文 Key（受管理员策略 disableKeyExport 限制）
+func (ps *ProviderService) ExportGatewayConfig(format string, includeKeys bool) (*GatewayExport, error) {
+	if includeKeys && currentPolicy().DisableKeyExport {
+		recordAudit("provider", "export_keys_denied", fmt.Sprintf("导出 %s 配置：管理员策略已禁止导出 API Key", format))
+		return nil, fmt.Errorf("管理员策略已禁止导出 API Key")
+	}
+	export := &GatewayExport{Format: format, EnvVars: []string{}, Warnings: []string{}}
+	byPlatform := make(map[string][]exportedProvider)
+	for _, platform := range []string{"claude", "codex"} {
+		providers, err := ps.LoadProviders(platform)
+		if err != nil {
+			return nil, err
+		}
+		items, skipped := exportableProviders(platform, providers, includeKeys)
+		export.Warnings = append(export.Warnings, skipped...)
+		for _, item := range items {
+			if item.keyRef != "" {
+				export.EnvVars = append(export.EnvVars, item.keyRef)
+			}
+		}
+		byPlatform[platform] = items
+	}
+	if len(byPlatform["claude"]) == 0 && len(byPlatform["codex"]) == 0 {
+		return nil, fmt.Errorf("没有可导出的 provider（需已启用且配置了 API 地址与 Key）")
+	}
+
+	var err error
+	switch format {
+	case GatewayFormatLiteLLM:
+		export.Filename = "config.yaml"
+		export.Content, err = renderLiteLLMConfig(byPlatform)
+	case GatewayExportNginx:
+		export.Filename = "code-switch.conf"
+		export.Content = renderNginxConfig(byPlatform)
+		export.Warnings = append(export.Warnings, reverseProxyWarnings(byPlatform)...)
+	case GatewayExportCaddy:
+		export.Filename = "Caddyfile"
+		export.Content = renderCaddyConfig(byPlatform)
+		export.Warnings = append(export.Warnings, reverseProxyWarnings(byPlatform)...)
+		export.EnvVars = []string{}
+		for _, platform := range []string{"claude", "codex"} {
+			if items := byPlatform[platform]; len(items) > 0 && items[0].keyRef != "" {
+				export.EnvVars = append(export.EnvVars, items[0].keyRef)
+			}
+			if len(byPlatform[platform]) > 1 {
+				export.Warnings = append(export.Warnings, fmt.Sprintf("Caddy 无法为不同上游设置不同的 Key，%s 只转发到第一个 provider，其余 provider 以注释列出", platform))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("不支持的导出格式: %s（可选值: litellm、nginx、caddy）", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if includeKeys {
+		recordAudit("provider", "export_keys", fmt.Sprintf("导出包含明文 API Key 的 %s 配置", format))
+	}
+	return export, nil
+}
+
+// exportableProviders 按降级顺序（Level 升序）列出可导出的 provider，返回无法导出的原因
+func exportableProviders(platform string, providers []Provider, includeKeys bool) ([]exportedProvider, []string) {
+	var items []exportedProvider
+	var skipped []string
+	for _, p := range providers {
+		switch {
+		case !p.Enabled:
+			continue
+		case len(p.SplitRoutes) > 0:
+			skipped = append(skipped, fmt.Sprintf("%s/%s 是模型分流的虚拟 provider，未导出", platform, p.Name))
+			continue
+		case p.isMockProvider():
+			skipped = append(skipped, fmt.Sprintf("%s/%s 是模拟 provider，未导出", platform, p.Name))
+			continue
+		case p.APIURL == "" || p.APIKey == "" || p.IsAuthDisabled():
+			skipped = append(skipped, fmt.Sprintf("%s/%s 缺少 API 地址或 Key，未导出", platform, p.Name))
+			continue
+		}
+		if p.Proxy != "" || p.BindAddress != "" {
+			skipped = append(skipped, fmt.Sprintf("%s/%s 的上游代理与出站绑定设置不会导出", platform, p.Name))
+		}
+		item := exportedProvider{platform: platform, provider: p}
+		if p.Level <= 0 {
+			item.provider.Level = 1
+		}
+		if !includeKeys {
+			item.keyRef = exportKeyEnv(platform, p.Name)
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].provider.Level < items[j].provider.Level })
+	return items, skipped
+}
+
+// exportKeyEnv provider Key 对应的环境变量名（如 CODESWITCH_CLAUDE_MAIN_KEY）
+func exportKeyEnv(platform, name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(platform + "_" + name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return "CODESWITCH_" + strings.Trim(b.String(), "_") + "_KEY"
+}
+
+// ---- LiteLLM ----
+
+type liteLLMExport struct {
+	ModelList      []liteLLMExportModel `yaml:"model_list"`
+	RouterSettings map[string]any       `yaml:"router_settings"`
+}
+
+type liteLLMExportModel struct {
+	ModelName string              `yaml:"model_name"`
+	Params    liteLLMExportParams `yaml:"litellm_params"`
+}
+
+type liteLLMExportParams struct {
+	Model   string `yaml:"model"`
+	APIBase string `yaml:"api_base"`
+	APIKey  string `yaml:"api_key"`
+	Order   int    `yaml:"order,omitempty"`
+	Weight  int    `yaml:"weight,omitempty"`
+}
+
+// renderLiteLLMConfig 每个 provider 的每个对外模型名生成一个部署，Level 对应 order（越小越优先）
+func renderLiteLLMConfig(byPlatform map[string][]exportedProvider) (string, error) {
+	weights := currentRelayConfig().Weights
+	config := liteLLMExport{
+		RouterSettings: map[string]any{
+			"routing_strategy":       "simple-shuffle",
+			"enable_pre_call_checks": true,
+			"num_retries":            2,
+		},
+	}
+	for _, platform := range []string{"claude", "codex"} {
+		prefix, wildcard := "openai/", "*"
+		if platform == "claude" {
+			prefix, wildcard = "anthropic/", "claude-*"
+		}
+		for _, item := range byPlatform[platform] {
+			p := item.provider
+			params := liteLLMExportParams{APIBase: strings.TrimRight(p.APIURL, "/"), APIKey: p.APIKey, Order: p.Level}
+			if item.keyRef != "" {
+				params.APIKey = "os.environ/" + item.keyRef
+			}
+			if weights.Enabled {
+				if weight, ok := weights.weightFor(platform, p.Name, ""); ok && weight > 0 {
+					params.Weight = weight
+				}
+			}
+			for _, route := range exportModelRoutes(p, wildcard) {
+				deployment := params
+				deployment.Model = prefix + route[1]
+				config.ModelList = append(config.ModelList, liteLLMExportModel{ModelName: route[0], Params: deployment})
+			}
+		}
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("生成 LiteLLM 配置失败: %w", err)
+	}
+	return "# 由 Code Switch 导出的 LiteLLM 配置（litellm --config config.yaml）\n" +
+		"# order 对应 provider 的 Level，相同模型名的部署按 order 降级\n" + string(data), nil
+}
+
+// exportModelRoutes provider 的对外模型名与上游模型名；未配置白名单与映射时使用通配符
+func exportModelRoutes(p Provider, wildcard string) [][2]string {
+	var routes [][2]string
+	for model := range p.SupportedModels {
+		routes = append(routes, [2]string{model, model})
+	}
+	for alias, target := range p.ModelMapping {
+		routes = append(routes, [2]string{alias, target})
+	}
+	if len(routes) == 0 {
+		return [][2]string{{wildcard, wildcard}}
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i][0] < routes[j][0] })
+	return routes
+}
+
+// ---- nginx / Caddy ----
+
+// exportRoutes 中继对外提供的路径及对应平台、上游路径
+var exportRoutes = []struct {
+	platform string
+	path     string
+	upstream string
+}{
+	{"claude", "/v1/messages", "/v1/messages"},
+	{"codex", "/responses", "/responses"},
+}
+
+// reverseProxyWarnings 反向代理无法等价实现的设置
+func reverseProxyWarnings(byPlatform map[string][]exportedProvider) []string {
+	var warnings []string
+	for _, platform := range []string{"claude", "codex"} {
+		for _, item := range byPlatform[platform] {
+			if len(item.provider.SupportedModels) > 0 || len(item.provider.ModelMapping) > 0 {
+				warnings = append(warnings, fmt.Sprintf("%s/%s 的模型白名单与映射在反向代理中不生效", platform, item.provider.Name))
+			}
+		}
+	}
+	return warnings
+}
+
+// exportKeyValue 配置中的 Key：明文或环境变量占位符
+func exportKeyValue(item exportedProvider, placeholder string) string {
+	if item.keyRef == "" {
+		return item.provider.APIKey
+	}
+	return fmt.Sprintf(placeholder, item.keyRef)
+}
+
+// renderNginxConfig 每个路径先转发给 Level 最高的 provider，失败（5xx / 429）时依次转给下一个
+func renderNginxConfig(byPlatform map[string][]exportedProvider) string {
+	var b strings.Builder
+	b.WriteString("# 由 Code Switch 导出的 nginx 配置，放入 http {} 中\n")
+	b.WriteString("# Key 以 ${VAR} 占位，部署前执行: envsubst '$CODESWITCH_...' < code-switch.conf > /etc/nginx/conf.d/code-switch.conf\n")
+	b.WriteString("server {\n\tlisten 18100;\n\tclient_max_body_size 50m;\n\n")
+	for _, route := range exportRoutes {
+		items := byPlatform[route.platform]
+		if len(items) == 0 {
+			continue
+		}
+		name := strings.Trim(strings.ReplaceAll(route.path, "/", "_"), "_")
+		for i, item := range items {
+			if i == 0 {
+				fmt.Fprintf(&b, "\t# %s: %s（Level %d）\n\tlocation = %s {\n", route.platform, item.provider.Name, item.provider.Level, route.path)
+			} else {
+				fmt.Fprintf(&b, "\t# 降级 %d: %s（Level %d）\n\tlocation @%s_fallback_%d {\n", i, item.provider.Name, item.provider.Level, name, i)
+			}
+			// 命名 location 中 proxy_pass 不能带路径，统一用 rewrite 设置上游路径
+			target, _ := url.Parse(joinURL(item.provider.APIURL, route.upstream))
+			fmt.Fprintf(&b, "\t\trewrite ^ %s break;\n", target.EscapedPath())
+			fmt.Fprintf(&b, "\t\tproxy_pass %s://%s;\n", target.Scheme, target.Host)
+			fmt.Fprintf(&b, "\t\tproxy_set_header Host %s;\n", target.Host)
+			fmt.Fprintf(&b, "\t\tproxy_set_header Authorization \"Bearer %s\";\n", exportKeyValue(item, "${%s}"))
+			b.WriteString("\t\tproxy_set_header x-api-key \"\";\n")
+			b.WriteString("\t\tproxy_ssl_server_name on;\n")
+			b.WriteString("\t\tproxy_http_version 1.1;\n")
+			b.WriteString("\t\tproxy_buffering off;\n")
+			b.WriteString("\t\tproxy_read_timeout 600s;\n")
+			if i+1 < len(items) {
+				b.WriteString("\t\tproxy_intercept_errors on;\n")
+				fmt.Fprintf(&b, "\t\terror_page 429 500 502 503 504 = @%s_fallback_%d;\n", name, i+1)
+			}
+			b.WriteString("\t}\n\n")
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// renderCaddyConfig 每个路径转发给 Level 最高的 provider（Caddy 无法按上游设置不同的请求头，其余 provider 以注释列出）
+func renderCaddyConfig(byPlatform map[string][]exportedProvider) string {
+	var b strings.Builder
+	b.WriteString("# 由 Code Switch 导出的 Caddyfile，Key 以 {$VAR} 引用环境变量\n")
+	b.WriteString(":18100 {\n")
+	for _, route := range exportRoutes {
+		items := byPlatform[route.platform]
+		if len(items) == 0 {
+			continue
+		}
+		primary := items[0]
+		target, _ := url.Parse(strings.TrimRight(primary.provider.APIURL, "/"))
+		fmt.Fprintf(&b, "\t# %s: %s（Level %d）\n", route.platform, primary.provider.Name, primary.provider.Level)
+		for i, item := range items[1:] {
+			fmt.Fprintf(&b, "\t# 降级 %d: %s（Level %d）%s\n", i+1, item.provider.Name, item.provider.Level, item.provider.APIURL)
+		}
+		fmt.Fprintf(&b, "\thandle %s {\n", route.path)
+		if prefix := strings.TrimRight(target.Path, "/"); prefix != "" {
+			fmt.Fprintf(&b, "\t\trewrite * %s{uri}\n", prefix)
+		}
+		fmt.Fprintf(&b, "\t\treverse_proxy %s://%s {\n", target.Scheme, target.Host)
+		b.WriteString("\t\t\theader_up Host {upstream_hostport}\n")
+		fmt.Fprintf(&b, "\t\t\theader_up Authorization \"Bearer %s\"\n", exportKeyValue(primary, "{$%s}"))
+		b.WriteString("\t\t\theader_up -x-api-key\n")
+		b.WriteString("\t\t\tflush_interval -1\n")
+		b.WriteString("\t\t}\n\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
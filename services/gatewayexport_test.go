@@ -0,0 +1,57 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExportKeyEnv(t *testing.T) {
+	if got := exportKeyEnv("claude", "main relay-2"); got != "CODESWITCH_CLAUDE_MAIN_RELAY_2_KEY" {
+		t.Errorf("exportKeyEnv() = %s", got)
+	}
+}
+
+func TestExportGatewayConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	ps := NewProviderService()
+	claude := []Provider{
+		{ID: 1, Name: "backup", APIURL: "https://backup.example.com/api", APIKey: "sk-backup", Enabled: true, Level: 2},
+		{ID: 2, Name: "main", APIURL: "https://api.anthropic.com", APIKey: "sk-main", Enabled: true, Level: 1},
+		{ID: 3, Name: "off", APIURL: "https://off.example.com", APIKey: "sk-off"},
+	}
+	if err := ps.SaveProviders("claude", claude); err != nil {
+		t.Fatal(err)
+	}
+
+	litellm, err := ps.ExportGatewayConfig(GatewayFormatLiteLLM, false)
+	if err != nil {
+		t.Fatalf("ExportGatewayConfig(litellm) error = %v", err)
+	}
+	for _, want := range []string{"model: anthropic/claude-*", "api_key: os.environ/CODESWITCH_CLAUDE_MAIN_KEY", "order: 2"} {
+		if !strings.Contains(litellm.Content, want) {
+			t.Errorf("LiteLLM 配置缺少 %q:\n%s", want, litellm.Content)
+		}
+	}
+	if strings.Contains(litellm.Content, "sk-") || len(litellm.EnvVars) != 2 {
+		t.Errorf("默认不应导出明文 Key: %v\n%s", litellm.EnvVars, litellm.Content)
+	}
+
+	nginx, err := ps.ExportGatewayConfig(GatewayExportNginx, true)
+	if err != nil {
+		t.Fatalf("ExportGatewayConfig(nginx) error = %v", err)
+	}
+	main := strings.Index(nginx.Content, "Bearer sk-main")
+	backup := strings.Index(nginx.Content, "Bearer sk-backup")
+	if main < 0 || backup < main || !strings.Contains(nginx.Content, "error_page 429 500 502 503 504 = @v1_messages_fallback_1;") {
+		t.Errorf("nginx 应按 Level 降级:\n%s", nginx.Content)
+	}
+	if !strings.Contains(nginx.Content, "rewrite ^ /api/v1/messages break;") || strings.Contains(nginx.Content, "off.example.com") {
+		t.Errorf("unexpected nginx config:\n%s", nginx.Content)
+	}
+
+	if _, err := ps.ExportGatewayConfig("haproxy", false); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+}
@@ -0,0 +1,486 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 从其他网关迁移：读取 LiteLLM 的 config.yaml 与 one-api / new-api 的渠道导出（JSON），转换为 code-switch provider。
+// Anthropic 类渠道导入为 claude provider，OpenAI 及兼容渠道导入为 codex provider，其余类型跳过并说明原因。
+// 已存在相同地址与 Key 的 provider 不会重复导入；名称冲突时追加 -imported 后缀。
+
+const (
+	GatewayFormatLiteLLM = "litellm"
+	GatewayFormatOneAPI  = "one-api" // 同时兼容 new-api 的渠道导出
+)
+
+// one-api / new-api 渠道类型
+const (
+	oneAPIChannelOpenAI    = 1
+	oneAPIChannelCustom    = 8 // 自定义（OpenAI 兼容）
+	oneAPIChannelAnthropic = 14
+)
+
+// GatewayImportItem 待导入的 provider
+type GatewayImportItem struct {
+	Platform     string            `json:"platform"` // claude / codex
+	Name         string            `json:"name"`
+	Source       string            `json:"source"` // 原配置中的模型名或渠道（如 "channel #12 主力"）
+	APIURL       string            `json:"apiUrl"`
+	KeyHint      string            `json:"keyHint"` // 脱敏后的 API Key
+	Models       []string          `json:"models,omitempty"`
+	ModelMapping map[string]string `json:"modelMapping,omitempty"`
+	Level        int               `json:"level"`
+	Enabled      bool              `json:"enabled"`
+	Duplicate    bool              `json:"duplicate"` // 已存在相同地址与 Key 的 provider，不会导入
+
+	provider Provider
+}
+
+// GatewayImportPreview 导入预览
+type GatewayImportPreview struct {
+	Format  string              `json:"format"`
+	Path    string              `json:"path"`
+	Items   []GatewayImportItem `json:"items"`
+	Skipped []string            `json:"skipped"` // 无法转换的条目及原因
+}
+
+// GatewayImportResult 导入结果
+type GatewayImportResult struct {
+	Format         string          `json:"format"`
+	Imported       int             `json:"imported"`
+	Duplicates     int             `json:"duplicates"`
+	Skipped        []string        `json:"skipped"`
+	SecretFindings []SecretFinding `json:"secretFindings,omitempty"`
+}
+
+// PreviewGatewayImport 解析 LiteLLM config.yaml 或 one-api / new-api 渠道导出，返回将要导入的 provider（供前端调用）
+func (is *ImportService) PreviewGatewayImport(path string) (*GatewayImportPreview, error) {
+	preview, err := parseGatewayFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, platform := range []string{"claude", "codex"} {
+		existing, err := is.providerService.LoadProviders(platform)
+		if err != nil {
+			return nil, err
+		}
+		markGatewayDuplicates(preview.Items, platform, existing)
+	}
+	return preview, nil
+}
+
+// ImportFromGateway 导入 LiteLLM / one-api / new-api 配置中的 provider（供前端调用）
+func (is *ImportService) ImportFromGateway(path string) (GatewayImportResult, error) {
+	preview, err := is.PreviewGatewayImport(path)
+	if err != nil {
+		return GatewayImportResult{}, err
+	}
+	result := GatewayImportResult{Format: preview.Format, Skipped: preview.Skipped}
+	tx, err := beginProviderFilesTransaction("导入 " + preview.Format + " 配置")
+	if err != nil {
+		return GatewayImportResult{}, err
+	}
+	for _, platform := range []string{"claude", "codex"} {
+		var pending []Provider
+		for _, item := range preview.Items {
+			if item.Platform != platform {
+				continue
+			}
+			if item.Duplicate {
+				result.Duplicates++
+				continue
+			}
+			pending = append(pending, item.provider)
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		added, err := is.saveGatewayProviders(platform, pending)
+		if err != nil {
+			tx.Rollback()
+			return GatewayImportResult{}, err
+		}
+		result.Imported += added
+	}
+	if err := tx.Commit(); err != nil {
+		return GatewayImportResult{}, err
+	}
+	if result.Imported > 0 {
+		log.Printf("✅ 已从 %s 导入 %d 个 provider", preview.Format, result.Imported)
+		result.SecretFindings = scanSecrets()
+	}
+	return result, nil
+}
+
+// saveGatewayProviders 追加 provider，名称冲突时改名
+func (is *ImportService) saveGatewayProviders(kind string, providers []Provider) (int, error) {
+	existing, err := is.providerService.LoadProviders(kind)
+	if err != nil {
+		return 0, err
+	}
+	usedNames := make(map[string]struct{}, len(existing)+len(providers))
+	for _, p := range existing {
+		usedNames[strings.ToLower(p.Name)] = struct{}{}
+	}
+	nextID := nextProviderID(existing)
+	accent, tint := defaultVisual(kind)
+	merged := append([]Provider{}, existing...)
+	for _, provider := range providers {
+		if _, exists := usedNames[strings.ToLower(provider.Name)]; exists {
+			provider.Name = generateUniqueName(provider.Name, usedNames)
+		}
+		usedNames[strings.ToLower(provider.Name)] = struct{}{}
+		provider.ID = nextID
+		provider.Accent, provider.Tint = accent, tint
+		merged = append(merged, provider)
+		nextID++
+	}
+	if err := is.providerService.SaveProviders(kind, merged); err != nil {
+		return 0, err
+	}
+	return len(providers), nil
+}
+
+// markGatewayDuplicates 标记已存在相同地址与 Key 的条目
+func markGatewayDuplicates(items []GatewayImportItem, platform string, existing []Provider) {
+	known := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		known[normalizeURL(p.APIURL)+"\x00"+p.APIKey] = true
+	}
+	for i := range items {
+		if items[i].Platform != platform {
+			continue
+		}
+		key := normalizeURL(items[i].provider.APIURL) + "\x00" + items[i].provider.APIKey
+		items[i].Duplicate = known[key]
+		known[key] = true
+	}
+}
+
+// parseGatewayFile 按内容识别格式并解析
+func parseGatewayFile(path string) (*GatewayImportPreview, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("导入路径为空")
+	}
+	path = filepath.Clean(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	var preview *GatewayImportPreview
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		preview, err = parseOneAPIChannels(trimmed)
+	} else {
+		preview, err = parseLiteLLMConfig(data, os.Getenv)
+	}
+	if err != nil {
+		return nil, err
+	}
+	preview.Path = path
+	if len(preview.Items) == 0 && len(preview.Skipped) == 0 {
+		return nil, fmt.Errorf("文件中没有可导入的模型或渠道")
+	}
+	return preview, nil
+}
+
+// newGatewayItem 由 provider 生成预览条目
+func newGatewayItem(platform, source string, provider Provider) GatewayImportItem {
+	item := GatewayImportItem{
+		Platform:     platform,
+		Name:         provider.Name,
+		Source:       source,
+		APIURL:       provider.APIURL,
+		KeyHint:      maskAPIKey(provider.APIKey),
+		ModelMapping: provider.ModelMapping,
+		Level:        provider.Level,
+		Enabled:      provider.Enabled,
+		provider:     provider,
+	}
+	for model := range provider.SupportedModels {
+		item.Models = append(item.Models, model)
+	}
+	sort.Strings(item.Models)
+	return item
+}
+
+// gatewayProviderName 由地址生成 provider 名称（如 api.example.com）
+func gatewayProviderName(apiURL, fallback string) string {
+	if parsed, err := url.Parse(apiURL); err == nil && parsed.Hostname() != "" {
+		return parsed.Hostname()
+	}
+	return fallback
+}
+
+// ---- LiteLLM ----
+
+type liteLLMConfig struct {
+	ModelList []liteLLMModel `yaml:"model_list"`
+}
+
+type liteLLMModel struct {
+	ModelName string        `yaml:"model_name"`
+	Params    liteLLMParams `yaml:"litellm_params"`
+}
+
+type liteLLMParams struct {
+	Model             string `yaml:"model"`
+	APIBase           string `yaml:"api_base"`
+	APIKey            string `yaml:"api_key"`
+	CustomLLMProvider string `yaml:"custom_llm_provider"`
+	Order             int    `yaml:"order"` // 路由顺序，越小越优先
+}
+
+// parseLiteLLMConfig 解析 LiteLLM config.yaml：相同地址与 Key 的模型合并为一个 provider，
+// model_name 作为对外模型名，litellm_params.model 去掉前缀后作为上游模型名
+func parseLiteLLMConfig(data []byte, getenv func(string) string) (*GatewayImportPreview, error) {
+	var config liteLLMConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("解析 LiteLLM 配置失败: %w", err)
+	}
+	preview := &GatewayImportPreview{Format: GatewayFormatLiteLLM, Items: []GatewayImportItem{}, Skipped: []string{}}
+	groups := make(map[string]*GatewayImportItem)
+	var order []string
+	for _, entry := range config.ModelList {
+		alias := strings.TrimSpace(entry.ModelName)
+		params := entry.Params
+		prefix, model := "", strings.TrimSpace(params.Model)
+		if i := strings.Index(model, "/"); i > 0 {
+			prefix, model = strings.ToLower(model[:i]), model[i+1:]
+		}
+		if params.CustomLLMProvider != "" {
+			prefix = strings.ToLower(params.CustomLLMProvider)
+		}
+		if alias == "" {
+			alias = model
+		}
+		if model == "" {
+			preview.Skipped = append(preview.Skipped, fmt.Sprintf("%s: 缺少 litellm_params.model", alias))
+			continue
+		}
+
+		var platform, apiURL string
+		switch {
+		case prefix == "anthropic" || (prefix == "" && strings.HasPrefix(model, "claude")):
+			platform, apiURL = "claude", pickFirstNonEmpty(params.APIBase, "https://api.anthropic.com")
+			// claude provider 的地址不含 /v1（转发时追加 /v1/messages）
+			apiURL = strings.TrimSuffix(strings.TrimRight(apiURL, "/"), "/v1")
+		case prefix == "" || prefix == "openai" || prefix == "text-completion-openai" || prefix == "azure":
+			platform, apiURL = "codex", pickFirstNonEmpty(params.APIBase, "https://api.openai.com/v1")
+			apiURL = strings.TrimRight(apiURL, "/")
+		default:
+			preview.Skipped = append(preview.Skipped, fmt.Sprintf("%s: 暂不支持 %s 类型的模型", alias, prefix))
+			continue
+		}
+
+		apiKey := strings.TrimSpace(params.APIKey)
+		if env, ok := strings.CutPrefix(apiKey, "os.environ/"); ok {
+			apiKey = strings.TrimSpace(getenv(env))
+			if apiKey == "" {
+				preview.Skipped = append(preview.Skipped, fmt.Sprintf("%s: 环境变量 %s 未设置", alias, env))
+				continue
+			}
+		}
+		if apiKey == "" {
+			preview.Skipped = append(preview.Skipped, fmt.Sprintf("%s: 缺少 api_key", alias))
+			continue
+		}
+
+		key := platform + "\x00" + normalizeURL(apiURL) + "\x00" + apiKey
+		item := groups[key]
+		if item == nil {
+			level := params.Order
+			if level < 1 {
+				level = 1
+			} else if level > 10 {
+				level = 10
+			}
+			item = &GatewayImportItem{provider: Provider{
+				Name:            gatewayProviderName(apiURL, alias),
+				APIURL:          apiURL,
+				APIKey:          apiKey,
+				Enabled:         true,
+				Level:           level,
+				SupportedModels: map[string]bool{},
+				ModelMapping:    map[string]string{},
+			}}
+			groups[key] = item
+			order = append(order, key)
+		}
+		item.Source = strings.TrimPrefix(item.Source+", "+alias, ", ")
+		item.provider.SupportedModels[model] = true
+		if alias != model {
+			item.provider.ModelMapping[alias] = model
+		}
+		item.Platform = platform
+	}
+	for _, key := range order {
+		item := groups[key]
+		if len(item.provider.ModelMapping) == 0 {
+			item.provider.ModelMapping = nil
+		}
+		preview.Items = append(preview.Items, newGatewayItem(item.Platform, item.Source, item.provider))
+	}
+	return preview, nil
+}
+
+// ---- one-api / new-api ----
+
+type oneAPIChannel struct {
+	ID           int64   `json:"id"`
+	Type         int     `json:"type"`
+	Key          string  `json:"key"`
+	Name         string  `json:"name"`
+	Status       int     `json:"status"` // 1 启用
+	BaseURL      *string `json:"base_url"`
+	Models       string  `json:"models"`        // 逗号分隔
+	ModelMapping *string `json:"model_mapping"` // JSON 字符串：请求模型 -> 实际模型
+	Priority     *int64  `json:"priority"`      // 越大越优先
+}
+
+// decodeOneAPIChannels 兼容数组、{"data": [...]} 与 new-api 分页响应 {"data": {"items": [...]}}
+func decodeOneAPIChannels(data []byte) ([]oneAPIChannel, error) {
+	var channels []oneAPIChannel
+	if err := json.Unmarshal(data, &channels); err == nil {
+		return channels, nil
+	}
+	var wrapped struct {
+		Data     json.RawMessage `json:"data"`
+		Channels []oneAPIChannel `json:"channels"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("解析渠道导出失败: %w", err)
+	}
+	if len(wrapped.Channels) > 0 {
+		return wrapped.Channels, nil
+	}
+	if err := json.Unmarshal(wrapped.Data, &channels); err == nil {
+		return channels, nil
+	}
+	var page struct {
+		Items []oneAPIChannel `json:"items"`
+	}
+	if err := json.Unmarshal(wrapped.Data, &page); err != nil {
+		return nil, fmt.Errorf("无法识别的渠道导出格式")
+	}
+	return page.Items, nil
+}
+
+// parseOneAPIChannels 解析 one-api / new-api 渠道导出：多个 Key（按行分隔）拆分为多个 provider，
+// 渠道优先级按从高到低映射为 Level 1-10
+func parseOneAPIChannels(data []byte) (*GatewayImportPreview, error) {
+	channels, err := decodeOneAPIChannels(data)
+	if err != nil {
+		return nil, err
+	}
+	preview := &GatewayImportPreview{Format: GatewayFormatOneAPI, Items: []GatewayImportItem{}, Skipped: []string{}}
+
+	// 优先级从高到低依次对应 Level 1、2、3……（超过 10 个档位的归入 Level 10）
+	priorities := []int64{}
+	seenPriority := map[int64]bool{}
+	for _, ch := range channels {
+		if p := oneAPIPriority(ch); !seenPriority[p] {
+			seenPriority[p] = true
+			priorities = append(priorities, p)
+		}
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] > priorities[j] })
+	levelOf := make(map[int64]int, len(priorities))
+	for i, p := range priorities {
+		levelOf[p] = min(i+1, 10)
+	}
+
+	for _, ch := range channels {
+		label := fmt.Sprintf("channel #%d %s", ch.ID, ch.Name)
+		baseURL := ""
+		if ch.BaseURL != nil {
+			baseURL = strings.TrimRight(strings.TrimSpace(*ch.BaseURL), "/")
+		}
+		var platform, apiURL string
+		switch ch.Type {
+		case oneAPIChannelAnthropic:
+			platform, apiURL = "claude", pickFirstNonEmpty(baseURL, "https://api.anthropic.com")
+			apiURL = strings.TrimSuffix(apiURL, "/v1")
+		case oneAPIChannelOpenAI, oneAPIChannelCustom:
+			// one-api 的地址不含 /v1（转发时追加 /v1/chat/completions），codex provider 的地址需要包含
+			platform, apiURL = "codex", pickFirstNonEmpty(baseURL, "https://api.openai.com")
+			if !strings.HasSuffix(apiURL, "/v1") {
+				apiURL += "/v1"
+			}
+		default:
+			preview.Skipped = append(preview.Skipped, fmt.Sprintf("%s: 暂不支持渠道类型 %d", label, ch.Type))
+			continue
+		}
+
+		var mapping map[string]string
+		if ch.ModelMapping != nil && strings.TrimSpace(*ch.ModelMapping) != "" {
+			if err := json.Unmarshal([]byte(*ch.ModelMapping), &mapping); err != nil {
+				preview.Skipped = append(preview.Skipped, fmt.Sprintf("%s: 模型映射不是有效的 JSON", label))
+				continue
+			}
+		}
+		var supported map[string]bool
+		for _, model := range strings.Split(ch.Models, ",") {
+			if model = strings.TrimSpace(model); model != "" {
+				if supported == nil {
+					supported = map[string]bool{}
+				}
+				// 渠道的模型列表是对外模型名，映射后的才是上游模型名
+				if target, ok := mapping[model]; ok && target != "" {
+					supported[target] = true
+				} else {
+					supported[model] = true
+				}
+			}
+		}
+
+		var keys []string
+		for _, key := range strings.Split(ch.Key, "\n") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			preview.Skipped = append(preview.Skipped, fmt.Sprintf("%s: 缺少 Key", label))
+			continue
+		}
+		name := strings.TrimSpace(ch.Name)
+		if name == "" {
+			name = gatewayProviderName(apiURL, fmt.Sprintf("channel-%d", ch.ID))
+		}
+		for i, key := range keys {
+			provider := Provider{
+				Name:            name,
+				APIURL:          apiURL,
+				APIKey:          key,
+				Enabled:         ch.Status == 1,
+				Level:           levelOf[oneAPIPriority(ch)],
+				SupportedModels: supported,
+				ModelMapping:    mapping,
+			}
+			if len(keys) > 1 {
+				provider.Name = fmt.Sprintf("%s-%d", name, i+1)
+			}
+			preview.Items = append(preview.Items, newGatewayItem(platform, label, provider))
+		}
+	}
+	return preview, nil
+}
+
+func oneAPIPriority(ch oneAPIChannel) int64 {
+	if ch.Priority == nil {
+		return 0
+	}
+	return *ch.Priority
+}
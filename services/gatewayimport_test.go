@@ -0,0 +1,111 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLiteLLMConfig(t *testing.T) {
+	config := `
+model_list:
+  - model_name: sonnet
+    litellm_params:
+      model: anthropic/claude-sonnet-4-5
+      api_key: os.environ/TEST_ANTHROPIC_KEY
+  - model_name: haiku
+    litellm_params:
+      model: anthropic/claude-haiku-4-5
+      api_key: os.environ/TEST_ANTHROPIC_KEY
+  - model_name: gpt-5
+    litellm_params:
+      model: openai/gpt-5
+      api_base: https://mirror.example.com/v1/
+      api_key: sk-mirror
+      order: 2
+  - model_name: gemini
+    litellm_params:
+      model: gemini/gemini-2.5-pro
+      api_key: x
+  - model_name: missing
+    litellm_params:
+      model: openai/gpt-4o
+      api_key: os.environ/UNSET_KEY
+`
+	env := map[string]string{"TEST_ANTHROPIC_KEY": "sk-ant-test"}
+	preview, err := parseLiteLLMConfig([]byte(config), func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Items) != 2 || len(preview.Skipped) != 2 {
+		t.Fatalf("应合并为 2 个 provider 并跳过 2 项: %+v", preview)
+	}
+	claude := preview.Items[0].provider
+	if preview.Items[0].Platform != "claude" || claude.APIURL != "https://api.anthropic.com" || claude.APIKey != "sk-ant-test" {
+		t.Errorf("unexpected claude provider: %+v", claude)
+	}
+	if claude.ModelMapping["sonnet"] != "claude-sonnet-4-5" || !claude.SupportedModels["claude-haiku-4-5"] {
+		t.Errorf("别名应映射到上游模型: %+v", claude.ModelMapping)
+	}
+	codex := preview.Items[1].provider
+	if preview.Items[1].Platform != "codex" || codex.APIURL != "https://mirror.example.com/v1" || codex.Name != "mirror.example.com" ||
+		codex.Level != 2 || codex.ModelMapping != nil {
+		t.Errorf("unexpected codex provider: %+v", codex)
+	}
+}
+
+func TestParseOneAPIChannels(t *testing.T) {
+	export := `{"success": true, "data": {"items": [
+		{"id": 1, "type": 14, "name": "claude-main", "key": "sk-a\nsk-b", "status": 1, "base_url": "", "models": "claude-sonnet-4-5", "priority": 10},
+		{"id": 2, "type": 1, "name": "openai-backup", "key": "sk-c", "status": 2, "base_url": "https://relay.example.com",
+		 "models": "gpt-5,gpt-5-mini", "model_mapping": "{\"gpt-5-mini\":\"gpt-5-nano\"}", "priority": 0},
+		{"id": 3, "type": 24, "name": "gemini", "key": "g", "status": 1}
+	]}}`
+	preview, err := parseOneAPIChannels([]byte(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Items) != 3 || len(preview.Skipped) != 1 {
+		t.Fatalf("多 Key 渠道应拆分、Gemini 渠道应跳过: %+v", preview)
+	}
+	first, second := preview.Items[0].provider, preview.Items[1].provider
+	if first.Name != "claude-main-1" || second.Name != "claude-main-2" || first.APIURL != "https://api.anthropic.com" || first.Level != 1 {
+		t.Errorf("unexpected claude providers: %+v %+v", first, second)
+	}
+	codex := preview.Items[2].provider
+	if preview.Items[2].Platform != "codex" || codex.APIURL != "https://relay.example.com/v1" || codex.Enabled || codex.Level != 2 {
+		t.Errorf("unexpected codex provider: %+v", codex)
+	}
+	if !codex.SupportedModels["gpt-5-nano"] || codex.SupportedModels["gpt-5-mini"] || codex.ModelMapping["gpt-5-mini"] != "gpt-5-nano" {
+		t.Errorf("unexpected model mapping: %+v %+v", codex.SupportedModels, codex.ModelMapping)
+	}
+}
+
+func TestImportFromGatewaySkipsDuplicates(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	path := filepath.Join(home, "channels.json")
+	export := `[{"id": 1, "type": 1, "name": "relay", "key": "sk-relay-key-1234", "status": 1, "base_url": "https://relay.example.com"}]`
+	if err := os.WriteFile(path, []byte(export), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ps := NewProviderService()
+	if err := ps.SaveProviders("codex", []Provider{{ID: 1, Name: "relay", APIURL: "https://other.example.com", APIKey: "sk-other"}}); err != nil {
+		t.Fatal(err)
+	}
+	is := NewImportService(ps, nil)
+
+	result, err := is.ImportFromGateway(path)
+	if err != nil || result.Imported != 1 {
+		t.Fatalf("ImportFromGateway() = %+v, %v", result, err)
+	}
+	providers, _ := ps.LoadProviders("codex")
+	if len(providers) != 2 || providers[1].Name != "relay-imported" || providers[1].ID != 2 {
+		t.Fatalf("名称冲突时应改名: %+v", providers)
+	}
+	result, err = is.ImportFromGateway(path)
+	if err != nil || result.Imported != 0 || result.Duplicates != 1 {
+		t.Errorf("重复导入应跳过: %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 切换 Gemini 供应商时写入 gemini-cli 的 ~/.gemini/.env 与 settings.json：
+// 先生成写入计划（可用于预览差异），写入前备份，任一步失败时恢复两个文件。
+const geminiPushBackupSuffix = ".code-switch.bak"
+
+// geminiManagedEnvKeys 切换供应商时由本应用写入的 .env 键，其他键原样保留
+var geminiManagedEnvKeys = []string{"GOOGLE_GEMINI_BASE_URL", "GEMINI_API_KEY", "GEMINI_MODEL"}
+
+func isGeminiManagedEnvKey(key string) bool {
+	for _, managed := range geminiManagedEnvKeys {
+		if key == managed {
+			return true
+		}
+	}
+	return false
+}
+
+// GeminiConfigDiff 单个配置文件的差异
+type GeminiConfigDiff struct {
+	Path    string   `json:"path"`
+	Changed bool     `json:"changed"`
+	Lines   []string `json:"lines"` // "+ " 新增、"- " 删除、"  " 未变，密钥已脱敏
+}
+
+// GeminiSwitchPreview 切换供应商的预览（不写入任何文件）
+type GeminiSwitchPreview struct {
+	Provider     string             `json:"provider"`
+	AuthType     GeminiAuthType     `json:"authType"`
+	ProxyEnabled bool               `json:"proxyEnabled"` // 已启用中继代理：只切换中继使用的供应商，不修改 CLI 配置
+	Files        []GeminiConfigDiff `json:"files"`
+}
+
+// geminiConfigFile 计划写入的文件；before 为 nil 表示原文件不存在
+type geminiConfigFile struct {
+	path   string
+	before []byte
+	after  []byte
+}
+
+// geminiSwitchPlan 切换供应商的写入计划
+type geminiSwitchPlan struct {
+	env      geminiConfigFile
+	settings geminiConfigFile
+	secrets  []string // 预览时需要脱敏的值
+}
+
+// PreviewSwitchProvider 预览切换到指定供应商时 .env 与 settings.json 的变化（供前端调用）
+func (s *GeminiService) PreviewSwitchProvider(id string) (*GeminiSwitchPreview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var provider *GeminiProvider
+	for i := range s.providers {
+		if s.providers[i].ID == id {
+			provider = &s.providers[i]
+			break
+		}
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("未找到 ID 为 '%s' 的供应商", id)
+	}
+
+	preview := &GeminiSwitchPreview{Provider: provider.Name, AuthType: detectGeminiAuthType(provider), Files: []GeminiConfigDiff{}}
+	if proxy, err := s.ProxyStatus(); err == nil && proxy.Enabled {
+		preview.ProxyEnabled = true
+		return preview, nil
+	}
+	plan, err := s.planSwitchLocked(provider)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range []geminiConfigFile{plan.env, plan.settings} {
+		lines := diffLines(maskSecrets(string(file.before), plan.secrets), maskSecrets(string(file.after), plan.secrets))
+		preview.Files = append(preview.Files, GeminiConfigDiff{
+			Path:    file.path,
+			Changed: file.before == nil || string(file.before) != string(file.after),
+			Lines:   lines,
+		})
+	}
+	return preview, nil
+}
+
+// validateGeminiSwitchTarget 切换前校验：API Key 认证需要 API Key 或 BaseURL
+func validateGeminiSwitchTarget(provider *GeminiProvider) error {
+	if detectGeminiAuthType(provider) == GeminiAuthOAuth || provider.APIKey != "" || provider.BaseURL != "" {
+		return nil
+	}
+	if provider.EnvConfig["GEMINI_API_KEY"] != "" || provider.EnvConfig["GOOGLE_GEMINI_BASE_URL"] != "" {
+		return nil
+	}
+	return fmt.Errorf("供应商 '%s' 配置不完整：需要 API Key 或 Base URL", provider.Name)
+}
+
+// planSwitchLocked 生成切换到 provider 时的写入计划（调用方需持有 s.mu）
+func (s *GeminiService) planSwitchLocked(provider *GeminiProvider) (*geminiSwitchPlan, error) {
+	authType := detectGeminiAuthType(provider)
+	providerEnv := make(map[string]string)
+	selectedType := string(authType)
+
+	if err := validateGeminiSwitchTarget(provider); err != nil {
+		return nil, err
+	}
+	if authType != GeminiAuthOAuth {
+		// 先从预设获取，再用 provider.EnvConfig 覆盖，最后用 provider 顶级字段覆盖（优先级最高）
+		for _, preset := range s.presets {
+			if preset.Name == provider.Name || preset.PartnerPromotionKey == provider.PartnerPromotionKey {
+				for k, v := range preset.EnvConfig {
+					if v != "" {
+						providerEnv[k] = v
+					}
+				}
+				break
+			}
+		}
+		for k, v := range provider.EnvConfig {
+			if v != "" {
+				providerEnv[k] = v
+			}
+		}
+		if provider.BaseURL != "" {
+			providerEnv["GOOGLE_GEMINI_BASE_URL"] = provider.BaseURL
+		}
+		if provider.APIKey != "" {
+			providerEnv["GEMINI_API_KEY"] = provider.APIKey
+		}
+		if provider.Model != "" {
+			providerEnv["GEMINI_MODEL"] = provider.Model
+		}
+	}
+
+	plan := &geminiSwitchPlan{
+		env:      geminiConfigFile{path: getGeminiEnvPath()},
+		settings: geminiConfigFile{path: getGeminiSettingsPath()},
+	}
+
+	// .env：移除上一个供应商写入的键（OAuth 不需要任何键），保留用户的其他键
+	before, err := readOptionalFile(plan.env.path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 .env 失败: %w", err)
+	}
+	plan.env.before = before
+	envConfig := parseEnvFile(string(before))
+	plan.secrets = append(plan.secrets, envConfig["GEMINI_API_KEY"])
+	for _, key := range geminiManagedEnvKeys {
+		delete(envConfig, key)
+	}
+	for k, v := range providerEnv {
+		envConfig[k] = v
+	}
+	plan.secrets = append(plan.secrets, envConfig["GEMINI_API_KEY"])
+	plan.env.after = []byte(renderGeminiEnv(envConfig))
+
+	// settings.json：只更新认证方式，其他配置保留
+	if before, err = readOptionalFile(plan.settings.path); err != nil {
+		return nil, fmt.Errorf("读取 settings.json 失败: %w", err)
+	}
+	plan.settings.before = before
+	existing := make(map[string]any)
+	if len(strings.TrimSpace(string(before))) > 0 {
+		// 格式无效时不覆盖，避免丢失用户手写的配置
+		if err := json.Unmarshal(before, &existing); err != nil {
+			return nil, fmt.Errorf("settings.json 格式无效，未写入: %w", err)
+		}
+	}
+	merged := deepMerge(existing, map[string]any{
+		"security": map[string]any{
+			"auth": map[string]any{
+				"selectedType": selectedType,
+			},
+		},
+	})
+	if plan.settings.after, err = json.MarshalIndent(merged, "", "  "); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// apply 备份并写入 .env 与 settings.json，返回恢复两个文件的回滚函数
+func (plan *geminiSwitchPlan) apply() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(plan.env.path), 0o700); err != nil {
+		return nil, err
+	}
+	files := []geminiConfigFile{plan.env, plan.settings}
+	for _, file := range files {
+		if file.before == nil {
+			continue
+		}
+		if err := os.WriteFile(file.path+geminiPushBackupSuffix, file.before, 0o600); err != nil {
+			return nil, fmt.Errorf("备份 %s 失败: %w", filepath.Base(file.path), err)
+		}
+	}
+
+	written := 0
+	rollback := func() {
+		for _, file := range files[:written] {
+			var err error
+			if file.before != nil {
+				err = AtomicWriteBytes(file.path, file.before)
+			} else {
+				err = os.Remove(file.path)
+			}
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("[Gemini] ⚠️  回滚 %s 失败（备份: %s）: %v", file.path, file.path+geminiPushBackupSuffix, err)
+			}
+		}
+	}
+	for _, file := range files {
+		if err := AtomicWriteBytes(file.path, file.after); err != nil {
+			rollback()
+			return nil, fmt.Errorf("写入 %s 失败: %w", filepath.Base(file.path), err)
+		}
+		written++
+	}
+	return rollback, nil
+}
+
+// readOptionalFile 读取文件，不存在时返回 nil
+func readOptionalFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err == nil && data == nil {
+		data = []byte{}
+	}
+	return data, err
+}
+
+// maskSecrets 将内容中的密钥替换为脱敏值
+func maskSecrets(content string, secrets []string) string {
+	sorted := append([]string(nil), secrets...)
+	// 先替换较长的值，避免一个密钥是另一个的子串时替换不完整
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, secret := range sorted {
+		if secret != "" {
+			content = strings.ReplaceAll(content, secret, maskAPIKey(secret))
+		}
+	}
+	return content
+}
+
+// diffLines 按行比较（最长公共子序列），返回统一格式的差异行
+func diffLines(before, after string) []string {
+	a := splitLines(before)
+	b := splitLines(after)
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+ "+b[j])
+	}
+	return lines
+}
+
+func splitLines(content string) []string {
+	content = strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
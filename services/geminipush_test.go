@@ -0,0 +1,73 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	got := diffLines("A=1\nB=2\nC=3\n", "A=1\nB=9\nC=3\nD=4\n")
+	want := []string{"  A=1", "- B=2", "+ B=9", "  C=3", "+ D=4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffLines = %q, want %q", got, want)
+	}
+	if got := diffLines("", "A=1\n"); !reflect.DeepEqual(got, []string{"+ A=1"}) {
+		t.Errorf("diffLines(空) = %q", got)
+	}
+}
+
+func TestGeminiSwitchPlanPreservesUserConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	dir := filepath.Join(home, ".gemini")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("GEMINI_API_KEY=old-key-0000\nGEMINI_MODEL=gemini-old\nHTTPS_PROXY=http://proxy:8080\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "settings.json"), []byte(`{"theme":"Dracula","security":{"auth":{"selectedType":"oauth-personal"}}}`), 0o600)
+
+	svc := &GeminiService{relayAddr: ":18100"}
+	provider := &GeminiProvider{Name: "Relay", BaseURL: "https://relay.example.com", APIKey: "new-secret-1234"}
+	plan, err := svc.planSwitchLocked(provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := parseEnvFile(string(plan.env.after))
+	if env["GOOGLE_GEMINI_BASE_URL"] != "https://relay.example.com" || env["GEMINI_API_KEY"] != "new-secret-1234" {
+		t.Errorf(".env = %v", env)
+	}
+	if _, ok := env["GEMINI_MODEL"]; ok {
+		t.Error("应移除上一个供应商的 GEMINI_MODEL")
+	}
+	if env["HTTPS_PROXY"] != "http://proxy:8080" {
+		t.Error("应保留用户的其他环境变量")
+	}
+	if !strings.Contains(string(plan.settings.after), `"theme": "Dracula"`) || !strings.Contains(string(plan.settings.after), `"selectedType": "generic"`) {
+		t.Errorf("settings.json = %s", plan.settings.after)
+	}
+
+	preview := strings.Join(diffLines(maskSecrets(string(plan.env.before), plan.secrets), maskSecrets(string(plan.env.after), plan.secrets)), "\n")
+	if strings.Contains(preview, "new-secret-1234") || strings.Contains(preview, "old-key-0000") {
+		t.Errorf("预览不应包含完整的 Key:\n%s", preview)
+	}
+
+	rollback, err := plan.apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, ".env")); string(data) != string(plan.env.after) {
+		t.Errorf("写入的 .env = %s", data)
+	}
+	rollback()
+	if data, _ := os.ReadFile(filepath.Join(dir, ".env")); string(data) != string(plan.env.before) {
+		t.Errorf("回滚后的 .env = %s", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "settings.json")); string(data) != string(plan.settings.before) {
+		t.Errorf("回滚后的 settings.json = %s", data)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -36,6 +37,9 @@ type GeminiProvider struct {
 	Level               int               `json:"level,omitempty"`               // 优先级分组 (1-10, 默认 1)
 	EnvConfig           map[string]string `json:"envConfig,omitempty"`           // .env 配置
 	SettingsConfig      map[string]any    `json:"settingsConfig,omitempty"`      // settings.json 配置
+	BindAddress         string            `json:"bindAddress,omitempty"`         // 出站绑定的本机 IP 或网卡名
+	Proxy               string            `json:"proxy,omitempty"`               // 上游代理（http/https/socks5/socks5h）
+	Mock                *ProviderMock     `json:"mock,omitempty"`                // 模拟 provider（不访问网络，不需要 BaseURL 和 Key）
 }
 
 // GeminiPreset 预设供应商
@@ -137,15 +141,41 @@ func (s *GeminiService) GetPresets() []GeminiPreset {
 	return s.presets
 }
 
-// GetProviders 获取已配置的供应商列表
+// GetProviders 获取已配置的供应商列表（包含完整 API Key，仅供后端使用，不生成前端绑定）
+//
+//wails:ignore
 func (s *GeminiService) GetProviders() []GeminiProvider {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return s.providers
 }
 
+// ListProviders 获取供应商列表，API Key 只返回脱敏后的末 4 位（供前端调用）
+// 完整的 Key 只能通过 RevealKey 在系统身份验证后读取
+func (s *GeminiService) ListProviders() []GeminiProvider {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	providers := make([]GeminiProvider, 0, len(s.providers))
+	for _, p := range s.providers {
+		providers = append(providers, maskGeminiProvider(p))
+	}
+	return providers
+}
+
 // AddProvider 添加供应商
 func (s *GeminiService) AddProvider(provider GeminiProvider) error {
+	if err := currentPolicy().checkProviderURL(provider.Name, provider.BaseURL); err != nil {
+		return err
+	}
+	if err := validateBindAddress(provider.BindAddress); err != nil {
+		return err
+	}
+	if err := validateUpstreamProxy(provider.Proxy); err != nil {
+		return err
+	}
+	if err := validateProviderMock(provider.Mock); err != nil {
+		return err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -167,11 +197,26 @@ func (s *GeminiService) AddProvider(provider GeminiProvider) error {
 
 // UpdateProvider 更新供应商
 func (s *GeminiService) UpdateProvider(provider GeminiProvider) error {
+	if err := currentPolicy().checkProviderURL(provider.Name, provider.BaseURL); err != nil {
+		return err
+	}
+	if err := validateBindAddress(provider.BindAddress); err != nil {
+		return err
+	}
+	if err := validateUpstreamProxy(provider.Proxy); err != nil {
+		return err
+	}
+	if err := validateProviderMock(provider.Mock); err != nil {
+		return err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for i, p := range s.providers {
 		if p.ID == provider.ID {
+			if err := restoreGeminiMaskedKey(&provider, p); err != nil {
+				return err
+			}
 			s.providers[i] = provider
 			return s.saveProviders()
 		}
@@ -209,97 +254,31 @@ func (s *GeminiService) SwitchProvider(id string) error {
 		return fmt.Errorf("未找到 ID 为 '%s' 的供应商", id)
 	}
 
-	// 检测认证类型
-	authType := detectGeminiAuthType(provider)
-
-	// 根据认证类型写入配置
-	switch authType {
-	case GeminiAuthOAuth:
-		// OAuth：清空 .env
-		if err := writeGeminiEnv(map[string]string{}); err != nil {
-			return fmt.Errorf("写入 .env 失败: %w", err)
-		}
-		// 写入 OAuth 认证标志
-		if err := writeGeminiSettings(map[string]any{
-			"security": map[string]any{
-				"auth": map[string]any{
-					"selectedType": string(GeminiAuthOAuth),
-				},
-			},
-		}); err != nil {
-			return fmt.Errorf("写入 settings.json 失败: %w", err)
-		}
-
-	case GeminiAuthPackycode, GeminiAuthAPIKey, GeminiAuthGeneric:
-		// 配置验证：API Key 认证需要 API Key 或 BaseURL
-		if provider.APIKey == "" && provider.BaseURL == "" {
-			// 检查 EnvConfig 中是否有配置
-			hasAPIKey := provider.EnvConfig != nil && provider.EnvConfig["GEMINI_API_KEY"] != ""
-			hasBaseURL := provider.EnvConfig != nil && provider.EnvConfig["GOOGLE_GEMINI_BASE_URL"] != ""
-			if !hasAPIKey && !hasBaseURL {
-				return fmt.Errorf("供应商 '%s' 配置不完整：需要 API Key 或 Base URL", provider.Name)
-			}
-		}
-
-		// 构建 envConfig：先从预设获取，再用 provider 字段覆盖
-		envConfig := make(map[string]string)
-
-		// 1. 先查找预设并复制其 EnvConfig
-		for _, preset := range s.presets {
-			if preset.Name == provider.Name || preset.PartnerPromotionKey == provider.PartnerPromotionKey {
-				for k, v := range preset.EnvConfig {
-					if v != "" {
-						envConfig[k] = v
-					}
-				}
-				break
-			}
-		}
-
-		// 2. 再用 provider.EnvConfig 覆盖
-		if provider.EnvConfig != nil {
-			for k, v := range provider.EnvConfig {
-				if v != "" {
-					envConfig[k] = v
-				}
+	// 未通过校验时回退到最近一次成功处理请求的 provider
+	if err := validateGeminiSwitchTarget(provider); err != nil {
+		if record, ok := lastKnownGood("gemini"); ok && record.Provider != provider.Name {
+			if fallback, ferr := s.fallbackToLastKnownGoodLocked(); ferr == nil {
+				return fmt.Errorf("%w，已回退到最近可用的供应商 '%s'", err, fallback)
 			}
 		}
+		return err
+	}
+	return s.activateProviderLocked(provider)
+}
 
-		// 3. 最后用 provider 顶级字段覆盖（优先级最高）
-		if provider.BaseURL != "" {
-			envConfig["GOOGLE_GEMINI_BASE_URL"] = provider.BaseURL
-		}
-		if provider.APIKey != "" {
-			envConfig["GEMINI_API_KEY"] = provider.APIKey
-		}
-		if provider.Model != "" {
-			envConfig["GEMINI_MODEL"] = provider.Model
-		}
-
-		if err := writeGeminiEnv(envConfig); err != nil {
-			return fmt.Errorf("写入 .env 失败: %w", err)
-		}
+// activateProviderLocked 写入 CLI 配置并将 provider 设为唯一启用的供应商（调用方需持有 s.mu）
+func (s *GeminiService) activateProviderLocked(provider *GeminiProvider) error {
+	id := provider.ID
 
-		// 按认证类型区分 selectedType 值
-		var selectedType string
-		switch authType {
-		case GeminiAuthPackycode:
-			selectedType = string(GeminiAuthPackycode) // "packycode"
-		case GeminiAuthAPIKey:
-			selectedType = string(GeminiAuthAPIKey) // "gemini-api-key"
-		case GeminiAuthGeneric:
-			selectedType = string(GeminiAuthGeneric) // "generic"
+	// 已启用中继代理时 gemini-cli 经由中继转发，只需切换启用状态，不修改 CLI 配置
+	var rollback func()
+	if proxy, err := s.ProxyStatus(); err != nil || !proxy.Enabled {
+		plan, err := s.planSwitchLocked(provider)
+		if err != nil {
+			return err
 		}
-
-		// 写入认证标志
-		if err := writeGeminiSettings(map[string]any{
-			"security": map[string]any{
-				"auth": map[string]any{
-					"selectedType": selectedType,
-				},
-			},
-		}); err != nil {
-			return fmt.Errorf("写入 settings.json 失败: %w", err)
+		if rollback, err = plan.apply(); err != nil {
+			return err
 		}
 	}
 
@@ -308,7 +287,13 @@ func (s *GeminiService) SwitchProvider(id string) error {
 		s.providers[i].Enabled = (s.providers[i].ID == id)
 	}
 
-	return s.saveProviders()
+	if err := s.saveProviders(); err != nil {
+		if rollback != nil {
+			rollback()
+		}
+		return err
+	}
+	return nil
 }
 
 // GetStatus 获取当前 Gemini 配置状态
@@ -388,12 +373,6 @@ func detectGeminiAuthType(provider *GeminiProvider) GeminiAuthType {
 	return GeminiAuthGeneric
 }
 
-// getConfigDir 获取 CodeSwitch 配置目录
-func getConfigDir() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".code-switch")
-}
-
 // getGeminiDir 获取 Gemini 配置目录
 func getGeminiDir() string {
 	home, _ := os.UserHomeDir()
@@ -465,35 +444,40 @@ func isValidEnvKey(key string) bool {
 	return true
 }
 
-// writeGeminiEnv 写入 .env 文件（原子操作）
-func writeGeminiEnv(envConfig map[string]string) error {
-	dir := getGeminiDir()
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return err
-	}
-
-	// 构建 .env 内容
+// renderGeminiEnv 生成 .env 内容：常用键按固定顺序在前，其他键按名称排序
+func renderGeminiEnv(envConfig map[string]string) string {
 	var lines []string
-	// 按固定顺序写入
-	keys := []string{"GOOGLE_GEMINI_BASE_URL", "GEMINI_API_KEY", "GEMINI_MODEL"}
-	for _, key := range keys {
+	for _, key := range geminiManagedEnvKeys {
 		if value, ok := envConfig[key]; ok && value != "" {
 			lines = append(lines, fmt.Sprintf("%s=%s", key, value))
 		}
 	}
-	// 写入其他键
+	others := make([]string, 0, len(envConfig))
 	for key, value := range envConfig {
-		if key != "GOOGLE_GEMINI_BASE_URL" && key != "GEMINI_API_KEY" && key != "GEMINI_MODEL" {
-			if value != "" {
-				lines = append(lines, fmt.Sprintf("%s=%s", key, value))
-			}
+		if value != "" && !isGeminiManagedEnvKey(key) {
+			others = append(others, key)
 		}
 	}
+	sort.Strings(others)
+	for _, key := range others {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, envConfig[key]))
+	}
 
 	content := strings.Join(lines, "\n")
 	if len(lines) > 0 {
 		content += "\n"
 	}
+	return content
+}
+
+// writeGeminiEnv 写入 .env 文件（原子操作）
+func writeGeminiEnv(envConfig map[string]string) error {
+	dir := getGeminiDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	content := renderGeminiEnv(envConfig)
 
 	// 原子写入
 	path := getGeminiEnvPath()
@@ -605,10 +589,14 @@ func (s *GeminiService) saveProviders() error {
 	}
 
 	tmpPath := path + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
 		return err
 	}
-	return os.Rename(tmpPath, path)
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	recordConfigIntegrity(path)
+	return nil
 }
 
 // CreateProviderFromPreset 从预设创建供应商
@@ -655,7 +643,8 @@ func (s *GeminiService) CreateProviderFromPreset(presetName string, apiKey strin
 		return nil, err
 	}
 
-	return &provider, nil
+	masked := maskGeminiProvider(provider)
+	return &masked, nil
 }
 
 // GeminiProxyStatus Gemini 代理状态
@@ -800,8 +789,14 @@ func (s *GeminiService) DuplicateProvider(sourceID string) (*GeminiProvider, err
 		Description:         source.Description,
 		Category:            source.Category,
 		PartnerPromotionKey: source.PartnerPromotionKey,
+		BindAddress:         source.BindAddress,
+		Proxy:               source.Proxy,
 		Enabled:             false, // 默认禁用，避免与源供应商冲突
 	}
+	if source.Mock != nil {
+		mock := *source.Mock
+		cloned.Mock = &mock
+	}
 
 	// 4. 深拷贝 map（避免共享引用）
 	if source.EnvConfig != nil {
@@ -825,7 +820,9 @@ func (s *GeminiService) DuplicateProvider(sourceID string) (*GeminiProvider, err
 		return nil, fmt.Errorf("保存副本失败: %w", err)
 	}
 
-	return &cloned, nil
+	// 返回给前端的副本同样不包含完整 Key
+	masked := maskGeminiProvider(cloned)
+	return &masked, nil
 }
 
 // ReorderProviders 重新排序供应商（按传入的 ID 顺序）
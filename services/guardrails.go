@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// GuardrailPolicyReject 超出限制时拒绝请求（默认）
+	GuardrailPolicyReject = "reject"
+	// GuardrailPolicyTruncate 超出限制时丢弃最早的对话轮次，直到满足限制
+	GuardrailPolicyTruncate = "truncate"
+)
+
+// guardrailMessagesPath 各平台请求体中对话数组的路径
+func guardrailMessagesPath(kind string) string {
+	switch kind {
+	case "codex":
+		return "input"
+	case "gemini":
+		return "contents"
+	default:
+		return "messages"
+	}
+}
+
+// hasGuardrails 判断 provider 是否配置了请求体积护栏
+func (p *Provider) hasGuardrails() bool {
+	return p.MaxRequestBytes > 0 || p.MaxPromptTokens > 0
+}
+
+// applyGuardrails 按 provider 的限制检查请求
+// 返回（可能被截断的）请求体；violation 非空表示请求超出限制且无法处理
+func applyGuardrails(provider Provider, kind string, bodyBytes []byte) (result []byte, violation string) {
+	if !provider.hasGuardrails() {
+		return bodyBytes, ""
+	}
+
+	violation = guardrailViolation(provider, bodyBytes)
+	if violation == "" {
+		return bodyBytes, ""
+	}
+	if provider.GuardrailPolicy != GuardrailPolicyTruncate {
+		return bodyBytes, violation
+	}
+
+	truncated, dropped := truncateConversation(provider, kind, bodyBytes)
+	if dropped == 0 {
+		return bodyBytes, violation
+	}
+	if remaining := guardrailViolation(provider, truncated); remaining != "" {
+		return bodyBytes, remaining + "（截断早期对话后仍超出限制）"
+	}
+	fmt.Printf("[INFO] ✂️  Provider %s 请求超出限制，已丢弃最早的 %d 条对话\n", provider.Name, dropped)
+	return truncated, ""
+}
+
+// guardrailViolation 返回请求违反的限制描述，未违反时返回空字符串
+func guardrailViolation(provider Provider, bodyBytes []byte) string {
+	if provider.MaxRequestBytes > 0 && len(bodyBytes) > provider.MaxRequestBytes {
+		return fmt.Sprintf("请求体 %d 字节超过 provider %s 的上限 %d 字节", len(bodyBytes), provider.Name, provider.MaxRequestBytes)
+	}
+	if provider.MaxPromptTokens > 0 {
+		if tokens := estimatePromptTokens(bodyBytes); tokens > provider.MaxPromptTokens {
+			return fmt.Sprintf("预估提示词 %d tokens 超过 provider %s 的上限 %d tokens", tokens, provider.Name, provider.MaxPromptTokens)
+		}
+	}
+	return ""
+}
+
+// truncateConversation 逐条丢弃最早的对话，直到满足限制或只剩最后一条
+// 丢弃后保证首条消息为用户消息，避免孤立的工具结果或助手回复
+func truncateConversation(provider Provider, kind string, bodyBytes []byte) ([]byte, int) {
+	path := guardrailMessagesPath(kind)
+	messages := gjson.GetBytes(bodyBytes, path)
+	if !messages.IsArray() {
+		return bodyBytes, 0
+	}
+	items := messages.Array()
+
+	for start := 1; start < len(items); start++ {
+		if !isConversationStart(kind, items[start]) {
+			continue
+		}
+		raw := make([]byte, 0, len(bodyBytes))
+		raw = append(raw, '[')
+		for i, item := range items[start:] {
+			if i > 0 {
+				raw = append(raw, ',')
+			}
+			raw = append(raw, item.Raw...)
+		}
+		raw = append(raw, ']')
+
+		candidate, err := sjson.SetRawBytes(bodyBytes, path, raw)
+		if err != nil {
+			return bodyBytes, 0
+		}
+		if guardrailViolation(provider, candidate) == "" {
+			return candidate, start
+		}
+		if start == len(items)-1 {
+			return candidate, start
+		}
+	}
+	return bodyBytes, 0
+}
+
+// isConversationStart 判断消息能否作为截断后的第一条
+func isConversationStart(kind string, item gjson.Result) bool {
+	role := item.Get("role").String()
+	if role != "user" {
+		return false
+	}
+	if kind == "claude" {
+		// tool_result 必须紧跟对应的 tool_use，不能作为开头
+		for _, block := range item.Get("content").Array() {
+			if block.Get("type").String() == "tool_result" {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestApplyGuardrails(t *testing.T) {
+	long := strings.Repeat("a", 400) // 约 100 tokens
+	body := []byte(`{"model":"claude","messages":[` +
+		`{"role":"user","content":"` + long + `"},` +
+		`{"role":"assistant","content":"` + long + `"},` +
+		`{"role":"user","content":[{"type":"tool_result","content":"` + long + `"}]},` +
+		`{"role":"assistant","content":"ok"},` +
+		`{"role":"user","content":"hi"}]}`)
+
+	tests := []struct {
+		name          string
+		provider      Provider
+		wantViolation bool
+		wantMessages  int
+	}{
+		{"未配置限制", Provider{Name: "p"}, false, 5},
+		{"未超出限制", Provider{Name: "p", MaxPromptTokens: 1000}, false, 5},
+		{"超出限制-拒绝", Provider{Name: "p", MaxPromptTokens: 50}, true, 5},
+		{"超出限制-截断到用户消息", Provider{Name: "p", MaxPromptTokens: 50, GuardrailPolicy: GuardrailPolicyTruncate}, false, 1},
+		{"截断后仍超出", Provider{Name: "p", MaxRequestBytes: 10, GuardrailPolicy: GuardrailPolicyTruncate}, true, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, violation := applyGuardrails(tt.provider, "claude", body)
+			if (violation != "") != tt.wantViolation {
+				t.Fatalf("violation = %q, wantViolation %v", violation, tt.wantViolation)
+			}
+			if got := len(gjson.GetBytes(result, "messages").Array()); got != tt.wantMessages {
+				t.Errorf("消息数 = %d, want %d", got, tt.wantMessages)
+			}
+		})
+	}
+}
+
+func TestEstimatePromptTokens(t *testing.T) {
+	if got := estimatePromptTokens([]byte(`{"messages":[{"content":"abcdefgh"}]}`)); got != 2 {
+		t.Errorf("ASCII 应按 4 字符 1 token 估算，got %d", got)
+	}
+	if got := estimatePromptTokens([]byte(`{"content":"你好世界"}`)); got != 4 {
+		t.Errorf("中文应按 1 字符 1 token 估算，got %d", got)
+	}
+}
+
+func TestEstimateTextTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"hello world", 2},
+		{"internationalization", 5},
+		{"2025-10-16", 6},
+		{"你好，世界", 5},
+		{"  ", 0},
+	}
+	for _, tt := range tests {
+		if got := estimateTextTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTextTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+	if got := estimatePromptTokens([]byte(`{"content":[{"type":"image","source":{"data":"aGVsbG8="}}]}`)); got != imageTokenEstimate {
+		t.Errorf("图片应按固定 token 数估算，got %d", got)
+	}
+}
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 中继高可用：两个中继实例互为备份，定期拉取对方的拉黑状态与当日花费
+// 客户端同时配置两个地址（见 GetHAClientConfig），任一实例故障时切换到另一个
+const (
+	haSecretHeader      = "X-CodeSwitch-HA-Secret"
+	haSecretMinLength   = 16
+	haRequestTimeout    = 5 * time.Second
+	haDisabledPollDelay = 10 * time.Second // 未配置对端时检查配置的间隔
+)
+
+// HABlacklistEntry 拉黑状态（同步给对端）
+type HABlacklistEntry struct {
+	Platform      string     `json:"platform"`
+	Provider      string     `json:"provider"`
+	Level         int        `json:"level"`
+	BlacklistedAt *time.Time `json:"blacklistedAt,omitempty"`
+	Until         *time.Time `json:"until,omitempty"`
+	RecoveredAt   *time.Time `json:"recoveredAt,omitempty"`
+}
+
+// HAState GET /ha/state 的响应：本实例自身的状态（不含从对端同步来的花费）
+type HAState struct {
+	Day         string             `json:"day"`
+	SpentUSD    float64            `json:"spentUsd"`
+	Blacklist   []HABlacklistEntry `json:"blacklist"`
+	GeneratedAt int64              `json:"generatedAt"`
+}
+
+// HAStatus 高可用配对状态（供前端展示）
+type HAStatus struct {
+	Enabled       bool    `json:"enabled"`
+	PeerURL       string  `json:"peerUrl,omitempty"`
+	PeerReachable bool    `json:"peerReachable"`
+	LastSyncAt    int64   `json:"lastSyncAt,omitempty"`
+	LastError     string  `json:"lastError,omitempty"`
+	PeerSpentUSD  float64 `json:"peerSpentUsd"`
+	Merged        int     `json:"merged"` // 最近一次同步合并的拉黑状态变更数
+}
+
+// HAClientConfig 指向主备两个中继的客户端配置
+type HAClientConfig struct {
+	Primary      string            `json:"primary"`
+	Secondary    string            `json:"secondary"`
+	ClaudeEnv    map[string]string `json:"claudeEnv"`    // 写入 ~/.claude/settings.json 的 env（主中继）
+	CodexTOML    string            `json:"codexToml"`    // ~/.codex/config.toml 片段，包含主备两个 provider
+	ShellSnippet string            `json:"shellSnippet"` // 启动前按健康状态选择中继的 shell 片段
+}
+
+// haPeerUsage 对端的当日花费
+type haPeerUsage struct {
+	day      string
+	spentUSD float64
+}
+
+var (
+	activeHAPeerUsage atomic.Pointer[haPeerUsage]
+	haStatusMu        sync.Mutex
+	haStatus          HAStatus
+)
+
+// peerSpendToday 对端实例的当日花费（未配对或不是同一天时为 0）
+func peerSpendToday(now time.Time) float64 {
+	usage := activeHAPeerUsage.Load()
+	if usage == nil || usage.day != now.Format("2006-01-02") {
+		return 0
+	}
+	return usage.spentUSD
+}
+
+// validateHAConfig 校验高可用配置
+func validateHAConfig(config RelayHAConfig) error {
+	if config.PeerURL == "" {
+		return nil
+	}
+	if err := validateHTTPURL(config.PeerURL, "peerUrl"); err != nil {
+		return err
+	}
+	if len(config.Secret) < haSecretMinLength {
+		return fmt.Errorf("高可用共享密钥至少需要 %d 个字符", haSecretMinLength)
+	}
+	if config.SyncIntervalSec < 2 || config.SyncIntervalSec > 300 {
+		return fmt.Errorf("高可用同步间隔必须在 2-300 秒之间")
+	}
+	return nil
+}
+
+// haStateHandler 返回本实例的拉黑状态与当日花费（需共享密钥）
+func (prs *ProviderRelayService) haStateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		config := currentRelayConfig().HA
+		if config.PeerURL == "" || config.Secret == "" {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "ha disabled"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(haSecretHeader)), []byte(config.Secret)) != 1 {
+			recordAudit("ha", "auth_failed", fmt.Sprintf("来自 %s 的同步请求密钥错误", c.ClientIP()))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid ha secret"})
+			return
+		}
+		state, err := prs.localHAState()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, state)
+	}
+}
+
+// localHAState 读取本实例状态
+func (prs *ProviderRelayService) localHAState() (*HAState, error) {
+	now := time.Now()
+	state := &HAState{Day: now.Format("2006-01-02"), GeneratedAt: now.UnixMilli()}
+	if prs.budget != nil {
+		spent, err := prs.budget.localSpentToday()
+		if err != nil {
+			return nil, err
+		}
+		state.SpentUSD = spent
+	}
+	entries, err := readHABlacklist()
+	if err != nil {
+		return nil, err
+	}
+	state.Blacklist = entries
+	return state, nil
+}
+
+// readHABlacklist 读取全部拉黑记录
+func readHABlacklist() ([]HABlacklistEntry, error) {
+	db, err := sharedDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT platform, provider_name, blacklist_level, blacklisted_at, blacklisted_until, last_recovered_at FROM provider_blacklist`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []HABlacklistEntry{}
+	for rows.Next() {
+		var entry HABlacklistEntry
+		var level sql.NullInt64
+		var at, until, recovered epochTime
+		if err := rows.Scan(&entry.Platform, &entry.Provider, &level, &at, &until, &recovered); err != nil {
+			return nil, err
+		}
+		entry.Level = int(level.Int64)
+		entry.BlacklistedAt = at.Ptr()
+		entry.Until = until.Ptr()
+		entry.RecoveredAt = recovered.Ptr()
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// haChange 同步时对本地拉黑状态的修改
+type haChange struct {
+	entry HABlacklistEntry
+	clear bool // true: 解除拉黑；false: 按对端状态拉黑
+}
+
+// mergeHABlacklist 比较本地与对端的拉黑状态，以较新的操作为准
+// - 对端拉黑更久且晚于本地最近一次恢复：本地同步拉黑
+// - 对端在本地拉黑之后恢复（手动解除或到期）：本地同步解除
+func mergeHABlacklist(local, peer []HABlacklistEntry, now time.Time) []haChange {
+	localByKey := make(map[string]HABlacklistEntry, len(local))
+	for _, entry := range local {
+		localByKey[entry.Platform+"/"+entry.Provider] = entry
+	}
+	var changes []haChange
+	for _, remote := range peer {
+		mine, exists := localByKey[remote.Platform+"/"+remote.Provider]
+		remoteActive := remote.Until != nil && remote.Until.After(now)
+		localActive := exists && mine.Until != nil && mine.Until.After(now)
+
+		if remoteActive {
+			if localActive && !remote.Until.After(*mine.Until) {
+				continue
+			}
+			if exists && mine.RecoveredAt != nil && remote.BlacklistedAt != nil && !remote.BlacklistedAt.After(*mine.RecoveredAt) {
+				continue // 本地已在对端拉黑之后手动恢复
+			}
+			changes = append(changes, haChange{entry: remote})
+			continue
+		}
+		if localActive && remote.RecoveredAt != nil && mine.BlacklistedAt != nil && remote.RecoveredAt.After(*mine.BlacklistedAt) {
+			changes = append(changes, haChange{entry: remote, clear: true})
+		}
+	}
+	return changes
+}
+
+// applyHAChanges 写入同步结果
+func applyHAChanges(changes []haChange) error {
+	for _, change := range changes {
+		entry := change.entry
+		var err error
+		if change.clear {
+			err = GlobalDBQueueShared.Exec(`
+				UPDATE provider_blacklist
+				SET blacklisted_at = NULL,
+					blacklisted_until = NULL,
+					failure_count = 0,
+					last_recovered_at = ?,
+					auto_recovered = 0
+				WHERE platform = ? AND provider_name = ?
+			`, entry.RecoveredAt.Unix(), entry.Platform, entry.Provider)
+		} else {
+			blacklistedAt := time.Now()
+			if entry.BlacklistedAt != nil {
+				blacklistedAt = *entry.BlacklistedAt
+			}
+			err = GlobalDBQueueShared.Exec(`
+				INSERT INTO provider_blacklist (platform, provider_name, blacklist_level, blacklisted_at, blacklisted_until, last_failure_at)
+				VALUES (?, ?, ?, ?, ?, ?)
+				ON CONFLICT(platform, provider_name) DO UPDATE SET
+					blacklisted_at = excluded.blacklisted_at,
+					blacklisted_until = excluded.blacklisted_until,
+					blacklist_level = CASE WHEN excluded.blacklist_level > provider_blacklist.blacklist_level
+						THEN excluded.blacklist_level ELSE provider_blacklist.blacklist_level END
+			`, entry.Platform, entry.Provider, entry.Level, blacklistedAt.Unix(), entry.Until.Unix(), blacklistedAt.Unix())
+		}
+		if err != nil {
+			return fmt.Errorf("同步 %s/%s 的拉黑状态失败: %w", entry.Platform, entry.Provider, err)
+		}
+	}
+	return nil
+}
+
+// fetchHAState 拉取对端状态
+func fetchHAState(config RelayHAConfig) (*HAState, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(config.PeerURL, "/")+"/ha/state", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(haSecretHeader, config.Secret)
+	client := &http.Client{Timeout: haRequestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("对端返回 HTTP %d", resp.StatusCode)
+	}
+	var state HAState
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return nil, fmt.Errorf("解析对端状态失败: %w", err)
+	}
+	return &state, nil
+}
+
+// syncHAPeer 同步一次：合并拉黑状态，记录对端花费
+func syncHAPeer(config RelayHAConfig) (int, *HAState, error) {
+	peer, err := fetchHAState(config)
+	if err != nil {
+		return 0, nil, err
+	}
+	activeHAPeerUsage.Store(&haPeerUsage{day: peer.Day, spentUSD: peer.SpentUSD})
+
+	local, err := readHABlacklist()
+	if err != nil {
+		return 0, peer, err
+	}
+	changes := mergeHABlacklist(local, peer.Blacklist, time.Now())
+	if err := applyHAChanges(changes); err != nil {
+		return 0, peer, err
+	}
+	for _, change := range changes {
+		if change.clear {
+			log.Printf("🔁 [HA] 对端已恢复 %s/%s，同步解除拉黑", change.entry.Platform, change.entry.Provider)
+		} else {
+			log.Printf("🔁 [HA] 对端已拉黑 %s/%s，同步拉黑至 %s", change.entry.Platform, change.entry.Provider, change.entry.Until.Format("15:04:05"))
+		}
+	}
+	return len(changes), peer, nil
+}
+
+// runHASync 定期与对端同步（每轮重新读取配置，修改配置后无需重启）
+func runHASync(stop <-chan struct{}) {
+	wasReachable := true
+	for {
+		config := currentRelayConfig().HA
+		delay := haDisabledPollDelay
+		if config.PeerURL != "" {
+			delay = time.Duration(config.SyncIntervalSec) * time.Second
+			merged, peer, err := syncHAPeer(config)
+
+			haStatusMu.Lock()
+			haStatus.PeerURL = config.PeerURL
+			haStatus.PeerReachable = peer != nil
+			if peer != nil {
+				haStatus.LastSyncAt = time.Now().UnixMilli()
+				haStatus.PeerSpentUSD = peer.SpentUSD
+				haStatus.Merged = merged
+			}
+			haStatus.LastError = ""
+			if err != nil {
+				haStatus.LastError = err.Error()
+			}
+			haStatusMu.Unlock()
+
+			if (peer != nil) != wasReachable {
+				if peer == nil {
+					log.Printf("⚠️  [HA] 对端中继 %s 不可用: %v", config.PeerURL, err)
+				} else {
+					log.Printf("✅ [HA] 对端中继 %s 已恢复", config.PeerURL)
+				}
+				wasReachable = peer != nil
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// GetHAStatus 获取高可用配对状态（供前端调用）
+func (prs *ProviderRelayService) GetHAStatus() HAStatus {
+	config := currentRelayConfig().HA
+	haStatusMu.Lock()
+	status := haStatus
+	haStatusMu.Unlock()
+	status.Enabled = config.PeerURL != ""
+	status.PeerURL = config.PeerURL
+	return status
+}
+
+// GetHAClientConfig 生成同时指向主备中继的客户端配置（供前端调用）
+func (prs *ProviderRelayService) GetHAClientConfig() (*HAClientConfig, error) {
+	secondary := strings.TrimRight(currentRelayConfig().HA.PeerURL, "/")
+	if secondary == "" {
+		return nil, fmt.Errorf("尚未配置备用中继地址")
+	}
+	primary := "http://127.0.0.1" + prs.addr[strings.LastIndex(prs.addr, ":"):]
+
+	config := &HAClientConfig{
+		Primary:   primary,
+		Secondary: secondary,
+		ClaudeEnv: map[string]string{
+			"ANTHROPIC_BASE_URL":   primary,
+			"ANTHROPIC_AUTH_TOKEN": claudeAuthTokenValue,
+		},
+	}
+	config.CodexTOML = fmt.Sprintf(`model_provider = %[1]q
+
+[model_providers.%[1]s]
+name = %[1]q
+base_url = %[3]q
+env_key = %[4]q
+wire_api = %[5]q
+requires_openai_auth = false
+
+# 主中继不可用时: codex -c model_provider=%[2]s
+[model_providers.%[2]s]
+name = %[2]q
+base_url = %[6]q
+env_key = %[4]q
+wire_api = %[5]q
+requires_openai_auth = false
+`, codexProviderKey, codexProviderKey+"-secondary", primary, codexEnvKey, codexWireAPI, secondary)
+	config.ShellSnippet = fmt.Sprintf(`# 启动前选择可用的中继（主中继优先）
+if curl -sf --max-time 2 %[1]s/health >/dev/null; then
+  export ANTHROPIC_BASE_URL=%[1]s
+else
+  export ANTHROPIC_BASE_URL=%[2]s
+fi
+export ANTHROPIC_AUTH_TOKEN=%[3]s
+`, primary, secondary, claudeAuthTokenValue)
+	return config, nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeHABlacklist(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	at := func(minutes int) *time.Time {
+		v := now.Add(time.Duration(minutes) * time.Minute)
+		return &v
+	}
+
+	local := []HABlacklistEntry{
+		{Platform: "claude", Provider: "longer", BlacklistedAt: at(-5), Until: at(5)},
+		{Platform: "claude", Provider: "recovered", RecoveredAt: at(-1)},
+		{Platform: "claude", Provider: "active", BlacklistedAt: at(-10), Until: at(20)},
+	}
+	peer := []HABlacklistEntry{
+		{Platform: "claude", Provider: "longer", BlacklistedAt: at(-2), Until: at(30), Level: 2}, // 对端拉黑更久：同步
+		{Platform: "claude", Provider: "recovered", BlacklistedAt: at(-3), Until: at(10)},        // 本地之后已恢复：忽略
+		{Platform: "claude", Provider: "active", RecoveredAt: at(-1)},                            // 对端在本地拉黑后恢复：解除
+		{Platform: "codex", Provider: "new", BlacklistedAt: at(-1), Until: at(10)},               // 本地没有记录：同步
+		{Platform: "codex", Provider: "expired", BlacklistedAt: at(-60), Until: at(-30)},         // 已过期：忽略
+	}
+
+	changes := mergeHABlacklist(local, peer, now)
+	got := map[string]bool{}
+	for _, change := range changes {
+		got[change.entry.Platform+"/"+change.entry.Provider] = change.clear
+	}
+	want := map[string]bool{"claude/longer": false, "claude/active": true, "codex/new": false}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %+v, want %v", got, want)
+	}
+	for key, clear := range want {
+		if c, ok := got[key]; !ok || c != clear {
+			t.Errorf("%s: got clear=%v (present=%v), want clear=%v", key, c, ok, clear)
+		}
+	}
+
+	// 同步后两端一致，再次合并不应产生变更
+	if again := mergeHABlacklist(peer[:1], peer[:1], now); len(again) != 0 {
+		t.Errorf("merge of identical state = %+v", again)
+	}
+}
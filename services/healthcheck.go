@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// 自定义健康检查：通用探测（向 API 地址 POST 一条最小对话请求）会误判对未知路径返回 403 的网关，
+// provider 可以定义自己的健康检查请求（方法、路径、请求头、期望的状态码与 JSON 字段），
+// 连通性测试按该定义判定，自动测试、唤醒后探测与拉黑联动都使用同一结果。
+
+const (
+	healthCheckMaxBody      = 64 << 10 // 请求体与读取的响应体上限
+	healthCheckSlowMs       = 5000
+	healthCheckAPIKeyMarker = "{{apiKey}}"
+)
+
+var healthCheckMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodOptions: true,
+}
+
+// ProviderHealthCheck 自定义健康检查请求
+type ProviderHealthCheck struct {
+	Method          string            `json:"method,omitempty"`          // 请求方法，默认 GET
+	Path            string            `json:"path,omitempty"`            // 相对 API 地址解析的路径（如 /health、v1/models），为空时请求 API 地址本身
+	Headers         map[string]string `json:"headers,omitempty"`         // 附加请求头（覆盖默认的认证头），取值中的 {{apiKey}} 替换为 API Key
+	Body            string            `json:"body,omitempty"`            // 请求体（不设置 Content-Type 时按 JSON 发送）
+	ExpectStatus    []int             `json:"expectStatus,omitempty"`    // 视为健康的状态码，为空时为 2xx
+	ExpectJSONField string            `json:"expectJsonField,omitempty"` // 响应 JSON 中必须存在的字段（gjson 路径，如 data.0.id、status）
+	ExpectJSONValue string            `json:"expectJsonValue,omitempty"` // 字段的期望取值（按字符串比较），为空时只要求字段存在
+}
+
+// validateHealthCheck 校验自定义健康检查配置
+func validateHealthCheck(check *ProviderHealthCheck) error {
+	if check == nil {
+		return nil
+	}
+	if check.Method != "" && !healthCheckMethods[strings.ToUpper(check.Method)] {
+		return fmt.Errorf("健康检查方法 %s 不受支持（可用 GET/HEAD/POST/PUT/OPTIONS）", check.Method)
+	}
+	if check.Path != "" {
+		ref, err := url.Parse(check.Path)
+		if err != nil {
+			return fmt.Errorf("健康检查路径无效: %w", err)
+		}
+		// 只允许相对路径，避免把 API Key 发送到其他地址
+		if ref.Scheme != "" || ref.Host != "" {
+			return fmt.Errorf("健康检查路径必须是相对 API 地址的路径，不能是完整 URL")
+		}
+	}
+	for name := range check.Headers {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\r\n") {
+			return fmt.Errorf("健康检查请求头名称无效: %q", name)
+		}
+	}
+	if len(check.Body) > healthCheckMaxBody {
+		return fmt.Errorf("健康检查请求体不能超过 %d 字节", healthCheckMaxBody)
+	}
+	for _, code := range check.ExpectStatus {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("健康检查期望状态码 %d 无效", code)
+		}
+	}
+	if check.ExpectJSONValue != "" && check.ExpectJSONField == "" {
+		return fmt.Errorf("设置健康检查期望取值时必须指定 JSON 字段")
+	}
+	return nil
+}
+
+// healthCheckURL 按 API 地址解析健康检查路径
+func healthCheckURL(apiURL, path string) (string, error) {
+	base, err := url.Parse(apiURL)
+	if err != nil || base.Host == "" {
+		return "", fmt.Errorf("API 地址无效: %s", apiURL)
+	}
+	if path == "" {
+		return base.String(), nil
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("健康检查路径无效: %w", err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// newHealthCheckRequest 按自定义定义构建健康检查请求：先设置默认认证头，再应用自定义请求头
+func newHealthCheckRequest(ctx context.Context, provider *Provider, platform string) (*http.Request, error) {
+	check := provider.HealthCheck
+	target, err := healthCheckURL(provider.APIURL, check.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUpstreamURL(target); err != nil {
+		return nil, err
+	}
+	method := strings.ToUpper(check.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if check.Body != "" {
+		body = strings.NewReader(check.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if check.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	setTestAuthHeaders(req, provider, platform)
+	for name, value := range check.Headers {
+		req.Header.Set(name, strings.ReplaceAll(value, healthCheckAPIKeyMarker, provider.APIKey))
+	}
+	return req, nil
+}
+
+// evaluateHealthCheck 按期望的状态码与 JSON 字段判定健康检查结果，返回状态、细分状态与说明
+func evaluateHealthCheck(check *ProviderHealthCheck, statusCode, latencyMs int, body []byte) (int, string, string) {
+	if !healthCheckStatusMatches(check.ExpectStatus, statusCode) {
+		subStatus := SubStatusClientError
+		switch {
+		case statusCode == 401 || statusCode == 403:
+			subStatus = SubStatusAuthError
+		case statusCode == 429:
+			subStatus = SubStatusRateLimit
+		case statusCode >= 500:
+			subStatus = SubStatusServerError
+		}
+		return StatusUnavailable, subStatus, fmt.Sprintf("状态码 %d 不符合期望", statusCode)
+	}
+
+	if check.ExpectJSONField != "" {
+		if !gjson.ValidBytes(body) {
+			return StatusUnavailable, SubStatusContentMismatch, "响应不是有效的 JSON"
+		}
+		field := gjson.GetBytes(body, check.ExpectJSONField)
+		if !field.Exists() {
+			return StatusUnavailable, SubStatusContentMismatch, fmt.Sprintf("响应缺少字段 %s", check.ExpectJSONField)
+		}
+		if check.ExpectJSONValue != "" && field.String() != check.ExpectJSONValue {
+			return StatusUnavailable, SubStatusContentMismatch,
+				fmt.Sprintf("字段 %s 为 %q，期望 %q", check.ExpectJSONField, field.String(), check.ExpectJSONValue)
+		}
+	}
+
+	if latencyMs > healthCheckSlowMs {
+		return StatusDegraded, SubStatusSlowLatency, ""
+	}
+	return StatusAvailable, SubStatusNone, ""
+}
+
+func healthCheckStatusMatches(expect []int, statusCode int) bool {
+	if len(expect) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	for _, code := range expect {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// runHealthCheck 按 provider 的自定义定义执行健康检查
+func (cts *ConnectivityTestService) runHealthCheck(ctx context.Context, provider Provider, platform string, result *ConnectivityResult) *ConnectivityResult {
+	req, err := newHealthCheckRequest(ctx, &provider, platform)
+	if err != nil {
+		result.Message = err.Error()
+		result.SubStatus = SubStatusClientError
+		return result
+	}
+
+	start := time.Now()
+	resp, err := withProviderNetwork(cts.client, provider.network()).Do(req)
+	result.LatencyMs = int(time.Since(start).Milliseconds())
+	if err != nil {
+		cts.applyRequestError(result, err)
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.HTTPCode = resp.StatusCode
+	body, err := io.ReadAll(io.LimitReader(resp.Body, healthCheckMaxBody))
+	if err != nil {
+		body = []byte{}
+	}
+
+	var message string
+	result.Status, result.SubStatus, message = evaluateHealthCheck(provider.HealthCheck, resp.StatusCode, result.LatencyMs, body)
+	if result.Status == StatusUnavailable {
+		if len(body) > 0 {
+			message += ": " + string(body)
+		}
+		result.Message = cts.truncateMessage(message)
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProviderHealthCheck(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	// 网关对未知路径返回 403，只有 /gateway/health 返回状态
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gateway/health" || r.Header.Get("X-Token") != "sk-test" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	cts := NewConnectivityTestService(nil, nil, nil)
+	provider := Provider{ID: 1, Name: "gateway", APIURL: server.URL + "/v1", APIKey: "sk-test"}
+	if result := cts.TestProvider(context.Background(), provider, "codex"); result.Status != StatusUnavailable {
+		t.Fatalf("通用探测应被网关拒绝: %+v", result)
+	}
+
+	provider.HealthCheck = &ProviderHealthCheck{
+		Path:            "/gateway/health",
+		Headers:         map[string]string{"X-Token": "{{apiKey}}"},
+		ExpectJSONField: "status",
+		ExpectJSONValue: "ok",
+	}
+	if err := validateHealthCheck(provider.HealthCheck); err != nil {
+		t.Fatal(err)
+	}
+	if result := cts.TestProvider(context.Background(), provider, "codex"); result.Status != StatusAvailable {
+		t.Fatalf("自定义健康检查应判定为可用: %+v", result)
+	}
+
+	provider.HealthCheck.ExpectJSONValue = "healthy"
+	result := cts.TestProvider(context.Background(), provider, "codex")
+	if result.Status != StatusUnavailable || result.SubStatus != SubStatusContentMismatch {
+		t.Errorf("字段取值不符时应为内容不匹配: %+v", result)
+	}
+
+	if err := validateHealthCheck(&ProviderHealthCheck{Path: "https://evil.example/health"}); err == nil {
+		t.Error("应拒绝完整 URL，避免把 Key 发送到其他地址")
+	}
+	if err := validateHealthCheck(&ProviderHealthCheck{ExpectStatus: []int{42}}); err == nil {
+		t.Error("应拒绝无效的期望状态码")
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 对冲请求：与延迟预算无关的显式策略。路由规则设置 hedgeDelayMs 后，命中该规则的请求在发出 hedgeDelayMs 毫秒后
+// 仍未响应时，同时发给下一个候选 provider，先返回成功响应的一方获胜，另一方取消（机制与延迟预算相同，见 latencybudget.go）。
+// 同时设置了延迟预算时取两者中较短的一个。每条规则统计对冲次数与获胜方，帮助判断对冲是否值得额外的费用。
+// 统计只保存在内存中，重启后清空。
+
+const (
+	// minHedgeDelayMs / maxHedgeDelayMs 对冲延迟范围
+	minHedgeDelayMs = 50
+	maxHedgeDelayMs = 600000
+)
+
+// validateHedgeDelay 校验规则的对冲延迟（0 表示不对冲）
+func validateHedgeDelay(ms int) error {
+	if ms != 0 && (ms < minHedgeDelayMs || ms > maxHedgeDelayMs) {
+		return fmt.Errorf("对冲延迟必须在 %d-%d 毫秒之间", minHedgeDelayMs, maxHedgeDelayMs)
+	}
+	return nil
+}
+
+// HedgeStat 单条规则的对冲统计
+type HedgeStat struct {
+	Platform    string  `json:"platform"`
+	Rule        string  `json:"rule"`
+	Requests    int     `json:"requests"`    // 命中规则且有备用 provider 的请求数
+	Hedged      int     `json:"hedged"`      // 超过对冲延迟、实际发出第二个请求的次数
+	HedgeWins   int     `json:"hedgeWins"`   // 第二个请求先响应的次数
+	PrimaryWins int     `json:"primaryWins"` // 发出第二个请求后仍由第一个请求先响应的次数
+	Failures    int     `json:"failures"`    // 对冲后两个请求都失败的次数
+	WinRate     float64 `json:"winRate"`     // HedgeWins / Hedged
+	LastHedgeAt int64   `json:"lastHedgeAt,omitempty"`
+}
+
+// hedgeStats 按 platform/rule 统计对冲结果
+type hedgeStats struct {
+	mu    sync.Mutex
+	stats map[string]*HedgeStat
+}
+
+func newHedgeStats() *hedgeStats {
+	return &hedgeStats{stats: make(map[string]*HedgeStat)}
+}
+
+// observe 记录一次命中对冲规则的请求；raced 为第二个请求的结果（未发出时为 nil），winner 为获胜的 provider
+func (s *hedgeStats) observe(platform, rule string, raced *raceResult, winner string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := platform + "/" + rule
+	stat := s.stats[key]
+	if stat == nil {
+		stat = &HedgeStat{Platform: platform, Rule: rule}
+		s.stats[key] = stat
+	}
+	stat.Requests++
+	if raced == nil {
+		return
+	}
+	stat.Hedged++
+	stat.LastHedgeAt = time.Now().Unix()
+	switch {
+	case !ok:
+		stat.Failures++
+	case winner == raced.candidate.provider.Name:
+		stat.HedgeWins++
+	default:
+		stat.PrimaryWins++
+	}
+}
+
+// list 各规则的对冲统计（按平台、规则名排序）
+func (s *hedgeStats) list() []HedgeStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]HedgeStat, 0, len(s.stats))
+	for _, stat := range s.stats {
+		item := *stat
+		if item.Hedged > 0 {
+			item.WinRate = float64(item.HedgeWins) / float64(item.Hedged)
+		}
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Platform != result[j].Platform {
+			return result[i].Platform < result[j].Platform
+		}
+		return result[i].Rule < result[j].Rule
+	})
+	return result
+}
+
+// raceDelay 本次请求的竞速延迟：延迟预算与规则对冲延迟中较短的一个，hedged 表示由对冲规则决定
+func raceDelay(budget time.Duration, decision *routingDecision) (delay time.Duration, hedged bool) {
+	if decision == nil || decision.hedgeDelay <= 0 {
+		return budget, false
+	}
+	if budget > 0 && budget <= decision.hedgeDelay {
+		return budget, false
+	}
+	return decision.hedgeDelay, true
+}
+
+// GetHedgeStats 列出各路由规则的对冲统计（供前端调用）
+func (prs *ProviderRelayService) GetHedgeStats() []HedgeStat {
+	return prs.hedges.list()
+}
+
+// ResetHedgeStats 清空对冲统计（供前端调用）
+func (prs *ProviderRelayService) ResetHedgeStats() {
+	prs.hedges.mu.Lock()
+	defer prs.hedges.mu.Unlock()
+	prs.hedges.stats = make(map[string]*HedgeStat)
+}
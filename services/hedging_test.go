@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRaceDelay(t *testing.T) {
+	hedge := &routingDecision{rule: "opus", hedgeDelay: 800 * time.Millisecond}
+	cases := []struct {
+		budget   time.Duration
+		decision *routingDecision
+		want     time.Duration
+		hedged   bool
+	}{
+		{0, nil, 0, false},
+		{3 * time.Second, nil, 3 * time.Second, false},
+		{0, hedge, 800 * time.Millisecond, true},
+		{3 * time.Second, hedge, 800 * time.Millisecond, true},
+		{500 * time.Millisecond, hedge, 500 * time.Millisecond, false},
+	}
+	for _, tc := range cases {
+		got, hedged := raceDelay(tc.budget, tc.decision)
+		if got != tc.want || hedged != tc.hedged {
+			t.Errorf("raceDelay(%v, %+v) = %v, %v, want %v, %v", tc.budget, tc.decision, got, hedged, tc.want, tc.hedged)
+		}
+	}
+}
+
+func TestHedgeStats(t *testing.T) {
+	stats := newHedgeStats()
+	backup := &raceResult{candidate: raceCandidate{provider: Provider{Name: "b"}}}
+	stats.observe("claude", "opus", nil, "a", true)
+	stats.observe("claude", "opus", backup, "b", true)
+	stats.observe("claude", "opus", backup, "a", true)
+	stats.observe("claude", "opus", backup, "a", false)
+
+	list := stats.list()
+	if len(list) != 1 {
+		t.Fatalf("list = %+v", list)
+	}
+	got := list[0]
+	if got.Requests != 4 || got.Hedged != 3 || got.HedgeWins != 1 || got.PrimaryWins != 1 || got.Failures != 1 {
+		t.Fatalf("stat = %+v", got)
+	}
+	if got.WinRate < 0.33 || got.WinRate > 0.34 {
+		t.Errorf("WinRate = %v, want 1/3", got.WinRate)
+	}
+
+	if err := validateRulesConfig(RelayRulesConfig{Rules: []RoutingRule{{Rule: `true -> exclude "x"`, HedgeDelayMs: 10}}}); err == nil {
+		t.Errorf("过短的对冲延迟应校验失败")
+	}
+}
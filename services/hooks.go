@@ -0,0 +1,434 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// 请求钩子：转发前（pre_request）与收到响应后（post_response）运行用户脚本，用于自定义鉴权、改写请求与自定义日志。
+// 脚本可以是可执行文件或 WASI 模块（.wasm），通过标准输入接收 JSON，通过标准输出返回 JSON：
+//   - pre_request 输入包含平台、provider、模型、目标地址、请求头（含 API Key）与请求体；
+//     输出可设置请求头（值为空表示删除）、替换请求体，或拒绝请求（reject）。输出为空表示不修改。
+//   - post_response 输入包含状态码、耗时、token 用量与错误信息，在后台运行，输出被忽略。
+// 每次运行都有时间上限，WASI 模块另有内存上限。钩子出错时默认按原请求继续，FailClosed 时拒绝请求。
+// 钩子看到的是经过模型映射与护栏处理后的请求；被钩子拒绝的请求不计入 provider 失败次数。
+
+// 钩子阶段
+const (
+	HookStagePreRequest   = "pre_request"
+	HookStagePostResponse = "post_response"
+)
+
+// 钩子类型
+const (
+	HookTypeCommand = "command"
+	HookTypeWASM    = "wasm"
+)
+
+const (
+	hookDefaultTimeout = time.Second
+	hookMaxTimeout     = 30 * time.Second
+	hookMaxOutputBytes = 32 << 20
+	hookMaxStderrBytes = 4 << 10
+	// hookWASMMemoryPages WASI 模块内存上限（每页 64KB，共 256MB）
+	hookWASMMemoryPages = 4096
+	// hookRejectedKey 请求已被钩子拒绝（响应已写出）
+	hookRejectedKey = "codeswitch.hookRejected"
+)
+
+// RelayHooksConfig 请求钩子配置
+type RelayHooksConfig struct {
+	Enabled bool        `json:"enabled"`         // 是否运行钩子
+	Hooks   []RelayHook `json:"hooks,omitempty"` // 按顺序运行，前一个钩子的修改对后一个可见
+}
+
+// RelayHook 单个钩子
+type RelayHook struct {
+	Name       string   `json:"name"`
+	Stage      string   `json:"stage"`               // pre_request / post_response
+	Type       string   `json:"type,omitempty"`      // command / wasm，为空时按扩展名判断
+	Path       string   `json:"path"`                // 可执行文件或 .wasm 的绝对路径
+	Args       []string `json:"args,omitempty"`      // 命令行参数
+	Platforms  []string `json:"platforms,omitempty"` // 生效的平台（claude/codex/gemini），为空表示全部
+	TimeoutMs  int      `json:"timeoutMs,omitempty"` // 单次运行时间上限（毫秒），默认 1000，最大 30000
+	FailClosed bool     `json:"failClosed"`          // 钩子出错时拒绝请求（默认按原请求继续）
+	Disabled   bool     `json:"disabled,omitempty"`  // 暂停该钩子
+}
+
+// hookInput 传给钩子的 JSON
+type hookInput struct {
+	Stage      string            `json:"stage"`
+	Platform   string            `json:"platform"`
+	Provider   string            `json:"provider"`
+	Model      string            `json:"model"`
+	URL        string            `json:"url,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       json.RawMessage   `json:"body,omitempty"`
+	Status     int               `json:"status,omitempty"`
+	DurationMs int64             `json:"durationMs,omitempty"`
+	Stream     bool              `json:"stream,omitempty"`
+	Usage      *hookUsage        `json:"usage,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+type hookUsage struct {
+	InputTokens       int `json:"inputTokens"`
+	OutputTokens      int `json:"outputTokens"`
+	CacheCreateTokens int `json:"cacheCreateTokens"`
+	CacheReadTokens   int `json:"cacheReadTokens"`
+	ReasoningTokens   int `json:"reasoningTokens"`
+}
+
+// hookOutput pre_request 钩子的返回
+type hookOutput struct {
+	Headers map[string]string `json:"headers,omitempty"` // 设置请求头，值为空表示删除
+	Body    json.RawMessage   `json:"body,omitempty"`    // 替换请求体
+	Reject  *hookReject       `json:"reject,omitempty"`  // 拒绝请求
+}
+
+type hookReject struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// HookTestResult 测试钩子的结果
+type HookTestResult struct {
+	Output     string `json:"output"`
+	Stderr     string `json:"stderr,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+func (h RelayHook) hookType() string {
+	if h.Type != "" {
+		return h.Type
+	}
+	if strings.EqualFold(filepath.Ext(h.Path), ".wasm") {
+		return HookTypeWASM
+	}
+	return HookTypeCommand
+}
+
+func (h RelayHook) timeout() time.Duration {
+	if h.TimeoutMs <= 0 {
+		return hookDefaultTimeout
+	}
+	return time.Duration(h.TimeoutMs) * time.Millisecond
+}
+
+func (h RelayHook) appliesTo(stage, platform string) bool {
+	return !h.Disabled && h.Stage == stage && (len(h.Platforms) == 0 || slices.Contains(h.Platforms, platform))
+}
+
+// validateHooksConfig 校验钩子配置（不检查脚本是否存在，运行时出错会记录日志）
+func validateHooksConfig(config RelayHooksConfig) error {
+	names := make(map[string]bool, len(config.Hooks))
+	for _, hook := range config.Hooks {
+		if strings.TrimSpace(hook.Name) == "" {
+			return fmt.Errorf("钩子名称不能为空")
+		}
+		if names[hook.Name] {
+			return fmt.Errorf("钩子名称重复: %s", hook.Name)
+		}
+		names[hook.Name] = true
+		if hook.Stage != HookStagePreRequest && hook.Stage != HookStagePostResponse {
+			return fmt.Errorf("钩子 %s 的阶段无效: %s（可选值: pre_request、post_response）", hook.Name, hook.Stage)
+		}
+		if hook.Type != "" && hook.Type != HookTypeCommand && hook.Type != HookTypeWASM {
+			return fmt.Errorf("钩子 %s 的类型无效: %s（可选值: command、wasm）", hook.Name, hook.Type)
+		}
+		if !filepath.IsAbs(hook.Path) {
+			return fmt.Errorf("钩子 %s 的路径必须是绝对路径", hook.Name)
+		}
+		if hook.TimeoutMs < 0 || time.Duration(hook.TimeoutMs)*time.Millisecond > hookMaxTimeout {
+			return fmt.Errorf("钩子 %s 的时间上限必须在 0-%d 毫秒之间", hook.Name, hookMaxTimeout.Milliseconds())
+		}
+		for _, platform := range hook.Platforms {
+			if platform != "claude" && platform != "codex" && platform != "gemini" {
+				return fmt.Errorf("钩子 %s 的平台无效: %s", hook.Name, platform)
+			}
+		}
+	}
+	return nil
+}
+
+// limitedBuffer 超过上限后写入失败，避免钩子输出占满内存
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("钩子输出超过 %d 字节", b.limit)
+	}
+	return b.Buffer.Write(p)
+}
+
+// runHook 运行钩子，返回标准输出与标准错误（WASI 模块的编译时间不计入时间上限，编译结果会缓存）
+func runHook(ctx context.Context, hook RelayHook, input []byte) ([]byte, string, error) {
+	var runtime wazero.Runtime
+	var compiled wazero.CompiledModule
+	if hook.hookType() == HookTypeWASM {
+		var err error
+		if runtime, compiled, err = compileWASMHook(ctx, hook.Path); err != nil {
+			return nil, "", err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hook.timeout())
+	defer cancel()
+	stdout := &limitedBuffer{limit: hookMaxOutputBytes}
+	stderr := &limitedBuffer{limit: hookMaxStderrBytes}
+
+	var err error
+	if compiled != nil {
+		err = runWASMHook(ctx, runtime, compiled, hook, input, stdout, stderr)
+	} else {
+		cmd := exec.CommandContext(ctx, hook.Path, hook.Args...)
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		err = cmd.Run()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("钩子 %s 运行超过 %s", hook.Name, hook.timeout())
+	}
+	return stdout.Bytes(), stderr.String(), err
+}
+
+// wasmHooks WASI 运行时与已编译模块（按路径、修改时间与大小缓存）
+var wasmHooks struct {
+	mu       sync.Mutex
+	runtime  wazero.Runtime
+	compiled map[string]wasmCompiledHook
+}
+
+type wasmCompiledHook struct {
+	module  wazero.CompiledModule
+	modTime time.Time
+	size    int64
+}
+
+func compileWASMHook(ctx context.Context, path string) (wazero.Runtime, wazero.CompiledModule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	wasmHooks.mu.Lock()
+	defer wasmHooks.mu.Unlock()
+	if wasmHooks.runtime == nil {
+		config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true).WithMemoryLimitPages(hookWASMMemoryPages)
+		runtime := wazero.NewRuntimeWithConfig(context.Background(), config)
+		if _, err := wasi_snapshot_preview1.Instantiate(context.Background(), runtime); err != nil {
+			return nil, nil, err
+		}
+		wasmHooks.runtime = runtime
+		wasmHooks.compiled = make(map[string]wasmCompiledHook)
+	}
+	if cached, ok := wasmHooks.compiled[path]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return wasmHooks.runtime, cached.module, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	module, err := wasmHooks.runtime.CompileModule(ctx, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("编译 WASM 钩子失败: %w", err)
+	}
+	wasmHooks.compiled[path] = wasmCompiledHook{module: module, modTime: info.ModTime(), size: info.Size()}
+	return wasmHooks.runtime, module, nil
+}
+
+func runWASMHook(ctx context.Context, runtime wazero.Runtime, compiled wazero.CompiledModule, hook RelayHook, input []byte, stdout, stderr *limitedBuffer) error {
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(append([]string{hook.Name}, hook.Args...)...).
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(stdout).
+		WithStderr(stderr)
+	module, err := runtime.InstantiateModule(ctx, compiled, config)
+	if module != nil {
+		_ = module.Close(context.Background())
+	}
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 0 {
+		return nil
+	}
+	return err
+}
+
+// hookBody 请求体为 JSON 时原样传给钩子
+func hookBody(body []byte) json.RawMessage {
+	if len(body) == 0 || !json.Valid(body) {
+		return nil
+	}
+	return body
+}
+
+// runPreRequestHooks 依次运行转发前钩子，修改请求头与请求体；钩子拒绝时返回错误
+func runPreRequestHooks(ctx context.Context, config RelayHooksConfig, kind, provider, model, targetURL string, headers map[string]string, body []byte) ([]byte, *hookReject, error) {
+	if !config.Enabled {
+		return body, nil, nil
+	}
+	for _, hook := range config.Hooks {
+		if !hook.appliesTo(HookStagePreRequest, kind) {
+			continue
+		}
+		input, _ := json.Marshal(hookInput{
+			Stage:    HookStagePreRequest,
+			Platform: kind,
+			Provider: provider,
+			Model:    model,
+			URL:      targetURL,
+			Headers:  headers,
+			Body:     hookBody(body),
+		})
+		stdout, stderr, err := runHook(ctx, hook, input)
+		var output hookOutput
+		if err == nil && len(bytes.TrimSpace(stdout)) > 0 {
+			if jsonErr := json.Unmarshal(stdout, &output); jsonErr != nil {
+				err = fmt.Errorf("钩子输出不是有效的 JSON: %w", jsonErr)
+			}
+		}
+		if err != nil {
+			fmt.Printf("[HOOK] ⚠️ 钩子 %s 运行失败: %v %s\n", hook.Name, err, strings.TrimSpace(stderr))
+			if hook.FailClosed {
+				return body, nil, fmt.Errorf("钩子 %s 运行失败: %w", hook.Name, err)
+			}
+			continue
+		}
+		if output.Reject != nil {
+			if output.Reject.Status < 400 || output.Reject.Status > 599 {
+				output.Reject.Status = http.StatusForbidden
+			}
+			if output.Reject.Message == "" {
+				output.Reject.Message = fmt.Sprintf("请求被钩子 %s 拒绝", hook.Name)
+			}
+			fmt.Printf("[HOOK] 🚫 钩子 %s 拒绝请求: %d %s\n", hook.Name, output.Reject.Status, output.Reject.Message)
+			return body, output.Reject, nil
+		}
+		for key, value := range output.Headers {
+			// 请求头大小写不敏感，先删除同名的其他写法
+			for existing := range headers {
+				if strings.EqualFold(existing, key) {
+					delete(headers, existing)
+				}
+			}
+			if value != "" {
+				headers[key] = value
+			}
+		}
+		if len(output.Body) > 0 {
+			body = output.Body
+		}
+	}
+	return body, nil, nil
+}
+
+// runPostResponseHooks 在后台运行响应后钩子（输出被忽略）
+func runPostResponseHooks(kind string, requestLog *ReqeustLog, errMsg string) {
+	config := currentRelayConfig().Hooks
+	if !config.Enabled {
+		return
+	}
+	var hooks []RelayHook
+	for _, hook := range config.Hooks {
+		if hook.appliesTo(HookStagePostResponse, kind) {
+			hooks = append(hooks, hook)
+		}
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	input, _ := json.Marshal(hookInput{
+		Stage:      HookStagePostResponse,
+		Platform:   kind,
+		Provider:   requestLog.Provider,
+		Model:      requestLog.Model,
+		Status:     requestLog.HttpCode,
+		DurationMs: int64(requestLog.DurationSec * 1000),
+		Stream:     requestLog.IsStream,
+		Usage: &hookUsage{
+			InputTokens:       requestLog.InputTokens,
+			OutputTokens:      requestLog.OutputTokens,
+			CacheCreateTokens: requestLog.CacheCreateTokens,
+			CacheReadTokens:   requestLog.CacheReadTokens,
+			ReasoningTokens:   requestLog.ReasoningTokens,
+		},
+		Error: errMsg,
+	})
+	go func() {
+		for _, hook := range hooks {
+			if _, stderr, err := runHook(context.Background(), hook, input); err != nil {
+				fmt.Printf("[HOOK] ⚠️ 钩子 %s 运行失败: %v %s\n", hook.Name, err, strings.TrimSpace(stderr))
+			}
+		}
+	}()
+}
+
+// errorString 错误信息，nil 时为空
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// rejectByHook 钩子拒绝或（FailClosed）出错时向客户端返回错误，并标记请求已处理
+func rejectByHook(c *gin.Context, kind string, reject *hookReject, err error) {
+	c.Set(hookRejectedKey, true)
+	if err != nil {
+		respondRelayError(c, kind, http.StatusBadGateway, err.Error(), nil)
+		return
+	}
+	respondRelayError(c, kind, reject.Status, reject.Message, nil)
+}
+
+// hookRejected 请求是否已被钩子拒绝（不再尝试其他 provider，也不计入失败次数）
+func hookRejected(c *gin.Context) bool {
+	return c.GetBool(hookRejectedKey)
+}
+
+// TestHook 用示例请求运行钩子并返回原始输出（供前端调试钩子）
+func (ss *SettingsService) TestHook(hook RelayHook, platform string, sampleBody string) (*HookTestResult, error) {
+	if hook.Name == "" {
+		hook.Name = "test"
+	}
+	if err := validateHooksConfig(RelayHooksConfig{Hooks: []RelayHook{hook}}); err != nil {
+		return nil, err
+	}
+	input, _ := json.Marshal(hookInput{
+		Stage:    hook.Stage,
+		Platform: platform,
+		Provider: "example",
+		Model:    "example-model",
+		URL:      "https://api.example.com/v1/messages",
+		Headers:  map[string]string{"Content-Type": "application/json"},
+		Body:     hookBody([]byte(sampleBody)),
+	})
+	start := time.Now()
+	stdout, stderr, err := runHook(context.Background(), hook, input)
+	result := &HookTestResult{Output: string(stdout), Stderr: stderr, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func writeHookScript(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("钩子测试脚本需要 /bin/sh")
+	}
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidateHooksConfig(t *testing.T) {
+	valid := RelayHook{Name: "auth", Stage: HookStagePreRequest, Path: "/usr/local/bin/sign"}
+	if err := validateHooksConfig(RelayHooksConfig{Hooks: []RelayHook{valid}}); err != nil {
+		t.Fatalf("有效配置不应报错: %v", err)
+	}
+	invalid := []RelayHook{
+		{Name: "", Stage: HookStagePreRequest, Path: "/bin/x"},
+		{Name: "a", Stage: "before", Path: "/bin/x"},
+		{Name: "a", Stage: HookStagePreRequest, Path: "relative/x"},
+		{Name: "a", Stage: HookStagePreRequest, Path: "/bin/x", TimeoutMs: 60000},
+		{Name: "a", Stage: HookStagePreRequest, Path: "/bin/x", Platforms: []string{"openai"}},
+	}
+	for _, hook := range invalid {
+		if err := validateHooksConfig(RelayHooksConfig{Hooks: []RelayHook{hook}}); err == nil {
+			t.Errorf("%+v 应校验失败", hook)
+		}
+	}
+	if err := validateHooksConfig(RelayHooksConfig{Hooks: []RelayHook{valid, valid}}); err == nil {
+		t.Error("重复的钩子名称应校验失败")
+	}
+}
+
+func TestRunPreRequestHooks(t *testing.T) {
+	path := writeHookScript(t, `cat > /dev/null; echo '{"headers":{"authorization":"Signed abc","X-Trace":"1"},"body":{"model":"rewritten"}}'`)
+	config := RelayHooksConfig{Enabled: true, Hooks: []RelayHook{{Name: "sign", Stage: HookStagePreRequest, Path: path, TimeoutMs: 5000}}}
+	headers := map[string]string{"Authorization": "Bearer sk-test"}
+
+	body, reject, err := runPreRequestHooks(context.Background(), config, "claude", "p", "m", "https://x", headers, []byte(`{"model":"m"}`))
+	if err != nil || reject != nil {
+		t.Fatalf("钩子不应失败: %v %v", err, reject)
+	}
+	if string(body) != `{"model":"rewritten"}` {
+		t.Errorf("请求体应被替换，得到 %s", body)
+	}
+	if headers["authorization"] != "Signed abc" || headers["Authorization"] != "" || headers["X-Trace"] != "1" {
+		t.Errorf("请求头应按大小写不敏感替换: %v", headers)
+	}
+}
+
+func TestRunPreRequestHooksRejectAndFailure(t *testing.T) {
+	reject := writeHookScript(t, `cat > /dev/null; echo '{"reject":{"status":451,"message":"blocked"}}'`)
+	config := RelayHooksConfig{Enabled: true, Hooks: []RelayHook{{Name: "dlp", Stage: HookStagePreRequest, Path: reject, TimeoutMs: 5000}}}
+	_, rejected, err := runPreRequestHooks(context.Background(), config, "codex", "p", "m", "", map[string]string{}, nil)
+	if err != nil || rejected == nil || rejected.Status != 451 {
+		t.Errorf("钩子应拒绝请求: %v %+v", err, rejected)
+	}
+
+	failing := writeHookScript(t, `exit 3`)
+	hook := RelayHook{Name: "broken", Stage: HookStagePreRequest, Path: failing, TimeoutMs: 5000}
+	config.Hooks = []RelayHook{hook}
+	if body, _, err := runPreRequestHooks(context.Background(), config, "codex", "p", "m", "", map[string]string{}, []byte(`{}`)); err != nil || string(body) != `{}` {
+		t.Errorf("默认出错时按原请求继续: %v %s", err, body)
+	}
+	hook.FailClosed = true
+	config.Hooks = []RelayHook{hook}
+	if _, _, err := runPreRequestHooks(context.Background(), config, "codex", "p", "m", "", map[string]string{}, nil); err == nil {
+		t.Error("FailClosed 时出错应拒绝请求")
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// meteredCacheTTL 计费网络检测结果的缓存时间（检测需要调用系统命令）
+const meteredCacheTTL = 5 * time.Minute
+
+// relayActivityTracker 统计中继的在途请求与最近一次请求时间，用于判断是否空闲
+type relayActivityTracker struct {
+	inflight    atomic.Int64
+	lastRequest atomic.Int64 // UnixMilli
+}
+
+var globalRelayActivity = &relayActivityTracker{}
+
+// relayActivityMiddleware 记录中继请求活动（后台测速据此避开繁忙时段）
+func relayActivityMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		globalRelayActivity.inflight.Add(1)
+		globalRelayActivity.lastRequest.Store(time.Now().UnixMilli())
+		defer func() {
+			globalRelayActivity.inflight.Add(-1)
+			globalRelayActivity.lastRequest.Store(time.Now().UnixMilli())
+		}()
+		c.Next()
+	}
+}
+
+// BackgroundTestState 后台测速调度状态
+type BackgroundTestState struct {
+	Deferred         bool   `json:"deferred"`         // 当前是否推迟后台测速
+	Reason           string `json:"reason,omitempty"` // 推迟原因
+	Metered          bool   `json:"metered"`          // 是否为计费网络
+	MeteredSource    string `json:"meteredSource,omitempty"`
+	InflightRequests int64  `json:"inflightRequests"` // 中继在途请求数
+	IdleSeconds      int64  `json:"idleSeconds"`      // 距最近一次中继请求的秒数，-1 表示启动后尚无请求
+}
+
+// backgroundTestGate 决定后台测速是否应当推迟
+type backgroundTestGate struct {
+	mu            sync.Mutex
+	deferredSince time.Time
+	metered       bool
+	meteredSource string
+	meteredAt     time.Time
+	detecting     bool                         // 检测进行中，其他调用直接使用上次结果，不重复启动系统命令
+	detect        func() (bool, string, error) // 计费网络检测（测试时替换）
+}
+
+// state 计算当前调度状态
+func (g *backgroundTestGate) state(config RelayBackgroundTestConfig, now time.Time) BackgroundTestState {
+	state := BackgroundTestState{
+		InflightRequests: globalRelayActivity.inflight.Load(),
+		IdleSeconds:      -1,
+	}
+	if last := globalRelayActivity.lastRequest.Load(); last > 0 {
+		state.IdleSeconds = int64(now.Sub(time.UnixMilli(last)).Seconds())
+	}
+
+	switch {
+	case config.TreatAsMetered:
+		state.Metered, state.MeteredSource = true, "user"
+	case config.DetectMetered:
+		state.Metered, state.MeteredSource = g.detectMetered(now)
+	}
+
+	switch {
+	case state.Metered:
+		state.Deferred = true
+		state.Reason = "当前为计费网络，暂停后台测速"
+	case config.DeferWhenBusy && state.InflightRequests > 0:
+		state.Deferred = true
+		state.Reason = fmt.Sprintf("中继有 %d 个请求正在处理", state.InflightRequests)
+	case config.DeferWhenBusy && state.IdleSeconds >= 0 && state.IdleSeconds < int64(config.IdleSeconds):
+		state.Deferred = true
+		state.Reason = fmt.Sprintf("中继 %d 秒前仍有请求，等待空闲", state.IdleSeconds)
+	}
+	return state
+}
+
+// shouldDefer 判断本轮后台测速是否推迟
+// 因中继繁忙推迟超过 MaxDeferMinutes 后强制执行一次，避免持续繁忙时永远不测；计费网络不受此限制
+func (g *backgroundTestGate) shouldDefer(config RelayBackgroundTestConfig) (bool, string) {
+	now := time.Now()
+	state := g.state(config, now)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !state.Deferred {
+		g.deferredSince = time.Time{}
+		return false, ""
+	}
+	if state.Metered {
+		return true, state.Reason
+	}
+	if g.deferredSince.IsZero() {
+		g.deferredSince = now
+	}
+	if config.MaxDeferMinutes > 0 && now.Sub(g.deferredSince) >= time.Duration(config.MaxDeferMinutes)*time.Minute {
+		g.deferredSince = time.Time{}
+		return false, ""
+	}
+	return true, state.Reason
+}
+
+// detectMetered 检测当前网络是否计费（结果缓存一段时间，同一时刻只执行一次检测）
+func (g *backgroundTestGate) detectMetered(now time.Time) (bool, string) {
+	g.mu.Lock()
+	if g.detecting || (!g.meteredAt.IsZero() && now.Sub(g.meteredAt) < meteredCacheTTL) {
+		metered, source := g.metered, g.meteredSource
+		g.mu.Unlock()
+		return metered, source
+	}
+	g.detecting = true
+	detect := g.detect
+	g.mu.Unlock()
+
+	if detect == nil {
+		detect = detectMeteredConnection
+	}
+	metered, source, err := detect()
+	if err != nil {
+		// 检测失败按非计费处理，不影响测速
+		fmt.Printf("[WARN] 检测计费网络失败: %v\n", err)
+	}
+
+	g.mu.Lock()
+	g.metered, g.meteredSource, g.meteredAt = metered, source, now
+	g.detecting = false
+	g.mu.Unlock()
+	return metered, source
+}
+
+// detectMeteredConnection 检测系统当前连接是否为计费网络
+func detectMeteredConnection() (bool, string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return detectMeteredWindows()
+	case "darwin":
+		return detectMeteredDarwin()
+	case "linux":
+		return detectMeteredLinux()
+	default:
+		return false, "", nil
+	}
+}
+
+// Windows 实现：读取 WinRT 网络连接费用类型（Fixed/Variable 为计费网络）
+func detectMeteredWindows() (bool, string, error) {
+	script := `[void][Windows.Networking.Connectivity.NetworkInformation,Windows.Networking.Connectivity,ContentType=WindowsRuntime];` +
+		`$p=[Windows.Networking.Connectivity.NetworkInformation]::GetInternetConnectionProfile();` +
+		`if($p){$p.GetConnectionCost().NetworkCostType}`
+	out, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-Command", script).Output()
+	if err != nil {
+		return false, "", fmt.Errorf("执行 PowerShell 失败: %w", err)
+	}
+	costType := strings.TrimSpace(string(out))
+	switch costType {
+	case "Fixed", "Variable":
+		return true, "windows:" + costType, nil
+	default:
+		return false, "", nil
+	}
+}
+
+// macOS 启发式：默认路由走 iPhone 个人热点（172.20.10.0/28）或 DHCP 标记了 ANDROID_METERED
+func detectMeteredDarwin() (bool, string, error) {
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return false, "", fmt.Errorf("执行 route 失败: %w", err)
+	}
+	iface, gateway := "", ""
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if v, ok := strings.CutPrefix(line, "interface:"); ok {
+			iface = strings.TrimSpace(v)
+		} else if v, ok := strings.CutPrefix(line, "gateway:"); ok {
+			gateway = strings.TrimSpace(v)
+		}
+	}
+
+	_, iphoneHotspot, _ := net.ParseCIDR("172.20.10.0/28")
+	if ip := net.ParseIP(gateway); ip != nil && iphoneHotspot.Contains(ip) {
+		return true, "darwin:iphone-hotspot", nil
+	}
+	if iface != "" {
+		if packet, err := exec.Command("ipconfig", "getpacket", iface).Output(); err == nil &&
+			strings.Contains(string(packet), "ANDROID_METERED") {
+			return true, "darwin:android-hotspot", nil
+		}
+	}
+	return false, "", nil
+}
+
+// Linux 实现：通过 NetworkManager 查询设备的计费标记（未安装时视为非计费）
+func detectMeteredLinux() (bool, string, error) {
+	path, err := exec.LookPath("nmcli")
+	if err != nil {
+		return false, "", nil
+	}
+	out, err := exec.Command(path, "-t", "-g", "GENERAL.METERED", "device", "show").Output()
+	if err != nil {
+		return false, "", fmt.Errorf("执行 nmcli 失败: %w", err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "yes") {
+			return true, "linux:networkmanager", nil
+		}
+	}
+	return false, "", nil
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackgroundTestGateMeteredDetection(t *testing.T) {
+	calls := 0
+	g := &backgroundTestGate{detect: func() (bool, string, error) {
+		calls++
+		return true, "test", nil
+	}}
+
+	// 默认不检测计费网络，不调用系统命令
+	config := DefaultRelayConfig().BackgroundTest
+	now := time.Now()
+	if state := g.state(config, now); state.Metered || calls != 0 {
+		t.Fatalf("默认配置不应检测计费网络: %+v, calls=%d", state, calls)
+	}
+
+	config.DetectMetered = true
+	for i := 0; i < 3; i++ {
+		if state := g.state(config, now.Add(time.Duration(i)*time.Minute)); !state.Metered || !state.Deferred {
+			t.Fatalf("计费网络应推迟后台测速: %+v", state)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("缓存有效期内应只检测一次，实际 %d 次", calls)
+	}
+	g.state(config, now.Add(meteredCacheTTL))
+	if calls != 2 {
+		t.Errorf("缓存过期后应重新检测，实际 %d 次", calls)
+	}
+}
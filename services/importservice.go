@@ -27,6 +27,7 @@ type ConfigImportResult struct {
 	Status            ConfigImportStatus `json:"status"`
 	ImportedProviders int                `json:"imported_providers"`
 	ImportedMCP       int                `json:"imported_mcp"`
+	SecretFindings    []SecretFinding    `json:"secret_findings,omitempty"` // 导入后密钥扫描发现的问题
 }
 
 type ImportService struct {
@@ -118,21 +119,36 @@ func (is *ImportService) ImportFromPath(path string) (ConfigImportResult, error)
 	if err != nil {
 		return result, err
 	}
+	// provider 与 MCP 在同一事务中导入，任一步失败时恢复全部文件
+	tx, err := beginProviderFilesTransaction("导入 cc-switch 配置")
+	if err != nil {
+		return result, err
+	}
 	addedProviders, err := is.importProviders(cfg, pendingProviders)
 	if err != nil {
+		tx.Rollback()
 		return result, err
 	}
-	result.ImportedProviders = addedProviders
 
 	pendingServers, err := is.pendingMCPCandidates(cfg)
 	if err != nil {
+		tx.Rollback()
 		return result, err
 	}
 	addedServers, err := is.importMCPServers(pendingServers)
 	if err != nil {
+		tx.Rollback()
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
 		return result, err
 	}
+	result.ImportedProviders = addedProviders
 	result.ImportedMCP = addedServers
+	if addedProviders > 0 {
+		// 导入的配置可能把密钥填错位置，同时收紧配置文件权限
+		result.SecretFindings = scanSecrets()
+	}
 
 	status, err := is.evaluateStatus(cfg)
 	if err != nil {
@@ -231,11 +247,7 @@ func ccSwitchConfigPath() (string, error) {
 }
 
 func firstRunMarkerPath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(home, ".code-switch", ".import_prompted"), nil
+	return filepath.Join(getConfigDir(), ".import_prompted"), nil
 }
 
 type ccSwitchConfig struct {
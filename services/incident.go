@@ -0,0 +1,208 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// incidentWindow 判定平台级故障的时间窗口：窗口内所有可用 provider 都失败且没有成功请求
+	incidentWindow = 2 * time.Minute
+	// incidentMinProviders 至少有多少个 provider 才做判定（只有一个 provider 时无法区分本地问题与上游故障）
+	incidentMinProviders = 2
+)
+
+// PlatformIncident 平台级故障（所有 provider 同时失败，通常是本机网络或客户端问题）
+type PlatformIncident struct {
+	Platform  string   `json:"platform"`
+	Since     int64    `json:"since"`     // 开始时间（毫秒）
+	Providers []string `json:"providers"` // 窗口内失败的 provider
+}
+
+// platformIncidentState 单个平台的失败情况
+type platformIncidentState struct {
+	failures map[string]time.Time // provider -> 最近一次失败（只保留最近一次成功之后的）
+	since    time.Time            // 故障开始时间，零值表示当前没有故障
+}
+
+// incidentDetector 平台级故障检测：故障期间暂停拉黑，避免本地网络问题把所有 provider 都拉黑
+type incidentDetector struct {
+	mu        sync.Mutex
+	platforms map[string]*platformIncidentState
+}
+
+func newIncidentDetector() *incidentDetector {
+	return &incidentDetector{platforms: make(map[string]*platformIncidentState)}
+}
+
+func (d *incidentDetector) state(platform string) *platformIncidentState {
+	st := d.platforms[platform]
+	if st == nil {
+		st = &platformIncidentState{failures: make(map[string]time.Time)}
+		d.platforms[platform] = st
+	}
+	return st
+}
+
+// recordFailure 记录一次失败；available 为平台当前可用（已启用且未拉黑）的 provider 数
+// 返回是否处于故障中，以及本次是否为故障开始
+func (d *incidentDetector) recordFailure(platform, provider string, available int, now time.Time) (active bool, started bool, providers []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st := d.state(platform)
+	windowStart := now.Add(-incidentWindow)
+	for name, at := range st.failures {
+		if at.Before(windowStart) {
+			delete(st.failures, name)
+		}
+	}
+	// 窗口内没有任何失败，说明之前的故障已经过去（只是没有成功请求来结束它）
+	if !st.since.IsZero() && len(st.failures) == 0 {
+		st.since = time.Time{}
+	}
+	st.failures[provider] = now
+
+	need := available
+	if need < incidentMinProviders {
+		need = incidentMinProviders
+	}
+	if st.since.IsZero() && available > 0 && len(st.failures) >= need {
+		st.since = now
+		started = true
+	}
+	return !st.since.IsZero(), started, st.failingProviders()
+}
+
+// recordSuccess 记录一次成功，结束故障；返回结束的故障（没有故障时为 nil）
+func (d *incidentDetector) recordSuccess(platform string) *PlatformIncident {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st := d.platforms[platform]
+	if st == nil {
+		return nil
+	}
+	var resolved *PlatformIncident
+	if !st.since.IsZero() {
+		resolved = &PlatformIncident{Platform: platform, Since: st.since.UnixMilli(), Providers: st.failingProviders()}
+	}
+	st.failures = make(map[string]time.Time)
+	st.since = time.Time{}
+	return resolved
+}
+
+// active 列出当前处于故障中的平台
+func (d *incidentDetector) active(now time.Time) []PlatformIncident {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	incidents := []PlatformIncident{}
+	windowStart := now.Add(-incidentWindow)
+	for platform, st := range d.platforms {
+		if st.since.IsZero() {
+			continue
+		}
+		recent := false
+		for _, at := range st.failures {
+			if !at.Before(windowStart) {
+				recent = true
+				break
+			}
+		}
+		if recent {
+			incidents = append(incidents, PlatformIncident{Platform: platform, Since: st.since.UnixMilli(), Providers: st.failingProviders()})
+		}
+	}
+	sort.Slice(incidents, func(i, j int) bool { return incidents[i].Platform < incidents[j].Platform })
+	return incidents
+}
+
+func (st *platformIncidentState) failingProviders() []string {
+	names := make([]string, 0, len(st.failures))
+	for name := range st.failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkIncident 记录失败并判断是否处于平台级故障；故障中返回 true，调用方应跳过拉黑
+func (bs *BlacklistService) checkIncident(platform, providerName string) bool {
+	if bs.availableProviders == nil {
+		return false
+	}
+	active, started, providers := bs.incidents.recordFailure(platform, providerName, bs.availableProviders(platform), time.Now())
+	if !active {
+		return false
+	}
+	if started {
+		log.Printf("🌐 %s 平台所有可用 provider 同时失败（%v），判定为本地网络或客户端问题，暂停拉黑", platform, providers)
+		// 故障开始前累计的失败同样来自本地问题，清零以免恢复后立即拉黑
+		for _, name := range providers {
+			if err := GlobalDBQueueShared.Exec(`UPDATE provider_blacklist SET failure_count = 0 WHERE platform = ? AND provider_name = ?`, platform, name); err != nil {
+				log.Printf("⚠️  清零 %s/%s 失败计数失败: %v", platform, name, err)
+			}
+		}
+		recordAudit("blacklist", "platform_incident", platform+" 平台所有 provider 同时失败，已暂停拉黑")
+		if bs.notificationService != nil {
+			bs.notificationService.NotifyLocalConnectivityIssue(platform, providers)
+		}
+	} else {
+		log.Printf("🌐 %s 平台处于本地连接故障中，跳过 %s 的失败计数", platform, providerName)
+	}
+	return true
+}
+
+// resolveIncident 收到成功请求时结束平台级故障
+func (bs *BlacklistService) resolveIncident(platform string) {
+	resolved := bs.incidents.recordSuccess(platform)
+	if resolved == nil {
+		return
+	}
+	log.Printf("🌐 %s 平台已恢复正常，恢复拉黑判定", platform)
+	if bs.notificationService != nil {
+		bs.notificationService.NotifyLocalConnectivityRecovered(platform)
+	}
+}
+
+// GetPlatformIncidents 获取当前的平台级故障（供前端调用）
+func (bs *BlacklistService) GetPlatformIncidents() []PlatformIncident {
+	return bs.incidents.active(time.Now())
+}
+
+// availableProviderCount 平台当前可用（已启用且未拉黑）的 provider 数，用于平台级故障判定
+func (prs *ProviderRelayService) availableProviderCount(platform string) int {
+	var names []string
+	switch platform {
+	case "claude", "codex":
+		providers, err := prs.providerService.LoadProviders(platform)
+		if err != nil {
+			return 0
+		}
+		for _, p := range providers {
+			// 虚拟 provider 的请求记在路由目标上，不单独计数
+			if p.Enabled && !p.isSplitProvider() {
+				names = append(names, p.Name)
+			}
+		}
+	case "gemini":
+		if prs.geminiService == nil {
+			return 0
+		}
+		for _, p := range prs.geminiService.GetProviders() {
+			if p.Enabled {
+				names = append(names, p.Name)
+			}
+		}
+	}
+	count := 0
+	for _, name := range names {
+		if blacklisted, _ := prs.blacklistService.IsBlacklisted(platform, name); !blacklisted {
+			count++
+		}
+	}
+	return count
+}
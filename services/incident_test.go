@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIncidentDetector(t *testing.T) {
+	d := newIncidentDetector()
+	now := time.Unix(1_700_000_000, 0)
+
+	if active, _, _ := d.recordFailure("claude", "a", 3, now); active {
+		t.Fatal("单个 provider 失败不应判定为平台故障")
+	}
+	if active, _, _ := d.recordFailure("claude", "b", 3, now.Add(10*time.Second)); active {
+		t.Fatal("仍有 provider 未失败")
+	}
+	active, started, providers := d.recordFailure("claude", "c", 3, now.Add(20*time.Second))
+	if !active || !started || len(providers) != 3 {
+		t.Fatalf("所有 provider 失败应判定为平台故障: %v %v %v", active, started, providers)
+	}
+	if active, started, _ := d.recordFailure("claude", "a", 3, now.Add(30*time.Second)); !active || started {
+		t.Errorf("故障持续中: active=%v started=%v", active, started)
+	}
+	if got := d.active(now.Add(time.Minute)); len(got) != 1 || got[0].Platform != "claude" {
+		t.Errorf("active() = %+v", got)
+	}
+
+	if resolved := d.recordSuccess("claude"); resolved == nil {
+		t.Fatal("成功请求应结束故障")
+	}
+	if got := d.active(now.Add(time.Minute)); len(got) != 0 {
+		t.Errorf("故障结束后 active() = %+v", got)
+	}
+
+	// 超出时间窗口的失败不计入
+	d.recordFailure("codex", "a", 2, now)
+	if active, _, _ := d.recordFailure("codex", "b", 2, now.Add(incidentWindow+time.Second)); active {
+		t.Error("窗口外的失败不应计入")
+	}
+
+	// 只有一个 provider 时无法区分本地问题
+	if active, _, _ := d.recordFailure("gemini", "a", 1, now); active {
+		t.Error("单 provider 平台不应判定为平台故障")
+	}
+}
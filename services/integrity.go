@@ -0,0 +1,507 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 配置完整性校验：本应用每次写入 ~/.code-switch 下的配置文件后记录其 SHA-256 校验和，并把内容保存到
+// ~/.code-switch/integrity/ 作为恢复点；数据库表结构在建表后同样记录校验和。后台定期比对，发现文件被应用外修改、
+// 内容不是合法 JSON（损坏）或被删除时发送通知，用户可以从恢复点恢复，或接受当前内容作为新的基准。
+// 读取失败的配置可能随后被默认值覆盖，因此发现问题时先固定恢复点，避免之后的写入覆盖最后一份完好的内容。
+
+const (
+	integrityStateFile = "integrity.json"
+	integritySnapshots = "integrity"
+	// integritySchemaName 数据库表结构在检查结果中的名称
+	integritySchemaName = "database-schema"
+	// integrityCheckInterval 后台校验间隔
+	integrityCheckInterval = 10 * time.Minute
+	// integritySettleWindow 刚修改的文件可能正在由本应用写入，跳过本轮校验
+	integritySettleWindow = 5 * time.Second
+	// integrityRestoreTTL 文件恢复正常后，固定的恢复点保留的时间
+	integrityRestoreTTL = 7 * 24 * time.Hour
+)
+
+// 校验结果状态
+const (
+	IntegrityModified      = "modified"       // 文件在应用外被修改
+	IntegrityCorrupted     = "corrupted"      // 文件不是合法 JSON
+	IntegrityMissing       = "missing"        // 文件被删除
+	IntegritySchemaChanged = "schema_changed" // 数据库表结构在应用外被修改
+)
+
+// managedConfigFiles 参与校验的配置文件（位于 ~/.code-switch）
+var managedConfigFiles = []string{
+	"claude-code.json",
+	"codex.json",
+	"gemini-providers.json",
+	"relay-config.json",
+	"app.json",
+	"blacklist-config.json",
+	"mcp.json",
+	"prompts.json",
+	"skill.json",
+	"cli-templates.json",
+	"speedtest-endpoints.json",
+}
+
+// ConfigIntegrityIssue 校验发现的问题
+type ConfigIntegrityIssue struct {
+	Name       string `json:"name"` // 文件名，数据库表结构为 database-schema
+	Path       string `json:"path"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	CanRestore bool   `json:"canRestore"` // 是否有可用的恢复点
+	DetectedAt int64  `json:"detectedAt"` // 毫秒
+	hash       string // 发现问题时的文件校验和，同一内容只通知一次
+}
+
+// integrityRecord 文件最近一次由本应用写入时的校验和
+type integrityRecord struct {
+	Hash       string `json:"hash"`
+	Size       int64  `json:"size"`
+	RecordedAt int64  `json:"recordedAt"` // 毫秒
+}
+
+// integrityState integrity.json 的内容
+type integrityState struct {
+	Files  map[string]integrityRecord `json:"files"`
+	Schema map[string]string          `json:"schema,omitempty"` // 表/索引名 → 建表语句的校验和
+}
+
+var integrityMu sync.Mutex
+
+func integrityStatePath() string {
+	return filepath.Join(getConfigDir(), integrityStateFile)
+}
+
+// integritySnapshotPath 文件最近一次写入内容的副本
+func integritySnapshotPath(name string) string {
+	return filepath.Join(getConfigDir(), integritySnapshots, name)
+}
+
+// integrityRestorePath 发现问题时固定的恢复点，之后的写入不会覆盖
+func integrityRestorePath(name string) string {
+	return integritySnapshotPath(name) + ".restore"
+}
+
+func isManagedConfigFile(name string) bool {
+	for _, managed := range managedConfigFiles {
+		if managed == name {
+			return true
+		}
+	}
+	return false
+}
+
+func loadIntegrityStateLocked() integrityState {
+	state := integrityState{Files: map[string]integrityRecord{}}
+	data, err := os.ReadFile(integrityStatePath())
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("⚠️  integrity.json 无效，将重新记录校验和: %v", err)
+		return integrityState{Files: map[string]integrityRecord{}}
+	}
+	if state.Files == nil {
+		state.Files = map[string]integrityRecord{}
+	}
+	return state
+}
+
+func saveIntegrityStateLocked(state integrityState) error {
+	return AtomicWriteJSON(integrityStatePath(), state)
+}
+
+// recordConfigIntegrity 本应用写入配置文件后调用：记录校验和并保存恢复点
+func recordConfigIntegrity(path string) {
+	name := filepath.Base(path)
+	if !isManagedConfigFile(name) || filepath.Dir(path) != getConfigDir() {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !json.Valid(data) {
+		return
+	}
+	integrityMu.Lock()
+	defer integrityMu.Unlock()
+	if err := recordIntegrityLocked(name, data); err != nil {
+		log.Printf("⚠️  记录 %s 校验和失败: %v", name, err)
+	}
+}
+
+func recordIntegrityLocked(name string, data []byte) error {
+	state := loadIntegrityStateLocked()
+	state.Files[name] = integrityRecord{Hash: contentHash(data), Size: int64(len(data)), RecordedAt: time.Now().UnixMilli()}
+	if err := AtomicWriteBytes(integritySnapshotPath(name), data); err != nil {
+		return err
+	}
+	return saveIntegrityStateLocked(state)
+}
+
+// pinRestorePointLocked 发现问题时把最近一次完好的副本固定为恢复点（已有恢复点时保留原恢复点）
+func pinRestorePointLocked(name string) bool {
+	if FileExists(integrityRestorePath(name)) {
+		return true
+	}
+	data, err := os.ReadFile(integritySnapshotPath(name))
+	if err != nil || !json.Valid(data) {
+		return false
+	}
+	if err := AtomicWriteBytes(integrityRestorePath(name), data); err != nil {
+		log.Printf("⚠️  固定 %s 的恢复点失败: %v", name, err)
+		return false
+	}
+	return true
+}
+
+// clearStaleRestorePoint 文件已恢复正常且恢复点超过保留期限时删除恢复点
+func clearStaleRestorePoint(name string, now time.Time) {
+	info, err := os.Stat(integrityRestorePath(name))
+	if err == nil && now.Sub(info.ModTime()) > integrityRestoreTTL {
+		_ = os.Remove(integrityRestorePath(name))
+	}
+}
+
+// verifyConfigFiles 比对配置文件与记录的校验和；未记录过的合法文件以当前内容为基准
+func verifyConfigFiles(now time.Time) []ConfigIntegrityIssue {
+	integrityMu.Lock()
+	defer integrityMu.Unlock()
+	state := loadIntegrityStateLocked()
+	var issues []ConfigIntegrityIssue
+	for _, name := range managedConfigFiles {
+		path := filepath.Join(getConfigDir(), name)
+		record, tracked := state.Files[name]
+		issue := ConfigIntegrityIssue{Name: name, Path: path, DetectedAt: now.UnixMilli()}
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			if tracked {
+				issue.Status, issue.Detail = IntegrityMissing, "文件已被删除"
+				issue.CanRestore = pinRestorePointLocked(name)
+				issues = append(issues, issue)
+			}
+			continue
+		}
+		if err != nil || now.Sub(info.ModTime()) < integritySettleWindow {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		issue.hash = contentHash(data)
+		switch {
+		case tracked && issue.hash == record.Hash:
+			clearStaleRestorePoint(name, now)
+			continue
+		case len(data) == 0 && !tracked:
+			continue
+		case !json.Valid(data):
+			issue.Status = IntegrityCorrupted
+			issue.Detail = fmt.Sprintf("文件不是合法 JSON（%d 字节），读取时会回退为默认配置", len(data))
+		case !tracked:
+			if err := recordIntegrityLocked(name, data); err != nil {
+				log.Printf("⚠️  记录 %s 校验和失败: %v", name, err)
+			}
+			continue
+		default:
+			issue.Status = IntegrityModified
+			issue.Detail = fmt.Sprintf("文件在应用外被修改（%d → %d 字节）", record.Size, len(data))
+		}
+		issue.CanRestore = pinRestorePointLocked(name) || latestValidBackup(path) != ""
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// latestValidBackup 查找内容是合法 JSON 的最新 *.bak.<时间戳> 备份（跳过保存下来的损坏文件）
+func latestValidBackup(path string) string {
+	backups, _ := filepath.Glob(path + ".bak.*")
+	modTimes := make(map[string]time.Time, len(backups))
+	for _, backup := range backups {
+		if info, err := os.Stat(backup); err == nil {
+			modTimes[backup] = info.ModTime()
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return modTimes[backups[i]].After(modTimes[backups[j]]) })
+	for _, backup := range backups {
+		if data, err := os.ReadFile(backup); err == nil && len(data) > 0 && json.Valid(data) {
+			return backup
+		}
+	}
+	return ""
+}
+
+// configRestoreSource 配置文件可用的恢复来源：固定的恢复点、最近一次写入的副本、最新的有效备份
+func configRestoreSource(name, path string) string {
+	for _, candidate := range []string{integrityRestorePath(name), integritySnapshotPath(name)} {
+		if data, err := os.ReadFile(candidate); err == nil && json.Valid(data) {
+			return candidate
+		}
+	}
+	return latestValidBackup(path)
+}
+
+// currentSchemaChecksums 读取数据库中各表与索引的建表语句校验和
+func currentSchemaChecksums() (map[string]string, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT type, name, COALESCE(sql, '') FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	schema := map[string]string{}
+	for rows.Next() {
+		var kind, name, sql string
+		if err := rows.Scan(&kind, &name, &sql); err != nil {
+			return nil, err
+		}
+		schema[kind+":"+name] = contentHash([]byte(sql))
+	}
+	return schema, rows.Err()
+}
+
+// recordSchemaIntegrity 建表完成后记录数据库表结构的校验和
+func recordSchemaIntegrity() {
+	schema, err := currentSchemaChecksums()
+	if err != nil {
+		log.Printf("⚠️  读取数据库表结构失败: %v", err)
+		return
+	}
+	integrityMu.Lock()
+	defer integrityMu.Unlock()
+	state := loadIntegrityStateLocked()
+	state.Schema = schema
+	if err := saveIntegrityStateLocked(state); err != nil {
+		log.Printf("⚠️  记录数据库表结构校验和失败: %v", err)
+	}
+}
+
+// diffSchema 比较记录的表结构与当前表结构，返回变化的表/索引
+func diffSchema(recorded, current map[string]string) []string {
+	var changed []string
+	for name, hash := range recorded {
+		if current[name] == "" {
+			changed = append(changed, name+"（已删除）")
+		} else if current[name] != hash {
+			changed = append(changed, name+"（已修改）")
+		}
+	}
+	for name := range current {
+		if _, ok := recorded[name]; !ok {
+			changed = append(changed, name+"（新增）")
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// verifySchema 比对数据库表结构；数据库未初始化或尚未记录时不检查
+func verifySchema(now time.Time) *ConfigIntegrityIssue {
+	if GlobalDBQueue == nil {
+		return nil
+	}
+	integrityMu.Lock()
+	recorded := loadIntegrityStateLocked().Schema
+	integrityMu.Unlock()
+	if len(recorded) == 0 {
+		return nil
+	}
+	current, err := currentSchemaChecksums()
+	if err != nil {
+		return nil
+	}
+	changed := diffSchema(recorded, current)
+	if len(changed) == 0 {
+		return nil
+	}
+	detail := strings.Join(changed, "、")
+	return &ConfigIntegrityIssue{
+		Name:       integritySchemaName,
+		Path:       filepath.Join(getConfigDir(), "app.db"),
+		Status:     IntegritySchemaChanged,
+		Detail:     "数据库表结构在应用外被修改: " + detail,
+		DetectedAt: now.UnixMilli(),
+		hash:       contentHash([]byte(detail)),
+	}
+}
+
+// IntegrityService 定期校验配置文件与数据库表结构
+type IntegrityService struct {
+	notificationService *NotificationService
+	mu                  sync.Mutex
+	issues              []ConfigIntegrityIssue
+	alerted             map[string]string // 已通知的问题（名称 → 校验和）
+}
+
+func NewIntegrityService(notificationService *NotificationService) *IntegrityService {
+	return &IntegrityService{
+		notificationService: notificationService,
+		issues:              []ConfigIntegrityIssue{},
+		alerted:             make(map[string]string),
+	}
+}
+
+// Start 注册后台定期校验任务
+func (is *IntegrityService) Start() error {
+	scheduleJob(backgroundJob{
+		name:     "integrity",
+		title:    "配置完整性校验",
+		delay:    10 * time.Second,
+		interval: func() time.Duration { return integrityCheckInterval },
+		run: func() error {
+			is.VerifyConfigIntegrity()
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止后台校验
+func (is *IntegrityService) Stop() error {
+	unscheduleJob("integrity")
+	return nil
+}
+
+// GetConfigIntegrity 获取最近一次校验发现的问题（供前端调用）
+func (is *IntegrityService) GetConfigIntegrity() []ConfigIntegrityIssue {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	return append([]ConfigIntegrityIssue{}, is.issues...)
+}
+
+// VerifyConfigIntegrity 立即校验，对新发现的问题发送通知（供前端调用）
+func (is *IntegrityService) VerifyConfigIntegrity() []ConfigIntegrityIssue {
+	now := time.Now()
+	issues := verifyConfigFiles(now)
+	if issue := verifySchema(now); issue != nil {
+		issues = append(issues, *issue)
+	}
+	if issues == nil {
+		issues = []ConfigIntegrityIssue{}
+	}
+
+	is.mu.Lock()
+	current := make(map[string]bool, len(issues))
+	var fresh []ConfigIntegrityIssue
+	for _, issue := range issues {
+		current[issue.Name] = true
+		if is.alerted[issue.Name] != issue.hash+issue.Status {
+			is.alerted[issue.Name] = issue.hash + issue.Status
+			fresh = append(fresh, issue)
+		}
+	}
+	for name := range is.alerted {
+		if !current[name] {
+			delete(is.alerted, name)
+		}
+	}
+	is.issues = issues
+	is.mu.Unlock()
+
+	for _, issue := range fresh {
+		log.Printf("[Integrity] ⚠️  %s: %s", issue.Name, issue.Detail)
+		if is.notificationService != nil {
+			is.notificationService.NotifyConfigIntegrity(issue)
+		}
+	}
+	return append([]ConfigIntegrityIssue{}, issues...)
+}
+
+// RestoreConfigFile 用恢复点（没有时使用最新的 .bak 备份）恢复配置文件，当前内容先备份为 .bak.<时间戳>（供前端调用）
+// provider 与中继配置立即生效，其他配置在应用重启后重新读取
+func (is *IntegrityService) RestoreConfigFile(name string) error {
+	if !isManagedConfigFile(name) {
+		return fmt.Errorf("不支持恢复的文件: %s", name)
+	}
+	path := filepath.Join(getConfigDir(), name)
+	integrityMu.Lock()
+	defer integrityMu.Unlock()
+
+	source := configRestoreSource(name, path)
+	if source == "" {
+		return fmt.Errorf("%s 没有可用的恢复点或备份", name)
+	}
+	backup, err := CreateBackup(path)
+	if err != nil {
+		return err
+	}
+	if err := RestoreBackup(source, path); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := recordIntegrityLocked(name, data); err != nil {
+		return err
+	}
+	_ = os.Remove(integrityRestorePath(name))
+	refreshConfigSnapshot()
+	is.forget(name)
+	detail := fmt.Sprintf("从 %s 恢复 %s", filepath.Base(source), name)
+	if backup != "" {
+		detail += fmt.Sprintf("（原内容备份为 %s）", filepath.Base(backup))
+	}
+	recordAudit("config", "integrity_restore", detail)
+	return nil
+}
+
+// AcceptConfigChange 接受应用外的修改，以当前内容作为新的校验基准（供前端调用）
+// 损坏的文件不能接受，数据库表结构传入 database-schema
+func (is *IntegrityService) AcceptConfigChange(name string) error {
+	if name == integritySchemaName {
+		recordSchemaIntegrity()
+		is.forget(name)
+		recordAudit("config", "integrity_accept", "接受数据库表结构的修改")
+		return nil
+	}
+	if !isManagedConfigFile(name) {
+		return fmt.Errorf("不支持的文件: %s", name)
+	}
+	path := filepath.Join(getConfigDir(), name)
+	integrityMu.Lock()
+	defer integrityMu.Unlock()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("%s 不是合法 JSON，请先恢复或手动修复", name)
+	}
+	if err := recordIntegrityLocked(name, data); err != nil {
+		return err
+	}
+	_ = os.Remove(integrityRestorePath(name))
+	is.forget(name)
+	recordAudit("config", "integrity_accept", fmt.Sprintf("接受 %s 在应用外的修改", name))
+	return nil
+}
+
+// forget 从最近一次校验结果中移除已处理的问题
+func (is *IntegrityService) forget(name string) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	delete(is.alerted, name)
+	kept := is.issues[:0]
+	for _, issue := range is.issues {
+		if issue.Name != name {
+			kept = append(kept, issue)
+		}
+	}
+	is.issues = kept
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyConfigFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "main", APIURL: "https://api.anthropic.com", APIKey: "sk-main"}}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(home, ".code-switch", "claude-code.json")
+	original, _ := os.ReadFile(path)
+	later := time.Now().Add(time.Minute)
+
+	if issues := verifyConfigFiles(later); len(issues) != 0 {
+		t.Fatalf("本应用写入的文件不应报告问题: %+v", issues)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"providers":[]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	issues := verifyConfigFiles(later)
+	if len(issues) != 1 || issues[0].Status != IntegrityModified || !issues[0].CanRestore {
+		t.Fatalf("外部修改应被发现: %+v", issues)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"providers":[`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	issues = verifyConfigFiles(later)
+	if len(issues) != 1 || issues[0].Status != IntegrityCorrupted {
+		t.Fatalf("损坏的文件应被发现: %+v", issues)
+	}
+
+	is := NewIntegrityService(nil)
+	if err := is.AcceptConfigChange("claude-code.json"); err == nil {
+		t.Error("损坏的文件不应被接受")
+	}
+	if err := is.RestoreConfigFile("claude-code.json"); err != nil {
+		t.Fatalf("RestoreConfigFile() error = %v", err)
+	}
+	restored, _ := os.ReadFile(path)
+	if string(restored) != string(original) {
+		t.Errorf("应恢复为最近一次写入的内容:\n%s", restored)
+	}
+	if issues := verifyConfigFiles(later); len(issues) != 0 {
+		t.Errorf("恢复后不应报告问题: %+v", issues)
+	}
+}
+
+func TestDiffSchema(t *testing.T) {
+	recorded := map[string]string{"table:request_log": "a", "table:old": "b", "index:idx": "c"}
+	current := map[string]string{"table:request_log": "a", "index:idx": "x", "table:new": "d"}
+	got := strings.Join(diffSchema(recorded, current), ",")
+	if got != "index:idx（已修改）,table:new（新增）,table:old（已删除）" {
+		t.Errorf("diffSchema() = %s", got)
+	}
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// 后台任务调度：测速、黑名单自动恢复、指标汇总、保留期限清理、状态页检查等定时任务统一注册到调度器，
+// 由一个循环按到期时间触发。调度器记录每个任务的上次/下次运行时间与错误，失败后按退避间隔重试，
+// 前端可查看任务状态、立即运行或暂停任务。
+
+const (
+	jobDisabledRecheck = time.Minute      // 未启用的任务重新检查配置的间隔
+	jobRetryBase       = 30 * time.Second // 首次失败后的重试间隔，之后逐次翻倍
+	jobMaxBackoff      = time.Hour        // 退避间隔上限（任务正常间隔更长时以正常间隔为准）
+	jobStartupGrace    = 10 * time.Second // 调度器启动后推迟所有任务的首次运行，避免与窗口加载争抢资源
+)
+
+// backgroundJob 后台任务定义
+type backgroundJob struct {
+	name     string
+	title    string
+	delay    time.Duration        // 注册后首次运行的延迟
+	interval func() time.Duration // 运行间隔，每轮重新读取；<= 0 表示当前未启用
+	run      func() error
+}
+
+// JobStatus 后台任务状态（用于前端展示）
+type JobStatus struct {
+	Name           string `json:"name"`
+	Title          string `json:"title"`
+	Enabled        bool   `json:"enabled"`
+	Paused         bool   `json:"paused"`
+	Running        bool   `json:"running"`
+	LastRunAt      int64  `json:"lastRunAt"` // 毫秒，0 表示尚未运行
+	LastDurationMs int64  `json:"lastDurationMs"`
+	LastError      string `json:"lastError"`
+	NextRunAt      int64  `json:"nextRunAt"` // 毫秒，暂停或运行中为 0
+	Failures       int    `json:"failures"`  // 连续失败次数
+	Runs           int    `json:"runs"`
+	IntervalSec    int64  `json:"intervalSec"`
+}
+
+type scheduledJob struct {
+	spec   backgroundJob
+	status JobStatus
+	next   time.Time
+}
+
+// JobScheduler 后台任务调度器
+type JobScheduler struct {
+	mu        sync.Mutex
+	jobs      map[string]*scheduledJob
+	order     []string // 注册顺序
+	wake      chan struct{}
+	stopChan  chan struct{}
+	running   bool
+	notBefore time.Time // 启动宽限期结束时间
+}
+
+var globalJobScheduler = newJobScheduler()
+
+func newJobScheduler() *JobScheduler {
+	return &JobScheduler{
+		jobs: make(map[string]*scheduledJob),
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// NewJobScheduler 返回全局调度器（各服务通过 scheduleJob 注册任务）
+func NewJobScheduler() *JobScheduler {
+	return globalJobScheduler
+}
+
+// scheduleJob 注册（或替换同名）后台任务
+func scheduleJob(job backgroundJob) {
+	globalJobScheduler.add(job)
+}
+
+// unscheduleJob 移除后台任务，正在运行的一轮不受影响
+func unscheduleJob(name string) {
+	globalJobScheduler.remove(name)
+}
+
+func (js *JobScheduler) add(job backgroundJob) {
+	js.mu.Lock()
+	existing, ok := js.jobs[job.name]
+	if !ok {
+		existing = &scheduledJob{}
+		js.jobs[job.name] = existing
+		js.order = append(js.order, job.name)
+	}
+	existing.spec = job
+	existing.status.Name = job.name
+	existing.status.Title = job.title
+	existing.next = time.Now().Add(job.delay)
+	js.mu.Unlock()
+	js.notify()
+}
+
+func (js *JobScheduler) remove(name string) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if _, ok := js.jobs[name]; !ok {
+		return
+	}
+	delete(js.jobs, name)
+	for i, n := range js.order {
+		if n == name {
+			js.order = append(js.order[:i], js.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// notify 唤醒调度循环重新计算下一个到期时间
+func (js *JobScheduler) notify() {
+	select {
+	case js.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start 启动调度循环
+func (js *JobScheduler) Start() error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if js.running {
+		return nil
+	}
+	js.stopChan = make(chan struct{})
+	js.running = true
+	js.notBefore = time.Now().Add(jobStartupGrace)
+	go js.loop(js.stopChan)
+	return nil
+}
+
+// Stop 停止调度循环（正在运行的任务会执行完当前一轮）
+func (js *JobScheduler) Stop() error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if js.running {
+		close(js.stopChan)
+		js.running = false
+	}
+	return nil
+}
+
+func (js *JobScheduler) loop(stop <-chan struct{}) {
+	timer := time.NewTimer(jobDisabledRecheck)
+	defer timer.Stop()
+	for {
+		wait := js.dispatch(time.Now())
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-js.wake:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// dispatch 启动所有到期的任务，返回距下一个任务到期的时间
+func (js *JobScheduler) dispatch(now time.Time) time.Duration {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	wait := jobDisabledRecheck
+	for _, name := range js.order {
+		job := js.jobs[name]
+		if job.status.Running || job.status.Paused {
+			continue
+		}
+		if !now.Before(js.dueLocked(job)) {
+			interval := job.spec.interval()
+			job.status.Enabled = interval > 0
+			job.status.IntervalSec = int64(interval / time.Second)
+			if interval <= 0 {
+				job.next = now.Add(jobDisabledRecheck)
+			} else {
+				job.status.Running = true
+				go js.execute(job)
+				continue
+			}
+		}
+		if d := js.dueLocked(job).Sub(now); d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// dueLocked 任务的下次运行时间（不早于启动宽限期结束）
+func (js *JobScheduler) dueLocked(job *scheduledJob) time.Time {
+	if job.next.Before(js.notBefore) {
+		return js.notBefore
+	}
+	return job.next
+}
+
+// execute 运行任务一轮并安排下一次运行（调用前已标记为运行中）
+func (js *JobScheduler) execute(job *scheduledJob) {
+	start := time.Now()
+	err := runJobSafely(job.spec.name, job.spec.run)
+	finished := time.Now()
+
+	js.mu.Lock()
+	status := &job.status
+	status.Running = false
+	status.Runs++
+	status.LastRunAt = start.UnixMilli()
+	status.LastDurationMs = finished.Sub(start).Milliseconds()
+	interval := job.spec.interval()
+	status.Enabled = interval > 0
+	status.IntervalSec = int64(interval / time.Second)
+	delay := interval
+	if err != nil {
+		status.LastError = err.Error()
+		status.Failures++
+		delay = jobBackoff(interval, status.Failures)
+	} else {
+		status.LastError = ""
+		status.Failures = 0
+	}
+	if delay <= 0 {
+		delay = jobDisabledRecheck
+	}
+	job.next = finished.Add(delay)
+	failures := status.Failures
+	js.mu.Unlock()
+	js.notify()
+
+	if err != nil {
+		log.Printf("[Jobs] %s 运行失败（连续 %d 次），%s 后重试: %v", job.spec.name, failures, delay, err)
+	}
+}
+
+// runJobSafely 运行任务，panic 写入崩溃报告并视为运行失败
+func runJobSafely(name string, run func() error) (err error) {
+	if runRecovered("job:"+name, func() { err = run() }) {
+		err = fmt.Errorf("任务发生 panic，已生成崩溃报告")
+	}
+	return err
+}
+
+// jobBackoff 连续失败 failures 次后的重试间隔：30 秒起逐次翻倍，不超过一小时与正常间隔中较大者
+func jobBackoff(interval time.Duration, failures int) time.Duration {
+	limit := jobMaxBackoff
+	if interval > limit {
+		limit = interval
+	}
+	if failures < 1 {
+		failures = 1
+	}
+	delay := jobRetryBase
+	for i := 1; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+func (js *JobScheduler) snapshot(job *scheduledJob) JobStatus {
+	status := job.status
+	if !status.Paused && !status.Running && !job.next.IsZero() {
+		status.NextRunAt = js.dueLocked(job).UnixMilli()
+	}
+	return status
+}
+
+// GetJobs 获取所有后台任务的状态（供前端调用）
+func (js *JobScheduler) GetJobs() []JobStatus {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	jobs := make([]JobStatus, 0, len(js.order))
+	for _, name := range js.order {
+		jobs = append(jobs, js.snapshot(js.jobs[name]))
+	}
+	return jobs
+}
+
+// RunJobNow 在后台立即运行一次任务，返回已标记为运行中的状态；完成情况通过 GetJobs 查看（供前端调用）
+func (js *JobScheduler) RunJobNow(name string) (*JobStatus, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	job, ok := js.jobs[name]
+	if !ok {
+		return nil, fmt.Errorf("后台任务 %s 不存在", name)
+	}
+	if job.status.Running {
+		return nil, fmt.Errorf("后台任务 %s 正在运行", name)
+	}
+	job.status.Running = true
+	go js.execute(job)
+	status := js.snapshot(job)
+	return &status, nil
+}
+
+// SetJobPaused 暂停或恢复任务的定时运行，暂停期间仍可手动运行（供前端调用）
+func (js *JobScheduler) SetJobPaused(name string, paused bool) error {
+	js.mu.Lock()
+	job, ok := js.jobs[name]
+	if !ok {
+		js.mu.Unlock()
+		return fmt.Errorf("后台任务 %s 不存在", name)
+	}
+	changed := job.status.Paused != paused
+	job.status.Paused = paused
+	js.mu.Unlock()
+	js.notify()
+
+	if changed {
+		action := "resume"
+		if paused {
+			action = "pause"
+		}
+		recordAudit("jobs", action, name)
+	}
+	return nil
+}
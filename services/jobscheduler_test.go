@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobBackoff(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{time.Minute, 1, 30 * time.Second},
+		{time.Minute, 3, 2 * time.Minute},
+		{time.Minute, 20, time.Hour},
+		{6 * time.Hour, 20, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := jobBackoff(tt.interval, tt.failures); got != tt.want {
+			t.Errorf("jobBackoff(%s, %d) = %s, want %s", tt.interval, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestJobSchedulerRunNow(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	js := newJobScheduler()
+	fail := true
+	js.add(backgroundJob{
+		name:     "test",
+		title:    "测试",
+		delay:    time.Hour,
+		interval: func() time.Duration { return 10 * time.Minute },
+		run: func() error {
+			if fail {
+				return errors.New("boom")
+			}
+			return nil
+		},
+	})
+
+	status, err := js.RunJobNow("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Running {
+		t.Errorf("立即运行应在后台执行并返回运行中状态: %+v", status)
+	}
+	status = waitJobIdle(t, js, "test")
+	if status.LastError != "boom" || status.Failures != 1 || status.Runs != 1 {
+		t.Errorf("失败后应记录错误与失败次数: %+v", status)
+	}
+	if next := time.UnixMilli(status.NextRunAt); time.Until(next) > time.Minute {
+		t.Errorf("失败后应按退避间隔重试: %s", next)
+	}
+
+	fail = false
+	if _, err := js.RunJobNow("test"); err != nil {
+		t.Fatal(err)
+	}
+	status = waitJobIdle(t, js, "test")
+	if status.LastError != "" || status.Failures != 0 || status.IntervalSec != 600 {
+		t.Errorf("成功后应清除错误: %+v", status)
+	}
+
+	if err := js.SetJobPaused("test", true); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := js.GetJobs(); len(jobs) != 1 || !jobs[0].Paused || jobs[0].NextRunAt != 0 {
+		t.Errorf("暂停后不应有下次运行时间: %+v", jobs)
+	}
+	if _, err := js.RunJobNow("missing"); err == nil {
+		t.Error("不存在的任务应返回错误")
+	}
+}
+
+// waitJobIdle 等待任务本轮运行结束并返回状态
+func waitJobIdle(t *testing.T, js *JobScheduler, name string) *JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, status := range js.GetJobs() {
+			if status.Name == name && !status.Running {
+				return &status
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("任务 %s 未在期限内结束", name)
+	return nil
+}
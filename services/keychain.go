@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// keychainService 钥匙串中条目的服务名
+const keychainService = "CodeSwitch"
+
+// keychainTimeout 单次钥匙串操作的超时（首次访问时系统可能弹窗请求授权）
+const keychainTimeout = 30 * time.Second
+
+// errKeychainUnavailable 当前系统没有可用的钥匙串
+var errKeychainUnavailable = errors.New("当前系统没有可用的钥匙串（macOS Keychain / Windows 凭据管理器 / Secret Service）")
+
+// keychainStore 系统钥匙串（按 account 保存一条密文）
+type keychainStore interface {
+	Set(account, secret string) error
+	Get(account string) (string, error)
+	Delete(account string) error
+}
+
+// systemKeychain 当前使用的钥匙串，测试中可替换
+var systemKeychain keychainStore = osKeychain{}
+
+// osKeychain 通过系统自带的命令行工具访问钥匙串：
+// macOS security、Windows PasswordVault（PowerShell）、Linux secret-tool（libsecret）
+type osKeychain struct{}
+
+func (osKeychain) Set(account, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), keychainTimeout)
+	defer cancel()
+	switch runtime.GOOS {
+	case "darwin":
+		// -U：已存在时更新；-w 放在最后且不带值时 security 从标准输入读取密文（输入两次确认），避免出现在进程参数中
+		cmd := exec.CommandContext(ctx, "security", "add-generic-password", "-U", "-s", keychainService, "-a", account, "-w")
+		cmd.Stdin = strings.NewReader(secret + "\n" + secret + "\n")
+		return runKeychainCommand(cmd)
+	case "windows":
+		cmd := windowsVaultCommand(ctx, `$v.Add((New-Object Windows.Security.Credentials.PasswordCredential($env:CODESWITCH_KEYCHAIN_SERVICE,$env:CODESWITCH_KEYCHAIN_ACCOUNT,$env:CODESWITCH_KEYCHAIN_SECRET)))`, account)
+		cmd.Env = append(cmd.Env, "CODESWITCH_KEYCHAIN_SECRET="+secret)
+		return runKeychainCommand(cmd)
+	case "linux":
+		path, err := exec.LookPath("secret-tool")
+		if err != nil {
+			return errKeychainUnavailable
+		}
+		// secret-tool 从标准输入读取密文，避免出现在进程参数中
+		cmd := exec.CommandContext(ctx, path, "store", "--label="+keychainService+" "+account, "service", keychainService, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+		return runKeychainCommand(cmd)
+	default:
+		return errKeychainUnavailable
+	}
+}
+
+func (osKeychain) Get(account string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keychainTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "security", "find-generic-password", "-s", keychainService, "-a", account, "-w")
+	case "windows":
+		cmd = windowsVaultCommand(ctx, `$c=$v.Retrieve($env:CODESWITCH_KEYCHAIN_SERVICE,$env:CODESWITCH_KEYCHAIN_ACCOUNT);$c.RetrievePassword();$c.Password`, account)
+	case "linux":
+		path, err := exec.LookPath("secret-tool")
+		if err != nil {
+			return "", errKeychainUnavailable
+		}
+		cmd = exec.CommandContext(ctx, path, "lookup", "service", keychainService, "account", account)
+	default:
+		return "", errKeychainUnavailable
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("读取钥匙串失败: %w", err)
+	}
+	secret := strings.TrimRight(string(out), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("钥匙串中没有 %s", account)
+	}
+	return secret, nil
+}
+
+func (osKeychain) Delete(account string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), keychainTimeout)
+	defer cancel()
+	switch runtime.GOOS {
+	case "darwin":
+		return runKeychainCommand(exec.CommandContext(ctx, "security", "delete-generic-password", "-s", keychainService, "-a", account))
+	case "windows":
+		return runKeychainCommand(windowsVaultCommand(ctx, `$v.Remove($v.Retrieve($env:CODESWITCH_KEYCHAIN_SERVICE,$env:CODESWITCH_KEYCHAIN_ACCOUNT))`, account))
+	case "linux":
+		path, err := exec.LookPath("secret-tool")
+		if err != nil {
+			return errKeychainUnavailable
+		}
+		return runKeychainCommand(exec.CommandContext(ctx, path, "clear", "service", keychainService, "account", account))
+	default:
+		return errKeychainUnavailable
+	}
+}
+
+// windowsVaultCommand 构造操作 Windows 凭据管理器的 PowerShell 命令（参数通过环境变量传递，避免拼接进脚本）
+func windowsVaultCommand(ctx context.Context, action, account string) *exec.Cmd {
+	script := `[void][Windows.Security.Credentials.PasswordVault,Windows.Security.Credentials,ContentType=WindowsRuntime];` +
+		`$v=New-Object Windows.Security.Credentials.PasswordVault;` + action
+	cmd := exec.CommandContext(ctx, "powershell.exe", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-Command", script)
+	cmd.Env = append(cmd.Environ(), "CODESWITCH_KEYCHAIN_SERVICE="+keychainService, "CODESWITCH_KEYCHAIN_ACCOUNT="+account)
+	return cmd
+}
+
+// runKeychainCommand 执行钥匙串命令，失败时附带命令输出
+func runKeychainCommand(cmd *exec.Cmd) error {
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if detail := strings.TrimSpace(string(out)); detail != "" {
+			return fmt.Errorf("访问钥匙串失败: %v（%s）", err, detail)
+		}
+		return fmt.Errorf("访问钥匙串失败: %w", err)
+	}
+	return nil
+}
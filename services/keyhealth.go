@@ -0,0 +1,277 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// 密钥健康状态
+const (
+	KeyStatusOK         = "ok"          // 密钥有效，余额充足或未知
+	KeyStatusLowBalance = "low_balance" // 余额低于告警阈值
+	KeyStatusInvalid    = "invalid"     // 密钥无效或已吊销（401/403）
+	KeyStatusUnknown    = "unknown"     // 检查失败（网络错误等）
+)
+
+// ProviderKeyHealth 单个 provider 的密钥健康状态
+type ProviderKeyHealth struct {
+	Platform  string   `json:"platform"`
+	Provider  string   `json:"provider"`
+	Status    string   `json:"status"`
+	Remaining *float64 `json:"remaining,omitempty"` // 剩余额度，nil 表示该 provider 不提供余额接口或不限额
+	Currency  string   `json:"currency,omitempty"`  // 额度单位，如 USD、CNY
+	Source    string   `json:"source,omitempty"`    // 数据来源接口
+	Error     string   `json:"error,omitempty"`
+	CheckedAt int64    `json:"checkedAt"` // 毫秒时间戳
+}
+
+// KeyHealthService 定期检查 provider 的密钥有效性与剩余额度，在额度耗尽前提醒
+type KeyHealthService struct {
+	providerService     *ProviderService
+	notificationService *NotificationService
+	client              *http.Client
+	mu                  sync.Mutex
+	results             map[string]ProviderKeyHealth // key: platform/provider
+	alerted             map[string]string            // 已告警的状态，状态变化前不重复告警
+}
+
+func NewKeyHealthService(providerService *ProviderService, notificationService *NotificationService) *KeyHealthService {
+	return &KeyHealthService{
+		providerService:     providerService,
+		notificationService: notificationService,
+		client:              &http.Client{Timeout: 15 * time.Second},
+		results:             make(map[string]ProviderKeyHealth),
+		alerted:             make(map[string]string),
+	}
+}
+
+// Start 注册后台定时检查任务（间隔读取自 relay-config.json，未启用时不检查）
+func (ks *KeyHealthService) Start() error {
+	scheduleJob(backgroundJob{
+		name:  "key_health",
+		title: "API Key 健康检查",
+		delay: time.Minute, // 启动后稍等片刻再检查，避免与启动流程争抢网络
+		interval: func() time.Duration {
+			config := currentRelayConfig().KeyHealth
+			if !config.Enabled {
+				return 0
+			}
+			interval := time.Duration(config.IntervalMinutes) * time.Minute
+			if interval < 5*time.Minute {
+				interval = time.Hour
+			}
+			return interval
+		},
+		run: func() error {
+			ks.CheckKeyHealth()
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止后台检查
+func (ks *KeyHealthService) Stop() error {
+	unscheduleJob("key_health")
+	return nil
+}
+
+// GetKeyHealth 获取最近一次检查结果（供前端调用）
+func (ks *KeyHealthService) GetKeyHealth() []ProviderKeyHealth {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	results := make([]ProviderKeyHealth, 0, len(ks.results))
+	for _, result := range ks.results {
+		results = append(results, result)
+	}
+	return results
+}
+
+// CheckKeyHealth 立即检查所有已启用 provider 的密钥，对新出现的问题发送告警
+func (ks *KeyHealthService) CheckKeyHealth() []ProviderKeyHealth {
+	config := currentRelayConfig().KeyHealth
+	var results []ProviderKeyHealth
+	for _, platform := range []string{"claude", "codex"} {
+		providers, err := ks.providerService.LoadProviders(platform)
+		if err != nil {
+			log.Printf("[KeyHealth] 加载 %s provider 失败: %v", platform, err)
+			continue
+		}
+		for _, provider := range providers {
+			if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
+				continue
+			}
+			result := ks.checkProvider(platform, provider)
+			if result.Status == KeyStatusOK && result.Remaining != nil && *result.Remaining < config.LowBalanceThreshold {
+				result.Status = KeyStatusLowBalance
+			}
+			results = append(results, result)
+		}
+	}
+
+	var alerts []ProviderKeyHealth
+	ks.mu.Lock()
+	ks.results = make(map[string]ProviderKeyHealth, len(results))
+	for _, result := range results {
+		key := result.Platform + "/" + result.Provider
+		ks.results[key] = result
+		switch result.Status {
+		case KeyStatusInvalid, KeyStatusLowBalance:
+			if ks.alerted[key] != result.Status {
+				ks.alerted[key] = result.Status
+				alerts = append(alerts, result)
+			}
+		case KeyStatusOK:
+			delete(ks.alerted, key)
+		}
+	}
+	ks.mu.Unlock()
+
+	for _, alert := range alerts {
+		log.Printf("[KeyHealth] ⚠️  %s/%s 密钥状态: %s", alert.Platform, alert.Provider, alert.Status)
+		if ks.notificationService != nil {
+			ks.notificationService.NotifyKeyHealth(alert)
+		}
+	}
+	return results
+}
+
+// checkProvider 检查单个 provider：优先查询余额接口，不支持时用 /models 验证密钥有效性
+func (ks *KeyHealthService) checkProvider(platform string, provider Provider) ProviderKeyHealth {
+	result := ProviderKeyHealth{
+		Platform:  platform,
+		Provider:  provider.Name,
+		Status:    KeyStatusUnknown,
+		CheckedAt: time.Now().UnixMilli(),
+	}
+
+	root := apiRoot(provider.APIURL)
+	host := ""
+	if parsed, err := url.Parse(provider.APIURL); err == nil {
+		host = strings.ToLower(parsed.Hostname())
+	}
+
+	var checks []func() (*float64, string, string, error)
+	switch {
+	case strings.HasSuffix(host, "openrouter.ai"):
+		checks = append(checks, func() (*float64, string, string, error) {
+			body, err := ks.get(provider, "https://openrouter.ai/api/v1/key")
+			if err != nil {
+				return nil, "", "", err
+			}
+			remaining := gjson.GetBytes(body, "data.limit_remaining")
+			if remaining.Type == gjson.Null || !remaining.Exists() {
+				return nil, "USD", "openrouter:key", nil
+			}
+			value := remaining.Float()
+			return &value, "USD", "openrouter:key", nil
+		})
+	case strings.HasSuffix(host, "deepseek.com"):
+		checks = append(checks, func() (*float64, string, string, error) {
+			body, err := ks.get(provider, "https://api.deepseek.com/user/balance")
+			if err != nil {
+				return nil, "", "", err
+			}
+			info := gjson.GetBytes(body, "balance_infos.0")
+			value := info.Get("total_balance").Float()
+			return &value, info.Get("currency").String(), "deepseek:balance", nil
+		})
+	case host == "api.openai.com" || host == "api.anthropic.com":
+		// 官方接口不提供基于 API Key 的余额查询，仅验证密钥
+	default:
+		// 中转站（one-api / new-api 等）常见的 OpenAI 兼容账单接口
+		checks = append(checks, func() (*float64, string, string, error) {
+			subscription, err := ks.get(provider, root+"/v1/dashboard/billing/subscription")
+			if err != nil {
+				return nil, "", "", err
+			}
+			limit := gjson.GetBytes(subscription, "hard_limit_usd")
+			if !limit.Exists() {
+				return nil, "", "", fmt.Errorf("账单接口未返回 hard_limit_usd")
+			}
+			now := time.Now()
+			usage, err := ks.get(provider, fmt.Sprintf("%s/v1/dashboard/billing/usage?start_date=%s&end_date=%s",
+				root, now.AddDate(0, 0, -99).Format("2006-01-02"), now.AddDate(0, 0, 1).Format("2006-01-02")))
+			if err != nil {
+				return nil, "", "", err
+			}
+			// total_usage 单位为美分
+			value := limit.Float() - gjson.GetBytes(usage, "total_usage").Float()/100
+			return &value, "USD", "billing:subscription", nil
+		})
+	}
+
+	for _, check := range checks {
+		remaining, currency, source, err := check()
+		if err == nil {
+			result.Status, result.Remaining, result.Currency, result.Source = KeyStatusOK, remaining, currency, source
+			return result
+		}
+		// 中转站可能禁止令牌访问账单接口，余额接口的 401/403 不足以判定密钥失效，继续用模型列表验证
+	}
+
+	// 无余额接口或余额接口不可用：通过模型列表验证密钥
+	_, err := ks.get(provider, root+"/v1/models")
+	switch {
+	case err == nil:
+		result.Status, result.Source = KeyStatusOK, "models"
+	case isAuthError(err):
+		result.Status, result.Error = KeyStatusInvalid, err.Error()
+	default:
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// keyHealthHTTPError 余额/模型接口返回的非 2xx 状态
+type keyHealthHTTPError struct {
+	status int
+	body   string
+}
+
+func (e *keyHealthHTTPError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.status, e.body)
+}
+
+// isAuthError 判断是否为密钥无效（401/403）
+func isAuthError(err error) bool {
+	httpErr, ok := err.(*keyHealthHTTPError)
+	return ok && (httpErr.status == http.StatusUnauthorized || httpErr.status == http.StatusForbidden)
+}
+
+func (ks *KeyHealthService) get(provider Provider, target string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	req.Header.Set("x-api-key", provider.APIKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &keyHealthHTTPError{status: resp.StatusCode, body: truncateBatchBody(body)}
+	}
+	return body, nil
+}
+
+// apiRoot 去掉 API 地址末尾的 /v1，得到站点根地址
+func apiRoot(apiURL string) string {
+	root := strings.TrimSuffix(apiURL, "/")
+	return strings.TrimSuffix(root, "/v1")
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// redirectTransport 将所有请求转发到测试服务器，保留路径与查询参数
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// keyHealthResponse 测试服务器对某个路径的响应
+type keyHealthResponse struct {
+	status int
+	body   string
+}
+
+func newKeyHealthTestService(t *testing.T, responses map[string]keyHealthResponse) *KeyHealthService {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(resp.status)
+		w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	ks := NewKeyHealthService(NewProviderService(), nil)
+	ks.client = &http.Client{Transport: redirectTransport{target: target}, Timeout: 5 * time.Second}
+	return ks
+}
+
+func TestCheckProviderClassification(t *testing.T) {
+	const (
+		subscription = "/v1/dashboard/billing/subscription"
+		usage        = "/v1/dashboard/billing/usage"
+		models       = "/v1/models"
+	)
+	remaining := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name          string
+		apiURL        string
+		responses     map[string]keyHealthResponse
+		wantStatus    string
+		wantRemaining *float64
+		wantSource    string
+	}{
+		{
+			name:   "中转站账单接口",
+			apiURL: "https://relay.example.com/v1",
+			responses: map[string]keyHealthResponse{
+				subscription: {200, `{"hard_limit_usd":10}`},
+				usage:        {200, `{"total_usage":250}`},
+			},
+			wantStatus: KeyStatusOK, wantRemaining: remaining(7.5), wantSource: "billing:subscription",
+		},
+		{
+			name:   "账单接口被禁止时用模型列表验证",
+			apiURL: "https://relay.example.com",
+			responses: map[string]keyHealthResponse{
+				subscription: {403, `{"error":"forbidden"}`},
+				models:       {200, `{"data":[]}`},
+			},
+			wantStatus: KeyStatusOK, wantSource: "models",
+		},
+		{
+			name:       "密钥无效",
+			apiURL:     "https://relay.example.com",
+			responses:  map[string]keyHealthResponse{models: {401, `{"error":"invalid key"}`}},
+			wantStatus: KeyStatusInvalid,
+		},
+		{
+			name:   "账单接口缺少字段且模型列表异常",
+			apiURL: "https://relay.example.com",
+			responses: map[string]keyHealthResponse{
+				subscription: {200, `{}`},
+				models:       {502, `bad gateway`},
+			},
+			wantStatus: KeyStatusUnknown,
+		},
+		{
+			name:       "OpenRouter 不限额",
+			apiURL:     "https://openrouter.ai/api/v1",
+			responses:  map[string]keyHealthResponse{"/api/v1/key": {200, `{"data":{"limit_remaining":null}}`}},
+			wantStatus: KeyStatusOK, wantSource: "openrouter:key",
+		},
+		{
+			name:       "OpenRouter 剩余额度",
+			apiURL:     "https://openrouter.ai/api/v1",
+			responses:  map[string]keyHealthResponse{"/api/v1/key": {200, `{"data":{"limit_remaining":3.25}}`}},
+			wantStatus: KeyStatusOK, wantRemaining: remaining(3.25), wantSource: "openrouter:key",
+		},
+		{
+			name:       "DeepSeek 余额",
+			apiURL:     "https://api.deepseek.com",
+			responses:  map[string]keyHealthResponse{"/user/balance": {200, `{"balance_infos":[{"currency":"CNY","total_balance":"42.5"}]}`}},
+			wantStatus: KeyStatusOK, wantRemaining: remaining(42.5), wantSource: "deepseek:balance",
+		},
+		{
+			name:       "官方接口只验证密钥",
+			apiURL:     "https://api.anthropic.com",
+			responses:  map[string]keyHealthResponse{subscription: {200, `{"hard_limit_usd":10}`}, models: {200, `{"data":[]}`}},
+			wantStatus: KeyStatusOK, wantSource: "models",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := newKeyHealthTestService(t, tt.responses)
+			result := ks.checkProvider("claude", Provider{Name: "p", APIURL: tt.apiURL, APIKey: "sk-test"})
+			if result.Status != tt.wantStatus || result.Source != tt.wantSource {
+				t.Fatalf("结果 = (%s, %s)，期望 (%s, %s): %s", result.Status, result.Source, tt.wantStatus, tt.wantSource, result.Error)
+			}
+			if (result.Remaining == nil) != (tt.wantRemaining == nil) || (result.Remaining != nil && *result.Remaining != *tt.wantRemaining) {
+				t.Errorf("剩余额度 = %v，期望 %v", result.Remaining, tt.wantRemaining)
+			}
+			if (result.Status == KeyStatusOK) != (result.Error == "") {
+				t.Errorf("只有检查失败时才记录错误: %q", result.Error)
+			}
+		})
+	}
+}
+
+func TestCheckKeyHealthAlertsOnce(t *testing.T) {
+	config := DefaultRelayConfig()
+	config.KeyHealth.LowBalanceThreshold = 5
+	writeTestRelayConfig(t, config)
+	responses := map[string]keyHealthResponse{
+		"/v1/dashboard/billing/subscription": {200, `{"hard_limit_usd":10}`},
+		"/v1/dashboard/billing/usage":        {200, `{"total_usage":800}`},
+	}
+	ks := newKeyHealthTestService(t, responses)
+	if err := ks.providerService.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "relay", APIURL: "https://relay.example.com", APIKey: "sk-test", Enabled: true},
+		{ID: 2, Name: "disabled", APIURL: "https://relay.example.com", APIKey: "sk-test"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 告警写入日志，统计日志中的告警次数
+	var logs bytes.Buffer
+	originalOutput := log.Writer()
+	log.SetOutput(&logs)
+	defer log.SetOutput(originalOutput)
+	alerts := func() int { return strings.Count(logs.String(), "claude/relay 密钥状态") }
+
+	// 剩余 2 美元低于阈值：首次检查告警
+	results := ks.CheckKeyHealth()
+	if len(results) != 1 || results[0].Status != KeyStatusLowBalance {
+		t.Fatalf("应只检查已启用的 provider 并判定余额不足: %+v", results)
+	}
+	if alerts() != 1 {
+		t.Fatalf("余额不足应告警一次，得到 %d", alerts())
+	}
+
+	// 状态未变化时不重复告警
+	ks.CheckKeyHealth()
+	if alerts() != 1 {
+		t.Errorf("状态未变化时不应重复告警，得到 %d", alerts())
+	}
+
+	// 恢复后再次异常时重新告警
+	responses["/v1/dashboard/billing/usage"] = keyHealthResponse{200, `{"total_usage":100}`}
+	if results := ks.CheckKeyHealth(); results[0].Status != KeyStatusOK {
+		t.Fatalf("余额恢复后应为正常: %+v", results)
+	}
+	responses["/v1/dashboard/billing/usage"] = keyHealthResponse{200, `{"total_usage":900}`}
+	ks.CheckKeyHealth()
+	if alerts() != 2 {
+		t.Errorf("恢复后再次余额不足应重新告警，共 %d 次", alerts())
+	}
+	if got := ks.GetKeyHealth(); len(got) != 1 || got[0].Provider != "relay" {
+		t.Errorf("GetKeyHealth() = %+v", got)
+	}
+}
+
+func TestKeyHealthSchedule(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyHealth RelayKeyHealthConfig
+		want      time.Duration
+	}{
+		{name: "未启用", keyHealth: RelayKeyHealthConfig{Enabled: false, IntervalMinutes: 30}, want: 0},
+		{name: "按配置的间隔", keyHealth: RelayKeyHealthConfig{Enabled: true, IntervalMinutes: 30}, want: 30 * time.Minute},
+		{name: "最短 5 分钟", keyHealth: RelayKeyHealthConfig{Enabled: true, IntervalMinutes: 5}, want: 5 * time.Minute},
+		{name: "间隔过短时每小时检查", keyHealth: RelayKeyHealthConfig{Enabled: true, IntervalMinutes: 1}, want: time.Hour},
+		{name: "未设置间隔时每小时检查", keyHealth: RelayKeyHealthConfig{Enabled: true}, want: time.Hour},
+	}
+	ks := NewKeyHealthService(NewProviderService(), nil)
+	before := time.Now()
+	if err := ks.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Stop()
+
+	globalJobScheduler.mu.Lock()
+	job := globalJobScheduler.jobs["key_health"]
+	globalJobScheduler.mu.Unlock()
+	if job == nil {
+		t.Fatal("Start() 应注册 key_health 任务")
+	}
+	if delay := job.next.Sub(before); delay < time.Minute || delay > time.Minute+time.Second {
+		t.Errorf("首次检查应延迟一分钟，得到 %s", delay)
+	}
+	for _, tt := range tests {
+		config := DefaultRelayConfig()
+		config.KeyHealth = tt.keyHealth
+		writeTestRelayConfig(t, config)
+		if got := job.spec.interval(); got != tt.want {
+			t.Errorf("%s: 检查间隔 = %s，期望 %s", tt.name, got, tt.want)
+		}
+	}
+	// 检查本身不返回错误，单个 provider 失败不会触发整个任务的失败退避
+	if err := job.spec.run(); err != nil {
+		t.Errorf("检查任务不应返回错误: %v", err)
+	}
+}
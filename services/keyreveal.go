@@ -0,0 +1,165 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// maskedKeyPrefix 脱敏后的 API Key 前缀：前端只拿到 "••••" + 末 4 位，保存时原样传回表示不修改
+const maskedKeyPrefix = "••••"
+
+// maskAPIKey 脱敏 API Key，只保留末 4 位（过短的 Key 不保留任何字符）
+func maskAPIKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 8 {
+		return maskedKeyPrefix
+	}
+	return maskedKeyPrefix + key[len(key)-4:]
+}
+
+// isMaskedAPIKey 是否为 maskAPIKey 生成的脱敏值（即前端未修改 Key）
+func isMaskedAPIKey(key string) bool {
+	return strings.HasPrefix(key, maskedKeyPrefix)
+}
+
+// ListProviders 获取 provider 列表，API Key 只返回脱敏后的末 4 位（供前端调用）
+// 完整的 Key 只能通过 RevealKey 在系统身份验证后读取
+func (ps *ProviderService) ListProviders(kind string) ([]Provider, error) {
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return nil, err
+	}
+	for i := range providers {
+		providers[i].APIKey = maskAPIKey(providers[i].APIKey)
+	}
+	return providers, nil
+}
+
+// restoreMaskedKeys 保存时将未修改的脱敏 Key 还原为已保存的完整 Key（按 ID 匹配）
+func restoreMaskedKeys(providers []Provider, existing []Provider) error {
+	keyByID := make(map[int64]string, len(existing))
+	for _, p := range existing {
+		keyByID[p.ID] = p.APIKey
+	}
+	for i := range providers {
+		if !isMaskedAPIKey(providers[i].APIKey) {
+			continue
+		}
+		key, ok := keyByID[providers[i].ID]
+		if !ok || maskAPIKey(key) != providers[i].APIKey {
+			return fmt.Errorf("[%s] API Key 不完整，请重新填写", providers[i].Name)
+		}
+		providers[i].APIKey = key
+	}
+	return nil
+}
+
+// RevealKey 读取 provider 的完整 API Key（供前端调用）
+// 需要通过系统身份验证（Touch ID / Windows Hello / polkit），成功与失败都会写入审计日志
+func (ps *ProviderService) RevealKey(kind string, name string) (string, error) {
+	if err := checkKeyExportAllowed(kind, name); err != nil {
+		return "", err
+	}
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range providers {
+		if p.Name == name {
+			return authenticateKeyReveal(kind, name, p.APIKey)
+		}
+	}
+	return "", fmt.Errorf("未找到名为 '%s' 的供应商", name)
+}
+
+// RevealKey 读取 Gemini 供应商的完整 API Key（供前端调用），验证与审计同 ProviderService.RevealKey
+func (s *GeminiService) RevealKey(id string) (string, error) {
+	s.mu.Lock()
+	var provider *GeminiProvider
+	for i := range s.providers {
+		if s.providers[i].ID == id {
+			found := s.providers[i]
+			provider = &found
+			break
+		}
+	}
+	s.mu.Unlock()
+	if provider == nil {
+		return "", fmt.Errorf("未找到 ID 为 '%s' 的供应商", id)
+	}
+	if err := checkKeyExportAllowed("gemini", provider.Name); err != nil {
+		return "", err
+	}
+	return authenticateKeyReveal("gemini", provider.Name, geminiAPIKey(*provider))
+}
+
+// checkKeyExportAllowed 管理员策略禁止导出 Key 时拒绝读取并记录审计
+func checkKeyExportAllowed(kind, name string) error {
+	if currentPolicy().DisableKeyExport {
+		recordAudit("provider", "reveal_key_denied", fmt.Sprintf("读取 %s/%s 的 API Key：管理员策略已禁止", kind, name))
+		return fmt.Errorf("管理员策略已禁止导出 API Key")
+	}
+	return nil
+}
+
+// authenticateKeyReveal 通过系统身份验证后返回 key（验证在读取 key 之后进行，不存在的 provider 不弹出验证）
+func authenticateKeyReveal(kind, name, key string) (string, error) {
+	if err := osAuthenticate(fmt.Sprintf("查看 %s 的 API Key", name)); err != nil {
+		log.Printf("🔒 读取 %s/%s 的 API Key 未通过身份验证: %v", kind, name, err)
+		recordAudit("provider", "reveal_key_denied", fmt.Sprintf("读取 %s/%s 的 API Key：%v", kind, name, err))
+		return "", err
+	}
+	recordAudit("provider", "reveal_key", fmt.Sprintf("读取 %s/%s 的 API Key（已通过系统身份验证）", kind, name))
+	return key, nil
+}
+
+// geminiAPIKey Gemini 供应商的 Key 可能只写在 .env 配置中
+func geminiAPIKey(p GeminiProvider) string {
+	if p.APIKey != "" {
+		return p.APIKey
+	}
+	return p.EnvConfig["GEMINI_API_KEY"]
+}
+
+// maskGeminiProvider 返回 API Key（含 .env 配置中的 GEMINI_API_KEY）已脱敏的副本
+func maskGeminiProvider(p GeminiProvider) GeminiProvider {
+	p.APIKey = maskAPIKey(p.APIKey)
+	if key, ok := p.EnvConfig["GEMINI_API_KEY"]; ok {
+		env := make(map[string]string, len(p.EnvConfig))
+		for k, v := range p.EnvConfig {
+			env[k] = v
+		}
+		env["GEMINI_API_KEY"] = maskAPIKey(key)
+		p.EnvConfig = env
+	}
+	return p
+}
+
+// restoreGeminiMaskedKey 保存时将未修改的脱敏 Key 还原为已保存的完整 Key
+func restoreGeminiMaskedKey(provider *GeminiProvider, existing GeminiProvider) error {
+	if isMaskedAPIKey(provider.APIKey) {
+		if maskAPIKey(existing.APIKey) != provider.APIKey {
+			return fmt.Errorf("[%s] API Key 不完整，请重新填写", provider.Name)
+		}
+		provider.APIKey = existing.APIKey
+	}
+	if key := provider.EnvConfig["GEMINI_API_KEY"]; isMaskedAPIKey(key) {
+		saved := existing.EnvConfig["GEMINI_API_KEY"]
+		if saved == "" {
+			saved = existing.APIKey
+		}
+		if maskAPIKey(saved) != key {
+			return fmt.Errorf("[%s] API Key 不完整，请重新填写", provider.Name)
+		}
+		env := make(map[string]string, len(provider.EnvConfig))
+		for k, v := range provider.EnvConfig {
+			env[k] = v
+		}
+		env["GEMINI_API_KEY"] = saved
+		provider.EnvConfig = env
+	}
+	return nil
+}
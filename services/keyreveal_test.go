@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMaskAPIKey(t *testing.T) {
+	tests := map[string]string{
+		"":                      "",
+		"short":                 maskedKeyPrefix,
+		"sk-ant-api03-abcd1234": maskedKeyPrefix + "1234",
+	}
+	for key, want := range tests {
+		if got := maskAPIKey(key); got != want {
+			t.Errorf("maskAPIKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestRestoreMaskedKeys(t *testing.T) {
+	existing := []Provider{{ID: 1, Name: "a", APIKey: "sk-original-key-9999"}}
+
+	providers := []Provider{
+		{ID: 1, Name: "a", APIKey: maskAPIKey("sk-original-key-9999")},
+		{ID: 2, Name: "b", APIKey: "sk-new-key"},
+	}
+	if err := restoreMaskedKeys(providers, existing); err != nil {
+		t.Fatal(err)
+	}
+	if providers[0].APIKey != "sk-original-key-9999" || providers[1].APIKey != "sk-new-key" {
+		t.Errorf("unexpected keys: %q, %q", providers[0].APIKey, providers[1].APIKey)
+	}
+
+	// 新 provider 不能只带脱敏值
+	if err := restoreMaskedKeys([]Provider{{ID: 3, Name: "c", APIKey: maskedKeyPrefix + "9999"}}, existing); err == nil {
+		t.Error("masked key for unknown provider should fail")
+	}
+}
+
+func TestRevealKeyRequiresOSAuth(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "a", APIURL: "https://api.example.com", APIKey: "sk-secret-key-1234"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	original := osAuthenticate
+	defer func() { osAuthenticate = original }()
+
+	osAuthenticate = func(string) error { return errors.New("denied") }
+	if _, err := ps.RevealKey("claude", "a"); err == nil {
+		t.Error("RevealKey should fail when authentication is denied")
+	}
+
+	osAuthenticate = func(string) error { return nil }
+	key, err := ps.RevealKey("claude", "a")
+	if err != nil || key != "sk-secret-key-1234" {
+		t.Errorf("RevealKey = %q, %v", key, err)
+	}
+
+	listed, err := ps.ListProviders("claude")
+	if err != nil || listed[0].APIKey != maskedKeyPrefix+"1234" {
+		t.Errorf("ListProviders key = %q, %v", listed[0].APIKey, err)
+	}
+}
+
+func TestGeminiProvidersMaskedForFrontend(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	svc := NewGeminiService("127.0.0.1:18100")
+	const secret = "AIza-secret-key-5678"
+	if err := svc.AddProvider(GeminiProvider{ID: "g1", Name: "g", BaseURL: "https://gemini.example.com", APIKey: secret, EnvConfig: map[string]string{"GEMINI_API_KEY": secret, "GEMINI_MODEL": "gemini-2.5-pro"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	listed := svc.ListProviders()
+	if len(listed) != 1 || listed[0].APIKey != maskedKeyPrefix+"5678" || listed[0].EnvConfig["GEMINI_API_KEY"] != maskedKeyPrefix+"5678" {
+		t.Fatalf("ListProviders 应返回脱敏 Key: %+v", listed)
+	}
+	if svc.GetProviders()[0].EnvConfig["GEMINI_API_KEY"] != secret {
+		t.Fatal("脱敏不应修改已保存的配置")
+	}
+
+	// 前端原样传回脱敏值时保留原 Key
+	edited := listed[0]
+	edited.Model = "gemini-2.5-flash"
+	if err := svc.UpdateProvider(edited); err != nil {
+		t.Fatal(err)
+	}
+	if saved := svc.GetProviders()[0]; saved.APIKey != secret || saved.EnvConfig["GEMINI_API_KEY"] != secret || saved.Model != "gemini-2.5-flash" {
+		t.Errorf("更新后应保留完整 Key: %+v", saved)
+	}
+	edited.APIKey = maskedKeyPrefix + "0000"
+	if err := svc.UpdateProvider(edited); err == nil {
+		t.Error("与已保存 Key 不匹配的脱敏值应报错")
+	}
+
+	original := osAuthenticate
+	defer func() { osAuthenticate = original }()
+	osAuthenticate = func(string) error { return errors.New("denied") }
+	if _, err := svc.RevealKey("g1"); err == nil {
+		t.Error("未通过身份验证时 RevealKey 应失败")
+	}
+	osAuthenticate = func(string) error { return nil }
+	if key, err := svc.RevealKey("g1"); err != nil || key != secret {
+		t.Errorf("RevealKey = %q, %v", key, err)
+	}
+}
@@ -0,0 +1,493 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// 局域网发现：通过 mDNS（DNS-SD）广播本机中继，并发现局域网内其他 code-switch 中继
+const (
+	mdnsServiceName        = "_code-switch._tcp.local."
+	mdnsTTL                = 120
+	lanDiscoveryTimeout    = 2 * time.Second
+	lanDiscoveryMaxTimeout = 10 * time.Second
+	lanHealthTimeout       = 2 * time.Second
+	lanRelayPlaceholderKey = "code-switch-lan" // 对端中继使用自己的 Key 转发，本地只需非空占位
+)
+
+// mdnsGroupAddr mDNS 组播地址
+var mdnsGroupAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// RelayHealth 中继健康状态（GET /health，供局域网内其他实例查询，不含任何密钥与地址）
+type RelayHealth struct {
+	Status    string                         `json:"status"`
+	Platforms map[string]RelayPlatformHealth `json:"platforms"`
+}
+
+// RelayPlatformHealth 单个平台的 provider 数量
+type RelayPlatformHealth struct {
+	Enabled   int `json:"enabled"`
+	Available int `json:"available"` // 已启用且未被拉黑
+}
+
+// DiscoveredRelay 局域网内发现的中继
+type DiscoveredRelay struct {
+	Name      string       `json:"name"`
+	Host      string       `json:"host"`
+	Addresses []string     `json:"addresses"`
+	Port      int          `json:"port"`
+	URL       string       `json:"url"`
+	Version   string       `json:"version,omitempty"`
+	Self      bool         `json:"self"`             // 本机中继
+	Health    *RelayHealth `json:"health,omitempty"` // 为空表示健康检查失败
+	Error     string       `json:"error,omitempty"`
+}
+
+// healthHandler 返回中继健康状态
+func (prs *ProviderRelayService) healthHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, prs.relayHealth())
+	}
+}
+
+// relayHealth 汇总各平台已启用与可用的 provider 数量
+func (prs *ProviderRelayService) relayHealth() RelayHealth {
+	health := RelayHealth{Status: "ok", Platforms: map[string]RelayPlatformHealth{}}
+	for _, kind := range []string{"claude", "codex"} {
+		providers, err := prs.providerService.snapshotProviders(kind)
+		if err != nil {
+			health.Status = "degraded"
+			continue
+		}
+		var stat RelayPlatformHealth
+		for _, p := range providers {
+			if !p.Enabled || p.APIURL == "" || p.APIKey == "" {
+				continue
+			}
+			stat.Enabled++
+			if blacklisted, _ := prs.blacklistService.IsBlacklisted(kind, p.Name); !blacklisted && !p.IsAuthDisabled() {
+				stat.Available++
+			}
+		}
+		if stat.Available == 0 {
+			health.Status = "degraded"
+		}
+		health.Platforms[kind] = stat
+	}
+	return health
+}
+
+// LanDiscoveryService 局域网中继发现
+type LanDiscoveryService struct {
+	providerService *ProviderService
+	port            int
+	version         string
+	instanceID      string // 用于在发现结果中识别本机
+
+	mu      sync.Mutex
+	conn    *net.UDPConn
+	running bool
+}
+
+func NewLanDiscoveryService(providerService *ProviderService, relayAddr string, version string) *LanDiscoveryService {
+	port := defaultRelayPort
+	if _, portStr, err := net.SplitHostPort(relayAddr); err == nil {
+		if p, err := strconv.Atoi(portStr); err == nil {
+			port = p
+		}
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &LanDiscoveryService{
+		providerService: providerService,
+		port:            port,
+		version:         version,
+		instanceID:      hex.EncodeToString(id),
+	}
+}
+
+// Start 启用广播时开始响应 mDNS 查询（修改 discovery.advertise 后重启生效）
+func (ld *LanDiscoveryService) Start() error {
+	if !currentRelayConfig().Discovery.Advertise {
+		return nil
+	}
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	if ld.running {
+		return nil
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroupAddr)
+	if err != nil {
+		log.Printf("⚠️  局域网广播启动失败: %v", err)
+		return nil
+	}
+	ld.conn = conn
+	ld.running = true
+	log.Printf("📡 已在局域网广播中继: %s（端口 %d）", ld.instanceName(), ld.port)
+	go ld.serve(conn)
+	return nil
+}
+
+// Stop 停止广播
+func (ld *LanDiscoveryService) Stop() error {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	if ld.running {
+		ld.conn.Close()
+		ld.running = false
+	}
+	return nil
+}
+
+// instanceName 广播的实例名（默认使用主机名）
+func (ld *LanDiscoveryService) instanceName() string {
+	name := strings.TrimSpace(currentRelayConfig().Discovery.Name)
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return mdnsLabel(name, "code-switch")
+}
+
+// mdnsLabel 将名称转换为合法的 DNS 标签（去掉点号，最长 63 字节）
+func mdnsLabel(name, fallback string) string {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".local")
+	name = strings.ReplaceAll(name, ".", "-")
+	if len(name) > 63 {
+		name = name[:63]
+		for !utf8.ValidString(name) {
+			name = name[:len(name)-1]
+		}
+	}
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// serve 响应查询本服务类型的 mDNS 请求
+func (ld *LanDiscoveryService) serve(conn *net.UDPConn) {
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ld.isStopped() {
+				return
+			}
+			continue
+		}
+		var parser dnsmessage.Parser
+		header, err := parser.Start(buf[:n])
+		if err != nil || header.Response {
+			continue
+		}
+		questions, err := parser.AllQuestions()
+		if err != nil {
+			continue
+		}
+		var matched *dnsmessage.Question
+		for i := range questions {
+			q := questions[i]
+			if (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL) && strings.EqualFold(q.Name.String(), mdnsServiceName) {
+				matched = &q
+				break
+			}
+		}
+		if matched == nil {
+			continue
+		}
+		// 源端口不是 5353 的一次性查询（RFC 6762 §6.7）直接单播回复，并带上原始 ID 与问题
+		dst, legacy := mdnsGroupAddr, src.Port != mdnsGroupAddr.Port
+		if legacy {
+			dst = src
+		}
+		resp, err := ld.buildResponse(header.ID, matched, legacy)
+		if err != nil {
+			log.Printf("⚠️  构造 mDNS 响应失败: %v", err)
+			continue
+		}
+		conn.WriteToUDP(resp, dst)
+	}
+}
+
+func (ld *LanDiscoveryService) isStopped() bool {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	return !ld.running
+}
+
+// buildResponse 构造 PTR / SRV / TXT / A 记录
+func (ld *LanDiscoveryService) buildResponse(id uint16, question *dnsmessage.Question, legacy bool) ([]byte, error) {
+	hostname, _ := os.Hostname()
+	host, err := dnsmessage.NewName(mdnsLabel(hostname, "code-switch") + ".local.")
+	if err != nil {
+		return nil, err
+	}
+	service := dnsmessage.MustNewName(mdnsServiceName)
+	instance, err := dnsmessage.NewName(ld.instanceName() + "." + mdnsServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	header := dnsmessage.Header{Response: true, Authoritative: true}
+	if legacy {
+		header.ID = id
+	}
+	b := dnsmessage.NewBuilder(nil, header)
+	b.EnableCompression()
+	if legacy {
+		if err := b.StartQuestions(); err != nil {
+			return nil, err
+		}
+		if err := b.Question(*question); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	rh := func(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Type: typ, Class: dnsmessage.ClassINET, TTL: mdnsTTL}
+	}
+	if err := b.PTRResource(rh(service, dnsmessage.TypePTR), dnsmessage.PTRResource{PTR: instance}); err != nil {
+		return nil, err
+	}
+	if err := b.SRVResource(rh(instance, dnsmessage.TypeSRV), dnsmessage.SRVResource{Target: host, Port: uint16(ld.port)}); err != nil {
+		return nil, err
+	}
+	txt := []string{"id=" + ld.instanceID, "version=" + ld.version, "health=/health"}
+	if err := b.TXTResource(rh(instance, dnsmessage.TypeTXT), dnsmessage.TXTResource{TXT: txt}); err != nil {
+		return nil, err
+	}
+	for _, ip := range localIPv4Addrs() {
+		var a [4]byte
+		copy(a[:], ip.To4())
+		if err := b.AResource(rh(host, dnsmessage.TypeA), dnsmessage.AResource{A: a}); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// localIPv4Addrs 本机局域网 IPv4 地址
+func localIPv4Addrs() []net.IP {
+	var addrs []net.IP
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifAddrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && !ipNet.IP.IsLinkLocalUnicast() {
+				addrs = append(addrs, ipNet.IP.To4())
+			}
+		}
+	}
+	return addrs
+}
+
+// mdnsInstance 解析过程中收集的实例信息
+type mdnsInstance struct {
+	target string
+	port   int
+	txt    map[string]string
+	source net.IP // 发出响应的地址，一定可达
+}
+
+// DiscoverRelays 在局域网内查找 code-switch 中继并检查其健康状态（供前端调用）
+// timeoutMs 为等待响应的时间，0 使用默认 2 秒
+func (ld *LanDiscoveryService) DiscoverRelays(timeoutMs int) ([]DiscoveredRelay, error) {
+	timeout := lanDiscoveryTimeout
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+		if timeout > lanDiscoveryMaxTimeout {
+			timeout = lanDiscoveryMaxTimeout
+		}
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, fmt.Errorf("创建 mDNS 查询失败: %w", err)
+	}
+	defer conn.Close()
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(mdnsServiceName), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET})
+	query, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(query, mdnsGroupAddr); err != nil {
+		return nil, fmt.Errorf("发送 mDNS 查询失败: %w", err)
+	}
+
+	instances := map[string]*mdnsInstance{}
+	hosts := map[string][]net.IP{}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break // 超时结束
+		}
+		parseMDNSResponse(buf[:n], src.IP, instances, hosts)
+	}
+
+	relays := make([]DiscoveredRelay, 0, len(instances))
+	for name, inst := range instances {
+		if inst.port == 0 {
+			continue
+		}
+		relay := DiscoveredRelay{
+			Name:    strings.TrimSuffix(name, "."+mdnsServiceName),
+			Host:    strings.TrimSuffix(inst.target, "."),
+			Port:    inst.port,
+			Version: inst.txt["version"],
+			Self:    inst.txt["id"] == ld.instanceID,
+		}
+		seen := map[string]bool{}
+		for _, ip := range append([]net.IP{inst.source}, hosts[inst.target]...) {
+			if ip != nil && !seen[ip.String()] {
+				seen[ip.String()] = true
+				relay.Addresses = append(relay.Addresses, ip.String())
+			}
+		}
+		if len(relay.Addresses) == 0 {
+			continue
+		}
+		relay.URL = "http://" + net.JoinHostPort(relay.Addresses[0], strconv.Itoa(relay.Port))
+		relays = append(relays, relay)
+	}
+
+	// 并发检查健康状态
+	var wg sync.WaitGroup
+	for i := range relays {
+		wg.Add(1)
+		go func(relay *DiscoveredRelay) {
+			defer wg.Done()
+			health, err := fetchRelayHealth(relay.URL)
+			if err != nil {
+				relay.Error = err.Error()
+			}
+			relay.Health = health
+		}(&relays[i])
+	}
+	wg.Wait()
+
+	sort.Slice(relays, func(i, j int) bool { return relays[i].Name < relays[j].Name })
+	return relays, nil
+}
+
+// parseMDNSResponse 从响应的 answer 与 additional 中收集 PTR / SRV / TXT / A 记录
+func parseMDNSResponse(msg []byte, source net.IP, instances map[string]*mdnsInstance, hosts map[string][]net.IP) {
+	var m dnsmessage.Message
+	if err := m.Unpack(msg); err != nil || !m.Header.Response {
+		return
+	}
+	instance := func(name string) *mdnsInstance {
+		inst, ok := instances[name]
+		if !ok {
+			inst = &mdnsInstance{txt: map[string]string{}, source: source}
+			instances[name] = inst
+		}
+		return inst
+	}
+	for _, rr := range append(m.Answers, m.Additionals...) {
+		name := strings.ToLower(rr.Header.Name.String())
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name == mdnsServiceName {
+				instance(body.PTR.String())
+			}
+		case *dnsmessage.SRVResource:
+			if strings.HasSuffix(name, "."+mdnsServiceName) {
+				inst := instance(rr.Header.Name.String())
+				inst.target, inst.port = body.Target.String(), int(body.Port)
+			}
+		case *dnsmessage.TXTResource:
+			if strings.HasSuffix(name, "."+mdnsServiceName) {
+				inst := instance(rr.Header.Name.String())
+				for _, entry := range body.TXT {
+					if key, value, ok := strings.Cut(entry, "="); ok {
+						inst.txt[key] = value
+					}
+				}
+			}
+		case *dnsmessage.AResource:
+			hosts[rr.Header.Name.String()] = append(hosts[rr.Header.Name.String()], net.IP(body.A[:]))
+		}
+	}
+}
+
+// fetchRelayHealth 查询对端中继的健康状态
+func fetchRelayHealth(baseURL string) (*RelayHealth, error) {
+	client := &http.Client{Timeout: lanHealthTimeout}
+	resp, err := client.Get(baseURL + "/health")
+	if err != nil {
+		return nil, fmt.Errorf("健康检查失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("健康检查失败: HTTP %d", resp.StatusCode)
+	}
+	var health RelayHealth
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, fmt.Errorf("解析健康状态失败: %w", err)
+	}
+	return &health, nil
+}
+
+// AddDiscoveredRelay 将发现的中继添加为 provider（默认禁用），返回 provider 名称（供前端调用）
+func (ld *LanDiscoveryService) AddDiscoveredRelay(kind string, name string, relayURL string) (string, error) {
+	if kind != "claude" && kind != "codex" {
+		return "", fmt.Errorf("不支持的平台: %s", kind)
+	}
+	if err := validateHTTPURL(relayURL, "url"); err != nil {
+		return "", err
+	}
+	if _, err := fetchRelayHealth(relayURL); err != nil {
+		return "", err
+	}
+
+	ld.providerService.mu.Lock()
+	defer ld.providerService.mu.Unlock()
+	providers, err := ld.providerService.LoadProviders(kind)
+	if err != nil {
+		return "", fmt.Errorf("加载供应商列表失败: %w", err)
+	}
+	provider := Provider{
+		ID:      time.Now().UnixNano(),
+		UID:     newProviderUID(),
+		Name:    uniqueProviderName(providers, "LAN "+name),
+		APIURL:  relayURL,
+		APIKey:  lanRelayPlaceholderKey,
+		Enabled: false, // 默认禁用，用户需手动启用
+		Level:   1,
+	}
+	if err := ld.providerService.saveProvidersLocked(kind, append(providers, provider)); err != nil {
+		return "", fmt.Errorf("保存供应商失败: %w", err)
+	}
+	recordAudit("provider", "add_lan_relay", fmt.Sprintf("添加局域网中继 %s/%s: %s", kind, provider.Name, relayURL))
+	return provider.Name, nil
+}
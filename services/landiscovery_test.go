@@ -0,0 +1,45 @@
+package services
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestMDNSResponseRoundTrip(t *testing.T) {
+	ld := &LanDiscoveryService{port: 18100, version: "v1.0.0", instanceID: "abc"}
+	question := dnsmessage.Question{Name: dnsmessage.MustNewName(mdnsServiceName), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}
+	resp, err := ld.buildResponse(7, &question, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances := map[string]*mdnsInstance{}
+	hosts := map[string][]net.IP{}
+	parseMDNSResponse(resp, net.IPv4(192, 168, 1, 20), instances, hosts)
+	if len(instances) != 1 {
+		t.Fatalf("instances = %v", instances)
+	}
+	for name, inst := range instances {
+		if inst.port != 18100 || inst.txt["id"] != "abc" || inst.txt["version"] != "v1.0.0" {
+			t.Errorf("instance %s = %+v", name, inst)
+		}
+		if !inst.source.Equal(net.IPv4(192, 168, 1, 20)) {
+			t.Errorf("source = %v", inst.source)
+		}
+	}
+}
+
+func TestMDNSLabel(t *testing.T) {
+	tests := map[string]string{
+		"my-laptop.local": "my-laptop",
+		"a.b":             "a-b",
+		"  ":              "fallback",
+	}
+	for in, want := range tests {
+		if got := mdnsLabel(in, "fallback"); got != want {
+			t.Errorf("mdnsLabel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
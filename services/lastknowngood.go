@@ -0,0 +1,182 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 最近可用（last known good）：记录各平台最近一次成功处理请求的 provider，保存在 ~/.code-switch/last-known-good.json。
+// 切换到未通过校验的 provider 时自动回退到该 provider，避免 CLI 停留在不可用的配置上。
+
+const lastKnownGoodFileName = "last-known-good.json"
+
+// LastKnownGood 平台最近一次成功处理请求的 provider
+type LastKnownGood struct {
+	Platform  string `json:"platform"`
+	Provider  string `json:"provider"`
+	UpdatedAt int64  `json:"updatedAt"` // 毫秒；只在 provider 变化时落盘
+}
+
+var (
+	lastKnownGoodMu sync.Mutex
+	// lastKnownGoodWritten 已落盘的 provider（键为 文件路径|平台），provider 未变化时不重复写入
+	lastKnownGoodWritten = map[string]string{}
+)
+
+func lastKnownGoodPath() string {
+	return filepath.Join(getConfigDir(), lastKnownGoodFileName)
+}
+
+func loadLastKnownGoodLocked(path string) map[string]LastKnownGood {
+	records := map[string]LastKnownGood{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return records
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		log.Printf("⚠️  解析最近可用供应商记录失败: %v", err)
+		return map[string]LastKnownGood{}
+	}
+	return records
+}
+
+// recordLastKnownGood 记录平台最近一次成功处理请求的 provider（由中继在请求成功后调用）
+func recordLastKnownGood(platform, provider string) {
+	if platform == "" || provider == "" {
+		return
+	}
+	lastKnownGoodMu.Lock()
+	defer lastKnownGoodMu.Unlock()
+
+	path := lastKnownGoodPath()
+	key := path + "|" + platform
+	if lastKnownGoodWritten[key] == provider {
+		return
+	}
+	records := loadLastKnownGoodLocked(path)
+	if records[platform].Provider != provider {
+		records[platform] = LastKnownGood{Platform: platform, Provider: provider, UpdatedAt: time.Now().UnixMilli()}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			log.Printf("⚠️  保存最近可用供应商失败: %v", err)
+			return
+		}
+		if err := AtomicWriteJSON(path, records); err != nil {
+			log.Printf("⚠️  保存最近可用供应商失败: %v", err)
+			return
+		}
+	}
+	lastKnownGoodWritten[key] = provider
+}
+
+// lastKnownGood 读取平台最近一次成功处理请求的 provider
+func lastKnownGood(platform string) (LastKnownGood, bool) {
+	lastKnownGoodMu.Lock()
+	defer lastKnownGoodMu.Unlock()
+	record, ok := loadLastKnownGoodLocked(lastKnownGoodPath())[platform]
+	return record, ok && record.Provider != ""
+}
+
+// validateSwitchTarget 切换前校验 provider：接口地址、API Key 与模型配置（模型分流的虚拟 provider 只校验模型配置）
+func validateSwitchTarget(p Provider) error {
+	if len(p.SplitRoutes) > 0 {
+		if errs := p.ValidateConfiguration(); len(errs) > 0 {
+			return fmt.Errorf("%s", strings.Join(errs, "；"))
+		}
+		return nil
+	}
+	if strings.TrimSpace(p.APIURL) == "" {
+		return fmt.Errorf("未配置接口地址")
+	}
+	parsed, err := url.Parse(p.APIURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("接口地址无效: %s", p.APIURL)
+	}
+	if strings.TrimSpace(p.APIKey) == "" {
+		return fmt.Errorf("未配置 API Key")
+	}
+	if errs := p.ValidateConfiguration(); len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "；"))
+	}
+	return nil
+}
+
+// GetLastKnownGood 获取平台最近一次成功处理请求的 provider，没有记录时返回 nil
+func (ps *ProviderService) GetLastKnownGood(kind string) *LastKnownGood {
+	record, ok := lastKnownGood(kind)
+	if !ok {
+		return nil
+	}
+	return &record
+}
+
+// FallbackToLastKnownGood 切换回平台最近一次成功处理请求的 provider，返回其名称
+func (ps *ProviderService) FallbackToLastKnownGood(kind string) (string, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return "", fmt.Errorf("加载供应商配置失败: %w", err)
+	}
+	return ps.fallbackToLastKnownGoodLocked(kind, providers)
+}
+
+func (ps *ProviderService) fallbackToLastKnownGoodLocked(kind string, providers []Provider) (string, error) {
+	record, ok := lastKnownGood(kind)
+	if !ok {
+		return "", fmt.Errorf("%s 平台还没有成功处理过请求的供应商", kind)
+	}
+	index := providerIndex(providers, record.Provider)
+	if index < 0 {
+		return "", fmt.Errorf("最近可用的供应商 '%s' 已不存在", record.Provider)
+	}
+	if err := validateSwitchTarget(providers[index]); err != nil {
+		return "", fmt.Errorf("最近可用的供应商 '%s' 未通过校验: %w", record.Provider, err)
+	}
+	if err := ps.activateProviderLocked(kind, providers, index); err != nil {
+		return "", err
+	}
+	return record.Provider, nil
+}
+
+func providerIndex(providers []Provider, name string) int {
+	for i, p := range providers {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// FallbackToLastKnownGood 切换回 Gemini 最近一次成功处理请求的 provider，返回其名称
+func (s *GeminiService) FallbackToLastKnownGood() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fallbackToLastKnownGoodLocked()
+}
+
+func (s *GeminiService) fallbackToLastKnownGoodLocked() (string, error) {
+	record, ok := lastKnownGood("gemini")
+	if !ok {
+		return "", fmt.Errorf("gemini 平台还没有成功处理过请求的供应商")
+	}
+	for i := range s.providers {
+		if s.providers[i].Name == record.Provider {
+			if err := validateGeminiSwitchTarget(&s.providers[i]); err != nil {
+				return "", fmt.Errorf("最近可用的供应商 '%s' 未通过校验: %w", record.Provider, err)
+			}
+			if err := s.activateProviderLocked(&s.providers[i]); err != nil {
+				return "", err
+			}
+			return record.Provider, nil
+		}
+	}
+	return "", fmt.Errorf("最近可用的供应商 '%s' 已不存在", record.Provider)
+}
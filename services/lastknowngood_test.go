@@ -0,0 +1,46 @@
+package services
+
+import "testing"
+
+func TestRecordLastKnownGood(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+
+	if _, ok := lastKnownGood("claude"); ok {
+		t.Fatal("没有记录时不应返回最近可用的 provider")
+	}
+	recordLastKnownGood("claude", "A")
+	recordLastKnownGood("codex", "B")
+	recordLastKnownGood("claude", "C")
+
+	if record, ok := lastKnownGood("claude"); !ok || record.Provider != "C" {
+		t.Errorf("claude 最近可用应为 C，得到 %+v", record)
+	}
+	if record, ok := lastKnownGood("codex"); !ok || record.Provider != "B" {
+		t.Errorf("codex 最近可用应为 B，得到 %+v", record)
+	}
+}
+
+func TestValidateSwitchTarget(t *testing.T) {
+	valid := Provider{Name: "ok", APIURL: "https://api.example.com", APIKey: "sk-test"}
+	if err := validateSwitchTarget(valid); err != nil {
+		t.Fatalf("有效 provider 不应报错: %v", err)
+	}
+
+	virtual := Provider{Name: "split", SplitRoutes: map[string]string{"claude-*": "ok"}}
+	if err := validateSwitchTarget(virtual); err != nil {
+		t.Fatalf("虚拟 provider 不需要接口地址和 Key: %v", err)
+	}
+
+	cases := map[string]Provider{
+		"无接口地址":  {Name: "a", APIKey: "sk-test"},
+		"接口地址无效": {Name: "b", APIURL: "api.example.com", APIKey: "sk-test"},
+		"无 Key":  {Name: "c", APIURL: "https://api.example.com"},
+		"护栏策略无效": {Name: "d", APIURL: "https://api.example.com", APIKey: "sk-test", GuardrailPolicy: "drop"},
+	}
+	for name, p := range cases {
+		if err := validateSwitchTarget(p); err == nil {
+			t.Errorf("%s: 应未通过校验", name)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 延迟预算：客户端（X-CodeSwitch-Latency-Budget 请求头）或路由规则（budget 动作）可以为请求声明首字节延迟预算。
+// 降级模式下，当前 provider 超出预算仍未返回响应时，不中断它，而是同时把请求发给下一个候选 provider 竞速，
+// 先返回成功响应的一方写给客户端，另一方随即取消。两次请求都会写入请求日志：被取消的一方按估算的输入 token 计费，
+// 已经开始返回的按实际用量计费。拉黑模式下不自动降级，预算不生效；Gemini 请求暂不支持。
+
+const (
+	// LatencyBudgetHeader 客户端声明首字节延迟预算（毫秒）的请求头
+	LatencyBudgetHeader = "X-CodeSwitch-Latency-Budget"
+
+	// minLatencyBudgetMs / maxLatencyBudgetMs 延迟预算范围
+	minLatencyBudgetMs = 100
+	maxLatencyBudgetMs = 600000
+)
+
+// errRaceLost 竞速中落后的请求写出响应时返回
+var errRaceLost = errors.New("竞速请求已由其他 provider 完成")
+
+// parseLatencyBudget 解析延迟预算（毫秒），超出范围返回 false
+func parseLatencyBudget(value string) (time.Duration, bool) {
+	ms, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || ms < minLatencyBudgetMs || ms > maxLatencyBudgetMs {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// requestLatencyBudget 请求的延迟预算：请求头优先，其次是命中的 budget 规则；没有预算返回 0
+func requestLatencyBudget(c *gin.Context, decision *routingDecision) time.Duration {
+	if value := c.GetHeader(LatencyBudgetHeader); value != "" {
+		if budget, ok := parseLatencyBudget(value); ok {
+			return budget
+		}
+		fmt.Printf("[WARN] 忽略无效的延迟预算 %q（需在 %d-%d 毫秒之间）\n", value, minLatencyBudgetMs, maxLatencyBudgetMs)
+	}
+	if decision != nil && decision.action == RuleActionBudget {
+		if budget, ok := parseLatencyBudget(decision.args[0]); ok {
+			return budget
+		}
+	}
+	return 0
+}
+
+// requestRace 一次竞速：第一个写出响应的请求获胜，其余请求被取消
+type requestRace struct {
+	mu      sync.Mutex
+	real    gin.ResponseWriter
+	winner  int // -1 表示尚无获胜者
+	cancels []context.CancelFunc
+	claimed chan struct{} // 产生获胜者时关闭
+}
+
+// claim 尝试让第 id 个请求获胜，成功时把它的响应头复制到真实响应并取消其他请求
+func (r *requestRace) claim(id int, header http.Header) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner >= 0 {
+		return r.winner == id
+	}
+	r.winner = id
+	for key, values := range header {
+		r.real.Header()[key] = values
+	}
+	for i, cancel := range r.cancels {
+		if i != id {
+			cancel()
+		}
+	}
+	close(r.claimed)
+	return true
+}
+
+func (r *requestRace) winnerID() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.winner
+}
+
+// raceWriter 竞速请求使用的响应写入器：获胜前响应头写在各自的副本中，第一次写出时争夺获胜权，落后的请求写入失败
+type raceWriter struct {
+	gin.ResponseWriter
+	race   *requestRace
+	id     int
+	header http.Header
+}
+
+func (w *raceWriter) won() bool {
+	return w.race.winnerID() == w.id
+}
+
+// lost 是否已被其他请求抢先
+func (w *raceWriter) lost() bool {
+	winner := w.race.winnerID()
+	return winner >= 0 && winner != w.id
+}
+
+func (w *raceWriter) Header() http.Header {
+	if w.won() {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *raceWriter) WriteHeader(code int) {
+	if w.race.claim(w.id, w.header) {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *raceWriter) WriteHeaderNow() {
+	if w.race.claim(w.id, w.header) {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *raceWriter) Write(data []byte) (int, error) {
+	if !w.race.claim(w.id, w.header) {
+		return 0, errRaceLost
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *raceWriter) WriteString(s string) (int, error) {
+	if !w.race.claim(w.id, w.header) {
+		return 0, errRaceLost
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *raceWriter) Flush() {
+	if w.won() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *raceWriter) Status() int {
+	if w.won() {
+		return w.ResponseWriter.Status()
+	}
+	return http.StatusOK
+}
+
+func (w *raceWriter) Size() int {
+	if w.won() {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *raceWriter) Written() bool {
+	return w.won() && w.ResponseWriter.Written()
+}
+
+func (w *raceWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("竞速请求不支持 Hijack")
+}
+
+func (w *raceWriter) Pusher() http.Pusher {
+	return nil
+}
+
+// raceLost 请求是否因竞速落后被取消（用于请求日志按估算用量计费）
+func raceLost(c *gin.Context) bool {
+	w, ok := c.Writer.(*raceWriter)
+	return ok && w.lost()
+}
+
+// raceCandidate 参与竞速的 provider 及其请求（已按 provider 映射模型）
+type raceCandidate struct {
+	provider Provider
+	model    string
+	body     []byte
+}
+
+// raceResult 竞速中一个请求的结果
+type raceResult struct {
+	candidate raceCandidate
+	ok        bool
+	err       error
+	duration  time.Duration
+}
+
+// raceOutcome 竞速结果
+type raceOutcome struct {
+	primary raceResult
+	backup  *raceResult // 未启动备用请求时为 nil
+	winner  *raceResult // 写出响应的一方，都未写出时为 nil
+}
+
+// forwardRaced 转发给 primary，delay 内没有写出响应时同时转发给 backup 竞速，等待所有已启动的请求结束
+// primary 在 delay 内失败时直接返回（不启动 backup），由调用方继续按顺序降级
+func (prs *ProviderRelayService) forwardRaced(
+	c *gin.Context,
+	kind string,
+	endpoint string,
+	query map[string]string,
+	clientHeaders map[string]string,
+	isStream bool,
+	primary raceCandidate,
+	backup raceCandidate,
+	delay time.Duration,
+) raceOutcome {
+	race := &requestRace{real: c.Writer, winner: -1, claimed: make(chan struct{})}
+	// 复制前创建尝试计数器，竞速双方与之后的降级请求共用同一计数
+	attemptCounter(c)
+	results := make([]raceResult, 2)
+	attempts := make([]*gin.Context, 2)
+	done := make([]chan struct{}, 2)
+
+	start := func(id int, candidate raceCandidate) {
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		race.mu.Lock()
+		race.cancels = append(race.cancels, cancel)
+		race.mu.Unlock()
+
+		attempt := c.Copy()
+		attempt.Request = c.Request.WithContext(ctx)
+		attempt.Writer = &raceWriter{ResponseWriter: c.Writer, race: race, id: id, header: make(http.Header)}
+		attempts[id] = attempt
+		done[id] = make(chan struct{})
+		go func() {
+			defer close(done[id])
+			defer cancel()
+			begin := time.Now()
+			ok, err := prs.forwardRequest(attempt, kind, candidate.provider, endpoint, query, clientHeaders, candidate.body, isStream, candidate.model)
+			results[id] = raceResult{candidate: candidate, ok: ok, err: err, duration: time.Since(begin)}
+		}()
+	}
+
+	start(0, primary)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	backupStarted := false
+	select {
+	case <-done[0]:
+	case <-race.claimed:
+	case <-timer.C:
+		fmt.Printf("[INFO] ⏱️  %s 超过 %dms 仍未响应，同时请求 %s 竞速\n", primary.provider.Name, delay.Milliseconds(), backup.provider.Name)
+		start(1, backup)
+		backupStarted = true
+	}
+
+	<-done[0]
+	if backupStarted {
+		<-done[1]
+	}
+	outcome := raceOutcome{primary: results[0]}
+	if backupStarted {
+		outcome.backup = &results[1]
+	}
+	switch race.winnerID() {
+	case 0:
+		outcome.winner = &outcome.primary
+	case 1:
+		outcome.winner = outcome.backup
+	}
+	// 获胜的请求被钩子拒绝时响应已写出，交由调用方停止降级
+	if winner := race.winnerID(); winner >= 0 && hookRejected(attempts[winner]) {
+		c.Set(hookRejectedKey, true)
+	}
+	if backupStarted && outcome.winner != nil {
+		loser := outcome.primary.candidate.provider.Name
+		if outcome.winner == &outcome.primary {
+			loser = backup.provider.Name
+		}
+		fmt.Printf("[INFO] 🏁 竞速结果: %s 先响应，已取消 %s\n", outcome.winner.candidate.provider.Name, loser)
+	}
+	return outcome
+}
+
+// prepareCandidate 按 provider 的模型映射改写请求体
+func prepareCandidate(provider Provider, requestedModel string, body []byte) (raceCandidate, error) {
+	model := provider.GetEffectiveModel(requestedModel)
+	if model != requestedModel && requestedModel != "" {
+		modified, err := ReplaceModelInRequestBody(body, model)
+		if err != nil {
+			return raceCandidate{}, err
+		}
+		body = modified
+	}
+	return raceCandidate{provider: provider, model: model, body: body}, nil
+}
+
+// nextCandidate 降级顺序中 provider 之后第一个尚未尝试的 provider
+func nextCandidate(levels []int, levelGroups map[int][]Provider, level, index int, tried map[string]bool) *Provider {
+	for _, l := range levels {
+		if l < level {
+			continue
+		}
+		for i, provider := range levelGroups[l] {
+			if (l == level && i <= index) || tried[provider.Name] {
+				continue
+			}
+			return &provider
+		}
+	}
+	return nil
+}
+
+// forwardWithBudget 带延迟预算转发给 primary，超出预算时与 backup 竞速；
+// 返回获胜的 provider（都失败时为 primary）及其结果，backup 参与了竞速时同时返回 backup 的结果
+func (prs *ProviderRelayService) forwardWithBudget(
+	c *gin.Context,
+	kind string,
+	endpoint string,
+	query map[string]string,
+	clientHeaders map[string]string,
+	isStream bool,
+	requestedModel string,
+	bodyBytes []byte,
+	primary raceCandidate,
+	backup Provider,
+	budget time.Duration,
+) (Provider, *raceResult, bool, error) {
+	candidate, err := prepareCandidate(backup, requestedModel, bodyBytes)
+	if err != nil {
+		fmt.Printf("[WARN] 备用 provider %s 替换模型名失败，不参与竞速: %v\n", backup.Name, err)
+		ok, err := prs.forwardRequest(c, kind, primary.provider, endpoint, query, clientHeaders, primary.body, isStream, primary.model)
+		return primary.provider, nil, ok, err
+	}
+
+	outcome := prs.forwardRaced(c, kind, endpoint, query, clientHeaders, isStream, primary, candidate, budget)
+	result := outcome.primary
+	if outcome.winner != nil {
+		result = *outcome.winner
+	}
+	return result.candidate.provider, outcome.backup, result.ok, result.err
+}
+
+// recordRaceFailure 记录竞速中 backup 的失败（被取消或限流不计入失败次数），返回失败原因；成功或被取消时返回空
+func (prs *ProviderRelayService) recordRaceFailure(kind string, result *raceResult) string {
+	if result.ok || errors.Is(result.err, errClientAbort) {
+		return ""
+	}
+	name := result.candidate.provider.Name
+	var rateLimited *retryAfterError
+	if !errors.Is(result.err, errQueueTimeout) && !errors.As(result.err, &rateLimited) {
+		if err := prs.blacklistService.RecordFailure(kind, name); err != nil {
+			fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
+		}
+	}
+	return describeAttemptFailure(name, result.err)
+}
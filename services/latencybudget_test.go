@@ -0,0 +1,61 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRaceWriterFirstWriteWins(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	cancelled := false
+	race := &requestRace{real: c.Writer, winner: -1, claimed: make(chan struct{})}
+	race.cancels = append(race.cancels, func() {}, func() { cancelled = true })
+
+	primary := &raceWriter{ResponseWriter: c.Writer, race: race, id: 0, header: make(http.Header)}
+	backup := &raceWriter{ResponseWriter: c.Writer, race: race, id: 1, header: make(http.Header)}
+	primary.Header().Set("X-Upstream", "primary")
+	backup.Header().Set("X-Upstream", "backup")
+
+	if _, err := primary.Write([]byte("hello")); err != nil {
+		t.Fatalf("先写出的请求应获胜: %v", err)
+	}
+	if _, err := backup.Write([]byte("late")); err != errRaceLost {
+		t.Fatalf("落后的请求写入应失败，得到 %v", err)
+	}
+	if !cancelled || !backup.lost() || primary.lost() {
+		t.Fatalf("获胜后应取消落后的请求")
+	}
+	if got := recorder.Header().Get("X-Upstream"); got != "primary" || recorder.Body.String() != "hello" {
+		t.Fatalf("响应应来自获胜的请求，得到 %q %q", got, recorder.Body.String())
+	}
+}
+
+func TestNextCandidate(t *testing.T) {
+	levelGroups := map[int][]Provider{
+		1: {{Name: "a"}, {Name: "b"}},
+		2: {{Name: "c"}},
+	}
+	levels := []int{1, 2}
+	if next := nextCandidate(levels, levelGroups, 1, 0, map[string]bool{"a": true}); next == nil || next.Name != "b" {
+		t.Fatalf("应返回同级的下一个 provider，得到 %+v", next)
+	}
+	if next := nextCandidate(levels, levelGroups, 1, 0, map[string]bool{"a": true, "b": true}); next == nil || next.Name != "c" {
+		t.Fatalf("同级都已尝试时应返回下一 Level 的 provider，得到 %+v", next)
+	}
+	if next := nextCandidate(levels, levelGroups, 2, 0, map[string]bool{}); next != nil {
+		t.Fatalf("没有后续 provider 时应返回 nil，得到 %+v", next)
+	}
+
+	if _, ok := parseLatencyBudget("3000"); !ok {
+		t.Errorf("3000ms 应为有效预算")
+	}
+	for _, value := range []string{"", "3s", "50", "700000"} {
+		if _, ok := parseLatencyBudget(value); ok {
+			t.Errorf("%q 不应为有效预算", value)
+		}
+	}
+}
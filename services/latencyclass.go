@@ -0,0 +1,61 @@
+package services
+
+import "fmt"
+
+// 端点延迟分级：测速结果、端点列表、延迟趋势与告警共用同一组阈值（中继配置 latencyClass），
+// 前端按分级着色，不再各自定义“慢”。
+
+// 延迟分级
+const (
+	LatencyGood     = "good"     // 低于 GoodMs
+	LatencyDegraded = "degraded" // 低于 DegradedMs
+	LatencyBad      = "bad"      // 其余情况，包括测速失败
+)
+
+// RelayLatencyClassConfig 延迟分级阈值
+type RelayLatencyClassConfig struct {
+	GoodMs     int `json:"goodMs"`     // 低于该值为 good，默认 300
+	DegradedMs int `json:"degradedMs"` // 低于该值为 degraded，默认 1000，其余为 bad
+}
+
+// validateLatencyClassConfig 校验延迟分级阈值
+func validateLatencyClassConfig(config RelayLatencyClassConfig) error {
+	if config.GoodMs < 1 || config.DegradedMs > 60000 {
+		return fmt.Errorf("延迟分级阈值必须在 1-60000 毫秒之间")
+	}
+	if config.GoodMs >= config.DegradedMs {
+		return fmt.Errorf("“正常”延迟阈值必须小于“较慢”延迟阈值")
+	}
+	return nil
+}
+
+// classify 按阈值对延迟分级，nil 表示失败
+func (c RelayLatencyClassConfig) classify(latencyMs *uint64) string {
+	switch {
+	case latencyMs == nil:
+		return LatencyBad
+	case *latencyMs < uint64(c.GoodMs):
+		return LatencyGood
+	case *latencyMs < uint64(c.DegradedMs):
+		return LatencyDegraded
+	default:
+		return LatencyBad
+	}
+}
+
+// classifyLatency 按当前配置的阈值对延迟分级
+func classifyLatency(latencyMs *uint64) string {
+	return currentRelayConfig().LatencyClass.classify(latencyMs)
+}
+
+// latencyClassLabel 分级的中文名称（用于通知）
+func latencyClassLabel(class string) string {
+	switch class {
+	case LatencyGood:
+		return "正常"
+	case LatencyDegraded:
+		return "较慢"
+	default:
+		return "很慢"
+	}
+}
@@ -0,0 +1,31 @@
+package services
+
+import "testing"
+
+func TestLatencyClassify(t *testing.T) {
+	thresholds := DefaultRelayConfig().LatencyClass
+	ms := func(v uint64) *uint64 { return &v }
+	cases := []struct {
+		latency *uint64
+		want    string
+	}{
+		{ms(0), LatencyGood},
+		{ms(299), LatencyGood},
+		{ms(300), LatencyDegraded},
+		{ms(999), LatencyDegraded},
+		{ms(1000), LatencyBad},
+		{nil, LatencyBad},
+	}
+	for _, tc := range cases {
+		if got := thresholds.classify(tc.latency); got != tc.want {
+			t.Errorf("classify(%v) = %s，期望 %s", tc.latency, got, tc.want)
+		}
+	}
+
+	if err := validateLatencyClassConfig(RelayLatencyClassConfig{GoodMs: 500, DegradedMs: 500}); err == nil {
+		t.Error("正常阈值不小于较慢阈值时应报错")
+	}
+	if err := validateLatencyClassConfig(thresholds); err != nil {
+		t.Errorf("默认阈值应有效: %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	// latencyTrendCheckInterval 后台评估延迟趋势的间隔
+	latencyTrendCheckInterval = time.Hour
+	// latencySampleRetention 延迟样本保留时间（只需覆盖 7 天基线）
+	latencySampleRetention = 8 * 24 * time.Hour
+)
+
+// EndpointLatencyTrend 单个端点的延迟趋势
+type EndpointLatencyTrend struct {
+	URL             string  `json:"url"`
+	Median24hMs     float64 `json:"median24hMs"`     // 最近 24 小时延迟中位数
+	BaselineMs      float64 `json:"baselineMs"`      // 此前 7 天延迟中位数
+	Samples24h      int     `json:"samples24h"`      // 最近 24 小时样本数
+	BaselineSamples int     `json:"baselineSamples"` // 基线样本数
+	Ratio           float64 `json:"ratio"`           // Median24hMs / BaselineMs，样本不足时为 0
+	Degraded        bool    `json:"degraded"`
+	Class           string  `json:"class,omitempty"` // 24 小时中位数的延迟分级，没有样本时为空
+}
+
+// ensureEndpointLatencyTable 确保 endpoint_latency 表存在
+func ensureEndpointLatencyTable() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS endpoint_latency (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		latency_ms INTEGER DEFAULT 0,
+		success INTEGER DEFAULT 0,
+		created_at BIGINT
+	)`
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("创建 endpoint_latency 表失败: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_endpoint_latency_url_time ON endpoint_latency(url, created_at)`); err != nil {
+		return fmt.Errorf("创建 endpoint_latency 索引失败: %w", err)
+	}
+	return nil
+}
+
+// recordEndpointLatency 记录一次端点延迟样本（latencyMs 为 nil 表示失败）
+func recordEndpointLatency(url string, latencyMs *uint64) {
+	if url == "" || GlobalDBQueueLogs == nil {
+		return
+	}
+	url = normalizeEndpointURL(url)
+	latency, success := uint64(0), 0
+	if latencyMs != nil {
+		latency, success = *latencyMs, 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	const insertSQL = `INSERT INTO endpoint_latency (url, latency_ms, success, created_at) VALUES (?, ?, ?, ?)`
+	args := []interface{}{url, latency, success, epochNow()}
+	var err error
+	if GlobalDBQueueShared != GlobalDBQueue {
+		// 批量队列写入 PostgreSQL 中的共享表，endpoint_latency 仍在本机 SQLite
+		err = GlobalDBQueue.ExecCtx(ctx, insertSQL, args...)
+	} else {
+		err = GlobalDBQueueLogs.ExecBatchCtx(ctx, insertSQL, args...)
+	}
+	if err != nil {
+		fmt.Printf("写入 endpoint_latency 失败: %v\n", err)
+	}
+}
+
+// LatencyTrendService 端点延迟趋势告警：最近 24 小时中位数相对 7 天基线劣化时告警
+type LatencyTrendService struct {
+	notificationService *NotificationService
+	mu                  sync.Mutex
+	alerted             map[string]bool // 已告警且尚未恢复的端点，避免重复告警
+}
+
+func NewLatencyTrendService(notificationService *NotificationService) *LatencyTrendService {
+	return &LatencyTrendService{
+		notificationService: notificationService,
+		alerted:             make(map[string]bool),
+	}
+}
+
+// Start 注册后台定时评估任务
+func (lt *LatencyTrendService) Start() error {
+	scheduleJob(backgroundJob{
+		name:     "latency_trend",
+		title:    "端点延迟趋势评估",
+		delay:    latencyTrendCheckInterval,
+		interval: func() time.Duration { return latencyTrendCheckInterval },
+		run: func() error {
+			if _, err := lt.CheckLatencyTrends(); err != nil {
+				return fmt.Errorf("评估延迟趋势失败: %w", err)
+			}
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止后台评估
+func (lt *LatencyTrendService) Stop() error {
+	unscheduleJob("latency_trend")
+	return nil
+}
+
+// GetLatencyTrends 获取各端点的延迟趋势（供前端调用，不触发告警）
+func (lt *LatencyTrendService) GetLatencyTrends() ([]EndpointLatencyTrend, error) {
+	return computeLatencyTrends(currentRelayConfig().LatencyAlert, time.Now())
+}
+
+// CheckLatencyTrends 评估延迟趋势，对新出现劣化的端点发送告警
+// 延迟虽然翻倍但仍在“正常”分级内（如 80ms → 200ms）时不告警
+func (lt *LatencyTrendService) CheckLatencyTrends() ([]EndpointLatencyTrend, error) {
+	config := currentRelayConfig().LatencyAlert
+	now := time.Now()
+	pruneEndpointLatency(now.Add(-latencySampleRetention))
+	pruneProviderEvents(now.Add(-providerEventRetention))
+
+	trends, err := computeLatencyTrends(config, now)
+	if err != nil || !config.Enabled {
+		return trends, err
+	}
+
+	for _, trend := range lt.newlyDegraded(trends) {
+		log.Printf("[LatencyTrend] ⚠️  %s 延迟劣化: 24h 中位数 %.0fms，7 天基线 %.0fms（%.1fx）",
+			trend.URL, trend.Median24hMs, trend.BaselineMs, trend.Ratio)
+		if lt.notificationService != nil {
+			lt.notificationService.NotifyLatencyDegraded(trend.URL, trend.Median24hMs, trend.BaselineMs, trend.Class)
+		}
+		if config.WebhookURL != "" {
+			go sendLatencyWebhook(config.WebhookURL, trend)
+		}
+	}
+	return trends, nil
+}
+
+// latencySample 一次成功探测的端点延迟
+type latencySample struct {
+	url       string
+	latencyMs float64
+	at        time.Time
+}
+
+// newlyDegraded 更新告警状态，返回新出现劣化的端点（已告警且尚未恢复的端点不重复返回）
+func (lt *LatencyTrendService) newlyDegraded(trends []EndpointLatencyTrend) []EndpointLatencyTrend {
+	var result []EndpointLatencyTrend
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	for _, trend := range trends {
+		slow := trend.Degraded && trend.Class != LatencyGood
+		if slow && !lt.alerted[trend.URL] {
+			lt.alerted[trend.URL] = true
+			result = append(result, trend)
+		} else if !slow && lt.alerted[trend.URL] {
+			delete(lt.alerted, trend.URL)
+			log.Printf("[LatencyTrend] ✅ %s 延迟已恢复正常", trend.URL)
+		}
+	}
+	return result
+}
+
+// computeLatencyTrends 按端点计算 24 小时中位数与此前 7 天基线
+func computeLatencyTrends(config RelayLatencyAlertConfig, now time.Time) ([]EndpointLatencyTrend, error) {
+	records, err := xdb.New("endpoint_latency").Selects(
+		xdb.WhereGte("created_at", now.Add(-8*24*time.Hour).Unix()),
+		xdb.WhereEq("success", 1),
+		xdb.Field("url", "latency_ms", "created_at"),
+	)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []EndpointLatencyTrend{}, nil
+		}
+		return nil, err
+	}
+
+	samples := make([]latencySample, 0, len(records))
+	for _, record := range records {
+		createdAt, ok := parseCreatedAt(record)
+		if !ok {
+			continue
+		}
+		samples = append(samples, latencySample{
+			url:       record.GetString("url"),
+			latencyMs: float64(record.GetInt64("latency_ms")),
+			at:        createdAt,
+		})
+	}
+	return buildLatencyTrends(samples, config, currentRelayConfig().LatencyClass, now), nil
+}
+
+// buildLatencyTrends 按端点汇总样本：now 之前 24 小时内为近期样本，更早的为基线样本
+// 近期与基线样本都达到 MinSamples 后才计算倍数，倍数达到 DegradeFactor 视为劣化
+func buildLatencyTrends(samples []latencySample, config RelayLatencyAlertConfig, thresholds RelayLatencyClassConfig, now time.Time) []EndpointLatencyTrend {
+	windowStart := now.Add(-24 * time.Hour)
+	type window struct{ recent, baseline []float64 }
+	byURL := make(map[string]*window)
+	for _, sample := range samples {
+		w, ok := byURL[sample.url]
+		if !ok {
+			w = &window{}
+			byURL[sample.url] = w
+		}
+		if sample.at.Before(windowStart) {
+			w.baseline = append(w.baseline, sample.latencyMs)
+		} else {
+			w.recent = append(w.recent, sample.latencyMs)
+		}
+	}
+
+	trends := make([]EndpointLatencyTrend, 0, len(byURL))
+	for url, w := range byURL {
+		trend := EndpointLatencyTrend{
+			URL:             url,
+			Median24hMs:     medianOf(w.recent),
+			BaselineMs:      medianOf(w.baseline),
+			Samples24h:      len(w.recent),
+			BaselineSamples: len(w.baseline),
+		}
+		if trend.Samples24h > 0 {
+			median := uint64(trend.Median24hMs)
+			trend.Class = thresholds.classify(&median)
+		}
+		if trend.Samples24h >= config.MinSamples && trend.BaselineSamples >= config.MinSamples && trend.BaselineMs > 0 {
+			trend.Ratio = trend.Median24hMs / trend.BaselineMs
+			trend.Degraded = trend.Ratio >= config.DegradeFactor
+		}
+		trends = append(trends, trend)
+	}
+	sort.Slice(trends, func(i, j int) bool { return trends[i].URL < trends[j].URL })
+	return trends
+}
+
+// medianOf 计算中位数，空切片返回 0
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// pruneEndpointLatency 清理过期的延迟样本
+func pruneEndpointLatency(before time.Time) {
+	if GlobalDBQueue == nil {
+		return
+	}
+	if err := GlobalDBQueue.Exec(`DELETE FROM endpoint_latency WHERE created_at < ?`, before.Unix()); err != nil {
+		log.Printf("[LatencyTrend] 清理过期延迟样本失败: %v", err)
+	}
+}
+
+// sendLatencyWebhook 将延迟劣化告警推送到 webhook
+func sendLatencyWebhook(webhookURL string, trend EndpointLatencyTrend) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":       "endpoint_latency_degraded",
+		"url":         trend.URL,
+		"median24hMs": trend.Median24hMs,
+		"baselineMs":  trend.BaselineMs,
+		"ratio":       trend.Ratio,
+		"timestamp":   time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("[LatencyTrend] 推送 webhook 失败: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[LatencyTrend] 推送 webhook 返回异常状态码: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMedianOf(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{nil, 0},
+		{[]float64{42}, 42},
+		{[]float64{300, 100, 200}, 200},
+		{[]float64{400, 100, 300, 200}, 250},
+		{[]float64{5, 5, 1000}, 5}, // 单个离群值不影响中位数
+	}
+	for _, tt := range tests {
+		input := append([]float64(nil), tt.values...)
+		if got := medianOf(input); got != tt.want {
+			t.Errorf("medianOf(%v) = %v, want %v", tt.values, got, tt.want)
+		}
+		for i := range input {
+			if input[i] != tt.values[i] {
+				t.Errorf("medianOf 不应修改输入: %v", input)
+				break
+			}
+		}
+	}
+}
+
+func TestBuildLatencyTrends(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	config := RelayLatencyAlertConfig{DegradeFactor: 2, MinSamples: 3}
+	thresholds := RelayLatencyClassConfig{GoodMs: 300, DegradedMs: 1000}
+	// samples 生成 recent 个近期样本与 baseline 个基线样本
+	samples := func(recentMs float64, recent int, baselineMs float64, baseline int) []latencySample {
+		var out []latencySample
+		for i := 0; i < recent; i++ {
+			out = append(out, latencySample{url: "https://api.example.com", latencyMs: recentMs, at: now.Add(-time.Duration(i+1) * time.Hour)})
+		}
+		for i := 0; i < baseline; i++ {
+			out = append(out, latencySample{url: "https://api.example.com", latencyMs: baselineMs, at: now.Add(-time.Duration(i+2) * 24 * time.Hour)})
+		}
+		return out
+	}
+
+	tests := []struct {
+		name         string
+		samples      []latencySample
+		wantRatio    float64
+		wantDegraded bool
+		wantClass    string
+	}{
+		{name: "基线样本不足（预热期）", samples: samples(900, 5, 100, 2), wantClass: LatencyDegraded},
+		{name: "近期样本不足", samples: samples(900, 2, 100, 5), wantClass: LatencyDegraded},
+		{name: "样本数恰好达到下限", samples: samples(900, 3, 300, 3), wantRatio: 3, wantDegraded: true, wantClass: LatencyDegraded},
+		{name: "倍数恰好等于阈值", samples: samples(400, 3, 200, 3), wantRatio: 2, wantDegraded: true, wantClass: LatencyDegraded},
+		{name: "倍数略低于阈值", samples: samples(399, 3, 200, 3), wantRatio: 1.995, wantClass: LatencyDegraded},
+		{name: "延迟下降", samples: samples(100, 3, 200, 3), wantRatio: 0.5, wantClass: LatencyGood},
+		{name: "基线为 0", samples: samples(100, 3, 0, 3), wantClass: LatencyGood},
+		{name: "只有基线样本", samples: samples(0, 0, 200, 5)},
+	}
+	for _, tt := range tests {
+		trends := buildLatencyTrends(tt.samples, config, thresholds, now)
+		if len(trends) != 1 {
+			t.Fatalf("%s: 应汇总为 1 个端点，得到 %d", tt.name, len(trends))
+		}
+		trend := trends[0]
+		if trend.Ratio != tt.wantRatio || trend.Degraded != tt.wantDegraded || trend.Class != tt.wantClass {
+			t.Errorf("%s: ratio=%v degraded=%v class=%q，期望 ratio=%v degraded=%v class=%q",
+				tt.name, trend.Ratio, trend.Degraded, trend.Class, tt.wantRatio, tt.wantDegraded, tt.wantClass)
+		}
+	}
+}
+
+func TestBuildLatencyTrendsWindowBoundary(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	windowStart := now.Add(-24 * time.Hour)
+	trends := buildLatencyTrends([]latencySample{
+		{url: "b", latencyMs: 10, at: windowStart},                   // 恰好 24 小时前计入近期
+		{url: "b", latencyMs: 20, at: windowStart.Add(-time.Second)}, // 更早的计入基线
+		{url: "a", latencyMs: 30, at: now},
+	}, RelayLatencyAlertConfig{DegradeFactor: 2, MinSamples: 1}, RelayLatencyClassConfig{GoodMs: 300, DegradedMs: 1000}, now)
+
+	if len(trends) != 2 || trends[0].URL != "a" || trends[1].URL != "b" {
+		t.Fatalf("应按 URL 排序汇总两个端点: %+v", trends)
+	}
+	if b := trends[1]; b.Samples24h != 1 || b.BaselineSamples != 1 || b.Median24hMs != 10 || b.BaselineMs != 20 {
+		t.Errorf("窗口边界划分不正确: %+v", b)
+	}
+}
+
+func TestLatencyTrendNewlyDegraded(t *testing.T) {
+	lt := NewLatencyTrendService(nil)
+	slow := EndpointLatencyTrend{URL: "u", Degraded: true, Class: LatencyDegraded}
+	fastButDoubled := EndpointLatencyTrend{URL: "v", Degraded: true, Class: LatencyGood}
+
+	if got := lt.newlyDegraded([]EndpointLatencyTrend{slow, fastButDoubled}); len(got) != 1 || got[0].URL != "u" {
+		t.Fatalf("劣化且不在正常分级内才告警: %+v", got)
+	}
+	if got := lt.newlyDegraded([]EndpointLatencyTrend{slow}); len(got) != 0 {
+		t.Errorf("已告警的端点不应重复告警: %+v", got)
+	}
+	// 恢复后再次劣化重新告警
+	lt.newlyDegraded([]EndpointLatencyTrend{{URL: "u", Class: LatencyGood}})
+	if got := lt.newlyDegraded([]EndpointLatencyTrend{slow}); len(got) != 1 {
+		t.Errorf("恢复后再次劣化应重新告警: %+v", got)
+	}
+}
@@ -27,13 +27,18 @@ func NewLogService() *LogService {
 }
 
 func (ls *LogService) ListRequestLogs(platform string, provider string, limit int) ([]ReqeustLog, error) {
+	return ls.listRequestLogs(platform, provider, limit)
+}
+
+// listRequestLogs 按 id 倒序查询请求日志，extra 为附加查询条件
+func (ls *LogService) listRequestLogs(platform string, provider string, limit int, extra ...xdb.Option) ([]ReqeustLog, error) {
 	if limit <= 0 {
 		limit = 100
 	}
 	if limit > 1000 {
 		limit = 1000
 	}
-	model := xdb.New("request_log")
+	model := sharedModel("request_log")
 	options := []xdb.Option{
 		xdb.OrderByDesc("id"),
 		xdb.Limit(limit),
@@ -44,6 +49,7 @@ func (ls *LogService) ListRequestLogs(platform string, provider string, limit in
 	if provider != "" {
 		options = append(options, xdb.WhereEq("provider", provider))
 	}
+	options = append(options, extra...)
 	records, err := model.Selects(options...)
 	if err != nil {
 		return nil, err
@@ -61,18 +67,23 @@ func (ls *LogService) ListRequestLogs(platform string, provider string, limit in
 			CacheCreateTokens: record.GetInt("cache_create_tokens"),
 			CacheReadTokens:   record.GetInt("cache_read_tokens"),
 			ReasoningTokens:   record.GetInt("reasoning_tokens"),
-			CreatedAt:         record.GetString("created_at"),
+			CreatedAt:         recordTimeString(record, "created_at"),
 			IsStream:          record.GetBool("is_stream"),
 			DurationSec:       record.GetFloat64("duration_sec"),
+			Project:           record.GetString("project"),
+			Client:            record.GetString("client"),
+			ClientProcess:     record.GetString("client_process"),
 		}
 		ls.decorateCost(&logEntry)
 		logs = append(logs, logEntry)
 	}
+	attachFeedback(logs)
+	attachAnnotations(logs)
 	return logs, nil
 }
 
 func (ls *LogService) ListProviders(platform string) ([]string, error) {
-	model := xdb.New("request_log")
+	model := sharedModel("request_log")
 	options := []xdb.Option{
 		xdb.Field("DISTINCT provider as provider"),
 		xdb.WhereNotEq("provider", ""),
@@ -107,9 +118,31 @@ func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 	if totalHours > 1 {
 		rangeStart = rangeStart.Add(-time.Duration(totalHours-1) * time.Hour)
 	}
-	model := xdb.New("request_log")
+	// 已汇总的时段读取小时汇总，之后的时段读取原始记录
+	hourBuckets := map[int64]*HeatmapStat{}
+	rawStart := rangeStart
+	if covered := rollupCoveredUntil(RollupGranularityHour); covered.After(rangeStart) {
+		rollups, err := loadRollups(RollupGranularityHour, "", rangeStart, covered)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rollups {
+			bucket := hourBuckets[r.BucketStart]
+			if bucket == nil {
+				bucket = &HeatmapStat{Day: time.Unix(r.BucketStart, 0).Format("01-02 15")}
+				hourBuckets[r.BucketStart] = bucket
+			}
+			bucket.TotalRequests += r.Requests
+			bucket.InputTokens += r.InputTokens
+			bucket.OutputTokens += r.OutputTokens
+			bucket.ReasoningTokens += r.ReasoningTokens
+			bucket.TotalCost += r.Cost
+		}
+		rawStart = covered
+	}
+	model := sharedModel("request_log")
 	options := []xdb.Option{
-		xdb.WhereGe("created_at", rangeStart.Format(timeLayout)),
+		xdb.WhereGe("created_at", rawStart.Unix()),
 		xdb.Field(
 			"model",
 			"input_tokens",
@@ -123,12 +156,11 @@ func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 	}
 	records, err := model.Selects(options...)
 	if err != nil {
-		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
-			return []HeatmapStat{}, nil
+		if !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+			return nil, err
 		}
-		return nil, err
+		records = nil
 	}
-	hourBuckets := map[int64]*HeatmapStat{}
 	for _, record := range records {
 		createdAt, _ := parseCreatedAt(record)
 		if createdAt.IsZero() {
@@ -184,13 +216,13 @@ func (ls *LogService) StatsSince(platform string) (LogStats, error) {
 		Series: make([]LogStatsSeries, 0, seriesHours),
 	}
 	now := time.Now()
-	model := xdb.New("request_log")
+	model := sharedModel("request_log")
 	seriesStart := startOfDay(now)
 	seriesEnd := seriesStart.Add(seriesHours * time.Hour)
 	queryStart := seriesStart.Add(-24 * time.Hour)
 	summaryStart := seriesStart
 	options := []xdb.Option{
-		xdb.WhereGte("created_at", queryStart.Format(timeLayout)),
+		xdb.WhereGte("created_at", queryStart.Unix()),
 		xdb.Field(
 			"model",
 			"input_tokens",
@@ -223,7 +255,7 @@ func (ls *LogService) StatsSince(platform string) (LogStats, error) {
 
 	for _, record := range records {
 		createdAt, hasTime := parseCreatedAt(record)
-		dayKey := dayFromTimestamp(record.GetString("created_at"))
+		dayKey := dayFromTimestamp(recordTimeString(record, "created_at"))
 		isToday := dayKey == seriesStart.Format("2006-01-02")
 
 		if hasTime {
@@ -304,9 +336,9 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 	start := startOfDay(time.Now())
 	end := start.Add(24 * time.Hour)
 	queryStart := start.Add(-24 * time.Hour)
-	model := xdb.New("request_log")
+	model := sharedModel("request_log")
 	options := []xdb.Option{
-		xdb.WhereGte("created_at", queryStart.Format(timeLayout)),
+		xdb.WhereGte("created_at", queryStart.Unix()),
 		xdb.Field(
 			"provider",
 			"model",
@@ -341,7 +373,7 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 				continue
 			}
 		} else {
-			dayKey := dayFromTimestamp(record.GetString("created_at"))
+			dayKey := dayFromTimestamp(recordTimeString(record, "created_at"))
 			if dayKey != start.Format("2006-01-02") {
 				continue
 			}
@@ -425,46 +457,10 @@ func (ls *LogService) calculateCost(model string, usage modelpricing.UsageSnapsh
 	return ls.pricing.CalculateCost(model, usage)
 }
 
+// parseCreatedAt 读取 created_at（UTC 时间戳）并转换为本地时间
 func parseCreatedAt(record xdb.Record) (time.Time, bool) {
-	if t := record.GetTime("created_at"); t != nil {
-		return t.In(time.Local), true
-	}
-	raw := strings.TrimSpace(record.GetString("created_at"))
-	if raw == "" {
-		return time.Time{}, false
-	}
-
-	layouts := []string{
-		timeLayout,
-		time.RFC3339,
-		"2006-01-02T15:04:05",
-		"2006-01-02 15:04:05 -0700",
-		"2006-01-02 15:04:05 -0700 MST",
-		"2006-01-02 15:04:05 MST",
-		"2006-01-02T15:04:05-0700",
-	}
-	for _, layout := range layouts {
-		if parsed, err := time.Parse(layout, raw); err == nil {
-			return parsed.In(time.Local), true
-		}
-		if parsed, err := time.ParseInLocation(layout, raw, time.Local); err == nil {
-			return parsed.In(time.Local), true
-		}
-	}
-
-	if normalized := strings.Replace(raw, " ", "T", 1); normalized != raw {
-		if parsed, err := time.Parse(time.RFC3339, normalized); err == nil {
-			return parsed.In(time.Local), true
-		}
-	}
-
-	if len(raw) >= len("2006-01-02") {
-		if parsed, err := time.ParseInLocation("2006-01-02", raw[:10], time.Local); err == nil {
-			return parsed, false
-		}
-	}
-
-	return time.Time{}, false
+	createdAt := recordTime(record, "created_at")
+	return createdAt, !createdAt.IsZero()
 }
 
 func dayFromTimestamp(value string) string {
@@ -498,7 +494,9 @@ func isNoSuchTableErr(err error) bool {
 	if err == nil {
 		return false
 	}
-	return strings.Contains(err.Error(), "no such table")
+	msg := err.Error()
+	// SQLite: no such table；PostgreSQL: relation "xxx" does not exist
+	return strings.Contains(msg, "no such table") || (strings.Contains(msg, "relation") && strings.Contains(msg, "does not exist"))
 }
 
 type HeatmapStat struct {
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// 内置脱敏规则名称
+const (
+	MaskRuleEmail  = "email"   // 邮箱地址
+	MaskRulePhone  = "phone"   // 电话号码（中国大陆手机号、北美格式号码）
+	MaskRulePath   = "path"    // 本地文件路径（Unix、~、Windows）
+	MaskRuleAPIKey = "api_key" // sk-/pk-/rk- 形式的密钥
+)
+
+// defaultMaskReplacement 自定义规则未指定替换文本时使用
+const defaultMaskReplacement = "[REDACTED]"
+
+// MaskPattern 用户自定义脱敏规则
+type MaskPattern struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`               // Go 正则表达式（RE2 语法）
+	Replacement string `json:"replacement,omitempty"` // 替换文本，为空时使用 [REDACTED]，支持 ${1} 引用分组
+}
+
+type maskRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// builtinMaskRules 内置脱敏规则
+// 路径规则要求前面是行首、空白或引号等分隔符，避免误伤 URL 中的路径
+var builtinMaskRules = map[string][]maskRule{
+	MaskRuleEmail: {
+		{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	},
+	MaskRulePhone: {
+		{regexp.MustCompile(`(?:\+?86[\s-]?)?\b1[3-9]\d{9}\b`), "[PHONE]"},
+		{regexp.MustCompile(`(?:\+1[\s.-]?)?\(?\b\d{3}\)?[\s.-]\d{3}[\s.-]\d{4}\b`), "[PHONE]"},
+	},
+	MaskRulePath: {
+		{regexp.MustCompile(`\b[A-Za-z]:\\(?:[^\\\s"'<>|]+\\)*[^\\\s"'<>|]*`), "[PATH]"},
+		{regexp.MustCompile(`(^|[\s"'=(,\[])~?(?:/[A-Za-z0-9._\-@+]+){2,}/?`), "${1}[PATH]"},
+	},
+	MaskRuleAPIKey: {
+		{regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_\-]{16,}`), "[API_KEY]"},
+	},
+}
+
+// BuiltinMaskRuleNames 返回全部内置规则名称
+func BuiltinMaskRuleNames() []string {
+	return []string{MaskRuleEmail, MaskRulePhone, MaskRulePath, MaskRuleAPIKey}
+}
+
+// masker 编译后的脱敏流水线
+type masker struct {
+	rules []maskRule
+}
+
+// newMasker 按配置编译脱敏规则：先应用内置规则，再应用自定义规则
+func newMasker(config RelayMaskingConfig) (*masker, error) {
+	m := &masker{}
+	if !config.Enabled {
+		return m, nil
+	}
+	for _, name := range config.BuiltinRules {
+		rules, ok := builtinMaskRules[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的内置脱敏规则: %s", name)
+		}
+		m.rules = append(m.rules, rules...)
+	}
+	for _, pattern := range config.CustomPatterns {
+		re, err := regexp.Compile(pattern.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("脱敏规则 %s 的正则无效: %w", pattern.Name, err)
+		}
+		replacement := pattern.Replacement
+		if replacement == "" {
+			replacement = defaultMaskReplacement
+		}
+		m.rules = append(m.rules, maskRule{re: re, replacement: replacement})
+	}
+	return m, nil
+}
+
+func (m *masker) mask(s string) string {
+	if m == nil || s == "" {
+		return s
+	}
+	for _, rule := range m.rules {
+		s = rule.re.ReplaceAllString(s, rule.replacement)
+	}
+	return s
+}
+
+var (
+	maskerMu        sync.Mutex
+	maskerConfigKey string
+	cachedMasker    *masker
+)
+
+// currentMasker 返回当前配置对应的脱敏流水线（按配置内容缓存，配置变化时重新编译）
+func currentMasker() *masker {
+	config := currentRelayConfig().Masking
+	keyBytes, _ := json.Marshal(config)
+	key := string(keyBytes)
+
+	maskerMu.Lock()
+	defer maskerMu.Unlock()
+	if cachedMasker != nil && key == maskerConfigKey {
+		return cachedMasker
+	}
+	m, err := newMasker(config)
+	if err != nil {
+		// 配置已在保存时校验，这里只可能是手动编辑了配置文件；回退到仅内置规则
+		fmt.Printf("[WARN] 脱敏规则编译失败，忽略自定义规则: %v\n", err)
+		config.CustomPatterns = nil
+		if m, err = newMasker(config); err != nil {
+			m = &masker{}
+		}
+	}
+	cachedMasker, maskerConfigKey = m, key
+	return m
+}
+
+// maskForStorage 在写入日志/对话/审计表之前对文本脱敏
+func maskForStorage(s string) string {
+	return currentMasker().mask(s)
+}
+
+// validateMaskingConfig 校验脱敏配置
+func validateMaskingConfig(config RelayMaskingConfig) error {
+	if _, err := newMasker(RelayMaskingConfig{
+		Enabled:        true,
+		BuiltinRules:   config.BuiltinRules,
+		CustomPatterns: config.CustomPatterns,
+	}); err != nil {
+		return err
+	}
+	for _, pattern := range config.CustomPatterns {
+		if pattern.Pattern == "" {
+			return fmt.Errorf("脱敏规则 %s 的正则不能为空", pattern.Name)
+		}
+		if regexp.MustCompile(pattern.Pattern).MatchString("") {
+			return fmt.Errorf("脱敏规则 %s 会匹配空字符串", pattern.Name)
+		}
+	}
+	return nil
+}
+
+// PreviewMasking 预览脱敏效果（供前端调试规则）
+func (ss *SettingsService) PreviewMasking(config RelayMaskingConfig, sample string) (string, error) {
+	config.Enabled = true
+	if err := validateMaskingConfig(config); err != nil {
+		return "", err
+	}
+	m, err := newMasker(config)
+	if err != nil {
+		return "", err
+	}
+	return m.mask(sample), nil
+}
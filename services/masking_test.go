@@ -0,0 +1,55 @@
+package services
+
+import "testing"
+
+func TestMasker_BuiltinRules(t *testing.T) {
+	m, err := newMasker(RelayMaskingConfig{Enabled: true, BuiltinRules: BuiltinMaskRuleNames()})
+	if err != nil {
+		t.Fatalf("newMasker() error = %v", err)
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"邮箱", "联系 alice.w@example.com 获取", "联系 [EMAIL] 获取"},
+		{"手机号", "电话 13812345678", "电话 [PHONE]"},
+		{"北美号码", "call (415) 555-0132 now", "call [PHONE] now"},
+		{"Unix 路径", `open "/Users/alice/work/app.go"`, `open "[PATH]"`},
+		{"家目录路径", "edit ~/projects/demo/main.go", "edit [PATH]"},
+		{"Windows 路径", `C:\Users\alice\app.go failed`, "[PATH] failed"},
+		{"URL 不视为路径", "see https://example.com/docs/api", "see https://example.com/docs/api"},
+		{"密钥", "key=sk-abcdefghijklmnop1234", "key=[API_KEY]"},
+		{"普通文本", "构建耗时 1234 ms", "构建耗时 1234 ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.mask(tt.input); got != tt.want {
+				t.Errorf("mask(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMasker_CustomPatterns(t *testing.T) {
+	m, err := newMasker(RelayMaskingConfig{
+		Enabled: true,
+		CustomPatterns: []MaskPattern{
+			{Name: "工号", Pattern: `EMP-\d+`},
+			{Name: "内网", Pattern: `(\w+)\.corp\.internal`, Replacement: "${1}.[HOST]"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("newMasker() error = %v", err)
+	}
+	if got, want := m.mask("EMP-42 on db1.corp.internal"), "[REDACTED] on db1.[HOST]"; got != want {
+		t.Errorf("mask() = %q, want %q", got, want)
+	}
+
+	if err := validateMaskingConfig(RelayMaskingConfig{CustomPatterns: []MaskPattern{{Name: "坏", Pattern: "("}}}); err == nil {
+		t.Error("无效正则应校验失败")
+	}
+	if err := validateMaskingConfig(RelayMaskingConfig{CustomPatterns: []MaskPattern{{Name: "空", Pattern: "x*"}}}); err == nil {
+		t.Error("匹配空字符串的正则应校验失败")
+	}
+}
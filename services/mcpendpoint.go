@@ -0,0 +1,327 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MCP 服务：以 Streamable HTTP 方式（只返回 JSON，不开启 SSE 流）提供管理工具，
+// 在 Claude Code 中添加：claude mcp add --transport http code-switch http://127.0.0.1:18100/mcp
+// 代理遇到持续错误时可以查询 provider 健康状态、测速并请求切换。
+
+const (
+	mcpProtocolVersion = "2025-06-18"
+	mcpServerName      = "code-switch"
+	mcpMaxBodyBytes    = 1 << 20
+)
+
+// JSON-RPC 错误码
+const (
+	mcpErrParse          = -32700
+	mcpErrInvalidRequest = -32600
+	mcpErrMethodNotFound = -32601
+	mcpErrInvalidParams  = -32602
+)
+
+// mcpSupportedVersions 支持的协议版本，客户端请求其中之一时原样返回
+var mcpSupportedVersions = map[string]bool{"2025-06-18": true, "2025-03-26": true, "2024-11-05": true}
+
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool tools/list 中的工具定义
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// mcpToolArgs 工具参数（各工具只使用其中一部分）
+type mcpToolArgs struct {
+	Platform string `json:"platform"`
+	Provider string `json:"provider"`
+	Reason   string `json:"reason"`
+}
+
+// MCPSpeedTestResult run_speedtest 的单条结果
+type MCPSpeedTestResult struct {
+	Provider  string  `json:"provider"`
+	URL       string  `json:"url"`
+	LatencyMs *uint64 `json:"latencyMs"` // nil 表示失败
+	Error     string  `json:"error,omitempty"`
+}
+
+func mcpPlatformSchema(required bool) map[string]any {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"platform": map[string]any{"type": "string", "enum": commandPlatforms, "description": "平台"},
+		},
+	}
+	if required {
+		schema["required"] = []string{"platform"}
+	}
+	return schema
+}
+
+// mcpTools 提供的工具
+func mcpTools() []mcpTool {
+	switchSchema := mcpPlatformSchema(true)
+	switchSchema["properties"].(map[string]any)["provider"] = map[string]any{"type": "string", "description": "要切换到的 provider 名称"}
+	switchSchema["properties"].(map[string]any)["reason"] = map[string]any{"type": "string", "description": "切换原因（记录到审计日志）"}
+	switchSchema["required"] = []string{"platform", "provider"}
+
+	speedSchema := mcpPlatformSchema(true)
+	speedSchema["properties"].(map[string]any)["provider"] = map[string]any{"type": "string", "description": "只测试指定 provider，为空时测试平台下全部已启用的 provider"}
+
+	return []mcpTool{
+		{"list_providers", "列出 code-switch 中配置的 provider 及当前使用的 provider（不含 API Key）", mcpPlatformSchema(false)},
+		{"get_health", "查询各平台当前 provider 与每个 provider 的健康状态（ok / blacklisted / auth_disabled / incident / disabled）", mcpPlatformSchema(false)},
+		{"switch_provider", "将平台切换到指定 provider，适用于当前 provider 持续报错时", switchSchema},
+		{"run_speedtest", "测试 provider 接口地址的响应延迟", speedSchema},
+	}
+}
+
+// mcpHandler POST /mcp：处理单个或批量 JSON-RPC 消息
+func (prs *ProviderRelayService) mcpHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentRelayConfig().MCP.Enabled {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "mcp disabled"})
+			return
+		}
+		if !isLoopbackRequest(c.Request) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "mcp is local only"})
+			return
+		}
+		// 防止网页通过 DNS 重绑定访问本机服务
+		if origin := c.GetHeader("Origin"); origin != "" && !isLoopbackOrigin(origin) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid origin"})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, mcpMaxBodyBytes))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, mcpResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &mcpError{mcpErrParse, "读取请求失败"}})
+			return
+		}
+		body = bytes.TrimSpace(body)
+
+		if len(body) > 0 && body[0] == '[' {
+			var requests []mcpRequest
+			if err := json.Unmarshal(body, &requests); err != nil {
+				c.JSON(http.StatusOK, mcpResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &mcpError{mcpErrParse, "无效的 JSON"}})
+				return
+			}
+			responses := make([]mcpResponse, 0, len(requests))
+			for _, req := range requests {
+				if resp := prs.handleMCPRequest(req); resp != nil {
+					responses = append(responses, *resp)
+				}
+			}
+			if len(responses) == 0 {
+				c.Status(http.StatusAccepted)
+				return
+			}
+			c.JSON(http.StatusOK, responses)
+			return
+		}
+
+		var req mcpRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			c.JSON(http.StatusOK, mcpResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &mcpError{mcpErrParse, "无效的 JSON"}})
+			return
+		}
+		resp := prs.handleMCPRequest(req)
+		if resp == nil {
+			// 通知不需要响应
+			c.Status(http.StatusAccepted)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// handleMCPRequest 处理单条消息；通知（没有 id）返回 nil
+func (prs *ProviderRelayService) handleMCPRequest(req mcpRequest) *mcpResponse {
+	if len(req.ID) == 0 || string(req.ID) == "null" {
+		return nil
+	}
+	resp := &mcpResponse{JSONRPC: "2.0", ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &mcpError{mcpErrInvalidRequest, "无效的 JSON-RPC 请求"}
+		return resp
+	}
+
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		version := mcpProtocolVersion
+		if mcpSupportedVersions[params.ProtocolVersion] {
+			version = params.ProtocolVersion
+		}
+		resp.Result = map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": mcpServerName, "version": "1.0.0"},
+			"instructions":    "查询与切换 code-switch 中继使用的 provider。当前 provider 持续报错时，先调用 get_health 查看状态，再用 switch_provider 切换到健康的 provider。",
+		}
+	case "ping":
+		resp.Result = map[string]any{}
+	case "tools/list":
+		resp.Result = map[string]any{"tools": mcpTools()}
+	case "tools/call":
+		var params struct {
+			Name      string      `json:"name"`
+			Arguments mcpToolArgs `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			resp.Error = &mcpError{mcpErrInvalidParams, "无效的参数"}
+			return resp
+		}
+		result, err := prs.callMCPTool(params.Name, params.Arguments)
+		if err != nil {
+			// 工具执行失败以结果返回，代理可以看到错误原因
+			resp.Result = map[string]any{
+				"content": []map[string]any{{"type": "text", "text": err.Error()}},
+				"isError": true,
+			}
+			return resp
+		}
+		text, _ := json.Marshal(result)
+		resp.Result = map[string]any{
+			"content": []map[string]any{{"type": "text", "text": string(text)}},
+			"isError": false,
+		}
+	default:
+		resp.Error = &mcpError{mcpErrMethodNotFound, fmt.Sprintf("不支持的方法: %s", req.Method)}
+	}
+	return resp
+}
+
+// callMCPTool 执行工具
+func (prs *ProviderRelayService) callMCPTool(name string, args mcpToolArgs) (any, error) {
+	if args.Platform != "" && !isCommandPlatform(args.Platform) {
+		return nil, fmt.Errorf("无效的平台: %s（可选值: claude、codex、gemini）", args.Platform)
+	}
+	switch name {
+	case "list_providers":
+		return CommandListProviders(prs.providerService, prs.geminiService, args.Platform)
+	case "get_health":
+		state := prs.editorState()
+		if args.Platform != "" {
+			state.Platforms = map[string]EditorPlatformState{args.Platform: state.Platforms[args.Platform]}
+		}
+		return state, nil
+	case "switch_provider":
+		if !currentRelayConfig().MCP.AllowSwitch {
+			return nil, fmt.Errorf("code-switch 未允许通过 MCP 切换 provider")
+		}
+		if args.Platform == "" || args.Provider == "" {
+			return nil, fmt.Errorf("platform 与 provider 不能为空")
+		}
+		if err := prs.switchProviderByName(args.Platform, args.Provider); err != nil {
+			return nil, err
+		}
+		detail := fmt.Sprintf("切换 %s 到 %s", args.Platform, args.Provider)
+		if reason := strings.TrimSpace(args.Reason); reason != "" {
+			detail += "，原因: " + reason
+		}
+		recordAudit("mcp", "switch_provider", detail)
+		return CommandSwitchOutput{Version: CommandOutputVersion, OK: true, Platform: args.Platform, Provider: args.Provider}, nil
+	case "run_speedtest":
+		if args.Platform == "" {
+			return nil, fmt.Errorf("platform 不能为空")
+		}
+		return prs.mcpSpeedTest(args.Platform, args.Provider)
+	default:
+		return nil, fmt.Errorf("未知的工具: %s", name)
+	}
+}
+
+// mcpSpeedTest 测试平台下已启用 provider（或指定 provider）的接口地址
+func (prs *ProviderRelayService) mcpSpeedTest(platform, provider string) ([]MCPSpeedTestResult, error) {
+	listing, err := CommandListProviders(prs.providerService, prs.geminiService, platform)
+	if err != nil {
+		return nil, err
+	}
+	var names, urls []string
+	for _, p := range listing.Platforms[0].Providers {
+		if p.APIURL == "" || (provider == "" && !p.Enabled) || (provider != "" && p.Name != provider) {
+			continue
+		}
+		names = append(names, p.Name)
+		urls = append(urls, p.APIURL)
+	}
+	if len(urls) == 0 {
+		if provider != "" {
+			return nil, fmt.Errorf("未找到名为 '%s' 且配置了接口地址的供应商", provider)
+		}
+		return nil, fmt.Errorf("%s 平台没有可测试的 provider", platform)
+	}
+
+	latencies := NewSpeedTestService().TestEndpoints(urls, nil)
+	results := make([]MCPSpeedTestResult, 0, len(latencies))
+	for i, latency := range latencies {
+		result := MCPSpeedTestResult{Provider: names[i], URL: latency.URL, LatencyMs: latency.Latency}
+		if latency.Error != nil {
+			result.Error = *latency.Error
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// isLoopbackRequest 请求是否来自本机：只看连接的对端地址，不信任 X-Forwarded-For 等可伪造的头；
+// 经 Unix socket 到达的请求由 socket 文件权限控制访问，视为本机
+func isLoopbackRequest(r *http.Request) bool {
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && local.Network() == "unix" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLoopbackOrigin Origin 是否指向本机
+func isLoopbackOrigin(origin string) bool {
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := parsed.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleMCPRequest(t *testing.T) {
+	prs := &ProviderRelayService{}
+
+	if resp := prs.handleMCPRequest(mcpRequest{JSONRPC: "2.0", Method: "notifications/initialized"}); resp != nil {
+		t.Fatalf("通知不应有响应，得到 %+v", resp)
+	}
+
+	resp := prs.handleMCPRequest(mcpRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: "initialize", Params: json.RawMessage(`{"protocolVersion":"2025-03-26"}`)})
+	if resp == nil || resp.Error != nil {
+		t.Fatalf("initialize 失败: %+v", resp)
+	}
+	if got := resp.Result.(map[string]any)["protocolVersion"]; got != "2025-03-26" {
+		t.Errorf("应返回客户端请求的协议版本，得到 %v", got)
+	}
+
+	resp = prs.handleMCPRequest(mcpRequest{JSONRPC: "2.0", ID: json.RawMessage("2"), Method: "tools/list"})
+	tools := resp.Result.(map[string]any)["tools"].([]mcpTool)
+	names := map[string]bool{}
+	for _, tool := range tools {
+		names[tool.Name] = true
+	}
+	for _, name := range []string{"list_providers", "get_health", "switch_provider", "run_speedtest"} {
+		if !names[name] {
+			t.Errorf("tools/list 缺少 %s", name)
+		}
+	}
+
+	resp = prs.handleMCPRequest(mcpRequest{JSONRPC: "2.0", ID: json.RawMessage(`"x"`), Method: "resources/list"})
+	if resp.Error == nil || resp.Error.Code != mcpErrMethodNotFound {
+		t.Errorf("未知方法应返回 %d，得到 %+v", mcpErrMethodNotFound, resp.Error)
+	}
+
+	resp = prs.handleMCPRequest(mcpRequest{JSONRPC: "2.0", ID: json.RawMessage("3"), Method: "tools/call", Params: json.RawMessage(`{"name":"get_health","arguments":{"platform":"foo"}}`)})
+	if resp.Error != nil || resp.Result.(map[string]any)["isError"] != true {
+		t.Errorf("无效平台应以 isError 结果返回，得到 %+v", resp)
+	}
+}
+
+func TestIsLoopbackOrigin(t *testing.T) {
+	cases := map[string]bool{
+		"http://localhost:5173": true,
+		"http://127.0.0.1":      true,
+		"http://[::1]:8080":     true,
+		"https://example.com":   false,
+		"null":                  false,
+	}
+	for origin, want := range cases {
+		if got := isLoopbackOrigin(origin); got != want {
+			t.Errorf("isLoopbackOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestIsLoopbackRequest(t *testing.T) {
+	cases := []struct {
+		remoteAddr string
+		forwarded  string
+		want       bool
+	}{
+		{remoteAddr: "127.0.0.1:50000", want: true},
+		{remoteAddr: "[::1]:50000", want: true},
+		{remoteAddr: "192.168.1.20:50000", want: false},
+		{remoteAddr: "192.168.1.20:50000", forwarded: "127.0.0.1", want: false}, // 伪造的代理头不可信
+		{remoteAddr: "127.0.0.1", want: false},
+		{remoteAddr: "", want: false},
+	}
+	for _, tt := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := isLoopbackRequest(req); got != tt.want {
+			t.Errorf("isLoopbackRequest(%q, XFF=%q) = %v, want %v", tt.remoteAddr, tt.forwarded, got, tt.want)
+		}
+	}
+
+	// 经 Unix socket 到达的请求没有 IP 对端地址
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "@"
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.UnixAddr{Name: "/tmp/relay.sock", Net: "unix"}))
+	if !isLoopbackRequest(req) {
+		t.Error("Unix socket 请求应视为本机")
+	}
+}
+
+// writeTestRelayConfig 在临时 HOME 下写入中继配置
+func writeTestRelayConfig(t *testing.T, config *RelayConfig) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	data, _ := json.Marshal(config)
+	if err := os.MkdirAll(filepath.Join(home, ".code-switch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".code-switch", "relay-config.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMCPHandlerRejectsForwardedLoopback(t *testing.T) {
+	config := DefaultRelayConfig()
+	config.MCP.Enabled = true
+	writeTestRelayConfig(t, config)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New() // 默认信任所有代理，模拟未收紧的 engine
+	router.POST("/mcp", (&ProviderRelayService{}).mcpHandler())
+
+	send := func(remoteAddr, forwarded string) int {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		req.RemoteAddr = remoteAddr
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	if code := send("192.168.1.20:50000", "127.0.0.1"); code != http.StatusForbidden {
+		t.Errorf("局域网主机伪造 X-Forwarded-For 应返回 403，得到 %d", code)
+	}
+	if code := send("127.0.0.1:50000", ""); code != http.StatusOK {
+		t.Errorf("本机请求应放行，得到 %d", code)
+	}
+}
@@ -16,7 +16,6 @@ import (
 )
 
 const (
-	mcpStoreDir     = ".code-switch"
 	mcpStoreFile    = "mcp.json"
 	claudeMcpFile   = ".claude.json"
 	codexDirName    = ".codex"
@@ -192,24 +191,38 @@ func (ms *MCPService) SaveServers(servers []MCPServer) error {
 		}
 	}
 
+	// mcp.json 与 Claude / Codex 的 MCP 配置在同一事务中写入
+	tx, err := beginConfigTransaction("保存 MCP 服务器")
+	if err != nil {
+		return err
+	}
+	for _, pathFn := range []func() (string, error){ms.configPath, claudeConfigPath, codexConfigPath} {
+		path, err := pathFn()
+		if err == nil {
+			err = tx.Track(path)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
 	if err := ms.saveConfig(raw); err != nil {
+		tx.Rollback()
 		return err
 	}
 	if err := ms.syncClaudeServers(normalized); err != nil {
+		tx.Rollback()
 		return err
 	}
 	if err := ms.syncCodexServers(normalized); err != nil {
+		tx.Rollback()
 		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
 func (ms *MCPService) configPath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-	dir := filepath.Join(home, mcpStoreDir)
+	dir := getConfigDir()
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return "", err
 	}
@@ -329,7 +342,11 @@ func (ms *MCPService) saveConfig(payload map[string]rawMCPServer) error {
 	if err := os.WriteFile(tmp, data, 0o644); err != nil {
 		return err
 	}
-	return os.Rename(tmp, path)
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	recordConfigIntegrity(path)
+	return nil
 }
 
 func normalizeServerType(value string) string {
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 内置模拟 provider：不访问网络，按模板返回各平台格式的响应（支持流式），可配置延迟与故障概率。
+// 用于没有网络时开发前端、演练降级策略。模拟 provider 不需要 API 地址和 Key，离线模式下视为本地 provider。
+// 故障与真实上游失败走相同的处理流程（拉黑、Retry-After 冷却、401 停用）；响应不计 token 与费用。
+
+const (
+	// mockDefaultResponse 未配置模板时的响应
+	mockDefaultResponse = "这是来自 {{provider}} 的模拟响应（模型 {{model}}）。"
+	// mockChunkRunes 流式响应每个片段的字符数
+	mockChunkRunes = 8
+	// mockPromptRunes {{prompt}} 保留的字符数
+	mockPromptRunes = 200
+	// mockMaxResponseLength 响应模板最大长度
+	mockMaxResponseLength = 64 << 10
+)
+
+// ProviderMock 模拟 provider 配置
+type ProviderMock struct {
+	Response          string  `json:"response,omitempty"`          // 响应模板，支持 {{provider}} {{model}} {{platform}} {{prompt}}（最后一条用户消息），为空时使用默认文本
+	LatencyMs         int     `json:"latencyMs,omitempty"`         // 返回响应前的等待时间（毫秒）
+	ChunkDelayMs      int     `json:"chunkDelayMs,omitempty"`      // 流式响应片段之间的间隔（毫秒）
+	ErrorRate         float64 `json:"errorRate,omitempty"`         // 返回错误的概率（0-1）
+	ErrorStatus       int     `json:"errorStatus,omitempty"`       // 错误状态码（400-599），默认 500
+	RetryAfterSeconds int     `json:"retryAfterSeconds,omitempty"` // 错误为 429/503 时携带的 Retry-After（秒）
+}
+
+// mockRand 故障概率的随机数来源（测试时替换）
+var mockRand = rand.Float64
+
+func (p *Provider) isMockProvider() bool {
+	return p.Mock != nil
+}
+
+// validateProviderMock 校验模拟 provider 配置
+func validateProviderMock(mock *ProviderMock) error {
+	if mock == nil {
+		return nil
+	}
+	if mock.LatencyMs < 0 || mock.LatencyMs > 300000 {
+		return fmt.Errorf("模拟延迟必须在 0-300000 毫秒之间")
+	}
+	if mock.ChunkDelayMs < 0 || mock.ChunkDelayMs > 10000 {
+		return fmt.Errorf("模拟流式片段间隔必须在 0-10000 毫秒之间")
+	}
+	if mock.ErrorRate < 0 || mock.ErrorRate > 1 {
+		return fmt.Errorf("模拟故障概率必须在 0-1 之间")
+	}
+	if mock.ErrorStatus != 0 && (mock.ErrorStatus < 400 || mock.ErrorStatus > 599) {
+		return fmt.Errorf("模拟错误状态码必须在 400-599 之间")
+	}
+	if mock.RetryAfterSeconds < 0 || mock.RetryAfterSeconds > 86400 {
+		return fmt.Errorf("模拟 Retry-After 必须在 0-86400 秒之间")
+	}
+	if len(mock.Response) > mockMaxResponseLength {
+		return fmt.Errorf("模拟响应模板不能超过 %d 字节", mockMaxResponseLength)
+	}
+	return nil
+}
+
+// serveMock 按模拟 provider 配置返回响应，返回模拟的状态码；失败时不写响应，由调用方按真实失败处理
+func (prs *ProviderRelayService) serveMock(c *gin.Context, kind, name string, mock ProviderMock, model string, body []byte, stream bool, start time.Time, retries int) (int, error) {
+	ctx := c.Request.Context()
+	if err := sleepContext(ctx, time.Duration(mock.LatencyMs)*time.Millisecond); err != nil {
+		return 0, fmt.Errorf("%w: %v", errClientAbort, err)
+	}
+
+	if mock.ErrorRate > 0 && mockRand() < mock.ErrorRate {
+		status := mock.ErrorStatus
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		fmt.Printf("[MOCK] 🎭 %s 模拟故障: HTTP %d\n", name, status)
+		if mock.RetryAfterSeconds > 0 {
+			header := http.Header{"Retry-After": {strconv.Itoa(mock.RetryAfterSeconds)}}
+			if wait, ok := prs.observeRetryAfter(kind, name, status, header); ok {
+				return status, &retryAfterError{status: status, wait: wait}
+			}
+		}
+		return status, fmt.Errorf("upstream status %d", status)
+	}
+
+	template := mock.Response
+	if template == "" {
+		template = mockDefaultResponse
+	}
+	text := strings.NewReplacer(
+		"{{provider}}", name,
+		"{{model}}", model,
+		"{{platform}}", kind,
+		"{{prompt}}", mockPrompt(kind, body),
+	).Replace(template)
+
+	setAttributionHeaders(c, name, time.Since(start), retries)
+	if err := writeStubResponse(c, kind, model, splitMockChunks(text, mockChunkRunes), stream, time.Duration(mock.ChunkDelayMs)*time.Millisecond); err != nil {
+		return http.StatusOK, fmt.Errorf("%w: %v", errClientAbort, err)
+	}
+	return http.StatusOK, nil
+}
+
+// sleepContext 等待 d，ctx 结束时提前返回错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mockPrompt 请求中最后一条用户消息的文本（截断），用于 {{prompt}}
+func mockPrompt(kind string, body []byte) string {
+	var messages gjson.Result
+	var contentField string
+	switch kind {
+	case "codex":
+		input := gjson.GetBytes(body, "input")
+		if input.Type == gjson.String {
+			return truncateRunes(input.String(), mockPromptRunes)
+		}
+		messages, contentField = input, "content"
+	case "gemini":
+		messages, contentField = gjson.GetBytes(body, "contents"), "parts"
+	default:
+		messages, contentField = gjson.GetBytes(body, "messages"), "content"
+	}
+
+	items := messages.Array()
+	for i := len(items) - 1; i >= 0; i-- {
+		if role := items[i].Get("role").String(); role != "" && role != "user" {
+			continue
+		}
+		content := items[i].Get(contentField)
+		if content.Type == gjson.String {
+			return truncateRunes(content.String(), mockPromptRunes)
+		}
+		var texts []string
+		for _, part := range content.Array() {
+			if text := part.Get("text"); text.Exists() {
+				texts = append(texts, text.String())
+			}
+		}
+		return truncateRunes(strings.Join(texts, "\n"), mockPromptRunes)
+	}
+	return ""
+}
+
+// splitMockChunks 按字符数切分流式片段
+func splitMockChunks(text string, size int) []string {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return []string{""}
+	}
+	chunks := make([]string, 0, (len(runes)+size-1)/size)
+	for start := 0; start < len(runes); start += size {
+		end := min(start+size, len(runes))
+		chunks = append(chunks, string(runes[start:end]))
+	}
+	return chunks
+}
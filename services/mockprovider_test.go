@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMockPrompt(t *testing.T) {
+	cases := []struct {
+		kind string
+		body string
+		want string
+	}{
+		{"claude", `{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"yo"},{"role":"user","content":[{"type":"text","text":"last"}]}]}`, "last"},
+		{"codex", `{"input":"plain"}`, "plain"},
+		{"codex", `{"input":[{"role":"user","content":[{"type":"input_text","text":"q"}]}]}`, "q"},
+		{"gemini", `{"contents":[{"role":"user","parts":[{"text":"a"},{"text":"b"}]}]}`, "a\nb"},
+		{"claude", `{}`, ""},
+	}
+	for _, tc := range cases {
+		if got := mockPrompt(tc.kind, []byte(tc.body)); got != tc.want {
+			t.Errorf("%s %s: 期望 %q，得到 %q", tc.kind, tc.body, tc.want, got)
+		}
+	}
+}
+
+func TestSplitMockChunks(t *testing.T) {
+	chunks := splitMockChunks("模拟响应abcdefg", 4)
+	if len(chunks) != 3 || chunks[0] != "模拟响应" || strings.Join(chunks, "") != "模拟响应abcdefg" {
+		t.Errorf("切分结果不正确: %q", chunks)
+	}
+}
+
+func TestServeMock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{cooldowns: newCooldownTracker()}
+	newContext := func() (*gin.Context, *httptest.ResponseRecorder) {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		return c, recorder
+	}
+
+	c, recorder := newContext()
+	mock := ProviderMock{Response: "{{provider}} 收到 {{model}}"}
+	status, err := prs.serveMock(c, "claude", "mock-a", mock, "claude-x", nil, false, time.Now(), 0)
+	if err != nil || status != http.StatusOK || !strings.Contains(recorder.Body.String(), "mock-a 收到 claude-x") {
+		t.Errorf("应返回模板渲染后的响应: %d %v %s", status, err, recorder.Body.String())
+	}
+
+	original := mockRand
+	mockRand = func() float64 { return 0 }
+	defer func() { mockRand = original }()
+
+	c, _ = newContext()
+	mock = ProviderMock{ErrorRate: 0.5, ErrorStatus: http.StatusTooManyRequests, RetryAfterSeconds: 30}
+	status, err = prs.serveMock(c, "claude", "mock-b", mock, "claude-x", nil, false, time.Now(), 0)
+	var rateLimited *retryAfterError
+	if status != http.StatusTooManyRequests || !errors.As(err, &rateLimited) {
+		t.Errorf("应模拟 429 并进入冷却: %d %v", status, err)
+	}
+	if prs.cooldowns.remaining("claude", "mock-b", time.Now()) <= 0 {
+		t.Error("模拟 429 应让 provider 进入冷却")
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// 按模型的路由权重：同一 Level 内的 provider 按权重随机排序，权重越高越可能被优先使用，
+// 其余 provider 依次作为降级候选（降级顺序同样按权重）。权重可以按模型设置
+// （如 provider A 处理 sonnet 很好、处理 haiku 很差），匹配优先级：精确模型 > 通配符 > 全部模型。
+// 同一 Level 内没有任何 provider 匹配到权重时保持原有顺序；权重为 0 的 provider 只在同级其他 provider 都失败后使用。
+
+const (
+	// defaultModelWeight 未配置权重的 provider 的权重
+	defaultModelWeight = 100
+	// maxModelWeight 权重上限
+	maxModelWeight = 10000
+)
+
+// weightRand 权重排序使用的随机数（测试中替换）
+var weightRand = rand.Float64
+
+// RelayWeightsConfig 按模型的路由权重配置
+type RelayWeightsConfig struct {
+	Enabled bool          `json:"enabled"`
+	Table   []ModelWeight `json:"table"`
+}
+
+// ModelWeight 权重表中的一项
+type ModelWeight struct {
+	Platform string `json:"platform"`
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"` // 模型名，支持单个 * 通配符，为空表示全部模型
+	Weight   int    `json:"weight"`          // 0-10000，未配置时为 100
+}
+
+// validateWeightsConfig 校验权重表
+func validateWeightsConfig(config RelayWeightsConfig) error {
+	seen := make(map[string]bool, len(config.Table))
+	for _, item := range config.Table {
+		if !isCommandPlatform(item.Platform) {
+			return fmt.Errorf("权重表中的平台无效: %s", item.Platform)
+		}
+		if strings.TrimSpace(item.Provider) == "" {
+			return fmt.Errorf("权重表中的 provider 不能为空")
+		}
+		if strings.Count(item.Model, "*") > 1 {
+			return fmt.Errorf("权重表中的模型 %s 只能包含一个 * 通配符", item.Model)
+		}
+		if item.Weight < 0 || item.Weight > maxModelWeight {
+			return fmt.Errorf("provider %s 的权重必须在 0-%d 之间", item.Provider, maxModelWeight)
+		}
+		key := item.Platform + "/" + item.Provider + "/" + item.Model
+		if seen[key] {
+			return fmt.Errorf("权重表中 %s 的模型 %q 重复", item.Provider, item.Model)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// weightFor 查找 provider 处理 model 的权重，没有匹配项时返回 false
+func (c RelayWeightsConfig) weightFor(platform, provider, model string) (int, bool) {
+	best, bestRank := 0, -1
+	for _, item := range c.Table {
+		if item.Platform != platform || item.Provider != provider {
+			continue
+		}
+		// 精确匹配优先，其次是更长的通配符，最后是全部模型
+		rank := -1
+		switch {
+		case item.Model == "" || item.Model == "*":
+			rank = 0
+		case item.Model == model:
+			rank = math.MaxInt32
+		case model != "" && matchWildcard(item.Model, model):
+			rank = len(item.Model)
+		}
+		if rank > bestRank {
+			best, bestRank = item.Weight, rank
+		}
+	}
+	return best, bestRank >= 0
+}
+
+// order 按权重为同一 Level 的 provider 排序，返回新顺序的下标；没有 provider 匹配到权重时返回 nil（保持原顺序）
+// 使用加权无放回抽样：每个 provider 的排序键为 u^(1/w)，键越大越靠前
+func (c RelayWeightsConfig) order(platform, model string, names []string) []int {
+	if !c.Enabled || len(names) < 2 {
+		return nil
+	}
+	weights := make([]int, len(names))
+	matched := false
+	for i, name := range names {
+		weight, ok := c.weightFor(platform, name, model)
+		if ok {
+			matched = true
+		} else {
+			weight = defaultModelWeight
+		}
+		weights[i] = weight
+	}
+	if !matched {
+		return nil
+	}
+
+	keys := make([]float64, len(names))
+	for i, weight := range weights {
+		if weight <= 0 {
+			keys[i] = -1 // 权重为 0 的排在最后
+			continue
+		}
+		keys[i] = math.Pow(weightRand(), 1/float64(weight))
+	}
+	indexes := make([]int, len(names))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool { return keys[indexes[a]] > keys[indexes[b]] })
+	return indexes
+}
+
+// orderProvidersByWeight 按当前配置的权重为同一 Level 的 provider 排序
+func orderProvidersByWeight(kind, model string, providers []Provider) []Provider {
+	names := make([]string, len(providers))
+	for i, provider := range providers {
+		names[i] = provider.Name
+	}
+	indexes := currentRelayConfig().Weights.order(kind, model, names)
+	if indexes == nil {
+		return providers
+	}
+	ordered := make([]Provider, len(providers))
+	for i, index := range indexes {
+		ordered[i] = providers[index]
+	}
+	return ordered
+}
+
+// orderGeminiProvidersByWeight 按当前配置的权重为同一 Level 的 Gemini provider 排序
+func orderGeminiProvidersByWeight(model string, providers []GeminiProvider) []GeminiProvider {
+	names := make([]string, len(providers))
+	for i, provider := range providers {
+		names[i] = provider.Name
+	}
+	indexes := currentRelayConfig().Weights.order("gemini", model, names)
+	if indexes == nil {
+		return providers
+	}
+	ordered := make([]GeminiProvider, len(providers))
+	for i, index := range indexes {
+		ordered[i] = providers[index]
+	}
+	return ordered
+}
+
+// GetModelWeights 获取平台的权重表（供前端调用）
+func (ss *SettingsService) GetModelWeights(platform string) ([]ModelWeight, error) {
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return nil, err
+	}
+	weights := make([]ModelWeight, 0, len(config.Weights.Table))
+	for _, item := range config.Weights.Table {
+		if item.Platform == platform {
+			weights = append(weights, item)
+		}
+	}
+	return weights, nil
+}
+
+// SetModelWeight 新增或修改权重表中的一项（平台、provider 与模型相同的视为同一项），并启用按模型的权重（供前端调用）
+func (ss *SettingsService) SetModelWeight(weight ModelWeight) error {
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return err
+	}
+	weight.Provider = strings.TrimSpace(weight.Provider)
+	weight.Model = strings.TrimSpace(weight.Model)
+	replaced := false
+	for i, item := range config.Weights.Table {
+		if item.Platform == weight.Platform && item.Provider == weight.Provider && item.Model == weight.Model {
+			config.Weights.Table[i] = weight
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		config.Weights.Table = append(config.Weights.Table, weight)
+	}
+	config.Weights.Enabled = true
+	return ss.UpdateRelayConfig(config)
+}
+
+// DeleteModelWeight 删除权重表中的一项（供前端调用）
+func (ss *SettingsService) DeleteModelWeight(platform, provider, model string) error {
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return err
+	}
+	kept := make([]ModelWeight, 0, len(config.Weights.Table))
+	for _, item := range config.Weights.Table {
+		if item.Platform != platform || item.Provider != provider || item.Model != model {
+			kept = append(kept, item)
+		}
+	}
+	if len(kept) == len(config.Weights.Table) {
+		return fmt.Errorf("权重表中没有 %s/%s 的模型 %q", platform, provider, model)
+	}
+	config.Weights.Table = kept
+	return ss.UpdateRelayConfig(config)
+}
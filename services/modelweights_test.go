@@ -0,0 +1,60 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestModelWeightsOrder(t *testing.T) {
+	config := RelayWeightsConfig{
+		Enabled: true,
+		Table: []ModelWeight{
+			{Platform: "claude", Provider: "a", Weight: 50},
+			{Platform: "claude", Provider: "a", Model: "claude-sonnet-*", Weight: 1000},
+			{Platform: "claude", Provider: "a", Model: "claude-3-5-haiku", Weight: 0},
+			{Platform: "claude", Provider: "b", Model: "claude-*", Weight: 10},
+		},
+	}
+	if err := validateWeightsConfig(config); err != nil {
+		t.Fatalf("validateWeightsConfig: %v", err)
+	}
+
+	cases := []struct {
+		provider, model string
+		want            int
+		ok              bool
+	}{
+		{"a", "claude-sonnet-4", 1000, true},
+		{"a", "claude-3-5-haiku", 0, true},
+		{"a", "claude-opus-4", 50, true},
+		{"b", "claude-opus-4", 10, true},
+		{"b", "gpt-5", 0, false},
+		{"c", "claude-sonnet-4", 0, false},
+	}
+	for _, tc := range cases {
+		got, ok := config.weightFor("claude", tc.provider, tc.model)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("weightFor(%s, %s) = %d, %v, want %d, %v", tc.provider, tc.model, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	original := weightRand
+	defer func() { weightRand = original }()
+	weightRand = func() float64 { return 0.5 }
+
+	names := []string{"b", "c", "a"}
+	if got := config.order("claude", "claude-sonnet-4", names); !slices.Equal(got, []int{2, 1, 0}) {
+		t.Errorf("sonnet order = %v, want a, c, b", got)
+	}
+	if got := config.order("claude", "claude-3-5-haiku", names); !slices.Equal(got, []int{1, 0, 2}) {
+		t.Errorf("haiku order = %v, want c, b, a（权重为 0 的排在最后）", got)
+	}
+	if got := config.order("codex", "gpt-5", names); got != nil {
+		t.Errorf("没有匹配的权重时应保持原顺序，got %v", got)
+	}
+
+	config.Table = append(config.Table, ModelWeight{Platform: "claude", Provider: "a", Weight: 1})
+	if err := validateWeightsConfig(config); err == nil {
+		t.Errorf("重复的权重项应校验失败")
+	}
+}
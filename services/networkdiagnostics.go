@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// networkDiagnosticsTimeout 单个诊断请求的超时时间
+const networkDiagnosticsTimeout = 5 * time.Second
+
+// 诊断结论
+const (
+	NetworkVerdictOK                = "ok"                  // 网络与目标端点均正常
+	NetworkVerdictOffline           = "offline"             // 完全无法联网
+	NetworkVerdictDNSFailure        = "dns_failure"         // DNS 解析失败
+	NetworkVerdictCaptivePortal     = "captive_portal"      // 处于强制门户（酒店/机场 Wi-Fi 登录页）
+	NetworkVerdictProxyAuthRequired = "proxy_auth_required" // 代理需要认证
+	NetworkVerdictTLSIntercepted    = "tls_intercepted"     // HTTPS 被中间人拦截（企业代理/安全软件）
+	NetworkVerdictEndpointDown      = "endpoint_down"       // 网络正常，但目标端点不可用
+)
+
+// networkBeacon 公开的连通性检测地址及其预期响应
+type networkBeacon struct {
+	name       string
+	url        string
+	wantStatus int
+	wantBody   string // 为空时只校验状态码
+}
+
+// networkBeacons 各系统用于检测强制门户的公开地址（明文 HTTP，门户会劫持并重定向）
+var networkBeacons = []networkBeacon{
+	{"google", "http://connectivitycheck.gstatic.com/generate_204", http.StatusNoContent, ""},
+	{"apple", "http://captive.apple.com/hotspot-detect.html", http.StatusOK, "Success"},
+	{"microsoft", "http://www.msftconnecttest.com/connecttest.txt", http.StatusOK, "Microsoft Connect Test"},
+	{"xiaomi", "http://connect.rom.miui.com/generate_204", http.StatusNoContent, ""},
+}
+
+// BeaconResult 单个检测地址的结果
+type BeaconResult struct {
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	OK         bool   `json:"ok"`                   // 响应符合预期
+	StatusCode int    `json:"statusCode,omitempty"` // 实际状态码
+	Location   string `json:"location,omitempty"`   // 被重定向到的地址（通常是门户登录页）
+	LatencyMs  int64  `json:"latencyMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// EndpointCheckResult 目标端点的分步检测结果
+type EndpointCheckResult struct {
+	URL        string `json:"url"`
+	Host       string `json:"host"`
+	DNSOK      bool   `json:"dnsOk"`
+	TCPOK      bool   `json:"tcpOk"`
+	TLSOK      bool   `json:"tlsOk"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	LatencyMs  int64  `json:"latencyMs"`
+	TLSIssuer  string `json:"tlsIssuer,omitempty"` // 证书颁发者，便于识别中间人代理
+	Error      string `json:"error,omitempty"`
+}
+
+// NetworkDiagnosticsReport 网络诊断报告
+type NetworkDiagnosticsReport struct {
+	Verdict   string               `json:"verdict"`
+	Summary   string               `json:"summary"`  // 一句话结论
+	Guidance  []string             `json:"guidance"` // 可操作的处理建议
+	ProxyURL  string               `json:"proxyUrl,omitempty"`
+	Beacons   []BeaconResult       `json:"beacons"`
+	Endpoint  *EndpointCheckResult `json:"endpoint,omitempty"`
+	CheckedAt int64                `json:"checkedAt"`
+}
+
+// RunNetworkDiagnostics 诊断网络问题（供前端调用）
+// endpointURL 为空时只检测基础网络；否则额外分步检测该端点（DNS / TCP / TLS / HTTP）
+func (nm *NetworkMonitorService) RunNetworkDiagnostics(endpointURL string) (*NetworkDiagnosticsReport, error) {
+	report := &NetworkDiagnosticsReport{
+		Guidance:  []string{},
+		CheckedAt: time.Now().UnixMilli(),
+	}
+
+	var target *url.URL
+	if endpointURL = strings.TrimSpace(endpointURL); endpointURL != "" {
+		parsed, err := url.Parse(endpointURL)
+		if err != nil || parsed.Hostname() == "" {
+			return nil, fmt.Errorf("无效的端点地址: %s", endpointURL)
+		}
+		target = parsed
+	}
+
+	probeURL := "http://connectivitycheck.gstatic.com/"
+	if target != nil {
+		probeURL = target.String()
+	}
+	report.ProxyURL = detectSystemProxy(probeURL)
+
+	var wg sync.WaitGroup
+	report.Beacons = make([]BeaconResult, len(networkBeacons))
+	for i, beacon := range networkBeacons {
+		wg.Add(1)
+		go func(i int, beacon networkBeacon) {
+			defer wg.Done()
+			report.Beacons[i] = checkBeacon(beacon)
+		}(i, beacon)
+	}
+	if target != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Endpoint = checkEndpoint(target)
+		}()
+	}
+	wg.Wait()
+
+	classifyNetworkDiagnostics(report)
+	return report, nil
+}
+
+// detectSystemProxy 返回转发时该地址使用的代理（PAC 或环境变量，隐藏账号密码）
+func detectSystemProxy(rawURL string) string {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return ""
+	}
+	proxyURL, err := relayProxy(req)
+	if err != nil || proxyURL == nil {
+		return ""
+	}
+	return proxyURL.Redacted()
+}
+
+// diagnosticsHTTPClient 不跟随重定向的客户端，以便识别门户跳转
+func diagnosticsHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: networkDiagnosticsTimeout,
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkBeacon 请求检测地址并比对预期响应
+func checkBeacon(beacon networkBeacon) BeaconResult {
+	result := BeaconResult{Name: beacon.name, URL: beacon.url}
+	start := time.Now()
+	resp, err := diagnosticsHTTPClient().Get(beacon.url)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.Location = resp.Header.Get("Location")
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	result.OK = resp.StatusCode == beacon.wantStatus &&
+		(beacon.wantBody == "" || strings.Contains(string(body), beacon.wantBody))
+	return result
+}
+
+// checkEndpoint 分步检测端点，定位失败发生在哪一层
+func checkEndpoint(target *url.URL) *EndpointCheckResult {
+	host := target.Hostname()
+	port := target.Port()
+	if port == "" {
+		port = "443"
+		if target.Scheme == "http" {
+			port = "80"
+		}
+	}
+	result := &EndpointCheckResult{URL: target.String(), Host: host}
+	start := time.Now()
+	defer func() { result.LatencyMs = time.Since(start).Milliseconds() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), networkDiagnosticsTimeout)
+	defer cancel()
+
+	if net.ParseIP(host) == nil {
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			result.Error = fmt.Sprintf("DNS 解析失败: %v", err)
+			return result
+		}
+	}
+	result.DNSOK = true
+
+	// 配置了代理时直连可能本就不通，TCP/TLS 检测交给 HTTP 请求完成
+	if detectSystemProxy(target.String()) == "" {
+		dialer := &net.Dialer{}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			result.Error = fmt.Sprintf("TCP 连接失败: %v", err)
+			return result
+		}
+		result.TCPOK = true
+
+		if target.Scheme == "https" {
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+			err := tlsConn.HandshakeContext(ctx)
+			tlsConn.Close()
+			if err != nil {
+				result.TLSIssuer = unverifiedIssuer(err)
+				result.Error = fmt.Sprintf("TLS 握手失败: %v", err)
+				return result
+			}
+		} else {
+			conn.Close()
+		}
+		result.TLSOK = true
+	}
+
+	resp, err := diagnosticsHTTPClient().Get(target.String())
+	if err != nil {
+		if issuer := unverifiedIssuer(err); issuer != "" {
+			result.TCPOK, result.TLSIssuer = true, issuer
+		}
+		result.Error = fmt.Sprintf("HTTP 请求失败: %v", err)
+		return result
+	}
+	resp.Body.Close()
+	result.TCPOK, result.TLSOK = true, true
+	result.StatusCode = resp.StatusCode
+	return result
+}
+
+// unverifiedIssuer 证书校验失败时返回对方证书的颁发者，其他错误返回空字符串
+func unverifiedIssuer(err error) string {
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) && len(certErr.UnverifiedCertificates) > 0 {
+		return certErr.UnverifiedCertificates[0].Issuer.String()
+	}
+	return ""
+}
+
+// classifyNetworkDiagnostics 根据检测结果给出结论与处理建议
+func classifyNetworkDiagnostics(report *NetworkDiagnosticsReport) {
+	beaconOK, proxyAuth := 0, false
+	portalLocation := ""
+	for _, beacon := range report.Beacons {
+		switch {
+		case beacon.OK:
+			beaconOK++
+		case beacon.StatusCode == http.StatusProxyAuthRequired:
+			proxyAuth = true
+		case beacon.StatusCode != 0:
+			// 有响应但内容不符：被门户劫持
+			if portalLocation == "" {
+				portalLocation = beacon.Location
+				if portalLocation == "" {
+					portalLocation = beacon.URL
+				}
+			}
+		}
+	}
+	endpoint := report.Endpoint
+	if endpoint != nil && endpoint.StatusCode == http.StatusProxyAuthRequired {
+		proxyAuth = true
+	}
+	if endpoint != nil && strings.Contains(endpoint.Error, "Proxy Authentication Required") {
+		proxyAuth = true
+	}
+
+	switch {
+	case proxyAuth:
+		report.Verdict = NetworkVerdictProxyAuthRequired
+		report.Summary = "代理服务器要求身份认证"
+		report.Guidance = append(report.Guidance,
+			"在 HTTPS_PROXY / HTTP_PROXY 中填写带账号的代理地址，例如 http://用户名:密码@proxy:8080",
+			"如使用企业代理，请联系 IT 获取认证方式或将 AI 服务域名加入白名单",
+		)
+	case beaconOK == 0 && portalLocation != "":
+		report.Verdict = NetworkVerdictCaptivePortal
+		report.Summary = "当前网络需要先登录（强制门户）"
+		report.Guidance = append(report.Guidance,
+			"请在浏览器中打开任意网页完成 Wi-Fi 登录: "+portalLocation,
+			"登录完成后重新运行诊断",
+		)
+	case beaconOK == 0 && endpoint != nil && !endpoint.DNSOK:
+		report.Verdict = NetworkVerdictDNSFailure
+		report.Summary = "DNS 解析失败，无法访问网络"
+		report.Guidance = append(report.Guidance,
+			"检查网络连接或尝试更换 DNS（如 223.5.5.5 / 1.1.1.1）",
+		)
+	case beaconOK == 0 && (endpoint == nil || endpoint.StatusCode == 0):
+		report.Verdict = NetworkVerdictOffline
+		report.Summary = "网络不可用"
+		report.Guidance = append(report.Guidance,
+			"检查网线 / Wi-Fi 是否已连接",
+			"如需代理才能上网，请确认代理软件已启动",
+		)
+	case endpoint == nil:
+		report.Verdict = NetworkVerdictOK
+		report.Summary = "网络正常"
+	case !endpoint.DNSOK:
+		report.Verdict = NetworkVerdictDNSFailure
+		report.Summary = fmt.Sprintf("无法解析 %s，但其他网络正常", endpoint.Host)
+		report.Guidance = append(report.Guidance,
+			"检查端点地址是否拼写正确",
+			"该域名可能被当前 DNS 屏蔽，可尝试更换 DNS 或使用代理",
+		)
+	case endpoint.TCPOK && !endpoint.TLSOK && endpoint.TLSIssuer != "":
+		report.Verdict = NetworkVerdictTLSIntercepted
+		report.Summary = fmt.Sprintf("%s 的 HTTPS 证书不受信任（颁发者: %s）", endpoint.Host, endpoint.TLSIssuer)
+		report.Guidance = append(report.Guidance,
+			"企业代理或安全软件可能在拦截 HTTPS 流量，请将其根证书加入系统信任或将该域名加入例外",
+		)
+	case endpoint.StatusCode == 0:
+		report.Verdict = NetworkVerdictEndpointDown
+		report.Summary = fmt.Sprintf("网络正常，但无法连接 %s", endpoint.Host)
+		report.Guidance = append(report.Guidance,
+			"端点服务可能已宕机或被防火墙拦截，可稍后重试或切换到其他 provider",
+		)
+		if report.ProxyURL == "" {
+			report.Guidance = append(report.Guidance, "若该服务需要代理访问，请设置 HTTPS_PROXY 环境变量")
+		}
+	case endpoint.StatusCode >= 500:
+		report.Verdict = NetworkVerdictEndpointDown
+		report.Summary = fmt.Sprintf("%s 返回 %d，服务端异常", endpoint.Host, endpoint.StatusCode)
+		report.Guidance = append(report.Guidance, "服务端故障，建议切换到其他 provider 或稍后重试")
+	default:
+		report.Verdict = NetworkVerdictOK
+		report.Summary = fmt.Sprintf("网络正常，%s 可以访问", endpoint.Host)
+	}
+
+	if beaconOK > 0 && beaconOK < len(report.Beacons) && report.Verdict == NetworkVerdictOK {
+		report.Guidance = append(report.Guidance, "部分检测地址不可达，可能是地区网络限制，一般不影响使用")
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// closedLocalURL 返回本机一个没有监听的端口地址
+func closedLocalURL(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return "http://" + addr
+}
+
+func TestRunNetworkDiagnostics(t *testing.T) {
+	writeTestRelayConfig(t, DefaultRelayConfig())
+	handlers := map[string]http.HandlerFunc{
+		"beacon_ok": func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+		"beacon_portal": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://portal.example.com/login", http.StatusFound)
+		},
+		"beacon_proxy": func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusProxyAuthRequired) },
+		"endpoint_ok":  func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+		"endpoint_502": func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) },
+	}
+	urls := map[string]string{"closed": closedLocalURL(t), "dns": "http://code-switch-diagnostics.invalid"}
+	for name, handler := range handlers {
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+		urls[name] = srv.URL
+	}
+	tlsServer := httptest.NewTLSServer(handlers["endpoint_ok"])
+	defer tlsServer.Close()
+	urls["endpoint_tls"] = tlsServer.URL
+
+	tests := []struct {
+		name        string
+		beacon      string
+		endpoint    string
+		wantVerdict string
+		wantSummary string
+		check       func(t *testing.T, endpoint *EndpointCheckResult)
+	}{
+		{name: "只检测基础网络", beacon: "beacon_ok", wantVerdict: NetworkVerdictOK, wantSummary: "网络正常"},
+		{name: "端点正常", beacon: "beacon_ok", endpoint: "endpoint_ok", wantVerdict: NetworkVerdictOK, wantSummary: "可以访问",
+			check: func(t *testing.T, endpoint *EndpointCheckResult) {
+				if !endpoint.DNSOK || !endpoint.TCPOK || !endpoint.TLSOK || endpoint.StatusCode != http.StatusOK {
+					t.Errorf("各步骤应全部成功: %+v", endpoint)
+				}
+			}},
+		{name: "端点服务端异常", beacon: "beacon_ok", endpoint: "endpoint_502", wantVerdict: NetworkVerdictEndpointDown, wantSummary: "返回 502"},
+		{name: "端点连接失败", beacon: "beacon_ok", endpoint: "closed", wantVerdict: NetworkVerdictEndpointDown, wantSummary: "无法连接",
+			check: func(t *testing.T, endpoint *EndpointCheckResult) {
+				if !endpoint.DNSOK || endpoint.TCPOK || !strings.Contains(endpoint.Error, "TCP 连接失败") {
+					t.Errorf("应在 TCP 连接步骤失败: %+v", endpoint)
+				}
+			}},
+		{name: "端点 DNS 解析失败", beacon: "beacon_ok", endpoint: "dns", wantVerdict: NetworkVerdictDNSFailure, wantSummary: "无法解析",
+			check: func(t *testing.T, endpoint *EndpointCheckResult) {
+				if endpoint.DNSOK || endpoint.TCPOK || !strings.Contains(endpoint.Error, "DNS 解析失败") {
+					t.Errorf("应在 DNS 解析步骤失败: %+v", endpoint)
+				}
+			}},
+		{name: "HTTPS 证书不受信任", beacon: "beacon_ok", endpoint: "endpoint_tls", wantVerdict: NetworkVerdictTLSIntercepted, wantSummary: "Acme Co",
+			check: func(t *testing.T, endpoint *EndpointCheckResult) {
+				if !endpoint.TCPOK || endpoint.TLSOK || endpoint.StatusCode != 0 {
+					t.Errorf("应在 TLS 握手步骤失败: %+v", endpoint)
+				}
+			}},
+		{name: "完全离线", beacon: "closed", wantVerdict: NetworkVerdictOffline, wantSummary: "网络不可用"},
+		{name: "离线且端点 DNS 解析失败", beacon: "closed", endpoint: "dns", wantVerdict: NetworkVerdictDNSFailure, wantSummary: "无法访问网络"},
+		{name: "强制门户", beacon: "beacon_portal", wantVerdict: NetworkVerdictCaptivePortal, wantSummary: "需要先登录"},
+		{name: "代理需要认证", beacon: "beacon_proxy", endpoint: "endpoint_ok", wantVerdict: NetworkVerdictProxyAuthRequired, wantSummary: "身份认证"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := networkBeacons
+			defer func() { networkBeacons = original }()
+			networkBeacons = []networkBeacon{
+				{"a", urls[tt.beacon] + "/generate_204", http.StatusNoContent, ""},
+				{"b", urls[tt.beacon] + "/hotspot", http.StatusNoContent, ""},
+			}
+
+			report, err := NewNetworkMonitorService(nil).RunNetworkDiagnostics(urls[tt.endpoint])
+			if err != nil {
+				t.Fatalf("RunNetworkDiagnostics() 失败: %v", err)
+			}
+			if report.Verdict != tt.wantVerdict || !strings.Contains(report.Summary, tt.wantSummary) {
+				t.Fatalf("结论 = %s (%s)，期望 %s (%s)", report.Verdict, report.Summary, tt.wantVerdict, tt.wantSummary)
+			}
+			if len(report.Beacons) != 2 || report.CheckedAt == 0 {
+				t.Errorf("报告应包含全部检测地址与检测时间: %+v", report)
+			}
+			if (report.Endpoint != nil) != (tt.endpoint != "") {
+				t.Errorf("端点检测结果 = %+v，是否指定端点 = %v", report.Endpoint, tt.endpoint != "")
+			}
+			if report.Verdict != NetworkVerdictOK && len(report.Guidance) == 0 {
+				t.Error("异常结论应附带处理建议")
+			}
+			if tt.wantVerdict == NetworkVerdictCaptivePortal && !strings.Contains(strings.Join(report.Guidance, "\n"), "http://portal.example.com/login") {
+				t.Errorf("应提示门户登录地址: %v", report.Guidance)
+			}
+			if tt.check != nil {
+				tt.check(t, report.Endpoint)
+			}
+		})
+	}
+}
+
+func TestRunNetworkDiagnosticsRejectsInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"://bad", "not-a-url", "http://"} {
+		if _, err := NewNetworkMonitorService(nil).RunNetworkDiagnostics(endpoint); err == nil {
+			t.Errorf("RunNetworkDiagnostics(%q) 应返回错误", endpoint)
+		}
+	}
+}
+
+func TestClassifyPartialBeaconFailure(t *testing.T) {
+	report := &NetworkDiagnosticsReport{
+		Guidance: []string{},
+		Beacons:  []BeaconResult{{Name: "a", OK: true}, {Name: "b", Error: "timeout"}},
+	}
+	classifyNetworkDiagnostics(report)
+	if report.Verdict != NetworkVerdictOK || len(report.Guidance) != 1 {
+		t.Errorf("部分检测地址不可达时仍判定为正常并附带提示: %+v", report)
+	}
+}
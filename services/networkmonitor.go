@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// networkProbeTimeout 单个探测目标的超时时间
+	networkProbeTimeout = 3 * time.Second
+	// networkOfflineThreshold 连续失败多少轮才判定为离线，避免瞬时抖动
+	networkOfflineThreshold = 2
+)
+
+// defaultNetworkProbeTargets 默认探测目标（任一可连通即视为在线，兼顾国内外网络环境）
+var defaultNetworkProbeTargets = []string{
+	"www.baidu.com:443",
+	"www.cloudflare.com:443",
+	"www.microsoft.com:443",
+	"1.1.1.1:443",
+	"223.5.5.5:53",
+}
+
+// NetworkStatus 网络状态
+type NetworkStatus struct {
+	Enabled      bool   `json:"enabled"`      // 是否启用离线检测
+	Online       bool   `json:"online"`       // 当前是否在线
+	LastCheckAt  int64  `json:"lastCheckAt"`  // 最近一次探测时间（毫秒）
+	LastChangeAt int64  `json:"lastChangeAt"` // 最近一次状态变化时间（毫秒）
+	LastError    string `json:"lastError"`    // 最近一次探测失败原因
+}
+
+// NetworkMonitorService 网络连通性监测：离线时中继直接返回错误或只使用本地 provider
+type NetworkMonitorService struct {
+	notificationService *NotificationService
+	mu                  sync.RWMutex
+	status              NetworkStatus
+	failures            int
+	stopChan            chan struct{}
+	running             bool
+}
+
+func NewNetworkMonitorService(notificationService *NotificationService) *NetworkMonitorService {
+	return &NetworkMonitorService{
+		notificationService: notificationService,
+		status:              NetworkStatus{Online: true},
+	}
+}
+
+// Start 启动后台探测（间隔由中继配置决定）
+func (nm *NetworkMonitorService) Start() error {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if nm.running {
+		return nil
+	}
+	nm.stopChan = make(chan struct{})
+	nm.running = true
+
+	go func() {
+		nm.CheckNow()
+		for {
+			interval := time.Duration(currentRelayConfig().Offline.ProbeIntervalSec) * time.Second
+			if interval <= 0 {
+				interval = 30 * time.Second
+			}
+			select {
+			case <-time.After(interval):
+				nm.CheckNow()
+			case <-nm.stopChan:
+				log.Println("[NetworkMonitor] 网络监测已停止")
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop 停止后台探测
+func (nm *NetworkMonitorService) Stop() error {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if nm.running {
+		close(nm.stopChan)
+		nm.running = false
+	}
+	return nil
+}
+
+// IsOnline 当前是否在线（未启用离线检测时始终返回 true）
+func (nm *NetworkMonitorService) IsOnline() bool {
+	if nm == nil {
+		return true
+	}
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	return !nm.status.Enabled || nm.status.Online
+}
+
+// GetNetworkStatus 获取网络状态（供前端调用）
+func (nm *NetworkMonitorService) GetNetworkStatus() NetworkStatus {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	return nm.status
+}
+
+// CheckNow 立即探测一次网络并更新状态
+func (nm *NetworkMonitorService) CheckNow() NetworkStatus {
+	config := currentRelayConfig().Offline
+	if !config.Enabled {
+		nm.mu.Lock()
+		nm.status.Enabled = false
+		nm.status.Online = true
+		nm.failures = 0
+		status := nm.status
+		nm.mu.Unlock()
+		return status
+	}
+
+	targets := config.ProbeTargets
+	if len(targets) == 0 {
+		targets = defaultNetworkProbeTargets
+	}
+	reachable, probeErr := networkProbe(targets)
+
+	nm.mu.Lock()
+	now := time.Now().UnixMilli()
+	wasOnline := nm.status.Online
+	nm.status.Enabled = true
+	nm.status.LastCheckAt = now
+	if reachable {
+		nm.failures = 0
+		nm.status.Online = true
+		nm.status.LastError = ""
+	} else {
+		nm.failures++
+		nm.status.LastError = probeErr
+		if nm.failures >= networkOfflineThreshold {
+			nm.status.Online = false
+		}
+	}
+	changed := wasOnline != nm.status.Online
+	if changed {
+		nm.status.LastChangeAt = now
+	}
+	status := nm.status
+	nm.mu.Unlock()
+
+	if changed {
+		if status.Online {
+			log.Println("[NetworkMonitor] ✅ 网络已恢复，退出离线模式")
+		} else {
+			log.Printf("[NetworkMonitor] ⚠️  网络不可用，进入离线模式: %s", probeErr)
+		}
+		if nm.notificationService != nil {
+			nm.notificationService.NotifyNetworkChanged(status.Online)
+		}
+	}
+	return status
+}
+
+// networkProbe 探测网络连通性，测试中可替换
+var networkProbe = probeAnyTarget
+
+// probeAnyTarget 并发探测，任一目标 TCP 可连通即返回 true
+func probeAnyTarget(targets []string) (bool, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), networkProbeTimeout)
+	defer cancel()
+
+	results := make(chan error, len(targets))
+	dialer := &net.Dialer{}
+	for _, target := range targets {
+		go func(addr string) {
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				conn.Close()
+			}
+			results <- err
+		}(target)
+	}
+
+	lastErr := ""
+	for range targets {
+		if err := <-results; err == nil {
+			return true, ""
+		} else {
+			lastErr = err.Error()
+		}
+	}
+	return false, lastErr
+}
+
+// isLocalEndpoint 判断地址是否指向本机或局域网（离线时仍可使用）
+func isLocalEndpoint(rawURL string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return false
+	}
+	host := parsed.Hostname()
+	if host == "" {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".local") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast())
+}
+
+// SetNetworkMonitor 注入网络监测服务（离线模式）
+func (prs *ProviderRelayService) SetNetworkMonitor(monitor *NetworkMonitorService) {
+	prs.networkMonitor = monitor
+}
+
+// isOffline 当前是否处于离线模式
+func (prs *ProviderRelayService) isOffline() bool {
+	return !prs.networkMonitor.IsOnline()
+}
+
+// respondOffline 离线且没有本地 provider 时立即返回结构化错误，避免请求耗尽超时
+func respondOffline(c *gin.Context, platform string) {
+	fmt.Printf("[WARN] 📴 离线模式：%s 没有可用的本地 provider，直接拒绝请求\n", platform)
+	respondRelayError(c, platform, http.StatusServiceUnavailable,
+		"网络不可用（Code Switch 离线模式），且未配置本地 provider。请检查网络连接后重试。", nil)
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeNetworkProbe 替换网络探测，按顺序返回预设结果
+func fakeNetworkProbe(t *testing.T, results ...bool) *[]string {
+	t.Helper()
+	original := networkProbe
+	t.Cleanup(func() { networkProbe = original })
+	var probed []string
+	networkProbe = func(targets []string) (bool, string) {
+		probed = targets
+		if len(results) == 0 {
+			t.Fatal("探测次数超出预期")
+		}
+		reachable := results[0]
+		results = results[1:]
+		if reachable {
+			return true, ""
+		}
+		return false, "dial tcp: connection refused"
+	}
+	return &probed
+}
+
+func TestNetworkMonitorOfflineTransitions(t *testing.T) {
+	config := DefaultRelayConfig()
+	config.Offline.Enabled = true
+	config.Offline.ProbeTargets = []string{"probe.example.com:443"}
+	writeTestRelayConfig(t, config)
+
+	steps := []struct {
+		reachable   bool
+		wantOnline  bool
+		wantChanged bool
+	}{
+		{reachable: true, wantOnline: true},
+		{reachable: false, wantOnline: true}, // 单次失败视为抖动
+		{reachable: false, wantOnline: false, wantChanged: true},
+		{reachable: false, wantOnline: false},
+		{reachable: true, wantOnline: true, wantChanged: true},
+		{reachable: false, wantOnline: true},
+	}
+	results := make([]bool, len(steps))
+	for i, step := range steps {
+		results[i] = step.reachable
+	}
+	probed := fakeNetworkProbe(t, append(results, false, false)...)
+
+	nm := NewNetworkMonitorService(nil)
+	for i, step := range steps {
+		// 清除上次的变化时间，只有状态变化时才会重新写入
+		nm.status.LastChangeAt = 0
+		status := nm.CheckNow()
+		if !status.Enabled || status.Online != step.wantOnline || nm.IsOnline() != step.wantOnline {
+			t.Fatalf("第 %d 次探测后 Online = %v，期望 %v", i+1, status.Online, step.wantOnline)
+		}
+		if changed := status.LastChangeAt != 0; changed != step.wantChanged {
+			t.Errorf("第 %d 次探测后状态变化 = %v，期望 %v", i+1, changed, step.wantChanged)
+		}
+		if (status.LastError == "") != step.reachable {
+			t.Errorf("第 %d 次探测后 LastError = %q", i+1, status.LastError)
+		}
+	}
+	if len(*probed) != 1 || (*probed)[0] != "probe.example.com:443" {
+		t.Errorf("应探测配置的目标，得到 %v", *probed)
+	}
+
+	// 关闭离线检测后立即恢复在线，且不再探测
+	nm.CheckNow()
+	nm.CheckNow()
+	if nm.IsOnline() {
+		t.Fatal("连续失败两次后应处于离线状态")
+	}
+	config.Offline.Enabled = false
+	writeTestRelayConfig(t, config)
+	if status := nm.CheckNow(); status.Enabled || !status.Online || !nm.IsOnline() {
+		t.Errorf("关闭离线检测后应视为在线: %+v", status)
+	}
+}
+
+func TestNetworkMonitorDefaultTargets(t *testing.T) {
+	config := DefaultRelayConfig()
+	config.Offline.Enabled = true
+	config.Offline.ProbeTargets = nil
+	writeTestRelayConfig(t, config)
+	probed := fakeNetworkProbe(t, true)
+
+	NewNetworkMonitorService(nil).CheckNow()
+	if len(*probed) != len(defaultNetworkProbeTargets) {
+		t.Errorf("未配置探测目标时应使用默认目标，得到 %v", *probed)
+	}
+	if !(*NetworkMonitorService)(nil).IsOnline() {
+		t.Error("未注入网络监测时应视为在线")
+	}
+}
+
+func TestOfflineRelayRequests(t *testing.T) {
+	var localHits atomic.Int32
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		localHits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","type":"message","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer local.Close()
+	remote := Provider{ID: 1, Name: "remote", APIURL: "https://api.example.com", APIKey: "sk-remote", Enabled: true}
+	localProvider := Provider{ID: 2, Name: "local", APIURL: local.URL, APIKey: "sk-local", Enabled: true}
+
+	tests := []struct {
+		name          string
+		providers     []Provider
+		wantStatus    int
+		wantLocalHits int32
+	}{
+		{name: "离线且只有远程 provider 时立即拒绝", providers: []Provider{remote}, wantStatus: http.StatusServiceUnavailable},
+		{name: "离线时只转发到本地 provider", providers: []Provider{remote, localProvider}, wantStatus: http.StatusOK, wantLocalHits: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localHits.Store(0)
+			config := DefaultRelayConfig()
+			config.Offline.Enabled = true
+			writeTestRelayConfig(t, config)
+			newTestDatabase(t)
+			providerService := NewProviderService()
+			if err := providerService.SaveProviders("claude", tt.providers); err != nil {
+				t.Fatal(err)
+			}
+
+			fakeNetworkProbe(t, false, false)
+			monitor := NewNetworkMonitorService(nil)
+			monitor.CheckNow()
+			monitor.CheckNow()
+			prs := NewProviderRelayService(providerService, nil, NewBlacklistService(NewSettingsService(), nil), nil, "")
+			prs.SetNetworkMonitor(monitor)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			prs.registerRoutes(router)
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`))
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus || localHits.Load() != tt.wantLocalHits {
+				t.Errorf("状态码 = %d，本地请求 %d 次，期望 %d / %d: %s", recorder.Code, localHits.Load(), tt.wantStatus, tt.wantLocalHits, recorder.Body.String())
+			}
+			if tt.wantStatus == http.StatusServiceUnavailable && !strings.Contains(recorder.Body.String(), "离线模式") {
+				t.Errorf("应返回离线模式的错误说明: %s", recorder.Body.String())
+			}
+		})
+	}
+}
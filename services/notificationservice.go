@@ -55,14 +55,7 @@ func (ns *NotificationService) SetApp(app *application.App) {
 // ensureIconFile 确保图标文件存在于临时目录，并返回路径
 // @author sm
 func (ns *NotificationService) ensureIconFile() string {
-	// 获取用户配置目录
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Printf("[Notification] 获取用户目录失败: %v", err)
-		return ""
-	}
-
-	iconDir := filepath.Join(homeDir, ".code-switch", "icons")
+	iconDir := filepath.Join(getConfigDir(), "icons")
 	if err := os.MkdirAll(iconDir, 0755); err != nil {
 		log.Printf("[Notification] 创建图标目录失败: %v", err)
 		return ""
@@ -197,3 +190,372 @@ func (ns *NotificationService) emitBlacklistEvent(platform, providerName string,
 		"timestamp":       time.Now().UnixMilli(),
 	})
 }
+
+// NotifyLocalConnectivityIssue 发送本地连接故障通知（平台所有 provider 同时失败）
+func (ns *NotificationService) NotifyLocalConnectivityIssue(platform string, providers []string) {
+	if ns.app != nil {
+		ns.app.Event.Emit("platform:incident", map[string]interface{}{
+			"platform":  platform,
+			"providers": providers,
+			"timestamp": time.Now().UnixMilli(),
+		})
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		body := fmt.Sprintf("%s 所有供应商同时失败，可能是本地网络问题，已暂停拉黑", platform)
+		if err := beeep.Notify("Code Switch", body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送本地连接故障通知失败: %v", err)
+		}
+	}()
+}
+
+// NotifyLocalConnectivityRecovered 本地连接故障恢复（只发送前端事件）
+func (ns *NotificationService) NotifyLocalConnectivityRecovered(platform string) {
+	if ns.app == nil {
+		return
+	}
+	ns.app.Event.Emit("platform:incident_resolved", map[string]interface{}{
+		"platform":  platform,
+		"timestamp": time.Now().UnixMilli(),
+	})
+}
+
+// NotifyUpstreamIncident 发送上游官方状态页故障通知
+func (ns *NotificationService) NotifyUpstreamIncident(platform string, incident UpstreamIncident) {
+	if ns.app != nil {
+		ns.app.Event.Emit("upstream:incident", map[string]interface{}{
+			"platform":  platform,
+			"incident":  incident,
+			"timestamp": time.Now().UnixMilli(),
+		})
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		body := fmt.Sprintf("%s 官方状态页报告故障: %s", platform, incident.Name)
+		if err := beeep.Notify("Code Switch", body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送上游故障通知失败: %v", err)
+		}
+	}()
+}
+
+// NotifyModelDowngraded 发送预算降级通知（前端事件每次都发送，系统通知受最小间隔节流）
+func (ns *NotificationService) NotifyModelDowngraded(platform, fromModel, toModel string, spentUSD, limitUSD float64) {
+	ns.emitDowngradeEvent(platform, fromModel, toModel, spentUSD, limitUSD)
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	ns.mu.Lock()
+	if time.Since(ns.lastNotifyTime) < ns.minInterval {
+		ns.mu.Unlock()
+		return
+	}
+	ns.lastNotifyTime = time.Now()
+	ns.mu.Unlock()
+
+	go func() {
+		title := "Code Switch"
+		body := fmt.Sprintf("预算已用 $%.2f / $%.2f，%s 已降级为 %s", spentUSD, limitUSD, fromModel, toModel)
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送降级通知失败: %v", err)
+		} else {
+			log.Printf("[Notification] 已发送降级通知: %s → %s", fromModel, toModel)
+		}
+	}()
+}
+
+// emitDowngradeEvent 发送模型降级事件到前端
+func (ns *NotificationService) emitDowngradeEvent(platform, fromModel, toModel string, spentUSD, limitUSD float64) {
+	if ns.app == nil {
+		return
+	}
+	ns.app.Event.Emit("model:downgraded", map[string]interface{}{
+		"platform":  platform,
+		"fromModel": fromModel,
+		"toModel":   toModel,
+		"spentUsd":  spentUSD,
+		"limitUsd":  limitUSD,
+		"timestamp": time.Now().UnixMilli(),
+	})
+}
+
+// NotifyNetworkChanged 发送网络状态变化通知（进入/退出离线模式）
+func (ns *NotificationService) NotifyNetworkChanged(online bool) {
+	if ns.app != nil {
+		ns.app.Event.Emit("network:changed", map[string]interface{}{
+			"online":    online,
+			"timestamp": time.Now().UnixMilli(),
+		})
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		body := "网络不可用，已进入离线模式"
+		if online {
+			body = "网络已恢复"
+		}
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送网络状态通知失败: %v", err)
+		}
+	}()
+}
+
+// NotifySystemResumed 通知前端系统已从睡眠中唤醒（只发送事件，不弹系统通知）
+func (ns *NotificationService) NotifySystemResumed(slept time.Duration) {
+	if ns.app != nil {
+		ns.app.Event.Emit("system:resumed", map[string]interface{}{
+			"sleptSec":  int64(slept / time.Second),
+			"timestamp": time.Now().UnixMilli(),
+		})
+	}
+}
+
+// NotifyServiceReady 通知前端某个服务已启动完成或启动失败（只发送事件）
+func (ns *NotificationService) NotifyServiceReady(status ServiceReadiness) {
+	if ns.app != nil {
+		ns.app.Event.Emit("service:ready", status)
+	}
+}
+
+// NotifyAppReady 通知前端全部服务已启动（只发送事件）
+func (ns *NotificationService) NotifyAppReady(report ReadinessReport) {
+	if ns.app != nil {
+		ns.app.Event.Emit("app:ready", report)
+	}
+}
+
+// NotifyCrashReports 提示上次运行期间产生的崩溃报告
+func (ns *NotificationService) NotifyCrashReports(count int) {
+	if ns.app != nil {
+		ns.app.Event.Emit("crash:pending", map[string]interface{}{
+			"count":     count,
+			"timestamp": time.Now().UnixMilli(),
+		})
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		body := fmt.Sprintf("上次运行期间发生 %d 次崩溃，已生成本地崩溃报告，可在设置中查看", count)
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送崩溃报告通知失败: %v", err)
+		}
+	}()
+}
+
+// EmitTokenSpeed 发送进行中的流式响应的生成速度（只发送事件）
+func (ns *NotificationService) EmitTokenSpeed(samples []TokenSpeedSample) {
+	if ns.app != nil {
+		ns.app.Event.Emit("relay:token_speed", samples)
+	}
+}
+
+// NotifyLatencyDegraded 发送端点延迟劣化通知，class 为 24 小时中位数的延迟分级
+func (ns *NotificationService) NotifyLatencyDegraded(url string, medianMs, baselineMs float64, class string) {
+	if ns.app != nil {
+		ns.app.Event.Emit("endpoint:latency_degraded", map[string]interface{}{
+			"url":         url,
+			"median24hMs": medianMs,
+			"baselineMs":  baselineMs,
+			"class":       class,
+			"timestamp":   time.Now().UnixMilli(),
+		})
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		body := fmt.Sprintf("%s 延迟变慢（%s）：近 24 小时 %.0fms，平时 %.0fms", url, latencyClassLabel(class), medianMs, baselineMs)
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送延迟告警通知失败: %v", err)
+		}
+	}()
+}
+
+// NotifySLOBreach 发送 provider 持续违反 SLO 的通知
+func (ns *NotificationService) NotifySLOBreach(status SLOStatus) {
+	if ns.app != nil {
+		ns.app.Event.Emit("slo:breach", map[string]interface{}{
+			"objective":     status.Objective.Name,
+			"platform":      status.Objective.Platform,
+			"provider":      status.Provider,
+			"observedMs":    status.Short.ObservedMs,
+			"thresholdMs":   status.Objective.ThresholdMs,
+			"burnRateShort": status.Short.BurnRate,
+			"burnRateLong":  status.Long.BurnRate,
+			"timestamp":     time.Now().UnixMilli(),
+		})
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		body := fmt.Sprintf("%s 持续违反 SLO「%s」：p%g %.0fms，目标 %dms", status.Provider, status.Objective.Name,
+			status.Objective.Percentile, status.Short.ObservedMs, status.Objective.ThresholdMs)
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送 SLO 告警通知失败: %v", err)
+		}
+	}()
+}
+
+// NotifyReportReady 发送摘要报告已生成的通知
+func (ns *NotificationService) NotifyReportReady(report *SummaryReport, path string) {
+	if ns.app != nil {
+		ns.app.Event.Emit("report:ready", map[string]interface{}{
+			"period":    report.Period,
+			"from":      report.From,
+			"to":        report.To,
+			"totalCost": report.TotalCost,
+			"path":      path,
+			"timestamp": time.Now().UnixMilli(),
+		})
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		body := fmt.Sprintf("%s已生成：花费 $%.2f，%d 次请求，%d 个事件", report.title(), report.TotalCost, report.TotalRequests, len(report.Incidents))
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送报告通知失败: %v", err)
+		}
+	}()
+}
+
+// NotifyKeyHealth 发送密钥失效或余额不足通知
+func (ns *NotificationService) NotifyKeyHealth(health ProviderKeyHealth) {
+	if ns.app != nil {
+		ns.app.Event.Emit("provider:key_health", health)
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		body := fmt.Sprintf("%s 的 API Key 已失效或被吊销", health.Provider)
+		if health.Status == KeyStatusLowBalance && health.Remaining != nil {
+			body = fmt.Sprintf("%s 余额不足：剩余 %.2f %s", health.Provider, *health.Remaining, health.Currency)
+		}
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送密钥告警通知失败: %v", err)
+		}
+	}()
+}
+
+// NotifyProviderAuthDisabled 发送 provider 因密钥失效被停用的通知
+func (ns *NotificationService) NotifyProviderAuthDisabled(platform, providerName string) {
+	if ns.app != nil {
+		ns.app.Event.Emit("provider:auth_disabled", map[string]interface{}{
+			"platform":  platform,
+			"provider":  providerName,
+			"timestamp": time.Now().UnixMilli(),
+		})
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		body := fmt.Sprintf("%s 的 API Key 无效或已吊销，已停止使用，更新 Key 后自动恢复", providerName)
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送密钥失效通知失败: %v", err)
+		}
+	}()
+}
+
+// NotifyCertPinMismatch 发送上游证书指纹不一致的告警
+func (ns *NotificationService) NotifyCertPinMismatch(platform, providerName, host, pin string) {
+	if ns.app != nil {
+		ns.app.Event.Emit("provider:cert_pin_mismatch", map[string]interface{}{
+			"platform":  platform,
+			"provider":  providerName,
+			"host":      host,
+			"pin":       pin,
+			"timestamp": time.Now().UnixMilli(),
+		})
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		body := fmt.Sprintf("%s 的证书与固定的指纹不一致（%s），已拒绝连接", providerName, host)
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送证书指纹告警失败: %v", err)
+		}
+	}()
+}
+
+// NotifyCanary 发送灰度切换完成或回滚通知
+func (ns *NotificationService) NotifyCanary(status CanaryStatus) {
+	if ns.app != nil {
+		ns.app.Event.Emit("provider:canary", status)
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		body := fmt.Sprintf("已完成灰度切换：%s → %s", status.From, status.To)
+		if status.State == CanaryStateRolledBack {
+			body = fmt.Sprintf("灰度切换已回滚（%s → %s）：%s", status.From, status.To, status.Reason)
+		}
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送灰度切换通知失败: %v", err)
+		}
+	}()
+}
+
+// NotifyConfigIntegrity 发送配置文件被外部修改或损坏的告警
+func (ns *NotificationService) NotifyConfigIntegrity(issue ConfigIntegrityIssue) {
+	if ns.app != nil {
+		ns.app.Event.Emit("config:integrity", issue)
+	}
+
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		body := fmt.Sprintf("%s：%s", issue.Name, issue.Detail)
+		if issue.CanRestore {
+			body += "，可在设置中从备份恢复"
+		}
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送配置完整性告警失败: %v", err)
+		}
+	}()
+}
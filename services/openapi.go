@@ -0,0 +1,192 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminPathParam 匹配 gin 路由中的路径参数（:name）
+var adminPathParam = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+// AdminOpenAPISpec 根据管理接口的路由表与响应类型生成 OpenAPI 3 文档
+// 构建时由 cmd/openapi 写入 build/openapi/admin-api.json，运行时通过 /admin/openapi.json 提供
+func AdminOpenAPISpec() ([]byte, error) {
+	builder := &openAPISchemaBuilder{schemas: map[string]any{}}
+	errorSchema := builder.schemaFor(reflect.TypeOf(AdminErrorResponse{}))
+	errorResponse := func(description string) map[string]any {
+		return map[string]any{
+			"description": description,
+			"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+		}
+	}
+
+	paths := map[string]any{}
+	for _, route := range (*ProviderRelayService)(nil).adminRoutes() {
+		path := "/admin" + adminPathParam.ReplaceAllString(route.path, "{$1}")
+		var parameters []any
+		for _, match := range adminPathParam.FindAllStringSubmatch(route.path, -1) {
+			parameter := map[string]any{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			}
+			if match[1] == "platform" {
+				parameter["schema"] = map[string]any{"type": "string", "enum": []string{"claude", "codex", "gemini"}}
+			}
+			parameters = append(parameters, parameter)
+		}
+
+		operation := map[string]any{
+			"operationId":      adminOperationID(route),
+			"summary":          route.summary,
+			"description":      "需要令牌权限: " + route.scope,
+			"x-required-scope": route.scope,
+			"security":         []any{map[string]any{"bearerAuth": []string{}}},
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "成功",
+					"content": map[string]any{"application/json": map[string]any{
+						"schema": builder.schemaFor(reflect.TypeOf(route.response)),
+					}},
+				},
+				"400": errorResponse("参数错误"),
+				"401": errorResponse("令牌无效"),
+				"403": errorResponse("令牌权限不足"),
+				"404": errorResponse("管理接口未启用或资源不存在"),
+			},
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		item, _ := paths[path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.method)] = operation
+	}
+
+	spec := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "CodeSwitch Admin API",
+			"version":     "1",
+			"description": "中继管理接口（默认关闭，需在 relay-config.json 的 adminApi 中启用并配置令牌）。令牌通过 Authorization: Bearer <token> 携带。",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": builder.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// adminOperationID 由方法与路径生成 operationId，如 GET /providers/:platform -> getProvidersPlatform
+func adminOperationID(route adminRoute) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(route.method))
+	for _, part := range strings.Split(route.path, "/") {
+		part = strings.TrimPrefix(part, ":")
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// adminOpenAPIHandler 提供管理接口的 OpenAPI 文档（文档不含敏感信息，无需令牌；管理接口未启用时返回 404）
+func adminOpenAPIHandler(c *gin.Context) {
+	if !currentRelayConfig().AdminAPI.Enabled {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "admin api disabled"})
+		return
+	}
+	spec, err := AdminOpenAPISpec()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/json", spec)
+}
+
+// openAPISchemaBuilder 按 Go 类型（json 标签）生成 JSON Schema，具名结构体放入 components/schemas
+type openAPISchemaBuilder struct {
+	schemas map[string]any
+}
+
+func (b *openAPISchemaBuilder) schemaFor(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schemaFor(t.Elem())
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return b.objectSchema(t)
+		}
+		if _, ok := b.schemas[name]; !ok {
+			b.schemas[name] = map[string]any{} // 占位，避免递归类型无限展开
+			b.schemas[name] = b.objectSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (b *openAPISchemaBuilder) objectSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schemaFor(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
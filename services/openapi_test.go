@@ -0,0 +1,48 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// 提交的 build/openapi/admin-api.json 需与路由定义一致（修改管理接口后执行 go run ./cmd/openapi 重新生成）
+func TestAdminOpenAPISpec_UpToDate(t *testing.T) {
+	spec, err := AdminOpenAPISpec()
+	if err != nil {
+		t.Fatalf("AdminOpenAPISpec() error = %v", err)
+	}
+	committed, err := os.ReadFile("../build/openapi/admin-api.json")
+	if err != nil {
+		t.Fatalf("读取已提交的文档失败: %v", err)
+	}
+	if !bytes.Equal(spec, committed) {
+		t.Error("build/openapi/admin-api.json 已过期，请执行 go run ./cmd/openapi 重新生成")
+	}
+}
+
+func TestAdminOpenAPISpec_CoversRoutes(t *testing.T) {
+	spec, err := AdminOpenAPISpec()
+	if err != nil {
+		t.Fatalf("AdminOpenAPISpec() error = %v", err)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Scope string `json:"x-required-scope"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatalf("文档不是合法 JSON: %v", err)
+	}
+	op, ok := doc.Paths["/admin/providers/{platform}/{name}/switch"]["post"]
+	if !ok {
+		t.Fatal("缺少切换 provider 接口")
+	}
+	if op.Scope != AdminScopeSwitch {
+		t.Errorf("切换接口权限 = %s, want %s", op.Scope, AdminScopeSwitch)
+	}
+	if got, want := len(doc.Paths), 6; got != want {
+		t.Errorf("路径数 = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 出站绑定：多网卡（VPN + 局域网）环境下，部分镜像只能经 VPN 访问。
+// provider 可指定出站源地址（IP）或网卡名，中继转发与测速都从该地址发起连接。
+// 网卡名在每次建立连接时解析，VPN 重连后地址变化也能跟上。
+// 绑定的是源地址：多数系统按源地址选择路由，VPN 分流规则与之冲突时仍以系统路由为准。
+
+const maxBindAddressLength = 64
+
+// OutboundInterface 可用于出站绑定的本机网卡
+type OutboundInterface struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+	Up        bool     `json:"up"`
+	Loopback  bool     `json:"loopback"`
+}
+
+// validateBindAddress 校验出站绑定格式（网卡可能暂未连接，不检查是否存在）
+func validateBindAddress(bind string) error {
+	if bind == "" {
+		return nil
+	}
+	if strings.TrimSpace(bind) != bind || len(bind) > maxBindAddressLength || strings.ContainsAny(bind, "/\\\r\n\t") {
+		return fmt.Errorf("无效的出站绑定: %q（应为本机 IP 或网卡名）", bind)
+	}
+	return nil
+}
+
+// resolveBindAddress 解析出站源地址：IP 直接使用，否则按网卡名取第一个可用地址（优先 IPv4）
+func resolveBindAddress(bind string) (net.IP, error) {
+	if ip := net.ParseIP(bind); ip != nil {
+		return ip, nil
+	}
+	iface, err := net.InterfaceByName(bind)
+	if err != nil {
+		return nil, fmt.Errorf("出站网卡 %s 不存在", bind)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return nil, fmt.Errorf("出站网卡 %s 未启用", bind)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("读取网卡 %s 地址失败: %w", bind, err)
+	}
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			return ip4, nil
+		}
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("出站网卡 %s 没有可用地址", bind)
+	}
+	return fallback, nil
+}
+
+// boundDialContext 从绑定地址发起连接；源地址与目标地址族需一致，按源地址限定 tcp4/tcp6
+func boundDialContext(bind string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ip, err := resolveBindAddress(bind)
+		if err != nil {
+			return nil, err
+		}
+		if network == "tcp" {
+			network = "tcp6"
+			if ip.To4() != nil {
+				network = "tcp4"
+			}
+		}
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			LocalAddr: &net.TCPAddr{IP: ip},
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// applyOutboundBinding 为客户端设置出站绑定（bind 为空时不做修改）
+func applyOutboundBinding(client *http.Client, bind string) {
+	if bind == "" {
+		return
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport == nil {
+		transport = newRelayTransport()
+		client.Transport = transport
+	}
+	transport.DialContext = boundDialContext(bind)
+}
+
+// ListOutboundInterfaces 列出本机网卡及地址，供配置出站绑定时选择（供前端调用）
+func (nm *NetworkMonitorService) ListOutboundInterfaces() ([]OutboundInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("读取网卡列表失败: %w", err)
+	}
+	result := make([]OutboundInterface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		item := OutboundInterface{
+			Name:      iface.Name,
+			Addresses: []string{},
+			Up:        iface.Flags&net.FlagUp != 0,
+			Loopback:  iface.Flags&net.FlagLoopback != 0,
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+					item.Addresses = append(item.Addresses, ipNet.IP.String())
+				}
+			}
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"net"
+	"testing"
+)
+
+func TestResolveBindAddress(t *testing.T) {
+	ip, err := resolveBindAddress("127.0.0.1")
+	if err != nil || !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("IP 应直接使用，得到 %v, %v", ip, err)
+	}
+	if _, err := resolveBindAddress("no-such-iface0"); err == nil {
+		t.Error("不存在的网卡应报错")
+	}
+
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		ip, err := resolveBindAddress(iface.Name)
+		if err != nil || !ip.IsLoopback() {
+			t.Errorf("回环网卡 %s 应解析为回环地址，得到 %v, %v", iface.Name, ip, err)
+		}
+		break
+	}
+}
+
+func TestValidateBindAddress(t *testing.T) {
+	for _, bind := range []string{"", "10.8.0.2", "utun3", "Ethernet 2", "fe80::1"} {
+		if err := validateBindAddress(bind); err != nil {
+			t.Errorf("%q 应有效: %v", bind, err)
+		}
+	}
+	for _, bind := range []string{" eth0", "10.0.0.0/8", "eth0\n"} {
+		if err := validateBindAddress(bind); err == nil {
+			t.Errorf("%q 应无效", bind)
+		}
+	}
+}
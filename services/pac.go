@@ -0,0 +1,559 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// 代理自动配置（PAC）：启用后转发请求按目标地址执行 PAC 脚本选择代理，与浏览器的代理决策一致。
+// PAC 地址可在配置中指定，留空时读取系统设置（Windows 注册表、macOS scutil、GNOME gsettings），不支持 WPAD 自动发现。
+// 脚本与每个目标主机的解析结果按 CacheMinutes 缓存；PAC 不可用时退回系统代理环境变量。
+// PAC 返回多个代理时只使用第一个受支持的条目，不做逐个故障转移。
+
+const (
+	pacMaxScriptBytes = 1 << 20
+	pacFetchTimeout   = 10 * time.Second
+	pacEvalTimeout    = time.Second
+	pacRetryInterval  = time.Minute // 加载失败后的重试间隔
+)
+
+// PAC 来源
+const (
+	PACSourceConfig = "config"
+	PACSourceSystem = "system"
+)
+
+// 代理决策来源
+const (
+	ProxyViaProvider = "provider" // provider 单独配置的上游代理
+	ProxyViaPAC      = "pac"
+	ProxyViaEnv      = "env" // 系统代理环境变量
+)
+
+// PACDiagnostics PAC 状态与各 provider 解析到的代理
+type PACDiagnostics struct {
+	Enabled  bool       `json:"enabled"`
+	URL      string     `json:"url,omitempty"`
+	Source   string     `json:"source,omitempty"` // config / system
+	LoadedAt int64      `json:"loadedAt,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Routes   []PACRoute `json:"routes"`
+}
+
+// PACRoute 单个 provider 的代理决策
+type PACRoute struct {
+	Platform  string `json:"platform"`
+	Provider  string `json:"provider"`
+	URL       string `json:"url"`
+	Proxy     string `json:"proxy"` // 代理地址（隐藏账号密码），直连为 DIRECT
+	Via       string `json:"via"`   // provider / pac / env
+	PACResult string `json:"pacResult,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// pacHelpers PAC 标准辅助函数（dnsResolve、myIpAddress 由 Go 提供）
+const pacHelpers = `
+function isPlainHostName(host) { return String(host).indexOf('.') < 0; }
+function dnsDomainIs(host, domain) {
+  host = String(host).toLowerCase(); domain = String(domain).toLowerCase();
+  return host.length >= domain.length && host.substring(host.length - domain.length) === domain;
+}
+function localHostOrDomainIs(host, hostdom) { return host === hostdom || String(hostdom).lastIndexOf(host + '.', 0) === 0; }
+function isResolvable(host) { return dnsResolve(host) !== null; }
+function dnsDomainLevels(host) { return String(host).split('.').length - 1; }
+function convert_addr(ip) {
+  var b = String(ip).split('.');
+  return ((b[0] & 0xff) << 24 | (b[1] & 0xff) << 16 | (b[2] & 0xff) << 8 | (b[3] & 0xff)) >>> 0;
+}
+function isInNet(host, pattern, mask) {
+  var ip = /^\d+\.\d+\.\d+\.\d+$/.test(host) ? host : dnsResolve(host);
+  if (ip === null) return false;
+  var m = convert_addr(mask);
+  return ((convert_addr(ip) & m) >>> 0) === ((convert_addr(pattern) & m) >>> 0);
+}
+function shExpMatch(str, pattern) {
+  var re = String(pattern).replace(/[.+^${}()|[\]\\]/g, '\\$&').replace(/\*/g, '.*').replace(/\?/g, '.');
+  return new RegExp('^' + re + '$').test(str);
+}
+var __pacDays = ['SUN', 'MON', 'TUE', 'WED', 'THU', 'FRI', 'SAT'];
+var __pacMonths = ['JAN', 'FEB', 'MAR', 'APR', 'MAY', 'JUN', 'JUL', 'AUG', 'SEP', 'OCT', 'NOV', 'DEC'];
+function __pacNow(args) {
+  var list = Array.prototype.slice.call(args), gmt = list.length > 0 && list[list.length - 1] === 'GMT';
+  if (gmt) list.pop();
+  var d = new Date();
+  return {
+    args: list,
+    day: gmt ? d.getUTCDay() : d.getDay(), date: gmt ? d.getUTCDate() : d.getDate(),
+    month: gmt ? d.getUTCMonth() : d.getMonth(), year: gmt ? d.getUTCFullYear() : d.getFullYear(),
+    seconds: (gmt ? d.getUTCHours() : d.getHours()) * 3600 + (gmt ? d.getUTCMinutes() : d.getMinutes()) * 60 + (gmt ? d.getUTCSeconds() : d.getSeconds())
+  };
+}
+function __pacInRange(now, from, to) { return from <= to ? (now >= from && now <= to) : (now >= from || now <= to); }
+function weekdayRange() {
+  var n = __pacNow(arguments), a = __pacDays.indexOf(n.args[0]), b = n.args.length > 1 ? __pacDays.indexOf(n.args[1]) : a;
+  return a >= 0 && b >= 0 && __pacInRange(n.day, a, b);
+}
+function timeRange() {
+  var n = __pacNow(arguments), a = n.args.map(Number);
+  switch (a.length) {
+  case 1: return Math.floor(n.seconds / 3600) === a[0];
+  case 2: return __pacInRange(n.seconds, a[0] * 3600, a[1] * 3600 - 1);
+  case 4: return __pacInRange(n.seconds, a[0] * 3600 + a[1] * 60, a[2] * 3600 + a[3] * 60 - 1);
+  case 6: return __pacInRange(n.seconds, a[0] * 3600 + a[1] * 60 + a[2], a[3] * 3600 + a[4] * 60 + a[5]);
+  }
+  return false;
+}
+function dateRange() {
+  var n = __pacNow(arguments), args = n.args;
+  function parse(list) {
+    var p = {};
+    for (var i = 0; i < list.length; i++) {
+      var m = __pacMonths.indexOf(String(list[i]).toUpperCase());
+      if (m >= 0) p.month = m; else if (Number(list[i]) > 31) p.year = Number(list[i]); else p.date = Number(list[i]);
+    }
+    return p;
+  }
+  function key(p, shape) {
+    return ('year' in shape ? p.year * 10000 : 0) + ('month' in shape ? p.month * 100 : 0) + ('date' in shape ? p.date : 0);
+  }
+  if (args.length === 1) { var one = parse(args); return key(n, one) === key(one, one); }
+  if (args.length % 2 !== 0 || args.length > 6) return false;
+  var from = parse(args.slice(0, args.length / 2)), to = parse(args.slice(args.length / 2));
+  return __pacInRange(key(n, from), key(from, from), key(to, from));
+}
+`
+
+// pacEngine 已加载的 PAC 脚本（goja 运行时不支持并发，调用时加锁）
+type pacEngine struct {
+	mu   sync.Mutex
+	vm   *goja.Runtime
+	find goja.Callable
+}
+
+func newPACEngine(script string) (*pacEngine, error) {
+	vm := goja.New()
+	_ = vm.Set("dnsResolve", func(host string) goja.Value {
+		if ip := pacResolveHost(host); ip != "" {
+			return vm.ToValue(ip)
+		}
+		return goja.Null()
+	})
+	_ = vm.Set("myIpAddress", pacMyIPAddress)
+	if _, err := vm.RunString(pacHelpers); err != nil {
+		return nil, fmt.Errorf("初始化 PAC 辅助函数失败: %w", err)
+	}
+
+	timer := time.AfterFunc(pacEvalTimeout, func() { vm.Interrupt("timeout") })
+	_, err := vm.RunString(script)
+	timer.Stop()
+	vm.ClearInterrupt()
+	if err != nil {
+		return nil, fmt.Errorf("PAC 脚本执行失败: %w", err)
+	}
+	find, ok := goja.AssertFunction(vm.Get("FindProxyForURL"))
+	if !ok {
+		return nil, fmt.Errorf("PAC 脚本未定义 FindProxyForURL")
+	}
+	return &pacEngine{vm: vm, find: find}, nil
+}
+
+// FindProxy 执行 FindProxyForURL；与浏览器一致，只传入 scheme://host/，不暴露路径与查询参数
+func (e *pacEngine) FindProxy(target *url.URL) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	host := target.Hostname()
+	timer := time.AfterFunc(pacEvalTimeout, func() { e.vm.Interrupt("timeout") })
+	defer func() {
+		timer.Stop()
+		e.vm.ClearInterrupt()
+	}()
+	result, err := e.find(goja.Undefined(), e.vm.ToValue(target.Scheme+"://"+target.Host+"/"), e.vm.ToValue(host))
+	if err != nil {
+		return "", fmt.Errorf("FindProxyForURL 执行失败: %w", err)
+	}
+	if goja.IsUndefined(result) || goja.IsNull(result) {
+		return "", nil
+	}
+	return result.String(), nil
+}
+
+// pacResolveHost dnsResolve：返回第一个 IPv4 地址，无法解析时返回空
+func pacResolveHost(host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(ips) == 0 {
+		return ""
+	}
+	return ips[0].String()
+}
+
+// pacMyIPAddress myIpAddress：默认路由使用的本机地址（UDP 连接不发送数据）
+func pacMyIPAddress() string {
+	conn, err := net.Dial("udp4", "198.51.100.1:53")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// parsePACResult 解析 PAC 返回值，取第一个受支持的条目；DIRECT 或空结果返回 nil
+func parsePACResult(result string) (*url.URL, error) {
+	if strings.TrimSpace(result) == "" {
+		return nil, nil
+	}
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		scheme := ""
+		switch strings.ToUpper(fields[0]) {
+		case "DIRECT":
+			return nil, nil
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		default:
+			continue // SOCKS4 等不支持的类型
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		return &url.URL{Scheme: scheme, Host: fields[1]}, nil
+	}
+	return nil, fmt.Errorf("PAC 返回的代理均不受支持: %s", result)
+}
+
+// validatePACConfig 校验 PAC 配置
+func validatePACConfig(config RelayPACConfig) error {
+	if config.URL != "" {
+		parsed, err := url.Parse(config.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https" && parsed.Scheme != "file") {
+			return fmt.Errorf("无效的 PAC 地址: %s（支持 http(s):// 与 file://）", config.URL)
+		}
+	}
+	if config.CacheMinutes < 1 || config.CacheMinutes > 1440 {
+		return fmt.Errorf("PAC 缓存时间必须在 1-1440 分钟之间")
+	}
+	return nil
+}
+
+type pacCacheEntry struct {
+	proxy     *url.URL
+	result    string
+	expiresAt time.Time
+}
+
+// pacResolver 缓存 PAC 脚本与各目标主机的解析结果
+type pacResolver struct {
+	mu        sync.Mutex
+	configURL string // 加载时配置中的 PAC 地址，变化后立即重新加载
+	url       string
+	source    string
+	engine    *pacEngine
+	loadedAt  time.Time
+	nextLoad  time.Time
+	loadErr   error
+	results   map[string]pacCacheEntry
+}
+
+var relayPAC = &pacResolver{}
+
+// reset 清空缓存，下次请求时重新读取 PAC
+func (r *pacResolver) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.engine, r.loadErr, r.results = nil, nil, nil
+	r.nextLoad = time.Time{}
+}
+
+// ensureLoaded 按缓存时间重新加载 PAC 脚本（调用方持有锁）
+func (r *pacResolver) ensureLoaded(config RelayPACConfig) error {
+	now := time.Now()
+	if now.Before(r.nextLoad) && r.configURL == config.URL {
+		return r.loadErr
+	}
+	r.results = nil
+	r.configURL = config.URL
+	r.url, r.source = config.URL, PACSourceConfig
+	if r.url == "" {
+		r.source = PACSourceSystem
+		systemURL, err := systemPACURL()
+		if err != nil {
+			return r.loadFailed(now, err)
+		}
+		r.url = systemURL
+	}
+	script, err := fetchPACScript(r.url)
+	if err != nil {
+		return r.loadFailed(now, err)
+	}
+	engine, err := newPACEngine(script)
+	if err != nil {
+		return r.loadFailed(now, err)
+	}
+	r.engine, r.loadErr, r.loadedAt = engine, nil, now
+	r.nextLoad = now.Add(time.Duration(config.CacheMinutes) * time.Minute)
+	return nil
+}
+
+func (r *pacResolver) loadFailed(now time.Time, err error) error {
+	if r.loadErr == nil || r.loadErr.Error() != err.Error() {
+		fmt.Printf("[PAC] 加载失败，使用系统代理环境变量: %v\n", err)
+	}
+	r.engine, r.loadErr = nil, err
+	r.nextLoad = now.Add(pacRetryInterval)
+	return err
+}
+
+// proxyFor 返回目标地址应使用的代理（nil 表示直连）及 PAC 原始返回值
+func (r *pacResolver) proxyFor(target *url.URL, config RelayPACConfig) (*url.URL, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.ensureLoaded(config); err != nil {
+		return nil, "", err
+	}
+	key := target.Scheme + "://" + target.Host
+	if entry, ok := r.results[key]; ok && time.Now().Before(entry.expiresAt) {
+		return entry.proxy, entry.result, nil
+	}
+	result, err := r.engine.FindProxy(target)
+	if err != nil {
+		return nil, "", err
+	}
+	proxy, err := parsePACResult(result)
+	if err != nil {
+		return nil, result, err
+	}
+	if r.results == nil {
+		r.results = make(map[string]pacCacheEntry)
+	}
+	r.results[key] = pacCacheEntry{proxy: proxy, result: result, expiresAt: time.Now().Add(time.Duration(config.CacheMinutes) * time.Minute)}
+	return proxy, result, nil
+}
+
+// relayProxy 转发请求的代理选择：启用 PAC 时按目标地址执行 PAC，否则（或 PAC 不可用时）使用系统代理环境变量
+func relayProxy(req *http.Request) (*url.URL, error) {
+	config := currentRelayConfig().PAC
+	if !config.Enabled {
+		return http.ProxyFromEnvironment(req)
+	}
+	proxy, _, err := relayPAC.proxyFor(req.URL, config)
+	if err != nil {
+		return http.ProxyFromEnvironment(req)
+	}
+	return proxy, nil
+}
+
+// newRelayTransport 按 relayProxy 选择代理的 Transport
+func newRelayTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = relayProxy
+	return transport
+}
+
+// relayTransport 转发类请求共用的 Transport（复用连接）；需要单独网络配置时先复制
+var relayTransport = newRelayTransport()
+
+// fetchPACScript 读取 PAC 脚本；下载时不经过代理，避免依赖自身
+func fetchPACScript(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("无效的 PAC 地址: %s", rawURL)
+	}
+	var reader io.Reader
+	switch parsed.Scheme {
+	case "file":
+		file, err := os.Open(parsed.Path)
+		if err != nil {
+			return "", fmt.Errorf("读取 PAC 文件失败: %w", err)
+		}
+		defer file.Close()
+		reader = file
+	case "http", "https":
+		client := &http.Client{Timeout: pacFetchTimeout, Transport: &http.Transport{}}
+		resp, err := client.Get(rawURL)
+		if err != nil {
+			return "", fmt.Errorf("下载 PAC 失败: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("下载 PAC 失败: HTTP %d", resp.StatusCode)
+		}
+		reader = resp.Body
+	default:
+		return "", fmt.Errorf("不支持的 PAC 地址: %s", rawURL)
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, pacMaxScriptBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("读取 PAC 失败: %w", err)
+	}
+	if len(data) > pacMaxScriptBytes {
+		return "", fmt.Errorf("PAC 脚本超过 %d 字节", pacMaxScriptBytes)
+	}
+	return string(data), nil
+}
+
+// systemPACURL 读取系统设置中的 PAC 地址
+func systemPACURL() (string, error) {
+	var pacURL string
+	switch runtime.GOOS {
+	case "windows":
+		out, err := exec.Command("reg", "query", `HKCU\Software\Microsoft\Windows\CurrentVersion\Internet Settings`, "/v", "AutoConfigURL").Output()
+		if err == nil {
+			pacURL = parseRegAutoConfigURL(string(out))
+		}
+	case "darwin":
+		out, err := exec.Command("scutil", "--proxy").Output()
+		if err != nil {
+			return "", fmt.Errorf("执行 scutil 失败: %w", err)
+		}
+		pacURL = parseScutilPACURL(string(out))
+	case "linux":
+		mode, err := exec.Command("gsettings", "get", "org.gnome.system.proxy", "mode").Output()
+		if err == nil && strings.Trim(strings.TrimSpace(string(mode)), "'") == "auto" {
+			out, err := exec.Command("gsettings", "get", "org.gnome.system.proxy", "autoconfig-url").Output()
+			if err == nil {
+				pacURL = strings.Trim(strings.TrimSpace(string(out)), "'")
+			}
+		}
+	}
+	if pacURL == "" {
+		return "", fmt.Errorf("系统未配置 PAC 地址")
+	}
+	return pacURL, nil
+}
+
+// parseRegAutoConfigURL 解析 reg query 输出中的 AutoConfigURL
+func parseRegAutoConfigURL(out string) string {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && strings.EqualFold(fields[0], "AutoConfigURL") && strings.HasPrefix(fields[1], "REG_") {
+			return fields[2]
+		}
+	}
+	return ""
+}
+
+// parseScutilPACURL 解析 scutil --proxy 输出（需 ProxyAutoConfigEnable 为 1）
+func parseScutilPACURL(out string) string {
+	enabled, pacURL := false, ""
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "ProxyAutoConfigEnable":
+			enabled = strings.TrimSpace(value) == "1"
+		case "ProxyAutoConfigURLString":
+			pacURL = strings.TrimSpace(value)
+		}
+	}
+	if !enabled {
+		return ""
+	}
+	return pacURL
+}
+
+// ReloadPAC 清空 PAC 缓存并立即重新加载（供前端调用）
+func (prs *ProviderRelayService) ReloadPAC() error {
+	relayPAC.reset()
+	config := currentRelayConfig().PAC
+	if !config.Enabled {
+		return nil
+	}
+	relayPAC.mu.Lock()
+	defer relayPAC.mu.Unlock()
+	return relayPAC.ensureLoaded(config)
+}
+
+// GetPACDiagnostics 返回 PAC 状态及各 provider 解析到的代理（供前端调用）
+func (prs *ProviderRelayService) GetPACDiagnostics() *PACDiagnostics {
+	config := currentRelayConfig().PAC
+	diag := &PACDiagnostics{Enabled: config.Enabled, Routes: []PACRoute{}}
+
+	for _, platform := range []string{"claude", "codex"} {
+		providers, err := prs.providerService.LoadProviders(platform)
+		if err != nil {
+			continue
+		}
+		for _, p := range providers {
+			if p.APIURL != "" {
+				diag.Routes = append(diag.Routes, resolveProxyRoute(platform, p.Name, p.APIURL, p.Proxy, config))
+			}
+		}
+	}
+	for _, p := range prs.geminiService.GetProviders() {
+		if p.BaseURL != "" {
+			diag.Routes = append(diag.Routes, resolveProxyRoute("gemini", p.Name, p.BaseURL, p.Proxy, config))
+		}
+	}
+
+	relayPAC.mu.Lock()
+	diag.URL, diag.Source = relayPAC.url, relayPAC.source
+	if !relayPAC.loadedAt.IsZero() {
+		diag.LoadedAt = relayPAC.loadedAt.Unix()
+	}
+	if relayPAC.loadErr != nil {
+		diag.Error = relayPAC.loadErr.Error()
+	}
+	relayPAC.mu.Unlock()
+	return diag
+}
+
+// resolveProxyRoute 按转发时的顺序判断代理：provider 上游代理 > PAC > 系统代理环境变量
+func resolveProxyRoute(platform, name, rawURL, providerProxy string, config RelayPACConfig) PACRoute {
+	route := PACRoute{Platform: platform, Provider: name, URL: rawURL, Proxy: "DIRECT"}
+	if providerProxy != "" {
+		route.Via = ProxyViaProvider
+		if parsed, err := url.Parse(providerProxy); err == nil {
+			route.Proxy = parsed.Redacted()
+		}
+		return route
+	}
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		route.Error = err.Error()
+		return route
+	}
+	var proxy *url.URL
+	if config.Enabled {
+		route.Via = ProxyViaPAC
+		proxy, route.PACResult, err = relayPAC.proxyFor(req.URL, config)
+		if err != nil {
+			route.Error = err.Error()
+		}
+	}
+	if !config.Enabled || err != nil {
+		route.Via = ProxyViaEnv
+		proxy, _ = http.ProxyFromEnvironment(req)
+	}
+	if proxy != nil {
+		route.Proxy = proxy.Redacted()
+	}
+	return route
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+)
+
+const testPACScript = `
+function FindProxyForURL(url, host) {
+  if (isPlainHostName(host) || isInNet(host, "10.0.0.0", "255.0.0.0")) return "DIRECT";
+  if (dnsDomainIs(host, ".corp.example")) return "SOCKS4 old:1080; SOCKS5 jump.corp:1080";
+  if (shExpMatch(url, "https://api.*.com/*") && weekdayRange("SUN", "SAT")) return "PROXY proxy.corp:3128; DIRECT";
+  return "DIRECT";
+}
+`
+
+func TestPACEngine(t *testing.T) {
+	engine, err := newPACEngine(testPACScript)
+	if err != nil {
+		t.Fatalf("加载 PAC 失败: %v", err)
+	}
+	cases := map[string]string{
+		"http://intranet/":                           "",
+		"https://10.1.2.3/v1":                        "",
+		"https://mirror.corp.example/v1/models":      "socks5://jump.corp:1080",
+		"https://api.anthropic.com/v1/messages":      "http://proxy.corp:3128",
+		"https://generativelanguage.googleapis.com/": "",
+	}
+	for rawURL, want := range cases {
+		target, _ := url.Parse(rawURL)
+		result, err := engine.FindProxy(target)
+		if err != nil {
+			t.Fatalf("%s 执行失败: %v", rawURL, err)
+		}
+		proxy, err := parsePACResult(result)
+		if err != nil {
+			t.Fatalf("%s 解析 %q 失败: %v", rawURL, result, err)
+		}
+		got := ""
+		if proxy != nil {
+			got = proxy.String()
+		}
+		if got != want {
+			t.Errorf("%s 应使用 %q，得到 %q（PAC 返回 %q）", rawURL, want, got, result)
+		}
+	}
+
+	if _, err := newPACEngine("var x = 1;"); err == nil {
+		t.Error("未定义 FindProxyForURL 应报错")
+	}
+	if _, err := newPACEngine("while (true) {}"); err == nil {
+		t.Error("死循环脚本应超时")
+	}
+}
+
+func TestParsePACResult(t *testing.T) {
+	if _, err := parsePACResult("SOCKS4 old:1080"); err == nil {
+		t.Error("只有不支持的代理类型时应报错")
+	}
+	proxy, err := parsePACResult(" HTTPS secure.proxy:443 ;DIRECT")
+	if err != nil || proxy == nil || proxy.String() != "https://secure.proxy:443" {
+		t.Errorf("应使用 HTTPS 代理，得到 %v, %v", proxy, err)
+	}
+}
+
+func TestParseSystemPACSettings(t *testing.T) {
+	reg := "\r\nHKEY_CURRENT_USER\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings\r\n    AutoConfigURL    REG_SZ    http://wpad.corp/proxy.pac\r\n"
+	if got := parseRegAutoConfigURL(reg); got != "http://wpad.corp/proxy.pac" {
+		t.Errorf("注册表解析错误: %q", got)
+	}
+	scutil := "<dictionary> {\n  HTTPEnable : 0\n  ProxyAutoConfigEnable : 1\n  ProxyAutoConfigURLString : http://wpad.corp/proxy.pac\n}\n"
+	if got := parseScutilPACURL(scutil); got != "http://wpad.corp/proxy.pac" {
+		t.Errorf("scutil 解析错误: %q", got)
+	}
+	if got := parseScutilPACURL("ProxyAutoConfigEnable : 0\nProxyAutoConfigURLString : http://x/p.pac\n"); got != "" {
+		t.Errorf("未启用 PAC 时应返回空，得到 %q", got)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 配置目录选择：默认使用 ~/.code-switch。用户目录只读（企业镜像、沙箱安装）或不存在时，
+// 依次尝试系统配置目录、缓存目录与临时目录下的 code-switch，使用第一个可写的目录，
+// 并把原目录中已有的文件复制过去。所有读写配置的位置都通过 getConfigDir 获取目录。
+
+const configDirName = ".code-switch"
+
+// PathStatus 配置目录状态
+type PathStatus struct {
+	Primary  string `json:"primary"`          // 默认目录 ~/.code-switch
+	Active   string `json:"active"`           // 实际使用的目录
+	Fallback bool   `json:"fallback"`         // 默认目录不可写，已改用备用目录
+	Reason   string `json:"reason,omitempty"` // 默认目录不可用的原因
+	Seeded   int    `json:"seeded,omitempty"` // 从默认目录复制到备用目录的文件数
+}
+
+var (
+	configPathMu     sync.Mutex
+	configPathHome   string // 解析时的用户目录，变化时重新解析
+	configPathStatus *PathStatus
+)
+
+// getConfigDir 获取 CodeSwitch 配置目录（默认目录不可写时返回备用目录）
+func getConfigDir() string {
+	return resolveConfigPath().Active
+}
+
+// ConfigDir 配置目录（供应用入口在创建服务前使用）
+func ConfigDir() string {
+	return getConfigDir()
+}
+
+func resolveConfigPath() PathStatus {
+	home, homeErr := os.UserHomeDir()
+	configPathMu.Lock()
+	defer configPathMu.Unlock()
+	if configPathStatus != nil && configPathHome == home {
+		return *configPathStatus
+	}
+
+	status := &PathStatus{}
+	if homeErr != nil {
+		status.Reason = fmt.Sprintf("获取用户目录失败: %v", homeErr)
+	} else {
+		status.Primary = filepath.Join(home, configDirName)
+		if err := probeWritableDir(status.Primary); err != nil {
+			status.Reason = err.Error()
+		} else {
+			status.Active = status.Primary
+		}
+	}
+	if status.Active == "" {
+		status.Fallback = true
+		for _, candidate := range fallbackConfigDirs() {
+			if probeWritableDir(candidate) == nil {
+				status.Active = candidate
+				break
+			}
+		}
+		if status.Active == "" {
+			// 没有可写目录时仍返回默认目录，由各处的写入报告错误
+			status.Active = status.Primary
+			log.Printf("❌ 配置目录 %s 不可写且没有可用的备用目录: %s", status.Primary, status.Reason)
+		} else {
+			if status.Primary != "" {
+				status.Seeded = seedFallbackConfigDir(status.Primary, status.Active)
+			}
+			log.Printf("⚠️  配置目录 %s 不可写（%s），已改用 %s", status.Primary, status.Reason, status.Active)
+		}
+	}
+	configPathHome = home
+	configPathStatus = status
+	return *status
+}
+
+// fallbackConfigDirs 备用配置目录（按优先级）。
+// 不使用系统临时目录：其中的目录名可被其他本地用户抢先创建，而备用目录会存放 API Key
+func fallbackConfigDirs() []string {
+	var dirs []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "code-switch"))
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "code-switch"))
+	}
+	return dirs
+}
+
+// probeWritableDir 创建目录并写入探测文件，确认目录可写
+func probeWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("目录不可写: %w", err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// seedFallbackConfigDir 备用目录中还没有文件时，复制默认目录下的文件（只复制顶层文件），返回复制的文件数
+func seedFallbackConfigDir(primary, fallback string) int {
+	existing, err := os.ReadDir(fallback)
+	if err != nil {
+		return 0
+	}
+	for _, entry := range existing {
+		if !entry.IsDir() {
+			return 0
+		}
+	}
+	entries, err := os.ReadDir(primary)
+	if err != nil {
+		return 0
+	}
+	copied := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := copyConfigFile(filepath.Join(primary, entry.Name()), filepath.Join(fallback, entry.Name())); err != nil {
+			log.Printf("⚠️  复制 %s 到备用配置目录失败: %v", entry.Name(), err)
+			continue
+		}
+		copied++
+	}
+	return copied
+}
+
+func copyConfigFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// PathService 提供配置目录状态
+type PathService struct{}
+
+func NewPathService() *PathService {
+	return &PathService{}
+}
+
+func (p *PathService) Start() error { return nil }
+func (p *PathService) Stop() error  { return nil }
+
+// GetPathStatus 获取配置目录状态（供前端调用）
+func (p *PathService) GetPathStatus() PathStatus {
+	return resolveConfigPath()
+}
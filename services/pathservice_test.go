@@ -0,0 +1,49 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigDirFallback(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	if got := getConfigDir(); got != filepath.Join(home, configDirName) {
+		t.Fatalf("默认目录可写时应使用 ~/.code-switch: %s", got)
+	}
+
+	// ~/.code-switch 被同名文件占用，无法创建目录
+	readonlyHome := t.TempDir()
+	if err := os.WriteFile(filepath.Join(readonlyHome, configDirName), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fallbackRoot := t.TempDir()
+	t.Setenv("HOME", readonlyHome)
+	t.Setenv("USERPROFILE", readonlyHome)
+	t.Setenv("XDG_CONFIG_HOME", fallbackRoot)
+	t.Setenv("APPDATA", fallbackRoot)
+	status := (&PathService{}).GetPathStatus()
+	if !status.Fallback || status.Active != filepath.Join(fallbackRoot, "code-switch") || status.Reason == "" {
+		t.Fatalf("默认目录不可写时应改用备用目录: %+v", status)
+	}
+	if getConfigDir() != status.Active {
+		t.Errorf("getConfigDir() 应返回备用目录")
+	}
+	if item := (&StartupCheckService{}).checkConfigDir(); item.Status != StartupCheckWarn {
+		t.Errorf("启动自检应提示已改用备用目录: %+v", item)
+	}
+}
+
+func TestFallbackConfigDirsExcludeTempDir(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("TMPDIR", "/shared-tmp")
+	for _, dir := range fallbackConfigDirs() {
+		if strings.HasPrefix(dir, os.TempDir()) {
+			t.Errorf("备用目录不应位于共享的临时目录: %s", dir)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// policyEnvVar 指定策略文件路径的环境变量（优先于系统默认位置，仅开发与测试构建生效）
+const policyEnvVar = "CODE_SWITCH_POLICY"
+
+// policyRetentionInterval 按策略清理过期数据的间隔
+const policyRetentionInterval = time.Hour
+
+// policyStorageKey lockedSettings 中锁定存储后端的键名，其余键对应 relay-config.json 的顶层字段
+const policyStorageKey = "storage"
+
+// Policy 企业管理员下发的只读策略（/etc/code-switch/policy.json 或 MDM 下发）
+type Policy struct {
+	// AllowedProviderDomains 允许使用的 provider 域名，支持 *.example.com 匹配子域名；为空表示不限制
+	AllowedProviderDomains []string `json:"allowedProviderDomains,omitempty"`
+	// DisableKeyExport 禁止通过管理接口等途径读取明文 API Key
+	DisableKeyExport bool `json:"disableKeyExport,omitempty"`
+	// MaxRetentionDays 请求日志、反馈与对话历史最长保留天数，0 表示不限制
+	MaxRetentionDays int `json:"maxRetentionDays,omitempty"`
+	// LockedSettings 锁定的设置及其取值，键为 relay-config.json 的顶层字段（如 transcript、adminApi）或 storage
+	LockedSettings map[string]json.RawMessage `json:"lockedSettings,omitempty"`
+
+	// failClosed 策略文件存在但无效：不知道管理员的本意，按最严格的限制处理
+	failClosed bool
+}
+
+// restrictivePolicy 策略文件无效时生效的策略：禁止所有 provider 域名、禁止导出 Key、锁定全部设置
+func restrictivePolicy() *Policy {
+	return &Policy{DisableKeyExport: true, failClosed: true}
+}
+
+// policyState 策略加载结果
+type policyState struct {
+	policy *Policy
+	path   string
+	err    error
+}
+
+var (
+	activePolicy   atomic.Pointer[policyState]
+	policyLoadOnce sync.Once
+)
+
+// policyFilePaths 按平台返回策略文件的候选位置
+func policyFilePaths() []string {
+	if path := strings.TrimSpace(os.Getenv(policyEnvVar)); path != "" && policyEnvOverride {
+		return []string{path}
+	}
+	switch runtime.GOOS {
+	case "windows":
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return []string{filepath.Join(programData, "CodeSwitch", "policy.json")}
+	case "darwin":
+		return []string{
+			"/Library/Managed Preferences/code-switch/policy.json", // MDM 下发
+			"/Library/Application Support/CodeSwitch/policy.json",
+		}
+	default:
+		return []string{"/etc/code-switch/policy.json"}
+	}
+}
+
+// loadPolicyFile 读取并校验策略文件
+func loadPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("解析策略文件失败: %w", err)
+	}
+	if policy.MaxRetentionDays < 0 {
+		return nil, fmt.Errorf("maxRetentionDays 不能为负数")
+	}
+	for i, domain := range policy.AllowedProviderDomains {
+		policy.AllowedProviderDomains[i] = strings.ToLower(strings.TrimSpace(domain))
+	}
+	return policy, nil
+}
+
+// currentPolicy 返回生效的策略（首次调用时加载，没有策略文件时返回空策略）
+// 策略文件无效时按最严格的限制处理（fail closed），错误通过 GetPolicyStatus 展示
+func currentPolicy() *Policy {
+	policyLoadOnce.Do(func() {
+		state := &policyState{policy: &Policy{}}
+		for _, path := range policyFilePaths() {
+			policy, err := loadPolicyFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			state.path = path
+			if err != nil {
+				state.policy = restrictivePolicy()
+				state.err = err
+				log.Printf("⚠️  管理员策略 %s 无效，已按最严格限制处理: %v", path, err)
+				break
+			}
+			state.policy = policy
+			log.Printf("🔒 已加载管理员策略: %s", path)
+			break
+		}
+		activePolicy.CompareAndSwap(nil, state)
+	})
+	return activePolicy.Load().policy
+}
+
+// AllowsURL provider 地址的域名是否在允许范围内
+func (p *Policy) AllowsURL(rawURL string) bool {
+	if p.failClosed {
+		return false
+	}
+	if len(p.AllowedProviderDomains) == 0 {
+		return true
+	}
+	host, err := upstreamHost(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, domain := range p.AllowedProviderDomains {
+		if matchDomain(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProviderURL 保存 provider 时校验域名
+func (p *Policy) checkProviderURL(name, rawURL string) error {
+	if rawURL == "" || p.AllowsURL(rawURL) {
+		return nil
+	}
+	return fmt.Errorf("[%s] 地址 %s 不在管理员允许的域名范围内", name, rawURL)
+}
+
+// IsLocked 设置是否被管理员锁定
+func (p *Policy) IsLocked(key string) bool {
+	if p.failClosed {
+		return true
+	}
+	_, ok := p.LockedSettings[key]
+	return ok
+}
+
+// relayConfigKeys RelayConfig 的顶层 JSON 字段
+var relayConfigKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(RelayConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		keys[name] = true
+	}
+	return keys
+}()
+
+// applyLockedSettings 将策略中锁定的取值覆盖到配置上（只处理 target 中存在的字段）
+func (p *Policy) applyLockedSettings(target any, allowed func(key string) bool) error {
+	overlay := map[string]json.RawMessage{}
+	for key, value := range p.LockedSettings {
+		if allowed(key) {
+			overlay[key] = value
+		}
+	}
+	if len(overlay) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(overlay)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// applyRelayConfig 覆盖中继配置中被锁定的设置
+func (p *Policy) applyRelayConfig(config *RelayConfig) error {
+	return p.applyLockedSettings(config, func(key string) bool { return relayConfigKeys[key] })
+}
+
+// checkRelayConfig 保存中继配置前检查是否修改了被锁定的设置
+func (p *Policy) checkRelayConfig(config *RelayConfig) error {
+	if p.failClosed {
+		return fmt.Errorf("管理员策略无效，所有设置已锁定，请联系管理员修复策略文件")
+	}
+	if len(p.LockedSettings) == 0 {
+		return nil
+	}
+	// 通过 JSON 复制，避免覆盖时修改调用方配置中的 map
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	var locked RelayConfig
+	if err := json.Unmarshal(data, &locked); err != nil {
+		return err
+	}
+	if err := p.applyRelayConfig(&locked); err != nil {
+		return fmt.Errorf("应用管理员策略失败: %w", err)
+	}
+	submitted, err := jsonFields(config)
+	if err != nil {
+		return err
+	}
+	enforced, err := jsonFields(&locked)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(p.LockedSettings))
+	for key := range p.LockedSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if relayConfigKeys[key] && !bytes.Equal(submitted[key], enforced[key]) {
+			return fmt.Errorf("设置 %s 已由管理员锁定，无法修改", key)
+		}
+	}
+	return nil
+}
+
+// jsonFields 将结构体序列化为顶层字段映射
+func jsonFields(v any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	return fields, json.Unmarshal(data, &fields)
+}
+
+// enforcePolicyRetention 删除超过策略保留天数的请求日志、反馈与对话历史
+func enforcePolicyRetention(now time.Time) (int64, error) {
+	days := currentPolicy().MaxRetentionDays
+	if days <= 0 {
+		return 0, nil
+	}
+	cutoff := startOfDay(now).AddDate(0, 0, -days).Unix()
+	var total int64
+	for _, table := range []string{"request_feedback", "request_annotation", "request_log", "conversation_log"} {
+		n, err := execPurge(table, "DELETE FROM "+table+" WHERE created_at < ?", cutoff)
+		if err != nil {
+			return total, fmt.Errorf("清理 %s 失败: %w", table, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// PolicyStatus 管理员策略状态（前端据此标记被锁定的选项）
+type PolicyStatus struct {
+	Active                 bool     `json:"active"`
+	Path                   string   `json:"path,omitempty"`
+	Error                  string   `json:"error,omitempty"`
+	AllowedProviderDomains []string `json:"allowedProviderDomains"`
+	DisableKeyExport       bool     `json:"disableKeyExport"`
+	MaxRetentionDays       int      `json:"maxRetentionDays"`
+	LockedSettings         []string `json:"lockedSettings"` // 被锁定的设置键名
+}
+
+// PolicyService 管理员策略：提供策略状态并按保留期限定期清理数据
+type PolicyService struct{}
+
+func NewPolicyService() *PolicyService {
+	return &PolicyService{}
+}
+
+// Start 注册定期清理任务（仅在设置了保留期限时运行）
+func (ps *PolicyService) Start() error {
+	scheduleJob(backgroundJob{
+		name:  "policy_retention",
+		title: "按保留期限清理数据",
+		interval: func() time.Duration {
+			if currentPolicy().MaxRetentionDays <= 0 {
+				return 0
+			}
+			return policyRetentionInterval
+		},
+		run: func() error {
+			n, err := enforcePolicyRetention(time.Now())
+			if err != nil {
+				return fmt.Errorf("按保留期限清理数据失败: %w", err)
+			}
+			if n > 0 {
+				log.Printf("[Policy] 已按保留期限清理 %d 条记录", n)
+			}
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止定期清理
+func (ps *PolicyService) Stop() error {
+	unscheduleJob("policy_retention")
+	return nil
+}
+
+// GetPolicyStatus 获取管理员策略（供前端调用）
+func (ps *PolicyService) GetPolicyStatus() PolicyStatus {
+	policy := currentPolicy()
+	state := activePolicy.Load()
+	status := PolicyStatus{
+		Active:                 state.path != "",
+		Path:                   state.path,
+		AllowedProviderDomains: append([]string{}, policy.AllowedProviderDomains...),
+		DisableKeyExport:       policy.DisableKeyExport,
+		MaxRetentionDays:       policy.MaxRetentionDays,
+		LockedSettings:         []string{},
+	}
+	if state.err != nil {
+		status.Error = state.err.Error()
+	}
+	for key := range policy.LockedSettings {
+		status.LockedSettings = append(status.LockedSettings, key)
+	}
+	if policy.failClosed {
+		for key := range relayConfigKeys {
+			status.LockedSettings = append(status.LockedSettings, key)
+		}
+		status.LockedSettings = append(status.LockedSettings, policyStorageKey)
+	}
+	sort.Strings(status.LockedSettings)
+	return status
+}
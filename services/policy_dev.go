@@ -0,0 +1,6 @@
+//go:build !production
+
+package services
+
+// policyEnvOverride 开发与测试构建允许通过 CODE_SWITCH_POLICY 指定策略文件
+const policyEnvOverride = true
@@ -0,0 +1,6 @@
+//go:build production
+
+package services
+
+// policyEnvOverride 正式版忽略 CODE_SWITCH_POLICY，避免普通用户绕过系统位置下发的策略
+const policyEnvOverride = false
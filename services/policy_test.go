@@ -0,0 +1,76 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPolicyAllowsURL(t *testing.T) {
+	policy := &Policy{AllowedProviderDomains: []string{"api.anthropic.com", "*.corp.example.com"}}
+	tests := map[string]bool{
+		"https://api.anthropic.com":             true,
+		"https://API.Anthropic.com:443/v1":      true,
+		"https://relay.corp.example.com/claude": true,
+		"https://corp.example.com":              false,
+		"https://evil-corp.example.com":         false,
+		"https://api.anthropic.com.evil.io":     false,
+		"not a url":                             false,
+	}
+	for url, want := range tests {
+		if got := policy.AllowsURL(url); got != want {
+			t.Errorf("AllowsURL(%q) = %v, want %v", url, got, want)
+		}
+	}
+	if !(&Policy{}).AllowsURL("https://anything.example.com") {
+		t.Error("empty allowlist should allow any domain")
+	}
+}
+
+func TestPolicyLockedRelaySettings(t *testing.T) {
+	policy := &Policy{LockedSettings: map[string]json.RawMessage{
+		"transcript": json.RawMessage(`{"enabled":false}`),
+		"storage":    json.RawMessage(`{"backend":"sqlite"}`),
+	}}
+
+	config := DefaultRelayConfig()
+	config.Transcript.Enabled = true
+	config.Transcript.Mode = TranscriptModeFull
+	if err := policy.applyRelayConfig(config); err != nil {
+		t.Fatalf("applyRelayConfig: %v", err)
+	}
+	if config.Transcript.Enabled || config.Transcript.Mode != TranscriptModeFull {
+		t.Errorf("locked value not applied or unlocked field overwritten: %+v", config.Transcript)
+	}
+
+	// 未修改锁定项时允许保存其他设置
+	config.Dedup.WindowMs = 1234
+	if err := policy.checkRelayConfig(config); err != nil {
+		t.Errorf("checkRelayConfig on unchanged locked setting: %v", err)
+	}
+	config.Transcript.Enabled = true
+	if err := policy.checkRelayConfig(config); err == nil {
+		t.Error("changing a locked setting should fail")
+	}
+}
+
+func TestRestrictivePolicyFailsClosed(t *testing.T) {
+	policy := restrictivePolicy()
+	if policy.AllowsURL("https://api.anthropic.com") {
+		t.Error("invalid policy should not allow any provider domain")
+	}
+	if !policy.DisableKeyExport || !policy.IsLocked("transcript") || !policy.IsLocked(policyStorageKey) {
+		t.Error("invalid policy should disable key export and lock every setting")
+	}
+	if err := policy.checkRelayConfig(DefaultRelayConfig()); err == nil {
+		t.Error("saving relay config under an invalid policy should fail")
+	}
+}
+
+func TestPolicyFilePathsEnvOverride(t *testing.T) {
+	t.Setenv(policyEnvVar, "/tmp/custom-policy.json")
+	paths := policyFilePaths()
+	overridden := len(paths) == 1 && paths[0] == "/tmp/custom-policy.json"
+	if overridden != policyEnvOverride {
+		t.Errorf("policyFilePaths() = %v, env override enabled = %v", paths, policyEnvOverride)
+	}
+}
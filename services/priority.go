@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// PriorityInteractive 交互式请求（IDE / 终端中用户正在等待的请求），优先排队
+	PriorityInteractive = "interactive"
+	// PriorityBatch 批量/后台请求（自动化 agent、脚本），并发受限时让位于交互式请求
+	PriorityBatch = "batch"
+
+	// PriorityHeader 客户端可通过该请求头指定优先级
+	PriorityHeader = "X-CodeSwitch-Priority"
+)
+
+// errQueueTimeout 等待 provider 并发名额超时（不计入 provider 失败次数）
+var errQueueTimeout = errors.New("等待 provider 并发名额超时")
+
+// requestPriority 确定请求的优先级：请求头 > 按客户端工具配置 > 默认优先级
+func requestPriority(c *gin.Context) string {
+	if c != nil && c.Request != nil {
+		switch strings.ToLower(strings.TrimSpace(c.GetHeader(PriorityHeader))) {
+		case PriorityInteractive:
+			return PriorityInteractive
+		case PriorityBatch:
+			return PriorityBatch
+		}
+	}
+	config := currentRelayConfig().Priority
+	if len(config.ClientClasses) > 0 {
+		tool, _ := identifyClient(c)
+		if class, ok := config.ClientClasses[tool]; ok && isValidPriority(class) {
+			return class
+		}
+	}
+	if isValidPriority(config.DefaultClass) {
+		return config.DefaultClass
+	}
+	return PriorityInteractive
+}
+
+func isValidPriority(class string) bool {
+	return class == PriorityInteractive || class == PriorityBatch
+}
+
+// providerLimiter 单个 provider 的并发限制，等待队列按优先级出队
+type providerLimiter struct {
+	mu          sync.Mutex
+	active      int
+	interactive []chan struct{}
+	batch       []chan struct{}
+}
+
+// acquire 获取并发名额；名额已满时排队等待，交互式请求总是先于批量请求被唤醒
+func (l *providerLimiter) acquire(ctx context.Context, limit int, class string) error {
+	l.mu.Lock()
+	if l.active < limit {
+		l.active++
+		l.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	if class == PriorityBatch {
+		l.batch = append(l.batch, ready)
+	} else {
+		l.interactive = append(l.interactive, ready)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.removeWaiter(ready) {
+			return ctx.Err()
+		}
+		// 取消的同时已被唤醒：名额已转交给本请求，需要归还
+		l.releaseLocked()
+		return ctx.Err()
+	}
+}
+
+// release 归还并发名额，直接转交给下一个等待者
+func (l *providerLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked()
+}
+
+func (l *providerLimiter) releaseLocked() {
+	var next chan struct{}
+	switch {
+	case len(l.interactive) > 0:
+		next, l.interactive = l.interactive[0], l.interactive[1:]
+	case len(l.batch) > 0:
+		next, l.batch = l.batch[0], l.batch[1:]
+	default:
+		l.active--
+		return
+	}
+	close(next)
+}
+
+// removeWaiter 从等待队列中移除，返回是否仍在队列中
+func (l *providerLimiter) removeWaiter(ready chan struct{}) bool {
+	for _, queue := range []*[]chan struct{}{&l.interactive, &l.batch} {
+		for i, ch := range *queue {
+			if ch == ready {
+				*queue = append((*queue)[:i], (*queue)[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// providerLimiters 按 "平台/provider 名" 管理并发限制器
+type providerLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*providerLimiter
+}
+
+func newProviderLimiters() *providerLimiters {
+	return &providerLimiters{limiters: make(map[string]*providerLimiter)}
+}
+
+func (pl *providerLimiters) get(kind, providerName string) *providerLimiter {
+	key := kind + "/" + providerName
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	limiter, ok := pl.limiters[key]
+	if !ok {
+		limiter = &providerLimiter{}
+		pl.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// acquireProviderSlot 按 provider 的并发上限获取名额，未配置上限时直接放行
+// 返回的 release 必须在请求结束后调用
+func (prs *ProviderRelayService) acquireProviderSlot(c *gin.Context, kind string, provider Provider) (release func(), err error) {
+	if provider.MaxConcurrency <= 0 || prs.limiters == nil {
+		return func() {}, nil
+	}
+	class := requestPriority(c)
+	limiter := prs.limiters.get(kind, provider.Name)
+
+	timeout := time.Duration(currentRelayConfig().Priority.QueueTimeoutSec) * time.Second
+	ctx := c.Request.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	if err := limiter.acquire(ctx, provider.MaxConcurrency, class); err != nil {
+		if c.Request.Context().Err() != nil {
+			return nil, errClientAbort
+		}
+		return nil, fmt.Errorf("%w（%s，已等待 %.1fs）", errQueueTimeout, provider.Name, time.Since(start).Seconds())
+	}
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		fmt.Printf("[INFO] ⏳ %s 请求排队 %.1fs 后获得 %s 的并发名额\n", class, waited.Seconds(), provider.Name)
+	}
+	return limiter.release, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProviderLimiter_InteractiveFirst(t *testing.T) {
+	limiter := &providerLimiter{}
+	ctx := context.Background()
+	if err := limiter.acquire(ctx, 1, PriorityBatch); err != nil {
+		t.Fatalf("首个请求应直接获得名额: %v", err)
+	}
+
+	order := make(chan string, 2)
+	go func() {
+		_ = limiter.acquire(ctx, 1, PriorityBatch)
+		order <- PriorityBatch
+		limiter.release()
+	}()
+	time.Sleep(20 * time.Millisecond) // 确保批量请求先进入队列
+	go func() {
+		_ = limiter.acquire(ctx, 1, PriorityInteractive)
+		order <- PriorityInteractive
+		limiter.release()
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	limiter.release()
+	if first := <-order; first != PriorityInteractive {
+		t.Errorf("交互式请求应先获得名额，实际为 %s", first)
+	}
+	<-order
+	if limiter.active != 0 {
+		t.Errorf("全部释放后 active = %d, want 0", limiter.active)
+	}
+}
+
+func TestProviderLimiter_Timeout(t *testing.T) {
+	limiter := &providerLimiter{}
+	_ = limiter.acquire(context.Background(), 1, PriorityInteractive)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.acquire(ctx, 1, PriorityBatch); err == nil {
+		t.Fatal("名额已满时应等待超时")
+	}
+	if len(limiter.batch) != 0 {
+		t.Errorf("超时后应移出等待队列，剩余 %d", len(limiter.batch))
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ProjectHeader 客户端用于标记请求所属项目的请求头
+	ProjectHeader = "X-CodeSwitch-Project"
+
+	// relayHeaderPrefix 中继自用请求头前缀，转发上游前会被移除
+	relayHeaderPrefix = "X-Codeswitch-"
+
+	// maxProjectNameLength 项目名最大长度（字符）
+	maxProjectNameLength = 64
+)
+
+// ProjectCostStat 按项目汇总的用量与费用
+type ProjectCostStat struct {
+	Project            string  `json:"project"` // 空字符串表示未标记项目（请求头与进程映射均未命中）
+	TotalRequests      int64   `json:"total_requests"`
+	SuccessfulRequests int64   `json:"successful_requests"`
+	InputTokens        int64   `json:"input_tokens"`
+	OutputTokens       int64   `json:"output_tokens"`
+	ReasoningTokens    int64   `json:"reasoning_tokens"`
+	CacheCreateTokens  int64   `json:"cache_create_tokens"`
+	CacheReadTokens    int64   `json:"cache_read_tokens"`
+	CostTotal          float64 `json:"cost_total"`
+}
+
+// requestProject 读取请求所属项目
+func requestProject(c *gin.Context) string {
+	if c == nil || c.Request == nil {
+		return ""
+	}
+	project := strings.TrimSpace(c.GetHeader(ProjectHeader))
+	if utf8.RuneCountInString(project) > maxProjectNameLength {
+		project = string([]rune(project)[:maxProjectNameLength])
+	}
+	return project
+}
+
+// processProject 按进程名查找映射的项目（忽略大小写与 Windows 的 .exe 后缀）
+func processProject(mapping map[string]string, process string) string {
+	if len(mapping) == 0 || process == "" {
+		return ""
+	}
+	want := normalizeProcessName(process)
+	for name, project := range mapping {
+		if normalizeProcessName(name) == want {
+			return strings.TrimSpace(project)
+		}
+	}
+	return ""
+}
+
+func normalizeProcessName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".exe")
+}
+
+// validateProjectByProcess 校验进程到项目的映射
+func validateProjectByProcess(mapping map[string]string) error {
+	for process, project := range mapping {
+		if strings.TrimSpace(process) == "" {
+			return fmt.Errorf("项目映射的进程名不能为空")
+		}
+		project = strings.TrimSpace(project)
+		if project == "" {
+			return fmt.Errorf("进程 %s 映射的项目名不能为空", process)
+		}
+		if utf8.RuneCountInString(project) > maxProjectNameLength {
+			return fmt.Errorf("进程 %s 映射的项目名超过 %d 个字符", process, maxProjectNameLength)
+		}
+	}
+	return nil
+}
+
+// isRelayHeader 判断是否为中继自用请求头
+func isRelayHeader(key string) bool {
+	return strings.HasPrefix(http.CanonicalHeaderKey(key), relayHeaderPrefix)
+}
+
+// stripRelayHeaders 移除中继自用请求头，避免泄露给上游
+func stripRelayHeaders(headers map[string]string) {
+	for key := range headers {
+		if isRelayHeader(key) {
+			delete(headers, key)
+		}
+	}
+}
+
+// ProjectCostStats 按项目统计最近 days 天的用量与费用（供前端出具按项目的费用报表）
+func (ls *LogService) ProjectCostStats(platform string, days int) ([]ProjectCostStat, error) {
+	if days <= 0 {
+		days = 30
+	}
+	start := startOfDay(time.Now()).AddDate(0, 0, -(days - 1))
+	model := sharedModel("request_log")
+	options := []xdb.Option{
+		xdb.WhereGte("created_at", start.Unix()),
+		xdb.Field(
+			"project",
+			"model",
+			"http_code",
+			"input_tokens",
+			"output_tokens",
+			"reasoning_tokens",
+			"cache_create_tokens",
+			"cache_read_tokens",
+		),
+	}
+	if platform != "" {
+		options = append(options, xdb.WhereEq("platform", platform))
+	}
+	records, err := model.Selects(options...)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return []ProjectCostStat{}, nil
+		}
+		return nil, err
+	}
+
+	rows := make([]ReqeustLog, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, ReqeustLog{
+			Project:           record.GetString("project"),
+			Model:             record.GetString("model"),
+			HttpCode:          record.GetInt("http_code"),
+			InputTokens:       record.GetInt("input_tokens"),
+			OutputTokens:      record.GetInt("output_tokens"),
+			ReasoningTokens:   record.GetInt("reasoning_tokens"),
+			CacheCreateTokens: record.GetInt("cache_create_tokens"),
+			CacheReadTokens:   record.GetInt("cache_read_tokens"),
+		})
+	}
+	return aggregateProjectCosts(rows, func(model string, usage modelpricing.UsageSnapshot) float64 {
+		return ls.calculateCost(model, usage).TotalCost
+	}), nil
+}
+
+// aggregateProjectCosts 按项目汇总请求记录，结果按费用降序
+func aggregateProjectCosts(rows []ReqeustLog, cost func(model string, usage modelpricing.UsageSnapshot) float64) []ProjectCostStat {
+	statMap := map[string]*ProjectCostStat{}
+	for _, row := range rows {
+		project := strings.TrimSpace(row.Project)
+		stat := statMap[project]
+		if stat == nil {
+			stat = &ProjectCostStat{Project: project}
+			statMap[project] = stat
+		}
+
+		stat.TotalRequests++
+		if row.HttpCode >= 200 && row.HttpCode < 300 {
+			stat.SuccessfulRequests++
+		}
+		stat.InputTokens += int64(row.InputTokens)
+		stat.OutputTokens += int64(row.OutputTokens)
+		stat.ReasoningTokens += int64(row.ReasoningTokens)
+		stat.CacheCreateTokens += int64(row.CacheCreateTokens)
+		stat.CacheReadTokens += int64(row.CacheReadTokens)
+		stat.CostTotal += cost(row.Model, modelpricing.UsageSnapshot{
+			InputTokens:       row.InputTokens,
+			OutputTokens:      row.OutputTokens,
+			ReasoningTokens:   row.ReasoningTokens,
+			CacheCreateTokens: row.CacheCreateTokens,
+			CacheReadTokens:   row.CacheReadTokens,
+		})
+	}
+
+	stats := make([]ProjectCostStat, 0, len(statMap))
+	for _, stat := range statMap {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].CostTotal == stats[j].CostTotal {
+			return stats[i].Project < stats[j].Project
+		}
+		return stats[i].CostTotal > stats[j].CostTotal
+	})
+	return stats
+}
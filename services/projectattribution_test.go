@@ -0,0 +1,81 @@
+package services
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestProject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	c.Request.Header.Set(ProjectHeader, "  acme  ")
+	if got := requestProject(c); got != "acme" {
+		t.Errorf("requestProject() = %q, want acme", got)
+	}
+	c.Request.Header.Set(ProjectHeader, strings.Repeat("项", maxProjectNameLength+10))
+	if got := requestProject(c); len([]rune(got)) != maxProjectNameLength {
+		t.Errorf("项目名应截断为 %d 个字符，得到 %d", maxProjectNameLength, len([]rune(got)))
+	}
+}
+
+func TestProcessProject(t *testing.T) {
+	mapping := map[string]string{"Cursor.exe": "client-a", "node": "client-b"}
+	tests := map[string]string{
+		"cursor":     "client-a",
+		"CURSOR.EXE": "client-a",
+		"node.exe":   "client-b",
+		"python":     "",
+		"":           "",
+	}
+	for process, want := range tests {
+		if got := processProject(mapping, process); got != want {
+			t.Errorf("processProject(%q) = %q, want %q", process, got, want)
+		}
+	}
+
+	if err := validateProjectByProcess(map[string]string{"node": " "}); err == nil {
+		t.Error("空项目名应报错")
+	}
+	if err := validateProjectByProcess(map[string]string{"node": strings.Repeat("x", maxProjectNameLength+1)}); err == nil {
+		t.Error("过长的项目名应报错")
+	}
+	if err := validateProjectByProcess(mapping); err != nil {
+		t.Errorf("有效映射不应报错: %v", err)
+	}
+}
+
+func TestAggregateProjectCosts(t *testing.T) {
+	rows := []ReqeustLog{
+		{Project: "acme", Model: "m", HttpCode: 200, InputTokens: 100, OutputTokens: 10},
+		{Project: " acme ", Model: "m", HttpCode: 500, InputTokens: 50},
+		{Project: "globex", Model: "m", HttpCode: 200, InputTokens: 1000, OutputTokens: 100, CacheReadTokens: 5},
+		{Project: "", Model: "m", HttpCode: 200, InputTokens: 1},
+	}
+	// 每个 token 计 0.001 美元
+	cost := func(model string, usage modelpricing.UsageSnapshot) float64 {
+		return float64(usage.InputTokens+usage.OutputTokens) * 0.001
+	}
+	stats := aggregateProjectCosts(rows, cost)
+	if len(stats) != 3 {
+		t.Fatalf("应汇总为 3 个项目，得到 %d: %+v", len(stats), stats)
+	}
+	if stats[0].Project != "globex" || stats[1].Project != "acme" || stats[2].Project != "" {
+		t.Fatalf("应按费用降序排列: %+v", stats)
+	}
+	acme := stats[1]
+	if acme.TotalRequests != 2 || acme.SuccessfulRequests != 1 || acme.InputTokens != 150 || acme.OutputTokens != 10 {
+		t.Errorf("acme 汇总不符: %+v", acme)
+	}
+	if acme.CostTotal < 0.1599 || acme.CostTotal > 0.1601 {
+		t.Errorf("acme 费用应为 0.16，得到 %v", acme.CostTotal)
+	}
+	if stats[0].CacheReadTokens != 5 {
+		t.Errorf("globex 缓存读取 token 不符: %+v", stats[0])
+	}
+}
@@ -386,12 +386,7 @@ func (s *PromptService) writePromptFile(path, content string) error {
 
 // load 加载配置
 func (s *PromptService) load() error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return err
-	}
-
-	configPath := filepath.Join(home, ".code-switch", "prompts.json")
+	configPath := filepath.Join(getConfigDir(), "prompts.json")
 
 	data, err := os.ReadFile(configPath)
 	if err != nil {
@@ -406,12 +401,7 @@ func (s *PromptService) load() error {
 
 // save 保存配置
 func (s *PromptService) save() error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return err
-	}
-
-	configDir := filepath.Join(home, ".code-switch")
+	configDir := getConfigDir()
 	if err := os.MkdirAll(configDir, 0755); err != nil {
 		return err
 	}
@@ -429,7 +419,11 @@ func (s *PromptService) save() error {
 		return err
 	}
 
-	return os.Rename(tmpPath, configPath)
+	if err := os.Rename(tmpPath, configPath); err != nil {
+		return err
+	}
+	recordConfigIntegrity(configPath)
+	return nil
 }
 
 // deepCopyMap 深拷贝提示词映射
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// provider 稳定 ID：claude / codex 的 provider 在保存时分配 UUID（uid），改名后保持不变；gemini 使用已有的字符串 ID。
+// request_log 与 provider_blacklist 在写入时同时记录 provider_uid，启动时为旧记录补齐，并按 uid 找回
+// 在应用外（手动编辑配置文件）改名的 provider 的历史记录，统一改为当前名称（同 RenameProvider，并记录曾用名）。
+
+// providerIdentity 平台内的 provider 身份
+type providerIdentity struct {
+	platform string
+	uid      string
+	name     string
+}
+
+// newProviderUID 生成新的 provider uid
+func newProviderUID() string {
+	return uuid.NewString()
+}
+
+// assignProviderUIDs 为缺少 uid 或 uid 重复（复制配置文件中的条目）的 provider 分配新的 uid，返回是否有变化
+func assignProviderUIDs(providers []Provider) bool {
+	changed := false
+	seen := make(map[string]bool, len(providers))
+	for i := range providers {
+		if providers[i].UID == "" || seen[providers[i].UID] {
+			providers[i].UID = newProviderUID()
+			changed = true
+		}
+		seen[providers[i].UID] = true
+	}
+	return changed
+}
+
+// providerUIDByName 按名称查找 claude / codex provider 的 uid（优先读取配置快照），找不到时返回空字符串
+func providerUIDByName(platform, name string) string {
+	if platform != "claude" && platform != "codex" {
+		return ""
+	}
+	var providers []Provider
+	if snapshot := activeConfigSnapshot.Load(); snapshot != nil && snapshot.providerErrs[platform] == nil {
+		providers = snapshot.providers[platform]
+	} else {
+		providers, _ = loadProvidersFile(platform)
+	}
+	if i := providerIndex(providers, name); i >= 0 {
+		return providers[i].UID
+	}
+	return ""
+}
+
+// requestLogProviderUID 请求日志中的 provider uid，转发时未记录时按名称查找
+func requestLogProviderUID(requestLog *ReqeustLog) string {
+	if requestLog.ProviderUID != "" {
+		return requestLog.ProviderUID
+	}
+	return providerUIDByName(requestLog.Platform, canonicalProviderName(requestLog.Platform, requestLog.Provider))
+}
+
+// MigrateProviderIdentities 启动时为 provider 分配 uid，并在后台为数据库记录补齐 uid、同步在应用外改名的 provider
+func (ps *ProviderService) MigrateProviderIdentities(gemini *GeminiService) {
+	var identities []providerIdentity
+	ps.mu.Lock()
+	for _, kind := range []string{"claude", "codex"} {
+		providers, err := loadProvidersFile(kind)
+		if err != nil || len(providers) == 0 {
+			continue
+		}
+		if assignProviderUIDs(providers) {
+			path, err := providerFilePath(kind)
+			if err == nil {
+				err = AtomicWriteJSON(path, providerEnvelope{Providers: providers})
+			}
+			if err != nil {
+				log.Printf("⚠️  [%s] 保存 provider uid 失败: %v", kind, err)
+				continue
+			}
+			recordConfigIntegrity(path)
+			log.Printf("🆔 [%s] 已为 provider 分配稳定 ID", kind)
+		}
+		for _, p := range providers {
+			identities = append(identities, providerIdentity{platform: kind, uid: p.UID, name: p.Name})
+		}
+	}
+	ps.mu.Unlock()
+	refreshConfigSnapshot()
+
+	if gemini != nil {
+		for _, p := range gemini.GetProviders() {
+			if p.ID != "" {
+				identities = append(identities, providerIdentity{platform: "gemini", uid: p.ID, name: p.Name})
+			}
+		}
+	}
+	if GlobalDBQueue == nil || len(identities) == 0 {
+		return
+	}
+	go syncProviderRecordIdentities(identities)
+}
+
+// syncProviderRecordIdentities 为旧记录补齐 provider_uid，并把 uid 相同但名称不同的记录改为当前名称
+func syncProviderRecordIdentities(identities []providerIdentity) {
+	db, err := sharedDB()
+	if err != nil {
+		log.Printf("⚠️  同步 provider 身份失败: %v", err)
+		return
+	}
+	current := make(map[string]string, len(identities)) // 平台|uid → 当前名称
+	byName := make(map[string]string, len(identities))  // 平台|名称 → uid
+	for _, id := range identities {
+		current[id.platform+"|"+id.uid] = id.name
+		byName[id.platform+"|"+id.name] = id.uid
+	}
+
+	// 1. 按 uid 找出在应用外改名的 provider
+	renamed := map[[3]string]bool{} // 平台, 原名称, 当前名称
+	for _, query := range []string{
+		`SELECT DISTINCT platform, provider_uid, provider FROM request_log WHERE provider_uid <> ''`,
+		`SELECT DISTINCT platform, provider_uid, provider_name FROM provider_blacklist WHERE provider_uid <> ''`,
+	} {
+		rows, err := db.Query(query)
+		if err != nil {
+			if !isNoSuchTableErr(err) {
+				log.Printf("⚠️  读取 provider 身份失败: %v", err)
+			}
+			continue
+		}
+		for rows.Next() {
+			var platform, uid, name string
+			if err := rows.Scan(&platform, &uid, &name); err != nil {
+				continue
+			}
+			// 原名称已被另一个 provider 使用时不合并，避免把两个 provider 的记录混在一起
+			if now, ok := current[platform+"|"+uid]; ok && now != name && byName[platform+"|"+name] == "" {
+				renamed[[3]string{platform, name, now}] = true
+			}
+		}
+		rows.Close()
+	}
+	for key := range renamed {
+		platform, oldName, newName := key[0], key[1], key[2]
+		if err := renameProviderRecords(platform, oldName, newName); err != nil {
+			log.Printf("⚠️  同步 %s/%s → %s 的记录失败: %v", platform, oldName, newName, err)
+			continue
+		}
+		rememberProviderAlias(platform, oldName, newName)
+		log.Printf("🆔 %s/%s 已在配置文件中改名为 %s，历史记录已同步", platform, oldName, newName)
+		recordAudit("provider", "rename_sync", fmt.Sprintf("%s: %s → %s（按稳定 ID 同步）", platform, oldName, newName))
+	}
+
+	// 2. 为没有 uid 的旧记录补齐（已删除的 provider 的记录保持为空）
+	backfills := []struct {
+		table  string
+		column string
+	}{
+		{"request_log", "provider"},
+		{"provider_blacklist", "provider_name"},
+	}
+	for _, b := range backfills {
+		rows, err := db.Query(fmt.Sprintf(`SELECT DISTINCT platform, %s FROM %s WHERE COALESCE(provider_uid, '') = ''`, b.column, b.table))
+		if err != nil {
+			if !isNoSuchTableErr(err) {
+				log.Printf("⚠️  读取 %s 失败: %v", b.table, err)
+			}
+			continue
+		}
+		var pending []providerIdentity
+		for rows.Next() {
+			var platform, name string
+			if err := rows.Scan(&platform, &name); err == nil && byName[platform+"|"+name] != "" {
+				pending = append(pending, providerIdentity{platform: platform, uid: byName[platform+"|"+name], name: name})
+			}
+		}
+		rows.Close()
+		for _, id := range pending {
+			err := GlobalDBQueueShared.Exec(
+				fmt.Sprintf(`UPDATE %s SET provider_uid = ? WHERE platform = ? AND %s = ? AND COALESCE(provider_uid, '') = ''`, b.table, b.column),
+				id.uid, id.platform, id.name)
+			if err != nil {
+				log.Printf("⚠️  补齐 %s 的 provider_uid 失败: %v", b.table, err)
+				break
+			}
+		}
+	}
+}
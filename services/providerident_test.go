@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestProviderUIDs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	ps := NewProviderService()
+	providers := []Provider{
+		{ID: 1, Name: "a", APIURL: "https://api.anthropic.com", APIKey: "sk-a"},
+		{ID: 2, Name: "b", APIURL: "https://api.anthropic.com", APIKey: "sk-b", UID: "copied"},
+		{ID: 3, Name: "c", APIURL: "https://api.anthropic.com", APIKey: "sk-c", UID: "copied"},
+	}
+	if err := ps.SaveProviders("claude", providers); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := ps.LoadProviders("claude")
+	if saved[0].UID == "" || saved[1].UID != "copied" || saved[2].UID == "copied" || saved[2].UID == "" {
+		t.Fatalf("应为缺少或重复的 uid 分配新值: %+v", saved)
+	}
+	if got := providerUIDByName("claude", "a"); got != saved[0].UID {
+		t.Errorf("providerUIDByName() = %q", got)
+	}
+
+	// uid 在改名后保持不变
+	if err := ps.RenameProvider("claude", "a", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if got := providerUIDByName("claude", "renamed"); got != saved[0].UID {
+		t.Errorf("改名后 uid 应保持不变: %q", got)
+	}
+
+	saved[1].Name = saved[2].Name
+	if err := ps.SaveProviders("claude", saved); err == nil {
+		t.Error("同一平台内名称重复时应拒绝保存")
+	}
+	copied, err := ps.DuplicateProvider("claude", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ps.DuplicateProvider("claude", 3)
+	if err != nil {
+		t.Fatalf("重复复制同一 provider 时应生成不同的名称: %v", err)
+	}
+	if copied.Name == again.Name || copied.UID == "" || copied.UID == again.UID {
+		t.Errorf("副本应有不同的名称与 uid: %+v %+v", copied, again)
+	}
+}
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// 测试矩阵输出格式
+const (
+	MatrixFormatJSON  = "json"
+	MatrixFormatJUnit = "junit"
+)
+
+const (
+	matrixPromptsFileName = "matrix-prompts.json"
+	matrixCaseTimeout     = 60 * time.Second
+	matrixConcurrency     = 4
+	matrixResponsePreview = 200
+)
+
+// MatrixPrompt 金丝雀提示词：发送给每个 provider，并检查回复是否包含期望文本
+type MatrixPrompt struct {
+	Name      string `json:"name"`
+	Prompt    string `json:"prompt"`
+	Expect    string `json:"expect,omitempty"`    // 回复中应包含的文本（不区分大小写），为空时只要求返回非空文本
+	MaxTokens int    `json:"maxTokens,omitempty"` // 默认 32
+}
+
+// defaultMatrixPrompts 未配置 matrix-prompts.json 时使用的提示词
+var defaultMatrixPrompts = []MatrixPrompt{
+	{Name: "echo", Prompt: "Reply with exactly one word: pong", Expect: "pong"},
+	{Name: "arithmetic", Prompt: "What is 17 + 25? Answer with the number only.", Expect: "42"},
+	{Name: "chinese", Prompt: "中国的首都是哪座城市？只回答城市名。", Expect: "北京"},
+}
+
+// MatrixCaseResult 单个 provider × 提示词的测试结果
+type MatrixCaseResult struct {
+	Platform  string `json:"platform"`
+	Provider  string `json:"provider"`
+	Prompt    string `json:"prompt"`
+	Model     string `json:"model"`
+	Passed    bool   `json:"passed"`
+	HTTPCode  int    `json:"httpCode,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+	Response  string `json:"response,omitempty"` // 回复文本（截断）
+	Failure   string `json:"failure,omitempty"`
+}
+
+// ProviderMatrixReport 测试矩阵报告
+type ProviderMatrixReport struct {
+	StartedAt  time.Time          `json:"startedAt"`
+	DurationMs int64              `json:"durationMs"`
+	Total      int                `json:"total"`
+	Passed     int                `json:"passed"`
+	Failed     int                `json:"failed"`
+	Results    []MatrixCaseResult `json:"results"`
+}
+
+// LoadMatrixPrompts 读取 ~/.code-switch/matrix-prompts.json，不存在时使用内置提示词
+func LoadMatrixPrompts() ([]MatrixPrompt, error) {
+	return LoadMatrixPromptsFile(filepath.Join(getConfigDir(), matrixPromptsFileName))
+}
+
+// LoadMatrixPromptsFile 读取提示词文件（可由团队放在版本库中，通过 -prompts 指定）
+func LoadMatrixPromptsFile(path string) ([]MatrixPrompt, error) {
+	var prompts []MatrixPrompt
+	if err := ReadJSONFile(path, &prompts); err != nil {
+		if os.IsNotExist(err) {
+			return defaultMatrixPrompts, nil
+		}
+		return nil, fmt.Errorf("读取提示词文件失败: %w", err)
+	}
+	for i, prompt := range prompts {
+		if strings.TrimSpace(prompt.Prompt) == "" {
+			return nil, fmt.Errorf("第 %d 个提示词内容为空", i+1)
+		}
+		if prompt.Name == "" {
+			prompts[i].Name = fmt.Sprintf("prompt-%d", i+1)
+		}
+	}
+	if len(prompts) == 0 {
+		return defaultMatrixPrompts, nil
+	}
+	return prompts, nil
+}
+
+// RunProviderMatrix 用每个提示词测试每个已启用的 provider（claude、codex），返回测试报告
+// platforms 为空时测试全部平台
+func RunProviderMatrix(ctx context.Context, ps *ProviderService, platforms []string, prompts []MatrixPrompt) (*ProviderMatrixReport, error) {
+	if len(platforms) == 0 {
+		platforms = []string{"claude", "codex"}
+	}
+	if len(prompts) == 0 {
+		prompts = defaultMatrixPrompts
+	}
+
+	type matrixCase struct {
+		platform string
+		provider Provider
+		prompt   MatrixPrompt
+	}
+	var cases []matrixCase
+	for _, platform := range platforms {
+		if platform != "claude" && platform != "codex" {
+			return nil, fmt.Errorf("测试矩阵仅支持 claude、codex 平台: %s", platform)
+		}
+		providers, err := ps.LoadProviders(platform)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] 加载 provider 失败: %w", platform, err)
+		}
+		sortProvidersByLevel(providers)
+		for _, p := range providers {
+			if !p.Enabled || p.APIURL == "" || p.APIKey == "" {
+				continue
+			}
+			for _, prompt := range prompts {
+				cases = append(cases, matrixCase{platform: platform, provider: p, prompt: prompt})
+			}
+		}
+	}
+
+	report := &ProviderMatrixReport{StartedAt: time.Now(), Results: make([]MatrixCaseResult, len(cases))}
+	client := &http.Client{Timeout: matrixCaseTimeout, CheckRedirect: checkUpstreamRedirect}
+	sem := make(chan struct{}, matrixConcurrency)
+	var wg sync.WaitGroup
+	for i, c := range cases {
+		wg.Add(1)
+		go func(i int, c matrixCase) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			report.Results[i] = runMatrixCase(ctx, client, c.platform, c.provider, c.prompt)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, result := range report.Results {
+		report.Total++
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report, nil
+}
+
+// runMatrixCase 发送一次提示词请求并校验回复
+func runMatrixCase(ctx context.Context, client *http.Client, platform string, provider Provider, prompt MatrixPrompt) MatrixCaseResult {
+	model := matrixModel(platform, provider)
+	result := MatrixCaseResult{Platform: platform, Provider: provider.Name, Prompt: prompt.Name, Model: model}
+	maxTokens := prompt.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 32
+	}
+
+	if err := checkUpstreamURL(provider.APIURL); err != nil {
+		result.Failure = err.Error()
+		return result
+	}
+
+	var endpoint string
+	var payload map[string]any
+	switch platform {
+	case "claude":
+		endpoint = "/v1/messages"
+		payload = map[string]any{
+			"model":      model,
+			"max_tokens": maxTokens,
+			"messages":   []map[string]string{{"role": "user", "content": prompt.Prompt}},
+		}
+	default:
+		endpoint = "/responses"
+		payload = map[string]any{
+			"model":             model,
+			"max_output_tokens": maxTokens,
+			"input":             prompt.Prompt,
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		result.Failure = err.Error()
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, matrixCaseTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, joinURL(provider.APIURL, endpoint), bytes.NewReader(body))
+	if err != nil {
+		result.Failure = fmt.Sprintf("创建请求失败: %v", err)
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	if platform == "claude" {
+		req.Header.Set("anthropic-version", anthropicAPIVersion)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Failure = fmt.Sprintf("请求失败: %v", err)
+		return result
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	result.HTTPCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Failure = fmt.Sprintf("HTTP %d: %s", resp.StatusCode, truncateRunes(string(respBody), matrixResponsePreview))
+		return result
+	}
+
+	text := matrixResponseText(platform, respBody)
+	result.Response = truncateRunes(text, matrixResponsePreview)
+	switch {
+	case strings.TrimSpace(text) == "":
+		result.Failure = "回复为空"
+	case prompt.Expect != "" && !strings.Contains(strings.ToLower(text), strings.ToLower(prompt.Expect)):
+		result.Failure = fmt.Sprintf("回复中未包含 %q", prompt.Expect)
+	default:
+		result.Passed = true
+	}
+	return result
+}
+
+// matrixModel 选择测试模型：优先使用白名单中的第一个模型（按名称排序，保证多次运行一致）
+func matrixModel(platform string, provider Provider) string {
+	var models []string
+	for model, ok := range provider.SupportedModels {
+		if ok && !strings.Contains(model, "*") {
+			models = append(models, model)
+		}
+	}
+	if len(models) > 0 {
+		sort.Strings(models)
+		return models[0]
+	}
+	model := "gpt-4o-mini"
+	if platform == "claude" {
+		model = "claude-3-5-haiku-latest"
+	}
+	return provider.GetEffectiveModel(model)
+}
+
+// matrixResponseText 提取回复文本（Anthropic Messages / OpenAI Responses 格式）
+func matrixResponseText(platform string, body []byte) string {
+	var parts []string
+	if platform == "claude" {
+		gjson.GetBytes(body, "content").ForEach(func(_, block gjson.Result) bool {
+			if block.Get("type").String() == "text" {
+				parts = append(parts, block.Get("text").String())
+			}
+			return true
+		})
+		return strings.Join(parts, "")
+	}
+	if text := gjson.GetBytes(body, "output_text"); text.Exists() {
+		return text.String()
+	}
+	gjson.GetBytes(body, "output").ForEach(func(_, item gjson.Result) bool {
+		item.Get("content").ForEach(func(_, content gjson.Result) bool {
+			if text := content.Get("text"); text.Exists() {
+				parts = append(parts, text.String())
+			}
+			return true
+		})
+		return true
+	})
+	return strings.Join(parts, "")
+}
+
+// truncateRunes 按字符截断
+func truncateRunes(s string, max int) string {
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max]) + "..."
+	}
+	return s
+}
+
+// Encode 按格式输出报告：json 或 junit（JUnit XML，每个 provider 一个 testsuite）
+func (r *ProviderMatrixReport) Encode(format string) ([]byte, error) {
+	switch format {
+	case "", MatrixFormatJSON:
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case MatrixFormatJUnit:
+		return r.junitXML()
+	default:
+		return nil, validateMatrixFormat(format)
+	}
+}
+
+func validateMatrixFormat(format string) error {
+	switch format {
+	case "", MatrixFormatJSON, MatrixFormatJUnit:
+		return nil
+	default:
+		return fmt.Errorf("无效的输出格式: %s（可选值: json、junit）", format)
+	}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func junitSeconds(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+func (r *ProviderMatrixReport) junitXML() ([]byte, error) {
+	root := junitTestSuites{Name: "provider-matrix", Tests: r.Total, Failures: r.Failed, Time: junitSeconds(r.DurationMs)}
+	suiteIndex := map[string]int{}
+	suiteTime := map[string]int64{}
+	for _, result := range r.Results {
+		name := result.Platform + "/" + result.Provider
+		i, ok := suiteIndex[name]
+		if !ok {
+			i = len(root.Suites)
+			suiteIndex[name] = i
+			root.Suites = append(root.Suites, junitTestSuite{Name: name, Timestamp: r.StartedAt.Format("2006-01-02T15:04:05")})
+		}
+		suite := &root.Suites[i]
+		testCase := junitTestCase{
+			ClassName: result.Platform + "." + result.Provider,
+			Name:      result.Prompt,
+			Time:      junitSeconds(result.LatencyMs),
+			SystemOut: result.Response,
+		}
+		if !result.Passed {
+			testCase.Failure = &junitFailure{
+				Message: result.Failure,
+				Type:    "ProviderMatrixFailure",
+				Text:    fmt.Sprintf("model=%s httpCode=%d\n%s", result.Model, result.HTTPCode, result.Failure),
+			}
+			suite.Failures++
+		}
+		suite.Tests++
+		suiteTime[name] += result.LatencyMs
+		suite.Time = junitSeconds(suiteTime[name])
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	data, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// RunProviderMatrix 运行 provider 测试矩阵并按格式返回报告内容（供前端调用，json 或 junit）
+func (cts *ConnectivityTestService) RunProviderMatrix(format string) (string, error) {
+	if err := validateMatrixFormat(format); err != nil {
+		return "", err
+	}
+	prompts, err := LoadMatrixPrompts()
+	if err != nil {
+		return "", err
+	}
+	report, err := RunProviderMatrix(context.Background(), cts.providerService, nil, prompts)
+	if err != nil {
+		return "", err
+	}
+	data, err := report.Encode(format)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
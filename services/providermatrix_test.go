@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunProviderMatrix(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"content":[{"type":"text","text":"Pong"}]}`))
+	}))
+	defer server.Close()
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "good", APIURL: server.URL, APIKey: "k", Enabled: true},
+		{ID: 2, Name: "off", APIURL: server.URL, APIKey: "k"},
+	}); err != nil {
+		t.Fatalf("SaveProviders: %v", err)
+	}
+
+	prompts := []MatrixPrompt{{Name: "echo", Prompt: "ping", Expect: "pong"}, {Name: "math", Prompt: "1+1", Expect: "2"}}
+	report, err := RunProviderMatrix(context.Background(), ps, []string{"claude"}, prompts)
+	if err != nil {
+		t.Fatalf("RunProviderMatrix: %v", err)
+	}
+	if report.Total != 2 || report.Passed != 1 || report.Failed != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	data, err := report.Encode(MatrixFormatJUnit)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	xml := string(data)
+	for _, want := range []string{`<testsuite name="claude/good" tests="2" failures="1"`, `<testcase classname="claude.good" name="echo"`, `<failure message="回复中未包含 &#34;2&#34;"`} {
+		if !strings.Contains(xml, want) {
+			t.Errorf("junit output missing %q:\n%s", want, xml)
+		}
+	}
+	if _, err := report.Encode("yaml"); err == nil {
+		t.Error("unknown format should fail")
+	}
+}
@@ -11,9 +11,9 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/daodao97/xgo/xdb"
 	"github.com/daodao97/xgo/xrequest"
 	"github.com/gin-gonic/gin"
 	"github.com/tidwall/gjson"
@@ -34,9 +34,29 @@ type ProviderRelayService struct {
 	blacklistService    *BlacklistService
 	notificationService *NotificationService
 	server              *http.Server
+	serverMu            sync.RWMutex // 保护 server（启动自检等其他 goroutine 会读取）
 	addr                string
 	lastUsed            map[string]*LastUsedProvider // 各平台最后使用的供应商
 	lastUsedMu          sync.RWMutex                 // 保护 lastUsed 的锁
+	deduper             *requestDeduper              // 相同并发请求合并
+	budget              *budgetTracker               // 当日花费统计（预算降级）
+	networkMonitor      *NetworkMonitorService       // 网络监测（离线模式）
+	limiters            *providerLimiters            // provider 并发限制（按优先级排队）
+	authFailures        *authFailureTracker          // 连续 401 统计（密钥失效自动停用）
+	betaFlags           *betaFlagStats               // beta 请求头使用统计
+	chaos               *chaosInjector               // 故障注入（演练降级链路）
+	canary              *canaryController            // 灰度切换
+	cooldowns           *cooldownTracker             // 按 Retry-After 冷却的 provider
+	usageWindows        *usageWindowTracker          // Claude 订阅账号用量窗口
+	rateLimits          *rateLimitTracker            // 上游响应头中的组织级限额
+	hedges              *hedgeStats                  // 对冲请求统计
+	dryRun              *dryRunRecorder              // 试运行（选路但不转发）
+	tokenSpeed          *tokenSpeedFeed              // 流式响应实时生成速度
+	configWatchStop     chan struct{}                // 停止配置文件监视
+	haStop              chan struct{}                // 停止高可用同步
+	collectorStop       chan struct{}                // 停止多机汇总上报
+	editorToken         atomic.Value                 // 编辑器接口令牌（string，启用后生成）
+	socketPath          string                       // 正在监听的 Unix socket 路径（未启用时为空）
 }
 
 // errClientAbort 表示客户端中断连接，不应计入 provider 失败次数
@@ -50,7 +70,7 @@ func NewProviderRelayService(providerService *ProviderService, geminiService *Ge
 	// 【修复】数据库初始化已移至 main.go 的 InitDatabase()
 	// 此处不再调用 xdb.Inits()、ensureRequestLogTable()、ensureBlacklistTables()
 
-	return &ProviderRelayService{
+	prs := &ProviderRelayService{
 		providerService:     providerService,
 		geminiService:       geminiService,
 		blacklistService:    blacklistService,
@@ -61,19 +81,38 @@ func NewProviderRelayService(providerService *ProviderService, geminiService *Ge
 			"codex":  nil,
 			"gemini": nil,
 		},
+		deduper:      newRequestDeduper(),
+		budget:       newBudgetTracker(),
+		limiters:     newProviderLimiters(),
+		authFailures: newAuthFailureTracker(),
+		betaFlags:    newBetaFlagStats(),
+		chaos:        newChaosInjector(),
+		canary:       newCanaryController(),
+		cooldowns:    newCooldownTracker(),
+		usageWindows: newUsageWindowTracker(),
+		rateLimits:   newRateLimitTracker(),
+		hedges:       newHedgeStats(),
+		dryRun:       newDryRunRecorder(),
+		tokenSpeed:   newTokenSpeedFeed(notificationService),
 	}
+	if blacklistService != nil {
+		blacklistService.availableProviders = prs.availableProviderCount
+	}
+	return prs
 }
 
 // setLastUsedProvider 记录最后使用的供应商
 // @author sm
 func (prs *ProviderRelayService) setLastUsedProvider(platform, providerName string) {
 	prs.lastUsedMu.Lock()
-	defer prs.lastUsedMu.Unlock()
 	prs.lastUsed[platform] = &LastUsedProvider{
 		Platform:     platform,
 		ProviderName: providerName,
 		UpdatedAt:    time.Now().UnixMilli(),
 	}
+	prs.lastUsedMu.Unlock()
+	// 同时持久化为最近可用的 provider，切换失败时可回退
+	recordLastKnownGood(platform, providerName)
 }
 
 // GetLastUsedProvider 获取指定平台最后使用的供应商
@@ -97,6 +136,19 @@ func (prs *ProviderRelayService) GetAllLastUsedProviders() map[string]*LastUsedP
 }
 
 func (prs *ProviderRelayService) Start() error {
+	// 预热配置快照，转发请求不再逐次读取配置文件
+	prs.warmConfigCache()
+
+	// 高可用：与对端中继同步拉黑状态与当日花费（未配置对端时空转）
+	prs.haStop = make(chan struct{})
+	haStop := prs.haStop
+	go superviseLoop("relay.ha", haStop, func() { runHASync(haStop) })
+
+	// 多机汇总：定期向汇总服务上报用量与健康状态（未配置地址时空转）
+	prs.collectorStop = make(chan struct{})
+	collectorStop := prs.collectorStop
+	go superviseLoop("relay.collector", collectorStop, func() { prs.runCollectorPush(collectorStop) })
+
 	// 启动前验证配置
 	if warnings := prs.validateConfig(); len(warnings) > 0 {
 		fmt.Println("======== Provider 配置验证警告 ========")
@@ -107,17 +159,32 @@ func (prs *ProviderRelayService) Start() error {
 	}
 
 	router := gin.Default()
+	// 中继直接面向客户端，不信任任何代理头，c.ClientIP() 始终为连接对端地址
+	_ = router.SetTrustedProxies(nil)
+	router.Use(relayCrashRecovery())
+	router.Use(relayCORSMiddleware())
+	router.Use(relayActivityMiddleware())
 	prs.registerRoutes(router)
 
-	prs.server = &http.Server{
+	server := &http.Server{
 		Addr:    prs.addr,
 		Handler: router,
 	}
+	prs.serverMu.Lock()
+	prs.server = server
+	prs.serverMu.Unlock()
 
 	fmt.Printf("provider relay server listening on %s\n", prs.addr)
 
+	// 可选：同时在 Unix socket 上提供服务
+	if socketConfig := currentRelayConfig().Socket; socketConfig.Enabled {
+		if err := prs.listenRelaySocket(server, socketConfig); err != nil {
+			fmt.Printf("⚠️  中继 socket 未启用: %v\n", err)
+		}
+	}
+
 	go func() {
-		if err := prs.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			fmt.Printf("provider relay server error: %v\n", err)
 		}
 	}()
@@ -130,7 +197,7 @@ func (prs *ProviderRelayService) validateConfig() []string {
 	warnings := make([]string, 0)
 
 	for _, kind := range []string{"claude", "codex"} {
-		providers, err := prs.providerService.LoadProviders(kind)
+		providers, err := prs.providerService.snapshotProviders(kind)
 		if err != nil {
 			warnings = append(warnings, fmt.Sprintf("[%s] 加载配置失败: %v", kind, err))
 			continue
@@ -175,25 +242,68 @@ func (prs *ProviderRelayService) validateConfig() []string {
 }
 
 func (prs *ProviderRelayService) Stop() error {
-	if prs.server == nil {
+	if prs.configWatchStop != nil {
+		close(prs.configWatchStop)
+		prs.configWatchStop = nil
+	}
+	if prs.haStop != nil {
+		close(prs.haStop)
+		prs.haStop = nil
+	}
+	if prs.collectorStop != nil {
+		close(prs.collectorStop)
+		prs.collectorStop = nil
+	}
+	prs.serverMu.RLock()
+	server := prs.server
+	prs.serverMu.RUnlock()
+	if server == nil {
 		return nil
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	return prs.server.Shutdown(ctx)
+	defer prs.closeRelaySocket()
+	return server.Shutdown(ctx)
 }
 
 func (prs *ProviderRelayService) Addr() string {
 	return prs.addr
 }
 
+// started 中继 HTTP 服务是否已启动
+func (prs *ProviderRelayService) started() bool {
+	prs.serverMu.RLock()
+	defer prs.serverMu.RUnlock()
+	return prs.server != nil
+}
+
 func (prs *ProviderRelayService) registerRoutes(router gin.IRouter) {
 	router.POST("/v1/messages", prs.proxyHandler("claude", "/v1/messages"))
+	router.POST("/v1/messages/count_tokens", prs.countTokensHandler())
 	router.POST("/responses", prs.proxyHandler("codex", "/responses"))
 
+	// 嵌入请求单独选路（可使用更便宜的 provider），并按输入缓存向量
+	router.POST("/embeddings", prs.embeddingsHandler())
+	router.POST("/v1/embeddings", prs.embeddingsHandler())
+
 	// Gemini API 端点（使用专门的路径前缀避免与 Claude 冲突）
 	router.POST("/gemini/v1beta/*any", prs.geminiProxyHandler("/v1beta"))
 	router.POST("/gemini/v1/*any", prs.geminiProxyHandler("/v1"))
+
+	// 健康状态（局域网发现与高可用客户端选择中继时查询）
+	router.GET("/health", prs.healthHandler())
+	// 高可用：对端拉取拉黑状态与当日花费（需共享密钥）
+	router.GET("/ha/state", prs.haStateHandler())
+	// 多机汇总：接收其他实例上报的用量与健康状态（需共享密钥）
+	router.POST("/collector/push", prs.collectorPushHandler())
+	// 终端/IDE 状态栏（仅限本机）
+	router.GET("/statusline", prs.statusLineHandler())
+	// MCP 管理工具（仅限本机），供 Claude Code 等代理查询 provider 健康状态并请求切换
+	router.POST("/mcp", prs.mcpHandler())
+	router.GET("/mcp", func(c *gin.Context) { c.Status(http.StatusMethodNotAllowed) })
+
+	prs.registerAdminRoutes(router)
+	prs.registerEditorRoutes(router)
 }
 
 func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.HandlerFunc {
@@ -202,7 +312,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 		if c.Request.Body != nil {
 			data, err := io.ReadAll(c.Request.Body)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				respondRelayError(c, kind, http.StatusBadRequest, "invalid request body", nil)
 				return
 			}
 			bodyBytes = data
@@ -212,22 +322,80 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 		isStream := gjson.GetBytes(bodyBytes, "stream").Bool()
 		requestedModel := gjson.GetBytes(bodyBytes, "model").String()
 
+		// 预算紧张时自动降级到低价模型
+		bodyBytes, requestedModel = prs.applyBudgetDowngrade(kind, bodyBytes, requestedModel)
+
+		// 相同的并发非流式请求只转发一次
+		finishDedup, handled := prs.beginDedup(c, endpoint, isStream, bodyBytes)
+		if handled {
+			return
+		}
+		defer finishDedup()
+
+		// 路由规则：命中 reject 时直接拒绝，provider/exclude 在下面过滤候选
+		decision, handled := applyRoutingRules(c, kind, requestedModel, bodyBytes, isStream)
+		if handled {
+			return
+		}
+
 		// 如果未指定模型，记录警告但不拦截
 		if requestedModel == "" {
 			fmt.Printf("[WARN] 请求未指定模型名，无法执行模型智能降级\n")
 		}
 
-		providers, err := prs.providerService.LoadProviders(kind)
+		providers, err := prs.providerService.snapshotProviders(kind)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load providers"})
+			respondRelayError(c, kind, http.StatusInternalServerError, "failed to load providers", nil)
 			return
 		}
 
 		active := make([]Provider, 0, len(providers))
+		activeNames := make(map[string]bool, len(providers))
+		var cooling []Provider
 		skippedCount := 0
+		var guardrailViolations []string
 		for _, provider := range providers {
+			// 虚拟 provider：按模型名替换为路由目标，再走下面的常规过滤
+			if provider.isSplitProvider() {
+				if !provider.Enabled {
+					continue
+				}
+				target, err := resolveSplitRoute(provider, providers, requestedModel)
+				if err != nil {
+					fmt.Printf("[INFO] 🔀 虚拟 provider %s 已跳过: %v\n", provider.Name, err)
+					skippedCount++
+					continue
+				}
+				fmt.Printf("[INFO] 🔀 虚拟 provider %s 将模型 %s 分流到 %s\n", provider.Name, requestedModel, target.Name)
+				provider = target
+			}
+
+			// 同一个 provider 既单独启用又是分流目标时只尝试一次
+			if activeNames[provider.Name] {
+				continue
+			}
+
+			// 路由规则限定或排除的 provider
+			if !decision.allows(provider.Name) {
+				skippedCount++
+				continue
+			}
+
 			// 基础过滤：enabled、URL、APIKey
-			if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
+			if !provider.Enabled || (!provider.isMockProvider() && (provider.APIURL == "" || provider.APIKey == "")) {
+				continue
+			}
+
+			// 域名检查：管理员策略与域名允许/拒绝列表之外的 provider 不参与转发（模拟 provider 不访问网络）
+			if err := checkUpstreamURL(provider.APIURL); err != nil && !provider.isMockProvider() {
+				fmt.Printf("[INFO] 🔒 Provider %s 已跳过: %v\n", provider.Name, err)
+				continue
+			}
+
+			// 密钥失效停用：更换 API Key 前不参与转发
+			if provider.IsAuthDisabled() {
+				fmt.Printf("[INFO] 🔑 Provider %s 的 API Key 已失效，已跳过\n", provider.Name)
+				skippedCount++
 				continue
 			}
 
@@ -252,26 +420,88 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				continue
 			}
 
+			// 请求体积护栏：无法满足限制的 provider 直接跳过
+			if _, violation := applyGuardrails(provider, kind, bodyBytes); violation != "" {
+				fmt.Printf("[WARN] 🛑 %s，已跳过\n", violation)
+				guardrailViolations = append(guardrailViolations, violation)
+				skippedCount++
+				continue
+			}
+
+			// 限流冷却：按上游 Retry-After 暂停转发
+			if wait := prs.cooldowns.remaining(kind, provider.Name, time.Now()); wait > 0 {
+				fmt.Printf("[INFO] ⏳ Provider %s 限流冷却中，剩余 %ds\n", provider.Name, retryAfterSeconds(wait))
+				cooling = append(cooling, provider)
+				activeNames[provider.Name] = true
+				skippedCount++
+				continue
+			}
+
 			active = append(active, provider)
+			activeNames[provider.Name] = true
+		}
+
+		// 所有候选都在限流冷却：等待最早恢复的 provider，或让客户端稍后重试
+		if len(active) == 0 && len(cooling) > 0 && !prs.isOffline() {
+			names := make([]string, len(cooling))
+			for i, provider := range cooling {
+				names[i] = provider.Name
+			}
+			idx, wait := prs.cooldowns.shortest(kind, names, time.Now())
+			if !waitCooldown(c, kind, cooling[idx].Name, wait) {
+				return
+			}
+			prs.cooldowns.clear(kind, cooling[idx].Name)
+			active = append(active, cooling[idx])
+		}
+
+		// 离线模式：只保留本地 provider，没有则立即返回，避免请求耗尽超时
+		if prs.isOffline() {
+			local := make([]Provider, 0, len(active))
+			for _, provider := range active {
+				if isLocalEndpoint(provider.APIURL) || provider.isMockProvider() {
+					local = append(local, provider)
+				}
+			}
+			if len(local) == 0 {
+				respondOffline(c, kind)
+				return
+			}
+			active = local
 		}
 
 		if len(active) == 0 {
+			if decision.restricts() {
+				respondRelayError(c, kind, http.StatusServiceUnavailable,
+					fmt.Sprintf("路由规则 %s 指定的 provider 均不可用: %s", decision.rule, strings.Join(decision.args, ", ")), nil)
+				return
+			}
+			if len(guardrailViolations) > 0 {
+				respondRelayError(c, kind, http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("请求超出 provider 的体积限制，已拒绝: %s", strings.Join(guardrailViolations, "; ")), nil)
+				return
+			}
 			if requestedModel != "" {
-				c.JSON(http.StatusNotFound, gin.H{
-					"error": fmt.Sprintf("没有可用的 provider 支持模型 '%s'（已跳过 %d 个不兼容的 provider）", requestedModel, skippedCount),
-				})
+				respondRelayError(c, kind, http.StatusNotFound,
+					fmt.Sprintf("没有可用的 provider 支持模型 '%s'（已跳过 %d 个不兼容的 provider）", requestedModel, skippedCount), nil)
 			} else {
-				c.JSON(http.StatusNotFound, gin.H{"error": "no providers available"})
+				respondRelayError(c, kind, http.StatusNotFound, "no providers available", nil)
 			}
 			return
 		}
 
+		// 额度将尽：剩余请求数/Token 数接近上游限额的 provider 让位给其他 provider
+		active = prs.rateLimits.avoidNearLimit(kind, active, time.Now())
+
 		fmt.Printf("[INFO] 找到 %d 个可用的 provider（已过滤 %d 个）：", len(active), skippedCount)
 		for _, p := range active {
 			fmt.Printf("%s ", p.Name)
 		}
 		fmt.Println()
 
+		// 灰度切换：按比例决定本次请求优先使用新 provider 还是原 provider
+		active = prs.applyCanary(kind, active)
+
 		// 按 Level 分组
 		levelGroups := make(map[int][]Provider)
 		for _, provider := range active {
@@ -281,6 +511,10 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			}
 			levelGroups[level] = append(levelGroups[level], provider)
 		}
+		// 同一 Level 内按模型权重排序（负载分配与降级顺序）
+		for level, group := range levelGroups {
+			levelGroups[level] = orderProvidersByWeight(kind, requestedModel, group)
+		}
 
 		// 获取所有 level 并升序排序
 		levels := make([]int, 0, len(levelGroups))
@@ -293,6 +527,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 		query := flattenQuery(c.Request.URL.Query())
 		clientHeaders := cloneHeaders(c.Request.Header)
+		stripRelayHeaders(clientHeaders)
 
 		// 获取拉黑功能开关状态
 		blacklistEnabled := prs.blacklistService.IsLevelBlacklistEnabled()
@@ -315,7 +550,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			}
 
 			if firstProvider == nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "no providers available"})
+				respondRelayError(c, kind, http.StatusNotFound, "no providers available", nil)
 				return
 			}
 
@@ -326,7 +561,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				fmt.Printf("[INFO] Provider %s 映射模型: %s -> %s\n", firstProvider.Name, requestedModel, effectiveModel)
 				modifiedBody, err := ReplaceModelInRequestBody(bodyBytes, effectiveModel)
 				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("模型映射失败: %v", err)})
+					respondRelayError(c, kind, http.StatusInternalServerError, fmt.Sprintf("模型映射失败: %v", err), nil)
 					return
 				}
 				currentBodyBytes = modifiedBody
@@ -336,7 +571,17 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 			startTime := time.Now()
 			ok, err := prs.forwardRequest(c, kind, *firstProvider, endpoint, query, clientHeaders, currentBodyBytes, isStream, effectiveModel)
+			// 限流且等待时间较短：不降级的模式下原地等待后重试一次
+			var rateLimited *retryAfterError
+			if !ok && errors.As(err, &rateLimited) && waitCooldownShort(c, rateLimited.wait) {
+				prs.cooldowns.clear(kind, firstProvider.Name)
+				ok, err = prs.forwardRequest(c, kind, *firstProvider, endpoint, query, clientHeaders, currentBodyBytes, isStream, effectiveModel)
+			}
 			duration := time.Since(startTime)
+			if hookRejected(c) {
+				return
+			}
+			prs.observeCanary(kind, firstProvider.Name, ok, err)
 
 			if ok {
 				fmt.Printf("[INFO] ✓ 成功: %s | 耗时: %.2fs\n", firstProvider.Name, duration.Seconds())
@@ -356,15 +601,17 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			fmt.Printf("[WARN] ✗ 失败: %s | 错误: %s | 耗时: %.2fs（拉黑模式，不降级）\n",
 				firstProvider.Name, errorMsg, duration.Seconds())
 
-			// 客户端中断不计入失败次数
-			if errors.Is(err, errClientAbort) {
-				fmt.Printf("[INFO] 客户端中断，跳过失败计数: %s\n", firstProvider.Name)
+			// 客户端中断不计入失败次数；上游限流按 Retry-After 冷却，同样不计入
+			if errors.Is(err, errClientAbort) || errors.Is(err, errQueueTimeout) {
+				fmt.Printf("[INFO] 客户端中断或排队超时，跳过失败计数: %s\n", firstProvider.Name)
+			} else if errors.As(err, &rateLimited) {
+				respondRateLimited(c, kind, rateLimited.wait, fmt.Sprintf("Provider %s 被上游限流，%ds 后可重试（拉黑模式，不自动降级）", firstProvider.Name, retryAfterSeconds(rateLimited.wait)))
+				return
 			} else if err := prs.blacklistService.RecordFailure(kind, firstProvider.Name); err != nil {
 				fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
 			}
 
-			c.JSON(http.StatusBadGateway, gin.H{
-				"error":    fmt.Sprintf("Provider %s 请求失败: %s", firstProvider.Name, errorMsg),
+			respondRelayError(c, kind, http.StatusBadGateway, fmt.Sprintf("Provider %s 请求失败: %s", firstProvider.Name, errorMsg), gin.H{
 				"provider": firstProvider.Name,
 				"level":    firstLevel,
 				"duration": fmt.Sprintf("%.2fs", duration.Seconds()),
@@ -381,12 +628,21 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 		var lastProvider string
 		var lastDuration time.Duration
 		totalAttempts := 0
+		otherFailures := 0              // 非限流的失败次数
+		var rateLimitWait time.Duration // 被限流的 provider 中最短的等待时间
+		var attempts []string           // 各 provider 的失败原因，返回给客户端
+		raceAfter, hedged := raceDelay(requestLatencyBudget(c, decision), decision)
+		tried := make(map[string]bool) // 已尝试（包括参与过竞速）的 provider
 
 		for _, level := range levels {
 			providersInLevel := levelGroups[level]
 			fmt.Printf("[INFO] === 尝试 Level %d（%d 个 provider）===\n", level, len(providersInLevel))
 
 			for i, provider := range providersInLevel {
+				if tried[provider.Name] {
+					continue
+				}
+				tried[provider.Name] = true
 				totalAttempts++
 
 				// 获取实际应该使用的模型名
@@ -408,10 +664,32 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 				fmt.Printf("[INFO]   [%d/%d] Provider: %s | Model: %s\n", i+1, len(providersInLevel), provider.Name, effectiveModel)
 
-				// 尝试发送请求
+				// 尝试发送请求；有延迟预算或对冲规则时，超时仍未响应则与下一个 provider 竞速
 				startTime := time.Now()
-				ok, err := prs.forwardRequest(c, kind, provider, endpoint, query, clientHeaders, currentBodyBytes, isStream, effectiveModel)
+				var ok bool
+				var err error
+				if backup := nextCandidate(levels, levelGroups, level, i, tried); raceAfter > 0 && backup != nil {
+					var raced *raceResult
+					provider, raced, ok, err = prs.forwardWithBudget(c, kind, endpoint, query, clientHeaders, isStream, requestedModel, bodyBytes,
+						raceCandidate{provider: provider, model: effectiveModel, body: currentBodyBytes}, *backup, raceAfter)
+					if hedged {
+						prs.hedges.observe(kind, decision.rule, raced, provider.Name, ok)
+					}
+					if raced != nil {
+						tried[backup.Name] = true
+						totalAttempts++
+						if failure := prs.recordRaceFailure(kind, raced); failure != "" {
+							attempts = append(attempts, failure)
+						}
+					}
+				} else {
+					ok, err = prs.forwardRequest(c, kind, provider, endpoint, query, clientHeaders, currentBodyBytes, isStream, effectiveModel)
+				}
 				duration := time.Since(startTime)
+				if hookRejected(c) {
+					return
+				}
+				prs.observeCanary(kind, provider.Name, ok, err)
 
 				if ok {
 					fmt.Printf("[INFO]   ✓ Level %d 成功: %s | 耗时: %.2fs\n", level, provider.Name, duration.Seconds())
@@ -439,29 +717,39 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				fmt.Printf("[WARN]   ✗ Level %d 失败: %s | 错误: %s | 耗时: %.2fs\n",
 					level, provider.Name, errorMsg, duration.Seconds())
 
-				// 客户端中断不计入失败次数
-				if errors.Is(err, errClientAbort) {
-					fmt.Printf("[INFO] 客户端中断，跳过失败计数: %s\n", provider.Name)
-				} else if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
-					fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
+				// 客户端中断不计入失败次数；上游限流按 Retry-After 冷却并转给下一个 provider，同样不计入
+				var rateLimited *retryAfterError
+				if errors.Is(err, errClientAbort) || errors.Is(err, errQueueTimeout) {
+					otherFailures++
+					fmt.Printf("[INFO] 客户端中断或排队超时，跳过失败计数: %s\n", provider.Name)
+				} else if errors.As(err, &rateLimited) {
+					rateLimitWait = minPositiveDuration(rateLimitWait, rateLimited.wait)
+				} else {
+					otherFailures++
+					if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
+						fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
+					}
 				}
-
-				// 发送切换通知：检查是否有下一个可用的 provider
-				if prs.notificationService != nil {
-					nextProvider := ""
-					// 先查找同级别的下一个
-					if i+1 < len(providersInLevel) {
-						nextProvider = providersInLevel[i+1].Name
-					} else {
-						// 查找下一个 level 的第一个 provider
-						for _, nextLevel := range levels {
-							if nextLevel > level && len(levelGroups[nextLevel]) > 0 {
-								nextProvider = levelGroups[nextLevel][0].Name
-								break
-							}
+				attempts = append(attempts, describeAttemptFailure(provider.Name, err))
+
+				// 记录切换事件并发送切换通知：检查是否有下一个可用的 provider
+				nextProvider := ""
+				// 先查找同级别的下一个
+				if i+1 < len(providersInLevel) {
+					nextProvider = providersInLevel[i+1].Name
+				} else {
+					// 查找下一个 level 的第一个 provider
+					for _, nextLevel := range levels {
+						if nextLevel > level && len(levelGroups[nextLevel]) > 0 {
+							nextProvider = levelGroups[nextLevel][0].Name
+							break
 						}
 					}
-					if nextProvider != "" {
+				}
+				if nextProvider != "" {
+					recordProviderEvent(kind, provider.Name, TimelineSwitch, nextProvider,
+						fmt.Sprintf("切换到 %s: %s", nextProvider, truncateAttemptError(errorMsg)))
+					if prs.notificationService != nil {
 						prs.notificationService.NotifyProviderSwitch(SwitchNotification{
 							FromProvider: provider.Name,
 							ToProvider:   nextProvider,
@@ -483,10 +771,15 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 		fmt.Printf("[ERROR] 所有 %d 个 provider 均失败，最后尝试: %s | 错误: %s\n",
 			totalAttempts, lastProvider, errorMsg)
 
-		c.JSON(http.StatusBadGateway, gin.H{
-			"error":         fmt.Sprintf("所有 %d 个 provider 均失败，最后错误: %s", totalAttempts, errorMsg),
-			"last_provider": lastProvider,
-			"last_duration": fmt.Sprintf("%.2fs", lastDuration.Seconds()),
+		// 全部因限流失败：让客户端按最短的 Retry-After 重试
+		if otherFailures == 0 && rateLimitWait > 0 {
+			respondRateLimited(c, kind, rateLimitWait, fmt.Sprintf("所有 %d 个 provider 均被上游限流: %s", totalAttempts, strings.Join(attempts, " → ")))
+			return
+		}
+
+		respondRelayError(c, kind, http.StatusBadGateway, fmt.Sprintf("所有 %d 个 provider 均失败: %s", totalAttempts, strings.Join(attempts, " → ")), gin.H{
+			"last_provider":  lastProvider,
+			"last_duration":  fmt.Sprintf("%.2fs", lastDuration.Seconds()),
 			"total_attempts": totalAttempts,
 		})
 	}
@@ -502,60 +795,102 @@ func (prs *ProviderRelayService) forwardRequest(
 	bodyBytes []byte,
 	isStream bool,
 	model string,
-) (bool, error) {
+) (_ bool, forwardErr error) {
+	// 按 provider 护栏截断超长对话（超限请求已在筛选阶段跳过）
+	bodyBytes, _ = applyGuardrails(provider, kind, bodyBytes)
+
+	// 并发名额已满时按优先级排队
+	releaseSlot, err := prs.acquireProviderSlot(c, kind, provider)
+	if err != nil {
+		return false, err
+	}
+	defer releaseSlot()
+
 	targetURL := joinURL(provider.APIURL, endpoint)
 	headers := cloneMap(clientHeaders)
 	headers["Authorization"] = fmt.Sprintf("Bearer %s", provider.APIKey)
 	if _, ok := headers["Accept"]; !ok {
 		headers["Accept"] = "application/json"
 	}
+	betaApplied := applyBetaFlags(kind, provider, headers)
+
+	// 转发前钩子：可修改请求头与请求体，或拒绝请求
+	bodyBytes, reject, err := runPreRequestHooks(c.Request.Context(), currentRelayConfig().Hooks, kind, provider.Name, model, targetURL, headers, bodyBytes)
+	if reject != nil || err != nil {
+		rejectByHook(c, kind, reject, err)
+		return false, fmt.Errorf("请求被钩子拒绝")
+	}
 
 	requestLog := &ReqeustLog{
-		Platform: kind,
-		Provider: provider.Name,
-		Model:    model,
-		IsStream: isStream,
+		Platform:    kind,
+		Provider:    provider.Name,
+		ProviderUID: provider.UID,
+		Model:       model,
+		IsStream:    isStream,
+		Project:     requestProject(c),
+		transcript:  newTranscriptRecorder(kind, bodyBytes),
 	}
+	requestLog.Client, requestLog.clientProcess = identifyClient(c)
+	retries := beginAttempt(c)
 	start := time.Now()
 	defer func() {
-		requestLog.DurationSec = time.Since(start).Seconds()
-
-		// 【修复】判空保护：避免队列未初始化时 panic
-		if GlobalDBQueueLogs == nil {
-			fmt.Printf("⚠️  写入 request_log 失败: 队列未初始化\n")
+		if requestLog.dryRun {
 			return
 		}
+		requestLog.DurationSec = time.Since(start).Seconds()
+		// 竞速中被取消的请求：上游已按输入收费，按估算的输入 token 记账
+		if requestLog.InputTokens == 0 && raceLost(c) {
+			requestLog.InputTokens = estimatePromptTokens(bodyBytes)
+		}
+		prs.betaFlags.observe(kind, provider.Name, betaApplied, requestLog.HttpCode >= http.StatusOK && requestLog.HttpCode < http.StatusMultipleChoices)
 
-		// 使用批量队列写入 request_log（高频同构操作，批量提交）
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		err := GlobalDBQueueLogs.ExecBatchCtx(ctx, `
-			INSERT INTO request_log (
-				platform, model, provider, http_code,
-				input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
-				reasoning_tokens, is_stream, duration_sec
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`,
-			requestLog.Platform,
-			requestLog.Model,
-			requestLog.Provider,
-			requestLog.HttpCode,
-			requestLog.InputTokens,
-			requestLog.OutputTokens,
-			requestLog.CacheCreateTokens,
-			requestLog.CacheReadTokens,
-			requestLog.ReasoningTokens,
-			boolToInt(requestLog.IsStream),
-			requestLog.DurationSec,
-		)
-
-		if err != nil {
+		if err := saveRequestLog(requestLog); err != nil {
 			fmt.Printf("写入 request_log 失败: %v\n", err)
 		}
+
+		if requestLog.HttpCode >= http.StatusOK && requestLog.HttpCode < http.StatusMultipleChoices {
+			requestLog.transcript.save(requestLog)
+		}
+		runPostResponseHooks(kind, requestLog, errorString(forwardErr))
 	}()
 
+	// 故障注入：模拟上游故障，走与真实失败相同的处理流程
+	if rule := prs.chaos.pick(kind, provider.Name, time.Now()); rule != nil {
+		status, err := rule.inject(c.Request.Context())
+		requestLog.HttpCode = status
+		fmt.Printf("[CHAOS] ⚡ 向 %s 注入故障 %s: %v\n", provider.Name, rule.Fault, err)
+		prs.trackAuthStatus(kind, provider, status)
+		return false, err
+	}
+
+	// 试运行：选路与请求改写已完成，记录后返回模拟响应，不转发到上游
+	if prs.isDryRun(c) {
+		requestLog.dryRun = true
+		prs.simulateRequest(c, dryRunRequest{
+			kind:     kind,
+			provider: provider.Name,
+			model:    model,
+			url:      targetURL,
+			headers:  headers,
+			body:     prs.injectThinkingIfNeeded(bodyBytes, provider.APIURL),
+			stream:   isStream,
+			attempt:  retries,
+		}, start)
+		return true, nil
+	}
+
+	// 模拟 provider：不访问网络，按配置返回模拟响应或故障
+	if provider.Mock != nil {
+		status, err := prs.serveMock(c, kind, provider.Name, *provider.Mock, model, bodyBytes, isStream, start, retries)
+		requestLog.HttpCode = status
+		requestLog.FirstByteSec = time.Since(start).Seconds()
+		prs.trackAuthStatus(kind, provider, status)
+		return err == nil, err
+	}
+
 	req := xrequest.New().
+		WithContext(c.Request.Context()).
+		SetClient(prs.upstreamClientFor(kind, provider)).
 		SetHeaders(headers).
 		SetQueryParams(query).
 		SetRetry(1, 500*time.Millisecond).
@@ -573,9 +908,23 @@ func (prs *ProviderRelayService) forwardRequest(
 	// 无论成功失败，先尝试记录 HttpCode
 	if resp != nil {
 		requestLog.HttpCode = resp.StatusCode()
+		requestLog.FirstByteSec = time.Since(start).Seconds()
+		prs.rateLimits.observe(kind, provider, resp.Headers(), time.Now())
+		wait, ok := prs.observeUsageWindow(kind, provider.Name, requestLog.HttpCode, resp.Headers())
+		if !ok {
+			wait, ok = prs.observeRetryAfter(kind, provider.Name, requestLog.HttpCode, resp.Headers())
+		}
+		if ok {
+			prs.trackAuthStatus(kind, provider, requestLog.HttpCode)
+			return false, &retryAfterError{status: requestLog.HttpCode, wait: wait}
+		}
 	}
 
 	if err != nil {
+		// 客户端断开（或竞速中落后被取消）时上游请求随之取消，不计入失败
+		if c.Request.Context().Err() != nil {
+			return false, fmt.Errorf("%w: %v", errClientAbort, err)
+		}
 		// resp 存在但 err != nil：可能是客户端中断，不计入失败
 		if resp != nil && requestLog.HttpCode == 0 {
 			fmt.Printf("[INFO] Provider %s 响应存在但状态码为0，判定为客户端中断\n", provider.Name)
@@ -589,6 +938,7 @@ func (prs *ProviderRelayService) forwardRequest(
 	}
 
 	status := requestLog.HttpCode
+	prs.trackAuthStatus(kind, provider, status)
 
 	if resp.Error() != nil {
 		// resp 存在、有错误、但状态码为 0：客户端中断，不计入失败
@@ -602,6 +952,7 @@ func (prs *ProviderRelayService) forwardRequest(
 	// 状态码为 0 且无错误：当作成功处理
 	if status == 0 {
 		fmt.Printf("[WARN] Provider %s 返回状态码 0，但无错误，当作成功处理\n", provider.Name)
+		setAttributionHeaders(c, provider.Name, time.Since(start), retries)
 		_, copyErr := resp.ToHttpResponseWriter(c.Writer, ReqeustLogHook(c, kind, requestLog))
 		if copyErr != nil {
 			fmt.Printf("[WARN] 复制响应到客户端失败（不影响provider成功判定）: %v\n", copyErr)
@@ -610,7 +961,12 @@ func (prs *ProviderRelayService) forwardRequest(
 	}
 
 	if status >= http.StatusOK && status < http.StatusMultipleChoices {
+		setAttributionHeaders(c, provider.Name, time.Since(start), retries)
+		if isStream {
+			requestLog.speed = prs.tokenSpeed.begin(kind, provider.Name, requestLog.Model)
+		}
 		_, copyErr := resp.ToHttpResponseWriter(c.Writer, ReqeustLogHook(c, kind, requestLog))
+		requestLog.speed.finish(requestLog.OutputTokens)
 		if copyErr != nil {
 			fmt.Printf("[WARN] 复制响应到客户端失败（不影响provider成功判定）: %v\n", copyErr)
 		}
@@ -621,6 +977,52 @@ func (prs *ProviderRelayService) forwardRequest(
 	return false, fmt.Errorf("upstream status %d", status)
 }
 
+// saveRequestLog 使用批量队列写入 request_log（高频同构操作，批量提交）
+func saveRequestLog(requestLog *ReqeustLog) error {
+	// 【修复】判空保护：避免队列未初始化时 panic
+	if GlobalDBQueueLogs == nil {
+		return fmt.Errorf("队列未初始化")
+	}
+
+	if requestLog.ClientProcess == "" {
+		requestLog.ClientProcess = requestLog.clientProcess.get()
+	}
+	// 未通过请求头标记项目时按进程映射归属项目
+	if requestLog.Project == "" {
+		requestLog.Project = processProject(currentRelayConfig().Client.ProjectByProcess, requestLog.ClientProcess)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return GlobalDBQueueLogs.ExecBatchCtx(ctx, `
+		INSERT INTO request_log (
+			platform, model, provider, http_code,
+			input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
+			reasoning_tokens, is_stream, duration_sec, first_byte_sec, project,
+			client, client_process, provider_uid, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		requestLog.Platform,
+		requestLog.Model,
+		canonicalProviderName(requestLog.Platform, requestLog.Provider),
+		requestLog.HttpCode,
+		requestLog.InputTokens,
+		requestLog.OutputTokens,
+		requestLog.CacheCreateTokens,
+		requestLog.CacheReadTokens,
+		requestLog.ReasoningTokens,
+		boolToInt(requestLog.IsStream),
+		requestLog.DurationSec,
+		requestLog.FirstByteSec,
+		maskForStorage(requestLog.Project),
+		maskForStorage(requestLog.Client),
+		maskForStorage(requestLog.ClientProcess),
+		requestLogProviderUID(requestLog),
+		epochNow(),
+	)
+}
+
 func cloneHeaders(header http.Header) map[string]string {
 	cloned := make(map[string]string, len(header))
 	for key, values := range header {
@@ -662,14 +1064,13 @@ func boolToInt(b bool) int {
 	return 0
 }
 
-func ensureRequestLogColumn(db *sql.DB, column string, definition string) error {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('request_log') WHERE name = '%s'", column)
-	var count int
-	if err := db.QueryRow(query).Scan(&count); err != nil {
+func ensureRequestLogColumn(db *sql.DB, dialect storageDialect, column string, definition string) error {
+	exists, err := dialect.ColumnExists(db, "request_log", column)
+	if err != nil {
 		return err
 	}
-	if count == 0 {
-		alter := fmt.Sprintf("ALTER TABLE request_log ADD COLUMN %s %s", column, definition)
+	if !exists {
+		alter := dialect.DDL(fmt.Sprintf("ALTER TABLE request_log ADD COLUMN %s %s", column, definition))
 		if _, err := db.Exec(alter); err != nil {
 			return err
 		}
@@ -678,14 +1079,14 @@ func ensureRequestLogColumn(db *sql.DB, column string, definition string) error
 }
 
 func ensureRequestLogTable() error {
-	db, err := xdb.DB("default")
+	db, err := sharedDB()
 	if err != nil {
 		return err
 	}
-	return ensureRequestLogTableWithDB(db)
+	return ensureRequestLogTableWithDB(db, sharedDialect())
 }
 
-func ensureRequestLogTableWithDB(db *sql.DB) error {
+func ensureRequestLogTableWithDB(db *sql.DB, dialect storageDialect) error {
 	const createTableSQL = `CREATE TABLE IF NOT EXISTS request_log (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		platform TEXT,
@@ -699,20 +1100,35 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 		reasoning_tokens INTEGER,
 		is_stream INTEGER DEFAULT 0,
 		duration_sec REAL DEFAULT 0,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		created_at BIGINT
 	)`
 
-	if _, err := db.Exec(createTableSQL); err != nil {
+	if _, err := db.Exec(dialect.DDL(createTableSQL)); err != nil {
 		return err
 	}
 
-	if err := ensureRequestLogColumn(db, "created_at", "DATETIME DEFAULT CURRENT_TIMESTAMP"); err != nil {
+	if err := ensureRequestLogColumn(db, dialect, "created_at", "BIGINT"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, dialect, "is_stream", "INTEGER DEFAULT 0"); err != nil {
 		return err
 	}
-	if err := ensureRequestLogColumn(db, "is_stream", "INTEGER DEFAULT 0"); err != nil {
+	if err := ensureRequestLogColumn(db, dialect, "duration_sec", "REAL DEFAULT 0"); err != nil {
 		return err
 	}
-	if err := ensureRequestLogColumn(db, "duration_sec", "REAL DEFAULT 0"); err != nil {
+	if err := ensureRequestLogColumn(db, dialect, "project", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, dialect, "client", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, dialect, "client_process", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, dialect, "first_byte_sec", "REAL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, dialect, "provider_uid", "TEXT DEFAULT ''"); err != nil {
 		return err
 	}
 
@@ -731,6 +1147,8 @@ func ReqeustLogHook(c *gin.Context, kind string, usage *ReqeustLog) func(data []
 			parserFn = GeminiParseTokenUsageFromResponse
 		}
 		parseEventPayload(payload, parserFn, usage)
+		usage.transcript.observe(payload)
+		usage.speed.observe(payload)
 
 		return true, data
 	}
@@ -747,28 +1165,41 @@ func parseEventPayload(payload string, parser func(string, *ReqeustLog), usage *
 }
 
 type ReqeustLog struct {
-	ID                int64   `json:"id"`
-	Platform          string  `json:"platform"` // claude、codex 或 gemini
-	Model             string  `json:"model"`
-	Provider          string  `json:"provider"` // provider name
-	HttpCode          int     `json:"http_code"`
-	InputTokens       int     `json:"input_tokens"`
-	OutputTokens      int     `json:"output_tokens"`
-	CacheCreateTokens int     `json:"cache_create_tokens"`
-	CacheReadTokens   int     `json:"cache_read_tokens"`
-	ReasoningTokens   int     `json:"reasoning_tokens"`
-	IsStream          bool    `json:"is_stream"`
-	DurationSec       float64 `json:"duration_sec"`
-	CreatedAt         string  `json:"created_at"`
-	InputCost         float64 `json:"input_cost"`
-	OutputCost        float64 `json:"output_cost"`
-	ReasoningCost     float64 `json:"reasoning_cost"`
-	CacheCreateCost   float64 `json:"cache_create_cost"`
-	CacheReadCost     float64 `json:"cache_read_cost"`
-	Ephemeral5mCost   float64 `json:"ephemeral_5m_cost"`
-	Ephemeral1hCost   float64 `json:"ephemeral_1h_cost"`
-	TotalCost         float64 `json:"total_cost"`
-	HasPricing        bool    `json:"has_pricing"`
+	ID                int64    `json:"id"`
+	Platform          string   `json:"platform"` // claude、codex 或 gemini
+	Model             string   `json:"model"`
+	Provider          string   `json:"provider"`               // provider name
+	ProviderUID       string   `json:"provider_uid,omitempty"` // provider 稳定 ID（gemini 为 provider ID）
+	HttpCode          int      `json:"http_code"`
+	InputTokens       int      `json:"input_tokens"`
+	OutputTokens      int      `json:"output_tokens"`
+	CacheCreateTokens int      `json:"cache_create_tokens"`
+	CacheReadTokens   int      `json:"cache_read_tokens"`
+	ReasoningTokens   int      `json:"reasoning_tokens"`
+	IsStream          bool     `json:"is_stream"`
+	DurationSec       float64  `json:"duration_sec"`
+	FirstByteSec      float64  `json:"first_byte_sec"` // 收到上游响应头的耗时（近似首 token 时间）
+	Project           string   `json:"project"`        // X-CodeSwitch-Project 请求头标记的项目，未标记时按进程映射
+	Client            string   `json:"client"`         // 发起请求的工具（按 User-Agent 识别）
+	ClientProcess     string   `json:"client_process"` // 发起请求的本机进程名（可选）
+	CreatedAt         string   `json:"created_at"`
+	InputCost         float64  `json:"input_cost"`
+	OutputCost        float64  `json:"output_cost"`
+	ReasoningCost     float64  `json:"reasoning_cost"`
+	CacheCreateCost   float64  `json:"cache_create_cost"`
+	CacheReadCost     float64  `json:"cache_read_cost"`
+	Ephemeral5mCost   float64  `json:"ephemeral_5m_cost"`
+	Ephemeral1hCost   float64  `json:"ephemeral_1h_cost"`
+	TotalCost         float64  `json:"total_cost"`
+	HasPricing        bool     `json:"has_pricing"`
+	Feedback          int      `json:"feedback"`       // 用户反馈：1 好评，-1 差评，0 未评价
+	Note              string   `json:"note,omitempty"` // 排查备注
+	Tags              []string `json:"tags,omitempty"` // 排查标签
+
+	transcript    *transcriptRecorder  // 对话历史记录器（未启用时为 nil）
+	clientProcess *clientProcessLookup // 后台进行的客户端进程查询（未启用时为 nil）
+	speed         *streamSpeed         // 实时生成速度（非流式请求为 nil）
+	dryRun        bool                 // 试运行请求，不写入 request_log
 }
 
 // claude code usage parser
@@ -835,7 +1266,7 @@ func mergeGeminiUsageMetadata(usage gjson.Result, reqLog *ReqeustLog) {
 // 【修复】维护跨 chunk 缓冲，确保完整 SSE 事件解析
 // Gemini SSE 格式: "data: {json}\n\n" 或 "data: [DONE]\n\n"
 func streamGeminiResponseWithHook(body io.Reader, writer io.Writer, requestLog *ReqeustLog) error {
-	buf := make([]byte, 8192) // 增大缓冲区减少系统调用
+	buf := make([]byte, 8192)   // 增大缓冲区减少系统调用
 	var lineBuf strings.Builder // 跨 chunk 行缓冲
 
 	for {
@@ -916,6 +1347,8 @@ func parseGeminiSSELine(event string, requestLog *ReqeustLog) {
 		if data == "[DONE]" || data == "" {
 			continue
 		}
+		requestLog.transcript.observe(data)
+		requestLog.speed.observe(line)
 		// 【优化】快速检查是否包含 usageMetadata，避免无效解析
 		if !strings.Contains(data, "usageMetadata") {
 			continue
@@ -962,7 +1395,7 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 		if c.Request.Body != nil {
 			data, err := io.ReadAll(c.Request.Body)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				respondRelayError(c, "gemini", http.StatusBadRequest, "invalid request body", nil)
 				return
 			}
 			bodyBytes = data
@@ -972,17 +1405,34 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 		// 判断是否为流式请求
 		isStream := strings.Contains(endpoint, ":streamGenerateContent") || strings.Contains(query, "alt=sse")
 
+		// 相同的并发非流式请求只转发一次
+		finishDedup, handled := prs.beginDedup(c, "/gemini", isStream, bodyBytes)
+		if handled {
+			return
+		}
+		defer finishDedup()
+
+		// 路由规则：命中 reject 时直接拒绝，provider/exclude 在下面过滤候选
+		decision, handled := applyRoutingRules(c, "gemini", extractGeminiModelFromEndpoint(endpoint), bodyBytes, isStream)
+		if handled {
+			return
+		}
+
 		// 加载 Gemini providers
 		providers := prs.geminiService.GetProviders()
 		if len(providers) == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "no gemini providers configured"})
+			respondRelayError(c, "gemini", http.StatusNotFound, "no gemini providers configured", nil)
 			return
 		}
 
 		// 1. 过滤可用的 providers（启用 + BaseURL 配置 + 未被拉黑）
-		var activeProviders []GeminiProvider
+		var activeProviders, coolingProviders []GeminiProvider
 		for _, p := range providers {
-			if !p.Enabled || p.BaseURL == "" {
+			if !p.Enabled || (p.Mock == nil && (p.BaseURL == "" || checkUpstreamURL(p.BaseURL) != nil)) {
+				continue
+			}
+			// 路由规则限定或排除的 provider
+			if !decision.allows(p.Name) {
 				continue
 			}
 			// 检查黑名单
@@ -994,11 +1444,51 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 			if p.Level <= 0 {
 				p.Level = 1
 			}
+			// 限流冷却：按上游 Retry-After 暂停转发
+			if wait := prs.cooldowns.remaining("gemini", p.Name, time.Now()); wait > 0 {
+				fmt.Printf("[Gemini] ⏳ Provider %s 限流冷却中，剩余 %ds\n", p.Name, retryAfterSeconds(wait))
+				coolingProviders = append(coolingProviders, p)
+				continue
+			}
 			activeProviders = append(activeProviders, p)
 		}
 
+		// 所有候选都在限流冷却：等待最早恢复的 provider，或让客户端稍后重试
+		if len(activeProviders) == 0 && len(coolingProviders) > 0 && !prs.isOffline() {
+			names := make([]string, len(coolingProviders))
+			for i, p := range coolingProviders {
+				names[i] = p.Name
+			}
+			idx, wait := prs.cooldowns.shortest("gemini", names, time.Now())
+			if !waitCooldown(c, "gemini", coolingProviders[idx].Name, wait) {
+				return
+			}
+			prs.cooldowns.clear("gemini", coolingProviders[idx].Name)
+			activeProviders = append(activeProviders, coolingProviders[idx])
+		}
+
+		// 离线模式：只保留本地 provider
+		if prs.isOffline() {
+			var local []GeminiProvider
+			for _, p := range activeProviders {
+				if isLocalEndpoint(p.BaseURL) || p.Mock != nil {
+					local = append(local, p)
+				}
+			}
+			if len(local) == 0 {
+				respondOffline(c, "gemini")
+				return
+			}
+			activeProviders = local
+		}
+
 		if len(activeProviders) == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "no active gemini provider (all disabled or blacklisted)"})
+			if decision.restricts() {
+				respondRelayError(c, "gemini", http.StatusServiceUnavailable,
+					fmt.Sprintf("路由规则 %s 指定的 provider 均不可用: %s", decision.rule, strings.Join(decision.args, ", ")), nil)
+				return
+			}
+			respondRelayError(c, "gemini", http.StatusNotFound, "no active gemini provider (all disabled or blacklisted)", nil)
 			return
 		}
 
@@ -1007,6 +1497,10 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 		for _, p := range activeProviders {
 			levelGroups[p.Level] = append(levelGroups[p.Level], p)
 		}
+		geminiModel := extractGeminiModelFromEndpoint(endpoint)
+		for level, group := range levelGroups {
+			levelGroups[level] = orderGeminiProvidersByWeight(geminiModel, group)
+		}
 
 		// 获取排序后的 Level 列表
 		var sortedLevels []int
@@ -1023,29 +1517,25 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 			IsStream:     isStream,
 			InputTokens:  0,
 			OutputTokens: 0,
+			Project:      requestProject(c),
+			transcript:   newTranscriptRecorder("gemini", bodyBytes),
 		}
+		requestLog.Client, requestLog.clientProcess = identifyClient(c)
 		start := time.Now()
 
 		// 保存日志的 defer
 		defer func() {
-			requestLog.DurationSec = time.Since(start).Seconds()
-			if GlobalDBQueueLogs == nil {
+			if requestLog.dryRun {
 				return
 			}
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			_ = GlobalDBQueueLogs.ExecBatchCtx(ctx, `
-				INSERT INTO request_log (
-					platform, model, provider, http_code,
-					input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
-					reasoning_tokens, is_stream, duration_sec
-				) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-			`,
-				requestLog.Platform, requestLog.Model, requestLog.Provider, requestLog.HttpCode,
-				requestLog.InputTokens, requestLog.OutputTokens, requestLog.CacheCreateTokens,
-				requestLog.CacheReadTokens, requestLog.ReasoningTokens,
-				boolToInt(requestLog.IsStream), requestLog.DurationSec,
-			)
+			requestLog.DurationSec = time.Since(start).Seconds()
+			if err := saveRequestLog(requestLog); err != nil {
+				fmt.Printf("[Gemini] 写入 request_log 失败: %v\n", err)
+			}
+			if requestLog.HttpCode >= http.StatusOK && requestLog.HttpCode < http.StatusMultipleChoices {
+				requestLog.transcript.save(requestLog)
+			}
+			runPostResponseHooks("gemini", requestLog, "")
 		}()
 
 		// 获取拉黑功能开关状态
@@ -1066,27 +1556,33 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 			}
 
 			if firstProvider == nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "no providers available"})
+				respondRelayError(c, "gemini", http.StatusNotFound, "no providers available", nil)
 				return
 			}
 
 			// 预填日志（失败也能记录尝试的 provider 与模型）
 			requestLog.Provider = firstProvider.Name
+			requestLog.ProviderUID = firstProvider.ID
 			requestLog.Model = firstProvider.Model
 
 			// 尝试第一个 provider
 			ok, err := prs.forwardGeminiRequest(c, firstProvider, endpoint, bodyBytes, isStream, requestLog)
+			if hookRejected(c) {
+				return
+			}
 			if ok {
 				_ = prs.blacklistService.RecordSuccess("gemini", firstProvider.Name)
 				// 记录最后使用的供应商
 				prs.setLastUsedProvider("gemini", firstProvider.Name)
+			} else if wait := prs.cooldowns.remaining("gemini", firstProvider.Name, time.Now()); wait > 0 {
+				// 上游限流：不计入失败次数，转告客户端重试时间
+				respondRateLimited(c, "gemini", wait, fmt.Sprintf("provider %s 被上游限流，%ds 后可重试（拉黑模式，不自动降级）", firstProvider.Name, retryAfterSeconds(wait)))
 			} else {
 				_ = prs.blacklistService.RecordFailure("gemini", firstProvider.Name)
 				if requestLog.HttpCode == 0 {
 					requestLog.HttpCode = http.StatusBadGateway
 				}
-				c.JSON(http.StatusBadGateway, gin.H{
-					"error":   fmt.Sprintf("provider %s failed", firstProvider.Name),
+				respondRelayError(c, "gemini", http.StatusBadGateway, fmt.Sprintf("provider %s failed: %s", firstProvider.Name, err), gin.H{
 					"details": err,
 					"hint":    "拉黑模式已开启，不会自动降级。请等待 provider 恢复或手动切换。",
 				})
@@ -1096,6 +1592,9 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 
 		// 【降级模式】：按 Level 顺序尝试所有 provider
 		var lastError string
+		otherFailures := 0              // 非限流的失败次数
+		var rateLimitWait time.Duration // 被限流的 provider 中最短的等待时间
+		var attempts []string           // 各 provider 的失败原因，返回给客户端
 		for _, level := range sortedLevels {
 			providersInLevel := levelGroups[level]
 			fmt.Printf("[Gemini] === 尝试 Level %d（%d 个 provider）===\n", level, len(providersInLevel))
@@ -1105,9 +1604,13 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 
 				// 预填日志，失败也能落库
 				requestLog.Provider = provider.Name
+				requestLog.ProviderUID = provider.ID
 				requestLog.Model = provider.Model
 
 				ok, errMsg := prs.forwardGeminiRequest(c, &provider, endpoint, bodyBytes, isStream, requestLog)
+				if hookRejected(c) {
+					return
+				}
 				if ok {
 					_ = prs.blacklistService.RecordSuccess("gemini", provider.Name)
 					// 记录最后使用的供应商
@@ -1116,20 +1619,30 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 					return // 成功，退出
 				}
 
-				// 失败，记录并继续
+				// 失败，记录并继续（上游限流已进入冷却，不计入失败次数）
 				lastError = errMsg
-				_ = prs.blacklistService.RecordFailure("gemini", provider.Name)
+				if wait := prs.cooldowns.remaining("gemini", provider.Name, time.Now()); wait > 0 {
+					rateLimitWait = minPositiveDuration(rateLimitWait, wait)
+					attempts = append(attempts, describeAttemptFailure(provider.Name, &retryAfterError{status: requestLog.HttpCode, wait: wait}))
+				} else {
+					otherFailures++
+					_ = prs.blacklistService.RecordFailure("gemini", provider.Name)
+					attempts = append(attempts, describeAttemptFailure(provider.Name, errors.New(errMsg)))
+				}
 			}
 
 			fmt.Printf("[Gemini] Level %d 的所有 %d 个 provider 均失败，尝试下一 Level\n", level, len(providersInLevel))
 		}
 
-		// 所有 Level 都失败
+		// 所有 Level 都失败；全部因限流失败时让客户端按最短的 Retry-After 重试
+		if otherFailures == 0 && rateLimitWait > 0 {
+			respondRateLimited(c, "gemini", rateLimitWait, fmt.Sprintf("all gemini providers are rate limited: %s", strings.Join(attempts, " → ")))
+			return
+		}
 		if requestLog.HttpCode == 0 {
 			requestLog.HttpCode = http.StatusBadGateway
 		}
-		c.JSON(http.StatusBadGateway, gin.H{
-			"error":   "all gemini providers failed",
+		respondRelayError(c, "gemini", http.StatusBadGateway, fmt.Sprintf("all gemini providers failed: %s", strings.Join(attempts, " → ")), gin.H{
 			"details": lastError,
 		})
 		fmt.Printf("[Gemini] ✗ 所有 provider 均失败 | 最后错误: %s\n", lastError)
@@ -1173,12 +1686,14 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 	requestLog *ReqeustLog,
 ) (bool, string) {
 	providerStart := time.Now()
+	retries := beginAttempt(c)
 
 	// 构建目标 URL
 	targetURL := strings.TrimSuffix(provider.BaseURL, "/") + endpoint
 
 	// 预先填充日志，保证失败也能记录 provider 和模型
 	requestLog.Provider = provider.Name
+	requestLog.ProviderUID = provider.ID
 	// 优先从 endpoint 提取模型名（如 gemini-2.5-pro），否则回退到 provider.Model
 	if extractedModel := extractGeminiModelFromEndpoint(endpoint); extractedModel != "" {
 		requestLog.Model = extractedModel
@@ -1194,6 +1709,9 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 
 	// 复制请求头
 	for key, values := range c.Request.Header {
+		if isRelayHeader(key) {
+			continue
+		}
 		for _, value := range values {
 			req.Header.Add(key, value)
 		}
@@ -1204,10 +1722,58 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 		req.Header.Set("x-goog-api-key", provider.APIKey)
 	}
 
+	// 转发前钩子：可修改请求头与请求体，或拒绝请求
+	if hooks := currentRelayConfig().Hooks; hooks.Enabled {
+		headers := cloneHeaders(req.Header)
+		hookedBody, reject, err := runPreRequestHooks(c.Request.Context(), hooks, "gemini", provider.Name, requestLog.Model, targetURL, headers, bodyBytes)
+		if reject != nil || err != nil {
+			rejectByHook(c, "gemini", reject, err)
+			return false, "请求被钩子拒绝"
+		}
+		req.Header = make(http.Header, len(headers))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		bodyBytes = hookedBody
+		req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		req.ContentLength = int64(len(bodyBytes))
+	}
+
+	// 试运行：记录后返回模拟响应，不转发到上游
+	if prs.isDryRun(c) {
+		requestLog.dryRun = true
+		prs.simulateRequest(c, dryRunRequest{
+			kind:     "gemini",
+			provider: provider.Name,
+			model:    requestLog.Model,
+			url:      targetURL,
+			headers:  cloneHeaders(req.Header),
+			body:     bodyBytes,
+			stream:   isStream,
+			attempt:  retries,
+		}, providerStart)
+		return true, ""
+	}
+
+	// 模拟 provider：不访问网络，按配置返回模拟响应或故障
+	if provider.Mock != nil {
+		status, err := prs.serveMock(c, "gemini", provider.Name, *provider.Mock, requestLog.Model, bodyBytes, isStream, providerStart, retries)
+		requestLog.HttpCode = status
+		requestLog.FirstByteSec = time.Since(providerStart).Seconds()
+		if err != nil {
+			fmt.Printf("[Gemini]   ✗ 失败: %s | 错误: %v（模拟）\n", provider.Name, err)
+			return false, err.Error()
+		}
+		return true, ""
+	}
+
 	// 发送请求
-	client := &http.Client{Timeout: 300 * time.Second}
+	client := withProviderNetwork(&http.Client{Timeout: 300 * time.Second, CheckRedirect: checkUpstreamRedirect, Transport: relayTransport}, provider.network())
 	resp, err := client.Do(req)
 	providerDuration := time.Since(providerStart).Seconds()
+	if err == nil {
+		requestLog.FirstByteSec = providerDuration
+	}
 
 	if err != nil {
 		fmt.Printf("[Gemini]   ✗ 失败: %s | 错误: %v | 耗时: %.2fs\n", provider.Name, err, providerDuration)
@@ -1220,6 +1786,7 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 
 	// 检查响应状态
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		prs.observeRetryAfter("gemini", provider.Name, resp.StatusCode, resp.Header)
 		errorBody, _ := io.ReadAll(resp.Body)
 		fmt.Printf("[Gemini]   ✗ 失败: %s | HTTP %d | 耗时: %.2fs\n", provider.Name, resp.StatusCode, providerDuration)
 		return false, fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(errorBody))
@@ -1233,13 +1800,16 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 			c.Header(key, value)
 		}
 	}
+	setAttributionHeaders(c, provider.Name, time.Since(providerStart), retries)
 	c.Status(resp.StatusCode)
 
 	// 处理响应
 	if isStream {
 		c.Writer.Flush()
+		requestLog.speed = prs.tokenSpeed.begin("gemini", provider.Name, requestLog.Model)
 		// 使用 SSE 解析器提取 token 用量
 		copyErr := streamGeminiResponseWithHook(resp.Body, c.Writer, requestLog)
+		requestLog.speed.finish(requestLog.OutputTokens)
 		if copyErr != nil {
 			fmt.Printf("[Gemini]   ⚠️ 流式传输中断: %s | 错误: %v\n", provider.Name, copyErr)
 			// 【修复】流式传输中断应标记为失败（虽然无法重试，但需记录健康度）
@@ -1254,6 +1824,7 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 		}
 		// 解析 Gemini 用量数据
 		parseGeminiUsageMetadata(body, requestLog)
+		requestLog.transcript.observe(string(body))
 		c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
 	}
 
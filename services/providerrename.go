@@ -0,0 +1,449 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// provider 重命名：黑名单、用量统计、路由规则等都以 provider 名称为键，直接改名会让这些记录失去归属。
+// RenameProvider 在同一事务中更新 provider 配置（含指向它的模型分流）、中继配置（权重表、路由规则、嵌入选路）、
+// 最近可用记录与数据库中引用该名称的表，任一步失败时全部回滚。改名同时记录曾用名：改名前已在途的请求
+// 写入日志时换成新名称，前端也可据此在历史报表中标注曾用名。
+// 多机汇总（collector_rollup）的数据由其他机器上报、按其本地名称记录，保持原样。
+
+// ProviderAlias provider 曾用名
+type ProviderAlias struct {
+	Platform  string `json:"platform"`
+	OldName   string `json:"oldName"`
+	NewName   string `json:"newName"` // 当前名称（多次改名时都指向最新的名称）
+	RenamedAt int64  `json:"renamedAt"`
+}
+
+// providerRenameTables 以 provider 名称为键的表（均有 platform 列）
+var providerRenameTables = []struct {
+	table  string
+	column string
+}{
+	{"request_log", "provider"},
+	{"request_rollup", "provider"},
+	{"request_feedback", "provider"},
+	{"request_annotation", "provider"},
+	{"conversation_log", "provider"},
+	{"provider_blacklist", "provider_name"},
+	{"provider_event", "provider"},
+	{"slo_breach", "provider"},
+	{"batch_job", "provider"},
+}
+
+var (
+	providerAliasMu sync.RWMutex
+	// providerAliasMap 平台|曾用名 → 当前名称，建表时从数据库加载
+	providerAliasMap = map[string]string{}
+)
+
+// ensureProviderAliasTable 确保 provider_alias 表存在并加载曾用名
+func ensureProviderAliasTable() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS provider_alias (
+		platform TEXT NOT NULL,
+		old_name TEXT NOT NULL,
+		new_name TEXT NOT NULL,
+		renamed_at BIGINT,
+		UNIQUE(platform, old_name)
+	)`
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("创建 provider_alias 表失败: %w", err)
+	}
+
+	aliases, err := queryProviderAliases(db, "")
+	if err != nil {
+		return fmt.Errorf("读取 provider 曾用名失败: %w", err)
+	}
+	providerAliasMu.Lock()
+	defer providerAliasMu.Unlock()
+	providerAliasMap = make(map[string]string, len(aliases))
+	for _, alias := range aliases {
+		providerAliasMap[alias.Platform+"|"+alias.OldName] = alias.NewName
+	}
+	return nil
+}
+
+// queryProviderAliases 读取曾用名，platform 为空时读取全部平台
+func queryProviderAliases(db *sql.DB, platform string) ([]ProviderAlias, error) {
+	query := `SELECT platform, old_name, new_name, COALESCE(renamed_at, 0) FROM provider_alias`
+	var args []interface{}
+	if platform != "" {
+		query += ` WHERE platform = ?`
+		args = append(args, platform)
+	}
+	rows, err := db.Query(query+` ORDER BY renamed_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	aliases := []ProviderAlias{}
+	for rows.Next() {
+		var alias ProviderAlias
+		if err := rows.Scan(&alias.Platform, &alias.OldName, &alias.NewName, &alias.RenamedAt); err != nil {
+			return nil, err
+		}
+		alias.RenamedAt *= 1000
+		aliases = append(aliases, alias)
+	}
+	return aliases, rows.Err()
+}
+
+// canonicalProviderName 把曾用名换成当前名称（改名前已在途的请求写入日志时使用）
+func canonicalProviderName(platform, name string) string {
+	providerAliasMu.RLock()
+	defer providerAliasMu.RUnlock()
+	if current, ok := providerAliasMap[platform+"|"+name]; ok {
+		return current
+	}
+	return name
+}
+
+// rememberProviderAlias 改名提交后更新内存中的曾用名（与 provider_alias 表的更新保持一致）
+func rememberProviderAlias(platform, oldName, newName string) {
+	providerAliasMu.Lock()
+	defer providerAliasMu.Unlock()
+	prefix := platform + "|"
+	for key, current := range providerAliasMap {
+		if strings.HasPrefix(key, prefix) && current == oldName {
+			providerAliasMap[key] = newName
+		}
+	}
+	// 改回曾用名时该名称重新成为当前名称
+	delete(providerAliasMap, prefix+newName)
+	providerAliasMap[prefix+oldName] = newName
+}
+
+// GetProviderAliases 获取平台下 provider 的曾用名（供前端调用）
+func (ps *ProviderService) GetProviderAliases(kind string) ([]ProviderAlias, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	aliases, err := queryProviderAliases(db, kind)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []ProviderAlias{}, nil
+		}
+		return nil, err
+	}
+	return aliases, nil
+}
+
+// RenameProvider 重命名 provider，并同步更新引用该名称的配置与数据库记录（供前端调用）
+func (ps *ProviderService) RenameProvider(kind, oldName, newName string) error {
+	if kind != "claude" && kind != "codex" {
+		return fmt.Errorf("不支持的平台: %s", kind)
+	}
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return fmt.Errorf("新名称不能为空")
+	}
+	if newName == oldName {
+		return nil
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return fmt.Errorf("加载供应商配置失败: %w", err)
+	}
+	index := providerIndex(providers, oldName)
+	if index < 0 {
+		return fmt.Errorf("provider 不存在: %s/%s", kind, oldName)
+	}
+	if providerIndex(providers, newName) >= 0 {
+		return fmt.Errorf("名称 %s 已被其他 provider 使用", newName)
+	}
+	providers[index].Name = newName
+	renameSplitTargets(providers, oldName, newName)
+
+	tx, err := beginConfigTransaction("重命名 " + kind + " provider " + oldName + " → " + newName)
+	if err != nil {
+		return err
+	}
+	if err := renameProviderConfigs(tx, ps, kind, providers, oldName, newName); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := renameProviderRecords(kind, oldName, newName); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("更新数据库记录失败，已回滚: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	rememberProviderAlias(kind, oldName, newName)
+	refreshConfigSnapshot()
+
+	recordAudit("provider", "rename", fmt.Sprintf("%s: %s → %s", kind, oldName, newName))
+	return nil
+}
+
+// renameProviderConfigs 在事务中写入改名后的 provider 配置、中继配置与最近可用记录
+func renameProviderConfigs(tx *configTransaction, ps *ProviderService, kind string, providers []Provider, oldName, newName string) error {
+	path, err := providerFilePath(kind)
+	if err != nil {
+		return err
+	}
+	if err := tx.Track(path); err != nil {
+		return err
+	}
+	if err := ps.saveProvidersRenamingLocked(kind, providers, oldName, newName); err != nil {
+		return err
+	}
+
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return err
+	}
+	if renameInRelayConfig(config, kind, oldName, newName, nameUsedOnOtherPlatforms(kind, oldName)) {
+		configPath, err := GetRelayConfigPath()
+		if err != nil {
+			return err
+		}
+		if err := tx.Track(configPath); err != nil {
+			return err
+		}
+		if err := (&SettingsService{}).UpdateRelayConfig(config); err != nil {
+			return fmt.Errorf("更新中继配置失败: %w", err)
+		}
+	}
+
+	lastKnownGoodMu.Lock()
+	defer lastKnownGoodMu.Unlock()
+	lkgPath := lastKnownGoodPath()
+	records := loadLastKnownGoodLocked(lkgPath)
+	if record, ok := records[kind]; ok && record.Provider == oldName {
+		if err := tx.Track(lkgPath); err != nil {
+			return err
+		}
+		record.Provider = newName
+		records[kind] = record
+		if err := AtomicWriteJSON(lkgPath, records); err != nil {
+			return fmt.Errorf("更新最近可用记录失败: %w", err)
+		}
+		lastKnownGoodWritten[lkgPath+"|"+kind] = newName
+	}
+	return nil
+}
+
+// renameSplitTargets 更新指向被改名 provider 的模型分流规则
+func renameSplitTargets(providers []Provider, oldName, newName string) {
+	for _, p := range providers {
+		for pattern, target := range p.SplitRoutes {
+			if target == oldName {
+				p.SplitRoutes[pattern] = newName
+			}
+		}
+	}
+}
+
+// nameUsedOnOtherPlatforms 返回也有同名 provider 的其他平台
+func nameUsedOnOtherPlatforms(kind, name string) map[string]bool {
+	used := map[string]bool{}
+	for _, platform := range []string{"claude", "codex"} {
+		if platform == kind {
+			continue
+		}
+		if providers, err := loadProvidersFile(platform); err == nil && providerIndex(providers, name) >= 0 {
+			used[platform] = true
+		}
+	}
+	return used
+}
+
+// renameInRelayConfig 更新中继配置中的 provider 名称，返回配置是否有变化
+// 规则适用于多个平台且其他平台也有同名 provider 时，在动作中追加新名称而不是替换
+func renameInRelayConfig(config *RelayConfig, kind, oldName, newName string, usedElsewhere map[string]bool) bool {
+	changed := false
+	for i := range config.Weights.Table {
+		item := &config.Weights.Table[i]
+		if item.Platform == kind && item.Provider == oldName {
+			item.Provider = newName
+			changed = true
+		}
+	}
+	if kind == "codex" {
+		for i, name := range config.Embeddings.Providers {
+			if name == oldName {
+				config.Embeddings.Providers[i] = newName
+				changed = true
+			}
+		}
+	}
+	for i := range config.Rules.Rules {
+		rule := &config.Rules.Rules[i]
+		if len(rule.Platforms) > 0 && !slices.Contains(rule.Platforms, kind) {
+			continue
+		}
+		keepOld := false
+		for platform := range usedElsewhere {
+			if len(rule.Platforms) == 0 || slices.Contains(rule.Platforms, platform) {
+				keepOld = true
+			}
+		}
+		if text, ok := renameRuleProvider(rule.Rule, oldName, newName, keepOld); ok {
+			rule.Rule = text
+			changed = true
+		}
+	}
+	return changed
+}
+
+// renameRuleProvider 替换规则 provider / exclude 动作中的 provider 名称，条件部分保持原样
+func renameRuleProvider(text, oldName, newName string, keepOld bool) (string, bool) {
+	idx := findRuleArrow(text)
+	if idx < 0 {
+		return text, false
+	}
+	action, args, err := parseRuleAction(strings.TrimSpace(text[idx+2:]))
+	if err != nil || (action != RuleActionProvider && action != RuleActionExclude) {
+		return text, false
+	}
+	pos := slices.Index(args, oldName)
+	if pos < 0 {
+		return text, false
+	}
+	if keepOld {
+		if slices.Contains(args, newName) {
+			return text, false
+		}
+		args = slices.Insert(args, pos+1, newName)
+	} else {
+		args[pos] = newName
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = strconv.Quote(arg)
+	}
+	return strings.TrimSpace(text[:idx]) + " -> " + action + " " + strings.Join(quoted, ", "), true
+}
+
+// renameProviderRecords 在数据库事务中更新引用 provider 名称的记录并写入曾用名；数据库未初始化时跳过
+// 共享表位于 PostgreSQL 时两个数据库各自一个事务，全部执行成功后依次提交
+func renameProviderRecords(platform, oldName, newName string) error {
+	if GlobalDBQueue == nil {
+		return nil
+	}
+	local, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	shared, err := sharedDB()
+	if err != nil {
+		return fmt.Errorf("获取共享表数据库连接失败: %w", err)
+	}
+
+	txs := map[*sql.DB]*sql.Tx{}
+	var order []*sql.Tx
+	begin := func(db *sql.DB) (*sql.Tx, error) {
+		if tx, ok := txs[db]; ok {
+			return tx, nil
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		txs[db] = tx
+		order = append(order, tx)
+		return tx, nil
+	}
+	rollback := func() {
+		for _, tx := range order {
+			_ = tx.Rollback()
+		}
+	}
+
+	sharedTx, err := begin(shared)
+	if err != nil {
+		return err
+	}
+	// 汇总表按 (时段, 平台, provider, 模型) 唯一，新名称已有汇总时无法合并
+	var conflicts int
+	err = sharedTx.QueryRow(`SELECT COUNT(*) FROM request_rollup WHERE platform = ? AND provider = ?`, platform, newName).Scan(&conflicts)
+	if err != nil && !isNoSuchTableErr(err) {
+		rollback()
+		return err
+	}
+	if conflicts > 0 {
+		rollback()
+		return fmt.Errorf("名称 %s 已有历史用量汇总（可能属于已删除的同名 provider），请换一个名称", newName)
+	}
+
+	for _, ref := range providerRenameTables {
+		db := local
+		if isSharedTable(ref.table) {
+			db = shared
+		}
+		tx, err := begin(db)
+		if err != nil {
+			rollback()
+			return err
+		}
+		if ref.table == "provider_blacklist" {
+			// 新名称的黑名单状态属于已删除的同名 provider，先清除以满足 UNIQUE(platform, provider_name)
+			if _, err := tx.Exec(`DELETE FROM provider_blacklist WHERE platform = ? AND provider_name = ?`, platform, newName); err != nil && !isNoSuchTableErr(err) {
+				rollback()
+				return fmt.Errorf("%s: %w", ref.table, err)
+			}
+		}
+		query := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE platform = ? AND %s = ?`, ref.table, ref.column, ref.column)
+		if _, err := tx.Exec(query, newName, platform, oldName); err != nil && !isNoSuchTableErr(err) {
+			rollback()
+			return fmt.Errorf("%s: %w", ref.table, err)
+		}
+	}
+
+	localTx, err := begin(local)
+	if err != nil {
+		rollback()
+		return err
+	}
+	aliasStatements := []struct {
+		query string
+		args  []interface{}
+	}{
+		// 之前的曾用名指向新名称；改回曾用名时删除该曾用名
+		{`UPDATE provider_alias SET new_name = ? WHERE platform = ? AND new_name = ?`, []interface{}{newName, platform, oldName}},
+		{`DELETE FROM provider_alias WHERE platform = ? AND old_name = ?`, []interface{}{platform, newName}},
+		{`INSERT INTO provider_alias (platform, old_name, new_name, renamed_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (platform, old_name) DO UPDATE SET new_name = excluded.new_name, renamed_at = excluded.renamed_at`,
+			[]interface{}{platform, oldName, newName, epochNow()}},
+	}
+	for _, stmt := range aliasStatements {
+		if _, err := localTx.Exec(stmt.query, stmt.args...); err != nil {
+			rollback()
+			return fmt.Errorf("provider_alias: %w", err)
+		}
+	}
+
+	if err := order[0].Commit(); err != nil {
+		rollback()
+		return err
+	}
+	if len(order) > 1 {
+		// 共享库已提交，不再回滚配置；本地表（事件、SLO、批量任务、曾用名）保留原名称
+		if err := order[1].Commit(); err != nil {
+			log.Printf("⚠️  重命名 %s 时本地数据库提交失败，本地记录保留原名称: %v", oldName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestRenameProvider(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	ps := NewProviderService()
+	providers := []Provider{
+		{ID: 1, Name: "old", APIURL: "https://api.anthropic.com", APIKey: "sk-old", Enabled: true},
+		{ID: 2, Name: "router", Enabled: true, SplitRoutes: map[string]string{"claude-*": "old"}},
+		{ID: 3, Name: "other", APIURL: "https://api.anthropic.com", APIKey: "sk-other"},
+	}
+	if err := ps.SaveProviders("claude", providers); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultRelayConfig()
+	config.Weights.Table = []ModelWeight{{Platform: "claude", Provider: "old", Weight: 50}}
+	config.Rules.Rules = []RoutingRule{{Name: "big", Rule: `est_tokens > 50000 -> provider "old", "other"`, Platforms: []string{"claude"}}}
+	if err := (&SettingsService{}).UpdateRelayConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	recordLastKnownGood("claude", "old")
+
+	if err := ps.RenameProvider("claude", "old", "other"); err == nil {
+		t.Error("新名称与已有 provider 重复时应拒绝")
+	}
+	if err := ps.RenameProvider("claude", "old", "new"); err != nil {
+		t.Fatalf("RenameProvider() error = %v", err)
+	}
+
+	saved, _ := ps.LoadProviders("claude")
+	if saved[0].Name != "new" || saved[1].SplitRoutes["claude-*"] != "new" {
+		t.Errorf("provider 与分流目标应改名: %+v", saved)
+	}
+	relay, _ := LoadRelayConfig()
+	if relay.Weights.Table[0].Provider != "new" {
+		t.Errorf("权重表应改名: %+v", relay.Weights.Table)
+	}
+	if got := relay.Rules.Rules[0].Rule; got != `est_tokens > 50000 -> provider "new", "other"` {
+		t.Errorf("路由规则应改名: %s", got)
+	}
+	if record, _ := lastKnownGood("claude"); record.Provider != "new" {
+		t.Errorf("最近可用记录应改名: %+v", record)
+	}
+	if got := canonicalProviderName("claude", "old"); got != "new" {
+		t.Errorf("canonicalProviderName() = %s", got)
+	}
+
+	// 普通保存仍不允许直接改名
+	saved[0].Name = "direct"
+	if err := ps.SaveProviders("claude", saved); err == nil {
+		t.Error("SaveProviders 不应允许直接改名")
+	}
+}
+
+func TestRenameRuleProvider(t *testing.T) {
+	got, ok := renameRuleProvider(`client == "a->b" -> exclude "x", "y"`, "x", "z", false)
+	if !ok || got != `client == "a->b" -> exclude "z", "y"` {
+		t.Errorf("renameRuleProvider() = %s, %v", got, ok)
+	}
+	// 其他平台也有同名 provider 时保留原名称
+	got, ok = renameRuleProvider(`stream -> provider "x"`, "x", "z", true)
+	if !ok || got != `stream -> provider "x", "z"` {
+		t.Errorf("renameRuleProvider() = %s, %v", got, ok)
+	}
+	if _, ok := renameRuleProvider(`stream -> reject "x"`, "x", "z", false); ok {
+		t.Error("reject 动作的参数不是 provider 名称")
+	}
+}
@@ -10,7 +10,8 @@ import (
 )
 
 type Provider struct {
-	ID      int64  `json:"id"` // 修复：使用 int64 支持大 ID 值
+	ID      int64  `json:"id"`            // 修复：使用 int64 支持大 ID 值
+	UID     string `json:"uid,omitempty"` // 稳定 ID（UUID）：保存时生成，改名后不变，数据库记录通过它关联 provider
 	Name    string `json:"name"`
 	APIURL  string `json:"apiUrl"`
 	APIKey  string `json:"apiKey"`
@@ -35,6 +36,43 @@ type Provider struct {
 	// 连通性检测开关 - 是否启用自动连通性检测
 	ConnectivityCheck bool `json:"connectivityCheck,omitempty"`
 
+	// 请求体积护栏 - 限制单次请求的字节数与预估提示词 token 数（0 表示不限制）
+	// 超出时按 GuardrailPolicy 处理：reject 拒绝（默认）/ truncate 丢弃最早的对话
+	MaxRequestBytes int    `json:"maxRequestBytes,omitempty"`
+	MaxPromptTokens int    `json:"maxPromptTokens,omitempty"`
+	GuardrailPolicy string `json:"guardrailPolicy,omitempty"`
+
+	// 并发上限 - 同时转发到该 provider 的请求数（0 表示不限制）
+	// 名额已满时请求排队，交互式请求优先于批量请求
+	MaxConcurrency int `json:"maxConcurrency,omitempty"`
+
+	// 密钥失效停用 - 连续 401 后记录当时 API Key 的指纹，更换 Key 后自动恢复
+	AuthDisabledKey string `json:"authDisabledKey,omitempty"`
+
+	// 证书固定 - 上游证书公钥指纹（sha256/<base64>），命中证书链中任一证书即可
+	// 开启 CertPinning 且未设置指纹时，首次验证通过的连接自动记录叶子证书指纹
+	CertPinning bool     `json:"certPinning,omitempty"`
+	CertPins    []string `json:"certPins,omitempty"`
+
+	// 模型分流 - 配置后成为虚拟 provider：按模型名（支持 * 通配符）把请求转给同平台的其他 provider
+	// 虚拟 provider 不需要 API 地址和 Key
+	SplitRoutes map[string]string `json:"splitRoutes,omitempty"`
+
+	// Beta 功能开关 - 转发时注入的 beta 请求头取值（anthropic-beta / OpenAI-Beta），只允许已知取值
+	BetaFlags []string `json:"betaFlags,omitempty"`
+
+	// 出站绑定 - 转发与测速从指定的本机 IP 或网卡发起连接（多网卡环境下经 VPN 访问镜像）
+	BindAddress string `json:"bindAddress,omitempty"`
+
+	// 上游代理 - 连接该 provider 时使用的代理（http/https/socks5/socks5h），优先于系统代理
+	Proxy string `json:"proxy,omitempty"`
+
+	// 模拟 provider - 配置后不访问网络，按模板返回模拟响应（可配置延迟与故障），不需要 API 地址和 Key
+	Mock *ProviderMock `json:"mock,omitempty"`
+
+	// 自定义健康检查 - 连通性测试按该定义发送请求并判定结果（用于对未知路径返回 403 的网关），为空时使用通用探测
+	HealthCheck *ProviderHealthCheck `json:"healthCheck,omitempty"`
+
 	// 内部字段：配置验证错误（不持久化）
 	configErrors []string `json:"-"`
 }
@@ -44,7 +82,18 @@ type providerEnvelope struct {
 }
 
 type ProviderService struct {
-	mu sync.Mutex
+	mu          sync.Mutex
+	switchHooks []providerSwitchHook // 切换供应商前的钩子（写入 CLI 配置）
+}
+
+// providerSwitchHook 切换供应商前执行，写入文件前需通过 tx.Track 登记，返回切换失败时的回滚函数
+type providerSwitchHook func(tx *configTransaction, kind string, provider Provider) (rollback func(), err error)
+
+// addSwitchHook 添加切换供应商时的钩子：任一钩子失败时不切换，切换保存失败时按相反顺序调用钩子返回的回滚函数
+func (ps *ProviderService) addSwitchHook(hook providerSwitchHook) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.switchHooks = append(ps.switchHooks, hook)
 }
 
 func NewProviderService() *ProviderService {
@@ -55,11 +104,7 @@ func (ps *ProviderService) Start() error { return nil }
 func (ps *ProviderService) Stop() error  { return nil }
 
 func providerFilePath(kind string) (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-	dir := filepath.Join(home, ".code-switch")
+	dir := getConfigDir()
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return "", err
 	}
@@ -83,6 +128,11 @@ func (ps *ProviderService) SaveProviders(kind string, providers []Provider) erro
 
 // saveProvidersLocked 内部保存方法，调用方必须已持有锁
 func (ps *ProviderService) saveProvidersLocked(kind string, providers []Provider) error {
+	return ps.saveProvidersRenamingLocked(kind, providers, "", "")
+}
+
+// saveProvidersRenamingLocked 保存 provider 配置，只允许 renameFrom → renameTo 这一处改名（由 RenameProvider 调用）
+func (ps *ProviderService) saveProvidersRenamingLocked(kind string, providers []Provider, renameFrom, renameTo string) error {
 	path, err := providerFilePath(kind)
 	if err != nil {
 		return err
@@ -93,17 +143,63 @@ func (ps *ProviderService) saveProvidersLocked(kind string, providers []Provider
 	if err != nil {
 		return err
 	}
+	// 前端只持有脱敏的 Key，未修改的 Key 还原为已保存的值
+	if err := restoreMaskedKeys(providers, existingProviders); err != nil {
+		return err
+	}
 	nameByID := make(map[int64]string, len(existingProviders))
 	for _, p := range existingProviders {
 		nameByID[p.ID] = p.Name
 	}
+	// 黑名单与用量统计在转发时按名称找到 provider，同一平台内名称不能重复
+	seenNames := make(map[string]bool, len(providers))
+	for _, p := range providers {
+		if seenNames[p.Name] {
+			return fmt.Errorf("供应商名称 '%s' 重复", p.Name)
+		}
+		seenNames[p.Name] = true
+	}
+	assignProviderUIDs(providers)
 
 	// 验证每个 provider 的配置
 	validationErrors := make([]string, 0)
+	for i := range providers {
+		// 已更换 API Key 的 provider 清除密钥失效标记
+		if providers[i].AuthDisabledKey != "" && !providers[i].IsAuthDisabled() {
+			providers[i].AuthDisabledKey = ""
+		}
+	}
 	for _, p := range providers {
-		// 规则：name 不可修改（黑名单/统计以 name 为 key，改名会导致数据丢失）
-		if oldName, ok := nameByID[p.ID]; ok && oldName != p.Name {
-			return fmt.Errorf("provider id %d 的 name 不可修改（会导致黑名单和统计数据丢失）", p.ID)
+		// 规则：name 不可直接修改（黑名单/统计以 name 为 key），改名需通过 RenameProvider 同步更新引用
+		if oldName, ok := nameByID[p.ID]; ok && oldName != p.Name && (oldName != renameFrom || p.Name != renameTo) {
+			return fmt.Errorf("provider id %d 的 name 不可直接修改（会导致黑名单和统计数据丢失），请使用重命名", p.ID)
+		}
+
+		// 管理员策略：provider 域名白名单
+		if err := currentPolicy().checkProviderURL(p.Name, p.APIURL); err != nil {
+			return err
+		}
+
+		if err := validateCertPins(p.CertPins); err != nil {
+			return fmt.Errorf("[%s] %w", p.Name, err)
+		}
+		if err := validateBetaFlags(kind, p.BetaFlags); err != nil {
+			return fmt.Errorf("[%s] %w", p.Name, err)
+		}
+		if err := validateBindAddress(p.BindAddress); err != nil {
+			return fmt.Errorf("[%s] %w", p.Name, err)
+		}
+		if err := validateUpstreamProxy(p.Proxy); err != nil {
+			return fmt.Errorf("[%s] %w", p.Name, err)
+		}
+		if err := validateProviderMock(p.Mock); err != nil {
+			return fmt.Errorf("[%s] %w", p.Name, err)
+		}
+		if err := validateHealthCheck(p.HealthCheck); err != nil {
+			return fmt.Errorf("[%s] %w", p.Name, err)
+		}
+		if err := validateSplitRoutes(p, providers); err != nil {
+			return fmt.Errorf("[%s] %w", p.Name, err)
 		}
 
 		// 验证模型配置
@@ -125,13 +221,28 @@ func (ps *ProviderService) saveProvidersLocked(kind string, providers []Provider
 	}
 
 	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
 		return err
 	}
-	return os.Rename(tmp, path)
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	recordConfigIntegrity(path)
+	// 立即更新中继使用的配置快照，保存后的第一个请求无需读文件
+	refreshConfigSnapshot()
+	return nil
 }
 
+// LoadProviders 从文件读取 provider 配置（编辑配置时使用；中继转发读取 snapshotProviders）
+// 返回完整 API Key，不生成前端绑定，前端通过 ListProviders 读取脱敏列表
+//
+//wails:ignore
 func (ps *ProviderService) LoadProviders(kind string) ([]Provider, error) {
+	return loadProvidersFile(kind)
+}
+
+// loadProvidersFile 读取并解析 provider 配置文件，文件不存在时返回 nil
+func loadProvidersFile(kind string) ([]Provider, error) {
 	path, err := providerFilePath(kind)
 	if err != nil {
 		return nil, err
@@ -192,7 +303,8 @@ func (ps *ProviderService) DuplicateProvider(kind string, sourceID int64) (*Prov
 	// 4. 克隆配置（深拷贝）
 	cloned := &Provider{
 		ID:                newID,
-		Name:              source.Name + " (副本)",
+		UID:               newProviderUID(),
+		Name:              uniqueProviderName(providers, source.Name+" (副本)"),
 		APIURL:            source.APIURL,
 		APIKey:            source.APIKey,
 		Site:              source.Site,
@@ -225,9 +337,101 @@ func (ps *ProviderService) DuplicateProvider(kind string, sourceID int64) (*Prov
 		return nil, fmt.Errorf("保存副本失败: %w", err)
 	}
 
+	// 返回给前端的副本同样不包含完整 Key
+	cloned.APIKey = maskAPIKey(cloned.APIKey)
 	return cloned, nil
 }
 
+// SwitchProvider 将指定 provider 设为首选：启用、移到列表首位，并放入当前最高优先级的 Level
+func (ps *ProviderService) SwitchProvider(kind string, name string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return fmt.Errorf("加载供应商配置失败: %w", err)
+	}
+
+	index := providerIndex(providers, name)
+	if index < 0 {
+		return fmt.Errorf("未找到名为 '%s' 的供应商", name)
+	}
+
+	// 未通过校验时回退到最近一次成功处理请求的 provider，避免 CLI 停留在不可用的配置上
+	if err := validateSwitchTarget(providers[index]); err != nil {
+		if record, ok := lastKnownGood(kind); ok && record.Provider != name {
+			if fallback, ferr := ps.fallbackToLastKnownGoodLocked(kind, providers); ferr == nil {
+				return fmt.Errorf("供应商 '%s' 未通过校验（%v），已回退到最近可用的供应商 '%s'", name, err, fallback)
+			}
+		}
+		return fmt.Errorf("供应商 '%s' 未通过校验，未切换: %w", name, err)
+	}
+	return ps.activateProviderLocked(kind, providers, index)
+}
+
+// activateProviderLocked 将 providers[index] 设为平台当前 provider：启用并移到最高优先级，
+// 依次执行切换钩子后保存（调用方需持有 ps.mu）
+func (ps *ProviderService) activateProviderLocked(kind string, providers []Provider, index int) error {
+	topLevel := 0
+	for _, p := range providers {
+		level := p.Level
+		if level <= 0 {
+			level = 1
+		}
+		if p.Enabled && (topLevel == 0 || level < topLevel) {
+			topLevel = level
+		}
+	}
+
+	target := providers[index]
+	target.Enabled = true
+	if topLevel > 0 {
+		target.Level = topLevel
+	}
+	reordered := make([]Provider, 0, len(providers))
+	reordered = append(reordered, target)
+	reordered = append(reordered, providers[:index]...)
+	reordered = append(reordered, providers[index+1:]...)
+
+	// CLI 配置与 provider 配置在同一事务中写入，中途退出时下次启动整体回滚
+	tx, err := beginConfigTransaction("切换 " + kind + " 供应商到 " + target.Name)
+	if err != nil {
+		return err
+	}
+	path, err := providerFilePath(kind)
+	if err == nil {
+		err = tx.Track(path)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 钩子的回滚函数同时更新配置漂移记录，先于事务回滚执行
+	var rollbacks []func()
+	rollbackAll := func() {
+		for i := len(rollbacks) - 1; i >= 0; i-- {
+			rollbacks[i]()
+		}
+		tx.Rollback()
+	}
+	for _, hook := range ps.switchHooks {
+		rollback, err := hook(tx, kind, target)
+		if err != nil {
+			rollbackAll()
+			return fmt.Errorf("写入 CLI 配置失败，未切换: %w", err)
+		}
+		if rollback != nil {
+			rollbacks = append(rollbacks, rollback)
+		}
+	}
+	if err := ps.saveProvidersLocked(kind, reordered); err != nil {
+		rollbackAll()
+		return err
+	}
+	return tx.Commit()
+}
+
 // IsModelSupported 检查 provider 是否支持指定的模型
 // 支持条件：1) 模型在 SupportedModels 中（精确或通配符匹配）
 //          2) 模型在 ModelMapping 的 key 中（精确或通配符匹配）
@@ -336,6 +540,19 @@ func (p *Provider) ValidateConfiguration() []string {
 
 	// 规则 3 移除：自映射不会破坏功能，最多是无效配置，不阻塞保存
 
+	// 规则 4：护栏策略必须是已知值
+	switch p.GuardrailPolicy {
+	case "", GuardrailPolicyReject, GuardrailPolicyTruncate:
+	default:
+		errors = append(errors, fmt.Sprintf("无效的护栏策略 '%s'，可选值: reject、truncate", p.GuardrailPolicy))
+	}
+	if p.MaxRequestBytes < 0 || p.MaxPromptTokens < 0 {
+		errors = append(errors, "请求体积上限不能为负数")
+	}
+	if p.MaxConcurrency < 0 {
+		errors = append(errors, "并发上限不能为负数")
+	}
+
 	p.configErrors = errors
 	return errors
 }
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// provider 时间线：把测速、失败请求、拉黑/恢复、降级切换与 SLO 违约按时间合并成一条时间线，
+// 用于排查“周二下午为什么那么糟”这类问题。拉黑与切换事件记录在本机 provider_event 表（保留 30 天），
+// 测速样本只保留 8 天，更早的时间线中不含测速结果。
+
+const (
+	// 时间线事件类型
+	TimelineSpeedTest    = "speed_test"
+	TimelineRequestError = "request_error"
+	TimelineBlacklisted  = "blacklisted"
+	TimelineUnblocked    = "unblocked"
+	TimelineRecovered    = "recovered"
+	TimelineSwitch       = "switch"
+	TimelineSLOBreach    = "slo_breach"
+	TimelineSLORecovered = "slo_recovered"
+
+	// timelineMaxEvents 时间线最多返回的事件数（保留最近的）
+	timelineMaxEvents = 2000
+	// timelineDefaultWindow 未指定起始时间时的时间范围
+	timelineDefaultWindow = 24 * time.Hour
+	// providerEventRetention provider_event 保留时间
+	providerEventRetention = 30 * 24 * time.Hour
+)
+
+// ProviderTimelineEvent 时间线中的一个事件
+type ProviderTimelineEvent struct {
+	Time      int64   `json:"time"` // Unix 时间戳（秒）
+	Type      string  `json:"type"`
+	Provider  string  `json:"provider"`
+	Summary   string  `json:"summary"`
+	LatencyMs *uint64 `json:"latencyMs,omitempty"` // 测速延迟，nil 表示失败
+	HTTPCode  int     `json:"httpCode,omitempty"`  // 失败请求的状态码
+	Model     string  `json:"model,omitempty"`
+	Peer      string  `json:"peer,omitempty"` // 切换事件的目标 provider
+}
+
+// ProviderTimeline provider 时间线
+type ProviderTimeline struct {
+	Platform  string                  `json:"platform"`
+	Provider  string                  `json:"provider"` // 为空表示平台下全部 provider
+	Since     int64                   `json:"since"`
+	Events    []ProviderTimelineEvent `json:"events"`    // 按时间升序
+	Truncated bool                    `json:"truncated"` // 事件过多，只保留了最近的部分
+}
+
+// ensureProviderEventTable 确保 provider_event 表存在
+func ensureProviderEventTable() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS provider_event (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		platform TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		event TEXT NOT NULL,
+		peer TEXT DEFAULT '',
+		detail TEXT,
+		created_at BIGINT
+	)`
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("创建 provider_event 表失败: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_provider_event_time ON provider_event(platform, created_at)`); err != nil {
+		return fmt.Errorf("创建 provider_event 索引失败: %w", err)
+	}
+	return nil
+}
+
+// recordProviderEvent 记录拉黑、恢复、切换等 provider 事件（失败只记录日志）
+func recordProviderEvent(platform, provider, event, peer, detail string) {
+	if GlobalDBQueue == nil {
+		return
+	}
+	if err := GlobalDBQueue.Exec(
+		`INSERT INTO provider_event (platform, provider, event, peer, detail, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		platform, provider, event, peer, maskForStorage(detail), epochNow(),
+	); err != nil {
+		fmt.Printf("写入 provider_event 失败: %v\n", err)
+	}
+}
+
+// pruneProviderEvents 清理过期的 provider 事件
+func pruneProviderEvents(before time.Time) {
+	if GlobalDBQueue == nil {
+		return
+	}
+	if err := GlobalDBQueue.Exec(`DELETE FROM provider_event WHERE created_at < ?`, before.Unix()); err != nil {
+		fmt.Printf("清理 provider_event 失败: %v\n", err)
+	}
+}
+
+// GetProviderTimeline 获取 provider 在 since（Unix 秒，0 表示最近 24 小时）之后的时间线；provider 为空时返回平台下全部 provider
+func (ls *LogService) GetProviderTimeline(platform string, provider string, since int64) (*ProviderTimeline, error) {
+	if !isCommandPlatform(platform) {
+		return nil, fmt.Errorf("无效的平台: %s", platform)
+	}
+	if since <= 0 {
+		since = time.Now().Add(-timelineDefaultWindow).Unix()
+	}
+
+	var events []ProviderTimelineEvent
+	sources := []func(string, string, int64) ([]ProviderTimelineEvent, error){
+		timelineRequestErrors,
+		timelineProviderEvents,
+		timelineSpeedTests,
+		timelineSLOBreaches,
+	}
+	for _, source := range sources {
+		items, err := source(platform, provider, since)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, items...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time < events[j].Time })
+	timeline := &ProviderTimeline{Platform: platform, Provider: provider, Since: since, Events: events}
+	if len(events) > timelineMaxEvents {
+		timeline.Events = events[len(events)-timelineMaxEvents:]
+		timeline.Truncated = true
+	}
+	if timeline.Events == nil {
+		timeline.Events = []ProviderTimelineEvent{}
+	}
+	return timeline, nil
+}
+
+// timelineQuery 查询最近的 timelineMaxEvents 条记录并按时间升序返回，表不存在时返回空
+func timelineQuery(model xdb.Model, options ...xdb.Option) ([]xdb.Record, error) {
+	options = append(options, xdb.OrderByDesc("id"), xdb.Limit(timelineMaxEvents))
+	records, err := model.Selects(options...)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	slices.Reverse(records)
+	return records, nil
+}
+
+// timelineRequestErrors 失败的请求
+func timelineRequestErrors(platform, provider string, since int64) ([]ProviderTimelineEvent, error) {
+	options := []xdb.Option{
+		xdb.WhereGte("created_at", since),
+		xdb.WhereEq("platform", platform),
+		xdb.Field("provider", "model", "http_code", "duration_sec", "created_at"),
+	}
+	if provider != "" {
+		options = append(options, xdb.WhereEq("provider", provider))
+	}
+	records, err := timelineQuery(sharedModel("request_log"), options...)
+	if err != nil {
+		return nil, err
+	}
+	var events []ProviderTimelineEvent
+	for _, record := range records {
+		code := record.GetInt("http_code")
+		if code >= 200 && code < 300 {
+			continue
+		}
+		createdAt, ok := parseCreatedAt(record)
+		if !ok {
+			continue
+		}
+		events = append(events, ProviderTimelineEvent{
+			Time:     createdAt.Unix(),
+			Type:     TimelineRequestError,
+			Provider: record.GetString("provider"),
+			Summary:  fmt.Sprintf("请求失败 HTTP %d（%.1fs）", code, record.GetFloat64("duration_sec")),
+			HTTPCode: code,
+			Model:    record.GetString("model"),
+		})
+	}
+	return events, nil
+}
+
+// timelineProviderEvents 拉黑、恢复与切换事件（切换事件同时出现在来源与目标 provider 的时间线中）
+func timelineProviderEvents(platform, provider string, since int64) ([]ProviderTimelineEvent, error) {
+	records, err := timelineQuery(xdb.New("provider_event"),
+		xdb.WhereGte("created_at", since),
+		xdb.WhereEq("platform", platform),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var events []ProviderTimelineEvent
+	for _, record := range records {
+		name, peer := record.GetString("provider"), record.GetString("peer")
+		if provider != "" && name != provider && peer != provider {
+			continue
+		}
+		createdAt, ok := parseCreatedAt(record)
+		if !ok {
+			continue
+		}
+		events = append(events, ProviderTimelineEvent{
+			Time:     createdAt.Unix(),
+			Type:     record.GetString("event"),
+			Provider: name,
+			Summary:  record.GetString("detail"),
+			Peer:     peer,
+		})
+	}
+	return events, nil
+}
+
+// timelineSpeedTests 测速样本（按 provider 的 API 地址匹配）
+func timelineSpeedTests(platform, provider string, since int64) ([]ProviderTimelineEvent, error) {
+	byURL := providerEndpointURLs(platform, provider)
+	if len(byURL) == 0 {
+		return nil, nil
+	}
+	urls := make([]any, 0, len(byURL))
+	for url := range byURL {
+		urls = append(urls, url)
+	}
+	records, err := timelineQuery(xdb.New("endpoint_latency"),
+		xdb.WhereGte("created_at", since),
+		xdb.WhereIn("url", urls),
+	)
+	if err != nil {
+		return nil, err
+	}
+	thresholds := currentRelayConfig().LatencyClass
+	var events []ProviderTimelineEvent
+	for _, record := range records {
+		createdAt, ok := parseCreatedAt(record)
+		if !ok {
+			continue
+		}
+		var latency *uint64
+		summary := "测速失败"
+		if record.GetInt("success") == 1 {
+			ms := uint64(record.GetInt64("latency_ms"))
+			latency = &ms
+			summary = fmt.Sprintf("测速 %dms（%s）", ms, latencyClassLabel(thresholds.classify(latency)))
+		}
+		for _, name := range byURL[record.GetString("url")] {
+			events = append(events, ProviderTimelineEvent{
+				Time:      createdAt.Unix(),
+				Type:      TimelineSpeedTest,
+				Provider:  name,
+				Summary:   summary,
+				LatencyMs: latency,
+			})
+		}
+	}
+	return events, nil
+}
+
+// timelineSLOBreaches SLO 违约的开始与恢复
+func timelineSLOBreaches(platform, provider string, since int64) ([]ProviderTimelineEvent, error) {
+	options := []xdb.Option{
+		xdb.WhereEq("platform", platform),
+		xdb.WhereGte("started_at", since),
+	}
+	if provider != "" {
+		options = append(options, xdb.WhereEq("provider", provider))
+	}
+	records, err := xdb.New("slo_breach").Selects(append(options, xdb.OrderByDesc("started_at"), xdb.Limit(timelineMaxEvents))...)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var events []ProviderTimelineEvent
+	for _, record := range records {
+		breach := sloBreachFromRecord(record)
+		events = append(events, ProviderTimelineEvent{
+			Time:     breach.StartedAt,
+			Type:     TimelineSLOBreach,
+			Provider: breach.Provider,
+			Summary:  fmt.Sprintf("违反 SLO %s（%s 阈值 %dms）", breach.Objective, breach.Metric, breach.ThresholdMs),
+		})
+		if breach.EndedAt > 0 {
+			events = append(events, ProviderTimelineEvent{
+				Time:     breach.EndedAt,
+				Type:     TimelineSLORecovered,
+				Provider: breach.Provider,
+				Summary:  fmt.Sprintf("SLO %s 已恢复", breach.Objective),
+			})
+		}
+	}
+	return events, nil
+}
+
+// providerEndpointURLs 读取平台 provider 的 API 地址（规范化后的 URL → provider 名称），provider 非空时只返回该 provider
+func providerEndpointURLs(platform, provider string) map[string][]string {
+	byURL := make(map[string][]string)
+	add := func(name, rawURL string) {
+		if rawURL != "" && (provider == "" || name == provider) {
+			url := normalizeEndpointURL(rawURL)
+			byURL[url] = append(byURL[url], name)
+		}
+	}
+
+	configDir := getConfigDir()
+	switch platform {
+	case "gemini":
+		var providers []GeminiProvider
+		if err := ReadJSONFile(filepath.Join(configDir, "gemini-providers.json"), &providers); err == nil {
+			for _, p := range providers {
+				add(p.Name, p.BaseURL)
+			}
+		}
+	default:
+		file := "claude-code.json"
+		if platform == "codex" {
+			file = "codex.json"
+		}
+		var envelope providerEnvelope
+		if err := ReadJSONFile(filepath.Join(configDir, file), &envelope); err == nil {
+			for _, p := range envelope.Providers {
+				add(p.Name, p.APIURL)
+			}
+		}
+	}
+	return byURL
+}
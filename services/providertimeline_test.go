@@ -0,0 +1,42 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProviderEndpointURLs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	dir := filepath.Join(home, ".code-switch")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	claude := `{"providers":[
+		{"name":"A","apiUrl":"https://api.example.com/"},
+		{"name":"B","apiUrl":"https://API.example.com"},
+		{"name":"C","apiUrl":"https://other.example.com"},
+		{"name":"Mock"}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, "claude-code.json"), []byte(claude), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	byURL := providerEndpointURLs("claude", "")
+	if names := byURL["https://api.example.com"]; len(names) != 2 || names[0] != "A" || names[1] != "B" {
+		t.Errorf("相同地址的 provider 应合并: %v", byURL)
+	}
+	if len(byURL) != 2 {
+		t.Errorf("没有地址的 provider 应忽略: %v", byURL)
+	}
+
+	byURL = providerEndpointURLs("claude", "C")
+	if len(byURL) != 1 || byURL["https://other.example.com"][0] != "C" {
+		t.Errorf("指定 provider 时只返回该 provider: %v", byURL)
+	}
+	if len(providerEndpointURLs("codex", "")) != 0 {
+		t.Error("配置文件不存在时应返回空")
+	}
+}
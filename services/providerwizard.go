@@ -0,0 +1,524 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 添加供应商向导：根据 Base URL 与 API Key 探测接口协议（Anthropic / OpenAI 兼容 / Gemini），
+// 获取模型列表并给出请求头建议，验证通过后才保存，减少配置错误的 provider。
+
+// 接口协议
+const (
+	WizardDialectAnthropic = "anthropic"
+	WizardDialectOpenAI    = "openai"
+	WizardDialectGemini    = "gemini"
+)
+
+const (
+	wizardProbeTimeout    = 10 * time.Second
+	wizardVerifyTimeout   = 30 * time.Second
+	wizardAnthropicVer    = "2023-06-01"
+	wizardMaxResponseSize = 1 << 20
+)
+
+// wizardURLSuffixes 用户可能粘贴的完整接口路径，探测前去掉，得到服务根地址
+var wizardURLSuffixes = []string{
+	"/v1/messages", "/v1/chat/completions", "/v1/responses", "/v1/models",
+	"/chat/completions", "/responses", "/models", "/v1beta", "/v1",
+}
+
+// wizardDefaultModels 模型列表不可用时验证使用的模型（与连通性测试一致）
+var wizardDefaultModels = map[string]string{
+	WizardDialectAnthropic: "claude-3-haiku-20240307",
+	WizardDialectOpenAI:    "gpt-4o-mini",
+	WizardDialectGemini:    "gemini-2.0-flash",
+}
+
+// wizardPreferredModels 从模型列表中挑选验证模型时优先选择的关键字（便宜、响应快）
+var wizardPreferredModels = map[string][]string{
+	WizardDialectAnthropic: {"haiku"},
+	WizardDialectOpenAI:    {"mini", "nano"},
+	WizardDialectGemini:    {"flash"},
+}
+
+// ProviderWizardRequest 向导输入
+type ProviderWizardRequest struct {
+	Name     string `json:"name"`
+	BaseURL  string `json:"baseUrl"`
+	APIKey   string `json:"apiKey"`
+	Platform string `json:"platform,omitempty"` // 可选：claude / codex / gemini，指定时按对应协议探测
+	Model    string `json:"model,omitempty"`    // 可选：验证使用的模型，为空时从模型列表中挑选
+}
+
+// ProviderWizardProbe 单次协议探测结果
+type ProviderWizardProbe struct {
+	Dialect  string `json:"dialect"`
+	URL      string `json:"url"`
+	HTTPCode int    `json:"httpCode,omitempty"`
+	OK       bool   `json:"ok"`
+	Message  string `json:"message,omitempty"`
+}
+
+// ProviderWizardProposal 探测得到的配置建议
+type ProviderWizardProposal struct {
+	Dialect  string                `json:"dialect"`
+	Platform string                `json:"platform"`
+	APIURL   string                `json:"apiUrl"` // 按平台约定规范化后的地址
+	Models   []string              `json:"models"`
+	Model    string                `json:"model"`   // 验证使用的模型
+	Headers  map[string]string     `json:"headers"` // 建议的请求头（API Key 以占位符表示）
+	Probes   []ProviderWizardProbe `json:"probes"`
+	Warnings []string              `json:"warnings,omitempty"`
+}
+
+// ProviderWizardVerification 验证请求结果
+type ProviderWizardVerification struct {
+	OK        bool   `json:"ok"`
+	URL       string `json:"url"`
+	HTTPCode  int    `json:"httpCode,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+	Message   string `json:"message,omitempty"`
+}
+
+// ProviderWizardResult 向导结果；验证未通过时 Saved 为 false，不保存
+type ProviderWizardResult struct {
+	Proposal     ProviderWizardProposal     `json:"proposal"`
+	Verification ProviderWizardVerification `json:"verification"`
+	Saved        bool                       `json:"saved"`
+	ProviderID   string                     `json:"providerId,omitempty"` // claude/codex 为数字 ID，gemini 为字符串 ID
+}
+
+// ProviderWizardService 添加供应商向导
+type ProviderWizardService struct {
+	providerService *ProviderService
+	geminiService   *GeminiService
+	client          *http.Client
+}
+
+// NewProviderWizardService 创建添加供应商向导服务
+func NewProviderWizardService(providerService *ProviderService, geminiService *GeminiService) *ProviderWizardService {
+	return &ProviderWizardService{
+		providerService: providerService,
+		geminiService:   geminiService,
+		client:          &http.Client{CheckRedirect: checkUpstreamRedirect},
+	}
+}
+
+func (pws *ProviderWizardService) Start() error { return nil }
+func (pws *ProviderWizardService) Stop() error  { return nil }
+
+// DetectProvider 探测接口协议、获取模型列表并给出配置建议（不保存）
+func (pws *ProviderWizardService) DetectProvider(req ProviderWizardRequest) (*ProviderWizardProposal, error) {
+	root, err := wizardRootURL(req.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.APIKey) == "" {
+		return nil, fmt.Errorf("API Key 不能为空")
+	}
+	if req.Platform != "" && !isCommandPlatform(req.Platform) {
+		return nil, fmt.Errorf("无效的平台: %s（可选值: claude、codex、gemini）", req.Platform)
+	}
+	if err := checkUpstreamURL(root); err != nil {
+		return nil, err
+	}
+
+	proposal := &ProviderWizardProposal{Models: []string{}, Probes: []ProviderWizardProbe{}}
+	for _, dialect := range wizardProbeOrder(root, req.Platform) {
+		probe, models, detected := pws.probeModels(root, req.APIKey, dialect)
+		proposal.Probes = append(proposal.Probes, probe)
+		if probe.OK {
+			proposal.Dialect = detected
+			proposal.Models = models
+			break
+		}
+	}
+
+	if proposal.Dialect == "" {
+		// 模型列表不可用（部分中转站不提供 /models）：按指定平台继续，由验证请求判断是否可用
+		if req.Platform == "" {
+			if wizardAllProbesUnauthorized(proposal.Probes) {
+				return proposal, fmt.Errorf("API Key 无效或无权限访问（所有探测均返回 401/403）")
+			}
+			return proposal, fmt.Errorf("无法识别接口协议，请选择平台后重试")
+		}
+		proposal.Dialect = wizardPlatformDialect(req.Platform)
+		proposal.Warnings = append(proposal.Warnings, "无法获取模型列表，将使用默认模型验证")
+	}
+
+	proposal.Platform = req.Platform
+	if proposal.Platform == "" {
+		proposal.Platform = wizardDialectPlatform(proposal.Dialect)
+	} else if wizardPlatformDialect(proposal.Platform) != proposal.Dialect {
+		proposal.Warnings = append(proposal.Warnings, fmt.Sprintf("接口协议为 %s，与所选平台 %s 的协议不一致，转发时可能失败", proposal.Dialect, proposal.Platform))
+	}
+	proposal.APIURL = wizardAPIURL(root, proposal.Platform)
+	proposal.Headers = wizardHeaders(proposal.Dialect)
+	proposal.Model = req.Model
+	if proposal.Model == "" {
+		proposal.Model = pickWizardModel(proposal.Dialect, proposal.Models)
+	} else if len(proposal.Models) > 0 && !slices.Contains(proposal.Models, proposal.Model) {
+		proposal.Warnings = append(proposal.Warnings, fmt.Sprintf("模型 '%s' 不在模型列表中", proposal.Model))
+	}
+	return proposal, nil
+}
+
+// CreateProviderWizard 探测、验证并在验证通过后保存 provider
+func (pws *ProviderWizardService) CreateProviderWizard(req ProviderWizardRequest) (*ProviderWizardResult, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, fmt.Errorf("供应商名称不能为空")
+	}
+	proposal, err := pws.DetectProvider(req)
+	if err != nil {
+		return nil, err
+	}
+	result := &ProviderWizardResult{Proposal: *proposal}
+	result.Verification = pws.verify(proposal, req.APIKey)
+	if !result.Verification.OK {
+		return result, nil
+	}
+
+	switch proposal.Platform {
+	case "gemini":
+		provider := GeminiProvider{
+			ID:       fmt.Sprintf("gemini-%d", time.Now().UnixMilli()),
+			Name:     req.Name,
+			BaseURL:  proposal.APIURL,
+			APIKey:   req.APIKey,
+			Model:    proposal.Model,
+			Category: "custom",
+		}
+		for _, existing := range pws.geminiService.GetProviders() {
+			if existing.Name == req.Name {
+				return result, fmt.Errorf("供应商名称 '%s' 已存在", req.Name)
+			}
+		}
+		if err := pws.geminiService.AddProvider(provider); err != nil {
+			return result, err
+		}
+		result.ProviderID = provider.ID
+	default:
+		provider, err := pws.providerService.appendProvider(proposal.Platform, Provider{
+			Name:   req.Name,
+			APIURL: proposal.APIURL,
+			APIKey: req.APIKey,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.ProviderID = fmt.Sprintf("%d", provider.ID)
+	}
+	result.Saved = true
+	recordAudit("provider", "wizard_create", fmt.Sprintf("通过向导添加 %s 供应商 %s（%s）", proposal.Platform, req.Name, proposal.APIURL))
+	return result, nil
+}
+
+// appendProvider 追加 provider：分配 ID 与默认配色，名称不能重复
+func (ps *ProviderService) appendProvider(kind string, provider Provider) (Provider, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.LoadProviders(kind)
+	if err != nil {
+		return provider, fmt.Errorf("加载供应商配置失败: %w", err)
+	}
+	if providerIndex(providers, provider.Name) >= 0 {
+		return provider, fmt.Errorf("供应商名称 '%s' 已存在", provider.Name)
+	}
+	provider.ID = nextProviderID(providers)
+	provider.UID = newProviderUID()
+	provider.Accent, provider.Tint = defaultVisual(kind)
+	provider.Enabled = true
+	if err := ps.saveProvidersLocked(kind, append(providers, provider)); err != nil {
+		return provider, err
+	}
+	return provider, nil
+}
+
+// probeModels 按指定协议请求模型列表；返回按响应格式识别的协议
+func (pws *ProviderWizardService) probeModels(root, apiKey, dialect string) (ProviderWizardProbe, []string, string) {
+	probe := ProviderWizardProbe{Dialect: dialect}
+	var modelsURL string
+	switch dialect {
+	case WizardDialectAnthropic:
+		modelsURL = joinURL(root, "/v1/models")
+	case WizardDialectOpenAI:
+		modelsURL = joinURL(root, "/v1/models")
+	case WizardDialectGemini:
+		modelsURL = joinURL(root, "/v1beta/models")
+	}
+	probe.URL = modelsURL
+
+	ctx, cancel := context.WithTimeout(context.Background(), wizardProbeTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, modelsURL, nil)
+	if err != nil {
+		probe.Message = err.Error()
+		return probe, nil, ""
+	}
+	setWizardAuth(httpReq, dialect, apiKey)
+
+	resp, err := pws.client.Do(httpReq)
+	if err != nil {
+		probe.Message = fmt.Sprintf("网络错误: %v", err)
+		return probe, nil, ""
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, wizardMaxResponseSize))
+	probe.HTTPCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		probe.Message = truncateWizardMessage(string(body))
+		return probe, nil, ""
+	}
+
+	detected, models, ok := parseWizardModels(body)
+	if !ok {
+		probe.Message = "响应不是模型列表"
+		return probe, nil, ""
+	}
+	probe.OK = true
+	return probe, models, detected
+}
+
+// parseWizardModels 解析模型列表并按响应格式识别协议：
+// Anthropic 的条目带 "type": "model"，OpenAI 兼容接口带 "object": "model"，Gemini 返回 models[].name
+func parseWizardModels(body []byte) (string, []string, bool) {
+	var payload struct {
+		Data []struct {
+			ID     string `json:"id"`
+			Type   string `json:"type"`
+			Object string `json:"object"`
+		} `json:"data"`
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", nil, false
+	}
+
+	models := make([]string, 0, len(payload.Data)+len(payload.Models))
+	if len(payload.Models) > 0 {
+		for _, m := range payload.Models {
+			if name := strings.TrimPrefix(m.Name, "models/"); name != "" {
+				models = append(models, name)
+			}
+		}
+		sort.Strings(models)
+		return WizardDialectGemini, models, true
+	}
+	if payload.Data == nil {
+		return "", nil, false
+	}
+	dialect := WizardDialectOpenAI
+	for _, m := range payload.Data {
+		if m.ID != "" {
+			models = append(models, m.ID)
+		}
+		if m.Type == "model" && m.Object == "" {
+			dialect = WizardDialectAnthropic
+		}
+	}
+	sort.Strings(models)
+	return dialect, models, true
+}
+
+// verify 发送一次最小的生成请求，确认地址、Key 与模型可用
+func (pws *ProviderWizardService) verify(proposal *ProviderWizardProposal, apiKey string) ProviderWizardVerification {
+	var (
+		target string
+		body   map[string]any
+	)
+	root := strings.TrimSuffix(proposal.APIURL, "/v1")
+	switch proposal.Dialect {
+	case WizardDialectAnthropic:
+		target = joinURL(root, "/v1/messages")
+		body = map[string]any{"model": proposal.Model, "max_tokens": 1, "messages": []map[string]string{{"role": "user", "content": "hi"}}}
+	case WizardDialectGemini:
+		target = joinURL(root, "/v1beta/models/"+url.PathEscape(proposal.Model)+":generateContent")
+		body = map[string]any{"contents": []map[string]any{{"parts": []map[string]string{{"text": "hi"}}}}, "generationConfig": map[string]any{"maxOutputTokens": 1}}
+	default:
+		// Codex 通过中继转发 Responses API，验证同一接口
+		target = joinURL(root, "/v1/responses")
+		body = map[string]any{"model": proposal.Model, "max_output_tokens": 16, "input": "hi"}
+	}
+	verification := ProviderWizardVerification{URL: target}
+	data, _ := json.Marshal(body)
+
+	ctx, cancel := context.WithTimeout(context.Background(), wizardVerifyTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		verification.Message = err.Error()
+		return verification
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	setWizardAuth(httpReq, proposal.Dialect, apiKey)
+
+	start := time.Now()
+	resp, err := pws.client.Do(httpReq)
+	verification.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		verification.Message = fmt.Sprintf("网络错误: %v", err)
+		return verification
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	verification.HTTPCode = resp.StatusCode
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		verification.OK = true
+	case resp.StatusCode == http.StatusTooManyRequests:
+		// 限流说明地址与 Key 均有效
+		verification.OK = true
+		verification.Message = "上游限流（429），地址与 API Key 有效"
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		verification.Message = "API Key 无效或无权限: " + truncateWizardMessage(string(respBody))
+	case resp.StatusCode == http.StatusNotFound:
+		verification.Message = fmt.Sprintf("接口或模型 '%s' 不存在: %s", proposal.Model, truncateWizardMessage(string(respBody)))
+	default:
+		verification.Message = truncateWizardMessage(string(respBody))
+	}
+	return verification
+}
+
+// wizardRootURL 校验地址并去掉常见的接口路径后缀
+func wizardRootURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("Base URL 无效: %s", raw)
+	}
+	root := strings.TrimSuffix(raw, "/")
+	for _, suffix := range wizardURLSuffixes {
+		if strings.HasSuffix(root, suffix) {
+			root = strings.TrimSuffix(root, suffix)
+			break
+		}
+	}
+	return root, nil
+}
+
+// wizardAPIURL 按平台约定生成保存的地址：Codex 的地址包含 /v1（中继拼接 /responses），其他平台为根地址
+func wizardAPIURL(root, platform string) string {
+	if platform == "codex" {
+		return root + "/v1"
+	}
+	return root
+}
+
+// wizardProbeOrder 探测顺序：指定平台的协议优先，其次按域名推断，最后依次尝试
+func wizardProbeOrder(root, platform string) []string {
+	order := make([]string, 0, 3)
+	add := func(dialect string) {
+		if dialect != "" && !slices.Contains(order, dialect) {
+			order = append(order, dialect)
+		}
+	}
+	if platform != "" {
+		add(wizardPlatformDialect(platform))
+	}
+	host := strings.ToLower(root)
+	switch {
+	case strings.Contains(host, "anthropic"):
+		add(WizardDialectAnthropic)
+	case strings.Contains(host, "googleapis") || strings.Contains(host, "gemini"):
+		add(WizardDialectGemini)
+	case strings.Contains(host, "openai"):
+		add(WizardDialectOpenAI)
+	}
+	add(WizardDialectAnthropic)
+	add(WizardDialectOpenAI)
+	add(WizardDialectGemini)
+	return order
+}
+
+func wizardPlatformDialect(platform string) string {
+	switch platform {
+	case "claude":
+		return WizardDialectAnthropic
+	case "gemini":
+		return WizardDialectGemini
+	default:
+		return WizardDialectOpenAI
+	}
+}
+
+func wizardDialectPlatform(dialect string) string {
+	switch dialect {
+	case WizardDialectAnthropic:
+		return "claude"
+	case WizardDialectGemini:
+		return "gemini"
+	default:
+		return "codex"
+	}
+}
+
+// wizardHeaders 建议的请求头，API Key 以占位符表示
+func wizardHeaders(dialect string) map[string]string {
+	switch dialect {
+	case WizardDialectAnthropic:
+		return map[string]string{"x-api-key": "<API Key>", "anthropic-version": wizardAnthropicVer}
+	case WizardDialectGemini:
+		return map[string]string{"x-goog-api-key": "<API Key>"}
+	default:
+		return map[string]string{"Authorization": "Bearer <API Key>"}
+	}
+}
+
+func setWizardAuth(req *http.Request, dialect, apiKey string) {
+	switch dialect {
+	case WizardDialectAnthropic:
+		req.Header.Set("x-api-key", apiKey)
+		req.Header.Set("anthropic-version", wizardAnthropicVer)
+	case WizardDialectGemini:
+		req.Header.Set("x-goog-api-key", apiKey)
+	default:
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+// pickWizardModel 挑选验证模型：优先便宜、响应快的模型，其次列表中的第一个，列表为空时使用默认模型
+func pickWizardModel(dialect string, models []string) string {
+	for _, keyword := range wizardPreferredModels[dialect] {
+		for _, model := range models {
+			if strings.Contains(strings.ToLower(model), keyword) {
+				return model
+			}
+		}
+	}
+	if len(models) > 0 {
+		return models[0]
+	}
+	return wizardDefaultModels[dialect]
+}
+
+func wizardAllProbesUnauthorized(probes []ProviderWizardProbe) bool {
+	for _, probe := range probes {
+		if probe.HTTPCode != http.StatusUnauthorized && probe.HTTPCode != http.StatusForbidden {
+			return false
+		}
+	}
+	return len(probes) > 0
+}
+
+func truncateWizardMessage(msg string) string {
+	msg = strings.TrimSpace(msg)
+	if len(msg) > 300 {
+		return msg[:300] + "..."
+	}
+	return msg
+}
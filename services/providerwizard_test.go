@@ -0,0 +1,91 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseWizardModels(t *testing.T) {
+	cases := []struct {
+		body    string
+		dialect string
+		first   string
+	}{
+		{`{"data":[{"id":"claude-sonnet-4","type":"model","display_name":"Claude Sonnet 4"}]}`, WizardDialectAnthropic, "claude-sonnet-4"},
+		{`{"object":"list","data":[{"id":"gpt-4o","object":"model"}]}`, WizardDialectOpenAI, "gpt-4o"},
+		{`{"models":[{"name":"models/gemini-2.5-pro"}]}`, WizardDialectGemini, "gemini-2.5-pro"},
+	}
+	for _, tc := range cases {
+		dialect, models, ok := parseWizardModels([]byte(tc.body))
+		if !ok || dialect != tc.dialect || len(models) == 0 || models[0] != tc.first {
+			t.Errorf("%s: 得到 %s %v %v", tc.body, dialect, models, ok)
+		}
+	}
+	if _, _, ok := parseWizardModels([]byte(`{"error":"not found"}`)); ok {
+		t.Error("非模型列表的响应不应识别成功")
+	}
+}
+
+func TestWizardRootURL(t *testing.T) {
+	cases := map[string]string{
+		"https://api.example.com/":                     "https://api.example.com",
+		"https://api.example.com/v1":                   "https://api.example.com",
+		"https://api.example.com/v1/chat/completions":  "https://api.example.com",
+		"https://gw.example.com/anthropic/v1/messages": "https://gw.example.com/anthropic",
+	}
+	for raw, want := range cases {
+		if got, err := wizardRootURL(raw); err != nil || got != want {
+			t.Errorf("wizardRootURL(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+	if _, err := wizardRootURL("api.example.com"); err == nil {
+		t.Error("缺少协议的地址应报错")
+	}
+	if got := wizardAPIURL("https://api.example.com", "codex"); got != "https://api.example.com/v1" {
+		t.Errorf("codex 地址应包含 /v1，得到 %s", got)
+	}
+}
+
+func TestDetectProviderAnthropic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/models":
+			w.Write([]byte(`{"data":[{"id":"claude-sonnet-4","type":"model"},{"id":"claude-haiku-4-5","type":"model"}]}`))
+		case "/v1/messages":
+			w.Write([]byte(`{"content":[{"type":"text","text":"hi"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	pws := NewProviderWizardService(nil, nil)
+	proposal, err := pws.DetectProvider(ProviderWizardRequest{BaseURL: server.URL + "/v1", APIKey: "sk-test"})
+	if err != nil {
+		t.Fatalf("探测失败: %v", err)
+	}
+	if proposal.Dialect != WizardDialectAnthropic || proposal.Platform != "claude" || proposal.APIURL != server.URL {
+		t.Fatalf("探测结果不符: %+v", proposal)
+	}
+	if proposal.Model != "claude-haiku-4-5" {
+		t.Errorf("应优先选择 haiku 模型验证，得到 %s", proposal.Model)
+	}
+	if proposal.Headers["anthropic-version"] == "" {
+		t.Error("应建议 anthropic-version 请求头")
+	}
+	if verification := pws.verify(proposal, "sk-test"); !verification.OK {
+		t.Errorf("验证应通过: %+v", verification)
+	}
+	if verification := pws.verify(proposal, "sk-wrong"); verification.OK || verification.HTTPCode != http.StatusUnauthorized {
+		t.Errorf("错误的 Key 不应通过验证: %+v", verification)
+	}
+
+	if _, err := pws.DetectProvider(ProviderWizardRequest{BaseURL: server.URL, APIKey: "sk-wrong"}); err == nil {
+		t.Error("所有探测均返回 401 时应报错")
+	}
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 数据清除范围
+const (
+	PurgeScopeAll      = "all"      // 全部数据：数据库记录 + 配置目录中的所有文件（含密钥）
+	PurgeScopeLogs     = "logs"     // 仅日志：对话记录、审计日志、端点延迟样本、批量任务结果
+	PurgeScopeUsage    = "usage"    // 仅用量：请求日志（用量与费用统计）
+	PurgeScopeProvider = "provider" // 单个 provider：其请求/对话记录、黑名单状态，并清除其 API Key
+)
+
+// PurgeRequest 数据清除请求
+type PurgeRequest struct {
+	Scope    string `json:"scope"`
+	Platform string `json:"platform,omitempty"` // scope=provider 时必填：claude、codex、gemini
+	Provider string `json:"provider,omitempty"` // scope=provider 时必填：provider 名称
+}
+
+// PurgeResult 数据清除结果
+type PurgeResult struct {
+	Scope           string   `json:"scope"`
+	Tables          []string `json:"tables"`          // 已清空（或按 provider 清理）的表
+	RowsDeleted     int64    `json:"rowsDeleted"`     // 删除的数据库记录数
+	FilesWiped      []string `json:"filesWiped"`      // 覆写后删除的文件
+	KeysCleared     int      `json:"keysCleared"`     // 清除的 API Key 数量
+	RestartRequired bool     `json:"restartRequired"` // 是否需要重启应用（内存中的配置仍是旧值）
+}
+
+// purgeLogTables 日志类数据表
+var purgeLogTables = []string{"conversation_log", "audit_log", "endpoint_latency", "provider_event", "batch_result", "batch_job"}
+
+// purgeAllTables 全部清除时清空的表（app_settings 只保存开关类设置，不含个人数据，保留）
+var purgeAllTables = append([]string{"request_log", "request_rollup", "request_feedback", "request_annotation", "provider_blacklist", "embedding_cache"}, purgeLogTables...)
+
+// DataPurgeService 数据清除：供用户停用/交还设备前彻底删除本机数据
+// 本应用的 API Key 保存在配置目录的 JSON 文件中（不使用系统钥匙串），清除时对文件覆写后再删除
+type DataPurgeService struct {
+	providerService *ProviderService
+	geminiService   *GeminiService
+}
+
+func NewDataPurgeService(providerService *ProviderService, geminiService *GeminiService) *DataPurgeService {
+	return &DataPurgeService{
+		providerService: providerService,
+		geminiService:   geminiService,
+	}
+}
+
+// PurgeData 按范围清除数据（供前端调用）
+func (ds *DataPurgeService) PurgeData(req PurgeRequest) (*PurgeResult, error) {
+	result := &PurgeResult{Scope: req.Scope, Tables: []string{}, FilesWiped: []string{}}
+
+	var err error
+	switch req.Scope {
+	case PurgeScopeAll:
+		err = ds.purgeAll(result)
+	case PurgeScopeLogs:
+		err = purgeTables(purgeLogTables, result)
+	case PurgeScopeUsage:
+		err = purgeTables([]string{"request_log", "request_rollup", "request_feedback", "request_annotation"}, result)
+	case PurgeScopeProvider:
+		err = ds.purgeProvider(req.Platform, req.Provider, result)
+	default:
+		return nil, fmt.Errorf("无效的清除范围: %s（可选值: all、logs、usage、provider）", req.Scope)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// VACUUM 重写数据库文件，避免已删除记录残留在空闲页中
+	if err := compactDatabase(); err != nil {
+		log.Printf("⚠️  清除数据后压缩数据库失败: %v", err)
+	}
+
+	detail := fmt.Sprintf("范围 %s，删除 %d 条记录，覆写删除 %d 个文件，清除 %d 个 Key", req.Scope, result.RowsDeleted, len(result.FilesWiped), result.KeysCleared)
+	if req.Scope == PurgeScopeProvider {
+		detail = fmt.Sprintf("%s/%s：%s", req.Platform, req.Provider, detail)
+	}
+	recordAudit("privacy", "purge_data", detail)
+	log.Printf("🧹 已清除数据：%s", detail)
+	return result, nil
+}
+
+// purgeAll 清空所有数据表，并覆写删除配置目录中除数据库以外的所有文件
+func (ds *DataPurgeService) purgeAll(result *PurgeResult) error {
+	if err := purgeTables(purgeAllTables, result); err != nil {
+		return err
+	}
+	result.KeysCleared = ds.countKeys()
+
+	configDir := getConfigDir()
+	err := filepath.WalkDir(configDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// 数据库正在使用，已通过删除记录 + VACUUM 清理
+		if strings.HasPrefix(d.Name(), "app.db") {
+			return nil
+		}
+		if err := secureDeleteFile(path); err != nil {
+			return fmt.Errorf("删除 %s 失败: %w", path, err)
+		}
+		result.FilesWiped = append(result.FilesWiped, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	result.RestartRequired = true
+	return nil
+}
+
+// purgeProvider 清除单个 provider 的记录与 API Key（保留 provider 条目并禁用，便于用户重新填写）
+func (ds *DataPurgeService) purgeProvider(platform, name string, result *PurgeResult) error {
+	if platform == "" || name == "" {
+		return fmt.Errorf("按 provider 清除时需要指定平台和名称")
+	}
+
+	switch platform {
+	case "claude", "codex":
+		providers, err := ds.providerService.LoadProviders(platform)
+		if err != nil {
+			return err
+		}
+		found := false
+		for i := range providers {
+			if providers[i].Name == name {
+				found = true
+				if providers[i].APIKey != "" {
+					result.KeysCleared++
+				}
+				providers[i].APIKey = ""
+				providers[i].Enabled = false
+			}
+		}
+		if !found {
+			return fmt.Errorf("provider 不存在: %s/%s", platform, name)
+		}
+		if err := ds.providerService.SaveProviders(platform, providers); err != nil {
+			return fmt.Errorf("清除 API Key 失败: %w", err)
+		}
+	case "gemini":
+		if ds.geminiService == nil {
+			return fmt.Errorf("Gemini 服务不可用")
+		}
+		found := false
+		for _, provider := range ds.geminiService.GetProviders() {
+			if provider.Name != name {
+				continue
+			}
+			found = true
+			if provider.APIKey != "" {
+				result.KeysCleared++
+			}
+			provider.APIKey = ""
+			provider.Enabled = false
+			for key := range provider.EnvConfig {
+				if strings.Contains(strings.ToUpper(key), "KEY") || strings.Contains(strings.ToUpper(key), "TOKEN") {
+					delete(provider.EnvConfig, key)
+					result.KeysCleared++
+				}
+			}
+			if err := ds.geminiService.UpdateProvider(provider); err != nil {
+				return fmt.Errorf("清除 API Key 失败: %w", err)
+			}
+		}
+		if !found {
+			return fmt.Errorf("provider 不存在: %s/%s", platform, name)
+		}
+	default:
+		return fmt.Errorf("无效的平台: %s", platform)
+	}
+
+	deletes := []struct {
+		table string
+		sql   string
+	}{
+		{"request_log", `DELETE FROM request_log WHERE platform = ? AND provider = ?`},
+		{"request_rollup", `DELETE FROM request_rollup WHERE platform = ? AND provider = ?`},
+		{"request_feedback", `DELETE FROM request_feedback WHERE platform = ? AND provider = ?`},
+		{"request_annotation", `DELETE FROM request_annotation WHERE platform = ? AND provider = ?`},
+		{"conversation_log", `DELETE FROM conversation_log WHERE platform = ? AND provider = ?`},
+		{"provider_blacklist", `DELETE FROM provider_blacklist WHERE platform = ? AND provider_name = ?`},
+		{"provider_event", `DELETE FROM provider_event WHERE platform = ? AND provider = ?`},
+		{"batch_result", `DELETE FROM batch_result WHERE job_id IN (SELECT id FROM batch_job WHERE platform = ? AND provider = ?)`},
+		{"batch_job", `DELETE FROM batch_job WHERE platform = ? AND provider = ?`},
+	}
+	for _, d := range deletes {
+		n, err := execPurge(d.table, d.sql, platform, name)
+		if err != nil {
+			return fmt.Errorf("清理 %s 失败: %w", d.table, err)
+		}
+		result.Tables = append(result.Tables, d.table)
+		result.RowsDeleted += n
+	}
+	return nil
+}
+
+// purgeTables 清空指定的表（表不存在时跳过）
+func purgeTables(tables []string, result *PurgeResult) error {
+	for _, table := range tables {
+		n, err := execPurge(table, "DELETE FROM "+table)
+		if err != nil {
+			return fmt.Errorf("清空 %s 失败: %w", table, err)
+		}
+		result.Tables = append(result.Tables, table)
+		result.RowsDeleted += n
+	}
+	return nil
+}
+
+// execPurge 在表所在的数据库上执行删除并返回影响行数（直接使用连接以获取行数，表不存在视为 0 行）
+func execPurge(table string, query string, args ...interface{}) (int64, error) {
+	conn := "default"
+	if isSharedTable(table) {
+		conn = sharedConn()
+	}
+	db, err := xdb.DB(conn)
+	if err != nil {
+		return 0, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// compactDatabase 截断 WAL 并 VACUUM，使已删除的数据不再留存在数据库文件中
+func compactDatabase() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return err
+	}
+	if _, err := db.Exec("VACUUM"); err != nil {
+		return err
+	}
+	_, err = db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
+
+// secureDeleteFile 用随机数据覆写文件内容并落盘后删除
+// 注意：在 SSD / 写时复制文件系统上覆写无法保证物理擦除，仅作尽力而为
+func secureDeleteFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if size := info.Size(); size > 0 {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		buf := make([]byte, 32*1024)
+		for written := int64(0); written < size; {
+			n := int64(len(buf))
+			if remaining := size - written; remaining < n {
+				n = remaining
+			}
+			if _, err := rand.Read(buf[:n]); err != nil {
+				f.Close()
+				return err
+			}
+			if _, err := f.Write(buf[:n]); err != nil {
+				f.Close()
+				return err
+			}
+			written += n
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return os.Remove(path)
+}
+
+// countKeys 统计当前配置中的 API Key 数量
+func (ds *DataPurgeService) countKeys() int {
+	count := 0
+	for _, platform := range []string{"claude", "codex"} {
+		providers, _ := ds.providerService.LoadProviders(platform)
+		for _, p := range providers {
+			if p.APIKey != "" {
+				count++
+			}
+		}
+	}
+	if ds.geminiService != nil {
+		for _, p := range ds.geminiService.GetProviders() {
+			if p.APIKey != "" {
+				count++
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// seedPurgeData 写入 claude/p1、claude/p2、codex/p1 三个 provider 的记录与配置
+func seedPurgeData(t *testing.T) *DataPurgeService {
+	t.Helper()
+	db, err := sharedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := epochNow()
+	for _, stmt := range []struct {
+		sql  string
+		args []interface{}
+	}{
+		{`INSERT INTO request_log (platform, model, provider, created_at) VALUES ('claude', 'm', 'p1', ?), ('claude', 'm', 'p2', ?), ('codex', 'm', 'p1', ?)`, []interface{}{now, now, now}},
+		{`INSERT INTO conversation_log (platform, session_id, role, content_hash, provider, created_at) VALUES ('claude', 's1', 'user', 'h', 'p1', ?), ('claude', 's2', 'user', 'h', 'p2', ?), ('codex', 's3', 'user', 'h', 'p1', ?)`, []interface{}{now, now, now}},
+		{`INSERT INTO request_feedback (request_id, platform, provider, rating, created_at) VALUES (1, 'claude', 'p1', 1, ?), (2, 'claude', 'p2', -1, ?)`, []interface{}{now, now}},
+		{`INSERT INTO provider_blacklist (platform, provider_name) VALUES ('claude', 'p1'), ('codex', 'p1')`, nil},
+		{`INSERT INTO audit_log (category, action, detail, created_at) VALUES ('config', 'update', 'x', ?)`, []interface{}{now}},
+	} {
+		if _, err := db.Exec(stmt.sql, stmt.args...); err != nil {
+			t.Fatalf("写入测试数据失败: %v", err)
+		}
+	}
+
+	ps := NewProviderService()
+	for platform, names := range map[string][]string{"claude": {"p1", "p2"}, "codex": {"p1"}} {
+		var providers []Provider
+		for i, name := range names {
+			providers = append(providers, Provider{ID: int64(i + 1), Name: name, APIURL: "https://api.example.com", APIKey: "sk-" + platform + "-" + name, Enabled: true})
+		}
+		if err := ps.SaveProviders(platform, providers); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewDataPurgeService(ps, nil)
+}
+
+// countRows 统计满足条件的记录数
+func countRows(t *testing.T, table, where string, args ...interface{}) int {
+	t.Helper()
+	db, err := sharedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE `+where, args...).Scan(&n); err != nil {
+		t.Fatalf("统计 %s 失败: %v", table, err)
+	}
+	return n
+}
+
+func TestPurgeDataScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     PurgeRequest
+		verify  func(t *testing.T, ds *DataPurgeService, result *PurgeResult)
+		wantErr bool
+	}{
+		{
+			name: "单个 provider",
+			req:  PurgeRequest{Scope: PurgeScopeProvider, Platform: "claude", Provider: "p1"},
+			verify: func(t *testing.T, ds *DataPurgeService, result *PurgeResult) {
+				for _, table := range []string{"request_log", "conversation_log", "request_feedback"} {
+					if n := countRows(t, table, `platform = 'claude' AND provider = 'p1'`); n != 0 {
+						t.Errorf("%s 中 claude/p1 的记录应被清除，剩余 %d", table, n)
+					}
+					// 同平台其他 provider 与其他平台的同名 provider 不受影响
+					if n := countRows(t, table, `NOT (platform = 'claude' AND provider = 'p1')`); n == 0 {
+						t.Errorf("%s 中范围外的记录不应被清除", table)
+					}
+				}
+				if n := countRows(t, "provider_blacklist", `platform = 'codex' AND provider_name = 'p1'`); n != 1 {
+					t.Errorf("codex/p1 的黑名单状态不应被清除")
+				}
+				if n := countRows(t, "audit_log", `category = 'config'`); n != 1 {
+					t.Errorf("审计日志不应被清除")
+				}
+				if result.KeysCleared != 1 || result.RowsDeleted != 4 || result.RestartRequired {
+					t.Errorf("清除结果不符: %+v", result)
+				}
+
+				claude, _ := ds.providerService.LoadProviders("claude")
+				codex, _ := ds.providerService.LoadProviders("codex")
+				if claude[0].APIKey != "" || claude[0].Enabled {
+					t.Errorf("claude/p1 的 Key 应被清除并停用: %+v", claude[0])
+				}
+				if claude[1].APIKey != "sk-claude-p2" || !claude[1].Enabled || codex[0].APIKey != "sk-codex-p1" {
+					t.Errorf("范围外的 Key 不应被清除: %+v / %+v", claude[1], codex[0])
+				}
+			},
+		},
+		{
+			name: "仅日志",
+			req:  PurgeRequest{Scope: PurgeScopeLogs},
+			verify: func(t *testing.T, ds *DataPurgeService, result *PurgeResult) {
+				if n := countRows(t, "conversation_log", "1=1"); n != 0 {
+					t.Errorf("对话记录应被清空，剩余 %d", n)
+				}
+				if n := countRows(t, "audit_log", `category = 'config'`); n != 0 {
+					t.Errorf("清除前的审计日志应被清空")
+				}
+				if countRows(t, "request_log", "1=1") != 3 || countRows(t, "request_feedback", "1=1") != 2 || countRows(t, "provider_blacklist", "1=1") != 2 {
+					t.Error("用量、反馈与黑名单不属于日志范围，不应被清除")
+				}
+				if claude, _ := ds.providerService.LoadProviders("claude"); claude[0].APIKey == "" {
+					t.Error("清除日志不应清除 Key")
+				}
+			},
+		},
+		{
+			name: "仅用量",
+			req:  PurgeRequest{Scope: PurgeScopeUsage},
+			verify: func(t *testing.T, ds *DataPurgeService, result *PurgeResult) {
+				if countRows(t, "request_log", "1=1") != 0 || countRows(t, "request_feedback", "1=1") != 0 {
+					t.Error("请求日志与反馈应被清空")
+				}
+				if countRows(t, "conversation_log", "1=1") != 3 || countRows(t, "provider_blacklist", "1=1") != 2 || countRows(t, "audit_log", `category = 'config'`) != 1 {
+					t.Error("对话记录、黑名单与审计日志不属于用量范围，不应被清除")
+				}
+			},
+		},
+		{
+			name: "全部数据",
+			req:  PurgeRequest{Scope: PurgeScopeAll},
+			verify: func(t *testing.T, ds *DataPurgeService, result *PurgeResult) {
+				for _, table := range []string{"request_log", "conversation_log", "request_feedback", "provider_blacklist"} {
+					if n := countRows(t, table, "1=1"); n != 0 {
+						t.Errorf("%s 应被清空，剩余 %d", table, n)
+					}
+				}
+				if _, err := os.Stat(filepath.Join(getConfigDir(), "claude-code.json")); !os.IsNotExist(err) {
+					t.Errorf("provider 配置文件应被删除: %v", err)
+				}
+				if _, err := os.Stat(filepath.Join(getConfigDir(), "app.db")); err != nil {
+					t.Errorf("正在使用的数据库文件应保留: %v", err)
+				}
+				if result.KeysCleared != 3 || !result.RestartRequired {
+					t.Errorf("清除结果不符: %+v", result)
+				}
+			},
+		},
+		{name: "未知 provider", req: PurgeRequest{Scope: PurgeScopeProvider, Platform: "claude", Provider: "p9"}, wantErr: true},
+		{name: "缺少 provider 名称", req: PurgeRequest{Scope: PurgeScopeProvider, Platform: "claude"}, wantErr: true},
+		{name: "无效范围", req: PurgeRequest{Scope: "everything"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTestRelayConfig(t, DefaultRelayConfig())
+			newTestDatabase(t)
+			ds := seedPurgeData(t)
+
+			result, err := ds.PurgeData(tt.req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("应返回错误")
+				}
+				if n := countRows(t, "request_log", "1=1"); n != 3 {
+					t.Errorf("失败的清除不应删除记录，剩余 %d", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PurgeData() 失败: %v", err)
+			}
+			tt.verify(t, ds, result)
+		})
+	}
+}
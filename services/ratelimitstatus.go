@@ -0,0 +1,237 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 上游限额：解析经过中继的响应头中的组织级限额（OpenAI x-ratelimit-*、Anthropic anthropic-ratelimit-*），
+// 按 provider 记录最近一次的限额、剩余量与重置时间。剩余量低于限额的一定比例时，选路会优先使用其他 provider，
+// 避免等到上游返回 429 才切换。记录只保存在内存中，更换 API Key 后旧记录不再生效。
+
+const (
+	// rateLimitUnknownResetTTL 没有重置时间的记录的有效期
+	rateLimitUnknownResetTTL = time.Minute
+)
+
+// RelayRateLimitConfig 上游限额配置
+type RelayRateLimitConfig struct {
+	AvoidBelowPercent int `json:"avoidBelowPercent"` // 剩余额度低于限额的该百分比时优先使用其他 provider，0 表示不避让
+}
+
+// validateRateLimitConfig 校验上游限额配置
+func validateRateLimitConfig(config RelayRateLimitConfig) error {
+	if config.AvoidBelowPercent < 0 || config.AvoidBelowPercent > 50 {
+		return fmt.Errorf("限额避让阈值必须在 0-50%% 之间")
+	}
+	return nil
+}
+
+// RateLimitBucket 一类限额（请求数或 Token 数）
+type RateLimitBucket struct {
+	Limit     int64 `json:"limit"`
+	Remaining int64 `json:"remaining"`
+	ResetsAt  int64 `json:"resetsAt,omitempty"` // 重置时间（Unix 时间戳），0 表示未知
+}
+
+// RateLimitStatus provider 最近一次响应给出的限额
+type RateLimitStatus struct {
+	Platform     string           `json:"platform"`
+	Provider     string           `json:"provider"`
+	KeyHint      string           `json:"keyHint"` // 脱敏后的 API Key
+	Requests     *RateLimitBucket `json:"requests,omitempty"`
+	Tokens       *RateLimitBucket `json:"tokens,omitempty"`
+	InputTokens  *RateLimitBucket `json:"inputTokens,omitempty"`  // 仅 Anthropic
+	OutputTokens *RateLimitBucket `json:"outputTokens,omitempty"` // 仅 Anthropic
+	NearLimit    bool             `json:"nearLimit"`              // 剩余额度低于避让阈值
+	Stale        bool             `json:"stale"`                  // 已过重置时间
+	UpdatedAt    int64            `json:"updatedAt"`
+}
+
+// buckets 非空的限额
+func (s *RateLimitStatus) buckets() []*RateLimitBucket {
+	var result []*RateLimitBucket
+	for _, bucket := range []*RateLimitBucket{s.Requests, s.Tokens, s.InputTokens, s.OutputTokens} {
+		if bucket != nil {
+			result = append(result, bucket)
+		}
+	}
+	return result
+}
+
+// nearLimit 是否有限额的剩余量低于 percent%（已过重置时间的不算）
+func (s *RateLimitStatus) nearLimit(percent int, now time.Time) bool {
+	if percent <= 0 {
+		return false
+	}
+	for _, bucket := range s.buckets() {
+		if bucket.Limit <= 0 || bucket.Remaining*100 >= bucket.Limit*int64(percent) {
+			continue
+		}
+		if bucket.ResetsAt > 0 && now.Unix() < bucket.ResetsAt {
+			return true
+		}
+		if bucket.ResetsAt == 0 && now.Sub(time.Unix(s.UpdatedAt, 0)) < rateLimitUnknownResetTTL {
+			return true
+		}
+	}
+	return false
+}
+
+// stale 所有限额都已过重置时间
+func (s *RateLimitStatus) stale(now time.Time) bool {
+	for _, bucket := range s.buckets() {
+		if bucket.ResetsAt == 0 || now.Unix() < bucket.ResetsAt {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRateLimitHeaders 解析 x-ratelimit-* 与 anthropic-ratelimit-* 响应头，没有限额信息时返回 false
+func parseRateLimitHeaders(header http.Header, now time.Time) (RateLimitStatus, bool) {
+	var status RateLimitStatus
+	// OpenAI：x-ratelimit-{limit,remaining,reset}-{requests,tokens}，重置时间为 "6m0s" 形式的时长
+	status.Requests = parseRateLimitBucket(header, now,
+		"X-Ratelimit-Limit-Requests", "X-Ratelimit-Remaining-Requests", "X-Ratelimit-Reset-Requests")
+	status.Tokens = parseRateLimitBucket(header, now,
+		"X-Ratelimit-Limit-Tokens", "X-Ratelimit-Remaining-Tokens", "X-Ratelimit-Reset-Tokens")
+	// Anthropic：anthropic-ratelimit-{requests,tokens,input-tokens,output-tokens}-{limit,remaining,reset}，重置时间为 RFC 3339
+	anthropic := func(kind string) *RateLimitBucket {
+		prefix := "Anthropic-Ratelimit-" + kind + "-"
+		return parseRateLimitBucket(header, now, prefix+"Limit", prefix+"Remaining", prefix+"Reset")
+	}
+	if status.Requests == nil {
+		status.Requests = anthropic("Requests")
+	}
+	if status.Tokens == nil {
+		status.Tokens = anthropic("Tokens")
+	}
+	status.InputTokens = anthropic("Input-Tokens")
+	status.OutputTokens = anthropic("Output-Tokens")
+	if len(status.buckets()) == 0 {
+		return RateLimitStatus{}, false
+	}
+	status.UpdatedAt = now.Unix()
+	return status, true
+}
+
+// parseRateLimitBucket 解析一类限额，缺少限额或剩余量时返回 nil
+func parseRateLimitBucket(header http.Header, now time.Time, limitName, remainingName, resetName string) *RateLimitBucket {
+	limit, err := strconv.ParseInt(strings.TrimSpace(header.Get(limitName)), 10, 64)
+	if err != nil || limit <= 0 {
+		return nil
+	}
+	remaining, err := strconv.ParseInt(strings.TrimSpace(header.Get(remainingName)), 10, 64)
+	if err != nil || remaining < 0 {
+		return nil
+	}
+	bucket := &RateLimitBucket{Limit: limit, Remaining: remaining}
+	if reset := strings.TrimSpace(header.Get(resetName)); reset != "" {
+		if at, err := time.Parse(time.RFC3339, reset); err == nil {
+			bucket.ResetsAt = at.Unix()
+		} else if wait, err := time.ParseDuration(reset); err == nil && wait >= 0 {
+			// 向上取整到秒，避免不足 1 秒的重置时间被视为已重置
+			bucket.ResetsAt = now.Add(wait + time.Second - 1).Unix()
+		}
+	}
+	return bucket
+}
+
+type rateLimitEntry struct {
+	key    string // API Key 指纹，Key 更换后记录失效
+	status RateLimitStatus
+}
+
+// rateLimitTracker 各 provider 最近一次的限额（key: platform/provider）
+type rateLimitTracker struct {
+	mu      sync.Mutex
+	entries map[string]rateLimitEntry
+}
+
+func newRateLimitTracker() *rateLimitTracker {
+	return &rateLimitTracker{entries: make(map[string]rateLimitEntry)}
+}
+
+// observe 记录响应头中的限额
+func (t *rateLimitTracker) observe(kind string, provider Provider, header http.Header, now time.Time) {
+	if header == nil {
+		return
+	}
+	status, ok := parseRateLimitHeaders(header, now)
+	if !ok {
+		return
+	}
+	status.Platform = kind
+	status.Provider = provider.Name
+	status.KeyHint = maskAPIKey(provider.APIKey)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[kind+"/"+provider.Name] = rateLimitEntry{key: keyFingerprint(provider.APIKey), status: status}
+}
+
+// nearLimit provider 当前 Key 的剩余额度是否低于 percent%
+func (t *rateLimitTracker) nearLimit(kind string, provider Provider, percent int, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[kind+"/"+provider.Name]
+	if !ok || entry.key != keyFingerprint(provider.APIKey) {
+		return false
+	}
+	return entry.status.nearLimit(percent, now)
+}
+
+// avoidNearLimit 去掉额度将尽的 provider，全部额度将尽时保持原样
+func (t *rateLimitTracker) avoidNearLimit(kind string, providers []Provider, now time.Time) []Provider {
+	percent := currentRelayConfig().RateLimit.AvoidBelowPercent
+	if percent <= 0 || len(providers) < 2 {
+		return providers
+	}
+	kept := make([]Provider, 0, len(providers))
+	var avoided []string
+	for _, provider := range providers {
+		if t.nearLimit(kind, provider, percent, now) {
+			avoided = append(avoided, provider.Name)
+			continue
+		}
+		kept = append(kept, provider)
+	}
+	if len(kept) == 0 {
+		return providers
+	}
+	if len(avoided) > 0 {
+		fmt.Printf("[INFO] 📉 Provider %s 剩余额度低于 %d%%，优先使用其他 provider\n", strings.Join(avoided, ", "), percent)
+	}
+	return kept
+}
+
+// list 各 provider 的限额（按平台、名称排序）
+func (t *rateLimitTracker) list(now time.Time) []RateLimitStatus {
+	percent := currentRelayConfig().RateLimit.AvoidBelowPercent
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]RateLimitStatus, 0, len(t.entries))
+	for _, entry := range t.entries {
+		status := entry.status
+		status.NearLimit = status.nearLimit(percent, now)
+		status.Stale = status.stale(now)
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Platform != result[j].Platform {
+			return result[i].Platform < result[j].Platform
+		}
+		return result[i].Provider < result[j].Provider
+	})
+	return result
+}
+
+// GetRateLimitStatus 列出各 provider 最近一次响应给出的上游限额（供前端调用）
+func (prs *ProviderRelayService) GetRateLimitStatus() []RateLimitStatus {
+	return prs.rateLimits.list(time.Now())
+}
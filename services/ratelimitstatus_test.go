@@ -0,0 +1,52 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	if _, ok := parseRateLimitHeaders(http.Header{"Content-Type": {"application/json"}}, now); ok {
+		t.Fatalf("没有限额响应头时应返回 false")
+	}
+
+	openai := http.Header{}
+	openai.Set("x-ratelimit-limit-requests", "500")
+	openai.Set("x-ratelimit-remaining-requests", "10")
+	openai.Set("x-ratelimit-reset-requests", "1m30s")
+	openai.Set("x-ratelimit-limit-tokens", "30000")
+	openai.Set("x-ratelimit-remaining-tokens", "29000")
+	openai.Set("x-ratelimit-reset-tokens", "20ms")
+	status, ok := parseRateLimitHeaders(openai, now)
+	if !ok || status.Requests == nil || status.Tokens == nil {
+		t.Fatalf("status = %+v, ok = %v", status, ok)
+	}
+	if status.Requests.Remaining != 10 || status.Requests.ResetsAt != now.Unix()+90 || status.Tokens.ResetsAt != now.Unix()+1 {
+		t.Fatalf("requests = %+v, tokens = %+v", status.Requests, status.Tokens)
+	}
+	if !status.nearLimit(5, now) || status.nearLimit(1, now) {
+		t.Fatalf("剩余 2%% 的请求数应低于 5%% 阈值、不低于 1%% 阈值")
+	}
+	if status.nearLimit(5, now.Add(2*time.Minute)) {
+		t.Fatalf("已过重置时间不应再避让")
+	}
+
+	anthropic := http.Header{}
+	anthropic.Set("anthropic-ratelimit-requests-limit", "50")
+	anthropic.Set("anthropic-ratelimit-requests-remaining", "49")
+	anthropic.Set("anthropic-ratelimit-requests-reset", "2025-10-09T08:54:20Z")
+	anthropic.Set("anthropic-ratelimit-output-tokens-limit", "8000")
+	anthropic.Set("anthropic-ratelimit-output-tokens-remaining", "0")
+	status, ok = parseRateLimitHeaders(anthropic, now)
+	if !ok || status.Requests == nil || status.OutputTokens == nil || status.InputTokens != nil {
+		t.Fatalf("status = %+v, ok = %v", status, ok)
+	}
+	if status.Requests.ResetsAt != time.Date(2025, 10, 9, 8, 54, 20, 0, time.UTC).Unix() {
+		t.Fatalf("requests = %+v", status.Requests)
+	}
+	if !status.nearLimit(5, now.Add(30*time.Second)) || status.nearLimit(5, now.Add(2*time.Minute)) {
+		t.Fatalf("没有重置时间的限额只在 1 分钟内有效")
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// 分阶段启动：窗口显示前只创建各服务的实例；应用启动（窗口显示）后先初始化数据库，
+// 再并行启动自检、中继监听与各后台服务。每个服务启动完成（或失败）时发送 service:ready 事件，
+// 全部完成后发送 app:ready，前端也可随时通过 GetReadiness 查询当前进度。
+
+// 启动阶段
+const (
+	StartupPhaseCore       = "core"       // 数据库等基础设施，其余服务在其完成后启动
+	StartupPhaseBackground = "background" // 基础设施就绪后并行启动
+)
+
+// 服务启动状态
+const (
+	ServicePending  = "pending"
+	ServiceStarting = "starting"
+	ServiceReady    = "ready"
+	ServiceFailed   = "failed"
+)
+
+// ServiceReadiness 单个服务的启动状态
+type ServiceReadiness struct {
+	Name       string `json:"name"`
+	Phase      string `json:"phase"`
+	State      string `json:"state"`
+	Error      string `json:"error,omitempty"`
+	ReadyAt    int64  `json:"readyAt,omitempty"` // 毫秒
+	DurationMs int64  `json:"durationMs"`
+}
+
+// ReadinessReport 启动进度
+type ReadinessReport struct {
+	Ready     bool               `json:"ready"` // 所有服务均已启动完成（含失败）
+	StartedAt int64              `json:"startedAt"`
+	ElapsedMs int64              `json:"elapsedMs"`
+	Services  []ServiceReadiness `json:"services"`
+}
+
+// ReadinessService 记录各服务的启动进度
+type ReadinessService struct {
+	mu                  sync.Mutex
+	notificationService *NotificationService
+	startedAt           time.Time
+	services            []*ServiceReadiness
+	index               map[string]*ServiceReadiness
+	sealed              bool // 已登记全部服务，之后全部完成即视为就绪
+	announced           bool
+}
+
+// NewReadinessService 创建启动进度服务（创建时间即为启动计时起点，应在初始化数据库前创建）
+func NewReadinessService() *ReadinessService {
+	return &ReadinessService{
+		startedAt: time.Now(),
+		index:     make(map[string]*ServiceReadiness),
+	}
+}
+
+// SetNotificationService 设置事件通知（通知服务创建前完成的启动项不发送事件）
+func (rs *ReadinessService) SetNotificationService(notificationService *NotificationService) {
+	rs.mu.Lock()
+	rs.notificationService = notificationService
+	rs.mu.Unlock()
+}
+
+func (rs *ReadinessService) Start() error { return nil }
+func (rs *ReadinessService) Stop() error  { return nil }
+
+// Register 登记待启动的服务
+func (rs *ReadinessService) Register(phase, name string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.entryLocked(phase, name)
+}
+
+func (rs *ReadinessService) entryLocked(phase, name string) *ServiceReadiness {
+	if entry, ok := rs.index[name]; ok {
+		return entry
+	}
+	entry := &ServiceReadiness{Name: name, Phase: phase, State: ServicePending}
+	rs.services = append(rs.services, entry)
+	rs.index[name] = entry
+	return entry
+}
+
+// Seal 表示已登记全部服务（在窗口显示前调用，避免部分服务完成时就误报全部就绪）
+func (rs *ReadinessService) Seal() {
+	rs.mu.Lock()
+	rs.sealed = true
+	rs.mu.Unlock()
+	rs.announceIfReady()
+}
+
+// Run 启动服务并记录耗时与结果，失败只记录不中断后续服务
+func (rs *ReadinessService) Run(phase, name string, start func() error) error {
+	rs.mu.Lock()
+	entry := rs.entryLocked(phase, name)
+	entry.State = ServiceStarting
+	rs.mu.Unlock()
+
+	began := time.Now()
+	err := start()
+
+	rs.mu.Lock()
+	entry.DurationMs = time.Since(began).Milliseconds()
+	entry.ReadyAt = time.Now().UnixMilli()
+	if err != nil {
+		entry.State = ServiceFailed
+		entry.Error = err.Error()
+	} else {
+		entry.State = ServiceReady
+	}
+	status := *entry
+	notifier := rs.notificationService
+	rs.mu.Unlock()
+
+	if err != nil {
+		log.Printf("⚠️  [Startup] %s 启动失败（%dms）: %v", name, status.DurationMs, err)
+	} else if status.DurationMs >= 500 {
+		log.Printf("🐢 [Startup] %s 启动耗时 %dms", name, status.DurationMs)
+	}
+	if notifier != nil {
+		notifier.NotifyServiceReady(status)
+	}
+	rs.announceIfReady()
+	return err
+}
+
+// announceIfReady 全部服务启动完成后发送一次 app:ready
+func (rs *ReadinessService) announceIfReady() {
+	rs.mu.Lock()
+	if rs.announced || !rs.sealed || !rs.readyLocked() {
+		rs.mu.Unlock()
+		return
+	}
+	rs.announced = true
+	report := rs.reportLocked()
+	notifier := rs.notificationService
+	rs.mu.Unlock()
+
+	log.Printf("✅ [Startup] 全部服务已启动，耗时 %dms", report.ElapsedMs)
+	if notifier != nil {
+		notifier.NotifyAppReady(report)
+	}
+}
+
+func (rs *ReadinessService) readyLocked() bool {
+	for _, entry := range rs.services {
+		if entry.State == ServicePending || entry.State == ServiceStarting {
+			return false
+		}
+	}
+	return true
+}
+
+func (rs *ReadinessService) reportLocked() ReadinessReport {
+	report := ReadinessReport{
+		Ready:     rs.sealed && rs.readyLocked(),
+		StartedAt: rs.startedAt.UnixMilli(),
+		ElapsedMs: time.Since(rs.startedAt).Milliseconds(),
+		Services:  make([]ServiceReadiness, 0, len(rs.services)),
+	}
+	if report.Ready {
+		// 就绪后耗时固定为最后一个服务完成的时间
+		var last int64
+		for _, entry := range rs.services {
+			if entry.ReadyAt > last {
+				last = entry.ReadyAt
+			}
+		}
+		if last > 0 {
+			report.ElapsedMs = last - report.StartedAt
+		}
+	}
+	for _, entry := range rs.services {
+		report.Services = append(report.Services, *entry)
+	}
+	return report
+}
+
+// GetReadiness 获取启动进度（供前端调用）
+func (rs *ReadinessService) GetReadiness() ReadinessReport {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.reportLocked()
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadinessReport(t *testing.T) {
+	rs := NewReadinessService()
+	_ = rs.Run(StartupPhaseCore, "database", func() error { return nil })
+	rs.Register(StartupPhaseBackground, "relay")
+	rs.Register(StartupPhaseBackground, "jobs")
+	rs.Seal()
+	if report := rs.GetReadiness(); report.Ready || len(report.Services) != 3 {
+		t.Fatalf("仍有服务未启动时不应就绪: %+v", report)
+	}
+
+	_ = rs.Run(StartupPhaseBackground, "relay", func() error { return nil })
+	if err := rs.Run(StartupPhaseBackground, "jobs", func() error { return errors.New("boom") }); err == nil {
+		t.Error("Run 应返回启动错误")
+	}
+	report := rs.GetReadiness()
+	if !report.Ready {
+		t.Fatalf("全部服务启动完成（含失败）后应就绪: %+v", report)
+	}
+	if last := report.Services[2]; last.State != ServiceFailed || last.Error != "boom" {
+		t.Errorf("应记录启动失败: %+v", last)
+	}
+}
@@ -0,0 +1,651 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RelayConfig 中继服务的可选功能配置（保存在 relay-config.json）
+// 所有功能默认关闭，未出现在文件中的字段使用默认值，向后兼容
+type RelayConfig struct {
+	Dedup          RelayDedupConfig          `json:"dedup"`                // 相同并发请求合并
+	Transcript     RelayTranscriptConfig     `json:"transcript"`           // 对话历史记录
+	Client         RelayClientConfig         `json:"client"`               // 客户端识别
+	Budget         RelayBudgetConfig         `json:"budget"`               // 每日预算与模型降级
+	Offline        RelayOfflineConfig        `json:"offline"`              // 离线模式
+	LatencyAlert   RelayLatencyAlertConfig   `json:"latencyAlert"`         // 端点延迟趋势告警
+	LatencyClass   RelayLatencyClassConfig   `json:"latencyClass"`         // 端点延迟分级阈值
+	SLO            RelaySLOConfig            `json:"slo"`                  // 响应延迟 SLO
+	Retention      RelayRetentionConfig      `json:"retention"`            // 请求日志保留与汇总
+	Report         RelayReportConfig         `json:"report"`               // 定期摘要报告
+	BackgroundTest RelayBackgroundTestConfig `json:"backgroundTest"`       // 后台测速调度
+	Priority       RelayPriorityConfig       `json:"priority"`             // 请求优先级
+	Embeddings     RelayEmbeddingsConfig     `json:"embeddings"`           // 嵌入请求选路与缓存
+	Masking        RelayMaskingConfig        `json:"masking"`              // 写入数据库前脱敏
+	AdminAPI       RelayAdminAPIConfig       `json:"adminApi"`             // 管理接口
+	KeyHealth      RelayKeyHealthConfig      `json:"keyHealth"`            // 密钥有效性与余额检查
+	AuthFailure    RelayAuthFailureConfig    `json:"authFailure"`          // 连续 401 自动停用
+	Canary         RelayCanaryConfig         `json:"canary"`               // 灰度切换
+	Domains        RelayDomainConfig         `json:"domains"`              // 上游域名允许/拒绝列表
+	Discovery      RelayDiscoveryConfig      `json:"discovery"`            // 局域网广播与发现
+	HA             RelayHAConfig             `json:"ha"`                   // 主备中继配对
+	StatusPage     RelayStatusPageConfig     `json:"statusPage"`           // 上游官方状态页
+	Editor         RelayEditorConfig         `json:"editor"`               // 编辑器扩展接口
+	StatusLine     RelayStatusLineConfig     `json:"statusLine"`           // 终端/IDE 状态栏快照
+	MCP            RelayMCPConfig            `json:"mcp"`                  // MCP 管理工具（/mcp）
+	CORS           RelayCORSConfig           `json:"cors"`                 // 浏览器客户端访问
+	ListenPort     int                       `json:"listenPort,omitempty"` // 中继监听端口，0 表示默认 18100（修改后需重启）
+	Socket         RelaySocketConfig         `json:"socket"`               // 同时在 Unix socket 上监听（修改后需重启）
+	PAC            RelayPACConfig            `json:"pac"`                  // 按 PAC 脚本选择上游代理
+	RetryAfter     RelayRetryAfterConfig     `json:"retryAfter"`           // 上游限流（429/503 Retry-After）冷却
+	Hooks          RelayHooksConfig          `json:"hooks"`                // 转发前/响应后运行的用户脚本
+	Rules          RelayRulesConfig          `json:"rules"`                // 按表达式选路或拒绝请求
+	UsageWindow    RelayUsageWindowConfig    `json:"usageWindow"`          // Claude 订阅账号用量窗口轮换
+	RateLimit      RelayRateLimitConfig      `json:"rateLimit"`            // 按上游限额响应头提前避让
+	Weights        RelayWeightsConfig        `json:"weights"`              // 按模型的路由权重
+	Collector      RelayCollectorConfig      `json:"collector"`            // 多机用量汇总
+	Capabilities   RelayCapabilitiesConfig   `json:"capabilities"`         // 社区能力数据集与本地覆盖
+	CrashReport    RelayCrashReportConfig    `json:"crashReport"`          // 崩溃报告提交
+
+	AttributionHeaders bool `json:"attributionHeaders"` // 在响应头中返回实际 provider、耗时与重试次数（X-CodeSwitch-*）
+}
+
+// RelayDiscoveryConfig 局域网 mDNS 广播配置（修改后需重启）
+type RelayDiscoveryConfig struct {
+	Advertise bool   `json:"advertise"`      // 是否在局域网广播本机中继，供其他实例发现
+	Name      string `json:"name,omitempty"` // 广播名称，为空时使用主机名
+}
+
+// RelayHAConfig 主备中继配对配置：两个实例互相配置对方地址与相同的共享密钥
+type RelayHAConfig struct {
+	PeerURL         string `json:"peerUrl,omitempty"` // 对端中继地址（如 http://192.168.1.20:18100），为空表示不启用
+	Secret          string `json:"secret,omitempty"`  // 共享密钥，两端必须一致
+	SyncIntervalSec int    `json:"syncIntervalSec"`   // 同步间隔（秒）
+}
+
+// RelayStatusPageConfig 上游官方状态页检查配置
+type RelayStatusPageConfig struct {
+	Enabled            bool              `json:"enabled"`            // 是否定期检查官方状态页
+	IntervalMinutes    int               `json:"intervalMinutes"`    // 检查间隔（分钟）
+	SuppressEscalation bool              `json:"suppressEscalation"` // 上游确认故障期间不提升拉黑等级
+	Pages              map[string]string `json:"pages,omitempty"`    // 按平台覆盖状态页地址，"-" 表示不检查该平台
+}
+
+// RelayEditorConfig 编辑器扩展接口配置（/editor/*，仅限本机访问，地址与令牌写入 ~/.code-switch/editor.json）
+type RelayEditorConfig struct {
+	Enabled bool `json:"enabled"` // 是否启用编辑器接口
+	Socket  bool `json:"socket"`  // 同时通过本地 socket 推送状态变化事件
+}
+
+// RelayStatusLineConfig 状态栏快照配置：定期写入 ~/.code-switch/statusline.json，供 shell 提示符、tmux 等读取
+type RelayStatusLineConfig struct {
+	Enabled bool `json:"enabled"` // 是否定期写入状态快照
+}
+
+// RelayMCPConfig MCP 服务配置：以 Streamable HTTP 方式在 /mcp 提供管理工具（仅限本机访问）
+type RelayMCPConfig struct {
+	Enabled     bool `json:"enabled"`     // 是否启用 MCP 服务
+	AllowSwitch bool `json:"allowSwitch"` // 是否允许通过 MCP 切换 provider
+}
+
+// RelayCORSConfig 浏览器客户端支持：为转发类接口返回 CORS 头并处理 OPTIONS 预检，只允许白名单中的来源
+type RelayCORSConfig struct {
+	Enabled        bool     `json:"enabled"`                  // 是否允许网页调用中继
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"` // 允许的来源，如 http://localhost:3000；支持 * 通配（http://localhost:*），单独的 * 表示任意来源
+	MaxAgeSeconds  int      `json:"maxAgeSeconds"`            // 预检结果缓存时间（秒）
+}
+
+// RelayPACConfig 代理自动配置：转发请求按目标地址执行 PAC 脚本选择代理，与浏览器的代理决策一致
+type RelayPACConfig struct {
+	Enabled      bool   `json:"enabled"`       // 是否按 PAC 选择代理（未启用时使用系统代理环境变量）
+	URL          string `json:"url,omitempty"` // PAC 地址（http(s):// 或 file://），为空时读取系统设置
+	CacheMinutes int    `json:"cacheMinutes"`  // PAC 脚本与解析结果的缓存时间（分钟）
+}
+
+// RelayRetryAfterConfig 上游限流处理：429/503 带 Retry-After 时暂停转发到该 provider，不计入失败次数
+type RelayRetryAfterConfig struct {
+	Enabled            bool `json:"enabled"`            // 是否按 Retry-After 冷却（关闭时限流按普通失败处理）
+	MaxWaitSeconds     int  `json:"maxWaitSeconds"`     // 没有其他可用 provider 时最多原地等待的秒数，超过则向客户端返回 429
+	MaxCooldownSeconds int  `json:"maxCooldownSeconds"` // 单次冷却时间上限（秒），避免异常的 Retry-After 长期停用 provider
+}
+
+// RelaySocketConfig 中继 Unix socket 配置：本机工具不占用端口即可连接，访问权限由文件权限控制
+type RelaySocketConfig struct {
+	Enabled bool   `json:"enabled"`        // 是否同时在 socket 上监听
+	Path    string `json:"path,omitempty"` // socket 路径，默认 ~/.code-switch/relay.sock
+	Mode    string `json:"mode,omitempty"` // 文件权限（八进制），默认 0600
+}
+
+// defaultRelayPort 中继默认监听端口
+const defaultRelayPort = 18100
+
+// RelayDedupConfig 相同请求合并配置
+type RelayDedupConfig struct {
+	Enabled  bool            `json:"enabled"`          // 是否启用请求合并
+	WindowMs int             `json:"windowMs"`         // 上游完成后继续复用响应的时间窗口（毫秒）
+	Routes   map[string]bool `json:"routes,omitempty"` // 按路由开关（"/v1/messages"、"/responses"、"/gemini"），未配置的路由跟随 Enabled
+}
+
+// RelayTranscriptConfig 对话历史记录配置
+type RelayTranscriptConfig struct {
+	Enabled bool   `json:"enabled"` // 是否记录经过中继的对话
+	Mode    string `json:"mode"`    // hash: 仅保存内容哈希；full: 保存完整内容
+}
+
+// RelayClientConfig 客户端识别配置
+type RelayClientConfig struct {
+	ResolveProcess   bool              `json:"resolveProcess"`             // 通过来源端口反查本机进程名（需调用系统命令，默认关闭）
+	ProjectByProcess map[string]string `json:"projectByProcess,omitempty"` // 进程名 → 项目，请求未带 X-CodeSwitch-Project 时按进程归属项目（需开启 resolveProcess）
+}
+
+// RelayBudgetConfig 每日预算与自动模型降级配置
+type RelayBudgetConfig struct {
+	DailyLimitUSD      float64           `json:"dailyLimitUsd"`            // 每日预算（美元），0 表示不限制
+	DowngradeEnabled   bool              `json:"downgradeEnabled"`         // 是否在预算紧张时自动降级模型
+	DowngradeThreshold int               `json:"downgradeThreshold"`       // 触发降级的预算使用百分比
+	DowngradeRules     map[string]string `json:"downgradeRules,omitempty"` // 降级规则（支持 * 通配符），为空时使用内置规则
+}
+
+// RelayOfflineConfig 离线模式配置
+type RelayOfflineConfig struct {
+	Enabled          bool     `json:"enabled"`                // 是否启用断网检测
+	ProbeIntervalSec int      `json:"probeIntervalSec"`       // 探测间隔（秒）
+	ProbeTargets     []string `json:"probeTargets,omitempty"` // 探测目标（host:port），为空时使用内置目标
+}
+
+// RelayLatencyAlertConfig 端点延迟趋势告警配置
+type RelayLatencyAlertConfig struct {
+	Enabled       bool    `json:"enabled"`              // 是否启用延迟劣化告警
+	DegradeFactor float64 `json:"degradeFactor"`        // 24 小时中位数达到基线的多少倍视为劣化
+	MinSamples    int     `json:"minSamples"`           // 24 小时与基线窗口各自至少需要的样本数
+	WebhookURL    string  `json:"webhookUrl,omitempty"` // 可选：告警推送地址（POST JSON）
+}
+
+// RelaySLOConfig 响应延迟 SLO 配置：按平台定义延迟目标，基于请求日志计算，记录违约区间并按消耗速率告警
+type RelaySLOConfig struct {
+	Enabled       bool           `json:"enabled"`              // 是否定期评估 SLO
+	Objectives    []SLOObjective `json:"objectives,omitempty"` // SLO 定义
+	BurnRateAlert float64        `json:"burnRateAlert"`        // 短窗口（1 小时）与长窗口（6 小时）的消耗速率均达到该值时告警
+	MinSamples    int            `json:"minSamples"`           // 窗口内至少需要的请求数，样本不足时不判定
+	WebhookURL    string         `json:"webhookUrl,omitempty"` // 可选：告警推送地址（POST JSON）
+}
+
+// RelayRetentionConfig 请求日志保留策略：后台按小时/天汇总请求指标，原始记录超过保留期后清理（只清理已汇总的部分）
+type RelayRetentionConfig struct {
+	RawDays    int `json:"rawDays"`    // 原始请求日志保留天数，0 表示永久保留
+	HourlyDays int `json:"hourlyDays"` // 小时汇总保留天数，0 表示永久保留
+	DailyDays  int `json:"dailyDays"`  // 天汇总保留天数，0 表示永久保留
+}
+
+// RelayReportConfig 定期摘要报告配置：花费、主要模型、provider 可靠性、拉黑与故障、延迟变化
+type RelayReportConfig struct {
+	Enabled    bool   `json:"enabled"`              // 是否定期生成
+	Period     string `json:"period"`               // daily / weekly
+	Hour       int    `json:"hour"`                 // 每天几点（本地时间）生成上一周期的报告
+	Weekday    int    `json:"weekday"`              // 周报生成日（0 为周日）
+	Format     string `json:"format"`               // markdown / html
+	Dir        string `json:"dir,omitempty"`        // 保存目录，默认 ~/.code-switch/reports
+	Notify     bool   `json:"notify"`               // 生成后发送桌面通知
+	WebhookURL string `json:"webhookUrl,omitempty"` // 可选：推送地址（POST JSON，包含报告全文）
+}
+
+// RelayBackgroundTestConfig 后台测速调度配置：避开计费网络与中继繁忙时段
+type RelayBackgroundTestConfig struct {
+	DeferWhenBusy   bool `json:"deferWhenBusy"`   // 中继有请求时推迟后台测速
+	IdleSeconds     int  `json:"idleSeconds"`     // 距最近一次请求多少秒后视为空闲
+	MaxDeferMinutes int  `json:"maxDeferMinutes"` // 因繁忙最多连续推迟多少分钟，0 表示不限
+	DetectMetered   bool `json:"detectMetered"`   // 自动检测计费网络（Windows 系统设置 / macOS 手机热点 / Linux NetworkManager），需调用系统命令，默认关闭
+	TreatAsMetered  bool `json:"treatAsMetered"`  // 手动标记当前网络为计费网络
+}
+
+// RelayPriorityConfig 请求优先级配置（仅对配置了并发上限的 provider 生效）
+type RelayPriorityConfig struct {
+	DefaultClass    string            `json:"defaultClass"`            // 未指定时的优先级：interactive / batch
+	ClientClasses   map[string]string `json:"clientClasses,omitempty"` // 按客户端工具指定优先级，如 {"aider": "batch"}
+	QueueTimeoutSec int               `json:"queueTimeoutSec"`         // 排队等待上限（秒），超时后尝试下一个 provider，0 表示不限
+}
+
+// RelayEmbeddingsConfig 嵌入请求配置：与聊天请求分开选路，并按输入缓存向量
+type RelayEmbeddingsConfig struct {
+	Providers    []string `json:"providers,omitempty"` // 嵌入请求使用的 codex provider（按顺序尝试），为空时按 Level 使用全部 provider
+	CacheEnabled bool     `json:"cacheEnabled"`        // 是否在本地缓存嵌入向量
+	CacheTTLDays int      `json:"cacheTtlDays"`        // 缓存有效天数
+}
+
+// RelayMaskingConfig 敏感信息脱敏配置：写入请求日志、对话记录、审计日志前替换匹配内容
+type RelayMaskingConfig struct {
+	Enabled        bool          `json:"enabled"`                  // 是否启用脱敏
+	BuiltinRules   []string      `json:"builtinRules"`             // 启用的内置规则：email、phone、path、api_key
+	CustomPatterns []MaskPattern `json:"customPatterns,omitempty"` // 用户自定义正则，在内置规则之后执行
+}
+
+// RelayAdminAPIConfig 管理接口配置（/admin/*，与中继共用端口）
+type RelayAdminAPIConfig struct {
+	Enabled bool         `json:"enabled"`          // 是否启用管理接口
+	Tokens  []AdminToken `json:"tokens,omitempty"` // 访问令牌及其权限
+}
+
+// RelayKeyHealthConfig 密钥健康检查配置
+type RelayKeyHealthConfig struct {
+	Enabled             bool    `json:"enabled"`             // 是否定期检查
+	IntervalMinutes     int     `json:"intervalMinutes"`     // 检查间隔（分钟）
+	LowBalanceThreshold float64 `json:"lowBalanceThreshold"` // 剩余额度低于该值时告警（按接口返回的单位）
+}
+
+// RelayAuthFailureConfig 密钥失效自动停用配置
+type RelayAuthFailureConfig struct {
+	Enabled   bool `json:"enabled"`   // 是否在连续 401 后自动停用 provider
+	Threshold int  `json:"threshold"` // 连续 401 次数阈值
+}
+
+// RelayCanaryConfig 灰度切换配置
+type RelayCanaryConfig struct {
+	Steps           []int   `json:"steps"`           // 新 provider 的流量比例，逐步递增，最后一步须为 100
+	WindowMinutes   int     `json:"windowMinutes"`   // 默认灰度窗口（分钟），各步骤平分
+	MinSamples      int     `json:"minSamples"`      // 新 provider 至少多少次请求后才判断是否回滚
+	ErrorRateMargin float64 `json:"errorRateMargin"` // 新 provider 错误率超过原 provider 多少（0-1）时回滚
+}
+
+// RelayDomainConfig 上游域名允许/拒绝列表（支持 *.example.com 匹配子域名），防止误用仿冒的镜像域名
+type RelayDomainConfig struct {
+	Allow []string `json:"allow,omitempty"` // 非空时只允许访问列表中的域名
+	Deny  []string `json:"deny,omitempty"`  // 始终拒绝的域名，优先于 Allow
+}
+
+// DefaultRelayConfig 返回默认的中继配置
+func DefaultRelayConfig() *RelayConfig {
+	return &RelayConfig{
+		Dedup: RelayDedupConfig{
+			Enabled:  false,
+			WindowMs: 2000,
+		},
+		Transcript: RelayTranscriptConfig{
+			Enabled: false,
+			Mode:    TranscriptModeHash,
+		},
+		Budget: RelayBudgetConfig{
+			DowngradeThreshold: 80,
+		},
+		Offline: RelayOfflineConfig{
+			Enabled:          false,
+			ProbeIntervalSec: 30,
+		},
+		BackgroundTest: RelayBackgroundTestConfig{
+			DeferWhenBusy:   true,
+			IdleSeconds:     30,
+			MaxDeferMinutes: 15,
+		},
+		Priority: RelayPriorityConfig{
+			DefaultClass:    PriorityInteractive,
+			QueueTimeoutSec: 60,
+		},
+		Embeddings: RelayEmbeddingsConfig{
+			CacheEnabled: true,
+			CacheTTLDays: 30,
+		},
+		Canary: RelayCanaryConfig{
+			Steps:           []int{10, 50, 100},
+			WindowMinutes:   30,
+			MinSamples:      10,
+			ErrorRateMargin: 0.05,
+		},
+		AuthFailure: RelayAuthFailureConfig{
+			Enabled:   true,
+			Threshold: 3,
+		},
+		KeyHealth: RelayKeyHealthConfig{
+			Enabled:             true,
+			IntervalMinutes:     60,
+			LowBalanceThreshold: 5,
+		},
+		Masking: RelayMaskingConfig{
+			Enabled:      false,
+			BuiltinRules: BuiltinMaskRuleNames(),
+		},
+		LatencyAlert: RelayLatencyAlertConfig{
+			Enabled:       false,
+			DegradeFactor: 2,
+			MinSamples:    3,
+		},
+		LatencyClass: RelayLatencyClassConfig{
+			GoodMs:     300,
+			DegradedMs: 1000,
+		},
+		SLO: RelaySLOConfig{
+			BurnRateAlert: 2,
+			MinSamples:    20,
+		},
+		Retention: RelayRetentionConfig{
+			HourlyDays: 90,
+		},
+		Report: RelayReportConfig{
+			Period:  ReportPeriodWeekly,
+			Hour:    9,
+			Weekday: int(time.Monday),
+			Format:  ReportFormatMarkdown,
+			Notify:  true,
+		},
+		HA: RelayHAConfig{
+			SyncIntervalSec: 10,
+		},
+		StatusPage: RelayStatusPageConfig{
+			IntervalMinutes: 5,
+		},
+		Editor: RelayEditorConfig{
+			Socket: true,
+		},
+		MCP: RelayMCPConfig{
+			AllowSwitch: true,
+		},
+		CORS: RelayCORSConfig{
+			MaxAgeSeconds: 600,
+		},
+		PAC: RelayPACConfig{
+			CacheMinutes: 30,
+		},
+		RetryAfter: RelayRetryAfterConfig{
+			Enabled:            true,
+			MaxWaitSeconds:     5,
+			MaxCooldownSeconds: 600,
+		},
+		UsageWindow: RelayUsageWindowConfig{
+			Enabled: true,
+		},
+		RateLimit: RelayRateLimitConfig{
+			AvoidBelowPercent: 5,
+		},
+		Collector: RelayCollectorConfig{
+			IntervalMinutes: 15,
+		},
+		Capabilities: RelayCapabilitiesConfig{
+			RefreshHours: 24,
+		},
+	}
+}
+
+// GetRelayConfigPath 获取中继配置文件路径
+func GetRelayConfigPath() (string, error) {
+	configDir := getConfigDir()
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return "", fmt.Errorf("创建配置目录失败: %w", err)
+	}
+
+	return filepath.Join(configDir, "relay-config.json"), nil
+}
+
+// LoadRelayConfig 读取中继配置，文件不存在时返回默认配置
+func LoadRelayConfig() (*RelayConfig, error) {
+	configPath, err := GetRelayConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultRelayConfig()
+	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取中继配置失败: %w", err)
+	}
+	if len(data) > 0 {
+		// 在默认值之上反序列化，缺失字段保持默认
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("解析中继配置失败: %w", err)
+		}
+	}
+
+	// 管理员策略锁定的设置优先于本地配置
+	if err := currentPolicy().applyRelayConfig(config); err != nil {
+		return nil, fmt.Errorf("应用管理员策略失败: %w", err)
+	}
+	return config, nil
+}
+
+// currentRelayConfig 读取中继配置，失败时回退默认值（供请求热路径使用，不阻断转发）
+// 中继启动后从配置快照读取，不再每次读文件；返回值只做浅拷贝，其中的 map 与切片与快照共享，调用方只读不写
+func currentRelayConfig() *RelayConfig {
+	if snapshot := activeConfigSnapshot.Load(); snapshot != nil && snapshot.relay != nil {
+		config := *snapshot.relay
+		return &config
+	}
+	config, err := LoadRelayConfig()
+	if err != nil {
+		log.Printf("⚠️  读取中继配置失败，使用默认值: %v", err)
+		return DefaultRelayConfig()
+	}
+	return config
+}
+
+// RelayListenAddr 返回中继监听地址（如 ":18100"），供启动时创建中继服务使用
+func RelayListenAddr() string {
+	port := currentRelayConfig().ListenPort
+	if port <= 0 {
+		port = defaultRelayPort
+	}
+	return fmt.Sprintf(":%d", port)
+}
+
+// GetRelayConfig 获取中继配置（供前端调用）
+func (ss *SettingsService) GetRelayConfig() (*RelayConfig, error) {
+	return LoadRelayConfig()
+}
+
+// UpdateRelayConfig 校验并保存中继配置（供前端调用）
+func (ss *SettingsService) UpdateRelayConfig(config *RelayConfig) error {
+	if config == nil {
+		return fmt.Errorf("配置不能为空")
+	}
+	if err := currentPolicy().checkRelayConfig(config); err != nil {
+		return err
+	}
+	if err := validateRelayConfig(config); err != nil {
+		return err
+	}
+
+	configPath, err := GetRelayConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := AtomicWriteJSON(configPath, config); err != nil {
+		return err
+	}
+	recordConfigIntegrity(configPath)
+	refreshConfigSnapshot()
+	return nil
+}
+
+// validateRelayConfig 验证中继配置
+func validateRelayConfig(config *RelayConfig) error {
+	if config.Dedup.WindowMs < 0 || config.Dedup.WindowMs > 60000 {
+		return fmt.Errorf("请求合并窗口必须在 0-60000 毫秒之间")
+	}
+	switch config.Transcript.Mode {
+	case "", TranscriptModeHash, TranscriptModeFull:
+	default:
+		return fmt.Errorf("无效的对话记录模式: %s", config.Transcript.Mode)
+	}
+	if config.Budget.DailyLimitUSD < 0 {
+		return fmt.Errorf("每日预算不能为负数")
+	}
+	if config.Budget.DowngradeThreshold < 1 || config.Budget.DowngradeThreshold > 100 {
+		return fmt.Errorf("降级阈值必须在 1-100 之间")
+	}
+	if config.Offline.ProbeIntervalSec < 5 || config.Offline.ProbeIntervalSec > 3600 {
+		return fmt.Errorf("网络探测间隔必须在 5-3600 秒之间")
+	}
+	if err := validateProjectByProcess(config.Client.ProjectByProcess); err != nil {
+		return err
+	}
+	if config.ListenPort != 0 && (config.ListenPort < 1024 || config.ListenPort > 65535) {
+		return fmt.Errorf("监听端口必须在 1024-65535 之间")
+	}
+	if config.LatencyAlert.DegradeFactor < 1.1 || config.LatencyAlert.DegradeFactor > 20 {
+		return fmt.Errorf("延迟劣化倍数必须在 1.1-20 之间")
+	}
+	if config.LatencyAlert.MinSamples < 1 {
+		return fmt.Errorf("延迟告警最少样本数必须大于 0")
+	}
+	if err := validateLatencyClassConfig(config.LatencyClass); err != nil {
+		return err
+	}
+	if err := validateSLOConfig(config.SLO); err != nil {
+		return err
+	}
+	if err := validateRetentionConfig(config.Retention); err != nil {
+		return err
+	}
+	if err := validateReportConfig(config.Report); err != nil {
+		return err
+	}
+	if config.BackgroundTest.IdleSeconds < 0 || config.BackgroundTest.IdleSeconds > 3600 {
+		return fmt.Errorf("空闲判定时间必须在 0-3600 秒之间")
+	}
+	if config.BackgroundTest.MaxDeferMinutes < 0 {
+		return fmt.Errorf("最大推迟时间不能为负数")
+	}
+	if config.Priority.DefaultClass != "" && !isValidPriority(config.Priority.DefaultClass) {
+		return fmt.Errorf("无效的默认优先级: %s（可选值: interactive、batch）", config.Priority.DefaultClass)
+	}
+	for tool, class := range config.Priority.ClientClasses {
+		if !isValidPriority(class) {
+			return fmt.Errorf("客户端 %s 的优先级无效: %s", tool, class)
+		}
+	}
+	if config.Priority.QueueTimeoutSec < 0 {
+		return fmt.Errorf("排队超时不能为负数")
+	}
+	if config.Embeddings.CacheTTLDays < 1 || config.Embeddings.CacheTTLDays > 365 {
+		return fmt.Errorf("嵌入缓存有效期必须在 1-365 天之间")
+	}
+	if err := validateMaskingConfig(config.Masking); err != nil {
+		return err
+	}
+	if err := validateAdminAPIConfig(config.AdminAPI); err != nil {
+		return err
+	}
+	if config.KeyHealth.IntervalMinutes < 5 || config.KeyHealth.IntervalMinutes > 24*60 {
+		return fmt.Errorf("密钥检查间隔必须在 5-1440 分钟之间")
+	}
+	if err := validateCanaryConfig(config.Canary); err != nil {
+		return err
+	}
+	if err := validateDomainConfig(config.Domains); err != nil {
+		return err
+	}
+	if err := validateHAConfig(config.HA); err != nil {
+		return err
+	}
+	if err := validateStatusPageConfig(config.StatusPage); err != nil {
+		return err
+	}
+	if err := validateCORSConfig(config.CORS); err != nil {
+		return err
+	}
+	if err := validateSocketConfig(config.Socket); err != nil {
+		return err
+	}
+	if err := validatePACConfig(config.PAC); err != nil {
+		return err
+	}
+	if err := validateRetryAfterConfig(config.RetryAfter); err != nil {
+		return err
+	}
+	if err := validateHooksConfig(config.Hooks); err != nil {
+		return err
+	}
+	if err := validateRulesConfig(config.Rules); err != nil {
+		return err
+	}
+	if err := validateRateLimitConfig(config.RateLimit); err != nil {
+		return err
+	}
+	if err := validateWeightsConfig(config.Weights); err != nil {
+		return err
+	}
+	if err := validateCollectorConfig(config.Collector); err != nil {
+		return err
+	}
+	if err := validateCapabilitiesConfig(config.Capabilities); err != nil {
+		return err
+	}
+	if err := validateCrashReportConfig(config.CrashReport); err != nil {
+		return err
+	}
+	if len(config.Discovery.Name) > 63 || strings.Contains(config.Discovery.Name, ".") {
+		return fmt.Errorf("广播名称不能超过 63 字节且不能包含点号")
+	}
+	if config.AuthFailure.Threshold < 1 || config.AuthFailure.Threshold > 100 {
+		return fmt.Errorf("连续 401 停用阈值必须在 1-100 之间")
+	}
+	if config.KeyHealth.LowBalanceThreshold < 0 {
+		return fmt.Errorf("余额告警阈值不能为负数")
+	}
+	if webhook := config.LatencyAlert.WebhookURL; webhook != "" {
+		if parsed, err := url.Parse(webhook); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("无效的告警 webhook 地址: %s", webhook)
+		}
+	}
+	for _, target := range config.Offline.ProbeTargets {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return fmt.Errorf("无效的探测目标 %s（格式应为 host:port）", target)
+		}
+	}
+	return nil
+}
+
+// validateStatusPageConfig 校验状态页配置
+func validateStatusPageConfig(config RelayStatusPageConfig) error {
+	if config.IntervalMinutes < 1 || config.IntervalMinutes > 24*60 {
+		return fmt.Errorf("状态页检查间隔必须在 1-1440 分钟之间")
+	}
+	for platform, page := range config.Pages {
+		if _, ok := defaultStatusPages[platform]; !ok {
+			return fmt.Errorf("未知的状态页平台: %s", platform)
+		}
+		if page == "" || page == "-" {
+			continue
+		}
+		if parsed, err := url.Parse(page); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("无效的状态页地址: %s", page)
+		}
+	}
+	return nil
+}
+
+// validateCanaryConfig 校验灰度切换配置
+func validateCanaryConfig(config RelayCanaryConfig) error {
+	if len(config.Steps) == 0 || config.Steps[len(config.Steps)-1] != 100 {
+		return fmt.Errorf("灰度比例的最后一步必须为 100")
+	}
+	for i, step := range config.Steps {
+		if step < 1 || step > 100 || (i > 0 && step <= config.Steps[i-1]) {
+			return fmt.Errorf("灰度比例必须在 1-100 之间且逐步递增")
+		}
+	}
+	if config.WindowMinutes < 1 || config.WindowMinutes > 7*24*60 {
+		return fmt.Errorf("灰度窗口必须在 1-10080 分钟之间")
+	}
+	if config.MinSamples < 1 {
+		return fmt.Errorf("灰度回滚最少样本数必须大于 0")
+	}
+	if config.ErrorRateMargin < 0 || config.ErrorRateMargin > 1 {
+		return fmt.Errorf("灰度回滚错误率容差必须在 0-1 之间")
+	}
+	return nil
+}
+
+// dedupEnabledFor 判断指定路由是否启用请求合并
+func (c RelayDedupConfig) dedupEnabledFor(route string) bool {
+	if !c.Enabled {
+		return false
+	}
+	if enabled, ok := c.Routes[route]; ok {
+		return enabled
+	}
+	return true
+}
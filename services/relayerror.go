@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 中继自身产生的错误按客户端能识别的格式返回：Claude Code 使用 Anthropic 错误格式，Codex 与嵌入接口使用 OpenAI 错误格式，
+// Gemini CLI 使用 Google API 错误格式。客户端因此能显示具体原因（如“provider A 被限流”）并按错误类型决定是否重试，
+// 而不是报告无法解析响应。原有的附加字段（provider、hint 等）保留在顶层，不影响客户端解析。
+
+// relayErrorBody 按平台生成错误响应体
+func relayErrorBody(kind string, status int, message string) gin.H {
+	switch kind {
+	case "codex", "embeddings":
+		errorType, code := openAIErrorType(status)
+		body := gin.H{"message": message, "type": errorType, "param": nil, "code": nil}
+		if code != "" {
+			body["code"] = code
+		}
+		return gin.H{"error": body}
+	case "gemini":
+		return gin.H{"error": gin.H{"code": status, "message": message, "status": geminiErrorStatus(status)}}
+	default:
+		return gin.H{"type": "error", "error": gin.H{"type": anthropicErrorType(status), "message": message}}
+	}
+}
+
+// respondRelayError 返回中继自身产生的错误，extra 中的字段附加在响应顶层
+func respondRelayError(c *gin.Context, kind string, status int, message string, extra gin.H) {
+	body := relayErrorBody(kind, status, message)
+	for key, value := range extra {
+		if _, exists := body[key]; !exists {
+			body[key] = value
+		}
+	}
+	c.JSON(status, body)
+}
+
+// maxAttemptErrorLength 单个 provider 失败原因的最大长度，避免上游返回的长错误体撑大响应
+const maxAttemptErrorLength = 200
+
+// describeAttemptFailure 降级时单个 provider 的失败描述，如 "A 被上游限流（30s 后可用）"、"B: upstream status 500"
+func describeAttemptFailure(name string, err error) string {
+	var rateLimited *retryAfterError
+	switch {
+	case err == nil:
+		return name + ": 未知错误"
+	case errors.As(err, &rateLimited):
+		return fmt.Sprintf("%s 被上游限流（%ds 后可用）", name, retryAfterSeconds(rateLimited.wait))
+	default:
+		return fmt.Sprintf("%s: %s", name, truncateAttemptError(err.Error()))
+	}
+}
+
+// truncateAttemptError 按字符截断失败原因
+func truncateAttemptError(message string) string {
+	if len(message) <= maxAttemptErrorLength {
+		return message
+	}
+	cut := maxAttemptErrorLength
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	return message[:cut] + "..."
+}
+
+// anthropicErrorType Anthropic 错误类型（Claude Code 对 429/529/5xx 自动重试）
+func anthropicErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// openAIErrorType OpenAI 错误类型与错误码
+func openAIErrorType(status int) (string, string) {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error", "invalid_api_key"
+	case status == http.StatusForbidden:
+		return "permission_error", ""
+	case status == http.StatusNotFound:
+		return "invalid_request_error", "model_not_found"
+	case status == http.StatusRequestEntityTooLarge:
+		return "invalid_request_error", "request_too_large"
+	case status == http.StatusTooManyRequests:
+		return "requests", "rate_limit_exceeded"
+	case status >= http.StatusInternalServerError:
+		return "server_error", ""
+	default:
+		return "invalid_request_error", ""
+	}
+}
+
+// geminiErrorStatus Google API 错误状态
+func geminiErrorStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "INTERNAL"
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRelayErrorBody(t *testing.T) {
+	claude := relayErrorBody("claude", http.StatusTooManyRequests, "A 被上游限流")
+	if claude["type"] != "error" || claude["error"].(gin.H)["type"] != "rate_limit_error" {
+		t.Errorf("claude 错误格式不正确: %v", claude)
+	}
+
+	codex := relayErrorBody("codex", http.StatusBadGateway, "all failed")["error"].(gin.H)
+	if codex["type"] != "server_error" || codex["message"] != "all failed" {
+		t.Errorf("codex 错误格式不正确: %v", codex)
+	}
+	if code := relayErrorBody("embeddings", http.StatusTooManyRequests, "x")["error"].(gin.H)["code"]; code != "rate_limit_exceeded" {
+		t.Errorf("embeddings 429 的 code 应为 rate_limit_exceeded，得到 %v", code)
+	}
+
+	gemini := relayErrorBody("gemini", http.StatusTooManyRequests, "x")["error"].(gin.H)
+	if gemini["code"] != http.StatusTooManyRequests || gemini["status"] != "RESOURCE_EXHAUSTED" {
+		t.Errorf("gemini 错误格式不正确: %v", gemini)
+	}
+}
+
+func TestRespondRelayErrorKeepsExtras(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	respondRelayError(c, "claude", http.StatusBadGateway, "failed", gin.H{"provider": "A", "type": "ignored"})
+
+	var body map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("响应不是 JSON: %v", err)
+	}
+	if body["type"] != "error" || body["provider"] != "A" {
+		t.Errorf("附加字段不应覆盖错误格式: %v", body)
+	}
+}
+
+func TestDescribeAttemptFailure(t *testing.T) {
+	if got := describeAttemptFailure("A", &retryAfterError{status: 429, wait: 29500 * time.Millisecond}); got != "A 被上游限流（30s 后可用）" {
+		t.Errorf("限流描述不正确: %s", got)
+	}
+	if got := describeAttemptFailure("B", errors.New("upstream status 500")); got != "B: upstream status 500" {
+		t.Errorf("失败描述不正确: %s", got)
+	}
+	long := describeAttemptFailure("C", errors.New(strings.Repeat("错", 100)))
+	if !strings.HasSuffix(long, "...") || len(long) > maxAttemptErrorLength+len("C: ...") {
+		t.Errorf("过长的错误应被截断: %d", len(long))
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// 中继 Unix domain socket：除 TCP 端口外，同时在本地 socket 上提供相同的接口。
+// 本机工具连接时不占用端口，访问权限由 socket 文件的权限控制（默认只有当前用户可读写）。
+// Windows 10 1803 起同样支持 AF_UNIX。
+
+const relaySocketFileName = "relay.sock"
+
+// SocketClientConfig 通过 socket 连接中继的客户端配置片段
+type SocketClientConfig struct {
+	Path            string `json:"path"`
+	Active          bool   `json:"active"`          // socket 当前是否在监听
+	Curl            string `json:"curl"`            // curl 示例
+	PythonAnthropic string `json:"pythonAnthropic"` // anthropic Python SDK（httpx 传输层）
+	PythonOpenAI    string `json:"pythonOpenai"`    // openai Python SDK，访问 /responses
+	NodeFetch       string `json:"nodeFetch"`       // Node.js（undici dispatcher）
+	GoClient        string `json:"goClient"`        // Go http.Client
+	Note            string `json:"note"`
+}
+
+// relaySocketPath socket 文件路径
+func relaySocketPath(config RelaySocketConfig) string {
+	if config.Path != "" {
+		return config.Path
+	}
+	return filepath.Join(getConfigDir(), relaySocketFileName)
+}
+
+// validateSocketConfig 校验 socket 配置
+func validateSocketConfig(config RelaySocketConfig) error {
+	if config.Path != "" && !filepath.IsAbs(config.Path) {
+		return fmt.Errorf("socket 路径必须是绝对路径: %s", config.Path)
+	}
+	if _, err := parseSocketMode(config.Mode); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseSocketMode 解析八进制权限（如 0600），为空时使用 0600
+func parseSocketMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0o600, nil
+	}
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || value > 0o777 {
+		return 0, fmt.Errorf("无效的 socket 权限: %s（应为八进制，如 0600）", mode)
+	}
+	return os.FileMode(value), nil
+}
+
+// listenRelaySocket 在 socket 上监听并由 server 提供服务
+func (prs *ProviderRelayService) listenRelaySocket(server *http.Server, config RelaySocketConfig) error {
+	path := relaySocketPath(config)
+	mode, err := parseSocketMode(config.Mode)
+	if err != nil {
+		return err
+	}
+	// 已有进程在监听时不抢占；否则清理上次异常退出遗留的 socket 文件
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s 已被其他进程使用", path)
+	}
+	_ = os.Remove(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("创建 socket 目录失败: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("创建 socket 失败: %w", err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("设置 socket 权限失败: %w", err)
+	}
+	prs.socketPath = path
+
+	fmt.Printf("provider relay server listening on unix:%s\n", path)
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("provider relay socket error: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// closeRelaySocket 删除 socket 文件（监听器由 server.Shutdown 关闭）
+func (prs *ProviderRelayService) closeRelaySocket() {
+	if prs.socketPath != "" {
+		_ = os.Remove(prs.socketPath)
+		prs.socketPath = ""
+	}
+}
+
+// GetSocketClientConfig 生成通过 socket 连接中继的客户端配置片段（供前端调用）
+func (prs *ProviderRelayService) GetSocketClientConfig() *SocketClientConfig {
+	config := currentRelayConfig().Socket
+	path := relaySocketPath(config)
+	return &SocketClientConfig{
+		Path:   path,
+		Active: prs.socketPath != "",
+		Curl: fmt.Sprintf(`curl --unix-socket %q http://localhost/v1/messages \
+  -H 'content-type: application/json' -H 'anthropic-version: 2023-06-01' -H 'x-api-key: %s' \
+  -d '{"model":"claude-haiku-4-5","max_tokens":64,"messages":[{"role":"user","content":"hi"}]}'
+`, path, claudeAuthTokenValue),
+		PythonAnthropic: fmt.Sprintf(`import anthropic, httpx
+
+client = anthropic.Anthropic(
+    base_url="http://localhost",
+    api_key=%q,
+    http_client=httpx.Client(transport=httpx.HTTPTransport(uds=%q)),
+)
+`, claudeAuthTokenValue, path),
+		PythonOpenAI: fmt.Sprintf(`import openai, httpx
+
+client = openai.OpenAI(
+    base_url="http://localhost",
+    api_key=%q,
+    http_client=httpx.Client(transport=httpx.HTTPTransport(uds=%q)),
+)
+client.responses.create(model="gpt-5-mini", input="hi")
+`, claudeAuthTokenValue, path),
+		NodeFetch: fmt.Sprintf(`import { Agent } from "undici";
+
+const dispatcher = new Agent({ connect: { socketPath: %q } });
+const res = await fetch("http://localhost/v1/messages", {
+  dispatcher,
+  method: "POST",
+  headers: { "content-type": "application/json", "anthropic-version": "2023-06-01", "x-api-key": %q },
+  body: JSON.stringify({ model: "claude-haiku-4-5", max_tokens: 64, messages: [{ role: "user", content: "hi" }] }),
+});
+`, path, claudeAuthTokenValue),
+		GoClient: fmt.Sprintf(`client := &http.Client{Transport: &http.Transport{
+	DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", %q)
+	},
+}}
+// 请求地址使用 http://localhost/v1/messages
+`, path),
+		Note: "Claude Code 与 Codex CLI 目前不支持通过 socket 连接，请继续使用 TCP 端口；socket 适用于自行编写的脚本与工具。",
+	}
+}
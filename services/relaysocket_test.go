@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRelaySocketListener(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "relay.sock")
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	})}
+	prs := &ProviderRelayService{}
+	if err := prs.listenRelaySocket(server, RelaySocketConfig{Enabled: true, Path: path}); err != nil {
+		t.Fatalf("监听 socket 失败: %v", err)
+	}
+	defer func() {
+		_ = server.Close()
+		prs.closeRelaySocket()
+	}()
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket 权限应为 0600，得到 %v (%v)", info.Mode().Perm(), err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://localhost/health")
+	if err != nil {
+		t.Fatalf("通过 socket 请求失败: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("响应不正确: %s", body)
+	}
+
+	// 已有进程在监听时不抢占
+	if err := (&ProviderRelayService{}).listenRelaySocket(&http.Server{}, RelaySocketConfig{Path: path}); err == nil {
+		t.Error("socket 已被占用时应报错")
+	}
+}
+
+func TestValidateSocketConfig(t *testing.T) {
+	if err := validateSocketConfig(RelaySocketConfig{Path: "relay.sock"}); err == nil {
+		t.Error("相对路径应报错")
+	}
+	if err := validateSocketConfig(RelaySocketConfig{Mode: "0999"}); err == nil {
+		t.Error("无效的权限应报错")
+	}
+	if err := validateSocketConfig(RelaySocketConfig{Mode: "0660"}); err != nil {
+		t.Errorf("有效配置不应报错: %v", err)
+	}
+}
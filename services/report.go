@@ -0,0 +1,633 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 用量摘要报告：按天或按周汇总花费、主要模型、provider 可靠性排行、拉黑与故障事件、明显的延迟变化，
+// 输出 Markdown 或 HTML，保存到 ~/.code-switch/reports 并可通过桌面通知与 webhook 推送。
+// 数据来自请求汇总表（request_rollup），与看板口径一致。
+
+const (
+	ReportPeriodDaily  = "daily"
+	ReportPeriodWeekly = "weekly"
+
+	ReportFormatMarkdown = "markdown"
+	ReportFormatHTML     = "html"
+)
+
+const (
+	// reportCheckInterval 检查是否到达生成时间的间隔
+	reportCheckInterval = 10 * time.Minute
+	// reportTopModels 报告列出的模型数量
+	reportTopModels = 5
+	// reportLatencyChangeRatio 耗时 P95 变化超过该比例时列入报告
+	reportLatencyChangeRatio = 0.5
+	// reportLatencyMinRequests 两个周期内都至少有这么多成功请求的 provider 才比较延迟
+	reportLatencyMinRequests = 20
+)
+
+// SummaryReport 一个周期的摘要报告
+type SummaryReport struct {
+	Period         string                `json:"period"` // daily / weekly
+	From           string                `json:"from"`   // 周期起始日期（含）
+	To             string                `json:"to"`     // 周期结束日期（含）
+	GeneratedAt    string                `json:"generatedAt"`
+	TotalRequests  int64                 `json:"totalRequests"`
+	TotalErrors    int64                 `json:"totalErrors"`
+	TotalCost      float64               `json:"totalCost"`
+	PreviousCost   float64               `json:"previousCost"` // 上一个周期的花费
+	TotalTokens    int64                 `json:"totalTokens"`
+	TopModels      []ReportModel         `json:"topModels"`
+	Providers      []ReportProvider      `json:"providers"` // 按成功率降序
+	Incidents      []ReportIncident      `json:"incidents"`
+	LatencyChanges []ReportLatencyChange `json:"latencyChanges"`
+}
+
+// ReportModel 按花费排序的模型
+type ReportModel struct {
+	Model    string  `json:"model"`
+	Requests int64   `json:"requests"`
+	Tokens   int64   `json:"tokens"`
+	Cost     float64 `json:"cost"`
+}
+
+// ReportProvider provider 可靠性
+type ReportProvider struct {
+	Platform    string  `json:"platform"`
+	Provider    string  `json:"provider"`
+	Requests    int64   `json:"requests"`
+	Errors      int64   `json:"errors"`
+	SuccessRate float64 `json:"successRate"` // 0-1
+	P95Ms       float64 `json:"p95Ms"`       // 各时段 P95 按成功请求数加权
+	Cost        float64 `json:"cost"`
+}
+
+// ReportIncident 周期内的拉黑、故障与 SLO 违约事件
+type ReportIncident struct {
+	Time   string `json:"time"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// ReportLatencyChange 与上一个周期相比耗时 P95 明显变化的 provider
+type ReportLatencyChange struct {
+	Platform  string  `json:"platform"`
+	Provider  string  `json:"provider"`
+	PrevP95Ms float64 `json:"prevP95Ms"`
+	P95Ms     float64 `json:"p95Ms"`
+	ChangePct float64 `json:"changePct"` // 正数为变慢
+}
+
+// ReportResult 生成报告的结果
+type ReportResult struct {
+	Report  *SummaryReport `json:"report"`
+	Format  string         `json:"format"`
+	Content string         `json:"content"`
+	Path    string         `json:"path,omitempty"` // 保存的文件路径
+}
+
+// validateReportConfig 校验报告配置
+func validateReportConfig(config RelayReportConfig) error {
+	if config.Period != ReportPeriodDaily && config.Period != ReportPeriodWeekly {
+		return fmt.Errorf("无效的报告周期: %s（可选值: daily、weekly）", config.Period)
+	}
+	if config.Hour < 0 || config.Hour > 23 {
+		return fmt.Errorf("报告生成时间必须在 0-23 点之间")
+	}
+	if config.Weekday < 0 || config.Weekday > 6 {
+		return fmt.Errorf("周报生成日必须在 0-6 之间（0 为周日）")
+	}
+	if config.Format != ReportFormatMarkdown && config.Format != ReportFormatHTML {
+		return fmt.Errorf("无效的报告格式: %s（可选值: markdown、html）", config.Format)
+	}
+	if webhook := config.WebhookURL; webhook != "" {
+		if parsed, err := url.Parse(webhook); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("无效的报告推送 webhook 地址: %s", webhook)
+		}
+	}
+	return nil
+}
+
+// reportPeriodRange 周期截止到 end（某天零点）时的起止时间
+func reportPeriodRange(period string, end time.Time) (time.Time, time.Time) {
+	if period == ReportPeriodWeekly {
+		return end.AddDate(0, 0, -7), end
+	}
+	return end.AddDate(0, 0, -1), end
+}
+
+// latestReportEnd 最近一次应生成的报告的周期终点（零点）：
+// 日报为最近一次到达生成时间的当天零点；周报为最近一个到达生成时间的生成日零点
+func latestReportEnd(config RelayReportConfig, now time.Time) time.Time {
+	day := startOfDay(now)
+	if now.Hour() < config.Hour {
+		day = day.AddDate(0, 0, -1)
+	}
+	if config.Period == ReportPeriodWeekly {
+		for int(day.Weekday()) != config.Weekday {
+			day = day.AddDate(0, 0, -1)
+		}
+	}
+	return day
+}
+
+// buildSummaryReport 由本周期与上一周期的汇总数据生成报告
+func buildSummaryReport(period string, from, to time.Time, current, previous []UsageRollup, incidents []ReportIncident) *SummaryReport {
+	report := &SummaryReport{
+		Period:         period,
+		From:           from.Format("2006-01-02"),
+		To:             to.AddDate(0, 0, -1).Format("2006-01-02"),
+		GeneratedAt:    time.Now().Format(timeLayout),
+		TopModels:      []ReportModel{},
+		Providers:      []ReportProvider{},
+		Incidents:      incidents,
+		LatencyChanges: []ReportLatencyChange{},
+	}
+	if report.Incidents == nil {
+		report.Incidents = []ReportIncident{}
+	}
+
+	models := map[string]*ReportModel{}
+	for _, r := range current {
+		tokens := r.InputTokens + r.OutputTokens + r.ReasoningTokens + r.CacheCreateTokens + r.CacheReadTokens
+		report.TotalRequests += r.Requests
+		report.TotalErrors += r.Errors
+		report.TotalCost += r.Cost
+		report.TotalTokens += tokens
+		m := models[r.Model]
+		if m == nil {
+			m = &ReportModel{Model: r.Model}
+			models[r.Model] = m
+		}
+		m.Requests += r.Requests
+		m.Tokens += tokens
+		m.Cost += r.Cost
+	}
+	for _, r := range previous {
+		report.PreviousCost += r.Cost
+	}
+	for _, m := range models {
+		report.TopModels = append(report.TopModels, *m)
+	}
+	sort.Slice(report.TopModels, func(i, j int) bool {
+		a, b := report.TopModels[i], report.TopModels[j]
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		return a.Requests > b.Requests
+	})
+	if len(report.TopModels) > reportTopModels {
+		report.TopModels = report.TopModels[:reportTopModels]
+	}
+
+	currentProviders := aggregateReportProviders(current)
+	previousProviders := aggregateReportProviders(previous)
+	for key, p := range currentProviders {
+		report.Providers = append(report.Providers, p.ReportProvider)
+		prev, ok := previousProviders[key]
+		if !ok || p.successes < reportLatencyMinRequests || prev.successes < reportLatencyMinRequests || prev.P95Ms <= 0 {
+			continue
+		}
+		// 变慢或变快（上一周期比本周期慢）超过 reportLatencyChangeRatio 时列入
+		ratio := p.P95Ms / prev.P95Ms
+		if ratio >= 1+reportLatencyChangeRatio || ratio <= 1/(1+reportLatencyChangeRatio) {
+			report.LatencyChanges = append(report.LatencyChanges, ReportLatencyChange{
+				Platform:  p.Platform,
+				Provider:  p.Provider,
+				PrevP95Ms: prev.P95Ms,
+				P95Ms:     p.P95Ms,
+				ChangePct: (ratio - 1) * 100,
+			})
+		}
+	}
+	sort.Slice(report.Providers, func(i, j int) bool {
+		a, b := report.Providers[i], report.Providers[j]
+		if a.SuccessRate != b.SuccessRate {
+			return a.SuccessRate > b.SuccessRate
+		}
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Platform+"/"+a.Provider < b.Platform+"/"+b.Provider
+	})
+	sort.Slice(report.LatencyChanges, func(i, j int) bool {
+		return report.LatencyChanges[i].ChangePct > report.LatencyChanges[j].ChangePct
+	})
+	return report
+}
+
+type reportProviderAcc struct {
+	ReportProvider
+	successes int64
+}
+
+// aggregateReportProviders 按 平台/provider 汇总请求数、成功率与加权 P95
+func aggregateReportProviders(rows []UsageRollup) map[string]*reportProviderAcc {
+	providers := map[string]*reportProviderAcc{}
+	for _, r := range rows {
+		key := r.Platform + "/" + r.Provider
+		p := providers[key]
+		if p == nil {
+			p = &reportProviderAcc{ReportProvider: ReportProvider{Platform: r.Platform, Provider: r.Provider}}
+			providers[key] = p
+		}
+		p.Requests += r.Requests
+		p.Errors += r.Errors
+		p.Cost += r.Cost
+		p.P95Ms += r.DurationP95Ms * float64(r.Successes)
+		p.successes += r.Successes
+	}
+	for _, p := range providers {
+		if p.successes > 0 {
+			p.P95Ms /= float64(p.successes)
+		}
+		if p.Requests > 0 {
+			p.SuccessRate = float64(p.Requests-p.Errors) / float64(p.Requests)
+		}
+	}
+	return providers
+}
+
+// Encode 按格式输出报告：markdown 或 html
+func (r *SummaryReport) Encode(format string) (string, error) {
+	switch format {
+	case "", ReportFormatMarkdown:
+		return r.markdown(), nil
+	case ReportFormatHTML:
+		var buf bytes.Buffer
+		if err := reportHTMLTemplate.Execute(&buf, r.templateData()); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	default:
+		return "", fmt.Errorf("无效的报告格式: %s（可选值: markdown、html）", format)
+	}
+}
+
+func (r *SummaryReport) title() string {
+	if r.Period == ReportPeriodWeekly {
+		return fmt.Sprintf("Code Switch 周报（%s ~ %s）", r.From, r.To)
+	}
+	return fmt.Sprintf("Code Switch 日报（%s）", r.From)
+}
+
+// costChange 与上一个周期相比的花费变化描述
+func (r *SummaryReport) costChange() string {
+	if r.PreviousCost <= 0 {
+		return "上一周期无花费"
+	}
+	return fmt.Sprintf("较上一周期 %+.1f%%", (r.TotalCost-r.PreviousCost)/r.PreviousCost*100)
+}
+
+func (r *SummaryReport) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", r.title())
+	fmt.Fprintf(&b, "- 总花费：$%.4f（%s）\n", r.TotalCost, r.costChange())
+	fmt.Fprintf(&b, "- 请求数：%d，错误 %d\n", r.TotalRequests, r.TotalErrors)
+	fmt.Fprintf(&b, "- Token：%d\n\n", r.TotalTokens)
+
+	b.WriteString("## 主要模型\n\n")
+	if len(r.TopModels) == 0 {
+		b.WriteString("本周期没有请求。\n\n")
+	} else {
+		b.WriteString("| 模型 | 请求数 | Token | 花费 |\n| --- | ---: | ---: | ---: |\n")
+		for _, m := range r.TopModels {
+			fmt.Fprintf(&b, "| %s | %d | %d | $%.4f |\n", markdownCell(m.Model), m.Requests, m.Tokens, m.Cost)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## 供应商可靠性\n\n")
+	if len(r.Providers) == 0 {
+		b.WriteString("本周期没有请求。\n\n")
+	} else {
+		b.WriteString("| 平台 | 供应商 | 请求数 | 成功率 | 耗时 P95 | 花费 |\n| --- | --- | ---: | ---: | ---: | ---: |\n")
+		for _, p := range r.Providers {
+			fmt.Fprintf(&b, "| %s | %s | %d | %.1f%% | %.0fms | $%.4f |\n", markdownCell(p.Platform), markdownCell(p.Provider), p.Requests, p.SuccessRate*100, p.P95Ms, p.Cost)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## 拉黑与故障\n\n")
+	if len(r.Incidents) == 0 {
+		b.WriteString("无。\n\n")
+	} else {
+		for _, incident := range r.Incidents {
+			fmt.Fprintf(&b, "- %s [%s] %s\n", incident.Time, incident.Kind, incident.Detail)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## 延迟变化\n\n")
+	if len(r.LatencyChanges) == 0 {
+		b.WriteString("无明显变化。\n")
+	} else {
+		for _, c := range r.LatencyChanges {
+			fmt.Fprintf(&b, "- %s/%s：耗时 P95 %.0fms → %.0fms（%+.0f%%）\n", c.Platform, c.Provider, c.PrevP95Ms, c.P95Ms, c.ChangePct)
+		}
+	}
+	return b.String()
+}
+
+// markdownCell 转义表格单元格中的竖线与换行
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+var reportHTMLTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"pct":   func(v float64) string { return fmt.Sprintf("%.1f%%", v*100) },
+	"ms":    func(v float64) string { return fmt.Sprintf("%.0fms", v) },
+	"usd":   func(v float64) string { return fmt.Sprintf("$%.4f", v) },
+	"delta": func(v float64) string { return fmt.Sprintf("%+.0f%%", v) },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ddd; padding: 4px 10px; }
+td.n { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<ul>
+<li>总花费：{{usd .Report.TotalCost}}（{{.CostChange}}）</li>
+<li>请求数：{{.Report.TotalRequests}}，错误 {{.Report.TotalErrors}}</li>
+<li>Token：{{.Report.TotalTokens}}</li>
+</ul>
+<h2>主要模型</h2>
+{{if .Report.TopModels}}<table>
+<tr><th>模型</th><th>请求数</th><th>Token</th><th>花费</th></tr>
+{{range .Report.TopModels}}<tr><td>{{.Model}}</td><td class="n">{{.Requests}}</td><td class="n">{{.Tokens}}</td><td class="n">{{usd .Cost}}</td></tr>
+{{end}}</table>{{else}}<p>本周期没有请求。</p>{{end}}
+<h2>供应商可靠性</h2>
+{{if .Report.Providers}}<table>
+<tr><th>平台</th><th>供应商</th><th>请求数</th><th>成功率</th><th>耗时 P95</th><th>花费</th></tr>
+{{range .Report.Providers}}<tr><td>{{.Platform}}</td><td>{{.Provider}}</td><td class="n">{{.Requests}}</td><td class="n">{{pct .SuccessRate}}</td><td class="n">{{ms .P95Ms}}</td><td class="n">{{usd .Cost}}</td></tr>
+{{end}}</table>{{else}}<p>本周期没有请求。</p>{{end}}
+<h2>拉黑与故障</h2>
+{{if .Report.Incidents}}<ul>
+{{range .Report.Incidents}}<li>{{.Time}} [{{.Kind}}] {{.Detail}}</li>
+{{end}}</ul>{{else}}<p>无。</p>{{end}}
+<h2>延迟变化</h2>
+{{if .Report.LatencyChanges}}<ul>
+{{range .Report.LatencyChanges}}<li>{{.Platform}}/{{.Provider}}：耗时 P95 {{ms .PrevP95Ms}} → {{ms .P95Ms}}（{{delta .ChangePct}}）</li>
+{{end}}</ul>{{else}}<p>无明显变化。</p>{{end}}
+</body>
+</html>
+`))
+
+// templateData HTML 模板数据
+func (r *SummaryReport) templateData() map[string]any {
+	return map[string]any{"Title": r.title(), "CostChange": r.costChange(), "Report": r}
+}
+
+// loadReportIncidents 读取周期内的拉黑、平台故障、自动停用、灰度回滚与 SLO 违约
+func loadReportIncidents(from, to time.Time) []ReportIncident {
+	var incidents []ReportIncident
+	type incidentAt struct {
+		at time.Time
+		ReportIncident
+	}
+	var items []incidentAt
+
+	// provider_blacklist 每个 provider 只保留最近一次拉黑
+	if records, err := sharedModel("provider_blacklist").Selects(
+		xdb.WhereGe("blacklisted_at", from.Unix()),
+		xdb.WhereLt("blacklisted_at", to.Unix()),
+	); err == nil {
+		for _, record := range records {
+			at := recordTime(record, "blacklisted_at")
+			items = append(items, incidentAt{at, ReportIncident{Kind: "拉黑", Detail: fmt.Sprintf("%s/%s 被拉黑（等级 %d）",
+				record.GetString("platform"), record.GetString("provider_name"), record.GetInt("blacklist_level"))}})
+		}
+	} else if !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+		log.Printf("[Report] 读取拉黑记录失败: %v", err)
+	}
+
+	auditKinds := map[string]string{
+		"blacklist/platform_incident": "平台故障",
+		"provider/auth_disabled":      "自动停用",
+		"canary/rollback":             "灰度回滚",
+	}
+	if records, err := sharedModel("audit_log").Selects(
+		xdb.WhereGe("created_at", from.Unix()),
+		xdb.WhereLt("created_at", to.Unix()),
+		xdb.WhereIn("category", []any{"blacklist", "provider", "canary"}),
+	); err == nil {
+		for _, record := range records {
+			kind, ok := auditKinds[record.GetString("category")+"/"+record.GetString("action")]
+			if !ok {
+				continue
+			}
+			items = append(items, incidentAt{recordTime(record, "created_at"), ReportIncident{Kind: kind, Detail: record.GetString("detail")}})
+		}
+	} else if !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+		log.Printf("[Report] 读取审计日志失败: %v", err)
+	}
+
+	if records, err := xdb.New("slo_breach").Selects(
+		xdb.WhereGe("started_at", from.Unix()),
+		xdb.WhereLt("started_at", to.Unix()),
+	); err == nil {
+		for _, record := range records {
+			items = append(items, incidentAt{recordTime(record, "started_at"), ReportIncident{Kind: "SLO 违约", Detail: fmt.Sprintf("%s/%s 违反 SLO「%s」",
+				record.GetString("platform"), record.GetString("provider"), record.GetString("objective"))}})
+		}
+	} else if !errors.Is(err, xdb.ErrNotFound) && !isNoSuchTableErr(err) {
+		log.Printf("[Report] 读取 SLO 违约记录失败: %v", err)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].at.Before(items[j].at) })
+	for _, item := range items {
+		item.Time = item.at.Format("01-02 15:04")
+		incidents = append(incidents, item.ReportIncident)
+	}
+	return incidents
+}
+
+// ReportService 定期生成摘要报告
+type ReportService struct {
+	notificationService *NotificationService
+}
+
+// NewReportService 创建报告服务
+func NewReportService(notificationService *NotificationService) *ReportService {
+	return &ReportService{notificationService: notificationService}
+}
+
+// Start 注册后台定时生成任务（未启用时不生成）
+func (rs *ReportService) Start() error {
+	scheduleJob(backgroundJob{
+		name:  "report",
+		title: "摘要报告生成",
+		delay: reportCheckInterval,
+		interval: func() time.Duration {
+			if !currentRelayConfig().Report.Enabled {
+				return 0
+			}
+			return reportCheckInterval
+		},
+		run: func() error {
+			rs.generateDue(time.Now())
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止后台生成
+func (rs *ReportService) Stop() error {
+	unscheduleJob("report")
+	return nil
+}
+
+// PreviewReport 生成最近一个完整周期的报告但不保存（供前端调用），period 为 daily 或 weekly
+func (rs *ReportService) PreviewReport(period, format string) (*ReportResult, error) {
+	if period != ReportPeriodDaily && period != ReportPeriodWeekly {
+		return nil, fmt.Errorf("无效的报告周期: %s（可选值: daily、weekly）", period)
+	}
+	return generateReport(period, format, startOfDay(time.Now()))
+}
+
+// GenerateReport 生成最近一个完整周期的报告，保存到报告目录并推送（供前端调用）
+func (rs *ReportService) GenerateReport(period string) (*ReportResult, error) {
+	config := currentRelayConfig().Report
+	result, err := rs.PreviewReport(period, config.Format)
+	if err != nil {
+		return nil, err
+	}
+	if err := rs.deliver(config, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetReportDir 获取报告保存目录
+func (rs *ReportService) GetReportDir() string {
+	return reportDir(currentRelayConfig().Report)
+}
+
+// generateDue 到达生成时间且该周期的报告尚未保存时生成
+func (rs *ReportService) generateDue(now time.Time) {
+	config := currentRelayConfig().Report
+	if !config.Enabled {
+		return
+	}
+	end := latestReportEnd(config, now)
+	from, _ := reportPeriodRange(config.Period, end)
+	path := reportPath(config, config.Period, from)
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	result, err := generateReport(config.Period, config.Format, end)
+	if err != nil {
+		log.Printf("[Report] 生成报告失败: %v", err)
+		return
+	}
+	if err := rs.deliver(config, result); err != nil {
+		log.Printf("[Report] 保存报告失败: %v", err)
+	}
+}
+
+// generateReport 生成截止到 end（零点）的周期报告
+func generateReport(period, format string, end time.Time) (*ReportResult, error) {
+	if format == "" {
+		format = ReportFormatMarkdown
+	}
+	from, to := reportPeriodRange(period, end)
+	prevFrom, _ := reportPeriodRange(period, from)
+	current, err := loadDashboardRollups(DashboardQuery{}, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("读取请求汇总失败: %w", err)
+	}
+	previous, err := loadDashboardRollups(DashboardQuery{}, prevFrom, from)
+	if err != nil {
+		return nil, fmt.Errorf("读取请求汇总失败: %w", err)
+	}
+	report := buildSummaryReport(period, from, to, current, previous, loadReportIncidents(from, to))
+	content, err := report.Encode(format)
+	if err != nil {
+		return nil, err
+	}
+	return &ReportResult{Report: report, Format: format, Content: content}, nil
+}
+
+// deliver 保存报告并按配置发送通知与 webhook
+func (rs *ReportService) deliver(config RelayReportConfig, result *ReportResult) error {
+	from, _ := time.ParseInLocation("2006-01-02", result.Report.From, time.Local)
+	path := reportPath(RelayReportConfig{Format: result.Format, Dir: config.Dir}, result.Report.Period, from)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("创建报告目录失败: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(result.Content), 0o644); err != nil {
+		return fmt.Errorf("保存报告失败: %w", err)
+	}
+	result.Path = path
+
+	if rs.notificationService != nil && config.Notify {
+		rs.notificationService.NotifyReportReady(result.Report, path)
+	}
+	if config.WebhookURL != "" {
+		go sendReportWebhook(config.WebhookURL, result)
+	}
+	return nil
+}
+
+func reportDir(config RelayReportConfig) string {
+	if config.Dir != "" {
+		return config.Dir
+	}
+	return filepath.Join(getConfigDir(), "reports")
+}
+
+// reportPath 报告文件路径，例如 reports/weekly-2025-03-03.md
+func reportPath(config RelayReportConfig, period string, from time.Time) string {
+	ext := ".md"
+	if config.Format == ReportFormatHTML {
+		ext = ".html"
+	}
+	return filepath.Join(reportDir(config), period+"-"+from.Format("2006-01-02")+ext)
+}
+
+// sendReportWebhook 将报告推送到 webhook
+func sendReportWebhook(webhookURL string, result *ReportResult) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":     "usage_report",
+		"report":    result.Report,
+		"format":    result.Format,
+		"content":   result.Content,
+		"timestamp": time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("[Report] 推送 webhook 失败: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[Report] 推送 webhook 返回异常状态码: %d", resp.StatusCode)
+	}
+}
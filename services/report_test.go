@@ -0,0 +1,63 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildSummaryReport(t *testing.T) {
+	from := time.Date(2025, 3, 3, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 0, 7)
+	current := []UsageRollup{
+		{BucketStart: from.Unix(), Platform: "claude", Provider: "A", Model: "opus", Requests: 50, Successes: 50, Cost: 10, InputTokens: 1000, DurationP95Ms: 9000},
+		{BucketStart: from.Unix(), Platform: "claude", Provider: "B", Model: "sonnet", Requests: 40, Successes: 30, Errors: 10, Cost: 2, DurationP95Ms: 3000},
+	}
+	previous := []UsageRollup{
+		{BucketStart: from.AddDate(0, 0, -7).Unix(), Platform: "claude", Provider: "A", Model: "opus", Requests: 40, Successes: 40, Cost: 8, DurationP95Ms: 4000},
+		{BucketStart: from.AddDate(0, 0, -7).Unix(), Platform: "claude", Provider: "B", Model: "sonnet", Requests: 40, Successes: 40, Cost: 2, DurationP95Ms: 2900},
+	}
+	incidents := []ReportIncident{{Time: "03-04 10:00", Kind: "拉黑", Detail: "claude/B 被拉黑（等级 1）"}}
+
+	report := buildSummaryReport(ReportPeriodWeekly, from, to, current, previous, incidents)
+	if report.To != "2025-03-09" || report.TotalCost != 12 || report.PreviousCost != 10 || report.TotalRequests != 90 {
+		t.Fatalf("汇总不正确: %+v", report)
+	}
+	if report.TopModels[0].Model != "opus" {
+		t.Errorf("花费最高的模型应排在最前，得到 %+v", report.TopModels)
+	}
+	if report.Providers[0].Provider != "A" || report.Providers[1].SuccessRate != 0.75 {
+		t.Errorf("可靠性排行不正确: %+v", report.Providers)
+	}
+	// A 的 P95 从 4000ms 变为 9000ms，B 变化不大
+	if len(report.LatencyChanges) != 1 || report.LatencyChanges[0].Provider != "A" || report.LatencyChanges[0].ChangePct != 125 {
+		t.Errorf("延迟变化不正确: %+v", report.LatencyChanges)
+	}
+
+	markdown, err := report.Encode(ReportFormatMarkdown)
+	if err != nil || !strings.Contains(markdown, "周报（2025-03-03 ~ 2025-03-09）") || !strings.Contains(markdown, "+20.0%") {
+		t.Errorf("Markdown 输出不正确 (%v):\n%s", err, markdown)
+	}
+	html, err := report.Encode(ReportFormatHTML)
+	if err != nil || !strings.Contains(html, "<td>opus</td>") || !strings.Contains(html, "被拉黑") {
+		t.Errorf("HTML 输出不正确 (%v):\n%s", err, html)
+	}
+}
+
+func TestLatestReportEnd(t *testing.T) {
+	config := RelayReportConfig{Period: ReportPeriodWeekly, Hour: 9, Weekday: int(time.Monday)}
+	// 2025-03-05 是周三：最近的周报截止到周一 03-03
+	now := time.Date(2025, 3, 5, 12, 0, 0, 0, time.Local)
+	if end := latestReportEnd(config, now); end.Format("2006-01-02") != "2025-03-03" {
+		t.Errorf("周报截止日期应为 2025-03-03，得到 %s", end.Format("2006-01-02"))
+	}
+	// 周一 8 点还没到生成时间：仍是上一周
+	now = time.Date(2025, 3, 10, 8, 0, 0, 0, time.Local)
+	if end := latestReportEnd(config, now); end.Format("2006-01-02") != "2025-03-03" {
+		t.Errorf("未到生成时间时应为上一周，得到 %s", end.Format("2006-01-02"))
+	}
+	config.Period = ReportPeriodDaily
+	if end := latestReportEnd(config, now); end.Format("2006-01-02") != "2025-03-09" {
+		t.Errorf("日报截止日期应为 2025-03-09，得到 %s", end.Format("2006-01-02"))
+	}
+}
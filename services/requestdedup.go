@@ -0,0 +1,244 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dedupMaxCaptureBytes 单个响应最多缓存的字节数，超出后不再向其他请求复用
+const dedupMaxCaptureBytes = 8 * 1024 * 1024
+
+// DedupStats 请求合并统计
+type DedupStats struct {
+	Eligible   int64 `json:"eligible"`   // 参与合并判断的请求数
+	Upstream   int64 `json:"upstream"`   // 实际发往上游的请求数
+	Coalesced  int64 `json:"coalesced"`  // 直接复用其他请求响应的次数
+	SavedBytes int64 `json:"savedBytes"` // 因合并而未发送的请求体字节数
+}
+
+// dedupResult 领头请求的响应快照
+type dedupResult struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// reusable 是否可分发给其他请求：只复用有响应体的 2xx 响应
+func (r *dedupResult) reusable() bool {
+	return r != nil && r.status >= 200 && r.status < 300 && len(r.body) > 0
+}
+
+// dedupCall 一次进行中（或刚完成）的上游调用
+type dedupCall struct {
+	done      chan struct{}
+	result    *dedupResult // nil 表示响应不可复用（失败、空响应或超出缓存上限）
+	expiresAt time.Time    // 完成后可继续复用的截止时间
+}
+
+// requestDeduper 合并相同的并发非流式请求：第一个请求负责访问上游，其余请求等待并复用其响应
+type requestDeduper struct {
+	mu    sync.Mutex
+	calls map[string]*dedupCall
+	stats DedupStats
+}
+
+func newRequestDeduper() *requestDeduper {
+	return &requestDeduper{calls: make(map[string]*dedupCall)}
+}
+
+// dedupKey 计算请求指纹（请求路径 + 查询参数 + 请求体）
+func dedupKey(path string, rawQuery string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(path))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(rawQuery))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// join 加入指纹对应的调用；返回 leader=true 表示调用方需要自行访问上游
+func (d *requestDeduper) join(key string) (call *dedupCall, leader bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stats.Eligible++
+	if existing, ok := d.calls[key]; ok {
+		select {
+		case <-existing.done:
+			// 已完成：仅在窗口期内且响应可复用时命中
+			if existing.result != nil && time.Now().Before(existing.expiresAt) {
+				return existing, false
+			}
+		default:
+			return existing, false
+		}
+	}
+
+	call = &dedupCall{done: make(chan struct{})}
+	d.calls[key] = call
+	d.stats.Upstream++
+	return call, true
+}
+
+// finish 领头请求完成，发布响应并在窗口期后清理
+func (d *requestDeduper) finish(key string, call *dedupCall, result *dedupResult, window time.Duration) {
+	// 失败与空响应不分发：已在等待的请求各自访问上游，而不是复制领头请求的失败
+	if !result.reusable() {
+		result = nil
+	}
+	d.mu.Lock()
+	call.result = result
+	if result != nil {
+		call.expiresAt = time.Now().Add(window)
+	}
+	close(call.done)
+	d.mu.Unlock()
+
+	cleanup := func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.calls[key] == call {
+			delete(d.calls, key)
+		}
+	}
+	if window <= 0 || call.expiresAt.IsZero() {
+		cleanup()
+		return
+	}
+	time.AfterFunc(window, cleanup)
+}
+
+// recordCoalesced 记录一次成功复用
+func (d *requestDeduper) recordCoalesced(bodySize int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats.Coalesced++
+	d.stats.SavedBytes += int64(bodySize)
+}
+
+// recordUpstream 记录一次等待后仍需自行访问上游的请求
+func (d *requestDeduper) recordUpstream() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats.Upstream++
+}
+
+// snapshot 返回统计快照
+func (d *requestDeduper) snapshot() DedupStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+// dedupCaptureWriter 包装 gin.ResponseWriter，转发写入的同时缓存响应体
+type dedupCaptureWriter struct {
+	gin.ResponseWriter
+	buf      []byte
+	overflow bool
+}
+
+func (w *dedupCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *dedupCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *dedupCaptureWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if len(w.buf)+len(data) > dedupMaxCaptureBytes {
+		w.overflow = true
+		w.buf = nil
+		return
+	}
+	w.buf = append(w.buf, data...)
+}
+
+// result 生成响应快照，超出缓存上限时返回 nil
+func (w *dedupCaptureWriter) result() *dedupResult {
+	if w.overflow {
+		return nil
+	}
+	return &dedupResult{
+		status: w.ResponseWriter.Status(),
+		header: w.ResponseWriter.Header().Clone(),
+		body:   w.buf,
+	}
+}
+
+// beginDedup 尝试合并相同的非流式请求
+// handled=true 表示已复用其他请求的响应，调用方应直接返回；
+// 否则调用方在请求处理结束后必须调用 finish（未启用时 finish 为空操作）
+func (prs *ProviderRelayService) beginDedup(c *gin.Context, route string, isStream bool, bodyBytes []byte) (finish func(), handled bool) {
+	noop := func() {}
+	if isStream || prs.deduper == nil {
+		return noop, false
+	}
+	config := currentRelayConfig().Dedup
+	if !config.dedupEnabledFor(route) {
+		return noop, false
+	}
+
+	key := dedupKey(c.Request.URL.Path, c.Request.URL.RawQuery, bodyBytes)
+	call, leader := prs.deduper.join(key)
+	if !leader {
+		select {
+		case <-call.done:
+		case <-c.Request.Context().Done():
+			// 客户端已断开，无需继续等待
+			return noop, true
+		}
+		if call.result != nil {
+			prs.deduper.recordCoalesced(len(bodyBytes))
+			fmt.Printf("[INFO] 🔁 合并相同请求，复用上游响应 | 路由: %s\n", route)
+			writeDedupResult(c, call.result)
+			return noop, true
+		}
+		// 领头请求失败、客户端断开或响应不可复用，自行访问上游
+		prs.deduper.recordUpstream()
+		return noop, false
+	}
+
+	capture := &dedupCaptureWriter{ResponseWriter: c.Writer}
+	c.Writer = capture
+	window := time.Duration(config.WindowMs) * time.Millisecond
+	return func() {
+		result := capture.result()
+		if c.Request.Context().Err() != nil {
+			// 领头请求的客户端已断开，响应可能不完整
+			result = nil
+		}
+		prs.deduper.finish(key, call, result, window)
+	}, false
+}
+
+// writeDedupResult 将缓存的响应写回客户端
+func writeDedupResult(c *gin.Context, result *dedupResult) {
+	for key, values := range result.header {
+		for _, value := range values {
+			c.Writer.Header().Add(key, value)
+		}
+	}
+	c.Status(result.status)
+	_, _ = c.Writer.Write(result.body)
+}
+
+// GetDedupStats 获取请求合并统计（供前端调用）
+func (prs *ProviderRelayService) GetDedupStats() DedupStats {
+	if prs.deduper == nil {
+		return DedupStats{}
+	}
+	return prs.deduper.snapshot()
+}
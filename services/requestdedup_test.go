@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRelayDedupConfig_DedupEnabledFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RelayDedupConfig
+		route  string
+		want   bool
+	}{
+		{"全局关闭", RelayDedupConfig{Enabled: false, Routes: map[string]bool{"/v1/messages": true}}, "/v1/messages", false},
+		{"全局开启-未配置路由", RelayDedupConfig{Enabled: true}, "/responses", true},
+		{"全局开启-路由关闭", RelayDedupConfig{Enabled: true, Routes: map[string]bool{"/gemini": false}}, "/gemini", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.dedupEnabledFor(tt.route); got != tt.want {
+				t.Errorf("dedupEnabledFor(%q) = %v, want %v", tt.route, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestDeduper_JoinAndFinish(t *testing.T) {
+	d := newRequestDeduper()
+	key := dedupKey("/v1/messages", "", []byte(`{"model":"claude"}`))
+
+	leaderCall, leader := d.join(key)
+	if !leader {
+		t.Fatal("第一个请求应成为领头请求")
+	}
+	followerCall, leader := d.join(key)
+	if leader || followerCall != leaderCall {
+		t.Fatal("进行中的相同请求应加入已有调用")
+	}
+
+	d.finish(key, leaderCall, &dedupResult{status: 200, body: []byte("ok")}, time.Minute)
+	<-followerCall.done
+	if string(followerCall.result.body) != "ok" {
+		t.Errorf("跟随请求应拿到领头请求的响应，got %q", followerCall.result.body)
+	}
+
+	// 窗口期内的成功响应可复用
+	if _, leader := d.join(key); leader {
+		t.Error("窗口期内的相同请求应复用响应")
+	}
+
+	// 失败响应不在窗口期内复用
+	otherKey := dedupKey("/v1/messages", "", []byte(`{"model":"other"}`))
+	call, _ := d.join(otherKey)
+	d.finish(otherKey, call, &dedupResult{status: 502}, time.Minute)
+	if _, leader := d.join(otherKey); !leader {
+		t.Error("失败响应不应被后续请求复用")
+	}
+
+	stats := d.snapshot()
+	if stats.Eligible != 5 || stats.Upstream != 3 {
+		t.Errorf("统计不符: %+v", stats)
+	}
+}
+
+func TestRequestDeduper_FailedLeaderNotFannedOut(t *testing.T) {
+	results := map[string]*dedupResult{
+		"5xx":    {status: 502, body: []byte("bad gateway")},
+		"空响应":    {status: 200},
+		"超出缓存上限": nil,
+	}
+	for name, result := range results {
+		t.Run(name, func(t *testing.T) {
+			d := newRequestDeduper()
+			key := dedupKey("/v1/messages", "", []byte(name))
+			call, _ := d.join(key)
+			follower, leader := d.join(key)
+			if leader {
+				t.Fatal("进行中的相同请求应加入已有调用")
+			}
+			d.finish(key, call, result, time.Minute)
+			<-follower.done
+			if follower.result != nil {
+				t.Errorf("失败的领头响应不应分发给等待中的请求: %+v", follower.result)
+			}
+		})
+	}
+}
+
+func TestBeginDedup_FollowerRetriesAfterLeaderDisconnect(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	config := DefaultRelayConfig()
+	config.Dedup = RelayDedupConfig{Enabled: true, WindowMs: 1000}
+	data, _ := json.Marshal(config)
+	if err := os.MkdirAll(filepath.Join(home, ".code-switch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".code-switch", "relay-config.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	prs := &ProviderRelayService{deduper: newRequestDeduper()}
+	body := []byte(`{"model":"claude"}`)
+
+	// 领头请求：客户端在上游返回前断开
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderC, _ := gin.CreateTestContext(httptest.NewRecorder())
+	leaderC.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil).WithContext(leaderCtx)
+	finishLeader, handled := prs.beginDedup(leaderC, "/v1/messages", false, body)
+	if handled {
+		t.Fatal("第一个请求应自行访问上游")
+	}
+
+	var wg sync.WaitGroup
+	var followerHandled bool
+	followerC, _ := gin.CreateTestContext(httptest.NewRecorder())
+	followerC.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, followerHandled = prs.beginDedup(followerC, "/v1/messages", false, body)
+	}()
+	for prs.deduper.snapshot().Eligible < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	leaderC.String(http.StatusOK, "partial")
+	cancel()
+	finishLeader()
+	wg.Wait()
+
+	if followerHandled {
+		t.Error("领头请求客户端断开后，等待中的请求应自行访问上游")
+	}
+	if stats := prs.deduper.snapshot(); stats.Upstream != 2 || stats.Coalesced != 0 {
+		t.Errorf("统计不符: %+v", stats)
+	}
+}
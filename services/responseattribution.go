@@ -0,0 +1,47 @@
+package services
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 响应归属头（relay-config.json 中 attributionHeaders 开启后返回），无需打开应用即可确认实际处理请求的上游
+const (
+	ProviderHeader = "X-CodeSwitch-Provider" // 实际处理请求的 provider
+	LatencyHeader  = "X-CodeSwitch-Latency"  // 该 provider 返回响应头的耗时（毫秒）
+	RetriesHeader  = "X-CodeSwitch-Retries"  // 在此之前失败的 provider 尝试次数
+)
+
+// attemptContextKey 同一请求已尝试 provider 次数在 gin.Context 中的键
+const attemptContextKey = "codeswitch.attempts"
+
+// attemptCounter 返回请求共享的尝试计数器，不存在时创建
+// 计数器以指针保存，竞速/对冲请求使用的 c.Copy() 与原请求共用同一个计数，须在复制前调用
+func attemptCounter(c *gin.Context) *atomic.Int32 {
+	if value, ok := c.Get(attemptContextKey); ok {
+		if counter, ok := value.(*atomic.Int32); ok {
+			return counter
+		}
+	}
+	counter := &atomic.Int32{}
+	c.Set(attemptContextKey, counter)
+	return counter
+}
+
+// beginAttempt 记录一次 provider 尝试，返回此前的尝试次数（即重试次数）
+func beginAttempt(c *gin.Context) int {
+	return int(attemptCounter(c).Add(1) - 1)
+}
+
+// setAttributionHeaders 写入归属响应头，须在响应头发送前调用
+func setAttributionHeaders(c *gin.Context, providerName string, latency time.Duration, retries int) {
+	if !currentRelayConfig().AttributionHeaders {
+		return
+	}
+	c.Header(ProviderHeader, providerName)
+	c.Header(LatencyHeader, strconv.FormatInt(latency.Milliseconds(), 10))
+	c.Header(RetriesHeader, strconv.Itoa(retries))
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBeginAttemptSharedAcrossCopies(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	attemptCounter(c)
+	first, second := c.Copy(), c.Copy()
+	if got := beginAttempt(first); got != 0 {
+		t.Errorf("第一次尝试的重试次数应为 0，得到 %d", got)
+	}
+	if got := beginAttempt(second); got != 1 {
+		t.Errorf("复制的上下文应共用计数，得到 %d", got)
+	}
+	if got := beginAttempt(c); got != 2 {
+		t.Errorf("原上下文应看到复制上下文的尝试，得到 %d", got)
+	}
+}
+
+func TestRacedAttemptAttributionHeaders(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	config := DefaultRelayConfig()
+	config.AttributionHeaders = true
+	data, _ := json.Marshal(config)
+	if err := os.MkdirAll(filepath.Join(home, ".code-switch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".code-switch", "relay-config.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","type":"message","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer fast.Close()
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	prs := NewProviderRelayService(NewProviderService(), nil, nil, nil, "")
+	body := []byte(`{"model":"claude-sonnet-4","messages":[]}`)
+	primary := raceCandidate{provider: Provider{Name: "slow", APIURL: slow.URL, APIKey: "k", Enabled: true}, model: "claude-sonnet-4", body: body}
+	backup := raceCandidate{provider: Provider{Name: "fast", APIURL: fast.URL, APIKey: "k", Enabled: true}, model: "claude-sonnet-4", body: body}
+
+	outcome := prs.forwardRaced(c, "claude", "/v1/messages", nil, map[string]string{}, false, primary, backup, 20*time.Millisecond)
+	if outcome.winner == nil || outcome.winner.candidate.provider.Name != "fast" {
+		t.Fatalf("备用 provider 应获胜: %+v", outcome)
+	}
+	if got := recorder.Header().Get(ProviderHeader); got != "fast" {
+		t.Errorf("%s = %q, want fast", ProviderHeader, got)
+	}
+	if got := recorder.Header().Get(RetriesHeader); got != "1" {
+		t.Errorf("%s = %q，竞速的备用请求是第二次尝试，应为 1", RetriesHeader, got)
+	}
+	if recorder.Header().Get(LatencyHeader) == "" {
+		t.Errorf("应返回 %s", LatencyHeader)
+	}
+	if got := beginAttempt(c); got != 2 {
+		t.Errorf("竞速后原请求应计入两次尝试，得到 %d", got)
+	}
+}
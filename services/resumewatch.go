@@ -0,0 +1,175 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// resumeCheckInterval 唤醒检测的心跳间隔
+	resumeCheckInterval = 15 * time.Second
+	// resumeGapThreshold 心跳实际间隔超出预期多少即判定为系统曾睡眠（或墙上时钟发生跳变）
+	resumeGapThreshold = 30 * time.Second
+	// resumeSettleDelay 唤醒后等待网络重新连接的时间
+	resumeSettleDelay = 5 * time.Second
+	// resumeProbeTimeout 唤醒后快速探测的整体超时
+	resumeProbeTimeout = 15 * time.Second
+)
+
+// ResumeWatchService 检测系统从睡眠中唤醒，并重新校验 provider 状态：
+// 睡眠期间基于墙上时钟的定时器不会按时触发，缓存的 keep-alive 连接也多半已被对端关闭
+type ResumeWatchService struct {
+	blacklistService    *BlacklistService
+	connectivityService *ConnectivityTestService
+	networkMonitor      *NetworkMonitorService
+	notificationService *NotificationService
+	mu                  sync.Mutex
+	stopChan            chan struct{}
+	running             bool
+	lastBeat            time.Time // 上一次心跳时间，零值表示尚未开始
+	lastResumeAt        time.Time
+}
+
+func NewResumeWatchService(
+	blacklistService *BlacklistService,
+	connectivityService *ConnectivityTestService,
+	networkMonitor *NetworkMonitorService,
+	notificationService *NotificationService,
+) *ResumeWatchService {
+	return &ResumeWatchService{
+		blacklistService:    blacklistService,
+		connectivityService: connectivityService,
+		networkMonitor:      networkMonitor,
+		notificationService: notificationService,
+	}
+}
+
+// Start 注册唤醒检测任务
+func (rw *ResumeWatchService) Start() error {
+	rw.mu.Lock()
+	if !rw.running {
+		rw.stopChan = make(chan struct{})
+		rw.running = true
+	}
+	rw.lastBeat = time.Time{}
+	rw.mu.Unlock()
+
+	scheduleJob(backgroundJob{
+		name:     "resume_watch",
+		title:    "系统唤醒检测",
+		interval: func() time.Duration { return resumeCheckInterval },
+		run: func() error {
+			rw.beat(time.Now())
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止唤醒检测
+func (rw *ResumeWatchService) Stop() error {
+	unscheduleJob("resume_watch")
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.running {
+		close(rw.stopChan)
+		rw.running = false
+	}
+	return nil
+}
+
+// GetLastResumeAt 最近一次检测到唤醒的时间（毫秒，未检测到时为 0，供前端调用）
+func (rw *ResumeWatchService) GetLastResumeAt() int64 {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.lastResumeAt.IsZero() {
+		return 0
+	}
+	return rw.lastResumeAt.UnixMilli()
+}
+
+// beat 心跳：与上一次心跳比较墙上时钟与单调时钟的间隔，判断系统是否曾睡眠
+func (rw *ResumeWatchService) beat(now time.Time) {
+	rw.mu.Lock()
+	last, stop := rw.lastBeat, rw.stopChan
+	rw.mu.Unlock()
+	if !last.IsZero() {
+		// Round(0) 去掉单调时钟读数，得到墙上时钟的间隔
+		wall := now.Round(0).Sub(last.Round(0))
+		mono := now.Sub(last)
+		if slept, ok := detectResume(wall, mono, resumeCheckInterval); ok {
+			rw.revalidate(slept, stop)
+		}
+	}
+	// 以本轮结束时间作为下一次比较的起点，重新校验耗费的时间不计入间隔
+	rw.mu.Lock()
+	rw.lastBeat = time.Now()
+	rw.mu.Unlock()
+}
+
+// detectResume 根据心跳的墙上时钟与单调时钟间隔判断系统是否曾睡眠，返回估算的睡眠时长
+// 多数平台的单调时钟在睡眠期间暂停，此时只有墙上时钟出现跳变；
+// 单调时钟包含睡眠时间的平台则表现为心跳严重延迟，两种情况都需要识别
+func detectResume(wall, mono, interval time.Duration) (time.Duration, bool) {
+	elapsed := wall
+	if mono > elapsed {
+		elapsed = mono
+	}
+	slept := elapsed - interval
+	if slept < resumeGapThreshold {
+		return 0, false
+	}
+	return slept, true
+}
+
+// revalidate 唤醒后重新校验：重置空闲连接、检查黑名单过期、重新探测网络与已启用的 provider
+func (rw *ResumeWatchService) revalidate(slept time.Duration, stop chan struct{}) {
+	log.Printf("[ResumeWatch] 检测到系统唤醒（约睡眠 %s），重新校验 provider 状态", slept.Round(time.Second))
+	rw.mu.Lock()
+	rw.lastResumeAt = time.Now()
+	rw.mu.Unlock()
+	if rw.notificationService != nil {
+		rw.notificationService.NotifySystemResumed(slept)
+	}
+
+	// 睡眠前建立的连接多半已被对端或 NAT 断开，复用会导致首个请求失败
+	resetIdleConnections(rw.connectivityService)
+
+	// 过期的拉黑在睡眠期间没有被定时器恢复，立即补一次
+	if rw.blacklistService != nil {
+		if err := rw.blacklistService.AutoRecoverExpired(); err != nil {
+			log.Printf("[ResumeWatch] 自动恢复黑名单失败: %v", err)
+		}
+	}
+
+	// 等待网络重新连接，避免把唤醒瞬间的断网误判为 provider 故障
+	select {
+	case <-time.After(resumeSettleDelay):
+	case <-stop:
+		return
+	}
+	if rw.networkMonitor != nil && !rw.networkMonitor.CheckNow().Online {
+		log.Println("[ResumeWatch] 网络尚未恢复，跳过 provider 探测")
+		return
+	}
+	if rw.connectivityService == nil {
+		return
+	}
+	for _, platform := range []string{"claude", "codex"} {
+		results := rw.connectivityService.ProbeActive(platform, resumeProbeTimeout)
+		log.Printf("[ResumeWatch] 已探测 %s 的 %d 个已启用 provider", platform, len(results))
+	}
+}
+
+// resetIdleConnections 关闭共享 Transport 上的空闲连接
+// 转发请求每次使用新的客户端，不受影响；这里处理默认 Transport 与测试客户端上缓存的连接
+func resetIdleConnections(connectivityService *ConnectivityTestService) {
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+	if connectivityService != nil {
+		connectivityService.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectResume(t *testing.T) {
+	interval := 15 * time.Second
+	tests := []struct {
+		name      string
+		wall      time.Duration
+		mono      time.Duration
+		wantSlept time.Duration
+		wantOK    bool
+	}{
+		{"正常心跳", 15 * time.Second, 15 * time.Second, 0, false},
+		{"轻微延迟", 20 * time.Second, 20 * time.Second, 0, false},
+		{"单调时钟暂停", 10 * time.Minute, 15 * time.Second, 10*time.Minute - interval, true},
+		{"心跳严重延迟", 15 * time.Second, 2 * time.Minute, 2*time.Minute - interval, true},
+		{"墙上时钟回拨", -time.Hour, 15 * time.Second, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slept, ok := detectResume(tt.wall, tt.mono, interval)
+			if ok != tt.wantOK || slept != tt.wantSlept {
+				t.Errorf("detectResume = (%v, %v), want (%v, %v)", slept, ok, tt.wantSlept, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Retry-After 冷却：上游返回 429/503 并给出 Retry-After 时，按给定时间暂停向该 provider 转发，
+// 不计入连续失败次数（限流不是故障，不应触发拉黑）。
+// 降级模式下请求直接转给下一个 provider；所有候选都在冷却时，剩余时间较短则原地等待，否则向客户端返回 429 与 Retry-After。
+// 冷却状态只保存在内存中，重启后清空。
+
+// retryAfterError 上游限流错误，携带需要等待的时间
+type retryAfterError struct {
+	status int
+	wait   time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("upstream status %d, retry after %ds", e.status, retryAfterSeconds(e.wait))
+}
+
+// ProviderCooldown 按 Retry-After 冷却中的 provider
+type ProviderCooldown struct {
+	Platform         string `json:"platform"`
+	Provider         string `json:"provider"`
+	Status           int    `json:"status"` // 触发冷却的状态码（429/503）
+	Since            int64  `json:"since"`
+	Until            int64  `json:"until"`
+	RemainingSeconds int    `json:"remainingSeconds"`
+}
+
+type cooldownEntry struct {
+	status int
+	since  time.Time
+	until  time.Time
+}
+
+// cooldownTracker 各 provider 的冷却截止时间（key: platform/provider）
+type cooldownTracker struct {
+	mu      sync.Mutex
+	entries map[string]cooldownEntry
+}
+
+func newCooldownTracker() *cooldownTracker {
+	return &cooldownTracker{entries: make(map[string]cooldownEntry)}
+}
+
+func (t *cooldownTracker) set(kind, name string, status int, wait time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[kind+"/"+name] = cooldownEntry{status: status, since: now, until: now.Add(wait)}
+}
+
+// remaining 剩余冷却时间，未冷却返回 0
+func (t *cooldownTracker) remaining(kind, name string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := kind + "/" + name
+	entry, ok := t.entries[key]
+	if !ok {
+		return 0
+	}
+	if !now.Before(entry.until) {
+		delete(t.entries, key)
+		return 0
+	}
+	return entry.until.Sub(now)
+}
+
+func (t *cooldownTracker) clear(kind, name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := kind + "/" + name
+	_, ok := t.entries[key]
+	delete(t.entries, key)
+	return ok
+}
+
+// list 冷却中的 provider（按剩余时间升序），同时清理已过期的记录
+func (t *cooldownTracker) list(now time.Time) []ProviderCooldown {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]ProviderCooldown, 0, len(t.entries))
+	for key, entry := range t.entries {
+		if !now.Before(entry.until) {
+			delete(t.entries, key)
+			continue
+		}
+		platform, name, _ := strings.Cut(key, "/")
+		result = append(result, ProviderCooldown{
+			Platform:         platform,
+			Provider:         name,
+			Status:           entry.status,
+			Since:            entry.since.Unix(),
+			Until:            entry.until.Unix(),
+			RemainingSeconds: retryAfterSeconds(entry.until.Sub(now)),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Until < result[j].Until })
+	return result
+}
+
+// shortest 所有候选中剩余冷却时间最短的下标与剩余时间
+func (t *cooldownTracker) shortest(kind string, names []string, now time.Time) (int, time.Duration) {
+	best, bestWait := -1, time.Duration(0)
+	for i, name := range names {
+		wait := t.remaining(kind, name, now)
+		if best < 0 || wait < bestWait {
+			best, bestWait = i, wait
+		}
+	}
+	return best, bestWait
+}
+
+// parseRetryAfter 解析 retry-after-ms 或 Retry-After（秒数或 HTTP 日期），无有效值时返回 false
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if value := strings.TrimSpace(header.Get("Retry-After-Ms")); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms > 0 && !math.IsInf(ms, 0) {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 || math.IsInf(seconds, 0) {
+			return 0, false
+		}
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now), true
+	}
+	return 0, false
+}
+
+// minPositiveDuration 两者中较小的一个（0 视为未设置）
+func minPositiveDuration(current, candidate time.Duration) time.Duration {
+	if current == 0 || candidate < current {
+		return candidate
+	}
+	return current
+}
+
+// retryAfterSeconds 向上取整的秒数（Retry-After 响应头只接受整数秒）
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
+
+// validateRetryAfterConfig 校验 Retry-After 配置
+func validateRetryAfterConfig(config RelayRetryAfterConfig) error {
+	if config.MaxWaitSeconds < 0 || config.MaxWaitSeconds > 60 {
+		return fmt.Errorf("限流原地等待时间必须在 0-60 秒之间")
+	}
+	if config.MaxCooldownSeconds < 1 || config.MaxCooldownSeconds > 86400 {
+		return fmt.Errorf("限流最长冷却时间必须在 1-86400 秒之间")
+	}
+	return nil
+}
+
+// observeRetryAfter 429/503 带有 Retry-After 时让 provider 进入冷却，返回冷却时间
+func (prs *ProviderRelayService) observeRetryAfter(kind, name string, status int, header http.Header) (time.Duration, bool) {
+	config := currentRelayConfig().RetryAfter
+	if !config.Enabled || (status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable) || header == nil {
+		return 0, false
+	}
+	now := time.Now()
+	wait, ok := parseRetryAfter(header, now)
+	if !ok {
+		return 0, false
+	}
+	if limit := time.Duration(config.MaxCooldownSeconds) * time.Second; wait > limit {
+		wait = limit
+	}
+	prs.cooldowns.set(kind, name, status, wait, now)
+	fmt.Printf("[INFO] ⏳ Provider %s 返回 %d，按 Retry-After 冷却 %ds\n", name, status, retryAfterSeconds(wait))
+	return wait, true
+}
+
+// waitCooldownShort 等待时间不超过 MaxWaitSeconds 时原地等待，客户端断开或等待时间过长返回 false
+func waitCooldownShort(c *gin.Context, wait time.Duration) bool {
+	if wait > time.Duration(currentRelayConfig().RetryAfter.MaxWaitSeconds)*time.Second {
+		return false
+	}
+	fmt.Printf("[INFO] ⏳ 上游限流，等待 %.1fs 后重试\n", wait.Seconds())
+	select {
+	case <-time.After(wait):
+		return true
+	case <-c.Request.Context().Done():
+		return false
+	}
+}
+
+// waitCooldown 所有候选都在冷却时，等待最早恢复的 provider 并返回 true；
+// 等待时间过长时向客户端返回 429 与 Retry-After（客户端断开时不返回），返回 false
+func waitCooldown(c *gin.Context, kind, provider string, wait time.Duration) bool {
+	if waitCooldownShort(c, wait) {
+		return true
+	}
+	if c.Request.Context().Err() == nil {
+		respondRateLimited(c, kind, wait, fmt.Sprintf("所有 provider 均被上游限流，最早可用的 %s 还需等待 %ds", provider, retryAfterSeconds(wait)))
+	}
+	return false
+}
+
+// respondRateLimited 向客户端返回 429，并转告需要等待的时间
+func respondRateLimited(c *gin.Context, kind string, wait time.Duration, message string) {
+	seconds := retryAfterSeconds(wait)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	respondRelayError(c, kind, http.StatusTooManyRequests, message, gin.H{"retry_after": seconds})
+}
+
+// GetProviderCooldowns 列出按 Retry-After 冷却中的 provider（供前端调用）
+func (prs *ProviderRelayService) GetProviderCooldowns() []ProviderCooldown {
+	return prs.cooldowns.list(time.Now())
+}
+
+// ClearProviderCooldown 提前结束 provider 的冷却（供前端调用）
+func (prs *ProviderRelayService) ClearProviderCooldown(platform, name string) error {
+	if !prs.cooldowns.clear(platform, name) {
+		return fmt.Errorf("provider %s/%s 不在冷却中", platform, name)
+	}
+	return nil
+}
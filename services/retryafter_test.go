@@ -0,0 +1,55 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{http.Header{"Retry-After": {"30"}}, 30 * time.Second, true},
+		{http.Header{"Retry-After": {"Mon, 10 Mar 2025 12:01:00 GMT"}}, time.Minute, true},
+		{http.Header{"Retry-After": {"30"}, "Retry-After-Ms": {"1500"}}, 1500 * time.Millisecond, true},
+		{http.Header{"Retry-After": {"Mon, 10 Mar 2025 11:00:00 GMT"}}, 0, false}, // 已过去的时间
+		{http.Header{"Retry-After": {"0"}}, 0, false},
+		{http.Header{"Retry-After": {"soon"}}, 0, false},
+		{http.Header{}, 0, false},
+	}
+	for _, tc := range cases {
+		got, ok := parseRetryAfter(tc.header, now)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%v 应解析为 %v/%v，得到 %v/%v", tc.header, tc.want, tc.ok, got, ok)
+		}
+	}
+}
+
+func TestCooldownTracker(t *testing.T) {
+	tracker := newCooldownTracker()
+	now := time.Now()
+	tracker.set("claude", "A", http.StatusTooManyRequests, 30*time.Second, now)
+	tracker.set("claude", "B", http.StatusServiceUnavailable, 5*time.Second, now)
+
+	if wait := tracker.remaining("claude", "A", now.Add(10*time.Second)); wait != 20*time.Second {
+		t.Errorf("A 应剩余 20s，得到 %v", wait)
+	}
+	if wait := tracker.remaining("codex", "A", now); wait != 0 {
+		t.Errorf("不同平台不应共享冷却，得到 %v", wait)
+	}
+	if idx, wait := tracker.shortest("claude", []string{"A", "B"}, now); idx != 1 || wait != 5*time.Second {
+		t.Errorf("最早恢复的应为 B（5s），得到 %d/%v", idx, wait)
+	}
+
+	list := tracker.list(now.Add(10 * time.Second))
+	if len(list) != 1 || list[0].Provider != "A" || list[0].RemainingSeconds != 20 {
+		t.Errorf("B 已过期，只应剩 A，得到 %+v", list)
+	}
+	if !tracker.clear("claude", "A") || tracker.clear("claude", "A") {
+		t.Error("clear 应只对冷却中的 provider 返回 true")
+	}
+}
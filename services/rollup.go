@@ -0,0 +1,523 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 请求指标汇总：后台按小时/天将 request_log 汇总到 request_rollup（请求数、错误数、Token、费用、延迟百分位），
+// 汇总数据长期保留；原始记录按 RelayConfig.Retention 清理，只清理已汇总的部分。
+// 热力图等报表对已汇总的时段直接读取汇总数据。
+
+const (
+	RollupGranularityHour = "hour"
+	RollupGranularityDay  = "day"
+)
+
+const (
+	// rollupInterval 汇总任务执行间隔
+	rollupInterval = time.Hour
+	// rollupStartDelay 启动后首次汇总的延迟，避免与启动流程争用数据库
+	rollupStartDelay = 2 * time.Minute
+	// rollupGrace 时段结束后等待的时间，确保写入队列中的日志已落库
+	rollupGrace = 5 * time.Minute
+	// rollupBatchDays 每次读取的原始记录跨度（首次汇总历史数据时分批处理）
+	rollupBatchDays = 7
+)
+
+// UsageRollup 一个时段内某个 provider/模型的汇总指标
+type UsageRollup struct {
+	Granularity       string  `json:"granularity"`
+	BucketStart       int64   `json:"bucketStart"` // 时段起点（秒级时间戳，按本地时区对齐）
+	Platform          string  `json:"platform"`
+	Provider          string  `json:"provider"`
+	Model             string  `json:"model"`
+	Requests          int64   `json:"requests"`
+	Successes         int64   `json:"successes"`
+	Errors            int64   `json:"errors"`
+	InputTokens       int64   `json:"inputTokens"`
+	OutputTokens      int64   `json:"outputTokens"`
+	ReasoningTokens   int64   `json:"reasoningTokens"`
+	CacheCreateTokens int64   `json:"cacheCreateTokens"`
+	CacheReadTokens   int64   `json:"cacheReadTokens"`
+	Cost              float64 `json:"cost"`          // 按汇总时的价格计算
+	DurationP50Ms     float64 `json:"durationP50Ms"` // 延迟百分位只统计成功请求
+	DurationP95Ms     float64 `json:"durationP95Ms"`
+	DurationP99Ms     float64 `json:"durationP99Ms"`
+	TTFTP50Ms         float64 `json:"ttftP50Ms"`
+	TTFTP95Ms         float64 `json:"ttftP95Ms"`
+}
+
+// RollupRunResult 一次汇总任务的结果
+type RollupRunResult struct {
+	HourlyRows    int   `json:"hourlyRows"`    // 写入的小时汇总行数
+	DailyRows     int   `json:"dailyRows"`     // 写入的天汇总行数
+	RawPurged     int64 `json:"rawPurged"`     // 清理的原始记录数
+	RollupsPurged int64 `json:"rollupsPurged"` // 清理的过期汇总行数
+}
+
+// rollupSample 汇总用的单条请求记录
+type rollupSample struct {
+	Platform     string
+	Provider     string
+	Model        string
+	CreatedAt    time.Time
+	HTTPCode     int
+	Usage        modelpricing.UsageSnapshot
+	DurationSec  float64
+	FirstByteSec float64
+}
+
+func ensureRollupTable() error {
+	db, err := sharedDB()
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS request_rollup (
+		granularity TEXT NOT NULL,
+		bucket_start BIGINT NOT NULL,
+		platform TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		requests BIGINT DEFAULT 0,
+		successes BIGINT DEFAULT 0,
+		errors BIGINT DEFAULT 0,
+		input_tokens BIGINT DEFAULT 0,
+		output_tokens BIGINT DEFAULT 0,
+		reasoning_tokens BIGINT DEFAULT 0,
+		cache_create_tokens BIGINT DEFAULT 0,
+		cache_read_tokens BIGINT DEFAULT 0,
+		cost REAL DEFAULT 0,
+		duration_p50_ms REAL DEFAULT 0,
+		duration_p95_ms REAL DEFAULT 0,
+		duration_p99_ms REAL DEFAULT 0,
+		ttft_p50_ms REAL DEFAULT 0,
+		ttft_p95_ms REAL DEFAULT 0,
+		UNIQUE (granularity, bucket_start, platform, provider, model)
+	)`
+	if _, err := db.Exec(sharedDialect().DDL(createTableSQL)); err != nil {
+		return fmt.Errorf("创建 request_rollup 表失败: %w", err)
+	}
+	return nil
+}
+
+// validateRetentionConfig 校验保留策略
+func validateRetentionConfig(config RelayRetentionConfig) error {
+	if config.RawDays < 0 || config.HourlyDays < 0 || config.DailyDays < 0 {
+		return fmt.Errorf("保留天数不能为负数")
+	}
+	if config.RawDays > 0 && config.RawDays < 7 {
+		return fmt.Errorf("原始请求日志至少保留 7 天")
+	}
+	if config.HourlyDays > 0 && config.HourlyDays < 7 {
+		return fmt.Errorf("小时汇总至少保留 7 天")
+	}
+	return nil
+}
+
+// rollupBucketStart 时间所在时段的起点
+func rollupBucketStart(granularity string, t time.Time) time.Time {
+	if granularity == RollupGranularityDay {
+		return startOfDay(t)
+	}
+	return startOfHour(t)
+}
+
+// nextRollupBucket 下一个时段的起点（天粒度按日历日推进，跨夏令时也对齐到零点）
+func nextRollupBucket(granularity string, start time.Time) time.Time {
+	if granularity == RollupGranularityDay {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.Add(time.Hour)
+}
+
+// aggregateRollups 按时段、平台、provider、模型汇总请求记录
+func aggregateRollups(granularity string, samples []rollupSample, cost func(model string, usage modelpricing.UsageSnapshot) float64) []UsageRollup {
+	type rollupKey struct {
+		bucket   int64
+		platform string
+		provider string
+		model    string
+	}
+	type rollupAcc struct {
+		row       UsageRollup
+		durations []float64
+		ttfts     []float64
+	}
+	groups := map[rollupKey]*rollupAcc{}
+	for _, s := range samples {
+		key := rollupKey{rollupBucketStart(granularity, s.CreatedAt).Unix(), s.Platform, s.Provider, s.Model}
+		acc := groups[key]
+		if acc == nil {
+			acc = &rollupAcc{row: UsageRollup{
+				Granularity: granularity,
+				BucketStart: key.bucket,
+				Platform:    s.Platform,
+				Provider:    s.Provider,
+				Model:       s.Model,
+			}}
+			groups[key] = acc
+		}
+		row := &acc.row
+		row.Requests++
+		if s.HTTPCode >= 200 && s.HTTPCode < 300 {
+			row.Successes++
+			acc.durations = append(acc.durations, s.DurationSec*1000)
+			if s.FirstByteSec > 0 {
+				acc.ttfts = append(acc.ttfts, s.FirstByteSec*1000)
+			}
+		} else {
+			row.Errors++
+		}
+		row.InputTokens += int64(s.Usage.InputTokens)
+		row.OutputTokens += int64(s.Usage.OutputTokens)
+		row.ReasoningTokens += int64(s.Usage.ReasoningTokens)
+		row.CacheCreateTokens += int64(s.Usage.CacheCreateTokens)
+		row.CacheReadTokens += int64(s.Usage.CacheReadTokens)
+		if cost != nil {
+			row.Cost += cost(s.Model, s.Usage)
+		}
+	}
+
+	rows := make([]UsageRollup, 0, len(groups))
+	for _, acc := range groups {
+		row := acc.row
+		row.DurationP50Ms = percentileOf(acc.durations, 50)
+		row.DurationP95Ms = percentileOf(acc.durations, 95)
+		row.DurationP99Ms = percentileOf(acc.durations, 99)
+		row.TTFTP50Ms = percentileOf(acc.ttfts, 50)
+		row.TTFTP95Ms = percentileOf(acc.ttfts, 95)
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.BucketStart != b.BucketStart {
+			return a.BucketStart < b.BucketStart
+		}
+		if a.Platform != b.Platform {
+			return a.Platform < b.Platform
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.Model < b.Model
+	})
+	return rows
+}
+
+// loadRollupSamples 读取 [from, to) 内的原始请求记录
+func loadRollupSamples(from, to time.Time) ([]rollupSample, error) {
+	records, err := sharedModel("request_log").Selects(
+		xdb.WhereGe("created_at", from.Unix()),
+		xdb.WhereLt("created_at", to.Unix()),
+		xdb.Field(
+			"platform",
+			"provider",
+			"model",
+			"http_code",
+			"input_tokens",
+			"output_tokens",
+			"reasoning_tokens",
+			"cache_create_tokens",
+			"cache_read_tokens",
+			"duration_sec",
+			"first_byte_sec",
+			"created_at",
+		),
+	)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	samples := make([]rollupSample, 0, len(records))
+	for _, record := range records {
+		createdAt, ok := parseCreatedAt(record)
+		if !ok {
+			continue
+		}
+		samples = append(samples, rollupSample{
+			Platform:  record.GetString("platform"),
+			Provider:  record.GetString("provider"),
+			Model:     record.GetString("model"),
+			CreatedAt: createdAt,
+			HTTPCode:  record.GetInt("http_code"),
+			Usage: modelpricing.UsageSnapshot{
+				InputTokens:       record.GetInt("input_tokens"),
+				OutputTokens:      record.GetInt("output_tokens"),
+				ReasoningTokens:   record.GetInt("reasoning_tokens"),
+				CacheCreateTokens: record.GetInt("cache_create_tokens"),
+				CacheReadTokens:   record.GetInt("cache_read_tokens"),
+			},
+			DurationSec:  record.GetFloat64("duration_sec"),
+			FirstByteSec: record.GetFloat64("first_byte_sec"),
+		})
+	}
+	return samples, nil
+}
+
+// rollupCoveredUntil 该粒度已汇总到的时间（最后一个汇总时段的终点），没有汇总数据时返回零值
+func rollupCoveredUntil(granularity string) time.Time {
+	db, err := sharedDB()
+	if err != nil {
+		return time.Time{}
+	}
+	var last sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(bucket_start) FROM request_rollup WHERE granularity = ?`, granularity).Scan(&last); err != nil || !last.Valid {
+		return time.Time{}
+	}
+	return nextRollupBucket(granularity, time.Unix(last.Int64, 0))
+}
+
+// earliestRequestTime 最早一条原始请求记录的时间
+func earliestRequestTime() time.Time {
+	record, err := sharedModel("request_log").First(
+		xdb.Field("created_at"),
+		xdb.OrderByAsc("created_at"),
+	)
+	if err != nil {
+		return time.Time{}
+	}
+	createdAt, _ := parseCreatedAt(record)
+	return createdAt
+}
+
+// saveRollups 写入汇总行（同一时段重复汇总时覆盖）
+func saveRollups(rows []UsageRollup) error {
+	if GlobalDBQueueShared == nil {
+		return fmt.Errorf("数据库队列未初始化")
+	}
+	const upsertSQL = `INSERT INTO request_rollup (
+		granularity, bucket_start, platform, provider, model,
+		requests, successes, errors,
+		input_tokens, output_tokens, reasoning_tokens, cache_create_tokens, cache_read_tokens, cost,
+		duration_p50_ms, duration_p95_ms, duration_p99_ms, ttft_p50_ms, ttft_p95_ms
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (granularity, bucket_start, platform, provider, model) DO UPDATE SET
+		requests = excluded.requests,
+		successes = excluded.successes,
+		errors = excluded.errors,
+		input_tokens = excluded.input_tokens,
+		output_tokens = excluded.output_tokens,
+		reasoning_tokens = excluded.reasoning_tokens,
+		cache_create_tokens = excluded.cache_create_tokens,
+		cache_read_tokens = excluded.cache_read_tokens,
+		cost = excluded.cost,
+		duration_p50_ms = excluded.duration_p50_ms,
+		duration_p95_ms = excluded.duration_p95_ms,
+		duration_p99_ms = excluded.duration_p99_ms,
+		ttft_p50_ms = excluded.ttft_p50_ms,
+		ttft_p95_ms = excluded.ttft_p95_ms`
+	for _, r := range rows {
+		if err := GlobalDBQueueShared.Exec(upsertSQL,
+			r.Granularity, r.BucketStart, r.Platform, r.Provider, r.Model,
+			r.Requests, r.Successes, r.Errors,
+			r.InputTokens, r.OutputTokens, r.ReasoningTokens, r.CacheCreateTokens, r.CacheReadTokens, r.Cost,
+			r.DurationP50Ms, r.DurationP95Ms, r.DurationP99Ms, r.TTFTP50Ms, r.TTFTP95Ms,
+		); err != nil {
+			return fmt.Errorf("写入请求汇总失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadRollups 读取 [from, to) 内的汇总行，platform 为空时读取全部平台
+func loadRollups(granularity, platform string, from, to time.Time) ([]UsageRollup, error) {
+	options := []xdb.Option{
+		xdb.WhereEq("granularity", granularity),
+		xdb.WhereGe("bucket_start", from.Unix()),
+		xdb.WhereLt("bucket_start", to.Unix()),
+		xdb.OrderByAsc("bucket_start"),
+	}
+	if platform != "" {
+		options = append(options, xdb.WhereEq("platform", platform))
+	}
+	records, err := sharedModel("request_rollup").Selects(options...)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return []UsageRollup{}, nil
+		}
+		return nil, err
+	}
+	rows := make([]UsageRollup, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, UsageRollup{
+			Granularity:       record.GetString("granularity"),
+			BucketStart:       record.GetInt64("bucket_start"),
+			Platform:          record.GetString("platform"),
+			Provider:          record.GetString("provider"),
+			Model:             record.GetString("model"),
+			Requests:          record.GetInt64("requests"),
+			Successes:         record.GetInt64("successes"),
+			Errors:            record.GetInt64("errors"),
+			InputTokens:       record.GetInt64("input_tokens"),
+			OutputTokens:      record.GetInt64("output_tokens"),
+			ReasoningTokens:   record.GetInt64("reasoning_tokens"),
+			CacheCreateTokens: record.GetInt64("cache_create_tokens"),
+			CacheReadTokens:   record.GetInt64("cache_read_tokens"),
+			Cost:              record.GetFloat64("cost"),
+			DurationP50Ms:     record.GetFloat64("duration_p50_ms"),
+			DurationP95Ms:     record.GetFloat64("duration_p95_ms"),
+			DurationP99Ms:     record.GetFloat64("duration_p99_ms"),
+			TTFTP50Ms:         record.GetFloat64("ttft_p50_ms"),
+			TTFTP95Ms:         record.GetFloat64("ttft_p95_ms"),
+		})
+	}
+	return rows, nil
+}
+
+// RollupService 请求指标汇总：每小时汇总已结束的时段，并按保留策略清理原始记录与过期汇总
+type RollupService struct {
+	logService *LogService
+	runMu      sync.Mutex // 串行执行汇总任务
+}
+
+// NewRollupService 创建汇总服务（费用按 logService 的模型价格计算）
+func NewRollupService(logService *LogService) *RollupService {
+	return &RollupService{logService: logService}
+}
+
+// Start 注册后台定时汇总任务
+func (rs *RollupService) Start() error {
+	scheduleJob(backgroundJob{
+		name:     "rollup",
+		title:    "请求指标汇总与清理",
+		delay:    rollupStartDelay,
+		interval: func() time.Duration { return rollupInterval },
+		run: func() error {
+			result, err := rs.RunRollups()
+			if err != nil {
+				return fmt.Errorf("汇总请求指标失败: %w", err)
+			}
+			if result.RawPurged > 0 || result.RollupsPurged > 0 {
+				log.Printf("[Rollup] 已清理 %d 条原始请求记录、%d 条过期汇总", result.RawPurged, result.RollupsPurged)
+			}
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止后台汇总
+func (rs *RollupService) Stop() error {
+	unscheduleJob("rollup")
+	return nil
+}
+
+// RunRollups 立即执行一次汇总与清理（供前端调用）
+func (rs *RollupService) RunRollups() (*RollupRunResult, error) {
+	rs.runMu.Lock()
+	defer rs.runMu.Unlock()
+
+	now := time.Now()
+	result := &RollupRunResult{}
+	var err error
+	if result.HourlyRows, err = rs.rollupPending(RollupGranularityHour, now); err != nil {
+		return result, err
+	}
+	if result.DailyRows, err = rs.rollupPending(RollupGranularityDay, now); err != nil {
+		return result, err
+	}
+	if err := purgeExpiredUsage(currentRelayConfig().Retention, now, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// GetUsageRollups 获取最近 days 天的汇总数据（供前端调用），granularity 为 hour 或 day，platform 为空时返回全部平台
+func (rs *RollupService) GetUsageRollups(granularity, platform string, days int) ([]UsageRollup, error) {
+	if granularity != RollupGranularityHour && granularity != RollupGranularityDay {
+		return nil, fmt.Errorf("无效的汇总粒度: %s（可选值: hour、day）", granularity)
+	}
+	if days <= 0 {
+		days = 30
+	}
+	now := time.Now()
+	return loadRollups(granularity, platform, startOfDay(now).AddDate(0, 0, -(days-1)), now)
+}
+
+// rollupPending 汇总该粒度下尚未汇总且已结束的时段，返回写入的行数
+func (rs *RollupService) rollupPending(granularity string, now time.Time) (int, error) {
+	end := rollupBucketStart(granularity, now.Add(-rollupGrace))
+	from := rollupCoveredUntil(granularity)
+	if from.IsZero() {
+		earliest := earliestRequestTime()
+		if earliest.IsZero() {
+			return 0, nil
+		}
+		from = rollupBucketStart(granularity, earliest)
+	}
+
+	var cost func(string, modelpricing.UsageSnapshot) float64
+	if rs.logService != nil {
+		cost = func(model string, usage modelpricing.UsageSnapshot) float64 {
+			return rs.logService.calculateCost(model, usage).TotalCost
+		}
+	}
+
+	written := 0
+	for from.Before(end) {
+		batchEnd := rollupBucketStart(granularity, from.AddDate(0, 0, rollupBatchDays))
+		if batchEnd.After(end) {
+			batchEnd = end
+		}
+		samples, err := loadRollupSamples(from, batchEnd)
+		if err != nil {
+			return written, fmt.Errorf("读取请求日志失败: %w", err)
+		}
+		rows := aggregateRollups(granularity, samples, cost)
+		if err := saveRollups(rows); err != nil {
+			return written, err
+		}
+		written += len(rows)
+		from = batchEnd
+	}
+	return written, nil
+}
+
+// purgeExpiredUsage 按保留策略清理原始记录（只清理小时与天汇总都已覆盖的部分）与过期汇总
+func purgeExpiredUsage(config RelayRetentionConfig, now time.Time, result *RollupRunResult) error {
+	today := startOfDay(now)
+	if config.RawDays > 0 {
+		cutoff := today.AddDate(0, 0, -config.RawDays)
+		for _, granularity := range []string{RollupGranularityHour, RollupGranularityDay} {
+			if covered := rollupCoveredUntil(granularity); covered.Before(cutoff) {
+				cutoff = covered
+			}
+		}
+		if !cutoff.IsZero() {
+			for _, table := range []string{"request_feedback", "request_annotation", "request_log"} {
+				n, err := execPurge(table, "DELETE FROM "+table+" WHERE created_at < ?", cutoff.Unix())
+				if err != nil {
+					return fmt.Errorf("清理 %s 失败: %w", table, err)
+				}
+				if table == "request_log" {
+					result.RawPurged = n
+				}
+			}
+		}
+	}
+
+	for granularity, days := range map[string]int{RollupGranularityHour: config.HourlyDays, RollupGranularityDay: config.DailyDays} {
+		if days <= 0 {
+			continue
+		}
+		n, err := execPurge("request_rollup", `DELETE FROM request_rollup WHERE granularity = ? AND bucket_start < ?`, granularity, today.AddDate(0, 0, -days).Unix())
+		if err != nil {
+			return fmt.Errorf("清理过期汇总失败: %w", err)
+		}
+		result.RollupsPurged += n
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+)
+
+func TestAggregateRollups(t *testing.T) {
+	base := time.Date(2025, 3, 10, 14, 0, 0, 0, time.Local)
+	var samples []rollupSample
+	// 14 点：10 个成功请求（耗时 1-10 秒）与 2 个失败请求
+	for i := 1; i <= 10; i++ {
+		samples = append(samples, rollupSample{
+			Platform: "claude", Provider: "A", Model: "m", CreatedAt: base.Add(time.Duration(i) * time.Minute), HTTPCode: 200,
+			Usage:       modelpricing.UsageSnapshot{InputTokens: 100, OutputTokens: 10},
+			DurationSec: float64(i), FirstByteSec: 0.5,
+		})
+	}
+	for i := 0; i < 2; i++ {
+		samples = append(samples, rollupSample{Platform: "claude", Provider: "A", Model: "m", CreatedAt: base.Add(30 * time.Minute), HTTPCode: 502, DurationSec: 60})
+	}
+	// 15 点：1 个成功请求
+	samples = append(samples, rollupSample{Platform: "claude", Provider: "A", Model: "m", CreatedAt: base.Add(70 * time.Minute), HTTPCode: 200, DurationSec: 2})
+
+	cost := func(model string, usage modelpricing.UsageSnapshot) float64 { return float64(usage.InputTokens) / 1000 }
+
+	hourly := aggregateRollups(RollupGranularityHour, samples, cost)
+	if len(hourly) != 2 {
+		t.Fatalf("应按小时分为 2 组，得到 %d", len(hourly))
+	}
+	first := hourly[0]
+	if first.BucketStart != base.Unix() || first.Requests != 12 || first.Successes != 10 || first.Errors != 2 {
+		t.Errorf("14 点汇总不正确: %+v", first)
+	}
+	if first.InputTokens != 1000 || first.OutputTokens != 100 || first.Cost < 0.999 || first.Cost > 1.001 {
+		t.Errorf("Token 或费用汇总不正确: %+v", first)
+	}
+	// 失败请求不计入延迟百分位
+	if first.DurationP50Ms != 5000 || first.DurationP95Ms != 10000 || first.TTFTP50Ms != 500 {
+		t.Errorf("延迟百分位不正确: p50=%.0f p95=%.0f ttft=%.0f", first.DurationP50Ms, first.DurationP95Ms, first.TTFTP50Ms)
+	}
+	if hourly[1].Requests != 1 || hourly[1].TTFTP50Ms != 0 {
+		t.Errorf("15 点汇总不正确: %+v", hourly[1])
+	}
+
+	daily := aggregateRollups(RollupGranularityDay, samples, nil)
+	if len(daily) != 1 || daily[0].Requests != 13 || daily[0].BucketStart != startOfDay(base).Unix() {
+		t.Errorf("天汇总不正确: %+v", daily)
+	}
+}
+
+func TestValidateRetentionConfig(t *testing.T) {
+	if err := validateRetentionConfig(DefaultRelayConfig().Retention); err != nil {
+		t.Fatalf("默认保留策略应有效: %v", err)
+	}
+	if err := validateRetentionConfig(RelayRetentionConfig{RawDays: 3}); err == nil {
+		t.Error("原始记录保留少于 7 天应报错")
+	}
+	if err := validateRetentionConfig(RelayRetentionConfig{DailyDays: -1}); err == nil {
+		t.Error("负数保留天数应报错")
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// routeAnalysisTimeout 路由追踪的总超时时间
+	routeAnalysisTimeout = 90 * time.Second
+	// routeMaxHops 最大跳数
+	routeMaxHops = 30
+	// routeLatencyJumpMs 相邻两跳延迟增加超过该值视为明显劣化
+	routeLatencyJumpMs = 80
+)
+
+// RouteHop 单跳结果
+type RouteHop struct {
+	Hop         int       `json:"hop"`
+	Address     string    `json:"address"`     // 该跳 IP，全部超时时为空
+	LatenciesMs []float64 `json:"latenciesMs"` // 每次探测的延迟
+	AvgMs       float64   `json:"avgMs"`
+	LossPercent float64   `json:"lossPercent"` // 探测丢失比例
+}
+
+// RouteAnalysis 路由分析结果
+type RouteAnalysis struct {
+	URL           string     `json:"url"`
+	Host          string     `json:"host"`
+	TargetIP      string     `json:"targetIp"`
+	Hops          []RouteHop `json:"hops"`
+	ReachedTarget bool       `json:"reachedTarget"`
+	Diagnosis     string     `json:"diagnosis"` // 结论：问题更可能出在本地网络、运营商线路还是服务端
+}
+
+// AnalyzeRoute 对端点主机做路由追踪（供前端调用），输出每跳延迟
+// 依赖系统自带的 tracert / traceroute，命令不可用或无权限时返回错误
+func (s *SpeedTestService) AnalyzeRoute(rawURL string) (*RouteAnalysis, error) {
+	parsed, err := neturl.Parse(trimSpace(rawURL))
+	if err != nil || parsed.Hostname() == "" {
+		return nil, fmt.Errorf("URL 无效: %s", rawURL)
+	}
+	host := parsed.Hostname()
+
+	ctx, cancel := context.WithTimeout(context.Background(), routeAnalysisTimeout)
+	defer cancel()
+
+	targetIP := host
+	if net.ParseIP(host) == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			return nil, fmt.Errorf("解析 %s 失败: %v", host, err)
+		}
+		// 优先使用 IPv4，traceroute 默认只走 IPv4
+		targetIP = addrs[0].IP.String()
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				targetIP = addr.IP.String()
+				break
+			}
+		}
+	}
+
+	cmd, err := traceCommand(ctx, targetIP)
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("路由追踪超时（%s）", routeAnalysisTimeout)
+	}
+	hops := parseTraceOutput(string(out))
+	if err != nil && len(hops) == 0 {
+		return nil, fmt.Errorf("执行路由追踪失败（可能缺少权限）: %w", err)
+	}
+
+	analysis := &RouteAnalysis{
+		URL:      parsed.String(),
+		Host:     host,
+		TargetIP: targetIP,
+		Hops:     hops,
+	}
+	if len(hops) > 0 && hops[len(hops)-1].Address == targetIP {
+		analysis.ReachedTarget = true
+	}
+	analysis.Diagnosis = diagnoseRoute(analysis)
+	return analysis, nil
+}
+
+// traceCommand 构建各平台的路由追踪命令（-d / -n 关闭反向解析以加快速度）
+func traceCommand(ctx context.Context, target string) (*exec.Cmd, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.CommandContext(ctx, "tracert", "-d", "-h", strconv.Itoa(routeMaxHops), "-w", "1000", target), nil
+	case "darwin", "linux":
+		path, err := exec.LookPath("traceroute")
+		if err != nil {
+			return nil, errors.New("未找到 traceroute 命令，请先安装（如 apt install traceroute）")
+		}
+		return exec.CommandContext(ctx, path, "-n", "-q", "3", "-w", "2", "-m", strconv.Itoa(routeMaxHops), target), nil
+	default:
+		return nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+}
+
+// parseTraceOutput 解析 tracert / traceroute 输出
+// 兼容格式：
+//
+//	Windows:  "  3    12 ms    11 ms    <1 ms  10.0.0.1"、"  4     *        *        *     请求超时。"
+//	Unix:     " 3  10.0.0.1  12.345 ms  11.2 ms  10.9 ms"、" 4  * * *"
+func parseTraceOutput(output string) []RouteHop {
+	var hops []RouteHop
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		hopNum, err := strconv.Atoi(fields[0])
+		if err != nil || hopNum <= 0 {
+			continue
+		}
+
+		hop := RouteHop{Hop: hopNum, LatenciesMs: []float64{}}
+		probes, lost := 0, 0
+		for i := 1; i < len(fields); i++ {
+			field := strings.Trim(fields[i], "[]()")
+			switch {
+			case field == "*":
+				probes++
+				lost++
+			case strings.EqualFold(field, "ms"):
+				// 单位，已在前一个数值处理
+			case strings.HasPrefix(field, "<"):
+				// Windows 的 "<1 ms"：只知道上限，按上限记录
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSuffix(field, "ms"), "<"), 64); err == nil {
+					hop.LatenciesMs = append(hop.LatenciesMs, v)
+					probes++
+				}
+			default:
+				if ip := net.ParseIP(field); ip != nil {
+					if hop.Address == "" {
+						hop.Address = ip.String()
+					}
+					continue
+				}
+				if v, err := strconv.ParseFloat(strings.TrimSuffix(field, "ms"), 64); err == nil {
+					hop.LatenciesMs = append(hop.LatenciesMs, v)
+					probes++
+				}
+			}
+		}
+		if probes == 0 {
+			continue
+		}
+		if len(hop.LatenciesMs) > 0 {
+			total := 0.0
+			for _, v := range hop.LatenciesMs {
+				total += v
+			}
+			hop.AvgMs = total / float64(len(hop.LatenciesMs))
+		}
+		hop.LossPercent = float64(lost) / float64(probes) * 100
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// diagnoseRoute 根据延迟在哪一跳明显增加，粗略判断问题出在哪里
+func diagnoseRoute(analysis *RouteAnalysis) string {
+	var responsive []RouteHop
+	for _, hop := range analysis.Hops {
+		if len(hop.LatenciesMs) > 0 {
+			responsive = append(responsive, hop)
+		}
+	}
+	if len(responsive) == 0 {
+		return "所有跳均无响应，可能是防火墙屏蔽了探测包，无法判断线路情况"
+	}
+
+	first := responsive[0]
+	if first.AvgMs > routeLatencyJumpMs {
+		return fmt.Sprintf("第一跳（本地网关 %s）延迟已达 %.0fms，问题很可能在本地网络（Wi-Fi 信号、路由器负载）", first.Address, first.AvgMs)
+	}
+
+	jumpAt, jump := -1, 0.0
+	for i := 1; i < len(responsive); i++ {
+		if delta := responsive[i].AvgMs - responsive[i-1].AvgMs; delta > jump {
+			jumpAt, jump = i, delta
+		}
+	}
+
+	last := responsive[len(responsive)-1]
+	switch {
+	case jump < routeLatencyJumpMs && analysis.ReachedTarget:
+		return fmt.Sprintf("线路正常，到达目标延迟 %.0fms；如果请求仍然很慢，更可能是服务端处理慢", last.AvgMs)
+	case jumpAt >= 0 && jump >= routeLatencyJumpMs && jumpAt >= len(responsive)-2:
+		return fmt.Sprintf("延迟在靠近目标的第 %d 跳（%s）增加 %.0fms，更可能是服务商一侧的问题", responsive[jumpAt].Hop, responsive[jumpAt].Address, jump)
+	case jumpAt >= 0 && jump >= routeLatencyJumpMs:
+		return fmt.Sprintf("延迟在中间第 %d 跳（%s）增加 %.0fms，可能是运营商线路或国际出口拥堵，可尝试更换线路或使用代理", responsive[jumpAt].Hop, responsive[jumpAt].Address, jump)
+	case !analysis.ReachedTarget:
+		return fmt.Sprintf("追踪在第 %d 跳后未到达目标，目标可能屏蔽了探测包，或线路在此中断", last.Hop)
+	default:
+		return "未发现明显的延迟突增"
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTraceOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []RouteHop
+	}{
+		{
+			name: "Windows",
+			output: "\r\nTracing route to 104.18.32.47 over a maximum of 20 hops\r\n\r\n" +
+				"  1    <1 ms    <1 ms    <1 ms  192.168.1.1\r\n" +
+				"  2     3 ms     2 ms     4 ms  10.0.0.1\r\n" +
+				"  3     *        *        *     Request timed out.\r\n" +
+				"  4    12 ms     *       14 ms  104.18.32.47\r\n\r\nTrace complete.\r\n",
+			want: []RouteHop{
+				{Hop: 1, Address: "192.168.1.1", LatenciesMs: []float64{1, 1, 1}, AvgMs: 1},
+				{Hop: 2, Address: "10.0.0.1", LatenciesMs: []float64{3, 2, 4}, AvgMs: 3},
+				{Hop: 3, LatenciesMs: []float64{}, LossPercent: 100},
+				{Hop: 4, Address: "104.18.32.47", LatenciesMs: []float64{12, 14}, AvgMs: 13, LossPercent: 100.0 / 3},
+			},
+		},
+		{
+			name: "Windows 中文",
+			output: "通过最多 20 个跃点跟踪到 104.18.32.47 的路由\r\n\r\n" +
+				"  1    <1 毫秒   <1 毫秒   <1 毫秒 192.168.1.1\r\n" +
+				"  2     *        *        *     请求超时。\r\n\r\n跟踪完成。\r\n",
+			want: []RouteHop{
+				{Hop: 1, Address: "192.168.1.1", LatenciesMs: []float64{1, 1, 1}, AvgMs: 1},
+				{Hop: 2, LatenciesMs: []float64{}, LossPercent: 100},
+			},
+		},
+		{
+			name: "macOS",
+			output: "traceroute to 104.18.32.47 (104.18.32.47), 20 hops max, 52 byte packets\n" +
+				" 1  192.168.1.1  2.000 ms  1.000 ms  3.000 ms\n" +
+				" 2  * 10.0.0.1  5.5 ms  6.5 ms\n" +
+				" 3  * * *\n",
+			want: []RouteHop{
+				{Hop: 1, Address: "192.168.1.1", LatenciesMs: []float64{2, 1, 3}, AvgMs: 2},
+				{Hop: 2, Address: "10.0.0.1", LatenciesMs: []float64{5.5, 6.5}, AvgMs: 6, LossPercent: 100.0 / 3},
+				{Hop: 3, LatenciesMs: []float64{}, LossPercent: 100},
+			},
+		},
+		{
+			name: "Linux",
+			output: "traceroute to 104.18.32.47 (104.18.32.47), 20 hops max, 60 byte packets\n" +
+				" 1  172.17.0.1  0.050 ms  0.030 ms  0.040 ms\n" +
+				" 2  10.0.0.1  8.000 ms 10.0.0.2  10.000 ms  12.000 ms\n" +
+				"10  104.18.32.47  20.000 ms !H  20.000 ms !H  20.000 ms !H\n",
+			want: []RouteHop{
+				{Hop: 1, Address: "172.17.0.1", LatenciesMs: []float64{0.05, 0.03, 0.04}, AvgMs: 0.04},
+				{Hop: 2, Address: "10.0.0.1", LatenciesMs: []float64{8, 10, 12}, AvgMs: 10},
+				{Hop: 10, Address: "104.18.32.47", LatenciesMs: []float64{20, 20, 20}, AvgMs: 20},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := parseTraceOutput(tt.output)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: 解析出 %d 跳，期望 %d: %+v", tt.name, len(got), len(tt.want), got)
+			continue
+		}
+		for i := range got {
+			if !hopsEqual(got[i], tt.want[i]) {
+				t.Errorf("%s: 第 %d 跳 = %+v, want %+v", tt.name, i+1, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+// hopsEqual 比较两跳（浮点数允许微小误差）
+func hopsEqual(a, b RouteHop) bool {
+	near := func(x, y float64) bool { return x-y < 1e-9 && y-x < 1e-9 }
+	if a.Hop != b.Hop || a.Address != b.Address || !near(a.AvgMs, b.AvgMs) || !near(a.LossPercent, b.LossPercent) || len(a.LatenciesMs) != len(b.LatenciesMs) {
+		return false
+	}
+	for i := range a.LatenciesMs {
+		if !near(a.LatenciesMs[i], b.LatenciesMs[i]) {
+			return false
+		}
+	}
+	a.LatenciesMs, b.LatenciesMs = nil, nil
+	a.AvgMs, b.AvgMs, a.LossPercent, b.LossPercent = 0, 0, 0, 0
+	return reflect.DeepEqual(a, b)
+}
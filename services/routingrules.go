@@ -0,0 +1,380 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 路由规则：不想写外部钩子时，用内置的表达式语言按请求特征选路或拒绝请求。
+// 规则写作 “条件 -> 动作”，例如：
+//
+//	model startsWith "claude" && est_tokens > 50000 -> provider "big-ctx"
+//	client == "cursor" -> exclude "官方", "备用"
+//	hour >= 1 && hour < 7 && !stream -> reject "夜间只允许流式请求"
+//	client == "claude-code" && stream -> budget "3000"
+//
+// 条件使用 expr 语法（&& || ! == != < > startsWith endsWith contains matches in 等），可用变量见 routingRuleEnv；
+// 动作为 provider（只使用列出的 provider，顺序仍按 Level）、exclude（跳过列出的 provider）、reject（拒绝请求）
+// 或 budget（首字节延迟预算，单位毫秒，见 latencybudget.go）。
+// 规则按顺序匹配，第一条命中的规则生效；条件运行出错时跳过该规则。规则还可以设置对冲延迟（hedgeDelayMs，见 hedging.go）。
+
+// 规则动作
+const (
+	RuleActionProvider = "provider"
+	RuleActionExclude  = "exclude"
+	RuleActionReject   = "reject"
+	RuleActionBudget   = "budget"
+)
+
+const (
+	// ruleMaxLength 单条规则最大长度
+	ruleMaxLength = 2000
+	// ruleMaxCount 规则最大条数
+	ruleMaxCount = 100
+	// ruleCacheSize 编译缓存上限（前端编辑规则时会校验大量中间文本），超出后清空
+	ruleCacheSize = 1000
+)
+
+// RelayRulesConfig 路由规则配置
+type RelayRulesConfig struct {
+	Enabled bool          `json:"enabled"`         // 是否按规则选路
+	Rules   []RoutingRule `json:"rules,omitempty"` // 按顺序匹配，第一条命中的规则生效
+}
+
+// RoutingRule 单条路由规则
+type RoutingRule struct {
+	Name         string   `json:"name"`
+	Rule         string   `json:"rule"`                   // 条件 -> 动作
+	Platforms    []string `json:"platforms,omitempty"`    // 生效的平台（claude/codex/gemini），为空表示全部
+	Disabled     bool     `json:"disabled,omitempty"`     // 暂停该规则
+	HedgeDelayMs int      `json:"hedgeDelayMs,omitempty"` // 对冲延迟（毫秒）：超过该时间未响应时同时请求下一个 provider，0 表示不对冲（见 hedging.go）
+}
+
+// routingRuleEnv 规则条件可用的变量
+type routingRuleEnv struct {
+	Model     string `expr:"model" json:"model"`           // 请求的模型名（预算降级之后）
+	Platform  string `expr:"platform" json:"platform"`     // claude / codex / gemini
+	EstTokens int    `expr:"est_tokens" json:"est_tokens"` // 本地估算的提示词 token 数
+	BodyBytes int    `expr:"body_bytes" json:"body_bytes"` // 请求体字节数
+	Stream    bool   `expr:"stream" json:"stream"`         // 是否流式请求
+	Client    string `expr:"client" json:"client"`         // 按 User-Agent 识别的客户端工具（claude-code、cursor 等）
+	Project   string `expr:"project" json:"project"`       // X-CodeSwitch-Project 请求头标记的项目
+	Hour      int    `expr:"hour" json:"hour"`             // 本地时间的小时（0-23）
+}
+
+// compiledRule 编译后的规则
+type compiledRule struct {
+	program *vm.Program
+	action  string
+	args    []string
+}
+
+// routingDecision 命中的规则
+type routingDecision struct {
+	rule       string
+	action     string
+	args       []string
+	hedgeDelay time.Duration // 规则的对冲延迟，0 表示不对冲
+}
+
+// RuleValidation 规则校验结果
+type RuleValidation struct {
+	Valid   bool     `json:"valid"`
+	Error   string   `json:"error,omitempty"`
+	Action  string   `json:"action,omitempty"`
+	Args    []string `json:"args,omitempty"`    // provider/exclude 的 provider 名称，reject 的提示信息，budget 的毫秒数
+	Matched bool     `json:"matched"`           // 示例请求是否命中条件
+	Sample  string   `json:"sample,omitempty"`  // 从示例请求中提取的变量（JSON）
+	EvalErr string   `json:"evalErr,omitempty"` // 对示例请求运行条件时的错误
+}
+
+var (
+	ruleCacheMu sync.Mutex
+	ruleCache   = map[string]*compiledRule{}
+)
+
+// compileRoutingRule 解析并编译规则（结果按规则文本缓存）
+func compileRoutingRule(text string) (*compiledRule, error) {
+	text = strings.TrimSpace(text)
+	ruleCacheMu.Lock()
+	cached, ok := ruleCache[text]
+	ruleCacheMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	if text == "" {
+		return nil, fmt.Errorf("规则不能为空")
+	}
+	if len(text) > ruleMaxLength {
+		return nil, fmt.Errorf("规则不能超过 %d 字节", ruleMaxLength)
+	}
+	idx := findRuleArrow(text)
+	if idx < 0 {
+		return nil, fmt.Errorf("规则缺少 “-> 动作”")
+	}
+	condition := strings.TrimSpace(text[:idx])
+	if condition == "" {
+		return nil, fmt.Errorf("规则缺少条件")
+	}
+	action, args, err := parseRuleAction(strings.TrimSpace(text[idx+2:]))
+	if err != nil {
+		return nil, err
+	}
+	program, err := expr.Compile(condition, expr.Env(routingRuleEnv{}), expr.AsBool())
+	if err != nil {
+		return nil, fmt.Errorf("条件无效: %v", err)
+	}
+
+	rule := &compiledRule{program: program, action: action, args: args}
+	ruleCacheMu.Lock()
+	if len(ruleCache) >= ruleCacheSize {
+		ruleCache = map[string]*compiledRule{}
+	}
+	ruleCache[text] = rule
+	ruleCacheMu.Unlock()
+	return rule, nil
+}
+
+// findRuleArrow 查找条件与动作之间的 “->”（忽略字符串中的）
+func findRuleArrow(text string) int {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote != '`' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'' || ch == '`':
+			quote = ch
+		case ch == '-' && i+1 < len(text) && text[i+1] == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseRuleAction 解析动作：关键字后跟一个或多个用逗号分隔的双引号字符串
+func parseRuleAction(text string) (string, []string, error) {
+	action, rest, _ := strings.Cut(text, " ")
+	switch action {
+	case RuleActionProvider, RuleActionExclude, RuleActionReject, RuleActionBudget:
+	case "":
+		return "", nil, fmt.Errorf("规则缺少动作")
+	default:
+		return "", nil, fmt.Errorf("未知的动作 %q（支持 provider、exclude、reject、budget）", action)
+	}
+
+	var args []string
+	rest = strings.TrimSpace(rest)
+	for rest != "" {
+		if rest[0] != '"' {
+			return "", nil, fmt.Errorf("动作 %s 的参数必须是双引号字符串", action)
+		}
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return "", nil, fmt.Errorf("动作 %s 的参数缺少结束引号", action)
+		}
+		arg, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return "", nil, fmt.Errorf("动作 %s 的参数无效: %v", action, err)
+		}
+		if strings.TrimSpace(arg) == "" {
+			return "", nil, fmt.Errorf("动作 %s 的参数不能为空", action)
+		}
+		args = append(args, arg)
+
+		rest = strings.TrimSpace(rest[end+1:])
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return "", nil, fmt.Errorf("动作 %s 的参数之间需要用逗号分隔", action)
+		}
+		rest = strings.TrimSpace(rest[1:])
+		if rest == "" {
+			return "", nil, fmt.Errorf("动作 %s 的参数列表不能以逗号结尾", action)
+		}
+	}
+
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("动作 %s 缺少参数", action)
+	}
+	if action == RuleActionReject && len(args) > 1 {
+		return "", nil, fmt.Errorf("动作 reject 只接受一条提示信息")
+	}
+	if action == RuleActionBudget {
+		if _, ok := parseLatencyBudget(args[0]); !ok || len(args) > 1 {
+			return "", nil, fmt.Errorf("动作 budget 只接受一个 %d-%d 之间的毫秒数", minLatencyBudgetMs, maxLatencyBudgetMs)
+		}
+	}
+	return action, args, nil
+}
+
+// validateRulesConfig 校验路由规则配置
+func validateRulesConfig(config RelayRulesConfig) error {
+	if len(config.Rules) > ruleMaxCount {
+		return fmt.Errorf("路由规则不能超过 %d 条", ruleMaxCount)
+	}
+	for i, rule := range config.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		for _, platform := range rule.Platforms {
+			if platform != "claude" && platform != "codex" && platform != "gemini" {
+				return fmt.Errorf("路由规则 %s 的平台无效: %s", name, platform)
+			}
+		}
+		if _, err := compileRoutingRule(rule.Rule); err != nil {
+			return fmt.Errorf("路由规则 %s 无效: %v", name, err)
+		}
+		if err := validateHedgeDelay(rule.HedgeDelayMs); err != nil {
+			return fmt.Errorf("路由规则 %s 无效: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// evaluateRoutingRules 按顺序运行规则，返回第一条命中的规则；没有命中时返回 nil
+func evaluateRoutingRules(config RelayRulesConfig, env routingRuleEnv) *routingDecision {
+	if !config.Enabled {
+		return nil
+	}
+	for i, rule := range config.Rules {
+		if rule.Disabled || (len(rule.Platforms) > 0 && !slices.Contains(rule.Platforms, env.Platform)) {
+			continue
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		compiled, err := compileRoutingRule(rule.Rule)
+		if err != nil {
+			fmt.Printf("[RULE] ⚠️  路由规则 %s 无效，已跳过: %v\n", name, err)
+			continue
+		}
+		matched, err := expr.Run(compiled.program, env)
+		if err != nil {
+			fmt.Printf("[RULE] ⚠️  路由规则 %s 运行失败，已跳过: %v\n", name, err)
+			continue
+		}
+		if matched == true {
+			return &routingDecision{
+				rule:       name,
+				action:     compiled.action,
+				args:       compiled.args,
+				hedgeDelay: time.Duration(rule.HedgeDelayMs) * time.Millisecond,
+			}
+		}
+	}
+	return nil
+}
+
+// allows provider 是否可以参与本次转发（没有命中规则时都可以）
+func (d *routingDecision) allows(name string) bool {
+	if d == nil {
+		return true
+	}
+	switch d.action {
+	case RuleActionProvider:
+		return slices.Contains(d.args, name)
+	case RuleActionExclude:
+		return !slices.Contains(d.args, name)
+	}
+	return true
+}
+
+// restricts 是否为限定 provider 的规则
+func (d *routingDecision) restricts() bool {
+	return d != nil && d.action == RuleActionProvider
+}
+
+// newRoutingRuleEnv 从请求中提取规则变量
+func newRoutingRuleEnv(c *gin.Context, kind, model string, body []byte, stream bool) routingRuleEnv {
+	env := routingRuleEnv{
+		Model:     model,
+		Platform:  kind,
+		EstTokens: estimatePromptTokens(body),
+		BodyBytes: len(body),
+		Stream:    stream,
+		Hour:      time.Now().Hour(),
+	}
+	if c != nil && c.Request != nil {
+		env.Client = detectClientTool(c.Request.UserAgent())
+		env.Project = requestProject(c)
+	}
+	return env
+}
+
+// applyRoutingRules 运行路由规则；命中 reject 时写出错误响应并返回 handled=true
+func applyRoutingRules(c *gin.Context, kind, model string, body []byte, stream bool) (decision *routingDecision, handled bool) {
+	config := currentRelayConfig().Rules
+	if !config.Enabled || len(config.Rules) == 0 {
+		return nil, false
+	}
+	decision = evaluateRoutingRules(config, newRoutingRuleEnv(c, kind, model, body, stream))
+	if decision == nil {
+		return nil, false
+	}
+	switch decision.action {
+	case RuleActionReject:
+		fmt.Printf("[RULE] 🚫 请求命中规则 %s，已拒绝: %s\n", decision.rule, decision.args[0])
+		respondRelayError(c, kind, http.StatusForbidden, fmt.Sprintf("请求被路由规则 %s 拒绝: %s", decision.rule, decision.args[0]), nil)
+		return decision, true
+	case RuleActionProvider:
+		fmt.Printf("[RULE] 🧭 请求命中规则 %s，只使用 provider: %s\n", decision.rule, strings.Join(decision.args, ", "))
+	case RuleActionExclude:
+		fmt.Printf("[RULE] 🧭 请求命中规则 %s，跳过 provider: %s\n", decision.rule, strings.Join(decision.args, ", "))
+	case RuleActionBudget:
+		fmt.Printf("[RULE] ⏱️  请求命中规则 %s，首字节延迟预算 %sms\n", decision.rule, decision.args[0])
+	}
+	return decision, false
+}
+
+// ValidateRule 校验规则语法；sampleBody 非空时用示例请求运行条件（供前端编辑规则时调用）
+func (ss *SettingsService) ValidateRule(rule string, platform string, sampleBody string) RuleValidation {
+	compiled, err := compileRoutingRule(rule)
+	if err != nil {
+		return RuleValidation{Error: err.Error()}
+	}
+	result := RuleValidation{Valid: true, Action: compiled.action, Args: compiled.args}
+	if strings.TrimSpace(sampleBody) == "" {
+		return result
+	}
+	if platform == "" {
+		platform = "claude"
+	}
+	body := []byte(sampleBody)
+	env := newRoutingRuleEnv(nil, platform, gjson.GetBytes(body, "model").String(), body, gjson.GetBytes(body, "stream").Bool())
+	if data, err := json.Marshal(env); err == nil {
+		result.Sample = string(data)
+	}
+	matched, err := expr.Run(compiled.program, env)
+	if err != nil {
+		result.EvalErr = err.Error()
+		return result
+	}
+	result.Matched = matched == true
+	return result
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRoutingRuleFixtures(t *testing.T) {
+	data, err := os.ReadFile("testdata/routing-rules.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixtures []struct {
+		Name    string         `json:"name"`
+		Rule    string         `json:"rule"`
+		Env     routingRuleEnv `json:"env"`
+		Matched bool           `json:"matched"`
+		Action  string         `json:"action"`
+		Args    []string       `json:"args"`
+		Error   string         `json:"error"`
+	}
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.Name, func(t *testing.T) {
+			compiled, err := compileRoutingRule(fixture.Rule)
+			if fixture.Error != "" {
+				if err == nil || !strings.Contains(err.Error(), fixture.Error) {
+					t.Fatalf("期望错误包含 %q，得到 %v", fixture.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("规则应有效: %v", err)
+			}
+
+			config := RelayRulesConfig{Enabled: true, Rules: []RoutingRule{{Name: fixture.Name, Rule: fixture.Rule}}}
+			decision := evaluateRoutingRules(config, fixture.Env)
+			if (decision != nil) != fixture.Matched {
+				t.Fatalf("期望命中 %v，得到 %+v", fixture.Matched, decision)
+			}
+			if fixture.Matched && (compiled.action != fixture.Action || !slices.Equal(decision.args, fixture.Args)) {
+				t.Errorf("期望动作 %s %q，得到 %s %q", fixture.Action, fixture.Args, decision.action, decision.args)
+			}
+		})
+	}
+}
+
+func TestEvaluateRoutingRulesOrder(t *testing.T) {
+	config := RelayRulesConfig{Enabled: true, Rules: []RoutingRule{
+		{Name: "disabled", Rule: `true -> reject "x"`, Disabled: true},
+		{Name: "gemini-only", Rule: `true -> provider "g"`, Platforms: []string{"gemini"}},
+		{Name: "first", Rule: `est_tokens > 10 -> exclude "a"`},
+		{Name: "second", Rule: `true -> provider "b"`},
+	}}
+	decision := evaluateRoutingRules(config, routingRuleEnv{Platform: "claude", EstTokens: 20})
+	if decision == nil || decision.rule != "first" {
+		t.Fatalf("应命中第一条生效的规则，得到 %+v", decision)
+	}
+	if decision.allows("a") || !decision.allows("b") || decision.restricts() {
+		t.Errorf("exclude 规则应只排除列出的 provider")
+	}
+
+	decision = evaluateRoutingRules(config, routingRuleEnv{Platform: "claude"})
+	if decision == nil || decision.rule != "second" || decision.allows("a") || !decision.allows("b") {
+		t.Errorf("provider 规则应只允许列出的 provider，得到 %+v", decision)
+	}
+
+	config.Enabled = false
+	if decision := evaluateRoutingRules(config, routingRuleEnv{Platform: "claude"}); decision != nil || !decision.allows("a") {
+		t.Error("未启用时不应命中规则")
+	}
+}
+
+func TestValidateRulesConfig(t *testing.T) {
+	if err := validateRulesConfig(RelayRulesConfig{Rules: []RoutingRule{{Name: "ok", Rule: `stream -> provider "a"`}}}); err != nil {
+		t.Errorf("有效规则不应报错: %v", err)
+	}
+	if err := validateRulesConfig(RelayRulesConfig{Rules: []RoutingRule{{Name: "bad", Rule: `stream -> provider "a"`, Platforms: []string{"x"}}}}); err == nil {
+		t.Error("无效平台应报错")
+	}
+	if err := validateRulesConfig(RelayRulesConfig{Rules: []RoutingRule{{Name: "bad", Rule: `nope -> provider "a"`}}}); err == nil {
+		t.Error("无效条件应报错")
+	}
+}
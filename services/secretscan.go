@@ -0,0 +1,230 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// secretScanMaxFileSize 扫描配置目录时跳过的大文件（数据库、日志等）
+const secretScanMaxFileSize = 1 << 20
+
+// 密钥扫描发现的问题类型
+const (
+	SecretFindingMisplacedKey = "misplaced_key" // API Key 填到了其他字段（如地址）
+	SecretFindingKeyAsURL     = "key_as_url"    // API Key 字段填写的是地址，疑似与地址字段填反
+	SecretFindingExposedFile  = "exposed_file"  // 含密钥的文件可被其他用户读取
+)
+
+// secretKeyPattern 常见 API Key 格式（Anthropic / OpenAI / Google / Groq / xAI / OpenRouter 等）
+var secretKeyPattern = regexp.MustCompile(`sk-[A-Za-z0-9_\-]{20,}|AIza[0-9A-Za-z_\-]{35}|gsk_[A-Za-z0-9]{20,}|xai-[A-Za-z0-9]{20,}`)
+
+// secretQueryParams 地址中常用于携带密钥的查询参数
+var secretQueryParams = []string{"key", "api_key", "apikey", "access_token", "token"}
+
+// SecretFinding 密钥扫描发现的问题
+type SecretFinding struct {
+	Kind     string `json:"kind"`
+	File     string `json:"file"`
+	Platform string `json:"platform,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+	Fixed    bool   `json:"fixed"` // 已自动修复（如收紧文件权限）
+}
+
+// redactSecret 只保留密钥前几位，用于提示
+func redactSecret(secret string) string {
+	if len(secret) <= 8 {
+		return "***"
+	}
+	return secret[:6] + "***"
+}
+
+// findSecretInURL 地址中是否携带了密钥（路径或查询参数中的 Key 格式字符串、userinfo 中的密码）
+func findSecretInURL(rawURL string) string {
+	if match := secretKeyPattern.FindString(rawURL); match != "" {
+		return match
+	}
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	if password, ok := parsed.User.Password(); ok && password != "" {
+		return password
+	}
+	query := parsed.Query()
+	for _, name := range secretQueryParams {
+		if value := query.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// secretField 待检查的 provider 字段（JSON 字段名与取值）
+type secretField struct {
+	name  string
+	value string
+}
+
+// scanProviderFields 检查单个 provider 的字段：密钥是否填错位置
+func scanProviderFields(file, platform, name, apiKey string, urlFields, textFields []secretField) []SecretFinding {
+	var findings []SecretFinding
+	for _, field := range urlFields {
+		if secret := findSecretInURL(field.value); secret != "" {
+			findings = append(findings, SecretFinding{
+				Kind: SecretFindingMisplacedKey, File: file, Platform: platform, Provider: name, Field: field.name,
+				Message: fmt.Sprintf("地址中包含疑似密钥（%s），请移到 API Key 字段", redactSecret(secret)),
+			})
+		}
+	}
+	for _, field := range textFields {
+		if secret := secretKeyPattern.FindString(field.value); secret != "" {
+			findings = append(findings, SecretFinding{
+				Kind: SecretFindingMisplacedKey, File: file, Platform: platform, Provider: name, Field: field.name,
+				Message: fmt.Sprintf("字段中包含疑似密钥（%s），请移到 API Key 字段", redactSecret(secret)),
+			})
+		}
+	}
+	key := strings.ToLower(strings.TrimSpace(apiKey))
+	if strings.HasPrefix(key, "http://") || strings.HasPrefix(key, "https://") {
+		findings = append(findings, SecretFinding{
+			Kind: SecretFindingKeyAsURL, File: file, Platform: platform, Provider: name, Field: "apiKey",
+			Message: "API Key 字段填写的是地址，可能与地址字段填反",
+		})
+	}
+	return findings
+}
+
+// scanProviderSecrets 检查 claude / codex / gemini 的 provider 配置
+func scanProviderSecrets() []SecretFinding {
+	var findings []SecretFinding
+	for _, kind := range []string{"claude", "codex"} {
+		path, err := providerFilePath(kind)
+		if err != nil {
+			continue
+		}
+		providers, err := loadProvidersFile(kind)
+		if err != nil {
+			continue
+		}
+		for _, p := range providers {
+			findings = append(findings, scanProviderFields(path, kind, p.Name, p.APIKey,
+				[]secretField{{"apiUrl", p.APIURL}, {"officialSite", p.Site}},
+				[]secretField{{"name", p.Name}, {"icon", p.Icon}})...)
+		}
+	}
+
+	path := getGeminiProvidersPath()
+	if data, err := os.ReadFile(path); err == nil {
+		var providers []GeminiProvider
+		if json.Unmarshal(data, &providers) == nil {
+			for _, p := range providers {
+				findings = append(findings, scanProviderFields(path, "gemini", p.Name, p.APIKey,
+					[]secretField{{"baseUrl", p.BaseURL}, {"websiteUrl", p.WebsiteURL}, {"apiKeyUrl", p.APIKeyURL}},
+					[]secretField{{"name", p.Name}, {"description", p.Description}, {"model", p.Model}})...)
+			}
+		}
+	}
+	return findings
+}
+
+// secretFileCandidates 可能含有密钥的文件：配置目录下的文件与 Gemini 的 .env
+func secretFileCandidates() []string {
+	var files []string
+	entries, err := os.ReadDir(getConfigDir())
+	if err == nil {
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				files = append(files, filepath.Join(getConfigDir(), entry.Name()))
+			}
+		}
+	}
+	return append(files, getGeminiEnvPath())
+}
+
+// scanSecretFilePermissions 含密钥的文件若可被其他用户读取，收紧为 0600（Windows 不适用）
+func scanSecretFilePermissions() []SecretFinding {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	var findings []SecretFinding
+	for _, path := range secretFileCandidates() {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > secretScanMaxFileSize {
+			continue
+		}
+		if info.Mode().Perm()&0o077 == 0 {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || !containsSecret(path, data) {
+			continue
+		}
+		finding := SecretFinding{Kind: SecretFindingExposedFile, File: path}
+		if err := os.Chmod(path, 0o600); err != nil {
+			finding.Message = fmt.Sprintf("文件包含密钥且权限为 %04o，其他用户可读取；自动修改权限失败: %v", info.Mode().Perm(), err)
+		} else {
+			finding.Fixed = true
+			finding.Message = fmt.Sprintf("文件包含密钥且权限为 %04o，已修改为 0600", info.Mode().Perm())
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// containsSecret 文件中是否有密钥：符合常见 Key 格式，或 provider 配置中存在非空 apiKey
+func containsSecret(path string, data []byte) bool {
+	if secretKeyPattern.Match(data) {
+		return true
+	}
+	if filepath.Ext(path) != ".json" {
+		return false
+	}
+	var probe struct {
+		Providers []struct {
+			APIKey string `json:"apiKey"`
+		} `json:"providers"`
+	}
+	if json.Unmarshal(data, &probe) == nil {
+		for _, p := range probe.Providers {
+			if p.APIKey != "" {
+				return true
+			}
+		}
+	}
+	var list []struct {
+		APIKey string `json:"apiKey"`
+	}
+	if json.Unmarshal(data, &list) == nil {
+		for _, p := range list {
+			if p.APIKey != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scanSecrets 扫描 provider 配置中填错位置的密钥，并收紧含密钥文件的权限
+func scanSecrets() []SecretFinding {
+	findings := append(scanProviderSecrets(), scanSecretFilePermissions()...)
+	for _, finding := range findings {
+		target := finding.File
+		if finding.Provider != "" {
+			target = fmt.Sprintf("%s/%s.%s", finding.Platform, finding.Provider, finding.Field)
+		}
+		log.Printf("🔑 密钥扫描 [%s] %s: %s", finding.Kind, target, finding.Message)
+		if finding.Fixed {
+			recordAudit("secrets", "chmod", fmt.Sprintf("%s: %s", finding.File, finding.Message))
+		}
+	}
+	return findings
+}
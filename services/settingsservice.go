@@ -26,6 +26,10 @@ type BlacklistLevelConfig struct {
 	FailureThreshold    int `json:"failureThreshold"`    // 失败阈值（连续失败次数）
 	DedupeWindowSeconds int `json:"dedupeWindowSeconds"` // 去重窗口（秒）
 
+	// 触发条件（基于请求日志，任一满足即拉黑；配置后替代连续失败计数）
+	// 如 "failures >= 3 within 5m"、"error_rate > 50% over 20"
+	Triggers []string `json:"triggers,omitempty"`
+
 	// 降级配置
 	NormalDegradeIntervalHours float64 `json:"normalDegradeIntervalHours"` // 正常降级间隔（小时）
 	ForgivenessHours           float64 `json:"forgivenessHours"`           // 宽恕触发时间（小时）
@@ -62,12 +66,8 @@ func DefaultBlacklistLevelConfig() *BlacklistLevelConfig {
 	}
 }
 
+// 表结构由 InitDatabase 创建（窗口显示后才初始化数据库，构造时不访问数据库）
 func NewSettingsService() *SettingsService {
-	// 确保数据库表存在
-	if err := ensureBlacklistTables(); err != nil {
-		// 记录错误但不阻止服务创建
-		fmt.Printf("[SettingsService] 初始化数据库表失败: %v\n", err)
-	}
 	return &SettingsService{}
 }
 
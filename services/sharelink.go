@@ -0,0 +1,218 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 分享链接格式：ccswitch://v1/share?d=<base64url(版本 | salt | nonce | 密文)>
+// 密钥由口令经 PBKDF2-SHA256 派生，内容使用 AES-256-GCM 加密，链接本身不含明文配置，可直接生成二维码
+const (
+	shareLinkPrefix     = "ccswitch://v1/share?d="
+	shareLinkVersion    = 1
+	shareLinkIterations = 600_000
+	shareLinkSaltSize   = 16
+	shareLinkMinPass    = 8
+)
+
+// errShareLinkDecrypt 口令错误或链接被篡改（GCM 校验失败时无法区分两者）
+var errShareLinkDecrypt = errors.New("口令错误或分享链接已损坏")
+
+// SharedProvider 分享链接中的 provider 配置
+type SharedProvider struct {
+	App       string   `json:"app"` // claude / codex
+	Provider  Provider `json:"provider"`
+	HasKey    bool     `json:"hasKey"` // 是否包含 API Key
+	CreatedAt int64    `json:"createdAt"`
+}
+
+// shareLinkKey 由口令与 salt 派生 AES-256 密钥
+func shareLinkKey(passphrase string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, passphrase, salt, shareLinkIterations, 32)
+}
+
+// encryptShareLink 加密分享内容并编码为链接
+func encryptShareLink(shared SharedProvider, passphrase string) (string, error) {
+	if len([]rune(passphrase)) < shareLinkMinPass {
+		return "", fmt.Errorf("口令至少需要 %d 个字符", shareLinkMinPass)
+	}
+	plaintext, err := json.Marshal(shared)
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, shareLinkSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := shareLinkKey(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	// 版本号与 salt 作为附加数据参与校验
+	header := append([]byte{shareLinkVersion}, salt...)
+	payload := append(append(header, nonce...), gcm.Seal(nil, nonce, plaintext, header)...)
+	return shareLinkPrefix + base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+// decryptShareLink 解析并解密分享链接（也接受不带前缀的编码串）
+func decryptShareLink(link string, passphrase string) (*SharedProvider, error) {
+	encoded := strings.TrimSpace(link)
+	if strings.HasPrefix(encoded, "ccswitch://") {
+		parsed, err := url.Parse(encoded)
+		if err != nil || parsed.Host != "v1" || parsed.Path != "/share" {
+			return nil, fmt.Errorf("无效的分享链接")
+		}
+		encoded = parsed.Query().Get("d")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("无效的分享链接: %w", err)
+	}
+	if len(payload) < 1+shareLinkSaltSize {
+		return nil, fmt.Errorf("无效的分享链接: 数据不完整")
+	}
+	if payload[0] != shareLinkVersion {
+		return nil, fmt.Errorf("不支持的分享链接版本: %d", payload[0])
+	}
+	header, rest := payload[:1+shareLinkSaltSize], payload[1+shareLinkSaltSize:]
+	key, err := shareLinkKey(passphrase, header[1:])
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("无效的分享链接: 数据不完整")
+	}
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, errShareLinkDecrypt
+	}
+	var shared SharedProvider
+	if err := json.Unmarshal(plaintext, &shared); err != nil {
+		return nil, fmt.Errorf("解析分享内容失败: %w", err)
+	}
+	if shared.App != "claude" && shared.App != "codex" {
+		return nil, fmt.Errorf("不支持的 app 类型: %s", shared.App)
+	}
+	return &shared, nil
+}
+
+// CreateShareLink 生成加密的 provider 分享链接（供前端调用，可直接生成二维码）
+// includeKey 为 false 时不包含 API Key，接收方导入后自行填写
+func (s *DeepLinkService) CreateShareLink(kind string, name string, passphrase string, includeKey bool) (string, error) {
+	if kind != "claude" && kind != "codex" {
+		return "", fmt.Errorf("不支持的 app 类型: %s", kind)
+	}
+	if includeKey && currentPolicy().DisableKeyExport {
+		return "", fmt.Errorf("管理员策略已禁止导出 API Key，请生成不含 Key 的分享链接")
+	}
+	providers, err := s.providerService.LoadProviders(kind)
+	if err != nil {
+		return "", fmt.Errorf("加载供应商列表失败: %w", err)
+	}
+	var provider *Provider
+	for i := range providers {
+		if providers[i].Name == name {
+			provider = &providers[i]
+			break
+		}
+	}
+	if provider == nil {
+		return "", fmt.Errorf("未找到名为 '%s' 的供应商", name)
+	}
+
+	shared := SharedProvider{App: kind, Provider: *provider, HasKey: includeKey && provider.APIKey != "", CreatedAt: time.Now().UnixMilli()}
+	// 只分享配置本身，不带本机状态
+	shared.Provider.ID = 0
+	shared.Provider.AuthDisabledKey = ""
+	if !includeKey {
+		shared.Provider.APIKey = ""
+	}
+	link, err := encryptShareLink(shared, passphrase)
+	if err != nil {
+		return "", err
+	}
+	recordAudit("provider", "share_link", fmt.Sprintf("生成 %s/%s 的分享链接（包含 Key: %v）", kind, name, shared.HasKey))
+	return link, nil
+}
+
+// PreviewShareLink 解密分享链接并预览内容，API Key 只显示脱敏值（供前端调用）
+func (s *DeepLinkService) PreviewShareLink(link string, passphrase string) (*SharedProvider, error) {
+	shared, err := decryptShareLink(link, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	shared.Provider.APIKey = maskAPIKey(shared.Provider.APIKey)
+	return shared, nil
+}
+
+// ImportShareLink 导入分享链接中的 provider，返回新 provider 的 ID（供前端调用）
+// 导入后默认禁用；名称已存在时自动追加序号
+func (s *DeepLinkService) ImportShareLink(link string, passphrase string) (string, error) {
+	shared, err := decryptShareLink(link, passphrase)
+	if err != nil {
+		return "", err
+	}
+	providers, err := s.providerService.LoadProviders(shared.App)
+	if err != nil {
+		return "", fmt.Errorf("加载供应商列表失败: %w", err)
+	}
+
+	provider := shared.Provider
+	provider.ID = time.Now().UnixNano()
+	provider.Enabled = false
+	provider.Name = uniqueProviderName(providers, provider.Name)
+	providers = append(providers, provider)
+	if err := s.providerService.SaveProviders(shared.App, providers); err != nil {
+		return "", fmt.Errorf("保存供应商失败: %w", err)
+	}
+	recordAudit("provider", "import_share_link", fmt.Sprintf("从分享链接导入 %s/%s（包含 Key: %v）", shared.App, provider.Name, shared.HasKey))
+	return strconv.FormatInt(provider.ID, 10), nil
+}
+
+// uniqueProviderName 名称已被占用时追加序号
+func uniqueProviderName(providers []Provider, name string) string {
+	taken := make(map[string]bool, len(providers))
+	for _, p := range providers {
+		taken[p.Name] = true
+	}
+	if !taken[name] {
+		return name
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
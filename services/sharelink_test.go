@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestShareLinkRoundTrip(t *testing.T) {
+	shared := SharedProvider{
+		App:      "claude",
+		Provider: Provider{Name: "team", APIURL: "https://api.example.com", APIKey: "sk-team-key", ModelMapping: map[string]string{"claude-*": "x/claude-*"}},
+		HasKey:   true,
+	}
+	link, err := encryptShareLink(shared, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link, shareLinkPrefix) || strings.Contains(link, "sk-team-key") {
+		t.Fatalf("unexpected link: %s", link)
+	}
+
+	got, err := decryptShareLink(link, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Provider.APIKey != "sk-team-key" || got.Provider.ModelMapping["claude-*"] != "x/claude-*" {
+		t.Errorf("decrypted provider = %+v", got.Provider)
+	}
+
+	if _, err := decryptShareLink(link, "wrong passphrase"); !errors.Is(err, errShareLinkDecrypt) {
+		t.Errorf("wrong passphrase error = %v", err)
+	}
+	if _, err := encryptShareLink(shared, "short"); err == nil {
+		t.Error("short passphrase should be rejected")
+	}
+}
+
+func TestUniqueProviderName(t *testing.T) {
+	providers := []Provider{{Name: "a"}, {Name: "a (2)"}}
+	if got := uniqueProviderName(providers, "a"); got != "a (3)" {
+		t.Errorf("uniqueProviderName = %q", got)
+	}
+	if got := uniqueProviderName(providers, "b"); got != "b" {
+		t.Errorf("uniqueProviderName = %q", got)
+	}
+}
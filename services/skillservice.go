@@ -20,7 +20,6 @@ import (
 )
 
 const (
-	skillStoreDir  = ".code-switch"
 	skillStoreFile = "skill.json"
 )
 
@@ -87,7 +86,7 @@ func NewSkillService() *SkillService {
 	}
 	return &SkillService{
 		httpClient: &http.Client{Timeout: 60 * time.Second},
-		storePath:  filepath.Join(home, skillStoreDir, skillStoreFile),
+		storePath:  filepath.Join(getConfigDir(), skillStoreFile),
 		installDir: filepath.Join(home, ".claude", "skills"),
 	}
 }
@@ -415,7 +414,11 @@ func (ss *SkillService) saveStoreLocked(store skillStore) error {
 	if err := os.WriteFile(tmp, data, 0o644); err != nil {
 		return err
 	}
-	return os.Rename(tmp, ss.storePath)
+	if err := os.Rename(tmp, ss.storePath); err != nil {
+		return err
+	}
+	recordConfigIntegrity(ss.storePath)
+	return nil
 }
 
 func (ss *SkillService) prepareRepoSnapshot(repo skillRepoConfig) (string, string, func(), error) {
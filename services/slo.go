@@ -0,0 +1,516 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 响应延迟 SLO：如 "claude 的 p95 首 token 时间 < 2 秒"。
+// 允许超时的请求比例即错误预算（p95 为 5%），消耗速率 = 超出阈值的请求比例 / 错误预算，
+// 大于 1 表示违约；短窗口与长窗口的消耗速率同时达到告警值时，说明 provider 持续违约而非偶发抖动。
+
+// SLO 指标
+const (
+	SLOMetricTTFT     = "ttft"     // 首 token 时间（收到上游响应头的耗时）
+	SLOMetricDuration = "duration" // 请求总耗时
+)
+
+const (
+	sloCheckInterval = 5 * time.Minute
+	sloShortWindow   = time.Hour
+	sloLongWindow    = 6 * time.Hour
+	// sloBreachRetention 违约记录保留时间
+	sloBreachRetention = 90 * 24 * time.Hour
+)
+
+// SLOObjective SLO 定义
+type SLOObjective struct {
+	Name        string  `json:"name"`        // 名称，同时作为标识
+	Platform    string  `json:"platform"`    // claude / codex / gemini
+	Metric      string  `json:"metric"`      // ttft / duration
+	Percentile  float64 `json:"percentile"`  // 百分位（50-99.9），如 95
+	ThresholdMs int     `json:"thresholdMs"` // 阈值（毫秒）
+}
+
+// SLOWindowStat 单个窗口内的统计
+type SLOWindowStat struct {
+	Samples    int     `json:"samples"`
+	Violations int     `json:"violations"` // 超出阈值的请求数
+	ObservedMs float64 `json:"observedMs"` // 窗口内的实际百分位延迟
+	BurnRate   float64 `json:"burnRate"`   // 错误预算消耗速率，样本不足时为 0
+}
+
+// SLOStatus 某个 provider 在某个 SLO 下的状态
+type SLOStatus struct {
+	Objective SLOObjective  `json:"objective"`
+	Provider  string        `json:"provider"`
+	Short     SLOWindowStat `json:"short"` // 最近 1 小时
+	Long      SLOWindowStat `json:"long"`  // 最近 6 小时
+	Breaching bool          `json:"breaching"`
+	Alerting  bool          `json:"alerting"` // 持续违约（两个窗口的消耗速率均达到告警值）
+}
+
+// SLOBreach 违约区间
+type SLOBreach struct {
+	ID           int64   `json:"id"`
+	Objective    string  `json:"objective"`
+	Platform     string  `json:"platform"`
+	Provider     string  `json:"provider"`
+	Metric       string  `json:"metric"`
+	ThresholdMs  int     `json:"thresholdMs"`
+	StartedAt    int64   `json:"startedAt"` // 秒
+	EndedAt      int64   `json:"endedAt"`   // 秒，0 表示尚未恢复
+	PeakBurnRate float64 `json:"peakBurnRate"`
+	Alerted      bool    `json:"alerted"`
+}
+
+// sloSample 一次成功请求的延迟样本
+type sloSample struct {
+	provider   string
+	ttftMs     float64
+	durationMs float64
+	at         time.Time
+}
+
+// validateSLOConfig 校验 SLO 配置
+func validateSLOConfig(config RelaySLOConfig) error {
+	if config.BurnRateAlert < 1 || config.BurnRateAlert > 100 {
+		return fmt.Errorf("SLO 告警消耗速率必须在 1-100 之间")
+	}
+	if config.MinSamples < 1 {
+		return fmt.Errorf("SLO 最少样本数必须大于 0")
+	}
+	names := make(map[string]bool, len(config.Objectives))
+	for _, objective := range config.Objectives {
+		name := strings.TrimSpace(objective.Name)
+		if name == "" {
+			return fmt.Errorf("SLO 名称不能为空")
+		}
+		if names[name] {
+			return fmt.Errorf("SLO 名称重复: %s", name)
+		}
+		names[name] = true
+		if !isCommandPlatform(objective.Platform) {
+			return fmt.Errorf("SLO %s 的平台无效: %s（可选值: claude、codex、gemini）", name, objective.Platform)
+		}
+		if objective.Metric != SLOMetricTTFT && objective.Metric != SLOMetricDuration {
+			return fmt.Errorf("SLO %s 的指标无效: %s（可选值: ttft、duration）", name, objective.Metric)
+		}
+		if objective.Percentile < 50 || objective.Percentile > 99.9 {
+			return fmt.Errorf("SLO %s 的百分位必须在 50-99.9 之间", name)
+		}
+		if objective.ThresholdMs <= 0 {
+			return fmt.Errorf("SLO %s 的阈值必须大于 0", name)
+		}
+	}
+	if webhook := config.WebhookURL; webhook != "" {
+		if parsed, err := url.Parse(webhook); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("无效的 SLO 告警 webhook 地址: %s", webhook)
+		}
+	}
+	return nil
+}
+
+// ensureSLOBreachTable 确保 slo_breach 表存在
+func ensureSLOBreachTable() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS slo_breach (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		objective TEXT NOT NULL,
+		platform TEXT,
+		provider TEXT NOT NULL,
+		metric TEXT,
+		threshold_ms INTEGER DEFAULT 0,
+		started_at BIGINT,
+		ended_at BIGINT DEFAULT 0,
+		peak_burn_rate REAL DEFAULT 0,
+		alerted INTEGER DEFAULT 0
+	)`
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("创建 slo_breach 表失败: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_slo_breach_started ON slo_breach(started_at)`); err != nil {
+		return fmt.Errorf("创建 slo_breach 索引失败: %w", err)
+	}
+	return nil
+}
+
+// SLOService 定期评估 SLO，记录违约区间并在持续违约时告警
+type SLOService struct {
+	notificationService *NotificationService
+	mu                  sync.Mutex
+	open                map[string]*SLOBreach // 尚未恢复的违约区间（键为 SLO 名称|provider）
+	loaded              bool
+}
+
+// NewSLOService 创建 SLO 服务
+func NewSLOService(notificationService *NotificationService) *SLOService {
+	return &SLOService{
+		notificationService: notificationService,
+		open:                make(map[string]*SLOBreach),
+	}
+}
+
+// Start 注册后台定时评估任务（未启用 SLO 时不评估）
+func (ss *SLOService) Start() error {
+	scheduleJob(backgroundJob{
+		name:  "slo",
+		title: "SLO 评估",
+		delay: sloCheckInterval,
+		interval: func() time.Duration {
+			if !currentRelayConfig().SLO.Enabled {
+				return 0
+			}
+			return sloCheckInterval
+		},
+		run: func() error {
+			if _, err := ss.CheckSLOs(); err != nil {
+				return fmt.Errorf("评估 SLO 失败: %w", err)
+			}
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止后台评估
+func (ss *SLOService) Stop() error {
+	unscheduleJob("slo")
+	return nil
+}
+
+// GetSLOStatus 获取各 SLO 下每个 provider 的当前状态（供前端调用，不记录违约）
+func (ss *SLOService) GetSLOStatus() ([]SLOStatus, error) {
+	config := currentRelayConfig().SLO
+	return computeSLOStatus(config, time.Now())
+}
+
+// GetSLOBreaches 获取最近的违约区间（最新在前）
+func (ss *SLOService) GetSLOBreaches(limit int) ([]SLOBreach, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	records, err := xdb.New("slo_breach").Selects(
+		xdb.OrderByDesc("started_at"),
+		xdb.Limit(limit),
+	)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return []SLOBreach{}, nil
+		}
+		return nil, err
+	}
+	breaches := make([]SLOBreach, 0, len(records))
+	for _, record := range records {
+		breaches = append(breaches, sloBreachFromRecord(record))
+	}
+	return breaches, nil
+}
+
+// CheckSLOs 评估 SLO：开始/结束违约区间，对新出现的持续违约发送告警
+func (ss *SLOService) CheckSLOs() ([]SLOStatus, error) {
+	config := currentRelayConfig().SLO
+	now := time.Now()
+	statuses, err := computeSLOStatus(config, now)
+	if err != nil {
+		return nil, err
+	}
+
+	ss.mu.Lock()
+	if !ss.loaded {
+		ss.loadOpenBreaches()
+		ss.loaded = true
+	}
+	seen := make(map[string]bool, len(statuses))
+	var alerts []SLOStatus
+	for _, status := range statuses {
+		key := status.Objective.Name + "|" + status.Provider
+		seen[key] = true
+		breach := ss.open[key]
+		switch {
+		case status.Breaching && breach == nil:
+			breach = &SLOBreach{
+				Objective:    status.Objective.Name,
+				Platform:     status.Objective.Platform,
+				Provider:     status.Provider,
+				Metric:       status.Objective.Metric,
+				ThresholdMs:  status.Objective.ThresholdMs,
+				StartedAt:    now.Unix(),
+				PeakBurnRate: status.Short.BurnRate,
+			}
+			ss.open[key] = breach
+			insertSLOBreach(breach)
+			log.Printf("[SLO] ⚠️  %s 违反 SLO %s: p%g %.0fms > %dms", status.Provider, status.Objective.Name,
+				status.Objective.Percentile, status.Short.ObservedMs, status.Objective.ThresholdMs)
+		case status.Breaching:
+			breach.PeakBurnRate = math.Max(breach.PeakBurnRate, status.Short.BurnRate)
+		case breach != nil:
+			ss.closeBreachLocked(key, breach, now)
+			continue
+		default:
+			continue
+		}
+		if status.Alerting && !breach.Alerted {
+			breach.Alerted = true
+			alerts = append(alerts, status)
+		}
+		updateSLOBreach(breach)
+	}
+	// SLO 被删除或 provider 不再有请求：结束违约区间
+	for key, breach := range ss.open {
+		if !seen[key] {
+			ss.closeBreachLocked(key, breach, now)
+		}
+	}
+	ss.mu.Unlock()
+
+	pruneSLOBreaches(now.Add(-sloBreachRetention))
+	for _, status := range alerts {
+		log.Printf("[SLO] 🔥 %s 持续违反 SLO %s：1 小时消耗速率 %.1fx，6 小时 %.1fx",
+			status.Provider, status.Objective.Name, status.Short.BurnRate, status.Long.BurnRate)
+		if ss.notificationService != nil {
+			ss.notificationService.NotifySLOBreach(status)
+		}
+		if config.WebhookURL != "" {
+			go sendSLOWebhook(config.WebhookURL, status)
+		}
+	}
+	return statuses, nil
+}
+
+func (ss *SLOService) closeBreachLocked(key string, breach *SLOBreach, now time.Time) {
+	breach.EndedAt = now.Unix()
+	updateSLOBreach(breach)
+	delete(ss.open, key)
+	log.Printf("[SLO] ✅ %s 已恢复满足 SLO %s", breach.Provider, breach.Objective)
+}
+
+// loadOpenBreaches 读取重启前尚未结束的违约区间
+func (ss *SLOService) loadOpenBreaches() {
+	records, err := xdb.New("slo_breach").Selects(xdb.WhereEq("ended_at", 0))
+	if err != nil {
+		return
+	}
+	for _, record := range records {
+		breach := sloBreachFromRecord(record)
+		ss.open[breach.Objective+"|"+breach.Provider] = &breach
+	}
+}
+
+// computeSLOStatus 读取最近 6 小时的成功请求，计算每个 SLO 下各 provider 的状态
+func computeSLOStatus(config RelaySLOConfig, now time.Time) ([]SLOStatus, error) {
+	statuses := []SLOStatus{}
+	if len(config.Objectives) == 0 {
+		return statuses, nil
+	}
+	samplesByPlatform := make(map[string][]sloSample)
+	for _, objective := range config.Objectives {
+		if _, ok := samplesByPlatform[objective.Platform]; ok {
+			continue
+		}
+		samples, err := loadSLOSamples(objective.Platform, now.Add(-sloLongWindow))
+		if err != nil {
+			return nil, err
+		}
+		samplesByPlatform[objective.Platform] = samples
+	}
+
+	for _, objective := range config.Objectives {
+		byProvider := make(map[string][]sloSample)
+		for _, sample := range samplesByPlatform[objective.Platform] {
+			byProvider[sample.provider] = append(byProvider[sample.provider], sample)
+		}
+		for provider, samples := range byProvider {
+			statuses = append(statuses, evaluateSLO(objective, provider, samples, config, now))
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Objective.Name != statuses[j].Objective.Name {
+			return statuses[i].Objective.Name < statuses[j].Objective.Name
+		}
+		return statuses[i].Provider < statuses[j].Provider
+	})
+	return statuses, nil
+}
+
+// evaluateSLO 计算单个 provider 在短、长窗口内的消耗速率
+func evaluateSLO(objective SLOObjective, provider string, samples []sloSample, config RelaySLOConfig, now time.Time) SLOStatus {
+	status := SLOStatus{Objective: objective, Provider: provider}
+	budget := 1 - objective.Percentile/100
+	threshold := float64(objective.ThresholdMs)
+	shortStart := now.Add(-sloShortWindow)
+
+	var shortValues, longValues []float64
+	for _, sample := range samples {
+		value := sample.durationMs
+		if objective.Metric == SLOMetricTTFT {
+			value = sample.ttftMs
+		}
+		if value <= 0 {
+			// 旧记录没有首字节时间
+			continue
+		}
+		longValues = append(longValues, value)
+		if !sample.at.Before(shortStart) {
+			shortValues = append(shortValues, value)
+		}
+	}
+	status.Short = sloWindowStat(shortValues, threshold, objective.Percentile, budget, config.MinSamples)
+	status.Long = sloWindowStat(longValues, threshold, objective.Percentile, budget, config.MinSamples)
+	status.Breaching = status.Short.BurnRate > 1
+	status.Alerting = status.Breaching && status.Short.BurnRate >= config.BurnRateAlert && status.Long.BurnRate >= config.BurnRateAlert
+	return status
+}
+
+func sloWindowStat(values []float64, threshold, percentile, budget float64, minSamples int) SLOWindowStat {
+	stat := SLOWindowStat{Samples: len(values)}
+	for _, value := range values {
+		if value > threshold {
+			stat.Violations++
+		}
+	}
+	stat.ObservedMs = percentileOf(values, percentile)
+	if stat.Samples >= minSamples && budget > 0 {
+		stat.BurnRate = float64(stat.Violations) / float64(stat.Samples) / budget
+	}
+	return stat
+}
+
+// percentileOf 按最近秩计算百分位，空切片返回 0
+func percentileOf(values []float64, percentile float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// loadSLOSamples 读取平台在 since 之后的成功请求
+func loadSLOSamples(platform string, since time.Time) ([]sloSample, error) {
+	records, err := sharedModel("request_log").Selects(
+		xdb.WhereGte("created_at", since.Unix()),
+		xdb.WhereEq("platform", platform),
+		xdb.Field("provider", "http_code", "duration_sec", "first_byte_sec", "created_at"),
+	)
+	if err != nil {
+		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	samples := make([]sloSample, 0, len(records))
+	for _, record := range records {
+		if code := record.GetInt("http_code"); code < 200 || code >= 300 {
+			continue
+		}
+		provider := strings.TrimSpace(record.GetString("provider"))
+		createdAt, ok := parseCreatedAt(record)
+		if provider == "" || !ok {
+			continue
+		}
+		samples = append(samples, sloSample{
+			provider:   provider,
+			ttftMs:     record.GetFloat64("first_byte_sec") * 1000,
+			durationMs: record.GetFloat64("duration_sec") * 1000,
+			at:         createdAt,
+		})
+	}
+	return samples, nil
+}
+
+func sloBreachFromRecord(record xdb.Record) SLOBreach {
+	return SLOBreach{
+		ID:           record.GetInt64("id"),
+		Objective:    record.GetString("objective"),
+		Platform:     record.GetString("platform"),
+		Provider:     record.GetString("provider"),
+		Metric:       record.GetString("metric"),
+		ThresholdMs:  record.GetInt("threshold_ms"),
+		StartedAt:    record.GetInt64("started_at"),
+		EndedAt:      record.GetInt64("ended_at"),
+		PeakBurnRate: record.GetFloat64("peak_burn_rate"),
+		Alerted:      record.GetInt("alerted") == 1,
+	}
+}
+
+func insertSLOBreach(breach *SLOBreach) {
+	if GlobalDBQueue == nil {
+		return
+	}
+	if err := GlobalDBQueue.Exec(
+		`INSERT INTO slo_breach (objective, platform, provider, metric, threshold_ms, started_at, ended_at, peak_burn_rate, alerted) VALUES (?, ?, ?, ?, ?, ?, 0, ?, 0)`,
+		breach.Objective, breach.Platform, breach.Provider, breach.Metric, breach.ThresholdMs, breach.StartedAt, breach.PeakBurnRate,
+	); err != nil {
+		log.Printf("[SLO] 记录违约区间失败: %v", err)
+	}
+}
+
+// updateSLOBreach 按 SLO、provider 与开始时间更新违约区间
+func updateSLOBreach(breach *SLOBreach) {
+	if GlobalDBQueue == nil {
+		return
+	}
+	if err := GlobalDBQueue.Exec(
+		`UPDATE slo_breach SET ended_at = ?, peak_burn_rate = ?, alerted = ? WHERE objective = ? AND provider = ? AND started_at = ?`,
+		breach.EndedAt, breach.PeakBurnRate, boolToInt(breach.Alerted), breach.Objective, breach.Provider, breach.StartedAt,
+	); err != nil {
+		log.Printf("[SLO] 更新违约区间失败: %v", err)
+	}
+}
+
+// pruneSLOBreaches 清理过期的违约记录
+func pruneSLOBreaches(before time.Time) {
+	if GlobalDBQueue == nil {
+		return
+	}
+	if err := GlobalDBQueue.Exec(`DELETE FROM slo_breach WHERE ended_at > 0 AND ended_at < ?`, before.Unix()); err != nil {
+		log.Printf("[SLO] 清理过期违约记录失败: %v", err)
+	}
+}
+
+// sendSLOWebhook 将持续违约告警推送到 webhook
+func sendSLOWebhook(webhookURL string, status SLOStatus) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":         "slo_burn_rate",
+		"objective":     status.Objective,
+		"provider":      status.Provider,
+		"observedMs":    status.Short.ObservedMs,
+		"burnRateShort": status.Short.BurnRate,
+		"burnRateLong":  status.Long.BurnRate,
+		"timestamp":     time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("[SLO] 推送 webhook 失败: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[SLO] 推送 webhook 返回异常状态码: %d", resp.StatusCode)
+	}
+}
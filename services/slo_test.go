@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluateSLO(t *testing.T) {
+	now := time.Now()
+	objective := SLOObjective{Name: "claude-ttft", Platform: "claude", Metric: SLOMetricTTFT, Percentile: 90, ThresholdMs: 2000}
+	config := RelaySLOConfig{BurnRateAlert: 2, MinSamples: 10}
+
+	// 最近 1 小时 10 个请求中 3 个超过 2 秒：超出比例 30%，错误预算 10%，消耗速率 3
+	var samples []sloSample
+	for i := 0; i < 10; i++ {
+		ttft := 500.0
+		if i < 3 {
+			ttft = 3000
+		}
+		samples = append(samples, sloSample{provider: "A", ttftMs: ttft, durationMs: 8000, at: now.Add(-10 * time.Minute)})
+	}
+	status := evaluateSLO(objective, "A", samples, config, now)
+	if !status.Breaching || status.Short.Violations != 3 || status.Short.BurnRate < 2.99 || status.Short.BurnRate > 3.01 {
+		t.Fatalf("应判定违约且消耗速率为 3，得到 %+v", status.Short)
+	}
+	if !status.Alerting {
+		t.Error("短、长窗口消耗速率均达到告警值时应告警")
+	}
+	if status.Short.ObservedMs != 3000 {
+		t.Errorf("p90 应为 3000ms，得到 %.0f", status.Short.ObservedMs)
+	}
+
+	// 再加入 5 小时前的大量正常请求：长窗口消耗速率低于告警值，只违约不告警
+	for i := 0; i < 90; i++ {
+		samples = append(samples, sloSample{provider: "A", ttftMs: 400, durationMs: 6000, at: now.Add(-5 * time.Hour)})
+	}
+	status = evaluateSLO(objective, "A", samples, config, now)
+	if !status.Breaching || status.Alerting {
+		t.Errorf("偶发违约不应告警，得到 breaching=%v alerting=%v long=%+v", status.Breaching, status.Alerting, status.Long)
+	}
+
+	// 样本不足时不判定
+	status = evaluateSLO(objective, "A", samples[:5], config, now)
+	if status.Breaching || status.Short.BurnRate != 0 {
+		t.Errorf("样本不足时不应判定违约，得到 %+v", status.Short)
+	}
+}
+
+func TestValidateSLOConfig(t *testing.T) {
+	config := DefaultRelayConfig().SLO
+	config.Objectives = []SLOObjective{{Name: "p95", Platform: "claude", Metric: SLOMetricTTFT, Percentile: 95, ThresholdMs: 2000}}
+	if err := validateSLOConfig(config); err != nil {
+		t.Fatalf("有效配置不应报错: %v", err)
+	}
+	config.Objectives = append(config.Objectives, SLOObjective{Name: "p95", Platform: "codex", Metric: SLOMetricDuration, Percentile: 95, ThresholdMs: 1000})
+	if err := validateSLOConfig(config); err == nil {
+		t.Error("重复的 SLO 名称应报错")
+	}
+	config.Objectives = []SLOObjective{{Name: "bad", Platform: "claude", Metric: "tps", Percentile: 95, ThresholdMs: 1000}}
+	if err := validateSLOConfig(config); err == nil {
+		t.Error("未知指标应报错")
+	}
+}
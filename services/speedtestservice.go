@@ -1,11 +1,13 @@
 package services
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	neturl "net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -16,6 +18,15 @@ const (
 	maxTimeoutSecs     = 30
 	minTimeoutSecs     = 2
 	endpointsFileName  = "speedtest-endpoints.json"
+
+	// endpointExpiringSoonWindow 到期前多久开始提示“即将到期”
+	endpointExpiringSoonWindow = 7 * 24 * time.Hour
+)
+
+// 端点到期状态（由 GetEndpointRecords 计算，不保存到文件）
+const (
+	EndpointExpiringSoon = "expiring_soon"
+	EndpointExpired      = "expired"
 )
 
 // EndpointLatency 端点延迟测试结果
@@ -24,6 +35,7 @@ type EndpointLatency struct {
 	Latency *uint64 `json:"latency"`          // 延迟（毫秒），nil 表示失败
 	Status  *int    `json:"status,omitempty"` // HTTP 状态码
 	Error   *string `json:"error,omitempty"`  // 错误信息
+	Class   string  `json:"class,omitempty"`  // 延迟分级：good / degraded / bad（失败为 bad）
 }
 
 // EndpointRecord 端点记录（保存到文件的数据结构）
@@ -31,8 +43,16 @@ type EndpointRecord struct {
 	URL            string  `json:"url"`              // API 端点 URL
 	LastTestTime   *int64  `json:"lastTestTime"`     // 最后一次测速时间（Unix 时间戳），nil 表示未测试
 	LastTestSpeed  *uint64 `json:"lastTestSpeed"`    // 最后一次测试速度（毫秒），nil 表示失败或未测试
+	Notes          string  `json:"notes,omitempty"`        // 备注
+	Owner          string  `json:"owner,omitempty"`        // 负责人/联系方式
+	ExpiresAt      *int64  `json:"expiresAt,omitempty"`    // 到期时间（Unix 时间戳），如试用中转的截止日期
+	ExpiryStatus   string  `json:"expiryStatus,omitempty"` // 到期提示：expiring_soon / expired（仅查询时计算）
+	LatencyClass   string  `json:"latencyClass,omitempty"` // 最后一次测速的延迟分级，未测试时为空（仅查询时计算）
 }
 
+// endpointsFileMu 串行化端点文件的“读取-修改-写入”，避免并发测速或编辑时互相覆盖
+var endpointsFileMu sync.Mutex
+
 // SpeedTestService 测速服务
 type SpeedTestService struct {
 	relayAddr string
@@ -68,6 +88,24 @@ func (s *SpeedTestService) TestEndpoints(urls []string, timeoutSecs *int) []Endp
 	timeout := s.sanitizeTimeout(timeoutSecs)
 	client := s.buildClient(timeout)
 
+	// 配置了出站绑定或上游代理的 provider 地址按相同网络路径测速，相同配置共用一个客户端
+	networks := s.loadEndpointNetworks()
+	networkClients := make(map[string]*http.Client)
+	clients := make([]*http.Client, len(urls))
+	for i, rawURL := range urls {
+		clients[i] = client
+		network := endpointNetwork(networks, rawURL)
+		if network.isZero() {
+			continue
+		}
+		if _, ok := networkClients[network.key()]; !ok {
+			networkClient := s.buildClient(timeout)
+			applyProviderNetwork(networkClient, network)
+			networkClients[network.key()] = networkClient
+		}
+		clients[i] = networkClients[network.key()]
+	}
+
 	// 并发测试所有端点
 	results := make([]EndpointLatency, len(urls))
 	var wg sync.WaitGroup
@@ -76,19 +114,31 @@ func (s *SpeedTestService) TestEndpoints(urls []string, timeoutSecs *int) []Endp
 		wg.Add(1)
 		go func(index int, urlStr string) {
 			defer wg.Done()
-			results[index] = s.testSingleEndpoint(client, urlStr)
+			results[index] = s.testSingleEndpoint(clients[index], urlStr)
 		}(i, rawURL)
 	}
 
 	wg.Wait()
 
-	// 保存测试结果（无论成功还是失败）
+	thresholds := currentRelayConfig().LatencyClass
+	for i := range results {
+		if results[i].Error == nil {
+			results[i].Class = thresholds.classify(results[i].Latency)
+		} else {
+			results[i].Class = LatencyBad
+		}
+	}
+
+	// 保存测试结果（无论成功还是失败），整批只写一次端点文件
+	if _, err := s.UpdateEndpointTestResults(results); err != nil {
+		fmt.Printf("保存测速结果失败: %v\n", err)
+	}
 	for _, result := range results {
 		if result.Error == nil {
-			_ = s.UpdateEndpointTestResult(result.URL, result.Latency)
+			recordEndpointLatency(result.URL, result.Latency)
 		} else {
 			// 测试失败也要记录，使用 nil 表示失败
-			_ = s.UpdateEndpointTestResult(result.URL, nil)
+			recordEndpointLatency(result.URL, nil)
 		}
 	}
 
@@ -204,47 +254,88 @@ func (s *SpeedTestService) sanitizeTimeout(timeoutSecs *int) int {
 
 // getEndpointsFilePath 获取端点清单文件路径
 func (s *SpeedTestService) getEndpointsFilePath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".code-switch", endpointsFileName)
+	return filepath.Join(getConfigDir(), endpointsFileName)
+}
+
+// defaultEndpointRecords 首次使用时创建的默认端点
+func defaultEndpointRecords() []EndpointRecord {
+	return []EndpointRecord{
+		{URL: "https://api.anthropic.com", LastTestTime: nil, LastTestSpeed: nil},
+		{URL: "https://api.openai.com", LastTestTime: nil, LastTestSpeed: nil},
+	}
 }
 
 // LoadEndpoints 加载端点清单
+// 只有文件不存在时才创建默认端点；文件无法解析时返回 *CorruptConfigError，不覆盖用户的清单
 func (s *SpeedTestService) LoadEndpoints() ([]EndpointRecord, error) {
 	filePath := s.getEndpointsFilePath()
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
 		// 文件不存在，创建默认端点文件
-		defaultRecords := []EndpointRecord{
-			{URL: "https://api.anthropic.com", LastTestTime: nil, LastTestSpeed: nil},
-			{URL: "https://api.openai.com", LastTestTime: nil, LastTestSpeed: nil},
-		}
-
-		// 确保目录存在并创建文件
+		defaultRecords := defaultEndpointRecords()
 		if err := s.SaveEndpoints(defaultRecords); err != nil {
 			return nil, fmt.Errorf("创建默认端点文件失败: %w", err)
 		}
-
 		return defaultRecords, nil
 	}
+	if err != nil {
+		return nil, fmt.Errorf("读取端点文件失败: %w", err)
+	}
 
 	var records []EndpointRecord
-	if err := ReadJSONFile(filePath, &records); err != nil {
-		// 读取失败，尝试创建默认文件
-		defaultRecords := []EndpointRecord{
-			{URL: "https://api.anthropic.com", LastTestTime: nil, LastTestSpeed: nil},
-			{URL: "https://api.openai.com", LastTestTime: nil, LastTestSpeed: nil},
+	if err := json.Unmarshal(data, &records); err != nil {
+		corrupt := &CorruptConfigError{Path: filePath, Reason: err.Error(), Options: []string{ConfigRecoveryReset}}
+		if len(data) == 0 {
+			corrupt.Reason = "文件为空"
 		}
-
-		if err := s.SaveEndpoints(defaultRecords); err != nil {
-			return nil, fmt.Errorf("创建默认端点文件失败: %w", err)
+		if backup, backupErr := preserveCorruptFile(filePath, data); backupErr != nil {
+			fmt.Printf("[WARN] 保存损坏的端点文件失败: %v\n", backupErr)
+		} else {
+			corrupt.BackupPath = backup
 		}
-
-		return defaultRecords, nil
+		if configRestoreSource(endpointsFileName, filePath) != "" {
+			corrupt.Options = []string{ConfigRecoveryRestore, ConfigRecoveryReset}
+		}
+		return nil, corrupt
 	}
 
 	return records, nil
 }
 
+// RecoverEndpointsFile 处理损坏的端点文件（供前端调用）
+// action 为 restore 时从恢复点或有效备份恢复，为 reset 时重新创建默认端点；损坏的文件会先另存为 .bak
+func (s *SpeedTestService) RecoverEndpointsFile(action string) ([]EndpointRecord, error) {
+	endpointsFileMu.Lock()
+	defer endpointsFileMu.Unlock()
+
+	filePath := s.getEndpointsFilePath()
+	if data, err := os.ReadFile(filePath); err == nil {
+		if _, err := preserveCorruptFile(filePath, data); err != nil {
+			return nil, fmt.Errorf("备份端点文件失败: %w", err)
+		}
+	}
+
+	switch action {
+	case ConfigRecoveryRestore:
+		source := configRestoreSource(endpointsFileName, filePath)
+		if source == "" {
+			return nil, fmt.Errorf("没有可用的端点文件备份")
+		}
+		if err := RestoreBackup(source, filePath); err != nil {
+			return nil, err
+		}
+		recordConfigIntegrity(filePath)
+	case ConfigRecoveryReset:
+		if err := s.SaveEndpoints(defaultEndpointRecords()); err != nil {
+			return nil, fmt.Errorf("创建默认端点文件失败: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("无效的恢复方式: %s（可选值: restore、reset）", action)
+	}
+	return s.LoadEndpoints()
+}
+
 // SaveEndpoints 保存端点清单
 func (s *SpeedTestService) SaveEndpoints(records []EndpointRecord) error {
 	filePath := s.getEndpointsFilePath()
@@ -254,7 +345,18 @@ func (s *SpeedTestService) SaveEndpoints(records []EndpointRecord) error {
 		return fmt.Errorf("创建目录失败: %w", err)
 	}
 
-	return AtomicWriteJSON(filePath, records)
+	// 到期状态与延迟分级是查询时计算的，不写入文件
+	stored := make([]EndpointRecord, len(records))
+	for i, record := range records {
+		record.ExpiryStatus = ""
+		record.LatencyClass = ""
+		stored[i] = record
+	}
+	if err := AtomicWriteJSON(filePath, stored); err != nil {
+		return err
+	}
+	recordConfigIntegrity(filePath)
+	return nil
 }
 
 // AddEndpoint 添加新的端点
@@ -268,6 +370,10 @@ func (s *SpeedTestService) AddEndpoint(url string) error {
 	if err != nil {
 		return fmt.Errorf("URL 无效: %w", err)
 	}
+	url = normalizeEndpointURL(url)
+
+	endpointsFileMu.Lock()
+	defer endpointsFileMu.Unlock()
 
 	// 加载现有端点
 	records, err := s.LoadEndpoints()
@@ -275,10 +381,10 @@ func (s *SpeedTestService) AddEndpoint(url string) error {
 		return err
 	}
 
-	// 检查重复
+	// 检查重复（按规范化后的地址比较）
 	for _, record := range records {
-		if record.URL == url {
-			return fmt.Errorf("端点已存在: %s", url)
+		if normalizeEndpointURL(record.URL) == url {
+			return fmt.Errorf("端点已存在: %s", record.URL)
 		}
 	}
 
@@ -298,6 +404,9 @@ func (s *SpeedTestService) RemoveEndpoint(url string) error {
 		return fmt.Errorf("URL 不能为空")
 	}
 
+	endpointsFileMu.Lock()
+	defer endpointsFileMu.Unlock()
+
 	// 加载现有端点
 	records, err := s.LoadEndpoints()
 	if err != nil {
@@ -308,7 +417,7 @@ func (s *SpeedTestService) RemoveEndpoint(url string) error {
 	var newRecords []EndpointRecord
 	found := false
 	for _, record := range records {
-		if record.URL != url {
+		if !sameEndpoint(record.URL, url) {
 			newRecords = append(newRecords, record)
 		} else {
 			found = true
@@ -328,37 +437,67 @@ func (s *SpeedTestService) UpdateEndpointTestResult(url string, latency *uint64)
 		return fmt.Errorf("URL 不能为空")
 	}
 
+	updated, err := s.UpdateEndpointTestResults([]EndpointLatency{{URL: url, Latency: latency}})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("端点不存在: %s", url)
+	}
+	return nil
+}
+
+// UpdateEndpointTestResults 批量更新端点测试结果，只读写一次端点文件
+// 带错误的结果记为失败（延迟为 nil）；不在清单中的地址忽略，返回实际更新的端点数
+func (s *SpeedTestService) UpdateEndpointTestResults(results []EndpointLatency) (int, error) {
+	if len(results) == 0 {
+		return 0, nil
+	}
+
+	endpointsFileMu.Lock()
+	defer endpointsFileMu.Unlock()
+
 	// 加载现有端点
 	records, err := s.LoadEndpoints()
 	if err != nil {
-		return err
+		return 0, err
+	}
+	index := make(map[string]int, len(records))
+	for i, record := range records {
+		index[normalizeEndpointURL(record.URL)] = i
 	}
 
 	// 更新测试结果
 	now := time.Now().Unix()
-	found := false
-	for i, record := range records {
-		if record.URL == url {
-			records[i].LastTestTime = &now
-			records[i].LastTestSpeed = latency
-			found = true
-			break
+	updated := 0
+	for _, result := range results {
+		i, ok := index[normalizeEndpointURL(result.URL)]
+		if !ok {
+			continue
 		}
+		latency := result.Latency
+		if result.Error != nil {
+			latency = nil
+		}
+		records[i].LastTestTime = &now
+		records[i].LastTestSpeed = latency
+		updated++
 	}
-
-	if !found {
-		return fmt.Errorf("端点不存在: %s", url)
+	if updated == 0 {
+		return 0, nil
 	}
 
-	return s.SaveEndpoints(records)
+	if err := s.SaveEndpoints(records); err != nil {
+		return 0, err
+	}
+	return updated, nil
 }
 
 // ExtractEndpointsFromConfigs 从配置文件中提取API端点
 func (s *SpeedTestService) ExtractEndpointsFromConfigs(relayAddr string) ([]string, error) {
 	var urls []string
 	seen := make(map[string]bool)
-	home, _ := os.UserHomeDir()
-	configDir := filepath.Join(home, ".code-switch")
+	configDir := getConfigDir()
 
 	// 从 Claude Code 配置文件中提取 API URL
 	claudeConfigPath := filepath.Join(configDir, "claude-code.json")
@@ -428,6 +567,29 @@ func (s *SpeedTestService) loadGeminiProviderFile(filePath string) ([]GeminiProv
 	return providers, nil
 }
 
+// loadEndpointNetworks 读取各 provider 地址对应的出站绑定与上游代理（键为规范化后的 URL）
+func (s *SpeedTestService) loadEndpointNetworks() map[string]providerNetwork {
+	networks := make(map[string]providerNetwork)
+	configDir := getConfigDir()
+	for _, name := range []string{"claude-code.json", "codex.json"} {
+		if providers, err := s.loadProviderFile(filepath.Join(configDir, name)); err == nil {
+			for _, provider := range providers {
+				if provider.APIURL != "" && !provider.network().isZero() {
+					networks[normalizeEndpointURL(provider.APIURL)] = provider.network()
+				}
+			}
+		}
+	}
+	if providers, err := s.loadGeminiProviderFile(filepath.Join(configDir, "gemini-providers.json")); err == nil {
+		for _, provider := range providers {
+			if provider.BaseURL != "" && !provider.network().isZero() {
+				networks[normalizeEndpointURL(provider.BaseURL)] = provider.network()
+			}
+		}
+	}
+	return networks
+}
+
 // getBaseURLFromRelayAddr 从代理地址生成基础URL
 func (s *SpeedTestService) getBaseURLFromRelayAddr() string {
 	if s.relayAddr == "" {
@@ -457,26 +619,32 @@ func (s *SpeedTestService) RefreshEndpointsFromConfigs(relayAddr string) error {
 		return fmt.Errorf("从配置提取端点失败: %w", err)
 	}
 
+	endpointsFileMu.Lock()
+	defer endpointsFileMu.Unlock()
+
 	// 加载现有端点
 	records, err := s.LoadEndpoints()
 	if err != nil {
 		return err
 	}
 
-	// 创建 URL 到记录的映射
+	// 创建规范化 URL 到记录的映射
 	recordMap := make(map[string]EndpointRecord)
 	for _, record := range records {
-		recordMap[record.URL] = record
+		recordMap[normalizeEndpointURL(record.URL)] = record
 	}
 
-	// 添加配置中的新端点
+	// 添加配置中的新端点（仅尾部斜杠、大小写或默认端口不同的地址视为已存在）
 	for _, url := range configURLs {
-		if _, exists := recordMap[url]; !exists {
-			records = append(records, EndpointRecord{
-				URL:           url,
+		normalized := normalizeEndpointURL(url)
+		if _, exists := recordMap[normalized]; !exists {
+			record := EndpointRecord{
+				URL:           normalized,
 				LastTestTime:  nil,
 				LastTestSpeed: nil,
-			})
+			}
+			records = append(records, record)
+			recordMap[normalized] = record
 		}
 	}
 
@@ -494,7 +662,167 @@ func (s *SpeedTestService) GetEndpointRecords() ([]EndpointRecord, error) {
 	}
 
 	// 返回端点记录
-	return s.LoadEndpoints()
+	records, err := s.LoadEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	thresholds := currentRelayConfig().LatencyClass
+	for i := range records {
+		records[i].ExpiryStatus = endpointExpiryStatus(records[i].ExpiresAt, now)
+		if records[i].LastTestTime != nil {
+			records[i].LatencyClass = thresholds.classify(records[i].LastTestSpeed)
+		}
+	}
+	return records, nil
+}
+
+// endpointExpiryStatus 计算端点的到期状态，未设置到期时间或距到期较远时返回空字符串
+func endpointExpiryStatus(expiresAt *int64, now time.Time) string {
+	if expiresAt == nil {
+		return ""
+	}
+	expiry := time.Unix(*expiresAt, 0)
+	switch {
+	case !now.Before(expiry):
+		return EndpointExpired
+	case expiry.Sub(now) <= endpointExpiringSoonWindow:
+		return EndpointExpiringSoon
+	default:
+		return ""
+	}
+}
+
+// UpdateEndpointAnnotations 更新端点的备注、负责人与到期时间（供前端调用）
+// expiresAt 为 nil 表示清除到期时间
+func (s *SpeedTestService) UpdateEndpointAnnotations(url string, notes string, owner string, expiresAt *int64) error {
+	if url == "" {
+		return fmt.Errorf("URL 不能为空")
+	}
+	if expiresAt != nil && *expiresAt <= 0 {
+		return fmt.Errorf("到期时间无效")
+	}
+
+	endpointsFileMu.Lock()
+	defer endpointsFileMu.Unlock()
+
+	records, err := s.LoadEndpoints()
+	if err != nil {
+		return err
+	}
+	for i, record := range records {
+		if sameEndpoint(record.URL, url) {
+			records[i].Notes = strings.TrimSpace(notes)
+			records[i].Owner = strings.TrimSpace(owner)
+			records[i].ExpiresAt = expiresAt
+			return s.SaveEndpoints(records)
+		}
+	}
+	return fmt.Errorf("端点不存在: %s", url)
+}
+
+// 端点列表排序字段
+const (
+	EndpointSortLatency  = "latency"  // 按最近一次测速延迟
+	EndpointSortLastTest = "lastTest" // 按最近一次测速时间
+	EndpointSortName     = "name"     // 按 URL 字母序
+)
+
+// EndpointRecordQuery 端点列表查询参数
+type EndpointRecordQuery struct {
+	SortBy   string `json:"sortBy"`   // latency / lastTest / name，为空时保持文件中的顺序
+	Desc     bool   `json:"desc"`     // 是否倒序
+	Page     int    `json:"page"`     // 页码，从 1 开始
+	PageSize int    `json:"pageSize"` // 每页数量，默认 50，最大 500
+}
+
+// EndpointRecordPage 端点列表分页结果
+type EndpointRecordPage struct {
+	Records  []EndpointRecord `json:"records"`
+	Total    int              `json:"total"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"pageSize"`
+}
+
+// QueryEndpointRecords 排序并分页获取端点记录（供前端调用）
+// 未测速或测速失败的端点在按延迟/时间排序时始终排在最后
+func (s *SpeedTestService) QueryEndpointRecords(query EndpointRecordQuery) (*EndpointRecordPage, error) {
+	records, err := s.GetEndpointRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	switch query.SortBy {
+	case "":
+	case EndpointSortLatency:
+		sortEndpointRecords(records, query.Desc, func(r EndpointRecord) (int64, bool) {
+			if r.LastTestSpeed == nil {
+				return 0, false
+			}
+			return int64(*r.LastTestSpeed), true
+		})
+	case EndpointSortLastTest:
+		sortEndpointRecords(records, query.Desc, func(r EndpointRecord) (int64, bool) {
+			if r.LastTestTime == nil {
+				return 0, false
+			}
+			return *r.LastTestTime, true
+		})
+	case EndpointSortName:
+		sort.SliceStable(records, func(i, j int) bool {
+			a, b := strings.ToLower(records[i].URL), strings.ToLower(records[j].URL)
+			if query.Desc {
+				return a > b
+			}
+			return a < b
+		})
+	default:
+		return nil, fmt.Errorf("不支持的排序字段: %s", query.SortBy)
+	}
+
+	pageSize := query.PageSize
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+	if pageSize > 500 {
+		pageSize = 500
+	}
+	page := query.Page
+	if page <= 0 {
+		page = 1
+	}
+
+	result := &EndpointRecordPage{
+		Records:  []EndpointRecord{},
+		Total:    len(records),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	// 先按页数比较再相乘，避免过大的页码溢出成负数
+	if pages := (len(records) + pageSize - 1) / pageSize; page-1 < pages {
+		start := (page - 1) * pageSize
+		end := start + pageSize
+		if end > len(records) {
+			end = len(records)
+		}
+		result.Records = records[start:end]
+	}
+	return result, nil
+}
+
+// sortEndpointRecords 按数值字段稳定排序，缺失值（未测速/失败）始终排在最后
+func sortEndpointRecords(records []EndpointRecord, desc bool, value func(EndpointRecord) (int64, bool)) {
+	sort.SliceStable(records, func(i, j int) bool {
+		a, okA := value(records[i])
+		b, okB := value(records[j])
+		if okA != okB {
+			return okA
+		}
+		if desc {
+			return a > b
+		}
+		return a < b
+	})
 }
 
 // AddEndpointRecord 添加端点记录（供前端调用）
@@ -507,6 +835,104 @@ func (s *SpeedTestService) RemoveEndpointRecord(url string) error {
 	return s.RemoveEndpoint(url)
 }
 
+// normalizeEndpointURL 规范化端点地址：scheme 与主机名小写、去掉默认端口和末尾斜杠
+// 无法解析的地址只去除首尾空白后原样返回
+func normalizeEndpointURL(raw string) string {
+	trimmed := trimSpace(raw)
+	parsed, err := neturl.Parse(trimmed)
+	if err != nil || parsed.Host == "" {
+		return trimmed
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	port := parsed.Port()
+	if (parsed.Scheme == "https" && port == "443") || (parsed.Scheme == "http" && port == "80") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	parsed.Host = host
+	parsed.Path = strings.TrimRight(parsed.Path, "/")
+	parsed.RawPath = ""
+	parsed.Fragment = ""
+	return parsed.String()
+}
+
+// sameEndpoint 判断两个地址规范化后是否相同
+func sameEndpoint(a, b string) bool {
+	return normalizeEndpointURL(a) == normalizeEndpointURL(b)
+}
+
+// MergeDuplicates 合并规范化后相同的端点（供前端调用的维护操作）
+// 保留最近一次测速结果，并将延迟历史归并到规范化地址下；返回被合并掉的条目数
+func (s *SpeedTestService) MergeDuplicates() (int, error) {
+	endpointsFileMu.Lock()
+	defer endpointsFileMu.Unlock()
+
+	records, err := s.LoadEndpoints()
+	if err != nil {
+		return 0, err
+	}
+
+	merged := make([]EndpointRecord, 0, len(records))
+	index := make(map[string]int, len(records))
+	var aliases []string
+	for _, record := range records {
+		normalized := normalizeEndpointURL(record.URL)
+		if record.URL != normalized {
+			aliases = append(aliases, record.URL)
+		}
+		i, exists := index[normalized]
+		if !exists {
+			record.URL = normalized
+			index[normalized] = len(merged)
+			merged = append(merged, record)
+			continue
+		}
+		// 保留较新的测速结果
+		if record.LastTestTime != nil && (merged[i].LastTestTime == nil || *record.LastTestTime > *merged[i].LastTestTime) {
+			merged[i].LastTestTime = record.LastTestTime
+			merged[i].LastTestSpeed = record.LastTestSpeed
+		}
+		// 保留重复条目上的备注信息
+		if merged[i].Notes == "" {
+			merged[i].Notes = record.Notes
+		}
+		if merged[i].Owner == "" {
+			merged[i].Owner = record.Owner
+		}
+		if merged[i].ExpiresAt == nil {
+			merged[i].ExpiresAt = record.ExpiresAt
+		}
+	}
+
+	removed := len(records) - len(merged)
+	if removed == 0 && len(aliases) == 0 {
+		return 0, nil
+	}
+	if _, err := CreateBackup(s.getEndpointsFilePath()); err != nil {
+		return 0, fmt.Errorf("备份端点文件失败: %w", err)
+	}
+	if err := s.SaveEndpoints(merged); err != nil {
+		return 0, err
+	}
+
+	// 延迟历史改写为规范化地址，使趋势统计连续
+	if GlobalDBQueue != nil {
+		for _, alias := range aliases {
+			if err := GlobalDBQueue.Exec(`UPDATE endpoint_latency SET url = ? WHERE url = ?`, normalizeEndpointURL(alias), alias); err != nil {
+				fmt.Printf("合并端点延迟历史失败 (%s): %v\n", alias, err)
+			}
+		}
+	}
+	fmt.Printf("✅ 已合并 %d 个重复端点\n", removed)
+	return removed, nil
+}
+
 // trimSpace 去除字符串首尾空格
 func trimSpace(s string) string {
 	start := 0
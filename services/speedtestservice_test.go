@@ -0,0 +1,256 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNormalizeEndpointURL(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"https://api.example.com", "https://api.example.com"},
+		{"https://api.example.com/", "https://api.example.com"},
+		{"  HTTPS://API.Example.com/v1/ ", "https://api.example.com/v1"},
+		{"https://api.example.com:443/v1", "https://api.example.com/v1"},
+		{"http://127.0.0.1:80", "http://127.0.0.1"},
+		{"http://127.0.0.1:8080/", "http://127.0.0.1:8080"},
+		{"https://api.example.com:80", "https://api.example.com:80"},
+		{"https://api.example.com/Path", "https://api.example.com/Path"},
+		{"not a url", "not a url"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeEndpointURL(tt.input); got != tt.want {
+			t.Errorf("normalizeEndpointURL(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateEndpointTestResultsConcurrent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+	s := NewSpeedTestService()
+
+	var records []EndpointRecord
+	for i := 0; i < 8; i++ {
+		records = append(records, EndpointRecord{URL: fmt.Sprintf("https://relay%d.example.com", i)})
+	}
+	if err := s.SaveEndpoints(records); err != nil {
+		t.Fatalf("SaveEndpoints: %v", err)
+	}
+
+	// 两批结果并发写入，互不覆盖
+	var wg sync.WaitGroup
+	for batch := 0; batch < 2; batch++ {
+		wg.Add(1)
+		go func(batch int) {
+			defer wg.Done()
+			var results []EndpointLatency
+			for i := batch; i < len(records); i += 2 {
+				latency := uint64(100 + i)
+				results = append(results, EndpointLatency{URL: records[i].URL + "/", Latency: &latency})
+			}
+			results = append(results, EndpointLatency{URL: "https://unknown.example.com"})
+			if n, err := s.UpdateEndpointTestResults(results); err != nil || n != len(records)/2 {
+				t.Errorf("UpdateEndpointTestResults = %d, %v", n, err)
+			}
+		}(batch)
+	}
+	wg.Wait()
+
+	loaded, err := s.LoadEndpoints()
+	if err != nil {
+		t.Fatalf("LoadEndpoints: %v", err)
+	}
+	for i, record := range loaded {
+		if record.LastTestSpeed == nil || *record.LastTestSpeed != uint64(100+i) {
+			t.Errorf("%s: LastTestSpeed = %v, want %d", record.URL, record.LastTestSpeed, 100+i)
+		}
+	}
+
+	if err := s.UpdateEndpointTestResult("https://unknown.example.com", nil); err == nil {
+		t.Error("UpdateEndpointTestResult for unknown endpoint should fail")
+	}
+}
+
+func TestLoadEndpointsKeepsCorruptFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	s := NewSpeedTestService()
+	if err := s.SaveEndpoints([]EndpointRecord{{URL: "https://relay.example.com"}}); err != nil {
+		t.Fatalf("SaveEndpoints: %v", err)
+	}
+	path := s.getEndpointsFilePath()
+	corrupt := []byte(`[{"url": "https://relay.example.com"`)
+	if err := os.WriteFile(path, corrupt, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := s.LoadEndpoints()
+		var corruptErr *CorruptConfigError
+		if !errors.As(err, &corruptErr) || corruptErr.BackupPath == "" || len(corruptErr.Options) != 2 {
+			t.Fatalf("LoadEndpoints() error = %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(corrupt) {
+		t.Errorf("损坏的文件不应被覆盖: %s", data)
+	}
+
+	records, err := s.RecoverEndpointsFile(ConfigRecoveryRestore)
+	if err != nil || len(records) != 1 || records[0].URL != "https://relay.example.com" {
+		t.Fatalf("RecoverEndpointsFile(restore) = %+v, %v", records, err)
+	}
+	records, err = s.RecoverEndpointsFile(ConfigRecoveryReset)
+	if err != nil || len(records) != 2 {
+		t.Errorf("RecoverEndpointsFile(reset) = %+v, %v", records, err)
+	}
+}
+
+func TestQueryEndpointRecords(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	s := NewSpeedTestService()
+	speed := func(v uint64) *uint64 { return &v }
+	at := func(v int64) *int64 { return &v }
+	// 文件顺序：c、A、b、d，其中 d 未测速
+	if err := s.SaveEndpoints([]EndpointRecord{
+		{URL: "https://c.example.com", LastTestSpeed: speed(300), LastTestTime: at(100)},
+		{URL: "https://A.example.com", LastTestSpeed: speed(100), LastTestTime: at(300)},
+		{URL: "https://b.example.com", LastTestSpeed: speed(200), LastTestTime: at(200)},
+		{URL: "https://d.example.com"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		query        EndpointRecordQuery
+		wantHosts    string
+		wantPage     int
+		wantPageSize int
+		wantErr      bool
+	}{
+		{name: "默认保持文件顺序", query: EndpointRecordQuery{}, wantHosts: "c,A,b,d", wantPage: 1, wantPageSize: 50},
+		{name: "按延迟升序", query: EndpointRecordQuery{SortBy: EndpointSortLatency}, wantHosts: "A,b,c,d", wantPage: 1, wantPageSize: 50},
+		{name: "按延迟倒序未测速仍在最后", query: EndpointRecordQuery{SortBy: EndpointSortLatency, Desc: true}, wantHosts: "c,b,A,d", wantPage: 1, wantPageSize: 50},
+		{name: "按测速时间升序", query: EndpointRecordQuery{SortBy: EndpointSortLastTest}, wantHosts: "c,b,A,d", wantPage: 1, wantPageSize: 50},
+		{name: "按测速时间倒序未测速仍在最后", query: EndpointRecordQuery{SortBy: EndpointSortLastTest, Desc: true}, wantHosts: "A,b,c,d", wantPage: 1, wantPageSize: 50},
+		{name: "按名称忽略大小写", query: EndpointRecordQuery{SortBy: EndpointSortName}, wantHosts: "A,b,c,d", wantPage: 1, wantPageSize: 50},
+		{name: "按名称倒序", query: EndpointRecordQuery{SortBy: EndpointSortName, Desc: true}, wantHosts: "d,c,b,A", wantPage: 1, wantPageSize: 50},
+		{name: "未知排序字段", query: EndpointRecordQuery{SortBy: "owner"}, wantErr: true},
+		{name: "页码为 0 视为第一页", query: EndpointRecordQuery{SortBy: EndpointSortName, PageSize: 3}, wantHosts: "A,b,c", wantPage: 1, wantPageSize: 3},
+		{name: "最后一页不足一页", query: EndpointRecordQuery{SortBy: EndpointSortName, Page: 2, PageSize: 3}, wantHosts: "d", wantPage: 2, wantPageSize: 3},
+		{name: "超出范围的页为空", query: EndpointRecordQuery{Page: 3, PageSize: 2}, wantHosts: "", wantPage: 3, wantPageSize: 2},
+		{name: "极大页码不溢出", query: EndpointRecordQuery{Page: math.MaxInt, PageSize: 500}, wantHosts: "", wantPage: math.MaxInt, wantPageSize: 500},
+		{name: "每页数量超过上限", query: EndpointRecordQuery{Page: math.MaxInt / 2, PageSize: math.MaxInt}, wantHosts: "", wantPage: math.MaxInt / 2, wantPageSize: 500},
+		{name: "每页数量为负数", query: EndpointRecordQuery{Page: -1, PageSize: -5}, wantHosts: "c,A,b,d", wantPage: 1, wantPageSize: 50},
+	}
+	for _, tt := range tests {
+		result, err := s.QueryEndpointRecords(tt.query)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: 应返回错误", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: QueryEndpointRecords() 失败: %v", tt.name, err)
+		}
+		var hosts []string
+		for _, record := range result.Records {
+			hosts = append(hosts, strings.TrimSuffix(strings.TrimPrefix(record.URL, "https://"), ".example.com"))
+		}
+		if got := strings.Join(hosts, ","); got != tt.wantHosts || result.Total != 4 || result.Page != tt.wantPage || result.PageSize != tt.wantPageSize {
+			t.Errorf("%s: 得到 %q (total=%d page=%d size=%d)，期望 %q (page=%d size=%d)",
+				tt.name, got, result.Total, result.Page, result.PageSize, tt.wantHosts, tt.wantPage, tt.wantPageSize)
+		}
+	}
+}
+
+func TestUpdateEndpointAnnotations(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	s := NewSpeedTestService()
+	if err := s.SaveEndpoints([]EndpointRecord{{URL: "https://a.example.com"}, {URL: "https://b.example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 添加：按规范化地址匹配，去除首尾空白
+	soon := time.Now().Add(3 * 24 * time.Hour).Unix()
+	if err := s.UpdateEndpointAnnotations("HTTPS://A.example.com:443/", "  试用中转  ", " ops@example.com ", &soon); err != nil {
+		t.Fatalf("UpdateEndpointAnnotations() 失败: %v", err)
+	}
+	expired := time.Now().Add(-time.Hour).Unix()
+	if err := s.UpdateEndpointAnnotations("https://b.example.com", "旧线路", "", &expired); err != nil {
+		t.Fatal(err)
+	}
+
+	// 持久化：新的服务实例从文件读取，查询时计算的字段不写入文件
+	records, err := NewSpeedTestService().LoadEndpoints()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("LoadEndpoints() = %+v, %v", records, err)
+	}
+	if a := records[0]; a.Notes != "试用中转" || a.Owner != "ops@example.com" || a.ExpiresAt == nil || *a.ExpiresAt != soon {
+		t.Errorf("备注未保存: %+v", a)
+	}
+	if data, _ := os.ReadFile(s.getEndpointsFilePath()); strings.Contains(string(data), "expiryStatus") {
+		t.Errorf("到期状态不应写入文件: %s", data)
+	}
+
+	// 测速结果更新不覆盖备注
+	latency := uint64(120)
+	if _, err := s.UpdateEndpointTestResults([]EndpointLatency{{URL: "https://a.example.com", Latency: &latency}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 通过 QueryEndpointRecords 读取备注与到期状态
+	page, err := s.QueryEndpointRecords(EndpointRecordQuery{SortBy: EndpointSortName})
+	if err != nil || len(page.Records) != 2 {
+		t.Fatalf("QueryEndpointRecords() = %+v, %v", page, err)
+	}
+	a, b := page.Records[0], page.Records[1]
+	if a.Notes != "试用中转" || a.Owner != "ops@example.com" || a.ExpiryStatus != EndpointExpiringSoon || a.LastTestSpeed == nil || *a.LastTestSpeed != latency {
+		t.Errorf("a 的查询结果不符: %+v", a)
+	}
+	if b.Notes != "旧线路" || b.ExpiryStatus != EndpointExpired {
+		t.Errorf("b 的查询结果不符: %+v", b)
+	}
+
+	// 编辑：清除到期时间与负责人
+	if err := s.UpdateEndpointAnnotations("https://b.example.com", "长期线路", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	page, err = s.QueryEndpointRecords(EndpointRecordQuery{SortBy: EndpointSortName, Desc: true, PageSize: 1})
+	if err != nil || len(page.Records) != 1 {
+		t.Fatalf("QueryEndpointRecords() = %+v, %v", page, err)
+	}
+	if b := page.Records[0]; b.URL != "https://b.example.com" || b.Notes != "长期线路" || b.ExpiresAt != nil || b.ExpiryStatus != "" {
+		t.Errorf("编辑后的查询结果不符: %+v", b)
+	}
+
+	invalid := int64(0)
+	for _, tt := range []struct {
+		url       string
+		expiresAt *int64
+	}{
+		{"", nil},
+		{"https://a.example.com", &invalid},
+		{"https://unknown.example.com", nil},
+	} {
+		if err := s.UpdateEndpointAnnotations(tt.url, "x", "", tt.expiresAt); err == nil {
+			t.Errorf("UpdateEndpointAnnotations(%q, %v) 应返回错误", tt.url, tt.expiresAt)
+		}
+	}
+}
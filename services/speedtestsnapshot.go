@@ -0,0 +1,321 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 测速快照：保存当前各端点最后一次测速结果（如“开 VPN 前”“开 VPN 后”），再逐端点对比两次快照的延迟变化。
+// 快照保存在 ~/.code-switch/speedtest-snapshots.json，与端点清单共用文件锁。
+
+const (
+	speedTestSnapshotsFileName = "speedtest-snapshots.json"
+	// maxSpeedTestSnapshots 保留的快照数，超出后删除最早的
+	maxSpeedTestSnapshots = 50
+	// maxSnapshotNameLength 快照名称最大字符数
+	maxSnapshotNameLength = 64
+	// snapshotUnchangedMs 延迟变化在此范围内（或不超过原延迟的 10%）视为无变化
+	snapshotUnchangedMs = 20
+)
+
+// 快照对比中单个端点的变化
+const (
+	SnapshotImproved    = "improved"    // 延迟降低
+	SnapshotRegressed   = "regressed"   // 延迟升高
+	SnapshotUnchanged   = "unchanged"   // 变化不明显
+	SnapshotRecovered   = "recovered"   // 之前失败，现在可用
+	SnapshotFailed      = "failed"      // 之前可用，现在失败
+	SnapshotUnavailable = "unavailable" // 两次都失败或未测试
+	SnapshotAdded       = "added"       // 只在后一个快照中
+	SnapshotRemoved     = "removed"     // 只在前一个快照中
+)
+
+// SpeedTestSnapshot 测速快照
+type SpeedTestSnapshot struct {
+	Name      string                   `json:"name"`
+	CreatedAt int64                    `json:"createdAt"` // Unix 时间戳
+	Results   []SpeedTestSnapshotEntry `json:"results"`
+}
+
+// SpeedTestSnapshotEntry 快照中单个端点的测速结果
+type SpeedTestSnapshotEntry struct {
+	URL       string  `json:"url"`
+	LatencyMs *uint64 `json:"latencyMs"`          // nil 表示失败或未测试
+	TestedAt  *int64  `json:"testedAt,omitempty"` // 测速时间（Unix 时间戳）
+}
+
+// SpeedTestSnapshotInfo 快照列表项
+type SpeedTestSnapshotInfo struct {
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"createdAt"`
+	Endpoints int    `json:"endpoints"`
+}
+
+// SnapshotDelta 单个端点在两次快照之间的变化
+type SnapshotDelta struct {
+	URL          string   `json:"url"`
+	BeforeMs     *uint64  `json:"beforeMs"`
+	AfterMs      *uint64  `json:"afterMs"`
+	DeltaMs      *int64   `json:"deltaMs,omitempty"`      // AfterMs - BeforeMs，两次都成功时才有
+	DeltaPercent *float64 `json:"deltaPercent,omitempty"` // 相对 BeforeMs 的变化百分比
+	Change       string   `json:"change"`
+}
+
+// SnapshotComparison 两次快照的对比报告
+type SnapshotComparison struct {
+	Before    string          `json:"before"`
+	After     string          `json:"after"`
+	Deltas    []SnapshotDelta `json:"deltas"`    // 按变化幅度排序：变慢最多的在前
+	Summary   map[string]int  `json:"summary"`   // 各类变化的端点数
+	AvgDelta  *float64        `json:"avgDelta"`  // 两次都成功的端点的平均延迟变化（毫秒）
+	Generated int64           `json:"generated"` // 生成时间（Unix 时间戳）
+}
+
+// getSnapshotsFilePath 获取快照文件路径
+func (s *SpeedTestService) getSnapshotsFilePath() string {
+	return filepath.Join(getConfigDir(), speedTestSnapshotsFileName)
+}
+
+// loadSnapshots 读取全部快照（文件不存在时返回空列表）
+func (s *SpeedTestService) loadSnapshots() ([]SpeedTestSnapshot, error) {
+	filePath := s.getSnapshotsFilePath()
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	var snapshots []SpeedTestSnapshot
+	if err := ReadJSONFile(filePath, &snapshots); err != nil {
+		return nil, fmt.Errorf("读取测速快照失败: %w", err)
+	}
+	return snapshots, nil
+}
+
+// saveSnapshots 写入全部快照
+func (s *SpeedTestService) saveSnapshots(snapshots []SpeedTestSnapshot) error {
+	filePath := s.getSnapshotsFilePath()
+	if err := EnsureDir(filepath.Dir(filePath)); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	if snapshots == nil {
+		snapshots = []SpeedTestSnapshot{}
+	}
+	return AtomicWriteJSON(filePath, snapshots)
+}
+
+// SaveSnapshot 将各端点最后一次测速结果保存为快照，同名快照会被覆盖
+func (s *SpeedTestService) SaveSnapshot(name string) (*SpeedTestSnapshot, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("快照名称不能为空")
+	}
+	if utf8.RuneCountInString(name) > maxSnapshotNameLength {
+		return nil, fmt.Errorf("快照名称不能超过 %d 个字符", maxSnapshotNameLength)
+	}
+
+	endpointsFileMu.Lock()
+	defer endpointsFileMu.Unlock()
+
+	records, err := s.LoadEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := SpeedTestSnapshot{
+		Name:      name,
+		CreatedAt: time.Now().Unix(),
+		Results:   make([]SpeedTestSnapshotEntry, 0, len(records)),
+	}
+	for _, record := range records {
+		snapshot.Results = append(snapshot.Results, SpeedTestSnapshotEntry{
+			URL:       normalizeEndpointURL(record.URL),
+			LatencyMs: record.LastTestSpeed,
+			TestedAt:  record.LastTestTime,
+		})
+	}
+
+	snapshots, err := s.loadSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]SpeedTestSnapshot, 0, len(snapshots)+1)
+	for _, existing := range snapshots {
+		if existing.Name != name {
+			kept = append(kept, existing)
+		}
+	}
+	kept = append(kept, snapshot)
+	if len(kept) > maxSpeedTestSnapshots {
+		kept = kept[len(kept)-maxSpeedTestSnapshots:]
+	}
+	if err := s.saveSnapshots(kept); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// ListSnapshots 列出快照，最新的在前
+func (s *SpeedTestService) ListSnapshots() ([]SpeedTestSnapshotInfo, error) {
+	endpointsFileMu.Lock()
+	defer endpointsFileMu.Unlock()
+
+	snapshots, err := s.loadSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]SpeedTestSnapshotInfo, 0, len(snapshots))
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		infos = append(infos, SpeedTestSnapshotInfo{
+			Name:      snapshots[i].Name,
+			CreatedAt: snapshots[i].CreatedAt,
+			Endpoints: len(snapshots[i].Results),
+		})
+	}
+	return infos, nil
+}
+
+// DeleteSnapshot 删除快照
+func (s *SpeedTestService) DeleteSnapshot(name string) error {
+	endpointsFileMu.Lock()
+	defer endpointsFileMu.Unlock()
+
+	snapshots, err := s.loadSnapshots()
+	if err != nil {
+		return err
+	}
+	kept := make([]SpeedTestSnapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if snapshot.Name != name {
+			kept = append(kept, snapshot)
+		}
+	}
+	if len(kept) == len(snapshots) {
+		return fmt.Errorf("快照不存在: %s", name)
+	}
+	return s.saveSnapshots(kept)
+}
+
+// CompareSnapshots 逐端点对比两次快照（a 为之前，b 为之后）
+func (s *SpeedTestService) CompareSnapshots(a, b string) (*SnapshotComparison, error) {
+	endpointsFileMu.Lock()
+	snapshots, err := s.loadSnapshots()
+	endpointsFileMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var before, after *SpeedTestSnapshot
+	for i := range snapshots {
+		switch snapshots[i].Name {
+		case a:
+			before = &snapshots[i]
+		case b:
+			after = &snapshots[i]
+		}
+	}
+	if before == nil {
+		return nil, fmt.Errorf("快照不存在: %s", a)
+	}
+	if after == nil {
+		return nil, fmt.Errorf("快照不存在: %s", b)
+	}
+	comparison := compareSnapshots(*before, *after)
+	comparison.Generated = time.Now().Unix()
+	return &comparison, nil
+}
+
+// compareSnapshots 计算两次快照之间每个端点的延迟变化
+func compareSnapshots(before, after SpeedTestSnapshot) SnapshotComparison {
+	afterByURL := make(map[string]SpeedTestSnapshotEntry, len(after.Results))
+	for _, entry := range after.Results {
+		afterByURL[normalizeEndpointURL(entry.URL)] = entry
+	}
+
+	comparison := SnapshotComparison{
+		Before:  before.Name,
+		After:   after.Name,
+		Deltas:  []SnapshotDelta{},
+		Summary: map[string]int{},
+	}
+	seen := make(map[string]bool, len(before.Results))
+	var totalDelta float64
+	var measured int
+	for _, entry := range before.Results {
+		url := normalizeEndpointURL(entry.URL)
+		seen[url] = true
+		next, ok := afterByURL[url]
+		if !ok {
+			comparison.Deltas = append(comparison.Deltas, SnapshotDelta{URL: url, BeforeMs: entry.LatencyMs, Change: SnapshotRemoved})
+			continue
+		}
+		delta := snapshotDelta(url, entry.LatencyMs, next.LatencyMs)
+		if delta.DeltaMs != nil {
+			totalDelta += float64(*delta.DeltaMs)
+			measured++
+		}
+		comparison.Deltas = append(comparison.Deltas, delta)
+	}
+	for _, entry := range after.Results {
+		url := normalizeEndpointURL(entry.URL)
+		if !seen[url] {
+			seen[url] = true
+			comparison.Deltas = append(comparison.Deltas, SnapshotDelta{URL: url, AfterMs: entry.LatencyMs, Change: SnapshotAdded})
+		}
+	}
+
+	for _, delta := range comparison.Deltas {
+		comparison.Summary[delta.Change]++
+	}
+	if measured > 0 {
+		avg := totalDelta / float64(measured)
+		comparison.AvgDelta = &avg
+	}
+
+	// 变慢最多的在前，其次是失败的，没有延迟变化的按地址排序
+	sort.SliceStable(comparison.Deltas, func(i, j int) bool {
+		di, dj := comparison.Deltas[i], comparison.Deltas[j]
+		if (di.DeltaMs != nil) != (dj.DeltaMs != nil) {
+			return di.DeltaMs != nil
+		}
+		if di.DeltaMs != nil && *di.DeltaMs != *dj.DeltaMs {
+			return *di.DeltaMs > *dj.DeltaMs
+		}
+		if (di.Change == SnapshotFailed) != (dj.Change == SnapshotFailed) {
+			return di.Change == SnapshotFailed
+		}
+		return di.URL < dj.URL
+	})
+	return comparison
+}
+
+// snapshotDelta 计算单个端点的变化
+func snapshotDelta(url string, beforeMs, afterMs *uint64) SnapshotDelta {
+	delta := SnapshotDelta{URL: url, BeforeMs: beforeMs, AfterMs: afterMs}
+	switch {
+	case beforeMs == nil && afterMs == nil:
+		delta.Change = SnapshotUnavailable
+	case beforeMs == nil:
+		delta.Change = SnapshotRecovered
+	case afterMs == nil:
+		delta.Change = SnapshotFailed
+	default:
+		diff := int64(*afterMs) - int64(*beforeMs)
+		delta.DeltaMs = &diff
+		if *beforeMs > 0 {
+			percent := float64(diff) / float64(*beforeMs) * 100
+			delta.DeltaPercent = &percent
+		}
+		threshold := max(int64(snapshotUnchangedMs), int64(*beforeMs)/10)
+		switch {
+		case diff > threshold:
+			delta.Change = SnapshotRegressed
+		case diff < -threshold:
+			delta.Change = SnapshotImproved
+		default:
+			delta.Change = SnapshotUnchanged
+		}
+	}
+	return delta
+}
@@ -0,0 +1,94 @@
+package services
+
+import "testing"
+
+func TestCompareSnapshots(t *testing.T) {
+	ms := func(v uint64) *uint64 { return &v }
+	before := SpeedTestSnapshot{Name: "before VPN", Results: []SpeedTestSnapshotEntry{
+		{URL: "https://a.example.com", LatencyMs: ms(300)},
+		{URL: "https://b.example.com", LatencyMs: ms(200)},
+		{URL: "https://c.example.com", LatencyMs: ms(100)},
+		{URL: "https://d.example.com", LatencyMs: ms(100)},
+		{URL: "https://e.example.com"},
+		{URL: "https://gone.example.com", LatencyMs: ms(50)},
+	}}
+	after := SpeedTestSnapshot{Name: "after VPN", Results: []SpeedTestSnapshotEntry{
+		{URL: "https://a.example.com/", LatencyMs: ms(120)},
+		{URL: "https://b.example.com", LatencyMs: ms(450)},
+		{URL: "https://c.example.com", LatencyMs: ms(110)},
+		{URL: "https://d.example.com"},
+		{URL: "https://e.example.com", LatencyMs: ms(80)},
+		{URL: "https://new.example.com", LatencyMs: ms(60)},
+	}}
+
+	comparison := compareSnapshots(before, after)
+	changes := map[string]string{}
+	for _, delta := range comparison.Deltas {
+		changes[delta.URL] = delta.Change
+	}
+	want := map[string]string{
+		"https://a.example.com":    SnapshotImproved,
+		"https://b.example.com":    SnapshotRegressed,
+		"https://c.example.com":    SnapshotUnchanged,
+		"https://d.example.com":    SnapshotFailed,
+		"https://e.example.com":    SnapshotRecovered,
+		"https://gone.example.com": SnapshotRemoved,
+		"https://new.example.com":  SnapshotAdded,
+	}
+	for url, change := range want {
+		if changes[url] != change {
+			t.Errorf("%s: 期望 %s，得到 %s", url, change, changes[url])
+		}
+	}
+	if first := comparison.Deltas[0]; first.URL != "https://b.example.com" || *first.DeltaMs != 250 {
+		t.Errorf("变慢最多的端点应排在最前: %+v", first)
+	}
+	if comparison.AvgDelta == nil || *comparison.AvgDelta != (-180+250+10)/3.0 {
+		t.Errorf("平均变化不正确: %v", comparison.AvgDelta)
+	}
+}
+
+func TestSaveAndCompareSnapshots(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+	s := NewSpeedTestService()
+	ms := func(v uint64) *uint64 { return &v }
+
+	if err := s.SaveEndpoints([]EndpointRecord{{URL: "https://a.example.com"}}); err != nil {
+		t.Fatalf("SaveEndpoints: %v", err)
+	}
+	if err := s.UpdateEndpointTestResult("https://a.example.com", ms(300)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveSnapshot("before"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateEndpointTestResult("https://a.example.com", ms(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveSnapshot("after"); err != nil {
+		t.Fatal(err)
+	}
+
+	comparison, err := s.CompareSnapshots("before", "after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comparison.Deltas) != 1 || comparison.Deltas[0].Change != SnapshotImproved {
+		t.Errorf("对比结果不正确: %+v", comparison.Deltas)
+	}
+	if _, err := s.CompareSnapshots("before", "missing"); err == nil {
+		t.Error("不存在的快照应报错")
+	}
+	if _, err := s.SaveSnapshot("  "); err == nil {
+		t.Error("空名称应报错")
+	}
+
+	if err := s.DeleteSnapshot("before"); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := s.ListSnapshots()
+	if err != nil || len(infos) != 1 || infos[0].Name != "after" {
+		t.Errorf("删除后应只剩 after: %+v %v", infos, err)
+	}
+}
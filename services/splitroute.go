@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 虚拟 provider（配置了 SplitRoutes）按请求的模型名把请求分流到同平台的其他 provider，
+// 例如 {"claude-*": "Anthropic 官方", "gpt-*": "OpenRouter"}，混用多家模型的工具只需配置一个中继地址。
+// 虚拟 provider 本身不需要 API 地址和 Key；路由目标即使未启用也可以被虚拟 provider 使用，
+// 拉黑、统计与日志都记在实际处理请求的目标 provider 上。
+
+// isSplitProvider 是否为虚拟 provider
+func (p *Provider) isSplitProvider() bool {
+	return len(p.SplitRoutes) > 0
+}
+
+// matchSplitRoute 按模型名选择路由目标：精确匹配优先，其次是最长的通配符模式，"*" 兜底
+func matchSplitRoute(routes map[string]string, model string) (string, bool) {
+	if target, ok := routes[model]; ok && model != "" {
+		return target, true
+	}
+	patterns := make([]string, 0, len(routes))
+	for pattern := range routes {
+		if strings.Contains(pattern, "*") {
+			patterns = append(patterns, pattern)
+		}
+	}
+	// 模式越长越具体；长度相同时按字典序，保证结果稳定
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	for _, pattern := range patterns {
+		if pattern == "*" || (model != "" && matchWildcard(pattern, model)) {
+			return routes[pattern], true
+		}
+	}
+	return "", false
+}
+
+// resolveSplitRoute 解析虚拟 provider 的路由目标，返回替代它参与转发的 provider
+// 目标沿用虚拟 provider 的 Level，以保持其在降级顺序中的位置
+func resolveSplitRoute(virtual Provider, providers []Provider, model string) (Provider, error) {
+	targetName, ok := matchSplitRoute(virtual.SplitRoutes, model)
+	if !ok {
+		return Provider{}, fmt.Errorf("没有匹配模型 %s 的路由", model)
+	}
+	for _, candidate := range providers {
+		if candidate.Name != targetName {
+			continue
+		}
+		if candidate.isSplitProvider() {
+			return Provider{}, fmt.Errorf("路由目标 %s 也是虚拟 provider", targetName)
+		}
+		candidate.Enabled = true
+		candidate.Level = virtual.Level
+		return candidate, nil
+	}
+	return Provider{}, fmt.Errorf("路由目标 %s 不存在", targetName)
+}
+
+// validateSplitRoutes 保存前校验虚拟 provider 的路由：目标必须是同平台中存在的普通 provider
+func validateSplitRoutes(provider Provider, providers []Provider) error {
+	if !provider.isSplitProvider() {
+		return nil
+	}
+	names := make(map[string]bool, len(providers))
+	for _, p := range providers {
+		if !p.isSplitProvider() {
+			names[p.Name] = true
+		}
+	}
+	for pattern, target := range provider.SplitRoutes {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("分流规则的模型匹配不能为空")
+		}
+		if strings.Count(pattern, "*") > 1 {
+			return fmt.Errorf("分流规则 %s 只支持一个 * 通配符", pattern)
+		}
+		if target == provider.Name {
+			return fmt.Errorf("分流规则 %s 不能指向自身", pattern)
+		}
+		if !names[target] {
+			return fmt.Errorf("分流规则 %s 的目标 %s 不存在或也是虚拟 provider", pattern, target)
+		}
+	}
+	return nil
+}
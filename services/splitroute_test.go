@@ -0,0 +1,57 @@
+package services
+
+import "testing"
+
+func TestResolveSplitRoute(t *testing.T) {
+	providers := []Provider{
+		{Name: "anthropic", APIURL: "https://a", APIKey: "k", Level: 3},
+		{Name: "router", APIURL: "https://r", APIKey: "k"},
+		{Name: "opus-only", APIURL: "https://o", APIKey: "k"},
+	}
+	virtual := Provider{Name: "mixed", Level: 1, Enabled: true, SplitRoutes: map[string]string{
+		"claude-*":       "anthropic",
+		"claude-opus-*":  "opus-only",
+		"gpt-*":          "router",
+		"deepseek-chat":  "router",
+		"missing-model*": "missing",
+	}}
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"claude-sonnet-4", "anthropic"},
+		{"claude-opus-4-1", "opus-only"},
+		{"gpt-5", "router"},
+		{"deepseek-chat", "router"},
+	}
+	for _, tt := range tests {
+		got, err := resolveSplitRoute(virtual, providers, tt.model)
+		if err != nil || got.Name != tt.want {
+			t.Errorf("resolveSplitRoute(%q) = %s, %v; want %s", tt.model, got.Name, err, tt.want)
+			continue
+		}
+		if got.Level != 1 || !got.Enabled {
+			t.Errorf("路由目标应沿用虚拟 provider 的 Level 并视为启用: %+v", got)
+		}
+	}
+	if _, err := resolveSplitRoute(virtual, providers, "gemini-2.5-pro"); err == nil {
+		t.Error("未匹配的模型应返回错误")
+	}
+	if _, err := resolveSplitRoute(virtual, providers, "missing-model-x"); err == nil {
+		t.Error("不存在的目标应返回错误")
+	}
+}
+
+func TestValidateSplitRoutes(t *testing.T) {
+	providers := []Provider{{Name: "a"}, {Name: "v", SplitRoutes: map[string]string{"*": "a"}}}
+	if err := validateSplitRoutes(providers[1], providers); err != nil {
+		t.Errorf("合法配置报错: %v", err)
+	}
+	if err := validateSplitRoutes(Provider{Name: "w", SplitRoutes: map[string]string{"*": "v"}}, providers); err == nil {
+		t.Error("指向虚拟 provider 应报错")
+	}
+	if err := validateSplitRoutes(Provider{Name: "w", SplitRoutes: map[string]string{"a*b*": "a"}}, providers); err == nil {
+		t.Error("多个通配符应报错")
+	}
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 自检项状态
+const (
+	StartupCheckOK    = "ok"
+	StartupCheckWarn  = "warn"
+	StartupCheckError = "error"
+)
+
+// 一键修复动作
+const (
+	StartupRepairRecreateProviders   = "recreate_providers"    // 备份并重建损坏的 provider 配置文件
+	StartupRepairRecreateRelayConfig = "recreate_relay_config" // 备份并重建损坏的中继配置文件
+	StartupRepairRunMigration        = "run_migration"         // 重新执行数据库表结构迁移
+	StartupRepairPickPort            = "pick_port"             // 选择一个空闲端口作为中继端口（重启后生效）
+)
+
+// StartupCheckItem 单个自检项结果
+type StartupCheckItem struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Repair  string `json:"repair,omitempty"` // 可执行的修复动作，为空表示需手动处理
+	Target  string `json:"target,omitempty"` // 修复动作的作用对象（如平台名）
+}
+
+// StartupReport 启动自检报告
+type StartupReport struct {
+	OK             bool               `json:"ok"` // 是否没有 error 级别的问题
+	Items          []StartupCheckItem `json:"items"`
+	SecretFindings []SecretFinding    `json:"secretFindings"` // 密钥扫描发现的问题明细
+	CheckedAt      int64              `json:"checkedAt"`
+}
+
+// StartupCheckService 启动自检：尽早发现配置目录、数据库、端口、provider 配置的问题
+// 并提供一键修复，避免问题在之后不相关的调用中才暴露
+type StartupCheckService struct {
+	providerService *ProviderService
+	relay           *ProviderRelayService
+	mu              sync.RWMutex
+	lastReport      *StartupReport
+}
+
+func NewStartupCheckService(providerService *ProviderService, relay *ProviderRelayService) *StartupCheckService {
+	return &StartupCheckService{
+		providerService: providerService,
+		relay:           relay,
+	}
+}
+
+func (sc *StartupCheckService) Start() error { return nil }
+func (sc *StartupCheckService) Stop() error  { return nil }
+
+// RunStartupChecks 执行全部自检项（启动时调用一次，前端也可手动重新检查）
+func (sc *StartupCheckService) RunStartupChecks() *StartupReport {
+	report := &StartupReport{OK: true, CheckedAt: time.Now().UnixMilli()}
+	report.Items = append(report.Items, sc.checkConfigDir())
+	report.Items = append(report.Items, sc.checkDatabase())
+	report.Items = append(report.Items, sc.checkRelayPort())
+	report.Items = append(report.Items, sc.checkRelayConfig())
+	for _, kind := range []string{"claude", "codex"} {
+		report.Items = append(report.Items, sc.checkProviders(kind))
+	}
+	secretsItem, findings := sc.checkSecrets()
+	report.Items = append(report.Items, secretsItem)
+	report.SecretFindings = findings
+
+	for _, item := range report.Items {
+		switch item.Status {
+		case StartupCheckError:
+			report.OK = false
+			log.Printf("❌ 启动自检 [%s] %s", item.Name, item.Message)
+		case StartupCheckWarn:
+			log.Printf("⚠️  启动自检 [%s] %s", item.Name, item.Message)
+		}
+	}
+
+	sc.mu.Lock()
+	sc.lastReport = report
+	sc.mu.Unlock()
+	return report
+}
+
+// GetStartupReport 获取最近一次自检报告（尚未执行时立即执行）
+func (sc *StartupCheckService) GetStartupReport() *StartupReport {
+	sc.mu.RLock()
+	report := sc.lastReport
+	sc.mu.RUnlock()
+	if report == nil {
+		return sc.RunStartupChecks()
+	}
+	return report
+}
+
+// RunRepair 执行修复动作，完成后重新自检并返回新报告
+func (sc *StartupCheckService) RunRepair(action string, target string) (*StartupReport, error) {
+	var err error
+	switch action {
+	case StartupRepairRecreateProviders:
+		err = sc.recreateProviders(target)
+	case StartupRepairRecreateRelayConfig:
+		err = recreateRelayConfig()
+	case StartupRepairRunMigration:
+		err = ensureSchema()
+	case StartupRepairPickPort:
+		err = pickRelayPort()
+	default:
+		return nil, fmt.Errorf("未知的修复动作: %s", action)
+	}
+	if err != nil {
+		return nil, err
+	}
+	recordAudit("startup", action, fmt.Sprintf("执行启动自检修复: %s %s", action, target))
+	return sc.RunStartupChecks(), nil
+}
+
+// checkSecrets 扫描填错位置的密钥与可被其他用户读取的密钥文件（文件权限自动收紧为 0600）
+func (sc *StartupCheckService) checkSecrets() (StartupCheckItem, []SecretFinding) {
+	item := StartupCheckItem{ID: "secrets", Name: "密钥安全", Status: StartupCheckOK, Message: "未发现问题"}
+	findings := scanSecrets()
+	if findings == nil {
+		findings = []SecretFinding{}
+	}
+	fixed := 0
+	for _, finding := range findings {
+		if finding.Fixed {
+			fixed++
+		}
+	}
+	switch {
+	case fixed < len(findings):
+		item.Status = StartupCheckWarn
+		item.Message = fmt.Sprintf("发现 %d 处密钥问题（已自动修复 %d 处），请查看明细", len(findings), fixed)
+	case fixed > 0:
+		item.Message = fmt.Sprintf("已将 %d 个含密钥文件的权限修改为 0600", fixed)
+	}
+	return item, findings
+}
+
+// checkConfigDir 配置目录是否可写（默认目录不可写时提示已改用的备用目录）
+func (sc *StartupCheckService) checkConfigDir() StartupCheckItem {
+	item := StartupCheckItem{ID: "config_dir", Name: "配置目录", Status: StartupCheckOK}
+	status := resolveConfigPath()
+	if err := probeWritableDir(status.Active); err != nil {
+		item.Status, item.Message = StartupCheckError, fmt.Sprintf("配置目录 %s 不可写，请检查目录权限: %v", status.Active, err)
+		return item
+	}
+	item.Message = status.Active
+	if status.Fallback {
+		item.Status = StartupCheckWarn
+		item.Message = fmt.Sprintf("默认配置目录 %s 不可用（%s），已改用 %s", status.Primary, status.Reason, status.Active)
+	}
+	return item
+}
+
+// checkDatabase 数据库能否打开且表结构完整
+func (sc *StartupCheckService) checkDatabase() StartupCheckItem {
+	item := StartupCheckItem{ID: "database", Name: "数据库", Status: StartupCheckOK}
+	db, err := xdb.DB("default")
+	if err != nil {
+		item.Status, item.Message = StartupCheckError, fmt.Sprintf("获取数据库连接失败: %v", err)
+		return item
+	}
+	if err := db.Ping(); err != nil {
+		item.Status, item.Message = StartupCheckError, fmt.Sprintf("数据库无法打开: %v", err)
+		return item
+	}
+
+	var result string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&result); err != nil || result != "ok" {
+		if err != nil {
+			result = err.Error()
+		}
+		item.Status, item.Message = StartupCheckError, fmt.Sprintf("数据库文件可能已损坏（%s），建议从备份恢复", result)
+		return item
+	}
+
+	shared, err := sharedDB()
+	if err != nil {
+		item.Status, item.Message = StartupCheckError, fmt.Sprintf("共享表数据库无法打开: %v", err)
+		return item
+	}
+	for _, table := range []string{"request_log", "app_settings", "provider_blacklist", "conversation_log", "audit_log", "endpoint_latency", "batch_job", "batch_result", "embedding_cache", "request_feedback", "request_annotation", "request_rollup"} {
+		tableDB, dialect := db, storageDialect(sqliteDialect{})
+		if isSharedTable(table) {
+			tableDB, dialect = shared, sharedDialect()
+		}
+		exists, err := dialect.TableExists(tableDB, table)
+		if err != nil || !exists {
+			item.Status = StartupCheckError
+			item.Message = fmt.Sprintf("缺少数据表 %s，需要执行迁移", table)
+			item.Repair = StartupRepairRunMigration
+			return item
+		}
+	}
+	item.Message = "数据库正常"
+	if sharedStorageFallback != "" {
+		item.Status = StartupCheckWarn
+		item.Message = fmt.Sprintf("共享表未能使用 PostgreSQL（%s），已回退本机 SQLite，日志与黑名单不会与团队共享", sharedStorageFallback)
+	} else if sharedDialect().Name() == StorageBackendPostgres {
+		item.Message = "数据库正常（共享表使用 PostgreSQL）"
+	}
+	return item
+}
+
+// checkRelayPort 中继端口是否可用（中继启动前检查，被其他程序占用时提示更换端口）
+func (sc *StartupCheckService) checkRelayPort() StartupCheckItem {
+	item := StartupCheckItem{ID: "relay_port", Name: "中继端口", Status: StartupCheckOK}
+	relayAddr := sc.relay.Addr()
+	if sc.relay.started() {
+		// 中继已启动（前端手动重新检查时），端口由本程序占用
+		item.Message = fmt.Sprintf("中继正在监听 %s", relayAddr)
+		return item
+	}
+	addr := relayAddr
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		if sc.relay.started() {
+			// 自检与中继并行启动，检查期间中继已开始监听
+			item.Message = fmt.Sprintf("中继正在监听 %s", relayAddr)
+			return item
+		}
+		item.Status = StartupCheckError
+		item.Message = fmt.Sprintf("端口 %s 已被其他程序占用，中继无法启动", relayAddr)
+		item.Repair = StartupRepairPickPort
+		return item
+	}
+	listener.Close()
+	item.Message = fmt.Sprintf("端口 %s 可用", relayAddr)
+	return item
+}
+
+// checkRelayConfig 中继配置文件能否解析
+func (sc *StartupCheckService) checkRelayConfig() StartupCheckItem {
+	item := StartupCheckItem{ID: "relay_config", Name: "中继配置", Status: StartupCheckOK}
+	config, err := LoadRelayConfig()
+	if err != nil {
+		item.Status = StartupCheckError
+		item.Message = fmt.Sprintf("%v，将使用默认配置", err)
+		item.Repair = StartupRepairRecreateRelayConfig
+		return item
+	}
+	if err := validateRelayConfig(config); err != nil {
+		item.Status = StartupCheckWarn
+		item.Message = fmt.Sprintf("配置项无效: %v", err)
+		item.Repair = StartupRepairRecreateRelayConfig
+		return item
+	}
+	item.Message = "配置正常"
+	return item
+}
+
+// checkProviders provider 配置文件能否解析，已启用的 provider 配置是否有效
+func (sc *StartupCheckService) checkProviders(kind string) StartupCheckItem {
+	item := StartupCheckItem{ID: "providers_" + kind, Name: kind + " providers", Status: StartupCheckOK, Target: kind}
+	providers, err := sc.providerService.LoadProviders(kind)
+	if err != nil {
+		item.Status = StartupCheckError
+		item.Message = fmt.Sprintf("配置文件无法解析: %v", err)
+		item.Repair = StartupRepairRecreateProviders
+		return item
+	}
+
+	enabled, invalid := 0, 0
+	for _, p := range providers {
+		if !p.Enabled {
+			continue
+		}
+		enabled++
+		if p.APIURL == "" || p.APIKey == "" || len(p.ValidateConfiguration()) > 0 {
+			invalid++
+		}
+	}
+	switch {
+	case enabled == 0:
+		item.Status = StartupCheckWarn
+		item.Message = "没有已启用的 provider，请求将无法转发"
+	case invalid > 0:
+		item.Status = StartupCheckWarn
+		item.Message = fmt.Sprintf("%d 个已启用的 provider 配置不完整或无效，请在设置中检查", invalid)
+	default:
+		item.Message = fmt.Sprintf("%d 个 provider 已启用", enabled)
+	}
+	return item
+}
+
+// recreateProviders 备份损坏的 provider 配置并重建为空列表
+func (sc *StartupCheckService) recreateProviders(kind string) error {
+	path, err := providerFilePath(kind)
+	if err != nil {
+		return err
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		var envelope providerEnvelope
+		if len(data) > 0 && json.Unmarshal(data, &envelope) == nil {
+			return fmt.Errorf("%s 配置文件可以正常解析，无需重建", kind)
+		}
+	}
+	backup, err := CreateBackup(path)
+	if err != nil {
+		return err
+	}
+	if backup != "" {
+		log.Printf("已备份损坏的 provider 配置: %s", backup)
+	}
+	if err := AtomicWriteJSON(path, providerEnvelope{Providers: []Provider{}}); err != nil {
+		return err
+	}
+	recordConfigIntegrity(path)
+	refreshConfigSnapshot()
+	return nil
+}
+
+// recreateRelayConfig 备份中继配置并重建为默认值（保留端口设置以免客户端失联，管理员锁定的设置按策略取值）
+func recreateRelayConfig() error {
+	configPath, err := GetRelayConfigPath()
+	if err != nil {
+		return err
+	}
+	config := DefaultRelayConfig()
+	if existing, err := LoadRelayConfig(); err == nil {
+		config.ListenPort = existing.ListenPort
+	}
+	if err := currentPolicy().applyRelayConfig(config); err != nil {
+		return fmt.Errorf("应用管理员策略失败: %w", err)
+	}
+	backup, err := CreateBackup(configPath)
+	if err != nil {
+		return err
+	}
+	if backup != "" {
+		log.Printf("已备份中继配置: %s", backup)
+	}
+	return (&SettingsService{}).UpdateRelayConfig(config)
+}
+
+// pickRelayPort 从默认端口之后查找空闲端口并写入中继配置
+func pickRelayPort() error {
+	config, err := LoadRelayConfig()
+	if err != nil {
+		return fmt.Errorf("中继配置无法读取，请先修复中继配置: %w", err)
+	}
+	for port := defaultRelayPort + 1; port <= defaultRelayPort+100; port++ {
+		listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			continue
+		}
+		listener.Close()
+
+		config.ListenPort = port
+		if err := (&SettingsService{}).UpdateRelayConfig(config); err != nil {
+			return err
+		}
+		log.Printf("✅ 中继端口已改为 %d，重启应用后生效", port)
+		return nil
+	}
+	return fmt.Errorf("未找到可用端口（%d-%d）", defaultRelayPort+1, defaultRelayPort+100)
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestStartupCheckRepairs(t *testing.T) {
+	tests := []struct {
+		name       string
+		corrupt    func(t *testing.T, configDir string) (relayAddr string)
+		check      func(sc *StartupCheckService) StartupCheckItem
+		wantStatus string
+		wantRepair string
+		target     string
+		verify     func(t *testing.T, configDir string)
+	}{
+		{
+			name: "端口被占用",
+			corrupt: func(t *testing.T, configDir string) string {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { listener.Close() })
+				return ":" + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+			},
+			check:      (*StartupCheckService).checkRelayPort,
+			wantStatus: StartupCheckError,
+			wantRepair: StartupRepairPickPort,
+			verify: func(t *testing.T, configDir string) {
+				config, err := LoadRelayConfig()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if config.ListenPort <= defaultRelayPort || config.ListenPort > defaultRelayPort+100 {
+					t.Errorf("应改用默认端口之后的空闲端口，得到 %d", config.ListenPort)
+				}
+			},
+		},
+		{
+			name: "中继配置损坏",
+			corrupt: func(t *testing.T, configDir string) string {
+				writeStartupCheckFile(t, filepath.Join(configDir, "relay-config.json"), "{not json")
+				return ""
+			},
+			check:      (*StartupCheckService).checkRelayConfig,
+			wantStatus: StartupCheckError,
+			wantRepair: StartupRepairRecreateRelayConfig,
+			verify: func(t *testing.T, configDir string) {
+				if _, err := LoadRelayConfig(); err != nil {
+					t.Errorf("重建后的中继配置应可解析: %v", err)
+				}
+				if backups, _ := filepath.Glob(filepath.Join(configDir, "relay-config.json.bak.*")); len(backups) != 1 {
+					t.Errorf("应备份损坏的中继配置，得到 %v", backups)
+				}
+			},
+		},
+		{
+			name: "中继配置项无效",
+			corrupt: func(t *testing.T, configDir string) string {
+				writeStartupCheckFile(t, filepath.Join(configDir, "relay-config.json"), `{"listenPort":18234,"dedup":{"windowMs":-1}}`)
+				return ""
+			},
+			check:      (*StartupCheckService).checkRelayConfig,
+			wantStatus: StartupCheckWarn,
+			wantRepair: StartupRepairRecreateRelayConfig,
+			verify: func(t *testing.T, configDir string) {
+				config, err := LoadRelayConfig()
+				if err != nil || config.ListenPort != 18234 || config.Dedup.WindowMs < 0 {
+					t.Errorf("重建后应恢复默认值并保留端口: %+v, %v", config, err)
+				}
+			},
+		},
+		{
+			name: "provider 配置损坏",
+			corrupt: func(t *testing.T, configDir string) string {
+				writeStartupCheckFile(t, filepath.Join(configDir, "claude-code.json"), "[[[")
+				return ""
+			},
+			check:      func(sc *StartupCheckService) StartupCheckItem { return sc.checkProviders("claude") },
+			wantStatus: StartupCheckError,
+			wantRepair: StartupRepairRecreateProviders,
+			target:     "claude",
+			verify: func(t *testing.T, configDir string) {
+				providers, err := NewProviderService().LoadProviders("claude")
+				if err != nil || len(providers) != 0 {
+					t.Errorf("重建后应为空列表: %v, %v", providers, err)
+				}
+				if backups, _ := filepath.Glob(filepath.Join(configDir, "claude-code.json.bak.*")); len(backups) != 1 {
+					t.Errorf("应备份损坏的 provider 配置，得到 %v", backups)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			t.Setenv("USERPROFILE", home)
+			configDir := getConfigDir()
+			if err := os.MkdirAll(configDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			relayAddr := tt.corrupt(t, configDir)
+			if relayAddr == "" {
+				relayAddr = "127.0.0.1:0"
+			}
+			providerService := NewProviderService()
+			sc := NewStartupCheckService(providerService, NewProviderRelayService(providerService, nil, nil, nil, relayAddr))
+
+			item := tt.check(sc)
+			if item.Status != tt.wantStatus || item.Repair != tt.wantRepair {
+				t.Fatalf("自检结果 = (%s, %s)，期望 (%s, %s): %s", item.Status, item.Repair, tt.wantStatus, tt.wantRepair, item.Message)
+			}
+			if _, err := sc.RunRepair(item.Repair, tt.target); err != nil {
+				t.Fatalf("RunRepair(%s) 失败: %v", item.Repair, err)
+			}
+			tt.verify(t, configDir)
+		})
+	}
+}
+
+func TestRecreateProvidersRefusesValidFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "a", APIURL: "https://api.example.com", APIKey: "sk-a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewStartupCheckService(ps, nil).recreateProviders("claude"); err == nil {
+		t.Error("可以解析的配置不应被重建")
+	}
+}
+
+func TestRecreateRelayConfigRespectsLockedSettings(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	writeStartupCheckFile(t, filepath.Join(getConfigDir(), "relay-config.json"), "{not json")
+
+	currentPolicy()
+	originalPolicy := activePolicy.Load()
+	defer activePolicy.Store(originalPolicy)
+	activePolicy.Store(&policyState{policy: &Policy{failClosed: true}})
+
+	if err := recreateRelayConfig(); err == nil {
+		t.Error("策略锁定全部设置时不应绕过策略写入中继配置")
+	}
+}
+
+func writeStartupCheckFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
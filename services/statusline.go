@@ -0,0 +1,195 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 状态栏：应用定期把各平台当前 provider、健康状态与当日花费写入 ~/.code-switch/statusline.json，
+// shell 提示符、tmux 状态栏等通过 cmd/statusline 读取该文件输出一行文本，不需要访问数据库或中继；
+// IDE 插件也可以请求中继的 GET /statusline（仅限本机）。
+
+const (
+	statusLineFileName = "statusline.json"
+	statusLineInterval = 15 * time.Second
+	// statusLineStaleAfter 快照超过该时间未更新视为应用未运行
+	statusLineStaleAfter = 4 * statusLineInterval
+)
+
+// StatusLinePlatform 单个平台的状态
+type StatusLinePlatform struct {
+	Platform string `json:"platform"`
+	Provider string `json:"provider"` // 当前 provider，为空表示没有已启用的 provider
+	Health   string `json:"health"`   // 当前 provider 的健康标记（与编辑器接口相同）
+}
+
+// StatusLineSnapshot 状态快照
+type StatusLineSnapshot struct {
+	UpdatedAt     int64                `json:"updatedAt"` // 毫秒
+	Offline       bool                 `json:"offline"`
+	SpentTodayUSD float64              `json:"spentTodayUsd"`
+	Platforms     []StatusLinePlatform `json:"platforms"`
+}
+
+func statusLinePath() string {
+	return filepath.Join(getConfigDir(), statusLineFileName)
+}
+
+// LoadStatusLineSnapshot 读取最近一次写入的状态快照
+func LoadStatusLineSnapshot() (*StatusLineSnapshot, error) {
+	data, err := os.ReadFile(statusLinePath())
+	if err != nil {
+		return nil, err
+	}
+	var snapshot StatusLineSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// FormatStatusLine 生成一行状态文本，如 "claude:Anthropic ✓ codex:OpenRouter ⚠ $1.23"
+// 快照过期时只输出 "code-switch ⏸"；ascii 为 true 时不使用 Unicode 符号
+func FormatStatusLine(snapshot *StatusLineSnapshot, ascii bool, now time.Time) string {
+	if snapshot == nil || now.Sub(time.UnixMilli(snapshot.UpdatedAt)) > statusLineStaleAfter {
+		if ascii {
+			return "code-switch off"
+		}
+		return "code-switch ⏸"
+	}
+	parts := make([]string, 0, len(snapshot.Platforms)+2)
+	for _, platform := range snapshot.Platforms {
+		if platform.Provider == "" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%s %s", platform.Platform, platform.Provider, statusLineSymbol(platform.Health, ascii)))
+	}
+	parts = append(parts, fmt.Sprintf("$%.2f", snapshot.SpentTodayUSD))
+	if snapshot.Offline {
+		parts = append(parts, "offline")
+	}
+	return strings.Join(parts, " ")
+}
+
+func statusLineSymbol(health string, ascii bool) string {
+	symbols := map[string][2]string{
+		EditorHealthOK:           {"✓", "ok"},
+		EditorHealthIncident:     {"⚠", "!"},
+		EditorHealthBlacklisted:  {"✗", "x"},
+		EditorHealthAuthDisabled: {"✗", "x"},
+	}
+	symbol, ok := symbols[health]
+	if !ok {
+		symbol = [2]string{"?", "?"}
+	}
+	if ascii {
+		return symbol[1]
+	}
+	return symbol[0]
+}
+
+// statusLineSnapshot 由编辑器接口的状态生成快照
+func (prs *ProviderRelayService) statusLineSnapshot() StatusLineSnapshot {
+	state := prs.editorState()
+	snapshot := StatusLineSnapshot{UpdatedAt: time.Now().UnixMilli(), Offline: state.Offline, Platforms: []StatusLinePlatform{}}
+	for _, platform := range []string{"claude", "codex", "gemini"} {
+		platformState := state.Platforms[platform]
+		item := StatusLinePlatform{Platform: platform, Provider: platformState.Current}
+		for _, badge := range platformState.Providers {
+			if badge.Name == platformState.Current {
+				item.Health = badge.Health
+				break
+			}
+		}
+		snapshot.Platforms = append(snapshot.Platforms, item)
+	}
+	if prs.budget != nil {
+		if spent, err := prs.budget.spentToday(); err == nil {
+			snapshot.SpentTodayUSD = spent
+		}
+	}
+	return snapshot
+}
+
+// statusLineHandler GET /statusline：返回一行文本，?format=json 返回快照，?ascii=1 不使用 Unicode 符号
+func (prs *ProviderRelayService) statusLineHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentRelayConfig().StatusLine.Enabled {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "statusline disabled"})
+			return
+		}
+		if !isLoopbackRequest(c.Request) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "statusline is local only"})
+			return
+		}
+		snapshot, err := LoadStatusLineSnapshot()
+		if err != nil {
+			// 尚未写入快照（刚启用），直接生成一次
+			current := prs.statusLineSnapshot()
+			snapshot = &current
+		}
+		if c.Query("format") == "json" {
+			c.JSON(http.StatusOK, snapshot)
+			return
+		}
+		c.String(http.StatusOK, FormatStatusLine(snapshot, c.Query("ascii") == "1", time.Now())+"\n")
+	}
+}
+
+// StatusLineService 定期写入状态快照
+type StatusLineService struct {
+	relay *ProviderRelayService
+}
+
+// NewStatusLineService 创建状态栏快照服务
+func NewStatusLineService(relay *ProviderRelayService) *StatusLineService {
+	return &StatusLineService{relay: relay}
+}
+
+// Start 注册定期写入任务（未启用时不写入）
+func (ss *StatusLineService) Start() error {
+	scheduleJob(backgroundJob{
+		name:  "status_line",
+		title: "状态栏快照",
+		interval: func() time.Duration {
+			if !currentRelayConfig().StatusLine.Enabled {
+				return 0
+			}
+			return statusLineInterval
+		},
+		run: func() error {
+			if err := ss.writeSnapshot(); err != nil {
+				return fmt.Errorf("写入状态栏快照失败: %w", err)
+			}
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止定期写入并删除快照（避免状态栏显示过期的状态）
+func (ss *StatusLineService) Stop() error {
+	unscheduleJob("status_line")
+	_ = os.Remove(statusLinePath())
+	return nil
+}
+
+// GetStatusLine 获取当前的一行状态文本（供前端预览）
+func (ss *StatusLineService) GetStatusLine() string {
+	snapshot := ss.relay.statusLineSnapshot()
+	return FormatStatusLine(&snapshot, false, time.Now())
+}
+
+func (ss *StatusLineService) writeSnapshot() error {
+	if err := os.MkdirAll(getConfigDir(), 0o755); err != nil {
+		return err
+	}
+	return AtomicWriteJSON(statusLinePath(), ss.relay.statusLineSnapshot())
+}
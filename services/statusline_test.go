@@ -0,0 +1,59 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFormatStatusLine(t *testing.T) {
+	now := time.Now()
+	snapshot := &StatusLineSnapshot{
+		UpdatedAt:     now.UnixMilli(),
+		SpentTodayUSD: 1.234,
+		Platforms: []StatusLinePlatform{
+			{Platform: "claude", Provider: "Anthropic", Health: EditorHealthOK},
+			{Platform: "codex", Provider: "OpenRouter", Health: EditorHealthIncident},
+			{Platform: "gemini"},
+		},
+	}
+	if got, want := FormatStatusLine(snapshot, false, now), "claude:Anthropic ✓ codex:OpenRouter ⚠ $1.23"; got != want {
+		t.Errorf("FormatStatusLine() = %q, want %q", got, want)
+	}
+	if got, want := FormatStatusLine(snapshot, true, now), "claude:Anthropic ok codex:OpenRouter ! $1.23"; got != want {
+		t.Errorf("FormatStatusLine(ascii) = %q, want %q", got, want)
+	}
+
+	snapshot.Offline = true
+	if got, want := FormatStatusLine(snapshot, true, now), "claude:Anthropic ok codex:OpenRouter ! $1.23 offline"; got != want {
+		t.Errorf("FormatStatusLine(offline) = %q, want %q", got, want)
+	}
+	if got := FormatStatusLine(snapshot, false, now.Add(statusLineStaleAfter+time.Second)); got != "code-switch ⏸" {
+		t.Errorf("过期快照应显示未运行，实际为 %q", got)
+	}
+	if got := FormatStatusLine(nil, true, now); got != "code-switch off" {
+		t.Errorf("没有快照时应显示未运行，实际为 %q", got)
+	}
+}
+
+func TestStatusLineHandlerRejectsForwardedLoopback(t *testing.T) {
+	config := DefaultRelayConfig()
+	config.StatusLine.Enabled = true
+	writeTestRelayConfig(t, config)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/statusline", (&ProviderRelayService{}).statusLineHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/statusline", nil)
+	req.RemoteAddr = "192.168.1.20:50000"
+	req.Header.Set("X-Forwarded-For", "127.0.0.1")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("局域网主机伪造 X-Forwarded-For 应返回 403，得到 %d", recorder.Code)
+	}
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultStatusPages 各平台默认的官方状态页
+// Anthropic/OpenAI 使用 statuspage.io 的 summary.json；Google 没有 statuspage.io 页面，使用 Google Cloud 状态页的 incidents.json
+var defaultStatusPages = map[string]string{
+	"claude": "https://status.anthropic.com/api/v2/summary.json",
+	"codex":  "https://status.openai.com/api/v2/summary.json",
+	"gemini": "https://status.cloud.google.com/incidents.json",
+}
+
+// googleStatusProducts Google Cloud 状态页中与 Gemini 相关的产品（名称包含即匹配，不区分大小写）
+var googleStatusProducts = []string{"gemini", "vertex ai"}
+
+// UpstreamIncident 官方状态页上未结束的故障
+type UpstreamIncident struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Status     string   `json:"status"` // investigating / identified / monitoring ...
+	Impact     string   `json:"impact"` // none / minor / major / critical
+	URL        string   `json:"url,omitempty"`
+	StartedAt  int64    `json:"startedAt"` // 毫秒时间戳
+	Components []string `json:"components,omitempty"`
+}
+
+// UpstreamStatus 单个平台官方状态页的检查结果
+type UpstreamStatus struct {
+	Platform    string             `json:"platform"`
+	Page        string             `json:"page"`
+	Indicator   string             `json:"indicator"` // none / minor / major / critical，检查失败时为 unknown
+	Description string             `json:"description,omitempty"`
+	Incidents   []UpstreamIncident `json:"incidents"`
+	Error       string             `json:"error,omitempty"`
+	CheckedAt   int64              `json:"checkedAt"` // 毫秒时间戳
+}
+
+// StatusPageService 定期拉取上游官方状态页，在 provider 健康状态旁展示正在进行的故障
+type StatusPageService struct {
+	notificationService *NotificationService
+	client              *http.Client
+	mu                  sync.Mutex
+	results             map[string]UpstreamStatus // key: platform
+	alerted             map[string]bool           // 已通知的故障（platform/id），故障结束后移除
+}
+
+func NewStatusPageService(blacklistService *BlacklistService, notificationService *NotificationService) *StatusPageService {
+	sps := &StatusPageService{
+		notificationService: notificationService,
+		client:              &http.Client{Timeout: 15 * time.Second},
+		results:             make(map[string]UpstreamStatus),
+		alerted:             make(map[string]bool),
+	}
+	if blacklistService != nil {
+		blacklistService.upstreamIncident = sps.suppressEscalation
+	}
+	return sps
+}
+
+// Start 注册后台定时检查任务（间隔读取自 relay-config.json，未启用时不检查）
+func (sps *StatusPageService) Start() error {
+	scheduleJob(backgroundJob{
+		name:  "status_page",
+		title: "上游状态页检查",
+		delay: 30 * time.Second,
+		interval: func() time.Duration {
+			config := currentRelayConfig().StatusPage
+			if !config.Enabled {
+				return 0
+			}
+			interval := time.Duration(config.IntervalMinutes) * time.Minute
+			if interval < time.Minute {
+				interval = 5 * time.Minute
+			}
+			return interval
+		},
+		run: func() error {
+			sps.CheckStatusPages()
+			return nil
+		},
+	})
+	return nil
+}
+
+// Stop 停止后台检查
+func (sps *StatusPageService) Stop() error {
+	unscheduleJob("status_page")
+	return nil
+}
+
+// GetUpstreamStatus 获取最近一次检查结果（供前端调用）
+func (sps *StatusPageService) GetUpstreamStatus() []UpstreamStatus {
+	sps.mu.Lock()
+	defer sps.mu.Unlock()
+	results := make([]UpstreamStatus, 0, len(sps.results))
+	for _, result := range sps.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Platform < results[j].Platform })
+	return results
+}
+
+// CheckStatusPages 立即检查所有平台的状态页，对新出现的故障发送通知
+func (sps *StatusPageService) CheckStatusPages() []UpstreamStatus {
+	config := currentRelayConfig().StatusPage
+	results := make(map[string]UpstreamStatus)
+	for _, platform := range []string{"claude", "codex", "gemini"} {
+		page := statusPageURL(config, platform)
+		if page == "" {
+			continue
+		}
+		result := sps.fetchStatus(platform, page)
+		if result.Error != "" {
+			log.Printf("[StatusPage] 检查 %s 状态页失败: %v", platform, result.Error)
+		}
+		results[platform] = result
+	}
+
+	var newIncidents []UpstreamStatus
+	sps.mu.Lock()
+	for platform, result := range results {
+		// 检查失败时保留上一次的故障列表，避免网络抖动导致故障反复出现
+		if result.Error != "" {
+			if previous, ok := sps.results[platform]; ok {
+				result.Incidents = previous.Incidents
+			}
+			sps.results[platform] = result
+			continue
+		}
+		current := make(map[string]bool, len(result.Incidents))
+		var fresh []UpstreamIncident
+		for _, incident := range result.Incidents {
+			key := platform + "/" + incident.ID
+			current[key] = true
+			if !sps.alerted[key] {
+				sps.alerted[key] = true
+				fresh = append(fresh, incident)
+			}
+		}
+		for key := range sps.alerted {
+			if strings.HasPrefix(key, platform+"/") && !current[key] {
+				delete(sps.alerted, key)
+			}
+		}
+		if len(fresh) > 0 {
+			newIncidents = append(newIncidents, UpstreamStatus{Platform: platform, Incidents: fresh})
+		}
+		sps.results[platform] = result
+	}
+	sps.mu.Unlock()
+
+	if sps.notificationService != nil {
+		for _, status := range newIncidents {
+			for _, incident := range status.Incidents {
+				sps.notificationService.NotifyUpstreamIncident(status.Platform, incident)
+			}
+		}
+	}
+	return sps.GetUpstreamStatus()
+}
+
+// HasActiveIncident 平台的官方状态页上是否有影响服务的故障
+func (sps *StatusPageService) HasActiveIncident(platform string) bool {
+	sps.mu.Lock()
+	defer sps.mu.Unlock()
+	for _, incident := range sps.results[platform].Incidents {
+		if incident.Impact != "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// suppressEscalation 上游确认故障期间是否暂停拉黑升级（由配置开关控制）
+func (sps *StatusPageService) suppressEscalation(platform string) bool {
+	config := currentRelayConfig().StatusPage
+	return config.Enabled && config.SuppressEscalation && sps.HasActiveIncident(platform)
+}
+
+func (sps *StatusPageService) fetchStatus(platform, page string) UpstreamStatus {
+	result := UpstreamStatus{
+		Platform:  platform,
+		Page:      page,
+		Indicator: "unknown",
+		Incidents: []UpstreamIncident{},
+		CheckedAt: time.Now().UnixMilli(),
+	}
+	resp, err := sps.client.Get(page)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		return result
+	}
+	if err := parseStatusPage(body, time.Now(), &result); err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// parseStatusPage 解析状态页响应：对象为 statuspage.io summary.json，数组为 Google Cloud incidents.json
+func parseStatusPage(body []byte, now time.Time, result *UpstreamStatus) error {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return parseGoogleIncidents(trimmed, now, result)
+	}
+	return parseStatuspageSummary(trimmed, result)
+}
+
+// statuspageSummary statuspage.io /api/v2/summary.json 中用到的字段
+type statuspageSummary struct {
+	Status struct {
+		Indicator   string `json:"indicator"`
+		Description string `json:"description"`
+	} `json:"status"`
+	Incidents []struct {
+		ID         string    `json:"id"`
+		Name       string    `json:"name"`
+		Status     string    `json:"status"`
+		Impact     string    `json:"impact"`
+		Shortlink  string    `json:"shortlink"`
+		StartedAt  time.Time `json:"started_at"`
+		Components []struct {
+			Name string `json:"name"`
+		} `json:"components"`
+	} `json:"incidents"`
+}
+
+func parseStatuspageSummary(body []byte, result *UpstreamStatus) error {
+	var summary statuspageSummary
+	if err := json.Unmarshal(body, &summary); err != nil {
+		return fmt.Errorf("解析状态页失败: %w", err)
+	}
+	result.Indicator = summary.Status.Indicator
+	result.Description = summary.Status.Description
+	for _, item := range summary.Incidents {
+		// summary.json 只列出未结束的故障，这里再过滤一次已解决状态
+		if item.Status == "resolved" || item.Status == "postmortem" {
+			continue
+		}
+		incident := UpstreamIncident{
+			ID:     item.ID,
+			Name:   item.Name,
+			Status: item.Status,
+			Impact: item.Impact,
+			URL:    item.Shortlink,
+		}
+		if !item.StartedAt.IsZero() {
+			incident.StartedAt = item.StartedAt.UnixMilli()
+		}
+		for _, component := range item.Components {
+			incident.Components = append(incident.Components, component.Name)
+		}
+		result.Incidents = append(result.Incidents, incident)
+	}
+	return nil
+}
+
+// googleIncident Google Cloud incidents.json 中用到的字段
+type googleIncident struct {
+	ID               string    `json:"id"`
+	Description      string    `json:"external_desc"`
+	Begin            time.Time `json:"begin"`
+	End              string    `json:"end"`
+	Severity         string    `json:"severity"` // low / medium / high
+	URI              string    `json:"uri"`
+	AffectedProducts []struct {
+		Title string `json:"title"`
+	} `json:"affected_products"`
+	MostRecentUpdate struct {
+		Status string `json:"status"` // SERVICE_DISRUPTION / SERVICE_OUTAGE / AVAILABLE ...
+	} `json:"most_recent_update"`
+}
+
+func parseGoogleIncidents(body []byte, now time.Time, result *UpstreamStatus) error {
+	var items []googleIncident
+	if err := json.Unmarshal(body, &items); err != nil {
+		return fmt.Errorf("解析状态页失败: %w", err)
+	}
+	result.Indicator = "none"
+	for _, item := range items {
+		// incidents.json 包含历史故障，只保留未结束且已开始的
+		if item.End != "" || item.Begin.After(now) {
+			continue
+		}
+		var components []string
+		for _, product := range item.AffectedProducts {
+			title := strings.ToLower(product.Title)
+			for _, keyword := range googleStatusProducts {
+				if strings.Contains(title, keyword) {
+					components = append(components, product.Title)
+					break
+				}
+			}
+		}
+		if len(components) == 0 {
+			continue
+		}
+		impact := googleSeverityImpact(item.Severity)
+		result.Incidents = append(result.Incidents, UpstreamIncident{
+			ID:         item.ID,
+			Name:       item.Description,
+			Status:     strings.ToLower(item.MostRecentUpdate.Status),
+			Impact:     impact,
+			URL:        "https://status.cloud.google.com/" + strings.TrimPrefix(item.URI, "/"),
+			StartedAt:  item.Begin.UnixMilli(),
+			Components: components,
+		})
+		if impactRank(impact) > impactRank(result.Indicator) {
+			result.Indicator = impact
+		}
+	}
+	return nil
+}
+
+func googleSeverityImpact(severity string) string {
+	if strings.EqualFold(severity, "high") {
+		return "major"
+	}
+	return "minor"
+}
+
+func impactRank(impact string) int {
+	switch impact {
+	case "minor":
+		return 1
+	case "major":
+		return 2
+	case "critical":
+		return 3
+	}
+	return 0
+}
+
+// statusPageURL 平台使用的状态页地址：配置优先，"-" 表示不检查该平台
+func statusPageURL(config RelayStatusPageConfig, platform string) string {
+	if page, ok := config.Pages[platform]; ok {
+		if page == "-" {
+			return ""
+		}
+		if page != "" {
+			return page
+		}
+	}
+	return defaultStatusPages[platform]
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStatusPage(t *testing.T) {
+	summary := `{
+		"status": {"indicator": "major", "description": "Partial System Outage"},
+		"incidents": [
+			{"id": "abc", "name": "Elevated errors on Claude Opus", "status": "identified", "impact": "major",
+			 "shortlink": "https://stspg.io/abc", "started_at": "2025-03-01T02:00:00.000Z",
+			 "components": [{"name": "API"}]},
+			{"id": "old", "name": "Resolved", "status": "resolved", "impact": "minor"}
+		]
+	}`
+	var result UpstreamStatus
+	if err := parseStatusPage([]byte(summary), time.Now(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Indicator != "major" || len(result.Incidents) != 1 {
+		t.Fatalf("statuspage.io 解析结果 = %+v", result)
+	}
+	incident := result.Incidents[0]
+	if incident.ID != "abc" || incident.StartedAt != time.Date(2025, 3, 1, 2, 0, 0, 0, time.UTC).UnixMilli() || len(incident.Components) != 1 {
+		t.Errorf("incident = %+v", incident)
+	}
+
+	google := `[
+		{"id": "g1", "external_desc": "Gemini API errors", "begin": "2025-03-01T02:00:00+00:00", "end": "",
+		 "severity": "high", "uri": "incidents/g1", "affected_products": [{"title": "Vertex Gemini API"}],
+		 "most_recent_update": {"status": "SERVICE_OUTAGE"}},
+		{"id": "g2", "external_desc": "BigQuery slow", "begin": "2025-03-01T02:00:00+00:00",
+		 "severity": "high", "affected_products": [{"title": "BigQuery"}]},
+		{"id": "g3", "external_desc": "Gemini old", "begin": "2025-02-01T02:00:00+00:00", "end": "2025-02-01T05:00:00+00:00",
+		 "severity": "high", "affected_products": [{"title": "Gemini"}]}
+	]`
+	result = UpstreamStatus{}
+	if err := parseStatusPage([]byte(google), time.Date(2025, 3, 1, 3, 0, 0, 0, time.UTC), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Indicator != "major" || len(result.Incidents) != 1 || result.Incidents[0].ID != "g1" {
+		t.Fatalf("Google 解析结果 = %+v", result)
+	}
+	if result.Incidents[0].URL != "https://status.cloud.google.com/incidents/g1" {
+		t.Errorf("url = %s", result.Incidents[0].URL)
+	}
+}
+
+func TestStatusPageURL(t *testing.T) {
+	config := RelayStatusPageConfig{Pages: map[string]string{"codex": "-", "gemini": "https://example.com/summary.json"}}
+	if got := statusPageURL(config, "claude"); got != defaultStatusPages["claude"] {
+		t.Errorf("claude = %s", got)
+	}
+	if got := statusPageURL(config, "codex"); got != "" {
+		t.Errorf("\"-\" 应禁用检查: %s", got)
+	}
+	if got := statusPageURL(config, "gemini"); got != "https://example.com/summary.json" {
+		t.Errorf("gemini = %s", got)
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// postgresRebindDriverName 共享表连接使用的驱动名
+// 业务代码与 xdb 生成的查询均使用 ? 占位符，该驱动在发送到 PostgreSQL 前转换为 $1、$2…
+const postgresRebindDriverName = "codeswitch-postgres"
+
+func init() {
+	sql.Register(postgresRebindDriverName, postgresRebindDriver{})
+}
+
+// rebindPlaceholders 按顺序将 ? 替换为 $1、$2…（跳过字符串字面量与带引号的标识符中的 ?）
+func rebindPlaceholders(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '?':
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+type postgresRebindDriver struct{}
+
+func (postgresRebindDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := pq.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresRebindConn{Conn: conn}, nil
+}
+
+// postgresRebindConn 包装 pq 连接，在准备与执行语句前转换占位符
+type postgresRebindConn struct {
+	driver.Conn
+}
+
+func (c *postgresRebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebindPlaceholders(query))
+}
+
+func (c *postgresRebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, rebindPlaceholders(query))
+	}
+	return c.Prepare(query)
+}
+
+func (c *postgresRebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if queryer, ok := c.Conn.(driver.QueryerContext); ok {
+		return queryer.QueryContext(ctx, rebindPlaceholders(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *postgresRebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := c.Conn.(driver.ExecerContext); ok {
+		return execer.ExecContext(ctx, rebindPlaceholders(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *postgresRebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *postgresRebindConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import "testing"
+
+func TestRebindPlaceholders(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"SELECT * FROM t WHERE a = '?' AND b = ?", "SELECT * FROM t WHERE a = '?' AND b = $1"},
+		{`SELECT "?" FROM t WHERE a = ?`, `SELECT "?" FROM t WHERE a = $1`},
+		{"SELECT 1", "SELECT 1"},
+	}
+	for _, tt := range tests {
+		if got := rebindPlaceholders(tt.query); got != tt.want {
+			t.Errorf("rebindPlaceholders(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPostgresDialectDDL(t *testing.T) {
+	got := postgresDialect{}.DDL("CREATE TABLE x (id INTEGER PRIMARY KEY AUTOINCREMENT, cost REAL, created_at DATETIME)")
+	want := "CREATE TABLE x (id BIGSERIAL PRIMARY KEY, cost DOUBLE PRECISION, created_at TIMESTAMP)"
+	if got != want {
+		t.Errorf("DDL = %q, want %q", got, want)
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := map[string]string{
+		"postgres://user:secret@db:5432/codeswitch": "postgres://user:***@db:5432/codeswitch",
+		"postgres://user@db:5432/codeswitch":        "postgres://user@db:5432/codeswitch",
+		"host=db user=app password=secret":          "host=db user=app password=***",
+	}
+	for dsn, want := range tests {
+		if got := redactDSN(dsn); got != want {
+			t.Errorf("redactDSN(%q) = %q, want %q", dsn, got, want)
+		}
+	}
+}
+
+func TestInitSharedStorageRecordsFallback(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { sharedStorageFallback = "" })
+
+	initSharedStorage()
+	if sharedStorageFallback != "" {
+		t.Fatalf("未配置 PostgreSQL 时不应记录回退: %q", sharedStorageFallback)
+	}
+
+	path, _ := GetStorageConfigPath()
+	if err := AtomicWriteJSON(path, &StorageConfig{Backend: StorageBackendPostgres}); err != nil {
+		t.Fatal(err)
+	}
+	initSharedStorage()
+	if sharedDialect().Name() != StorageBackendSQLite || sharedStorageFallback == "" {
+		t.Fatalf("PostgreSQL 不可用时应回退 SQLite 并记录原因: %s, %q", sharedDialect().Name(), sharedStorageFallback)
+	}
+	status, err := (&SettingsService{}).GetStorageStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.FallbackReason != sharedStorageFallback {
+		t.Errorf("存储状态应返回回退原因: %+v", status)
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 中继自行生成的响应（试运行、模拟 provider），按各平台的响应格式返回，客户端可以照常解析。
+// 不统计 token 用量，usage 均为 0。
+
+// writeStubResponse 返回模拟响应；流式时每个片段一个增量事件，片段之间等待 chunkDelay，客户端断开时返回错误
+func writeStubResponse(c *gin.Context, kind, model string, chunks []string, stream bool, chunkDelay time.Duration) error {
+	id := fmt.Sprintf("stub_%d", time.Now().UnixNano())
+	if !stream || (kind == "gemini" && c.Query("alt") != "sse") {
+		response := stubResponseBody(kind, model, strings.Join(chunks, ""), id)
+		if stream {
+			// Gemini 未指定 alt=sse 的流式接口返回 JSON 数组
+			c.JSON(http.StatusOK, []any{response})
+			return nil
+		}
+		c.JSON(http.StatusOK, response)
+		return nil
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	for i, event := range stubResponseEvents(kind, model, chunks, id) {
+		if i > 0 && chunkDelay > 0 {
+			select {
+			case <-time.After(chunkDelay):
+			case <-c.Request.Context().Done():
+				return c.Request.Context().Err()
+			}
+		}
+		data, _ := json.Marshal(event.data)
+		if event.name != "" {
+			fmt.Fprintf(c.Writer, "event: %s\n", event.name)
+		}
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+	}
+	return nil
+}
+
+// stubResponseBody 非流式响应
+func stubResponseBody(kind, model, text, id string) gin.H {
+	switch kind {
+	case "codex":
+		return stubCodexResponse(model, text, id, "completed")
+	case "gemini":
+		return stubGeminiChunk(model, text, true)
+	default:
+		return gin.H{
+			"id":            "msg_" + id,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         model,
+			"content":       []gin.H{{"type": "text", "text": text}},
+			"stop_reason":   "end_turn",
+			"stop_sequence": nil,
+			"usage":         gin.H{"input_tokens": 0, "output_tokens": 0},
+		}
+	}
+}
+
+// stubCodexResponse Responses API 的响应对象
+func stubCodexResponse(model, text, id, status string) gin.H {
+	output := []gin.H{}
+	if status == "completed" {
+		output = append(output, stubCodexItem(text, id))
+	}
+	return gin.H{
+		"id":         "resp_" + id,
+		"object":     "response",
+		"created_at": time.Now().Unix(),
+		"status":     status,
+		"model":      model,
+		"output":     output,
+		"usage":      gin.H{"input_tokens": 0, "output_tokens": 0, "total_tokens": 0},
+	}
+}
+
+func stubCodexItem(text, id string) gin.H {
+	return gin.H{
+		"type":    "message",
+		"id":      "msg_" + id,
+		"status":  "completed",
+		"role":    "assistant",
+		"content": []gin.H{{"type": "output_text", "text": text, "annotations": []any{}}},
+	}
+}
+
+// stubGeminiChunk Gemini 响应（流式时每个片段一个，最后一个带 finishReason）
+func stubGeminiChunk(model, text string, last bool) gin.H {
+	candidate := gin.H{
+		"content": gin.H{"role": "model", "parts": []gin.H{{"text": text}}},
+		"index":   0,
+	}
+	if last {
+		candidate["finishReason"] = "STOP"
+	}
+	return gin.H{
+		"candidates":    []gin.H{candidate},
+		"usageMetadata": gin.H{"promptTokenCount": 0, "candidatesTokenCount": 0, "totalTokenCount": 0},
+		"modelVersion":  model,
+	}
+}
+
+type stubEvent struct {
+	name string // SSE 事件名，Gemini 为空
+	data gin.H
+}
+
+// stubResponseEvents 流式响应的事件序列
+func stubResponseEvents(kind, model string, chunks []string, id string) []stubEvent {
+	text := strings.Join(chunks, "")
+	var events []stubEvent
+	switch kind {
+	case "codex":
+		events = append(events, stubEvent{"response.created", gin.H{"type": "response.created", "response": stubCodexResponse(model, text, id, "in_progress")}})
+		for _, chunk := range chunks {
+			events = append(events, stubEvent{"response.output_text.delta", gin.H{"type": "response.output_text.delta", "item_id": "msg_" + id, "output_index": 0, "content_index": 0, "delta": chunk}})
+		}
+		events = append(events,
+			stubEvent{"response.output_item.done", gin.H{"type": "response.output_item.done", "output_index": 0, "item": stubCodexItem(text, id)}},
+			stubEvent{"response.completed", gin.H{"type": "response.completed", "response": stubCodexResponse(model, text, id, "completed")}},
+		)
+	case "gemini":
+		for i, chunk := range chunks {
+			events = append(events, stubEvent{"", stubGeminiChunk(model, chunk, i == len(chunks)-1)})
+		}
+	default:
+		events = append(events,
+			stubEvent{"message_start", gin.H{"type": "message_start", "message": gin.H{
+				"id": "msg_" + id, "type": "message", "role": "assistant", "model": model, "content": []any{},
+				"stop_reason": nil, "stop_sequence": nil, "usage": gin.H{"input_tokens": 0, "output_tokens": 0},
+			}}},
+			stubEvent{"content_block_start", gin.H{"type": "content_block_start", "index": 0, "content_block": gin.H{"type": "text", "text": ""}}},
+		)
+		for _, chunk := range chunks {
+			events = append(events, stubEvent{"content_block_delta", gin.H{"type": "content_block_delta", "index": 0, "delta": gin.H{"type": "text_delta", "text": chunk}}})
+		}
+		events = append(events,
+			stubEvent{"content_block_stop", gin.H{"type": "content_block_stop", "index": 0}},
+			stubEvent{"message_delta", gin.H{"type": "message_delta", "delta": gin.H{"stop_reason": "end_turn", "stop_sequence": nil}, "usage": gin.H{"output_tokens": 0}}},
+			stubEvent{"message_stop", gin.H{"type": "message_stop"}},
+		)
+	}
+	return events
+}
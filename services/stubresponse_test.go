@@ -0,0 +1,31 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStubResponseEvents(t *testing.T) {
+	claude := stubResponseEvents("claude", "claude-sonnet-4", []string{"o", "k"}, "1")
+	if claude[0].name != "message_start" || claude[len(claude)-1].name != "message_stop" {
+		t.Errorf("claude 流式事件应以 message_start 开始、message_stop 结束: %+v", claude)
+	}
+	if len(claude) != 7 {
+		t.Errorf("每个片段应有一个 content_block_delta，得到 %d 个事件", len(claude))
+	}
+
+	codex := stubResponseEvents("codex", "gpt-5", []string{"ok"}, "1")
+	last := codex[len(codex)-1]
+	if last.name != "response.completed" || last.data["response"].(gin.H)["status"] != "completed" {
+		t.Errorf("codex 流式事件应以 response.completed 结束: %+v", last)
+	}
+
+	gemini := stubResponseEvents("gemini", "gemini-2.5-pro", []string{"o", "k"}, "1")
+	if len(gemini) != 2 || gemini[0].name != "" {
+		t.Fatalf("gemini 每个片段一个不带事件名的 data: %+v", gemini)
+	}
+	if _, ok := gemini[1].data["candidates"].([]gin.H)[0]["finishReason"]; !ok {
+		t.Error("gemini 最后一个片段应带 finishReason")
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import "fmt"
+
+// 命令行（cmd/code-switch）的 list / switch 子命令，供 Raycast、Alfred 等启动器调用。
+// --json 输出的结构带有 version 字段，字段只增不改，便于工作流长期解析。
+
+// CommandOutputVersion --json 输出格式的版本
+const CommandOutputVersion = 1
+
+// CommandProvider list 输出中的 provider（不含 API Key）
+type CommandProvider struct {
+	Name    string `json:"name"`
+	APIURL  string `json:"apiUrl"`
+	Enabled bool   `json:"enabled"`
+	Level   int    `json:"level"`
+	Current bool   `json:"current"` // 当前 provider（优先级最高的已启用 provider）
+	HasKey  bool   `json:"hasKey"`
+}
+
+// CommandPlatform list 输出中的平台
+type CommandPlatform struct {
+	Platform  string            `json:"platform"`
+	Current   string            `json:"current"`
+	Providers []CommandProvider `json:"providers"`
+}
+
+// CommandListOutput list --json 的输出
+type CommandListOutput struct {
+	Version   int               `json:"version"`
+	OK        bool              `json:"ok"`
+	Error     string            `json:"error,omitempty"`
+	Platforms []CommandPlatform `json:"platforms"`
+}
+
+// CommandSwitchOutput switch --json 的输出
+type CommandSwitchOutput struct {
+	Version  int    `json:"version"`
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+	Platform string `json:"platform"`
+	Provider string `json:"provider"`
+}
+
+// commandPlatforms 命令行支持的平台
+var commandPlatforms = []string{"claude", "codex", "gemini"}
+
+// CommandListProviders 列出平台的 provider；platform 为空时列出全部平台
+func CommandListProviders(providerService *ProviderService, geminiService *GeminiService, platform string) (CommandListOutput, error) {
+	output := CommandListOutput{Version: CommandOutputVersion, OK: true, Platforms: []CommandPlatform{}}
+	platforms := commandPlatforms
+	if platform != "" {
+		if !isCommandPlatform(platform) {
+			return output, fmt.Errorf("无效的平台: %s（可选值: claude、codex、gemini）", platform)
+		}
+		platforms = []string{platform}
+	}
+
+	for _, name := range platforms {
+		item := CommandPlatform{Platform: name, Providers: []CommandProvider{}}
+		switch name {
+		case "claude", "codex":
+			providers, err := providerService.LoadProviders(name)
+			if err != nil {
+				return output, fmt.Errorf("读取 %s 供应商失败: %w", name, err)
+			}
+			for _, p := range providers {
+				item.Providers = append(item.Providers, CommandProvider{Name: p.Name, APIURL: p.APIURL, Enabled: p.Enabled, Level: p.Level, HasKey: p.APIKey != ""})
+			}
+		case "gemini":
+			if geminiService != nil {
+				for _, p := range geminiService.GetProviders() {
+					item.Providers = append(item.Providers, CommandProvider{Name: p.Name, APIURL: p.BaseURL, Enabled: p.Enabled, Level: p.Level, HasKey: p.APIKey != ""})
+				}
+			}
+		}
+		markCommandCurrent(&item)
+		output.Platforms = append(output.Platforms, item)
+	}
+	return output, nil
+}
+
+// markCommandCurrent 标记当前 provider：优先级最高（Level 最小）的已启用 provider，同级时取排在前面的
+func markCommandCurrent(item *CommandPlatform) {
+	current := -1
+	for i := range item.Providers {
+		p := &item.Providers[i]
+		if p.Level <= 0 {
+			p.Level = 1
+		}
+		if p.Enabled && (current < 0 || p.Level < item.Providers[current].Level) {
+			current = i
+		}
+	}
+	if current >= 0 {
+		item.Providers[current].Current = true
+		item.Current = item.Providers[current].Name
+	}
+}
+
+// CommandSwitchProvider 切换平台的 provider（与应用内切换相同，会触发已配置的 CLI 配置写入）
+func CommandSwitchProvider(providerService *ProviderService, geminiService *GeminiService, platform, name string) error {
+	switch platform {
+	case "claude", "codex":
+		return providerService.SwitchProvider(platform, name)
+	case "gemini":
+		return switchGeminiByName(geminiService, name)
+	default:
+		return fmt.Errorf("无效的平台: %s（可选值: claude、codex、gemini）", platform)
+	}
+}
+
+func isCommandPlatform(platform string) bool {
+	for _, p := range commandPlatforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
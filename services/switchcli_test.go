@@ -0,0 +1,25 @@
+package services
+
+import "testing"
+
+func TestMarkCommandCurrent(t *testing.T) {
+	item := CommandPlatform{Providers: []CommandProvider{
+		{Name: "disabled", Enabled: false, Level: 1},
+		{Name: "backup", Enabled: true, Level: 2},
+		{Name: "primary", Enabled: true},
+		{Name: "same-level", Enabled: true, Level: 1},
+	}}
+	markCommandCurrent(&item)
+	if item.Current != "primary" || !item.Providers[2].Current {
+		t.Errorf("current = %q, providers = %+v", item.Current, item.Providers)
+	}
+	if item.Providers[2].Level != 1 {
+		t.Error("未设置优先级时应按 1 输出")
+	}
+
+	empty := CommandPlatform{Providers: []CommandProvider{{Name: "off"}}}
+	markCommandCurrent(&empty)
+	if empty.Current != "" || empty.Providers[0].Current {
+		t.Error("没有已启用的 provider 时不应标记当前 provider")
+	}
+}
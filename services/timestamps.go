@@ -0,0 +1,296 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 数据库中的时间列统一以 UTC 秒级时间戳（epoch）存储，只在 API 边界转换为本地时间。
+// 早期版本混用 CURRENT_TIMESTAMP（UTC 文本）、本地时间文本与驱动序列化的 time.Time，
+// 按字符串比较时会随时区出错；启动时由 migrateEpochTimestamps 一次性转换旧数据。
+
+// epochColumn 需要转换为时间戳的时间列
+type epochColumn struct {
+	table  string
+	column string
+	// localText 旧数据中不带时区的文本是否按本地时间写入（否则为 CURRENT_TIMESTAMP 写入的 UTC）
+	localText bool
+}
+
+var epochColumns = []epochColumn{
+	{"request_log", "created_at", false},
+	{"conversation_log", "created_at", false},
+	{"audit_log", "created_at", false},
+	{"batch_job", "created_at", false},
+	{"batch_job", "updated_at", true},
+	{"request_feedback", "created_at", true},
+	{"endpoint_latency", "created_at", true},
+	{"embedding_cache", "created_at", true},
+	{"provider_blacklist", "blacklisted_at", true},
+	{"provider_blacklist", "blacklisted_until", true},
+	{"provider_blacklist", "last_failure_at", true},
+	{"provider_blacklist", "last_recovered_at", true},
+	{"provider_blacklist", "last_failure_window_start", true},
+}
+
+// epochMigratedKeyPrefix app_settings 中记录 SQLite 表已完成转换的标记，避免每次启动全表扫描
+const epochMigratedKeyPrefix = "epoch_timestamps:"
+
+// epochNow 当前时间的 UTC 秒级时间戳
+func epochNow() int64 {
+	return time.Now().Unix()
+}
+
+// epochTime 可为空的时间戳列，用法与 sql.NullTime 相同
+// 写入时转换为 UTC 秒级时间戳，读取时转换为本地时间
+type epochTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func newEpochTime(t time.Time) epochTime {
+	return epochTime{Time: t, Valid: !t.IsZero()}
+}
+
+// Scan 实现 sql.Scanner（兼容尚未迁移的旧格式）
+func (e *epochTime) Scan(value interface{}) error {
+	e.Time, e.Valid = time.Time{}, false
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case int64:
+		e.Time, e.Valid = time.Unix(v, 0), true
+	case float64:
+		e.Time, e.Valid = time.Unix(int64(v), 0), true
+	case time.Time:
+		e.Time, e.Valid = v.Local(), true
+	case []byte:
+		return e.Scan(string(v))
+	case string:
+		if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+			e.Time, e.Valid = time.Unix(sec, 0), true
+			return nil
+		}
+		t, ok := parseLegacyTimestamp(v, time.Local)
+		if !ok {
+			return fmt.Errorf("无法解析时间: %q", v)
+		}
+		e.Time, e.Valid = t.Local(), true
+	default:
+		return fmt.Errorf("不支持的时间类型: %T", value)
+	}
+	return nil
+}
+
+// Value 实现 driver.Valuer
+func (e epochTime) Value() (driver.Value, error) {
+	if !e.Valid {
+		return nil, nil
+	}
+	return e.Time.Unix(), nil
+}
+
+// Ptr 有效时返回时间指针，否则返回 nil
+func (e epochTime) Ptr() *time.Time {
+	if !e.Valid {
+		return nil
+	}
+	t := e.Time
+	return &t
+}
+
+// recordTime 读取 xdb 记录中的时间戳列（本地时间），为空时返回零值
+func recordTime(record xdb.Record, key string) time.Time {
+	value, _ := record.Get(key)
+	var e epochTime
+	if err := e.Scan(value); err != nil || !e.Valid {
+		return time.Time{}
+	}
+	return e.Time
+}
+
+// formatDBTime 将数据库返回的时间戳格式化为本地时间文本（API 返回格式），为空时返回空字符串
+func formatDBTime(value interface{}) string {
+	var t epochTime
+	if err := t.Scan(value); err != nil || !t.Valid {
+		return ""
+	}
+	return t.Time.Format(timeLayout)
+}
+
+// recordTimeString 读取 xdb 记录中的时间戳列并格式化为本地时间文本
+func recordTimeString(record xdb.Record, key string) string {
+	value, _ := record.Get(key)
+	return formatDBTime(value)
+}
+
+// legacyTimestampLayouts 旧数据可能出现的带时区格式
+var legacyTimestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST", // time.Time.String()（modernc 驱动默认写入格式）
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05 -0700",
+}
+
+// legacyLocalLayouts 旧数据中不带时区的格式
+var legacyLocalLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseLegacyTimestamp 解析迁移前的时间文本；不带时区的按 loc 解释
+func parseLegacyTimestamp(raw string, loc *time.Location) (time.Time, bool) {
+	raw = strings.TrimSpace(raw)
+	if idx := strings.Index(raw, " m="); idx > 0 {
+		raw = raw[:idx] // 去掉 time.Time.String() 附带的单调时钟读数
+	}
+	if raw == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range legacyTimestampLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, true
+		}
+	}
+	if strings.HasSuffix(raw, "Z") {
+		loc = time.UTC
+		raw = strings.TrimSuffix(raw, "Z")
+	}
+	for _, layout := range legacyLocalLayouts {
+		if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// migrateEpochTimestamps 将旧的时间文本转换为 UTC 时间戳（幂等，ensureSchema 末尾调用）
+func migrateEpochTimestamps() error {
+	local, err := xdb.DB("default")
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	for _, col := range epochColumns {
+		db, dialect := local, storageDialect(sqliteDialect{})
+		if isSharedTable(col.table) {
+			if db, err = sharedDB(); err != nil {
+				return fmt.Errorf("获取共享表数据库连接失败: %w", err)
+			}
+			dialect = sharedDialect()
+		}
+
+		markerKey := epochMigratedKeyPrefix + col.table + "." + col.column
+		if dialect.Name() == StorageBackendSQLite && epochMigrated(local, markerKey) {
+			continue
+		}
+		loc := time.UTC
+		if col.localText {
+			loc = time.Local
+		}
+		converted, err := dialect.ConvertEpochColumn(db, col.table, col.column, loc)
+		if err != nil {
+			return fmt.Errorf("转换 %s.%s 时间格式失败: %w", col.table, col.column, err)
+		}
+		if converted > 0 {
+			log.Printf("✅ 已将 %s.%s 的 %d 条记录转换为 UTC 时间戳", col.table, col.column, converted)
+		}
+		if dialect.Name() == StorageBackendSQLite {
+			if _, err := local.Exec(`INSERT OR REPLACE INTO app_settings (key, value) VALUES (?, ?)`, markerKey, "1"); err != nil {
+				return fmt.Errorf("记录时间格式迁移状态失败: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func epochMigrated(db *sql.DB, key string) bool {
+	var value string
+	return db.QueryRow(`SELECT value FROM app_settings WHERE key = ?`, key).Scan(&value) == nil && value == "1"
+}
+
+// convertSQLiteEpochColumn 逐行解析文本时间并改写为时间戳，无法解析的置空
+func convertSQLiteEpochColumn(db *sql.DB, table, column string, loc *time.Location) (int, error) {
+	// CAST 为 TEXT，避免驱动按 DATETIME 声明类型自动解析（无时区文本会被当作 UTC）
+	rows, err := db.Query(fmt.Sprintf(`SELECT rowid, CAST(%s AS TEXT) FROM %s WHERE typeof(%s) = 'text'`, column, table, column))
+	if err != nil {
+		return 0, err
+	}
+	type update struct {
+		rowid int64
+		value interface{}
+	}
+	var updates []update
+	for rows.Next() {
+		var rowid int64
+		var raw string
+		if err := rows.Scan(&rowid, &raw); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		var value interface{}
+		if sec, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64); err == nil {
+			value = sec
+		} else if t, ok := parseLegacyTimestamp(raw, loc); ok {
+			value = t.Unix()
+		} else {
+			log.Printf("⚠️  无法解析 %s.%s 的时间 %q，已置空", table, column, raw)
+		}
+		updates = append(updates, update{rowid, value})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(updates) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, table, column))
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, u := range updates {
+		if _, err := stmt.Exec(u.value, u.rowid); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+	return len(updates), tx.Commit()
+}
+
+// convertPostgresEpochColumn 将 TIMESTAMP 列改为 BIGINT
+// 旧数据为不带时区的 TIMESTAMP：UTC 写入的直接取 epoch，本地时间写入的按当前本地时区偏移修正
+func convertPostgresEpochColumn(db *sql.DB, table, column string, loc *time.Location) (int, error) {
+	var dataType string
+	err := db.QueryRow(`SELECT data_type FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2`, table, column).Scan(&dataType)
+	if err != nil {
+		return 0, err
+	}
+	if dataType == "bigint" || dataType == "integer" {
+		return 0, nil
+	}
+	_, offset := time.Now().In(loc).Zone()
+	_, err = db.Exec(fmt.Sprintf(
+		`ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT, ALTER COLUMN %s TYPE BIGINT USING (EXTRACT(EPOCH FROM %s)::BIGINT - %d)`,
+		table, column, column, column, offset))
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("✅ 已将 %s.%s 转换为 BIGINT 时间戳", table, column)
+	return 0, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLegacyTimestamp(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	want := time.Date(2025, 3, 1, 2, 0, 0, 0, time.UTC).Unix()
+	tests := []struct {
+		name string
+		raw  string
+		loc  *time.Location
+	}{
+		{"CURRENT_TIMESTAMP", "2025-03-01 02:00:00", time.UTC},
+		{"本地时间文本", "2025-03-01 10:00:00", shanghai},
+		{"time.Time.String", "2025-03-01 10:00:00.5 +0800 CST m=+12.345", time.UTC},
+		{"带偏移", "2025-03-01 10:00:00+08:00", time.UTC},
+		{"RFC3339", "2025-03-01T02:00:00Z", shanghai},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseLegacyTimestamp(tt.raw, tt.loc)
+			if !ok || got.Unix() != want {
+				t.Errorf("parseLegacyTimestamp(%q) = %v, %v; want unix %d", tt.raw, got, ok, want)
+			}
+		})
+	}
+	if _, ok := parseLegacyTimestamp("not a time", time.UTC); ok {
+		t.Error("无效文本应解析失败")
+	}
+}
+
+func TestEpochTimeScanValue(t *testing.T) {
+	var e epochTime
+	if err := e.Scan(int64(1740794400)); err != nil || !e.Valid || e.Time.Unix() != 1740794400 {
+		t.Fatalf("Scan(int64) = %+v, %v", e, err)
+	}
+	if v, _ := e.Value(); v != int64(1740794400) {
+		t.Errorf("Value() = %v", v)
+	}
+	if err := e.Scan(nil); err != nil || e.Valid {
+		t.Errorf("Scan(nil) = %+v, %v", e, err)
+	}
+	if v, _ := e.Value(); v != nil {
+		t.Errorf("无效值 Value() = %v", v)
+	}
+	if formatDBTime("garbage") != "" {
+		t.Error("无法解析的值应返回空字符串")
+	}
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// provider TLS 诊断：连接 provider 的 API 地址，报告协商的 TLS 版本、加密套件、证书链、到期时间与主机名是否匹配。
+// 握手时不做证书校验（以便在证书有问题时仍能拿到证书链），随后按系统根证书单独校验并给出原因。
+// 证书 14 天内到期时给出警告——镜像站常用短期证书且续期失败时没有任何提示。
+
+const (
+	// tlsExpiryWarnDays 证书剩余有效期少于该天数时警告
+	tlsExpiryWarnDays = 14
+	// tlsDiagnosticsTimeout 单个地址的连接与握手超时
+	tlsDiagnosticsTimeout = 10 * time.Second
+)
+
+// TLSCertificateInfo 证书链中的一张证书
+type TLSCertificateInfo struct {
+	Subject            string   `json:"subject"`
+	Issuer             string   `json:"issuer"`
+	DNSNames           []string `json:"dnsNames,omitempty"`
+	SerialNumber       string   `json:"serialNumber"`
+	SignatureAlgorithm string   `json:"signatureAlgorithm"`
+	NotBefore          int64    `json:"notBefore"` // 毫秒
+	NotAfter           int64    `json:"notAfter"`  // 毫秒
+	DaysLeft           int      `json:"daysLeft"`  // 剩余有效天数，已过期为负数
+	Pin                string   `json:"pin"`       // SPKI 指纹（可用于证书固定）
+	IsLeaf             bool     `json:"isLeaf"`
+	SelfSigned         bool     `json:"selfSigned"`
+}
+
+// ProviderTLSReport provider API 地址的 TLS 诊断结果
+type ProviderTLSReport struct {
+	Platform      string               `json:"platform"`
+	Providers     []string             `json:"providers"` // 使用该地址的 provider
+	URL           string               `json:"url"`
+	Host          string               `json:"host"`
+	SNI           string               `json:"sni,omitempty"`         // 握手时发送的服务器名称
+	TLSVersion    string               `json:"tlsVersion,omitempty"`  // 如 TLS 1.3
+	CipherSuite   string               `json:"cipherSuite,omitempty"` // 如 TLS_AES_128_GCM_SHA256
+	ALPN          string               `json:"alpn,omitempty"`        // 协商的应用层协议（h2 / http/1.1）
+	HandshakeMs   int64                `json:"handshakeMs,omitempty"`
+	Chain         []TLSCertificateInfo `json:"chain"`
+	Trusted       bool                 `json:"trusted"`               // 证书链能被系统根证书验证
+	HostnameMatch bool                 `json:"hostnameMatch"`         // 叶子证书包含该主机名
+	VerifyError   string               `json:"verifyError,omitempty"` // 证书校验失败的原因
+	ExpiresAt     int64                `json:"expiresAt,omitempty"`   // 叶子证书到期时间（毫秒）
+	DaysLeft      int                  `json:"daysLeft"`              // 叶子证书剩余有效天数
+	Warnings      []string             `json:"warnings"`              // 需要关注的问题
+	Error         string               `json:"error,omitempty"`       // 无法连接或握手失败
+	OK            bool                 `json:"ok"`                    // 握手成功、证书可信、主机名匹配且未临近到期
+	CheckedAt     int64                `json:"checkedAt"`             // 毫秒
+}
+
+// VerifyProvider 诊断 provider API 地址的 TLS 与证书（供前端调用）
+func (ps *ProviderService) VerifyProvider(kind string, name string) (*ProviderTLSReport, error) {
+	if !isCommandPlatform(kind) {
+		return nil, fmt.Errorf("无效的平台: %s", kind)
+	}
+	for url, names := range providerEndpointURLs(kind, name) {
+		report := diagnoseProviderTLS(url, nil, time.Now())
+		report.Platform = kind
+		report.Providers = names
+		return report, nil
+	}
+	return nil, fmt.Errorf("未找到名为 '%s' 的供应商或其没有 API 地址", name)
+}
+
+// VerifyAllProviders 并发诊断平台下所有 provider 的 TLS 与证书，相同地址只连接一次（供前端调用）
+func (ps *ProviderService) VerifyAllProviders(kind string) ([]ProviderTLSReport, error) {
+	if !isCommandPlatform(kind) {
+		return nil, fmt.Errorf("无效的平台: %s", kind)
+	}
+	byURL := providerEndpointURLs(kind, "")
+	reports := make([]ProviderTLSReport, 0, len(byURL))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for url, names := range byURL {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report := diagnoseProviderTLS(url, nil, time.Now())
+			report.Platform = kind
+			report.Providers = names
+			mu.Lock()
+			reports = append(reports, *report)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	// 有问题的地址在前
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].OK != reports[j].OK {
+			return !reports[i].OK
+		}
+		return reports[i].URL < reports[j].URL
+	})
+	return reports, nil
+}
+
+// diagnoseProviderTLS 连接地址并分析 TLS 握手结果；roots 为 nil 时使用系统根证书
+func diagnoseProviderTLS(rawURL string, roots *x509.CertPool, now time.Time) *ProviderTLSReport {
+	report := &ProviderTLSReport{URL: rawURL, Chain: []TLSCertificateInfo{}, Warnings: []string{}, CheckedAt: now.UnixMilli()}
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		report.Error = fmt.Sprintf("无效的地址: %s", rawURL)
+		return report
+	}
+	report.Host = parsed.Hostname()
+	if parsed.Scheme != "https" {
+		if isLocalEndpoint(rawURL) {
+			report.OK = true
+			report.Warnings = append(report.Warnings, "本机地址未使用 HTTPS，无需证书")
+		} else {
+			report.Error = "未使用 HTTPS，API Key 与对话内容以明文传输"
+		}
+		return report
+	}
+	if err := checkUpstreamURL(rawURL); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+	}
+	// IP 地址不发送 SNI
+	if net.ParseIP(report.Host) == nil {
+		report.SNI = report.Host
+	}
+	dialer := &net.Dialer{Timeout: tlsDiagnosticsTimeout}
+	start := time.Now()
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(report.Host, port), &tls.Config{
+		ServerName:         report.SNI,
+		InsecureSkipVerify: true, // 证书在下面单独校验，以便校验失败时仍能报告证书链
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		report.Error = fmt.Sprintf("TLS 握手失败: %v", err)
+		return report
+	}
+	defer conn.Close()
+	report.HandshakeMs = time.Since(start).Milliseconds()
+	analyzeTLSState(report, conn.ConnectionState(), roots, now)
+	return report
+}
+
+// analyzeTLSState 根据握手状态填写协议、证书链与校验结果
+func analyzeTLSState(report *ProviderTLSReport, state tls.ConnectionState, roots *x509.CertPool, now time.Time) {
+	report.TLSVersion = tls.VersionName(state.Version)
+	report.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	report.ALPN = state.NegotiatedProtocol
+	if state.Version < tls.VersionTLS12 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("协商的协议版本 %s 已不安全", report.TLSVersion))
+	}
+
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		report.VerifyError = "服务器没有返回证书"
+		return
+	}
+	for i, cert := range certs {
+		report.Chain = append(report.Chain, TLSCertificateInfo{
+			Subject:            cert.Subject.String(),
+			Issuer:             cert.Issuer.String(),
+			DNSNames:           cert.DNSNames,
+			SerialNumber:       cert.SerialNumber.Text(16),
+			SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+			NotBefore:          cert.NotBefore.UnixMilli(),
+			NotAfter:           cert.NotAfter.UnixMilli(),
+			DaysLeft:           certDaysLeft(cert, now),
+			Pin:                spkiPin(cert),
+			IsLeaf:             i == 0,
+			SelfSigned:         isSelfSigned(cert),
+		})
+	}
+
+	leaf := certs[0]
+	report.ExpiresAt = leaf.NotAfter.UnixMilli()
+	report.DaysLeft = certDaysLeft(leaf, now)
+	report.HostnameMatch = leaf.VerifyHostname(report.Host) == nil
+	if !report.HostnameMatch {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("证书不包含主机名 %s（证书适用于: %s）", report.Host, certNames(leaf)))
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	report.Trusted = err == nil
+	if err != nil {
+		report.VerifyError = describeCertError(err)
+	}
+
+	switch {
+	case now.After(leaf.NotAfter):
+		report.Warnings = append(report.Warnings, fmt.Sprintf("证书已于 %s 过期", leaf.NotAfter.Local().Format("2006-01-02")))
+	case leaf.NotAfter.Sub(now) < tlsExpiryWarnDays*24*time.Hour:
+		report.Warnings = append(report.Warnings, fmt.Sprintf("证书将于 %s 到期（剩余 %d 天）", leaf.NotAfter.Local().Format("2006-01-02"), report.DaysLeft))
+	}
+	for _, info := range report.Chain[1:] {
+		if info.DaysLeft < tlsExpiryWarnDays {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("中间证书 %s 剩余 %d 天", info.Subject, info.DaysLeft))
+		}
+	}
+
+	report.OK = report.Trusted && report.HostnameMatch && report.DaysLeft >= tlsExpiryWarnDays && state.Version >= tls.VersionTLS12
+}
+
+// certDaysLeft 证书剩余有效天数（向下取整）
+func certDaysLeft(cert *x509.Certificate, now time.Time) int {
+	return int(cert.NotAfter.Sub(now).Hours() / 24)
+}
+
+// isSelfSigned 证书是否由自身的私钥签发（不要求是 CA 证书）
+func isSelfSigned(cert *x509.Certificate) bool {
+	return cert.Subject.String() == cert.Issuer.String() &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// certNames 证书适用的主机名
+func certNames(cert *x509.Certificate) string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 {
+		return cert.Subject.CommonName
+	}
+	return strings.Join(names, ", ")
+}
+
+// describeCertError 证书校验失败的中文说明
+func describeCertError(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return "证书不是由受信任的机构签发（自签名证书或被中间人代理替换）"
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		return "证书已过期或尚未生效"
+	case errors.As(err, &hostname):
+		return "证书与主机名不匹配"
+	default:
+		return err.Error()
+	}
+}
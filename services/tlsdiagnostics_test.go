@@ -0,0 +1,78 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeTLSState(t *testing.T) {
+	now := time.Now()
+	cert := newTestCert(t, "api.example.com", now.Add(60*24*time.Hour))
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	state := tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+		PeerCertificates: []*x509.Certificate{cert},
+	}
+
+	report := &ProviderTLSReport{Host: "api.example.com"}
+	analyzeTLSState(report, state, roots, now)
+	if !report.OK || !report.Trusted || !report.HostnameMatch || len(report.Warnings) != 0 {
+		t.Fatalf("healthy certificate reported problems: %+v", report)
+	}
+	if report.TLSVersion != "TLS 1.3" || report.CipherSuite != "TLS_AES_128_GCM_SHA256" {
+		t.Fatalf("unexpected protocol: %s %s", report.TLSVersion, report.CipherSuite)
+	}
+	if len(report.Chain) != 1 || !report.Chain[0].IsLeaf || !report.Chain[0].SelfSigned || report.DaysLeft != 59 {
+		t.Fatalf("unexpected chain: %+v", report.Chain)
+	}
+
+	// 主机名不匹配
+	report = &ProviderTLSReport{Host: "mirror.example.org"}
+	analyzeTLSState(report, state, roots, now)
+	if report.OK || report.HostnameMatch || len(report.Warnings) == 0 || !strings.Contains(report.Warnings[0], "api.example.com") {
+		t.Fatalf("hostname mismatch not reported: %+v", report)
+	}
+
+	// 不受信任
+	report = &ProviderTLSReport{Host: "api.example.com"}
+	analyzeTLSState(report, state, x509.NewCertPool(), now)
+	if report.OK || report.Trusted || !strings.Contains(report.VerifyError, "受信任") {
+		t.Fatalf("untrusted certificate not reported: %+v", report)
+	}
+}
+
+func TestAnalyzeTLSStateExpiry(t *testing.T) {
+	now := time.Now()
+	cert := newTestCert(t, "api.example.com", now.Add(10*24*time.Hour))
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	state := tls.ConnectionState{Version: tls.VersionTLS12, PeerCertificates: []*x509.Certificate{cert}}
+
+	report := &ProviderTLSReport{Host: "api.example.com"}
+	analyzeTLSState(report, state, roots, now)
+	if report.OK || !report.Trusted || len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "剩余 9 天") {
+		t.Fatalf("expiry within %d days not reported: %+v", tlsExpiryWarnDays, report)
+	}
+
+	report = &ProviderTLSReport{Host: "api.example.com"}
+	analyzeTLSState(report, state, roots, now.Add(11*24*time.Hour))
+	if report.OK || report.Trusted || !strings.Contains(report.Warnings[0], "过期") {
+		t.Fatalf("expired certificate not reported: %+v", report)
+	}
+}
+
+func TestDiagnoseProviderTLSPlainHTTP(t *testing.T) {
+	report := diagnoseProviderTLS("http://api.example.com/v1", nil, time.Now())
+	if report.OK || !strings.Contains(report.Error, "HTTPS") {
+		t.Fatalf("plain http not reported: %+v", report)
+	}
+	report = diagnoseProviderTLS("http://127.0.0.1:8080", nil, time.Now())
+	if !report.OK || report.Error != "" {
+		t.Fatalf("local http should be allowed: %+v", report)
+	}
+}
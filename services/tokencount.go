@@ -0,0 +1,262 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// countTokensUnsupportedTTL provider 不支持 count_tokens 时，在此期间直接使用本地估算
+	countTokensUnsupportedTTL = time.Hour
+	// imageTokenEstimate 单张图片的估算 token 数（按 Claude 约 1.15 百万像素图片计）
+	imageTokenEstimate = 1600
+)
+
+// countTokensSupport 记录不支持 count_tokens 接口的 provider（内存中）
+type countTokensSupport struct {
+	mu          sync.Mutex
+	unsupported map[string]time.Time // key: provider 名称，value: 记录时间
+}
+
+var countTokensProviders = &countTokensSupport{unsupported: make(map[string]time.Time)}
+
+func (s *countTokensSupport) isUnsupported(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	markedAt, ok := s.unsupported[name]
+	if ok && time.Since(markedAt) >= countTokensUnsupportedTTL {
+		delete(s.unsupported, name)
+		return false
+	}
+	return ok
+}
+
+func (s *countTokensSupport) markUnsupported(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsupported[name] = time.Now()
+}
+
+// countTokensHandler 代理 Anthropic 的 /v1/messages/count_tokens
+// 依次尝试可用的 claude provider；都不支持或不可用时返回本地估算结果
+func (prs *ProviderRelayService) countTokensHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondRelayError(c, "claude", http.StatusBadRequest, "invalid request body", nil)
+			return
+		}
+		model := gjson.GetBytes(bodyBytes, "model").String()
+
+		providers, err := prs.countTokensCandidates(model)
+		if err != nil {
+			fmt.Printf("[WARN] count_tokens 加载 provider 失败，使用本地估算: %v\n", err)
+		}
+
+		clientHeaders := cloneHeaders(c.Request.Header)
+		stripRelayHeaders(clientHeaders)
+		client := &http.Client{Timeout: 30 * time.Second, CheckRedirect: checkUpstreamRedirect, Transport: relayTransport}
+		for _, provider := range providers {
+			status, respBody, err := forwardCountTokens(c, prs.withCertPins("claude", provider, client), provider, clientHeaders, model, bodyBytes)
+			switch {
+			case err != nil:
+				fmt.Printf("[WARN] count_tokens provider %s 失败: %v\n", provider.Name, err)
+				if c.Request.Context().Err() != nil {
+					return
+				}
+			case status >= 200 && status < 300:
+				c.Header("X-CodeSwitch-Token-Count", "upstream")
+				c.Data(status, "application/json", respBody)
+				return
+			case status == http.StatusNotFound || status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented:
+				fmt.Printf("[INFO] Provider %s 不支持 count_tokens，%s 内使用本地估算\n", provider.Name, countTokensUnsupportedTTL)
+				countTokensProviders.markUnsupported(provider.Name)
+			case status == http.StatusBadRequest:
+				// 请求本身有误，其他 provider 也会拒绝
+				c.Data(status, "application/json", respBody)
+				return
+			default:
+				fmt.Printf("[WARN] count_tokens provider %s 返回 %d\n", provider.Name, status)
+			}
+		}
+
+		c.Header("X-CodeSwitch-Token-Count", "estimated")
+		c.JSON(http.StatusOK, gin.H{"input_tokens": estimatePromptTokens(bodyBytes)})
+	}
+}
+
+// countTokensCandidates 按 Level 排序的可用 claude provider（跳过已知不支持 count_tokens 的）
+func (prs *ProviderRelayService) countTokensCandidates(model string) ([]Provider, error) {
+	providers, err := prs.providerService.snapshotProviders("claude")
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		if !p.Enabled || p.APIURL == "" || p.APIKey == "" || p.IsAuthDisabled() || checkUpstreamURL(p.APIURL) != nil {
+			continue
+		}
+		if model != "" && !p.IsModelSupported(model) {
+			continue
+		}
+		if blacklisted, _ := prs.blacklistService.IsBlacklisted("claude", p.Name); blacklisted {
+			continue
+		}
+		if prs.isOffline() && !isLocalEndpoint(p.APIURL) {
+			continue
+		}
+		if countTokensProviders.isUnsupported(p.Name) {
+			continue
+		}
+		candidates = append(candidates, p)
+	}
+	sortProvidersByLevel(candidates)
+	return candidates, nil
+}
+
+// forwardCountTokens 向单个 provider 转发 count_tokens 请求（不计入请求日志与拉黑统计）
+func forwardCountTokens(c *gin.Context, client *http.Client, provider Provider, clientHeaders map[string]string, model string, body []byte) (int, []byte, error) {
+	if effectiveModel := provider.GetEffectiveModel(model); model != "" && effectiveModel != model {
+		var err error
+		if body, err = ReplaceModelInRequestBody(body, effectiveModel); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, joinURL(provider.APIURL, "/v1/messages/count_tokens"), bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	for key, value := range clientHeaders {
+		switch http.CanonicalHeaderKey(key) {
+		case "Host", "Content-Length", "Accept-Encoding", "Connection":
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	if req.Header.Get("anthropic-version") == "" {
+		req.Header.Set("anthropic-version", anthropicAPIVersion)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// estimatePromptTokens 本地估算请求中的提示词 token 数（上游不提供计数接口时使用，也用于预算与请求体积护栏）
+// 按分词器的切分方式近似：短单词约 1 token，长单词约 4 字符 1 token，数字约 3 位 1 token，
+// 标点约 2 个 1 token，非 ASCII（如中文）约 1 字符 1 token；图片按固定数量计
+func estimatePromptTokens(bodyBytes []byte) int {
+	tokens := 0
+	var walk func(value gjson.Result)
+	walk = func(value gjson.Result) {
+		switch {
+		case value.IsObject():
+			switch value.Get("type").String() {
+			case "image", "input_image", "image_url":
+				tokens += imageTokenEstimate
+				return
+			}
+			if value.Get("inlineData").Exists() || value.Get("inline_data").Exists() {
+				tokens += imageTokenEstimate
+				return
+			}
+			value.ForEach(func(_, child gjson.Result) bool {
+				walk(child)
+				return true
+			})
+		case value.IsArray():
+			value.ForEach(func(_, child gjson.Result) bool {
+				walk(child)
+				return true
+			})
+		case value.Type == gjson.String:
+			tokens += estimateTextTokens(value.String())
+		}
+	}
+	walk(gjson.ParseBytes(bodyBytes))
+	return tokens
+}
+
+// estimateTextTokens 估算一段文本的 token 数
+func estimateTextTokens(s string) int {
+	const (
+		runNone = iota
+		runLetter
+		runDigit
+		runPunct
+	)
+	tokens, kind, length := 0, runNone, 0
+	flush := func() {
+		switch kind {
+		case runLetter:
+			if length <= 6 {
+				tokens++
+			} else {
+				tokens += (length + 3) / 4
+			}
+		case runDigit:
+			tokens += (length + 2) / 3
+		case runPunct:
+			tokens += (length + 1) / 2
+		}
+		kind, length = runNone, 0
+	}
+
+	for _, r := range s {
+		next := runNone
+		switch {
+		case r >= utf8.RuneSelf:
+			flush()
+			if !unicode.IsSpace(r) {
+				tokens++
+			}
+			continue
+		case unicode.IsSpace(r):
+			flush()
+			continue
+		case unicode.IsLetter(r):
+			next = runLetter
+		case unicode.IsDigit(r):
+			next = runDigit
+		default:
+			next = runPunct
+		}
+		if next != kind {
+			flush()
+			kind = next
+		}
+		length++
+	}
+	flush()
+	return tokens
+}
+
+// estimateRequestCost 按本地估算的输入 token 数计算本次请求的最低费用（美元），未知模型返回 0
+func estimateRequestCost(model string, bodyBytes []byte) float64 {
+	pricing, err := modelpricing.DefaultService()
+	if err != nil || model == "" {
+		return 0
+	}
+	return pricing.CalculateCost(model, modelpricing.UsageSnapshot{InputTokens: estimatePromptTokens(bodyBytes)}).TotalCost
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// 实时生成速度：转发流式响应时按增量文本估算已生成的 token 数，存在进行中的流时每 500ms 发送一次
+// relay:token_speed 事件（各流的 provider、模型与 tokens/s），供前端显示实时生成速度、及时发现被限速的镜像。
+// 没有进行中的流时不发送事件；流结束时以上游报告的输出 token 数发送最后一次采样。
+
+const tokenSpeedInterval = 500 * time.Millisecond
+
+// TokenSpeedSample 单个流式响应的生成速度
+type TokenSpeedSample struct {
+	ID                  int64   `json:"id"`
+	Platform            string  `json:"platform"`
+	Provider            string  `json:"provider"`
+	Model               string  `json:"model"`
+	Tokens              int     `json:"tokens"`              // 已生成的输出 token（进行中为估算值）
+	TokensPerSec        float64 `json:"tokensPerSec"`        // 首 token 以来的平均速度
+	CurrentTokensPerSec float64 `json:"currentTokensPerSec"` // 最近一个采样周期的速度
+	FirstTokenMs        int64   `json:"firstTokenMs"`        // 首 token 耗时，0 表示尚未收到
+	ElapsedMs           int64   `json:"elapsedMs"`
+	Done                bool    `json:"done"`
+}
+
+// streamSpeed 单个流式响应的生成进度
+type streamSpeed struct {
+	feed       *tokenSpeedFeed
+	id         int64
+	platform   string
+	provider   string
+	model      string
+	started    time.Time
+	firstToken time.Time
+	tokens     int
+	lastTokens int // 上次采样时的 token 数
+	lastAt     time.Time
+}
+
+// tokenSpeedFeed 进行中的流式响应，按固定间隔发送速度事件
+type tokenSpeedFeed struct {
+	mu       sync.Mutex
+	active   map[int64]*streamSpeed
+	finished []TokenSpeedSample // 上次发送后结束的流，随下一次事件发送
+	nextID   int64
+	running  bool
+	emit     func([]TokenSpeedSample)
+}
+
+func newTokenSpeedFeed(notificationService *NotificationService) *tokenSpeedFeed {
+	feed := &tokenSpeedFeed{active: make(map[int64]*streamSpeed)}
+	if notificationService != nil {
+		feed.emit = notificationService.EmitTokenSpeed
+	}
+	return feed
+}
+
+// begin 登记开始转发的流式响应（feed 为 nil 时返回 nil，后续调用均为空操作）
+func (f *tokenSpeedFeed) begin(platform, provider, model string) *streamSpeed {
+	if f == nil {
+		return nil
+	}
+	now := time.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	s := &streamSpeed{feed: f, id: f.nextID, platform: platform, provider: provider, model: model, started: now, lastAt: now}
+	f.active[s.id] = s
+	if !f.running && f.emit != nil {
+		f.running = true
+		go f.loop()
+	}
+	return s
+}
+
+// observe 累计一段 SSE 数据中的增量文本
+func (s *streamSpeed) observe(payload string) {
+	if s == nil {
+		return
+	}
+	tokens := 0
+	for _, line := range strings.Split(payload, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		for _, text := range streamDeltaText(s.platform, data) {
+			tokens += estimateTextTokens(text)
+		}
+	}
+	if tokens == 0 {
+		return
+	}
+	s.feed.mu.Lock()
+	if s.firstToken.IsZero() {
+		s.firstToken = time.Now()
+	}
+	s.tokens += tokens
+	s.feed.mu.Unlock()
+}
+
+// finish 流结束，outputTokens 为上游报告的输出 token 数（未报告时为 0，沿用估算值）
+func (s *streamSpeed) finish(outputTokens int) {
+	if s == nil {
+		return
+	}
+	f := s.feed
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.active[s.id]; !ok {
+		return
+	}
+	delete(f.active, s.id)
+	if outputTokens > 0 {
+		s.tokens = outputTokens
+	}
+	sample := s.sampleLocked(time.Now())
+	sample.Done = true
+	f.finished = append(f.finished, sample)
+}
+
+func (s *streamSpeed) sampleLocked(now time.Time) TokenSpeedSample {
+	sample := TokenSpeedSample{
+		ID:        s.id,
+		Platform:  s.platform,
+		Provider:  s.provider,
+		Model:     s.model,
+		Tokens:    s.tokens,
+		ElapsedMs: now.Sub(s.started).Milliseconds(),
+	}
+	if !s.firstToken.IsZero() {
+		sample.FirstTokenMs = s.firstToken.Sub(s.started).Milliseconds()
+		if generating := now.Sub(s.firstToken).Seconds(); generating > 0 {
+			sample.TokensPerSec = float64(s.tokens) / generating
+		}
+	}
+	if dt := now.Sub(s.lastAt).Seconds(); dt > 0 {
+		sample.CurrentTokensPerSec = float64(s.tokens-s.lastTokens) / dt
+	}
+	return sample
+}
+
+// snapshot 采样所有进行中的流，并取出上次发送后结束的流
+func (f *tokenSpeedFeed) snapshot(now time.Time, advance bool) []TokenSpeedSample {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	samples := make([]TokenSpeedSample, 0, len(f.active)+len(f.finished))
+	for _, s := range f.active {
+		samples = append(samples, s.sampleLocked(now))
+		if advance {
+			s.lastTokens, s.lastAt = s.tokens, now
+		}
+	}
+	if advance {
+		samples = append(samples, f.finished...)
+		f.finished = nil
+	}
+	return samples
+}
+
+func (f *tokenSpeedFeed) loop() {
+	ticker := time.NewTicker(tokenSpeedInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if samples := f.snapshot(time.Now(), true); len(samples) > 0 {
+			f.emit(samples)
+		}
+		f.mu.Lock()
+		if len(f.active) == 0 && len(f.finished) == 0 {
+			f.running = false
+			f.mu.Unlock()
+			return
+		}
+		f.mu.Unlock()
+	}
+}
+
+// streamDeltaText 流式事件中新生成的内容（正文、思考过程与工具调用参数都计入生成速度）
+func streamDeltaText(platform, data string) []string {
+	switch platform {
+	case "codex":
+		if strings.HasSuffix(gjson.Get(data, "type").String(), ".delta") {
+			return []string{gjson.Get(data, "delta").String()}
+		}
+	case "gemini":
+		var texts []string
+		for _, part := range gjson.Get(data, "candidates.0.content.parts").Array() {
+			if text := part.Get("text").String(); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		return texts
+	default:
+		if gjson.Get(data, "type").String() == "content_block_delta" {
+			delta := gjson.Get(data, "delta")
+			for _, field := range []string{"text", "thinking", "partial_json"} {
+				if text := delta.Get(field).String(); text != "" {
+					return []string{text}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// GetActiveStreams 获取进行中的流式响应的生成速度（供前端调用）
+func (prs *ProviderRelayService) GetActiveStreams() []TokenSpeedSample {
+	if prs.tokenSpeed == nil {
+		return []TokenSpeedSample{}
+	}
+	return prs.tokenSpeed.snapshot(time.Now(), false)
+}
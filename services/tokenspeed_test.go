@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenSpeedFeed(t *testing.T) {
+	feed := newTokenSpeedFeed(nil)
+	s := feed.begin("claude", "p1", "claude-sonnet")
+	s.observe("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"hello world\"}}\n\n")
+	s.observe("data: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"thinking_delta\",\"thinking\":\"let me think\"}}\n\n")
+	s.observe("data: {\"type\":\"message_stop\"}\n\n")
+
+	samples := feed.snapshot(time.Now().Add(time.Second), true)
+	if len(samples) != 1 || samples[0].Tokens == 0 || samples[0].Provider != "p1" || samples[0].FirstTokenMs < 0 {
+		t.Fatalf("进行中的流应估算已生成的 token: %+v", samples)
+	}
+	if samples[0].TokensPerSec <= 0 || samples[0].Done {
+		t.Errorf("应计算生成速度: %+v", samples[0])
+	}
+
+	s.finish(42)
+	s.finish(42)
+	samples = feed.snapshot(time.Now(), true)
+	if len(samples) != 1 || !samples[0].Done || samples[0].Tokens != 42 {
+		t.Fatalf("结束时应以上游报告的用量发送最后一次采样: %+v", samples)
+	}
+	if samples = feed.snapshot(time.Now(), true); len(samples) != 0 {
+		t.Errorf("结束的流只发送一次: %+v", samples)
+	}
+
+	var nilFeed *tokenSpeedFeed
+	nilFeed.begin("codex", "p", "m").observe("data: {}")
+}
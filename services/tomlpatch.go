@@ -0,0 +1,431 @@
+package services
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// patchTomlDocument 把修改前后两份解析结果的差异就地应用到 TOML 原文上：
+// 只替换、追加或删除变化的顶层键，以及 entryTables 指定的表（如 model_providers）下变化的条目，
+// 注释、空行与其余内容的顺序原样保留。
+// 遇到无法就地编辑的结构（条目写成内联表或点号键、多行取值、其他表被修改等）时返回 false，由调用方整体重写
+func patchTomlDocument(content []byte, before, after map[string]any, entryTables ...string) ([]byte, bool) {
+	newline := "\n"
+	text := string(content)
+	if strings.Contains(text, "\r\n") {
+		newline = "\r\n"
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	var lines []string
+	if text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	doc := scanTomlLines(lines)
+	isEntryTable := make(map[string]bool, len(entryTables))
+	for _, table := range entryTables {
+		isEntryTable[table] = true
+	}
+
+	var (
+		edits      []tomlEdit
+		topInserts []string
+	)
+	inserts := make(map[int][]string)
+	for _, key := range unionKeys(before, after) {
+		oldValue, hadOld := before[key]
+		newValue, hasNew := after[key]
+
+		if isEntryTable[key] {
+			oldEntries, ok1 := tomlEntries(oldValue)
+			newEntries, ok2 := tomlEntries(newValue)
+			if !ok1 || !ok2 {
+				return nil, false
+			}
+			for _, name := range unionKeys(oldEntries, newEntries) {
+				oldEntry, inOld := oldEntries[name]
+				newEntry, inNew := newEntries[name]
+				if inOld && inNew && reflect.DeepEqual(oldEntry, newEntry) {
+					continue
+				}
+				start, end, found, ok := doc.entryBlock(key, name)
+				if !ok || inOld != found {
+					return nil, false
+				}
+				if !inNew {
+					edits = append(edits, tomlEdit{start: doc.blankBefore(start), end: end})
+					continue
+				}
+				entry, isTable := tomlTable(newEntry)
+				if !isTable {
+					return nil, false
+				}
+				rendered, ok := renderTomlEntry(key, name, entry)
+				if !ok {
+					return nil, false
+				}
+				if found {
+					edits = append(edits, tomlEdit{start: start, end: end, lines: rendered})
+					continue
+				}
+				pos := doc.tableEnd(key)
+				if len(inserts[pos]) > 0 || (pos > 0 && strings.TrimSpace(lines[pos-1]) != "") {
+					rendered = append([]string{""}, rendered...)
+				}
+				inserts[pos] = append(inserts[pos], rendered...)
+			}
+			continue
+		}
+
+		if hadOld && hasNew && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if _, isTable := tomlTable(oldValue); isTable {
+			return nil, false
+		}
+		if _, isTable := tomlTable(newValue); isTable {
+			return nil, false
+		}
+		index := doc.topLevelKey(key)
+		if hadOld != (index >= 0) {
+			return nil, false
+		}
+		if !hasNew {
+			edits = append(edits, tomlEdit{start: index, end: index + 1})
+			continue
+		}
+		rendered, ok := renderTomlKey(key, newValue)
+		if !ok {
+			return nil, false
+		}
+		if index >= 0 {
+			edits = append(edits, tomlEdit{start: index, end: index + 1, lines: rendered})
+			continue
+		}
+		topInserts = append(topInserts, rendered...)
+	}
+
+	if len(topInserts) > 0 {
+		// 新的顶层键放在第一个表头之前，与后面的表之间留一个空行
+		pos := doc.topLevelEnd()
+		following := inserts[pos]
+		if (len(following) > 0 && following[0] != "") || (len(following) == 0 && pos == doc.firstHeader && pos < len(lines)) {
+			topInserts = append(topInserts, "")
+		}
+		inserts[pos] = append(topInserts, following...)
+	}
+	for pos, inserted := range inserts {
+		edits = append(edits, tomlEdit{start: pos, end: pos, lines: inserted})
+	}
+	// 从后往前应用，同一位置先替换再插入，保证插入内容位于替换内容之前
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start > edits[j].start
+		}
+		return edits[i].end-edits[i].start > edits[j].end-edits[j].start
+	})
+	for i := 1; i < len(edits); i++ {
+		if edits[i].end > edits[i-1].start {
+			return nil, false
+		}
+	}
+	for _, edit := range edits {
+		lines = append(lines[:edit.start], append(append([]string{}, edit.lines...), lines[edit.end:]...)...)
+	}
+	if len(lines) == 0 {
+		return []byte{}, true
+	}
+	return []byte(strings.Join(lines, newline) + newline), true
+}
+
+// tomlDocumentsEqual 比较两份解析结果（忽略空表，兼容 ensureTomlTable 转换后的类型）
+func tomlDocumentsEqual(a, b map[string]any) bool {
+	normalize := func(doc map[string]any) map[string]any {
+		out := make(map[string]any, len(doc))
+		for key, value := range doc {
+			value = normalizeTomlValue(value)
+			if table, ok := value.(map[string]any); ok && len(table) == 0 {
+				continue
+			}
+			out[key] = value
+		}
+		return out
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func normalizeTomlValue(value any) any {
+	switch v := value.(type) {
+	case map[string]map[string]any:
+		out := make(map[string]any, len(v))
+		for key, inner := range v {
+			out[key] = normalizeTomlValue(inner)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, inner := range v {
+			out[key] = normalizeTomlValue(inner)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+type tomlEdit struct {
+	start, end int // 替换 [start, end) 行，start == end 表示插入
+	lines      []string
+}
+
+type tomlHeader struct {
+	line  int
+	path  []string
+	array bool
+}
+
+// tomlLines 按行扫描的 TOML 原文：记录表头位置，以及位于多行字符串内部、不能当作键或表头的行
+type tomlLines struct {
+	lines       []string
+	headers     []tomlHeader
+	inString    []bool
+	firstHeader int
+}
+
+func scanTomlLines(lines []string) *tomlLines {
+	doc := &tomlLines{lines: lines, inString: make([]bool, len(lines)), firstHeader: len(lines)}
+	delim := ""
+	for i, line := range lines {
+		if delim != "" {
+			doc.inString[i] = true
+			if strings.Count(line, delim)%2 == 1 {
+				delim = ""
+			}
+			continue
+		}
+		for _, d := range []string{`"""`, `'''`} {
+			if strings.Count(line, d)%2 == 1 {
+				delim = d
+				break
+			}
+		}
+		if path, array, ok := parseTomlHeader(line); ok {
+			doc.headers = append(doc.headers, tomlHeader{line: i, path: path, array: array})
+			if doc.firstHeader == len(lines) {
+				doc.firstHeader = i
+			}
+		}
+	}
+	return doc
+}
+
+// blockEnd 表头 h 所在表的结束行（不含紧挨下一个表头的空行与注释，它们通常属于下一个表）
+func (d *tomlLines) blockEnd(h int) int {
+	end := len(d.lines)
+	if h+1 < len(d.headers) {
+		end = d.headers[h+1].line
+	}
+	for end > d.headers[h].line+1 && isTomlFiller(d.lines[end-1]) {
+		end--
+	}
+	return end
+}
+
+// entryBlock 定位 [table.name] 及其子表所在的行区间；子表不连续或为表数组时 ok 为 false
+func (d *tomlLines) entryBlock(table, name string) (start, end int, found, ok bool) {
+	first, last := -1, -1
+	for h, header := range d.headers {
+		if len(header.path) < 2 || header.path[0] != table || header.path[1] != name {
+			continue
+		}
+		if header.array || (last >= 0 && last != h-1) {
+			return 0, 0, false, false
+		}
+		if first < 0 {
+			first = h
+		}
+		last = h
+	}
+	if first < 0 {
+		return 0, 0, false, true
+	}
+	return d.headers[first].line, d.blockEnd(last), true, true
+}
+
+// tableEnd 表 table 最后一个子表之后的位置（用于追加新条目），文件中没有该表时返回文件末尾
+func (d *tomlLines) tableEnd(table string) int {
+	for h := len(d.headers) - 1; h >= 0; h-- {
+		if d.headers[h].path[0] == table {
+			return d.blockEnd(h)
+		}
+	}
+	end := len(d.lines)
+	for end > 0 && strings.TrimSpace(d.lines[end-1]) == "" {
+		end--
+	}
+	return end
+}
+
+// topLevelKey 查找第一个表头之前定义 key 的行：不存在时返回 -1，取值跨多行（无法按行编辑）时返回 -2
+func (d *tomlLines) topLevelKey(key string) int {
+	pattern := regexp.MustCompile(`^\s*(` + regexp.QuoteMeta(key) + `|"` + regexp.QuoteMeta(key) + `"|'` + regexp.QuoteMeta(key) + `')\s*=`)
+	for i := 0; i < d.firstHeader; i++ {
+		if d.inString[i] || !pattern.MatchString(d.lines[i]) {
+			continue
+		}
+		var single map[string]any
+		if toml.Unmarshal([]byte(d.lines[i]), &single) != nil {
+			return -2
+		}
+		return i
+	}
+	return -1
+}
+
+// topLevelEnd 第一个表头之前最后一个键之后的位置（用于追加新的顶层键）
+func (d *tomlLines) topLevelEnd() int {
+	for i := d.firstHeader - 1; i >= 0; i-- {
+		if !d.inString[i] && !isTomlFiller(d.lines[i]) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// blankBefore 删除区间时一并去掉前面的空行，避免留下多余空行
+func (d *tomlLines) blankBefore(start int) int {
+	for start > 0 && strings.TrimSpace(d.lines[start-1]) == "" {
+		start--
+	}
+	return start
+}
+
+func isTomlFiller(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+// parseTomlHeader 解析 [a.b] 或 [[a.b]] 表头，返回键路径
+func parseTomlHeader(line string) (path []string, array bool, ok bool) {
+	s := strings.TrimSpace(line)
+	if !strings.HasPrefix(s, "[") {
+		return nil, false, false
+	}
+	closing := "]"
+	if strings.HasPrefix(s, "[[") {
+		array, closing = true, "]]"
+		s = s[2:]
+	} else {
+		s = s[1:]
+	}
+	var segment strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\'':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				return nil, false, false
+			}
+			segment.WriteString(s[i+1 : i+1+j])
+			i += j + 1
+		case c == '.' || c == ']':
+			name := strings.TrimSpace(segment.String())
+			if name == "" {
+				return nil, false, false
+			}
+			path = append(path, name)
+			segment.Reset()
+			if c == ']' {
+				rest := s[i:]
+				if !strings.HasPrefix(rest, closing) {
+					return nil, false, false
+				}
+				rest = strings.TrimSpace(rest[len(closing):])
+				if rest != "" && !strings.HasPrefix(rest, "#") {
+					return nil, false, false
+				}
+				return path, array, true
+			}
+		case c == ' ' || c == '\t' || c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9'):
+			segment.WriteByte(c)
+		default:
+			return nil, false, false
+		}
+	}
+	return nil, false, false
+}
+
+// renderTomlEntry 生成 [table.name] 条目（含子表）的文本
+func renderTomlEntry(table, name string, entry map[string]any) ([]string, bool) {
+	data, err := toml.Marshal(map[string]any{table: map[string]any{name: entry}})
+	if err != nil {
+		return nil, false
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "["+table+"]" {
+		lines = lines[1:]
+	}
+	return lines, true
+}
+
+// renderTomlKey 生成单个顶层键的文本，取值会生成表头（表数组）时无法放在顶层
+func renderTomlKey(key string, value any) ([]string, bool) {
+	data, err := toml.Marshal(map[string]any{key: value})
+	if err != nil {
+		return nil, false
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for _, line := range lines {
+		if _, _, isHeader := parseTomlHeader(line); isHeader {
+			return nil, false
+		}
+	}
+	return lines, true
+}
+
+// tomlEntries 将表转为 条目名 -> 取值，缺失时为空表
+func tomlEntries(value any) (map[string]any, bool) {
+	switch v := value.(type) {
+	case nil:
+		return map[string]any{}, true
+	case map[string]any:
+		return v, true
+	case map[string]map[string]any:
+		out := make(map[string]any, len(v))
+		for key, inner := range v {
+			out[key] = inner
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+func tomlTable(value any) (map[string]any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		return v, true
+	case map[string]map[string]any:
+		entries, _ := tomlEntries(v)
+		return entries, true
+	default:
+		return nil, false
+	}
+}
+
+func unionKeys(a, b map[string]any) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// TranscriptModeHash 仅保存内容哈希（默认，保护隐私）
+	TranscriptModeHash = "hash"
+	// TranscriptModeFull 保存完整对话内容
+	TranscriptModeFull = "full"
+
+	// transcriptMaxContentBytes 单条对话内容最多保存的字节数
+	transcriptMaxContentBytes = 256 * 1024
+)
+
+// TranscriptEntry 一条对话记录
+type TranscriptEntry struct {
+	ID           int64   `json:"id"`
+	Platform     string  `json:"platform"`
+	SessionID    string  `json:"session_id"`
+	Role         string  `json:"role"` // user 或 assistant
+	Content      string  `json:"content"`
+	ContentHash  string  `json:"content_hash"`
+	Provider     string  `json:"provider"`
+	Model        string  `json:"model"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+// TranscriptSession 会话概要
+type TranscriptSession struct {
+	SessionID string  `json:"session_id"`
+	Platform  string  `json:"platform"`
+	Turns     int     `json:"turns"`
+	TotalCost float64 `json:"total_cost"`
+	FirstAt   string  `json:"first_at"`
+	LastAt    string  `json:"last_at"`
+}
+
+// transcriptRecorder 记录一次转发请求的对话回合（用户输入 + 模型回复）
+type transcriptRecorder struct {
+	platform  string
+	mode      string
+	sessionID string
+	userText  string
+	mu        sync.Mutex
+	reply     strings.Builder
+}
+
+// newTranscriptRecorder 根据中继配置创建记录器，未启用或无法解析用户输入时返回 nil
+func newTranscriptRecorder(platform string, bodyBytes []byte) *transcriptRecorder {
+	config := currentRelayConfig().Transcript
+	if !config.Enabled {
+		return nil
+	}
+	userText := extractLatestUserText(platform, bodyBytes)
+	if userText == "" {
+		return nil
+	}
+	return &transcriptRecorder{
+		platform:  platform,
+		mode:      config.normalizedMode(),
+		sessionID: extractTranscriptSessionID(platform, bodyBytes),
+		userText:  userText,
+	}
+}
+
+// observe 从响应数据（SSE 行或完整 JSON）中累计模型回复文本
+func (tr *transcriptRecorder) observe(payload string) {
+	if tr == nil {
+		return
+	}
+	payload = strings.TrimSpace(payload)
+	if payload == "" {
+		return
+	}
+
+	var texts []string
+	if strings.HasPrefix(payload, "{") {
+		texts = extractReplyText(tr.platform, payload)
+	} else {
+		for _, line := range strings.Split(payload, "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if data == "" || data == "[DONE]" {
+				continue
+			}
+			texts = append(texts, extractReplyText(tr.platform, data)...)
+		}
+	}
+
+	if len(texts) == 0 {
+		return
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for _, text := range texts {
+		if tr.reply.Len()+len(text) > transcriptMaxContentBytes {
+			return
+		}
+		tr.reply.WriteString(text)
+	}
+}
+
+// save 将对话回合写入 conversation_log（仅在请求成功时调用）
+func (tr *transcriptRecorder) save(requestLog *ReqeustLog) {
+	if tr == nil || requestLog == nil {
+		return
+	}
+	if GlobalDBQueueLogs == nil {
+		fmt.Printf("⚠️  写入 conversation_log 失败: 队列未初始化\n")
+		return
+	}
+
+	tr.mu.Lock()
+	reply := tr.reply.String()
+	tr.mu.Unlock()
+
+	cost := 0.0
+	if pricing, err := modelpricing.DefaultService(); err == nil {
+		cost = pricing.CalculateCost(requestLog.Model, modelpricing.UsageSnapshot{
+			InputTokens:       requestLog.InputTokens,
+			OutputTokens:      requestLog.OutputTokens,
+			ReasoningTokens:   requestLog.ReasoningTokens,
+			CacheCreateTokens: requestLog.CacheCreateTokens,
+			CacheReadTokens:   requestLog.CacheReadTokens,
+		}).TotalCost
+	}
+
+	turns := []struct {
+		role    string
+		content string
+	}{
+		{"user", tr.userText},
+		{"assistant", reply},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, turn := range turns {
+		if turn.content == "" {
+			continue
+		}
+		stored := ""
+		if tr.mode == TranscriptModeFull {
+			stored = maskForStorage(truncateTranscript(turn.content))
+		}
+		// 用量与费用记在回复行上，避免按会话汇总时重复计算
+		inputTokens, outputTokens, turnCost := 0, 0, 0.0
+		if turn.role == "assistant" {
+			inputTokens, outputTokens, turnCost = requestLog.InputTokens, requestLog.OutputTokens, cost
+		}
+		err := GlobalDBQueueLogs.ExecBatchCtx(ctx, `
+			INSERT INTO conversation_log (
+				platform, session_id, role, content, content_hash,
+				provider, model, input_tokens, output_tokens, cost, created_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			tr.platform,
+			tr.sessionID,
+			turn.role,
+			stored,
+			transcriptHash(turn.content),
+			requestLog.Provider,
+			requestLog.Model,
+			inputTokens,
+			outputTokens,
+			turnCost,
+			epochNow(),
+		)
+		if err != nil {
+			fmt.Printf("写入 conversation_log 失败: %v\n", err)
+			return
+		}
+	}
+}
+
+// normalizedMode 返回有效的隐私模式
+func (c RelayTranscriptConfig) normalizedMode() string {
+	if c.Mode == TranscriptModeFull {
+		return TranscriptModeFull
+	}
+	return TranscriptModeHash
+}
+
+// extractLatestUserText 提取请求中最后一条用户消息的文本
+func extractLatestUserText(platform string, bodyBytes []byte) string {
+	switch platform {
+	case "codex":
+		input := gjson.GetBytes(bodyBytes, "input")
+		if input.Type == gjson.String {
+			return input.String()
+		}
+		items := input.Array()
+		for i := len(items) - 1; i >= 0; i-- {
+			if items[i].Get("role").String() == "user" {
+				return joinTextParts(items[i].Get("content"), "text")
+			}
+		}
+	case "gemini":
+		contents := gjson.GetBytes(bodyBytes, "contents").Array()
+		for i := len(contents) - 1; i >= 0; i-- {
+			role := contents[i].Get("role").String()
+			if role == "" || role == "user" {
+				return joinTextParts(contents[i].Get("parts"), "text")
+			}
+		}
+	default:
+		messages := gjson.GetBytes(bodyBytes, "messages").Array()
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].Get("role").String() == "user" {
+				return joinTextParts(messages[i].Get("content"), "text")
+			}
+		}
+	}
+	return ""
+}
+
+// joinTextParts 拼接字符串或内容块数组中的文本（忽略工具调用等非文本块）
+func joinTextParts(content gjson.Result, field string) string {
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	var parts []string
+	for _, block := range content.Array() {
+		if text := block.Get(field); text.Exists() && text.String() != "" {
+			parts = append(parts, text.String())
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// extractTranscriptSessionID 识别请求所属会话
+// 优先使用客户端自带的会话标识，否则以首条用户消息的哈希归并同一会话
+func extractTranscriptSessionID(platform string, bodyBytes []byte) string {
+	switch platform {
+	case "claude":
+		if userID := gjson.GetBytes(bodyBytes, "metadata.user_id").String(); userID != "" {
+			if idx := strings.LastIndex(userID, "session_"); idx >= 0 {
+				return userID[idx+len("session_"):]
+			}
+		}
+	case "codex":
+		if key := gjson.GetBytes(bodyBytes, "prompt_cache_key").String(); key != "" {
+			return key
+		}
+	}
+
+	var first string
+	switch platform {
+	case "codex":
+		first = gjson.GetBytes(bodyBytes, "input.0").Raw
+	case "gemini":
+		first = gjson.GetBytes(bodyBytes, "contents.0").Raw
+	default:
+		first = gjson.GetBytes(bodyBytes, "messages.0").Raw
+	}
+	return transcriptHash(platform + "\n" + first)[:16]
+}
+
+// extractReplyText 从单个响应 JSON（流式事件或完整响应）中提取回复文本
+func extractReplyText(platform string, data string) []string {
+	var texts []string
+	switch platform {
+	case "codex":
+		if gjson.Get(data, "type").String() == "response.output_text.delta" {
+			return []string{gjson.Get(data, "delta").String()}
+		}
+		// 非流式响应
+		for _, item := range gjson.Get(data, "output").Array() {
+			for _, block := range item.Get("content").Array() {
+				if block.Get("type").String() == "output_text" {
+					texts = append(texts, block.Get("text").String())
+				}
+			}
+		}
+	case "gemini":
+		for _, part := range gjson.Get(data, "candidates.0.content.parts").Array() {
+			if part.Get("thought").Bool() {
+				continue
+			}
+			if text := part.Get("text").String(); text != "" {
+				texts = append(texts, text)
+			}
+		}
+	default:
+		if gjson.Get(data, "type").String() == "content_block_delta" {
+			if gjson.Get(data, "delta.type").String() == "text_delta" {
+				return []string{gjson.Get(data, "delta.text").String()}
+			}
+			return nil
+		}
+		// 非流式响应
+		if gjson.Get(data, "type").String() == "message" {
+			for _, block := range gjson.Get(data, "content").Array() {
+				if block.Get("type").String() == "text" {
+					texts = append(texts, block.Get("text").String())
+				}
+			}
+		}
+	}
+	return texts
+}
+
+func transcriptHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncateTranscript(content string) string {
+	if len(content) <= transcriptMaxContentBytes {
+		return content
+	}
+	return strings.ToValidUTF8(content[:transcriptMaxContentBytes], "")
+}
+
+// ensureTranscriptTable 确保 conversation_log 表存在
+func ensureTranscriptTable() error {
+	db, err := sharedDB()
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	const createTableSQL = `CREATE TABLE IF NOT EXISTS conversation_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		platform TEXT,
+		session_id TEXT,
+		role TEXT,
+		content TEXT,
+		content_hash TEXT,
+		provider TEXT,
+		model TEXT,
+		input_tokens INTEGER DEFAULT 0,
+		output_tokens INTEGER DEFAULT 0,
+		cost REAL DEFAULT 0,
+		created_at BIGINT
+	)`
+	if _, err := db.Exec(sharedDialect().DDL(createTableSQL)); err != nil {
+		return fmt.Errorf("创建 conversation_log 表失败: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_conversation_log_session ON conversation_log(session_id)`); err != nil {
+		return fmt.Errorf("创建 conversation_log 索引失败: %w", err)
+	}
+	return nil
+}
+
+// TranscriptService 对话历史查询服务
+type TranscriptService struct{}
+
+func NewTranscriptService() *TranscriptService {
+	return &TranscriptService{}
+}
+
+// SearchTranscripts 按关键词搜索历史对话（多个关键词以空格分隔，需全部命中）
+// 仅保存哈希的记录只能通过完整原文精确匹配
+func (ts *TranscriptService) SearchTranscripts(keyword string, platform string, limit int) ([]TranscriptEntry, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	keyword = strings.TrimSpace(keyword)
+	query := `SELECT id, platform, session_id, role, content, content_hash, provider, model,
+		input_tokens, output_tokens, cost, created_at FROM conversation_log WHERE 1=1`
+	args := []interface{}{}
+	if platform != "" {
+		query += ` AND platform = ?`
+		args = append(args, platform)
+	}
+	if keyword != "" {
+		terms := strings.Fields(keyword)
+		conds := make([]string, 0, len(terms))
+		for _, term := range terms {
+			conds = append(conds, `content LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+escapeLike(term)+"%")
+		}
+		query += ` AND ((` + strings.Join(conds, " AND ") + `) OR content_hash = ?)`
+		args = append(args, transcriptHash(keyword))
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	return queryTranscripts(query, args...)
+}
+
+// GetTranscriptSession 获取会话内的全部对话（按时间顺序）
+func (ts *TranscriptService) GetTranscriptSession(sessionID string) ([]TranscriptEntry, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("会话 ID 不能为空")
+	}
+	return queryTranscripts(`SELECT id, platform, session_id, role, content, content_hash, provider, model,
+		input_tokens, output_tokens, cost, created_at FROM conversation_log
+		WHERE session_id = ? ORDER BY id ASC`, sessionID)
+}
+
+// ListTranscriptSessions 列出最近的会话
+func (ts *TranscriptService) ListTranscriptSessions(platform string, limit int) ([]TranscriptSession, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	db, err := sharedDB()
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	query := `SELECT session_id, platform, SUM(CASE WHEN role = 'user' THEN 1 ELSE 0 END),
+		COALESCE(SUM(cost), 0), MIN(created_at), MAX(created_at)
+		FROM conversation_log`
+	args := []interface{}{}
+	if platform != "" {
+		query += ` WHERE platform = ?`
+		args = append(args, platform)
+	}
+	query += ` GROUP BY session_id, platform ORDER BY MAX(id) DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []TranscriptSession{}, nil
+		}
+		return nil, fmt.Errorf("查询会话失败: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]TranscriptSession, 0)
+	for rows.Next() {
+		var s TranscriptSession
+		var firstAt, lastAt interface{}
+		if err := rows.Scan(&s.SessionID, &s.Platform, &s.Turns, &s.TotalCost, &firstAt, &lastAt); err != nil {
+			return nil, fmt.Errorf("读取会话失败: %w", err)
+		}
+		s.FirstAt = formatDBTime(firstAt)
+		s.LastAt = formatDBTime(lastAt)
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// ClearTranscripts 清空全部对话历史
+func (ts *TranscriptService) ClearTranscripts() error {
+	if GlobalDBQueueShared == nil {
+		return fmt.Errorf("数据库队列未初始化")
+	}
+	return GlobalDBQueueShared.Exec(`DELETE FROM conversation_log`)
+}
+
+func queryTranscripts(query string, args ...interface{}) ([]TranscriptEntry, error) {
+	db, err := sharedDB()
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []TranscriptEntry{}, nil
+		}
+		return nil, fmt.Errorf("查询对话历史失败: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]TranscriptEntry, 0)
+	for rows.Next() {
+		var e TranscriptEntry
+		var createdAt interface{}
+		if err := rows.Scan(&e.ID, &e.Platform, &e.SessionID, &e.Role, &e.Content, &e.ContentHash,
+			&e.Provider, &e.Model, &e.InputTokens, &e.OutputTokens, &e.Cost, &createdAt); err != nil {
+			return nil, fmt.Errorf("读取对话历史失败: %w", err)
+		}
+		e.CreatedAt = formatDBTime(createdAt)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `%`, `\%`)
+	return strings.ReplaceAll(s, `_`, `\_`)
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// newTestDatabase 在当前 HOME 下初始化数据库与写入队列，测试结束后关闭
+func newTestDatabase(t *testing.T) {
+	t.Helper()
+	if err := InitDatabase(); err != nil {
+		t.Fatalf("InitDatabase() 失败: %v", err)
+	}
+	if err := InitGlobalDBQueue(); err != nil {
+		t.Fatalf("InitGlobalDBQueue() 失败: %v", err)
+	}
+	t.Cleanup(func() {
+		ShutdownGlobalDBQueue(5 * time.Second)
+		GlobalDBQueue, GlobalDBQueueLogs, GlobalDBQueueShared = nil, nil, nil
+		if db, err := xdb.DB("default"); err == nil {
+			db.Close()
+		}
+	})
+}
+
+func TestTranscriptRecorderSave(t *testing.T) {
+	const prompt = "如何配置 100% 的流量"
+	body := []byte(`{"model":"claude-sonnet-4","metadata":{"user_id":"user_x_session_abc"},"messages":[{"role":"user","content":"` + prompt + `"}]}`)
+	stream := "data: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"改成\"}}\n" +
+		"data: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{}\"}}\n" +
+		"data: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"默认值\"}}\n"
+
+	tests := []struct {
+		name        string
+		transcript  RelayTranscriptConfig
+		wantSaved   bool
+		wantContent bool
+	}{
+		{name: "未启用", transcript: RelayTranscriptConfig{Enabled: false}},
+		{name: "仅保存哈希", transcript: RelayTranscriptConfig{Enabled: true, Mode: TranscriptModeHash}, wantSaved: true},
+		{name: "未知模式按哈希处理", transcript: RelayTranscriptConfig{Enabled: true, Mode: "raw"}, wantSaved: true},
+		{name: "保存完整内容", transcript: RelayTranscriptConfig{Enabled: true, Mode: TranscriptModeFull}, wantSaved: true, wantContent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultRelayConfig()
+			config.Transcript = tt.transcript
+			writeTestRelayConfig(t, config)
+			newTestDatabase(t)
+
+			recorder := newTranscriptRecorder("claude", body)
+			if (recorder != nil) != tt.wantSaved {
+				t.Fatalf("newTranscriptRecorder() = %v，期望创建 = %v", recorder, tt.wantSaved)
+			}
+			recorder.observe(stream)
+			recorder.save(&ReqeustLog{Provider: "p", Model: "claude-sonnet-4", InputTokens: 10, OutputTokens: 5})
+			if !tt.wantSaved {
+				return
+			}
+
+			entries, err := NewTranscriptService().GetTranscriptSession("abc")
+			if err != nil || len(entries) != 2 {
+				t.Fatalf("会话应包含用户与回复两条记录: %+v, %v", entries, err)
+			}
+			user, reply := entries[0], entries[1]
+			if user.Role != "user" || user.ContentHash != transcriptHash(prompt) || reply.ContentHash != transcriptHash("改成默认值") {
+				t.Errorf("哈希不符: %+v / %+v", user, reply)
+			}
+			if user.InputTokens != 0 || reply.InputTokens != 10 || reply.OutputTokens != 5 {
+				t.Errorf("用量应只记在回复行上: %+v / %+v", user, reply)
+			}
+			wantUser, wantReply := "", ""
+			if tt.wantContent {
+				wantUser, wantReply = prompt, "改成默认值"
+			}
+			if user.Content != wantUser || reply.Content != wantReply {
+				t.Errorf("内容 = (%q, %q)，期望 (%q, %q)", user.Content, reply.Content, wantUser, wantReply)
+			}
+
+			// 仅保存哈希时只能通过完整原文精确匹配
+			found, err := NewTranscriptService().SearchTranscripts(prompt, "claude", 0)
+			if err != nil || len(found) != 1 || found[0].Role != "user" {
+				t.Errorf("完整原文应命中用户记录: %+v, %v", found, err)
+			}
+			found, err = NewTranscriptService().SearchTranscripts("流量", "", 0)
+			if err != nil || (len(found) == 1) != tt.wantContent {
+				t.Errorf("部分关键词命中 %d 条 (%v)，保存完整内容 = %v", len(found), err, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestSearchTranscriptsEscapesLikeWildcards(t *testing.T) {
+	writeTestRelayConfig(t, DefaultRelayConfig())
+	newTestDatabase(t)
+	db, err := sharedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"100% done", "100 percent", "a_b", "axb", `C:\temp`} {
+		if _, err := db.Exec(`INSERT INTO conversation_log (platform, session_id, role, content, content_hash, provider, model, created_at) VALUES ('claude', 's', 'user', ?, ?, 'p', 'm', ?)`,
+			content, transcriptHash(content), epochNow()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		keyword string
+		want    []string
+	}{
+		{"100%", []string{"100% done"}},
+		{"a_b", []string{"a_b"}},
+		{"%", []string{"100% done"}},
+		{"_", []string{"a_b"}},
+		{`\temp`, []string{`C:\temp`}},
+		{"100 done", []string{"100% done"}}, // 多个关键词需全部命中
+	}
+	for _, tt := range tests {
+		entries, err := NewTranscriptService().SearchTranscripts(tt.keyword, "", 0)
+		if err != nil {
+			t.Fatalf("SearchTranscripts(%q) 失败: %v", tt.keyword, err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Content)
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("SearchTranscripts(%q) = %q，期望 %q", tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func TestEnforcePolicyRetentionPrunesTranscripts(t *testing.T) {
+	writeTestRelayConfig(t, DefaultRelayConfig())
+	newTestDatabase(t)
+	currentPolicy()
+	originalPolicy := activePolicy.Load()
+	defer activePolicy.Store(originalPolicy)
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	db, err := sharedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []struct {
+		session string
+		at      time.Time
+	}{
+		{"expired", now.AddDate(0, 0, -8)},
+		{"boundary", startOfDay(now).AddDate(0, 0, -7)}, // 恰好在保留期限起点，保留
+		{"recent", now.Add(-time.Hour)},
+	} {
+		if _, err := db.Exec(`INSERT INTO conversation_log (platform, session_id, role, content_hash, created_at) VALUES ('claude', ?, 'user', 'h', ?)`,
+			row.session, row.at.Unix()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 未设置保留期限时不清理
+	activePolicy.Store(&policyState{policy: &Policy{}})
+	if n, err := enforcePolicyRetention(now); err != nil || n != 0 {
+		t.Fatalf("未设置保留期限不应清理: %d, %v", n, err)
+	}
+
+	activePolicy.Store(&policyState{policy: &Policy{MaxRetentionDays: 7}})
+	if n, err := enforcePolicyRetention(now); err != nil || n != 1 {
+		t.Fatalf("应清理 1 条过期记录: %d, %v", n, err)
+	}
+	sessions, err := NewTranscriptService().ListTranscriptSessions("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range sessions {
+		got = append(got, s.SessionID)
+	}
+	if len(got) != 2 || got[0] != "recent" || got[1] != "boundary" {
+		t.Errorf("剩余会话 = %v，期望 [recent boundary]", got)
+	}
+}
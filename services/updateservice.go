@@ -76,13 +76,8 @@ type GitHubRelease struct {
 
 // NewUpdateService 创建更新服务
 func NewUpdateService(currentVersion string) *UpdateService {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		home = "."
-	}
-
-	updateDir := filepath.Join(home, ".code-switch", "updates")
-	stateFile := filepath.Join(home, ".code-switch", "update-state.json")
+	updateDir := filepath.Join(getConfigDir(), "updates")
+	stateFile := filepath.Join(getConfigDir(), "update-state.json")
 
 	us := &UpdateService{
 		currentVersion:   currentVersion,
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// provider 级上游代理：部分镜像必须经指定跳板机访问。
+// 配置后中继转发、连通性测试与测速都通过该代理连接 provider，优先于系统代理环境变量。
+// 支持 http、https、socks5、socks5h（socks5 同样由代理端解析域名），用户名密码写在 URL 中。
+
+// providerNetwork provider 的出站网络配置
+type providerNetwork struct {
+	BindAddress string
+	Proxy       string
+}
+
+func (n providerNetwork) isZero() bool {
+	return n.BindAddress == "" && n.Proxy == ""
+}
+
+// key 用于按相同网络配置复用客户端
+func (n providerNetwork) key() string {
+	return n.BindAddress + "|" + n.Proxy
+}
+
+func (p Provider) network() providerNetwork {
+	return providerNetwork{BindAddress: p.BindAddress, Proxy: p.Proxy}
+}
+
+func (p GeminiProvider) network() providerNetwork {
+	return providerNetwork{BindAddress: p.BindAddress, Proxy: p.Proxy}
+}
+
+// validateUpstreamProxy 校验上游代理地址
+func validateUpstreamProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	parsed, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("无效的上游代理地址")
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("上游代理只支持 http、https、socks5、socks5h: %s", parsed.Redacted())
+	}
+	if parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" {
+		return fmt.Errorf("无效的上游代理地址: %s（格式应为 scheme://[user:pass@]host:port）", parsed.Redacted())
+	}
+	return nil
+}
+
+// applyUpstreamProxy 为客户端设置上游代理（proxy 为空时不做修改）
+// 地址无效时请求直接失败，而不是绕过代理直连
+func applyUpstreamProxy(client *http.Client, proxy string) {
+	if proxy == "" {
+		return
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport == nil {
+		transport = newRelayTransport()
+		client.Transport = transport
+	}
+	if err := validateUpstreamProxy(proxy); err != nil {
+		transport.Proxy = func(*http.Request) (*url.URL, error) { return nil, err }
+		return
+	}
+	parsed, _ := url.Parse(proxy)
+	transport.Proxy = http.ProxyURL(parsed)
+}
+
+// applyProviderNetwork 按出站绑定与上游代理配置客户端（经代理时绑定作用于到代理的连接）
+func applyProviderNetwork(client *http.Client, network providerNetwork) {
+	applyOutboundBinding(client, network.BindAddress)
+	applyUpstreamProxy(client, network.Proxy)
+}
+
+// withProviderNetwork 有出站网络配置时复制 base（连同 Transport）后应用，否则直接返回 base
+func withProviderNetwork(base *http.Client, network providerNetwork) *http.Client {
+	if network.isZero() {
+		return base
+	}
+	client := *base
+	if transport, ok := base.Transport.(*http.Transport); ok && transport != nil {
+		client.Transport = transport.Clone()
+	}
+	applyProviderNetwork(&client, network)
+	return &client
+}
+
+// endpointNetwork 测速地址对应的出站网络配置：先按完整地址匹配，再按主机匹配（测速地址可能只是 provider 地址的根路径）
+func endpointNetwork(networks map[string]providerNetwork, rawURL string) providerNetwork {
+	if len(networks) == 0 {
+		return providerNetwork{}
+	}
+	normalized := normalizeEndpointURL(rawURL)
+	if network, ok := networks[normalized]; ok {
+		return network
+	}
+	target, err := url.Parse(normalized)
+	if err != nil || target.Host == "" {
+		return providerNetwork{}
+	}
+	for endpoint, network := range networks {
+		if parsed, err := url.Parse(endpoint); err == nil && parsed.Scheme == target.Scheme && parsed.Host == target.Host {
+			return network
+		}
+	}
+	return providerNetwork{}
+}
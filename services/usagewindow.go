@@ -0,0 +1,227 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Claude 订阅账号用量窗口：订阅账号按 5 小时窗口（另有 7 天窗口）计量，上游在响应头 anthropic-ratelimit-unified-* 中
+// 给出窗口状态、已用比例与重置时间。中继按 provider 记录窗口信息；窗口用尽（状态 rejected）时让该账号冷却到窗口重置，
+// 请求自动转给其他已配置的账号，重置后冷却结束，按优先级切回原账号。
+// 窗口信息只保存在内存中，重启后在下一次请求时重新获取。
+
+const (
+	// usageWindowDuration 订阅账号的短周期窗口长度
+	usageWindowDuration = 5 * time.Hour
+
+	// 统一限流状态
+	UsageWindowAllowed  = "allowed"
+	UsageWindowWarning  = "allowed_warning"
+	UsageWindowRejected = "rejected"
+
+	// 用量窗口事件（记录在 provider 时间线中）
+	TimelineWindowExhausted = "window_exhausted"
+	TimelineWindowReset     = "window_reset"
+)
+
+// RelayUsageWindowConfig 订阅账号用量窗口配置
+type RelayUsageWindowConfig struct {
+	Enabled bool `json:"enabled"` // 窗口用尽时让账号冷却到窗口重置，请求转给其他账号
+}
+
+// UsageWindow 订阅账号的用量窗口
+type UsageWindow struct {
+	Platform          string  `json:"platform"`
+	Provider          string  `json:"provider"`
+	Status            string  `json:"status"`                      // allowed / allowed_warning / rejected
+	Claim             string  `json:"claim,omitempty"`             // 起限制作用的窗口（five_hour、seven_day 等）
+	WindowStart       int64   `json:"windowStart,omitempty"`       // 5 小时窗口开始时间（由重置时间推算）
+	ResetsAt          int64   `json:"resetsAt,omitempty"`          // 5 小时窗口重置时间
+	UsedPercent       float64 `json:"usedPercent"`                 // 5 小时窗口已用百分比
+	RemainingPercent  float64 `json:"remainingPercent"`            // 5 小时窗口剩余百分比
+	WeeklyUsedPercent float64 `json:"weeklyUsedPercent,omitempty"` // 7 天窗口已用百分比
+	WeeklyResetsAt    int64   `json:"weeklyResetsAt,omitempty"`
+	Exhausted         bool    `json:"exhausted"`             // 窗口已用尽，请求转给其他账号
+	AvailableAt       int64   `json:"availableAt,omitempty"` // 用尽时恢复可用的时间
+	Stale             bool    `json:"stale"`                 // 已过重置时间，数据待下一次请求更新
+	UpdatedAt         int64   `json:"updatedAt"`
+}
+
+// usageWindowHeaders 从响应头解析出的窗口状态
+type usageWindowHeaders struct {
+	status          string
+	claim           string
+	resetsAt        int64 // 起限制作用的窗口的重置时间
+	fiveHourStatus  string
+	fiveHourReset   int64
+	fiveHourUsed    float64 // 0-1
+	sevenDayReset   int64
+	sevenDayUsed    float64
+	hasFiveHourUsed bool
+}
+
+// exhausted 窗口是否已用尽
+func (h usageWindowHeaders) exhausted() bool {
+	return h.status == UsageWindowRejected || h.fiveHourStatus == UsageWindowRejected
+}
+
+// availableAt 用尽后恢复可用的时间，优先使用起限制作用的窗口的重置时间
+func (h usageWindowHeaders) availableAt() int64 {
+	if h.resetsAt > 0 {
+		return h.resetsAt
+	}
+	return h.fiveHourReset
+}
+
+// parseUsageWindowHeaders 解析 anthropic-ratelimit-unified-* 响应头，非订阅账号（没有这些响应头）返回 false
+func parseUsageWindowHeaders(header http.Header) (usageWindowHeaders, bool) {
+	get := func(name string) string {
+		return strings.TrimSpace(header.Get("Anthropic-Ratelimit-Unified-" + name))
+	}
+	unix := func(name string) int64 {
+		value, err := strconv.ParseInt(get(name), 10, 64)
+		if err != nil || value <= 0 {
+			return 0
+		}
+		return value
+	}
+	ratio := func(name string) (float64, bool) {
+		value, err := strconv.ParseFloat(get(name), 64)
+		if err != nil || value < 0 {
+			return 0, false
+		}
+		return math.Min(value, 1), true
+	}
+
+	parsed := usageWindowHeaders{
+		status:         strings.ToLower(get("Status")),
+		claim:          get("Representative-Claim"),
+		resetsAt:       unix("Reset"),
+		fiveHourStatus: strings.ToLower(get("5h-Status")),
+		fiveHourReset:  unix("5h-Reset"),
+		sevenDayReset:  unix("7d-Reset"),
+	}
+	parsed.fiveHourUsed, parsed.hasFiveHourUsed = ratio("5h-Utilization")
+	parsed.sevenDayUsed, _ = ratio("7d-Utilization")
+	if parsed.status == "" && parsed.fiveHourStatus == "" {
+		return usageWindowHeaders{}, false
+	}
+	return parsed, true
+}
+
+// usageWindowTracker 各 provider 的用量窗口（key: platform/provider）
+type usageWindowTracker struct {
+	mu      sync.Mutex
+	entries map[string]*UsageWindow
+}
+
+func newUsageWindowTracker() *usageWindowTracker {
+	return &usageWindowTracker{entries: make(map[string]*UsageWindow)}
+}
+
+// update 记录最新的窗口状态，返回之前是否处于用尽状态
+func (t *usageWindowTracker) update(kind, name string, parsed usageWindowHeaders, now time.Time) (wasExhausted bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := kind + "/" + name
+	window, ok := t.entries[key]
+	if !ok {
+		window = &UsageWindow{Platform: kind, Provider: name}
+		t.entries[key] = window
+	}
+	wasExhausted = window.Exhausted
+
+	window.Status = parsed.status
+	if window.Status == "" {
+		window.Status = parsed.fiveHourStatus
+	}
+	window.Claim = parsed.claim
+	window.ResetsAt = parsed.fiveHourReset
+	window.WindowStart = 0
+	if parsed.fiveHourReset > 0 {
+		window.WindowStart = parsed.fiveHourReset - int64(usageWindowDuration/time.Second)
+	}
+	if parsed.hasFiveHourUsed {
+		window.UsedPercent = parsed.fiveHourUsed * 100
+	} else if parsed.exhausted() {
+		window.UsedPercent = 100
+	}
+	window.RemainingPercent = 100 - window.UsedPercent
+	window.WeeklyUsedPercent = parsed.sevenDayUsed * 100
+	window.WeeklyResetsAt = parsed.sevenDayReset
+	window.Exhausted = parsed.exhausted()
+	window.AvailableAt = 0
+	if window.Exhausted {
+		window.AvailableAt = parsed.availableAt()
+	}
+	window.UpdatedAt = now.Unix()
+	return wasExhausted
+}
+
+// list 各 provider 的用量窗口（按平台、名称排序）
+func (t *usageWindowTracker) list(now time.Time) []UsageWindow {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]UsageWindow, 0, len(t.entries))
+	for _, window := range t.entries {
+		item := *window
+		if item.Exhausted && item.AvailableAt > 0 && now.Unix() >= item.AvailableAt {
+			item.Exhausted = false
+		}
+		item.Stale = item.ResetsAt > 0 && now.Unix() >= item.ResetsAt
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Platform != result[j].Platform {
+			return result[i].Platform < result[j].Platform
+		}
+		return result[i].Provider < result[j].Provider
+	})
+	return result
+}
+
+// observeUsageWindow 记录 Claude 订阅账号的用量窗口；窗口用尽时让账号冷却到窗口重置并返回冷却时间，
+// 请求随后按降级/拉黑流程转给其他账号
+func (prs *ProviderRelayService) observeUsageWindow(kind, name string, status int, header http.Header) (time.Duration, bool) {
+	if kind != "claude" || header == nil || !currentRelayConfig().UsageWindow.Enabled {
+		return 0, false
+	}
+	parsed, ok := parseUsageWindowHeaders(header)
+	if !ok {
+		return 0, false
+	}
+	now := time.Now()
+	wasExhausted := prs.usageWindows.update(kind, name, parsed, now)
+
+	if !parsed.exhausted() {
+		if wasExhausted {
+			fmt.Printf("[USAGE] 账号 %s 的用量窗口已重置，恢复使用\n", name)
+			recordProviderEvent(kind, name, TimelineWindowReset, "", "用量窗口已重置")
+		}
+		return 0, false
+	}
+
+	resetAt := parsed.availableAt()
+	if status != http.StatusTooManyRequests || resetAt <= now.Unix() {
+		return 0, false
+	}
+	wait := time.Unix(resetAt, 0).Sub(now)
+	prs.cooldowns.set(kind, name, status, wait, now)
+	if !wasExhausted {
+		resetText := time.Unix(resetAt, 0).Format("01-02 15:04")
+		fmt.Printf("[USAGE] ⏳ 账号 %s 的用量窗口已用尽（%s），%s 重置前请求转给其他账号\n", name, parsed.claim, resetText)
+		recordProviderEvent(kind, name, TimelineWindowExhausted, "", fmt.Sprintf("用量窗口已用尽，%s 重置", resetText))
+	}
+	return wait, true
+}
+
+// GetUsageWindows 列出订阅账号的用量窗口（供前端调用）
+func (prs *ProviderRelayService) GetUsageWindows() []UsageWindow {
+	return prs.usageWindows.list(time.Now())
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseUsageWindowHeaders(t *testing.T) {
+	if _, ok := parseUsageWindowHeaders(http.Header{"Retry-After": {"30"}}); ok {
+		t.Fatalf("没有 unified 响应头时不应识别为订阅账号")
+	}
+
+	header := http.Header{}
+	header.Set("anthropic-ratelimit-unified-status", "rejected")
+	header.Set("anthropic-ratelimit-unified-representative-claim", "five_hour")
+	header.Set("anthropic-ratelimit-unified-reset", "1760000000")
+	header.Set("anthropic-ratelimit-unified-5h-status", "rejected")
+	header.Set("anthropic-ratelimit-unified-5h-reset", "1760000000")
+	header.Set("anthropic-ratelimit-unified-5h-utilization", "1.02")
+	header.Set("anthropic-ratelimit-unified-7d-utilization", "0.4")
+
+	parsed, ok := parseUsageWindowHeaders(header)
+	if !ok || !parsed.exhausted() {
+		t.Fatalf("parsed = %+v, ok = %v, want exhausted", parsed, ok)
+	}
+	if parsed.availableAt() != 1760000000 || parsed.fiveHourUsed != 1 || parsed.sevenDayUsed != 0.4 {
+		t.Fatalf("parsed = %+v", parsed)
+	}
+
+	tracker := newUsageWindowTracker()
+	now := time.Unix(1759990000, 0)
+	if tracker.update("claude", "pro-a", parsed, now) {
+		t.Fatalf("首次记录不应视为之前已用尽")
+	}
+	windows := tracker.list(now)
+	if len(windows) != 1 || !windows[0].Exhausted || windows[0].WindowStart != 1760000000-5*3600 || windows[0].RemainingPercent != 0 {
+		t.Fatalf("windows = %+v", windows)
+	}
+	if !tracker.update("claude", "pro-a", usageWindowHeaders{status: UsageWindowAllowed}, now.Add(time.Minute)) {
+		t.Fatalf("用尽后再次记录应返回之前已用尽")
+	}
+	if windows := tracker.list(time.Unix(1760000001, 0)); windows[0].Exhausted {
+		t.Fatalf("窗口重置后不应仍为用尽状态: %+v", windows[0])
+	}
+}